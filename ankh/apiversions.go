@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/schema"
+)
+
+// clusterMinorVersions caches the Kubernetes 1.x minor version of each context's cluster, or -1 if it's unknown.
+var clusterMinorVersions = make(map[string]int)
+
+func clusterMinorVersion(ctx *ankh.ExecutionContext) int {
+	// When linting against a particular version, there's no need to ask the cluster.
+	if ctx.Mode == ankh.Lint {
+		version := ctx.Options.SchemaKubernetesVersion
+		if version == "" {
+			version = ctx.AnkhConfig.Lint.KubernetesVersion
+		}
+		if major, minor, ok := parseMajorMinor(schema.NormalizeVersion(version) + "."); ok && major == 1 {
+			return minor
+		}
+	}
+
+	name := ctx.AnkhConfig.CurrentContextName
+	if minor, ok := clusterMinorVersions[name]; ok {
+		return minor
+	}
+
+	minor := -1
+	if binaryMissing("kubectl") {
+		clusterMinorVersions[name] = minor
+		return minor
+	}
+	major, m, err := kubectl.ServerVersion(ctx)
+	if err != nil {
+		ctx.Logger.Warnf("Unable to detect the Kubernetes version of context '%v', so checking against every known apiVersion deprecation: %v", name, err)
+	} else if major != 1 {
+		ctx.Logger.Warnf("Context '%v' runs Kubernetes %v.%v, which Ankh doesn't know apiVersion deprecations for", name, major, m)
+	} else {
+		ctx.Logger.Debugf("Context '%v' runs Kubernetes %v.%v", name, major, m)
+		minor = m
+	}
+	clusterMinorVersions[name] = minor
+	return minor
+}
+
+// checkDeprecatedAPIs warns about rendered objects that use apiVersions the
+// current context's cluster has deprecated, and returns errors for those it
+// no longer serves.
+func checkDeprecatedAPIs(ctx *ankh.ExecutionContext, helmOutput string) []error {
+	removed, deprecated := helm.DeprecatedAPIs(helmOutput, clusterMinorVersion(ctx))
+	for _, err := range deprecated {
+		ctx.Logger.Warnf("%v", err)
+	}
+	return removed
+}
+
+// schemaValidators are shared across charts and contexts, so that each schema is only read once.
+var schemaValidators = make(map[string]*schema.Validator)
+
+// schemaKubernetesVersion decides which Kubernetes version to validate against:
+// `--kubernetes-version`, then `lint.kubernetesVersion`, then the version of
+// the current context's cluster, and otherwise the latest schemas.
+func schemaKubernetesVersion(ctx *ankh.ExecutionContext) string {
+	if ctx.Options.SchemaKubernetesVersion != "" {
+		return ctx.Options.SchemaKubernetesVersion
+	}
+	if ctx.AnkhConfig.Lint.KubernetesVersion != "" {
+		return ctx.AnkhConfig.Lint.KubernetesVersion
+	}
+	if minor := clusterMinorVersion(ctx); minor >= 0 {
+		return fmt.Sprintf("1.%v", minor)
+	}
+	return "master"
+}
+
+// validateSchemas returns an error for each problem found validating the
+// rendered objects against the Kubernetes schemas.
+func validateSchemas(ctx *ankh.ExecutionContext, helmOutput string) []error {
+	if ctx.Options.SkipSchemaValidation {
+		return []error{}
+	}
+
+	version := schema.NormalizeVersion(schemaKubernetesVersion(ctx))
+	validator, ok := schemaValidators[version]
+	if !ok {
+		ctx.Logger.Debugf("Validating objects against Kubernetes %v schemas", version)
+		validator = schema.NewValidator(ctx, ctx.AnkhConfig.Lint.SchemaLocation, version)
+		schemaValidators[version] = validator
+	}
+	return validator.Validate(helmOutput)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// takeAtomicSnapshot records the live state of the objects in helmOutput
+// before `apply --atomic` changes them.
+func takeAtomicSnapshot(ctx *ankh.ExecutionContext, namespace string, helmOutput string) kubectl.Snapshot {
+	snapshot, err := kubectl.TakeSnapshot(ctx, namespace, helmOutput)
+	if err != nil {
+		fatalf(exitApplyFailed, "Refusing to apply atomically: %v", err)
+	}
+	if len(snapshot.Unrestorable) > 0 {
+		ctx.Logger.Warnf("[ %v ] in namespace \"%v\" weren't created by `kubectl apply`, so they can't be restored if this apply fails",
+			strings.Join(snapshot.Unrestorable, ", "), namespace)
+	}
+	ctx.Logger.Debugf("Took a snapshot of %v existing object(s) in namespace \"%v\"", len(snapshot.Existing), namespace)
+	return snapshot
+}
+
+// revertAtomicApply restores snapshot after `apply --atomic` failed with
+// cause, records the revert in the audit log, and exits with code.
+func revertAtomicApply(ctx *ankh.ExecutionContext, snapshot kubectl.Snapshot, helmOutput string, cause error, code int) {
+	ctx.Logger.Errorf("%v", cause)
+	ctx.Logger.Warnf("Reverting the apply to namespace \"%v\"", snapshot.Namespace)
+
+	message := fmt.Sprintf("Reverted apply: %v", cause)
+	err := kubectl.RestoreSnapshot(ctx, snapshot, helmOutput)
+	if err != nil {
+		message = fmt.Sprintf("Failed to revert apply (%v): %v", cause, err)
+	}
+	if err := ctx.Audit(ankh.AuditEntry{Namespace: snapshot.Namespace, Message: message}); err != nil {
+		ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+	}
+	if err != nil {
+		ctx.Logger.Errorf("%v. Objects in namespace \"%v\" may be left partially applied", err, snapshot.Namespace)
+	} else {
+		ctx.Logger.Infof("Reverted namespace \"%v\" to its state before the apply", snapshot.Namespace)
+	}
+	exit(code)
+}
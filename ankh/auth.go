@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/appnexus/ankh/config"
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// authenticateContexts logs in to each of contexts whose kubectl credentials
+// come from an exec plugin that may prompt, before anything else runs. kubectl
+// normally runs with its output captured, which would hide the plugin's device
+// code or browser login prompt and leave ankh looking frozen. Doing this up
+// front also means that every context of an environment is logged in to before
+// the first one is changed.
+func authenticateContexts(ctx *ankh.ExecutionContext, contexts []string) {
+	switch ctx.Mode {
+	case ankh.Template, ankh.Resources, ankh.Lint, ankh.Explain, ankh.Values:
+		// These don't talk to clusters, or don't need to.
+		return
+	}
+	if binaryMissing("kubectl") {
+		return
+	}
+
+	plugins, err := config.KubeConfigExecPlugins(ctx.KubeConfigPath)
+	if err != nil {
+		ctx.Logger.Debugf("Unable to check kubeconfig for exec credential plugins: %v", err)
+		return
+	}
+	if len(plugins) == 0 {
+		return
+	}
+
+	for _, context := range contexts {
+		ankhContext := ctx.AnkhConfig.Contexts[context]
+		plugin, ok := plugins[ankhContext.KubeContext]
+		if ankhContext.KubeServer != "" || !ok {
+			continue
+		}
+
+		if context != ctx.AnkhConfig.CurrentContextName {
+			switchContext(ctx, &ctx.AnkhConfig, context)
+		}
+		ctx.Logger.Infof("Authenticating to context \"%v\" using kubectl credential plugin `%v`. Follow any prompts it shows", context, plugin)
+		if err := kubectl.Authenticate(ctx); err != nil {
+			fatalf(exitFailure, "Failed to authenticate to context \"%v\": %v", context, err)
+		}
+	}
+}
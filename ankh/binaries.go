@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// missingBinaries are the external tools that were looked for and not found on the PATH.
+var missingBinaries = make(map[string]bool)
+
+func binaryMissing(name string) bool {
+	if missing, ok := missingBinaries[name]; ok {
+		return missing
+	}
+	_, err := exec.LookPath(name)
+	missingBinaries[name] = err != nil
+	return missingBinaries[name]
+}
+
+// requireBinaries fails command up front when any of the tools it runs are
+// missing, rather than half way through, eg: after applying some charts.
+func requireBinaries(ctx *ankh.ExecutionContext, command string, names ...string) {
+	missing := []string{}
+	for _, name := range names {
+		if binaryMissing(name) {
+			missing = append(missing, name)
+		}
+	}
+	switch len(missing) {
+	case 0:
+	case 1:
+		fatalf(exitPreconditionFailed, "`ankh %v` needs %v, but %v was not found on your PATH. Install it, or run ankh somewhere that has it",
+			command, strings.Join(names, " and "), missing[0])
+	default:
+		fatalf(exitPreconditionFailed, "`ankh %v` needs %v, but %v were not found on your PATH. Install them, or run ankh somewhere that has them",
+			command, strings.Join(names, " and "), strings.Join(missing, " and "))
+	}
+}
+
+func onlyManifests(ankhFile ankh.AnkhFile) bool {
+	if len(ankhFile.Dependencies) > 0 {
+		return false
+	}
+	for _, chart := range ankhFile.Charts {
+		if !chart.IsManifests() {
+			return false
+		}
+	}
+	return true
+}
+
+// checkModeBinaries makes sure the tools that ctx.Mode runs on rootAnkhFile are
+// available. Where ankh can do without a tool, it carries on without it:
+// explain and values don't run either, Ankh files made only of plain manifests
+// don't need helm, and lint can validate objects without asking the
+// cluster for its version.
+func checkModeBinaries(ctx *ankh.ExecutionContext, rootAnkhFile ankh.AnkhFile) {
+	if ctx.Mode == ankh.Explain || ctx.Mode == ankh.Values || ctx.Mode == ankh.Export {
+		// explain only prints the helm and kubectl commands that apply would run, and values and export merge values themselves.
+		return
+	}
+
+	required := []string{}
+	if onlyManifests(rootAnkhFile) {
+		if binaryMissing("helm") {
+			ctx.Logger.Infof("Continuing without helm, which was not found on your PATH, since every chart is plain manifests")
+		}
+	} else {
+		required = append(required, "helm")
+	}
+
+	switch ctx.Mode {
+	case ankh.Template, ankh.Resources:
+	case ankh.GitOps:
+		required = append(required, "git")
+	case ankh.Lint:
+		if binaryMissing("kubectl") {
+			ctx.Logger.Infof("Continuing without kubectl, which was not found on your PATH, so lint won't check clusters for their Kubernetes version")
+		}
+	default:
+		required = append(required, "kubectl")
+	}
+	if policiesApply(ctx) {
+		required = append(required, "opa")
+	}
+	if scanApplies(ctx) && ctx.Options.SkipScan == "" {
+		required = append(required, "trivy")
+	}
+	if cosignEnabled(ctx) {
+		required = append(required, "cosign")
+	}
+	requireBinaries(ctx, string(ctx.Mode), required...)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// ciResult is written as JSON at the end of `ankh ci`, whether it succeeds or not.
+type ciResult struct {
+	Status         string              `json:"status"`
+	ExitCode       int                 `json:"exitCode"`
+	AnkhFilePath   string              `json:"ankhFilePath"`
+	Environment    string              `json:"environment,omitempty"`
+	Context        string              `json:"context,omitempty"`
+	DryRun         bool                `json:"dryRun,omitempty"`
+	LintResults    []ankh.LintResult   `json:"lintResults"`
+	ApplySummaries []ankh.ApplySummary `json:"applySummaries"`
+}
+
+func newCIResult(ctx *ankh.ExecutionContext, code int) ciResult {
+	status := "succeeded"
+	switch code {
+	case 0:
+	case exitLintFailed:
+		status = "lint-failed"
+	case exitPolicyDenied:
+		status = "policy-denied"
+	default:
+		status = "failed"
+	}
+	result := ciResult{
+		Status:         status,
+		ExitCode:       code,
+		AnkhFilePath:   ctx.AnkhFilePath,
+		Environment:    ctx.Environment,
+		DryRun:         ctx.DryRun,
+		LintResults:    ctx.LintResults,
+		ApplySummaries: ctx.ApplySummaries,
+	}
+	if ctx.Environment == "" {
+		result.Context = ctx.AnkhConfig.CurrentContextName
+	}
+	if result.LintResults == nil {
+		result.LintResults = []ankh.LintResult{}
+	}
+	if result.ApplySummaries == nil {
+		result.ApplySummaries = []ankh.ApplySummary{}
+	}
+	return result
+}
+
+// writeCIOutputs writes the results of `ankh ci` as JSON to resultsPath, and
+// its lint results as JUnit XML to junitPath, for whichever are set.
+func writeCIOutputs(ctx *ankh.ExecutionContext, code int, resultsPath string, junitPath string) {
+	if junitPath != "" {
+		body, err := lintJUnit(ctx.LintResults)
+		if err == nil {
+			err = ioutil.WriteFile(junitPath, body, 0644)
+		}
+		if err != nil {
+			ctx.Logger.Warnf("Failed to write JUnit lint results to %v: %v", junitPath, err)
+		}
+	}
+	if resultsPath != "" {
+		body, err := json.MarshalIndent(newCIResult(ctx, code), "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(resultsPath, append(body, '\n'), 0644)
+		}
+		if err != nil {
+			ctx.Logger.Warnf("Failed to write results to %v: %v", resultsPath, err)
+		}
+	}
+}
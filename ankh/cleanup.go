@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// defaultJobTTL is how long after they complete that succeeded Jobs are kept, without `cleanup.job-ttl`.
+const defaultJobTTL = 24 * time.Hour
+
+// cleanupNamespace deletes the succeeded Jobs of charts that completed longer
+// than `cleanup.job-ttl` ago, and the old ReplicaSets of their Deployments
+// beyond `revisionHistoryLimit`, when the current context enables cleanup.
+// Cleanup is best effort, so failures are only warned about.
+func cleanupNamespace(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	cleanup := ctx.AnkhConfig.CurrentContext.Cleanup
+	if !cleanup.Enabled || ctx.DryRun {
+		return
+	}
+
+	ttl := defaultJobTTL
+	if cleanup.JobTTL != "" {
+		d, err := time.ParseDuration(cleanup.JobTTL)
+		if err != nil {
+			ctx.Logger.Warnf("Skipping cleanup of namespace \"%v\", since `cleanup.job-ttl` '%v' is invalid: %v", namespace, cleanup.JobTTL, err)
+			return
+		}
+		ttl = d
+	}
+
+	names := []string{}
+	for _, chart := range charts {
+		names = append(names, chart.Name)
+	}
+	jobs, err := kubectl.StaleJobs(ctx, helmOutput, namespace, names, ttl)
+	if err != nil {
+		ctx.Logger.Warnf("Unable to find Jobs to clean up in namespace \"%v\": %v", namespace, err)
+	}
+	replicaSets, err := kubectl.ExcessReplicaSets(ctx, helmOutput, namespace)
+	if err != nil {
+		ctx.Logger.Warnf("Unable to find ReplicaSets to clean up in namespace \"%v\": %v", namespace, err)
+	}
+
+	objects := append(jobs, replicaSets...)
+	if len(objects) == 0 {
+		return
+	}
+	if err := kubectl.DeleteObjects(ctx, namespace, objects); err != nil {
+		ctx.Logger.Warnf("%v", err)
+		return
+	}
+	ctx.Logger.Infof("Cleaned up %v succeeded Jobs and %v old ReplicaSets in namespace \"%v\"", len(jobs), len(replicaSets), namespace)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// completionCommands maps each top level command to its subcommands, if any.
+// mow.cli doesn't expose its command tree, so keep this in sync with main().
+var completionCommands = map[string][]string{
+	"apply":        nil,
+	"chart":        {"ls", "versions", "inspect", "publish", "cache", "bump"},
+	"ci":           nil,
+	"config":       {"init", "view", "get-contexts", "get-environments", "use-context", "current-context", "set-context", "delete-context", "rename-context", "import-kubeconfig", "migrate", "doctor"},
+	"convert":      {"helmfile"},
+	"cp":           nil,
+	"describe":     nil,
+	"diff":         nil,
+	"drift":        nil,
+	"events":       nil,
+	"exec":         nil,
+	"explain":      nil,
+	"export":       {"flux"},
+	"features":     {"list"},
+	"fleet":        {"status"},
+	"get":          nil,
+	"gitops":       {"push"},
+	"image":        {"tags", "ls"},
+	"lint":         nil,
+	"lock":         {"status", "release"},
+	"login":        {"registry", "docker"},
+	"logs":         nil,
+	"plugin":       {"list", "run"},
+	"pods":         nil,
+	"port-forward": nil,
+	"resources":    nil,
+	"restart":      nil,
+	"rollback":     nil,
+	"run-job":      nil,
+	"scale":        nil,
+	"serve":        nil,
+	"status":       nil,
+	"template":     nil,
+	"top":          nil,
+	"values":       nil,
+	"version":      nil,
+	"wait":         nil,
+	"watch":        nil,
+	"watch-drift":  nil,
+	"workspace":    {"ls", "view"},
+	"completion":   {"bash", "zsh", "fish"},
+}
+
+// Global options that take a value, so the completion scripts can skip over them when finding commands.
+var completionValueOpts = []string{"-c", "--context", "-e", "--environment", "-n", "--namespace", "-r", "--release",
+	"--ankhconfig", "--kubeconfig", "--datadir", "--config-cache-ttl", "--workspace", "--actor", "--log-format", "--timeout", "--max-concurrency", "--set"}
+
+type completionData struct {
+	Commands    []string
+	Subcommands map[string]string
+	ValueOpts   string
+}
+
+func newCompletionData() completionData {
+	data := completionData{
+		Subcommands: make(map[string]string),
+		ValueOpts:   strings.Join(completionValueOpts, "|"),
+	}
+	for command, subcommands := range completionCommands {
+		data.Commands = append(data.Commands, command)
+		if len(subcommands) > 0 {
+			data.Subcommands[command] = strings.Join(subcommands, " ")
+		}
+	}
+	sort.Strings(data.Commands)
+	return data
+}
+
+const bashCompletionTemplate = `# bash completion for ankh. Load it using: source <(ankh completion bash)
+_ankh_completion_values() {
+    ankh -q completion values "$@" 2>/dev/null
+}
+
+_ankh() {
+    local cur prev cmd sub ankhfile i w
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    cmd=""
+    sub=""
+    ankhfile="ankh.yaml"
+
+    for (( i=1; i < COMP_CWORD; i++ )); do
+        w="${COMP_WORDS[i]}"
+        case "$w" in
+            -f|--filename)
+                ankhfile="${COMP_WORDS[i+1]}"
+                ;;
+        esac
+        if [[ -z "$cmd" ]]; then
+            case "$w" in
+                {{ .ValueOpts }})
+                    (( i++ ))
+                    ;;
+                -*)
+                    ;;
+                *)
+                    cmd="$w"
+                    ;;
+            esac
+        elif [[ -z "$sub" && "$w" != -* ]]; then
+            sub="$w"
+        fi
+    done
+
+    if [[ -z "$cmd" ]]; then
+        case "$prev" in
+            -c|--context)
+                COMPREPLY=( $(compgen -W "$(_ankh_completion_values contexts)" -- "$cur") )
+                return
+                ;;
+            -e|--environment)
+                COMPREPLY=( $(compgen -W "$(_ankh_completion_values environments)" -- "$cur") )
+                return
+                ;;
+        esac
+    fi
+
+    if [[ "$prev" == "--chart" ]]; then
+        COMPREPLY=( $(compgen -W "$(_ankh_completion_values -f "$ankhfile" charts)" -- "$cur") )
+        return
+    fi
+
+    if [[ -z "$cmd" ]]; then
+        COMPREPLY=( $(compgen -W "{{ join .Commands " " }}" -- "$cur") )
+        return
+    fi
+
+    if [[ -z "$sub" ]]; then
+        case "$cmd" in
+{{- range $command, $subcommands := .Subcommands }}
+            {{ $command }})
+                COMPREPLY=( $(compgen -W "{{ $subcommands }}" -- "$cur") )
+                ;;
+{{- end }}
+        esac
+    fi
+}
+
+complete -o default -F _ankh ankh
+`
+
+const zshCompletionTemplate = `# zsh completion for ankh. Load it using: source <(ankh completion zsh)
+autoload -U +X bashcompinit && bashcompinit
+` + bashCompletionTemplate
+
+const fishCompletionTemplate = `# fish completion for ankh. Load it using: ankh completion fish | source
+complete -c ankh -f
+complete -c ankh -n '__fish_use_subcommand' -s c -l context -x -a '(ankh -q completion values contexts 2>/dev/null)' -d 'The context to use'
+complete -c ankh -n '__fish_use_subcommand' -s e -l environment -x -a '(ankh -q completion values environments 2>/dev/null)' -d 'The environment to use'
+complete -c ankh -l chart -x -a '(ankh -q completion values charts 2>/dev/null)' -d 'Limit the command to a chart'
+complete -c ankh -n '__fish_use_subcommand' -a '{{ join .Commands " " }}'
+{{- range $command, $subcommands := .Subcommands }}
+complete -c ankh -n '__fish_seen_subcommand_from {{ $command }}' -a '{{ $subcommands }}'
+{{- end }}
+`
+
+// completionScript renders the completion script for a shell.
+func completionScript(shell string) (string, error) {
+	templates := map[string]string{
+		"bash": bashCompletionTemplate,
+		"zsh":  zshCompletionTemplate,
+		"fish": fishCompletionTemplate,
+	}
+	text, ok := templates[shell]
+	if !ok {
+		return "", fmt.Errorf("Unsupported shell '%v'. Must be one of 'bash', 'zsh', or 'fish'", shell)
+	}
+
+	tmpl, err := template.New(shell).Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, newCompletionData()); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// completionValues returns the dynamic values used by the completion scripts.
+func completionValues(ctx *ankh.ExecutionContext, kind string, ankhFilePath string) ([]string, error) {
+	values := []string{}
+	switch kind {
+	case "contexts":
+		for name, _ := range ctx.AnkhConfig.Contexts {
+			values = append(values, name)
+		}
+	case "environments":
+		for name, _ := range ctx.AnkhConfig.Environments {
+			values = append(values, name)
+		}
+	case "charts":
+		ankhFile, err := ankh.ParseAnkhFile(ankhFilePath)
+		if err != nil {
+			// Completion should never complain, there's just nothing to complete.
+			return values, nil
+		}
+		for _, chart := range ankhFile.Charts {
+			values = append(values, chart.Name)
+		}
+	default:
+		return values, fmt.Errorf("Unsupported completion values '%v'. Must be one of 'contexts', 'environments', or 'charts'", kind)
+	}
+	sort.Strings(values)
+	return values, nil
+}
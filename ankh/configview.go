@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/config"
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// configOutputFormats are the formats that `config get-contexts` and `config
+// get-environments` print in. `config view` prints the structured ones.
+var configOutputFormats = []string{"table", "json", "yaml"}
+
+type contextView struct {
+	Name             string `json:"name" yaml:"name"`
+	Release          string `json:"release,omitempty" yaml:"release,omitempty"`
+	EnvironmentClass string `json:"environment-class,omitempty" yaml:"environment-class,omitempty"`
+	ResourceProfile  string `json:"resource-profile,omitempty" yaml:"resource-profile,omitempty"`
+	KubeContext      string `json:"kube-context,omitempty" yaml:"kube-context,omitempty"`
+	KubeServer       string `json:"kube-server,omitempty" yaml:"kube-server,omitempty"`
+	Source           string `json:"source" yaml:"source"`
+}
+
+type environmentView struct {
+	Name     string   `json:"name" yaml:"name"`
+	Contexts []string `json:"contexts" yaml:"contexts"`
+	Source   string   `json:"source" yaml:"source"`
+}
+
+func validateConfigOutput(format string, formats []string) {
+	if !util.Contains(formats, format) {
+		fatalf(exitConfigError, "Invalid output format '%v', must be one of [ %v ]", format, strings.Join(formats, ", "))
+	}
+}
+
+// kubeServers maps kube-contexts to the servers of their clusters, or is empty
+// when the kubeconfig can't be read, since the servers are only informational.
+func kubeServers(ctx *ankh.ExecutionContext) map[string]string {
+	servers, err := config.KubeConfigServers(ctx.KubeConfigPath)
+	if err != nil {
+		ctx.Logger.Debugf("Unable to resolve kube-context servers: %v", err)
+	}
+	return servers
+}
+
+// contextViews describes each context, sorted by name, resolving the server
+// of contexts that use a kube-context.
+func contextViews(ctx *ankh.ExecutionContext) []contextView {
+	servers := kubeServers(ctx)
+	views := []contextView{}
+	for name, context := range ctx.AnkhConfig.Contexts {
+		view := contextView{
+			Name:             name,
+			Release:          context.Release,
+			EnvironmentClass: context.EnvironmentClass,
+			ResourceProfile:  context.ResourceProfile,
+			KubeContext:      context.KubeContext,
+			KubeServer:       context.KubeServer,
+			Source:           context.Source,
+		}
+		if view.KubeServer == "" {
+			view.KubeServer = servers[context.KubeContext]
+		}
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+func environmentViews(ctx *ankh.ExecutionContext) []environmentView {
+	views := []environmentView{}
+	for name, env := range ctx.AnkhConfig.Environments {
+		contexts := env.Contexts
+		if contexts == nil {
+			contexts = []string{}
+		}
+		views = append(views, environmentView{Name: name, Contexts: contexts, Source: env.Source})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// configView is the merged Ankh config as generic values, with the source
+// of each context and environment, and the resolved server of each context.
+func configView(ctx *ankh.ExecutionContext) (map[string]interface{}, error) {
+	out, err := yaml.Marshal(ctx.AnkhConfig)
+	if err != nil {
+		return nil, err
+	}
+	generic := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(out, &generic); err != nil {
+		return nil, err
+	}
+	view := util.NormalizeYAMLMap(generic).(map[string]interface{})
+
+	if contexts, ok := view["contexts"].(map[string]interface{}); ok {
+		for _, context := range contextViews(ctx) {
+			if values, ok := contexts[context.Name].(map[string]interface{}); ok {
+				values["source"] = context.Source
+				if context.KubeServer != "" {
+					values["kube-server"] = context.KubeServer
+				}
+			}
+		}
+	}
+	if environments, ok := view["environments"].(map[string]interface{}); ok {
+		for name, env := range ctx.AnkhConfig.Environments {
+			if values, ok := environments[name].(map[string]interface{}); ok {
+				values["source"] = env.Source
+			}
+		}
+	}
+	return view, nil
+}
+
+// formatStructured formats v as json or yaml.
+func formatStructured(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		body, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(body, '\n'), nil
+	case "yaml":
+		return yaml.Marshal(v)
+	}
+	return nil, fmt.Errorf("Invalid output format '%v'", format)
+}
+
+func printContextViews(views []contextView) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 8, ' ', 0)
+	fmt.Fprintf(w, "NAME\tRELEASE\tENVIRONMENT-CLASS\tRESOURCE-PROFILE\tKUBE-CONTEXT/SERVER\tSOURCE\n")
+	for _, view := range views {
+		target := view.KubeContext
+		if target == "" {
+			target = view.KubeServer
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", view.Name, view.Release, view.EnvironmentClass, view.ResourceProfile, target, view.Source)
+	}
+	w.Flush()
+}
+
+func printEnvironmentViews(views []environmentView) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 8, ' ', 0)
+	fmt.Fprintf(w, "NAME\tCONTEXTS\tSOURCE\n")
+	for _, view := range views {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", view.Name, strings.Join(view.Contexts, ","), view.Source)
+	}
+	w.Flush()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/util"
+)
+
+// The choices for each object that `apply --confirm` would change.
+const (
+	confirmApplyObject    = "Apply"
+	confirmSkipObject     = "Skip"
+	confirmRecreateObject = "Recreate"
+	confirmAbortAll       = "Abort all"
+)
+
+// confirmApply shows what applying helmOutput would change in namespace, one
+// object at a time, and asks whether to apply, skip or recreate each of them,
+// or abort before anything is applied. Conflicts are called out: changes to
+// immutable fields, which only recreating the object can apply, and objects
+// edited by hand since they were last applied, whose edits applying undoes.
+// The objects to recreate are deleted, and what's left to apply is returned.
+func confirmApply(ctx *ankh.ExecutionContext, namespace string, helmOutput string) string {
+	if ctx.NoPrompt {
+		fatalf(exitConfigError, "`apply --confirm` asks about each change, but prompts are disabled")
+	}
+
+	docs := kubectl.ObjectDocuments(helmOutput, namespace)
+	objects := []string{}
+	for object := range docs {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+
+	changed := []string{}
+	diffs := make(map[string]string)
+	immutable := make(map[string]string)
+	for _, object := range objects {
+		diff, drifted, err := kubectl.Drift(ctx, docs[object], namespace, nil)
+		if err != nil && strings.Contains(err.Error(), "immutable") {
+			immutable[object] = err.Error()
+		} else {
+			check(err)
+			if len(drifted) == 0 {
+				continue
+			}
+			diffs[object] = diff
+		}
+		changed = append(changed, object)
+	}
+	if len(changed) == 0 {
+		ctx.Logger.Infof("Nothing would change in namespace \"%v\"", namespace)
+		return helmOutput
+	}
+
+	edited := []string{}
+	for ns, objects := range objectsByNamespace(changed) {
+		e, err := kubectl.HandEdits(ctx, ns, objects)
+		check(err)
+		for _, object := range e {
+			edited = append(edited, kubectl.ObjectKey(object, ns))
+		}
+	}
+
+	skip, recreate := []string{}, []string{}
+	for _, object := range changed {
+		choices := []string{confirmApplyObject, confirmSkipObject, confirmRecreateObject, confirmAbortAll}
+		if reason, ok := immutable[object]; ok {
+			ctx.Logger.Warnf("Applying %v would change immutable fields, so it can only be recreated: %v", object, reason)
+			choices = []string{confirmRecreateObject, confirmSkipObject, confirmAbortAll}
+		} else {
+			fmt.Println(diffs[object])
+			if util.Contains(edited, object) {
+				ctx.Logger.Warnf("%v was edited by hand since it was last applied, and applying it undoes those edits", object)
+			}
+		}
+
+		selection, err := util.PromptForSelection(choices, fmt.Sprintf("What should be done with %v in namespace \"%v\"?", object, namespace))
+		check(err)
+		switch selection {
+		case confirmSkipObject:
+			skip = append(skip, object)
+		case confirmRecreateObject:
+			recreate = append(recreate, object)
+		case confirmAbortAll:
+			fatalf(exitFailure, "Aborting")
+		}
+	}
+
+	if len(skip) > 0 {
+		ctx.Logger.Infof("Skipping [ %v ] in namespace \"%v\"", strings.Join(skip, ", "), namespace)
+		helmOutput = kubectl.WithoutObjects(helmOutput, namespace, skip)
+	}
+	for ns, objects := range objectsByNamespace(recreate) {
+		ctx.Logger.Warnf("Deleting [ %v ] from namespace \"%v\" to recreate them", strings.Join(objects, ", "), ns)
+		check(kubectl.DeleteObjects(ctx, ns, objects))
+	}
+	return helmOutput
+}
+
+// objectsByNamespace groups objects, which are `kind/namespace/name` like
+// kubectl.ObjectDocuments, into the `kind/name` of the objects in each
+// namespace, which is how kubectl refers to them.
+func objectsByNamespace(objects []string) map[string][]string {
+	grouped := make(map[string][]string)
+	for _, key := range objects {
+		object, namespace := kubectl.SplitObjectKey(key)
+		grouped[namespace] = append(grouped[namespace], object)
+	}
+	return grouped
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/cosign"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// cosignEnabled is true when applying to the current context, or any context
+// of the environment, verifies cosign signatures.
+func cosignEnabled(ctx *ankh.ExecutionContext) bool {
+	if ctx.Mode != ankh.Apply {
+		return false
+	}
+	contexts := []string{ctx.AnkhConfig.CurrentContextName}
+	if ctx.Environment != "" {
+		contexts = ctx.AnkhConfig.Environments[ctx.Environment].Contexts
+	}
+	for _, name := range contexts {
+		if ctx.AnkhConfig.Contexts[name].Cosign.Enabled {
+			return true
+		}
+	}
+	return ctx.AnkhConfig.CurrentContext.Cosign.Enabled
+}
+
+// verifyImageSignatures verifies the cosign signature of each image that the
+// objects about to be applied run, returning an error for each image whose
+// signature can't be verified.
+func verifyImageSignatures(ctx *ankh.ExecutionContext, helmOutput string) []error {
+	if !cosign.Applies(ctx) {
+		return []error{}
+	}
+	images, err := kubectl.Images(helmOutput)
+	if err != nil {
+		fatalf(exitTemplateError, "%v", err)
+	}
+	errs := []error{}
+	for _, image := range images {
+		if err := cosign.VerifyImage(ctx, image); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/vcs"
+)
+
+// diffSection is the diff of one namespace of one context.
+type diffSection struct {
+	Context   string
+	Namespace string
+	Diff      string
+}
+
+var diffSections = []diffSection{}
+
+// diffFoundChanges is set when `diff` finds any difference, to exit with exitDiffChanges.
+var diffFoundChanges bool
+
+// noteDiff notes whether the diff of namespace found any difference, and
+// records its output to comment with `--post-comment`.
+func noteDiff(ctx *ankh.ExecutionContext, namespace string, output string, differs bool) {
+	if differs {
+		diffFoundChanges = true
+	}
+	if ctx.Options.DiffPostComment {
+		recordDiff(ctx, namespace, output)
+	}
+}
+
+// finishDiff comments the diffs, when asked to, and exits with
+// exitDiffChanges when any of them found a difference.
+func finishDiff(ctx *ankh.ExecutionContext, pr vcs.PullRequest) {
+	if ctx.Options.DiffPostComment {
+		postDiffComment(ctx, pr)
+	}
+	if diffFoundChanges {
+		exit(exitDiffChanges)
+	}
+	os.Exit(0)
+}
+
+func recordDiff(ctx *ankh.ExecutionContext, namespace string, output string) {
+	diffSections = append(diffSections, diffSection{
+		Context:   ctx.AnkhConfig.CurrentContextName,
+		Namespace: namespace,
+		Diff:      output,
+	})
+}
+
+// diffSectionReserve is kept free for each section yet to be written, so that
+// a long diff can't crowd out the summaries of the sections after it.
+const diffSectionReserve = 300
+
+// formatDiffComment formats sections as Markdown, with each diff collapsed,
+// and truncated where needed to fit the comment in max bytes.
+func formatDiffComment(ankhFilePath string, sections []diffSection, max int) string {
+	var comment bytes.Buffer
+	fmt.Fprintf(&comment, "#### `ankh diff -f %v`\n\n", ankhFilePath)
+
+	changed := []diffSection{}
+	for _, section := range sections {
+		if strings.TrimSpace(section.Diff) != "" {
+			changed = append(changed, section)
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Fprintf(&comment, "No differences from the live objects.\n")
+		return comment.String()
+	}
+
+	for i, section := range changed {
+		diff := strings.TrimRight(section.Diff, "\n") + "\n"
+		header := fmt.Sprintf("<details><summary>Context <code>%v</code>, namespace <code>%v</code>: %v lines</summary>\n\n```diff\n",
+			section.Context, section.Namespace, strings.Count(diff, "\n"))
+		footer := "```\n</details>\n\n"
+		remaining := max - comment.Len() - len(header) - len(footer) - diffSectionReserve*(len(changed)-i)
+		if remaining < 0 {
+			remaining = 0
+		}
+		diff, cut := vcs.Truncate(diff, remaining)
+		if cut > 0 {
+			footer = fmt.Sprintf("```\n\n_%v more lines were cut. Run `ankh diff` to see the whole diff._\n</details>\n\n", cut)
+		}
+		comment.WriteString(header + diff + footer)
+	}
+	return comment.String()
+}
+
+// postDiffComment comments the diffs that were recorded on the pull request that CI is running for.
+func postDiffComment(ctx *ankh.ExecutionContext, pr vcs.PullRequest) {
+	comment := formatDiffComment(ctx.AnkhFilePath, diffSections, vcs.MaxCommentLength)
+	if err := pr.PostComment(comment); err != nil {
+		ctx.Logger.Warnf("%v", err)
+		return
+	}
+	ctx.Logger.Infof("Commented the diff on %v", pr)
+}
+
+// detectPullRequest finds the pull request to comment diffs on, or warns
+// that there isn't one, since diffs are still worth seeing in the CI log.
+func detectPullRequest(ctx *ankh.ExecutionContext) (vcs.PullRequest, bool) {
+	pr, err := vcs.DetectPullRequest(os.Getenv)
+	if err != nil {
+		ctx.Logger.Warnf("Not commenting the diff: %v", err)
+		return pr, false
+	}
+	return pr, true
+}
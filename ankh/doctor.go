@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/appnexus/ankh/config"
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/docker"
+	"github.com/appnexus/ankh/helm"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+type doctorStatus string
+
+const (
+	doctorPass doctorStatus = "PASS"
+	doctorWarn doctorStatus = "WARN"
+	doctorFail doctorStatus = "FAIL"
+)
+
+type doctorCheck struct {
+	Status doctorStatus
+	Name   string
+	Detail string
+	Hint   string
+}
+
+var versionRegexp = regexp.MustCompile(`v(\d+)\.(\d+)\.`)
+
+// parseMajorMinor finds the first `vMAJOR.MINOR.` version in a `version` command's output.
+func parseMajorMinor(version string) (int, int, bool) {
+	m := versionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major, minor, true
+}
+
+func checkBinaries(ctx *ankh.ExecutionContext) []doctorCheck {
+	checks := []doctorCheck{}
+
+	helmVersion, err := helm.Version(ctx)
+	if err != nil {
+		checks = append(checks, doctorCheck{doctorFail, "helm binary", fmt.Sprintf("%v", err),
+			"Install Helm v2 and make sure `helm` is on your PATH"})
+	} else if major, minor, ok := parseMajorMinor(helmVersion); !ok {
+		checks = append(checks, doctorCheck{doctorWarn, "helm binary", "Unable to parse `helm version --client`",
+			"Ankh is tested with Helm v2"})
+	} else if major != 2 {
+		checks = append(checks, doctorCheck{doctorFail, "helm binary", fmt.Sprintf("Found helm v%v.%v", major, minor),
+			"Ankh templates charts using `helm template --name`, which requires Helm v2"})
+	} else {
+		checks = append(checks, doctorCheck{doctorPass, "helm binary", fmt.Sprintf("Found helm v%v.%v", major, minor), ""})
+	}
+
+	kubectlVersion, err := kubectl.Version(ctx)
+	if err != nil {
+		checks = append(checks, doctorCheck{doctorFail, "kubectl binary", fmt.Sprintf("%v", err),
+			"Install kubectl and make sure it is on your PATH"})
+	} else if major, minor, ok := parseMajorMinor(kubectlVersion); !ok {
+		checks = append(checks, doctorCheck{doctorWarn, "kubectl binary", "Unable to parse `kubectl version --client`", ""})
+	} else if major == 1 && minor < 10 {
+		checks = append(checks, doctorCheck{doctorWarn, "kubectl binary", fmt.Sprintf("Found kubectl v%v.%v", major, minor),
+			"Some operations, like `ankh diff`, work best with kubectl v1.12 or newer"})
+	} else {
+		checks = append(checks, doctorCheck{doctorPass, "kubectl binary", fmt.Sprintf("Found kubectl v%v.%v", major, minor), ""})
+	}
+
+	return checks
+}
+
+func checkContexts(ctx *ankh.ExecutionContext) []doctorCheck {
+	checks := []doctorCheck{}
+
+	kubeContexts, err := config.KubeConfigContexts(ctx.KubeConfigPath)
+	if err != nil {
+		checks = append(checks, doctorCheck{doctorFail, "kubeconfig", fmt.Sprintf("%v", err),
+			"Set `--kubeconfig` or KUBECONFIG to a valid kubeconfig"})
+	}
+
+	names := []string{}
+	for name, _ := range ctx.AnkhConfig.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		context := ctx.AnkhConfig.Contexts[name]
+		checkName := fmt.Sprintf("context %v", name)
+
+		if context.KubeServer == "" {
+			if context.KubeContext == "" {
+				checks = append(checks, doctorCheck{doctorFail, checkName, "No `kube-context` or `kube-server`",
+					fmt.Sprintf("Run `ankh config set-context --kube-context KUBE-CONTEXT %v`", name)})
+				continue
+			}
+			found := false
+			for _, kubeContext := range kubeContexts {
+				if kubeContext == context.KubeContext {
+					found = true
+					break
+				}
+			}
+			if !found {
+				checks = append(checks, doctorCheck{doctorFail, checkName,
+					fmt.Sprintf("kube-context \"%v\" not found in kubeconfig", context.KubeContext),
+					"Add the kube-context to your kubeconfig, or fix `kube-context` on the Ankh context"})
+				continue
+			}
+		}
+
+		if err := kubectl.ClusterReachable(ctx, context); err != nil {
+			checks = append(checks, doctorCheck{doctorFail, checkName, "Cluster is unreachable",
+				"Check your network connection, VPN, and cluster credentials"})
+			ctx.Logger.Debugf("Cluster for context %v is unreachable: %v", name, err)
+			continue
+		}
+		checks = append(checks, doctorCheck{doctorPass, checkName, "Cluster is reachable", ""})
+	}
+
+	return checks
+}
+
+func checkRegistries(ctx *ankh.ExecutionContext) []doctorCheck {
+	checks := []doctorCheck{}
+
+	registries := helm.Registries(ctx)
+	for _, context := range ctx.AnkhConfig.Contexts {
+		registries = append(registries, context.HelmRegistries...)
+		if context.HelmRegistryURL != "" {
+			registries = append(registries, context.HelmRegistryURL)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, registry := range registries {
+		if seen[registry] {
+			continue
+		}
+		seen[registry] = true
+
+		checkName := fmt.Sprintf("helm registry %v", registry)
+		if err := helm.PingRegistry(ctx, registry); err != nil {
+			checks = append(checks, doctorCheck{doctorFail, checkName, fmt.Sprintf("%v", err),
+				"Check the registry URL, and that it serves an index.yaml"})
+		} else {
+			checks = append(checks, doctorCheck{doctorPass, checkName, "Registry responds", ""})
+		}
+	}
+	if len(seen) == 0 {
+		checks = append(checks, doctorCheck{doctorWarn, "helm registry", "No helm registry configured",
+			"Set `helm.registry` in your Ankh config to use remote charts"})
+	}
+
+	if ctx.AnkhConfig.Docker.Registry == "" {
+		checks = append(checks, doctorCheck{doctorWarn, "docker registry", "No docker registry configured",
+			"Set `docker.registry` in your Ankh config to use `ankh image` and tag prompts"})
+	} else {
+		checkName := fmt.Sprintf("docker registry %v", ctx.AnkhConfig.Docker.Registry)
+		if err := docker.Ping(ctx); err != nil {
+			checks = append(checks, doctorCheck{doctorFail, checkName, fmt.Sprintf("%v", err),
+				"Check the registry domain and your docker credentials"})
+		} else {
+			checks = append(checks, doctorCheck{doctorPass, checkName, "Registry responds", ""})
+		}
+	}
+
+	return checks
+}
+
+// runDoctor checks the merged Ankh config end to end, writes a report, and returns the number of failed checks.
+func runDoctor(ctx *ankh.ExecutionContext, w io.Writer) int {
+	checks := checkBinaries(ctx)
+	checks = append(checks, checkContexts(ctx)...)
+	checks = append(checks, checkRegistries(ctx)...)
+
+	failures := 0
+	for _, check := range checks {
+		fmt.Fprintf(w, "[%v] %v: %v\n", check.Status, check.Name, strings.TrimSpace(check.Detail))
+		if check.Hint != "" && check.Status != doctorPass {
+			fmt.Fprintf(w, "       -> %v\n", check.Hint)
+		}
+		if check.Status == doctorFail {
+			failures++
+		}
+	}
+	return failures
+}
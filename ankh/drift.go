@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// driftReport is the drift found for the charts on one namespace of one context.
+type driftReport struct {
+	Context   string   `json:"context"`
+	Namespace string   `json:"namespace"`
+	Charts    []string `json:"charts"`
+	Objects   []string `json:"objects"`
+	Diff      string   `json:"diff"`
+}
+
+var driftReports = []driftReport{}
+
+func checkChartDrift(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	diff, objects, err := kubectl.Drift(ctx, helmOutput, namespace, nil)
+	check(err)
+
+	names := []string{}
+	for _, chart := range charts {
+		names = append(names, chart.Name)
+	}
+	if len(objects) == 0 {
+		ctx.Logger.Infof("No drift for charts [ %v ] in namespace \"%v\"", strings.Join(names, ", "), namespace)
+		return
+	}
+	ctx.Logger.Warnf("Found drift for charts [ %v ] in namespace \"%v\": %v", strings.Join(names, ", "), namespace, strings.Join(objects, ", "))
+	driftReports = append(driftReports, driftReport{
+		Context:   ctx.AnkhConfig.CurrentContextName,
+		Namespace: namespace,
+		Charts:    names,
+		Objects:   objects,
+		Diff:      diff,
+	})
+}
+
+// writeDriftReports prints any drift found, and writes the reports as JSON to outputPath if it's set.
+func writeDriftReports(ctx *ankh.ExecutionContext, outputPath string) {
+	for _, report := range driftReports {
+		fmt.Println(report.Diff)
+	}
+	if outputPath == "" {
+		return
+	}
+	body, err := json.MarshalIndent(driftReports, "", "  ")
+	check(err)
+	check(ioutil.WriteFile(outputPath, body, 0644))
+}
+
+// selfArgs are the global options that ankh subprocesses need to see the same config as this one.
+func selfArgs(ctx *ankh.ExecutionContext) []string {
+	return []string{"--ankhconfig", ctx.AnkhConfigPath, "--kubeconfig", ctx.KubeConfigPath,
+		"--datadir", filepath.Dir(ctx.AuditLogPath)}
+}
+
+func driftTargetName(target ankh.DriftTarget) string {
+	name := target.AnkhFile
+	if target.Environment != "" {
+		name += " in environment " + target.Environment
+	} else if target.Context != "" {
+		name += " in context " + target.Context
+	}
+	return name
+}
+
+// targetArgs are the global options that ankh subprocesses need to run against target.
+func targetArgs(ctx *ankh.ExecutionContext, target ankh.DriftTarget) []string {
+	args := selfArgs(ctx)
+	if target.Environment != "" {
+		args = append(args, "--environment", target.Environment)
+	} else if target.Context != "" {
+		args = append(args, "--context", target.Context)
+	}
+	return args
+}
+
+// driftArgs builds the ankh command line that checks target for drift, writing reports to outputPath.
+func driftArgs(ctx *ankh.ExecutionContext, target ankh.DriftTarget, outputPath string) []string {
+	return append(targetArgs(ctx, target), "drift", "-f", target.AnkhFile, "--output", outputPath)
+}
+
+// driftResult is the outcome of the last check of one target.
+type driftResult struct {
+	Target    ankh.DriftTarget
+	Reports   []driftReport
+	Err       error
+	CheckedAt time.Time
+}
+
+func (r driftResult) objects() []string {
+	objects := []string{}
+	for _, report := range r.Reports {
+		for _, object := range report.Objects {
+			objects = append(objects, fmt.Sprintf("%v/%v/%v", report.Context, report.Namespace, object))
+		}
+	}
+	sort.Strings(objects)
+	return objects
+}
+
+type driftWatcher struct {
+	ctx        *ankh.ExecutionContext
+	self       string
+	targets    []ankh.DriftTarget
+	webhookURL string
+
+	mtx     sync.Mutex
+	results map[string]driftResult
+	// notified is the drift last notified about for each target, so that
+	// notifications only go out when it changes.
+	notified map[string][]string
+}
+
+// check renders target in an ankh subprocess and compares it with the live cluster.
+func (w *driftWatcher) check(target ankh.DriftTarget) driftResult {
+	result := driftResult{Target: target, CheckedAt: time.Now()}
+	output, err := ioutil.TempFile("", "ankh-drift")
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	output.Close()
+	defer ankh.RemoveOnExit(output.Name())()
+
+	cmd := exec.Command(w.self, driftArgs(w.ctx, target, output.Name())...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	w.ctx.Logger.Debugf("Running %v", strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		drifted := false
+		if exitError, ok := err.(*exec.ExitError); ok {
+			status, ok := exitError.Sys().(syscall.WaitStatus)
+			drifted = ok && status.ExitStatus() == exitDrift
+		}
+		if !drifted {
+			result.Err = fmt.Errorf("%v -- ankh had the following output:\n%s", err, out.String())
+			return result
+		}
+	}
+
+	body, err := ioutil.ReadFile(output.Name())
+	if err == nil {
+		err = json.Unmarshal(body, &result.Reports)
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("Unable to read drift reports: %v", err)
+	}
+	return result
+}
+
+// notify POSTs to the webhook when the drift for a target has changed since the last notification.
+// The `text` field makes the payload usable with Slack incoming webhooks as is.
+func (w *driftWatcher) notify(result driftResult) {
+	name := driftTargetName(result.Target)
+	objects := result.objects()
+	if strings.Join(objects, ",") == strings.Join(w.notified[name], ",") {
+		return
+	}
+	w.notified[name] = objects
+	if w.webhookURL == "" {
+		return
+	}
+
+	text := fmt.Sprintf("Drift resolved for %v", name)
+	if len(objects) > 0 {
+		text = fmt.Sprintf("Found drift for %v: %v", name, strings.Join(objects, ", "))
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"text":     text,
+		"ankhFile": result.Target.AnkhFile,
+		"context":  result.Target.Context,
+		"actor":    w.ctx.Actor,
+		"drifted":  len(objects) > 0,
+		"objects":  objects,
+	})
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(w.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		w.ctx.Logger.Warnf("Failed to notify webhook about drift: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		w.ctx.Logger.Warnf("Failed to notify webhook about drift: %v", resp.Status)
+	}
+}
+
+// run checks every target once, returning whether any drifted, and whether any checks failed.
+func (w *driftWatcher) run() (bool, bool) {
+	drifted, failed := false, false
+	for _, target := range w.targets {
+		name := driftTargetName(target)
+		w.ctx.Logger.Infof("Checking %v for drift", name)
+		result := w.check(target)
+		w.mtx.Lock()
+		w.results[name] = result
+		w.mtx.Unlock()
+
+		if result.Err != nil {
+			w.ctx.Logger.Errorf("Failed to check %v for drift: %v", name, result.Err)
+			failed = true
+			continue
+		}
+		if objects := result.objects(); len(objects) > 0 {
+			drifted = true
+			w.ctx.Logger.Warnf("Found drift for %v: %v", name, strings.Join(objects, ", "))
+		} else {
+			w.ctx.Logger.Infof("No drift for %v", name)
+		}
+		w.notify(result)
+	}
+	return drifted, failed
+}
+
+func metricLabels(target ankh.DriftTarget) string {
+	return fmt.Sprintf("ankh_file=%q,context=%q,environment=%q", target.AnkhFile, target.Context, target.Environment)
+}
+
+// metrics formats the last results in the Prometheus text format.
+func (w *driftWatcher) metrics() string {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	names := []string{}
+	for name, _ := range w.results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "# HELP ankh_drift_objects Number of objects that differ from their Ankh file, as of the last successful check.")
+	fmt.Fprintln(&out, "# TYPE ankh_drift_objects gauge")
+	for _, name := range names {
+		if result := w.results[name]; result.Err == nil {
+			fmt.Fprintf(&out, "ankh_drift_objects{%v} %v\n", metricLabels(result.Target), len(result.objects()))
+		}
+	}
+	fmt.Fprintln(&out, "# HELP ankh_drift_check_success Whether the last drift check succeeded.")
+	fmt.Fprintln(&out, "# TYPE ankh_drift_check_success gauge")
+	for _, name := range names {
+		success := 1
+		if w.results[name].Err != nil {
+			success = 0
+		}
+		fmt.Fprintf(&out, "ankh_drift_check_success{%v} %v\n", metricLabels(w.results[name].Target), success)
+	}
+	fmt.Fprintln(&out, "# HELP ankh_drift_last_check_timestamp_seconds When the last drift check finished.")
+	fmt.Fprintln(&out, "# TYPE ankh_drift_last_check_timestamp_seconds gauge")
+	for _, name := range names {
+		result := w.results[name]
+		fmt.Fprintf(&out, "ankh_drift_last_check_timestamp_seconds{%v} %v\n", metricLabels(result.Target), result.CheckedAt.Unix())
+	}
+	return out.String()
+}
+
+// watchDrift checks the configured targets for drift every interval, or
+// just once. Drift is reported in the log, to the configured webhook, and
+// as Prometheus metrics when metricsAddr is set.
+func watchDrift(ctx *ankh.ExecutionContext, targets []ankh.DriftTarget, interval time.Duration, metricsAddr string, once bool) {
+	self, err := os.Executable()
+	check(err)
+
+	w := &driftWatcher{
+		ctx:        ctx,
+		self:       self,
+		targets:    targets,
+		webhookURL: ctx.AnkhConfig.Drift.WebhookURL,
+		results:    make(map[string]driftResult),
+		notified:   make(map[string][]string),
+	}
+	if once {
+		drifted, failed := w.run()
+		if failed {
+			os.Exit(1)
+		}
+		if drifted {
+			exit(exitDrift)
+		}
+		return
+	}
+
+	if metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			fmt.Fprint(rw, w.metrics())
+		})
+		go func() {
+			ctx.Logger.Infof("Serving drift metrics on http://%v/metrics", metricsAddr)
+			check(http.ListenAndServe(metricsAddr, mux))
+		}()
+	}
+
+	for {
+		w.run()
+		ctx.Logger.Infof("Checking for drift again in %v", interval)
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// eventTargets are the objects templated into each namespace, which `events --watch` watches once every namespace has been printed.
+var eventTargets = []kubectl.EventTarget{}
+
+// printEvents prints the recent Events involving the objects templated in
+// helmOutput, or the objects that their controllers made, oldest first.
+func printEvents(ctx *ankh.ExecutionContext, namespace string, helmOutput string) {
+	target := kubectl.EventTarget{Namespace: namespace, Objects: kubectl.EventObjects(helmOutput)}
+	eventTargets = append(eventTargets, target)
+
+	events, err := kubectl.Events(ctx, []kubectl.EventTarget{target})
+	check(err)
+	if len(events) == 0 {
+		ctx.Logger.Infof("No events found for the objects in namespace \"%v\"", namespace)
+		return
+	}
+	kubectl.FormatEvents(os.Stdout, events, time.Now())
+}
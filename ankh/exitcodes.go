@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// Exit codes, so that scripts and CI systems can tell outcomes apart. Any
+// other failure exits with exitFailure, eg: via check.
+const (
+	exitFailure            = 1
+	exitDrift              = 2  // `drift` found live objects that differ from their Ankh file.
+	exitLintFailed         = 3  // `lint` found problems.
+	exitPolicyDenied       = 4  // `apply` refused to apply objects that violate a `deny` policy.
+	exitWaitTimeout        = 5  // `wait` timed out before its conditions were met.
+	exitDiffChanges        = 6  // `diff` found objects that differ from the live ones.
+	exitConfigError        = 7  // The Ankh config or an Ankh file is invalid, or can't be read.
+	exitTemplateError      = 8  // Templating a chart failed.
+	exitApplyFailed        = 9  // kubectl failed to apply objects.
+	exitPartialEnvironment = 10 // Applying an environment failed after some of its contexts were applied.
+	exitVulnerable         = 11 // `apply` refused to apply images with vulnerabilities of `scan.severity` or above.
+	exitUnverified         = 12 // `apply` refused to apply images whose cosign signatures can't be verified.
+	exitPreconditionFailed = 13 // An Ankh file's preconditions weren't met, or a binary that the command needs isn't installed.
+)
+
+// interruptGrace is how long an interrupted run waits for ankh to exit by
+// failing on the commands it stopped, before exiting anyway. It's a little
+// longer than commands are given to stop.
+const interruptGrace = 7 * time.Second
+
+// interruptedExitCode is the status to exit with after sig, 128 plus its
+// number like shells use, eg: 130 for SIGINT and 143 for SIGTERM.
+func interruptedExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return exitFailure
+}
+
+// warnExitCodes report what ankh found, rather than that it failed, so
+// `--exit-zero-on-warn` exits with 0 instead of them.
+var warnExitCodes = map[int]bool{
+	exitDrift:       true,
+	exitLintFailed:  true,
+	exitDiffChanges: true,
+}
+
+// exitZeroOnWarn is set by `--exit-zero-on-warn`.
+var exitZeroOnWarn bool
+
+// appliedEnvironmentContexts counts the contexts of an environment that were
+// applied, so that a failure after the first can be told apart.
+var appliedEnvironmentContexts int
+
+// exitCode is the code that ankh is exiting with, for exit handlers. Fatalf
+// exits with 1, eg: from the helm package.
+var exitCode = 1
+
+// finalExitCode is code, or 0 for warnings with `--exit-zero-on-warn`, or
+// exitPartialEnvironment for failures after some of an environment was
+// applied, unless the run was interrupted, which takes precedence.
+func finalExitCode(code int) int {
+	if sig := ankh.Interrupted(); sig != nil {
+		return interruptedExitCode(sig)
+	}
+	if warnExitCodes[code] && exitZeroOnWarn {
+		log.Warnf("Exiting with 0 instead of %v because of `--exit-zero-on-warn`", code)
+		return 0
+	}
+	if code != 0 && !warnExitCodes[code] && appliedEnvironmentContexts > 0 {
+		log.Errorf("Failed after applying %v of the environment's contexts, so the environment is partially applied", appliedEnvironmentContexts)
+		return exitPartialEnvironment
+	}
+	return code
+}
+
+// exit exits with code after running the exit handlers, like log.Fatalf does,
+// so that failure hooks still run and deploy locks are still released.
+func exit(code int) {
+	exitCode = finalExitCode(code)
+	logrus.Exit(exitCode)
+}
+
+// fatalf logs like log.Fatalf does, then exits with code.
+func fatalf(code int, format string, args ...interface{}) {
+	if log.Level >= logrus.FatalLevel {
+		entry := logrus.NewEntry(log)
+		entry.Time = time.Now()
+		entry.Level = logrus.FatalLevel
+		entry.Message = fmt.Sprintf(format, args...)
+		if line, err := log.Formatter.Format(entry); err == nil {
+			log.Out.Write(line)
+		}
+	}
+	exit(code)
+}
+
+// checkWith exits with code if err isn't nil, like check does with 1.
+func checkWith(code int, err error) {
+	if err != nil {
+		fatalf(code, "%v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// fleetReport is the status of every chart in every context of the fleet.
+type fleetReport struct {
+	Contexts []string          `json:"contexts"`
+	Charts   []string          `json:"charts"`
+	Statuses []chartStatus     `json:"statuses"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// fleetContexts are the contexts of `--environment`, or else every context.
+func fleetContexts(ctx *ankh.ExecutionContext) ([]string, error) {
+	if ctx.Environment != "" {
+		environment, ok := ctx.AnkhConfig.Environments[ctx.Environment]
+		if !ok {
+			return nil, fmt.Errorf("Environment '%v' not found in `environments`", ctx.Environment)
+		}
+		return environment.Contexts, nil
+	}
+
+	contexts := []string{}
+	for name := range ctx.AnkhConfig.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+	return contexts, nil
+}
+
+// fleetStatusArgs builds the ankh command line that gets the status of the
+// charts in ankhFilePath on one context, as JSON.
+func fleetStatusArgs(ctx *ankh.ExecutionContext, context string, ankhFilePath string, chart string) []string {
+	args := append(selfArgs(ctx), "--context", context)
+	if ctx.Release != "" {
+		args = append(args, "--release", ctx.Release)
+	}
+	if ctx.Namespace != nil {
+		args = append(args, "--namespace", *ctx.Namespace)
+	}
+	args = append(args, "status", "-f", ankhFilePath, "-o", "json")
+	if chart != "" {
+		args = append(args, "--chart", chart)
+	}
+	return args
+}
+
+// fleetStatus gets the status of the charts in ankhFilePath on each context,
+// running up to parallel ankh processes at once.
+func fleetStatus(ctx *ankh.ExecutionContext, self string, contexts []string, ankhFilePath string, chart string, parallel int) fleetReport {
+	report := fleetReport{Contexts: contexts, Charts: []string{}, Statuses: []chartStatus{}, Errors: make(map[string]string)}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var mtx sync.Mutex
+	pool := util.NewPool(parallel)
+	for _, context := range contexts {
+		context := context
+		pool.Go(func() {
+			cmd := ctx.Command(ankh.RunPhase, self, fleetStatusArgs(ctx, context, ankhFilePath, chart)...)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			ctx.Logger.Debugf("Running %v", strings.Join(cmd.Args, " "))
+			statuses := []chartStatus{}
+			err := cmd.Run()
+			if err != nil {
+				err = fmt.Errorf("%v -- ankh had the following output:\n%s", err, stderr.String())
+			} else if err = json.Unmarshal(stdout.Bytes(), &statuses); err != nil {
+				err = fmt.Errorf("Unable to parse chart statuses: %v", err)
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil {
+				ctx.Logger.Warnf("Failed to get the status of context \"%v\": %v", context, err)
+				report.Errors[context] = err.Error()
+				return
+			}
+			ctx.Logger.Infof("Got the status of %v charts in context \"%v\"", len(statuses), context)
+			report.Statuses = append(report.Statuses, statuses...)
+		})
+	}
+	pool.Wait()
+
+	charts := []string{}
+	for _, status := range report.Statuses {
+		charts = append(charts, status.Chart)
+	}
+	sort.Strings(charts)
+	for _, chart := range charts {
+		if len(report.Charts) == 0 || report.Charts[len(report.Charts)-1] != chart {
+			report.Charts = append(report.Charts, chart)
+		}
+	}
+	sort.SliceStable(report.Statuses, func(i, j int) bool {
+		a, b := report.Statuses[i], report.Statuses[j]
+		if a.Context != b.Context {
+			return a.Context < b.Context
+		}
+		if a.Chart != b.Chart {
+			return a.Chart < b.Chart
+		}
+		return a.Namespace < b.Namespace
+	})
+	return report
+}
+
+// fleetCell summarizes a chart's statuses in one context, across namespaces,
+// eg: `1.2.3 3/3`, marking unhealthy charts with `!`, and `-` if it's not there.
+func fleetCell(statuses []chartStatus) string {
+	if len(statuses) == 0 {
+		return "-"
+	}
+	versions := []string{}
+	ready, desired := 0, 0
+	healthy := true
+	for _, status := range statuses {
+		r, d := status.ready()
+		ready += r
+		desired += d
+		healthy = healthy && status.Healthy
+		if status.DeployedVersion != "" && (len(versions) == 0 || versions[len(versions)-1] != status.DeployedVersion) {
+			versions = append(versions, status.DeployedVersion)
+		}
+	}
+
+	version := strings.Join(versions, ",")
+	if version == "" {
+		version = "?"
+	}
+	cell := fmt.Sprintf("%v %v/%v", version, ready, desired)
+	if !healthy {
+		cell += " !"
+	}
+	return cell
+}
+
+// printFleetReport prints the fleet as a matrix of contexts by charts.
+func printFleetReport(report fleetReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "CONTEXT\t%v\n", strings.Join(report.Charts, "\t"))
+	for _, context := range report.Contexts {
+		cells := []string{context}
+		if _, ok := report.Errors[context]; ok {
+			fmt.Fprintln(w, context+"\terror")
+			continue
+		}
+		for _, chart := range report.Charts {
+			statuses := []chartStatus{}
+			for _, status := range report.Statuses {
+				if status.Context == context && status.Chart == chart {
+					statuses = append(statuses, status)
+				}
+			}
+			cells = append(cells, fleetCell(statuses))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+
+	for _, context := range report.Contexts {
+		if err, ok := report.Errors[context]; ok {
+			fmt.Printf("\nError in context \"%v\": %v\n", context, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+	"github.com/appnexus/ankh/util"
+)
+
+// fluxSourceName is the name of the HelmRepository that every exported HelmRelease uses.
+const fluxSourceName = "ankh"
+
+// fluxRelease is a chart to export as a Flux HelmRelease, for one namespace of one context.
+type fluxRelease struct {
+	Context   string
+	Registry  string
+	Release   string
+	Namespace string
+	Chart     string
+	Version   string
+	Values    map[string]interface{}
+}
+
+var fluxReleases = []fluxRelease{}
+
+// recordFluxReleases merges the values of each of charts the same way that
+// templating does, keeping only those that differ from the chart's defaults,
+// since Flux merges them over the defaults itself.
+func recordFluxReleases(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string) {
+	registries := helm.Registries(ctx)
+	if len(registries) == 0 {
+		fatalf(exitConfigError, "No helm registry is configured for context \"%v\", so there's no HelmRepository for Flux to fetch charts from. "+
+			"Set `helm.registry` in the Ankh config", ctx.AnkhConfig.CurrentContextName)
+	}
+
+	for _, chart := range charts {
+		if chart.IsManifests() || chart.Version == "" {
+			ctx.Logger.Warnf("Skipping chart \"%v\", since only charts with a version in a helm registry can be exported to Flux", chart.Name)
+			continue
+		}
+		values, _, err := helm.ExplainValues(ctx, chart)
+		check(err)
+		defaults, err := helm.ChartDefaultValues(ctx, chart)
+		check(err)
+
+		fluxReleases = append(fluxReleases, fluxRelease{
+			Context:   ctx.AnkhConfig.CurrentContextName,
+			Registry:  registries[0],
+			Release:   ctx.AnkhConfig.CurrentContext.Release,
+			Namespace: namespace,
+			Chart:     chart.Name,
+			Version:   chart.Version,
+			Values:    util.DiffValues(defaults, values),
+		})
+	}
+}
+
+func fluxHelmRepository(registry string, sourceNamespace string, interval string) yaml.MapSlice {
+	return yaml.MapSlice{
+		{Key: "apiVersion", Value: "source.toolkit.fluxcd.io/v1"},
+		{Key: "kind", Value: "HelmRepository"},
+		{Key: "metadata", Value: yaml.MapSlice{
+			{Key: "name", Value: fluxSourceName},
+			{Key: "namespace", Value: sourceNamespace},
+		}},
+		{Key: "spec", Value: yaml.MapSlice{
+			{Key: "interval", Value: interval},
+			{Key: "url", Value: registry},
+		}},
+	}
+}
+
+func fluxHelmRelease(release fluxRelease, sourceNamespace string, interval string) yaml.MapSlice {
+	spec := yaml.MapSlice{{Key: "interval", Value: interval}}
+	if release.Release != "" {
+		spec = append(spec, yaml.MapItem{Key: "releaseName", Value: release.Release})
+	}
+	spec = append(spec, yaml.MapItem{Key: "chart", Value: yaml.MapSlice{
+		{Key: "spec", Value: yaml.MapSlice{
+			{Key: "chart", Value: release.Chart},
+			{Key: "version", Value: release.Version},
+			{Key: "sourceRef", Value: yaml.MapSlice{
+				{Key: "kind", Value: "HelmRepository"},
+				{Key: "name", Value: fluxSourceName},
+				{Key: "namespace", Value: sourceNamespace},
+			}},
+		}},
+	}})
+	if len(release.Values) > 0 {
+		spec = append(spec, yaml.MapItem{Key: "values", Value: release.Values})
+	}
+	return yaml.MapSlice{
+		{Key: "apiVersion", Value: "helm.toolkit.fluxcd.io/v2"},
+		{Key: "kind", Value: "HelmRelease"},
+		{Key: "metadata", Value: yaml.MapSlice{
+			{Key: "name", Value: release.Chart},
+			{Key: "namespace", Value: release.Namespace},
+		}},
+		{Key: "spec", Value: spec},
+	}
+}
+
+func writeFluxObject(ctx *ankh.ExecutionContext, path string, obj yaml.MapSlice) {
+	out, err := yaml.Marshal(obj)
+	check(err)
+	check(os.MkdirAll(filepath.Dir(path), 0755))
+	check(ioutil.WriteFile(path, append([]byte("---\n"), out...), 0644))
+	ctx.Logger.Infof("Wrote %v", path)
+}
+
+// writeFluxExport writes a HelmRepository for each context that was exported
+// to `<dir>/<context>/helmrepository.yaml`, and a HelmRelease for each chart
+// to `<dir>/<context>/<namespace>/<chart>.yaml`.
+func writeFluxExport(ctx *ankh.ExecutionContext, dir string, interval string, sourceNamespace string) {
+	if len(fluxReleases) == 0 {
+		ctx.Logger.Warnf("No charts could be exported to Flux")
+		return
+	}
+
+	repositories := make(map[string]bool)
+	for _, release := range fluxReleases {
+		if !repositories[release.Context] {
+			repositories[release.Context] = true
+			if !strings.HasPrefix(release.Registry, "http://") && !strings.HasPrefix(release.Registry, "https://") {
+				ctx.Logger.Warnf("Flux may not be able to fetch charts from the helm registry '%v' of context \"%v\", which isn't an HTTP(S) URL",
+					release.Registry, release.Context)
+			}
+			writeFluxObject(ctx, filepath.Join(dir, release.Context, "helmrepository.yaml"),
+				fluxHelmRepository(release.Registry, sourceNamespace, interval))
+		}
+		writeFluxObject(ctx, filepath.Join(dir, release.Context, release.Namespace, release.Chart+".yaml"),
+			fluxHelmRelease(release, sourceNamespace, interval))
+	}
+	ctx.Logger.Infof("Exported %v HelmReleases to %v", len(fluxReleases), dir)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// checkFreezeWindows refuses to apply or rollback to any context that is in a
+// freeze window, unless the freeze was overridden with a reason, in which case
+// the override is recorded in the audit log.
+func checkFreezeWindows(ctx *ankh.ExecutionContext, contexts []string) {
+	if (ctx.Mode != ankh.Apply && ctx.Mode != ankh.Rollback) || ctx.DryRun {
+		return
+	}
+
+	now := time.Now()
+	checked := make(map[string]bool)
+	for _, name := range contexts {
+		context, ok := ctx.AnkhConfig.Contexts[name]
+		if !ok || checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		window, until, err := context.ActiveFreezeWindow(now)
+		if err != nil {
+			fatalf(exitConfigError, "Invalid `freeze-windows` for context '%v': %v", name, err)
+		}
+		if window == nil {
+			continue
+		}
+
+		if ctx.Options.OverrideFreeze == "" {
+			fatalf(exitConfigError, "Context '%v' is frozen by freeze window '%v' until %v. "+
+				"Pass `--override-freeze REASON` to proceed anyway", name, window, until.Format(time.RFC3339))
+		}
+
+		message := fmt.Sprintf("Overrode freeze window '%v' on context '%v': %v", window, name, ctx.Options.OverrideFreeze)
+		ctx.Logger.Warnf("%v", message)
+		if err := ctx.Audit(ankh.AuditEntry{Context: name, Message: message}); err != nil {
+			ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+		}
+	}
+}
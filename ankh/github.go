@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const (
+	defaultGitHubAPIURL   = "https://api.github.com"
+	defaultGitHubTokenEnv = "GITHUB_TOKEN"
+)
+
+// gitHubDeployment is a GitHub Deployment created for the context being applied.
+type gitHubDeployment struct {
+	ID          int    `json:"id"`
+	StatusesURL string `json:"statuses_url"`
+	Environment string `json:"environment"`
+}
+
+// activeGitHubDeployment is the Deployment of the context being applied, if
+// any, so that it can be marked as failed if ankh exits early.
+var activeGitHubDeployment *gitHubDeployment
+var activeGitHubDeploymentMtx sync.Mutex
+
+func gitHubToken(ctx *ankh.ExecutionContext) (string, string) {
+	tokenEnv := ctx.AnkhConfig.GitHub.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = defaultGitHubTokenEnv
+	}
+	return os.Getenv(tokenEnv), tokenEnv
+}
+
+// gitHubRef is the ref that's being deployed: `github.ref` from the Ankh
+// config, or the commit that GitHub Actions is running for, or the commit
+// checked out where ankh runs.
+func gitHubRef(ctx *ankh.ExecutionContext) (string, error) {
+	if ctx.AnkhConfig.GitHub.Ref != "" {
+		return ctx.AnkhConfig.GitHub.Ref, nil
+	}
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha, nil
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("Unable to tell which git ref is being deployed. Set `github.ref` in the Ankh config, or run ankh in a git checkout")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func gitHubRequest(ctx *ankh.ExecutionContext, url string, body interface{}, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	token, _ := gitHubToken(ctx)
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if result != nil {
+		return json.Unmarshal(respBody, result)
+	}
+	return nil
+}
+
+// createGitHubDeployment creates a Deployment of the current context, which is its environment in GitHub.
+func createGitHubDeployment(ctx *ankh.ExecutionContext) (*gitHubDeployment, error) {
+	ref, err := gitHubRef(ctx)
+	if err != nil {
+		return nil, err
+	}
+	apiURL := ctx.AnkhConfig.GitHub.APIURL
+	if apiURL == "" {
+		apiURL = defaultGitHubAPIURL
+	}
+
+	deployment := &gitHubDeployment{}
+	err = gitHubRequest(ctx, fmt.Sprintf("%v/repos/%v/deployments", strings.TrimSuffix(apiURL, "/"), ctx.AnkhConfig.GitHub.Repo), map[string]interface{}{
+		"ref":               ref,
+		"environment":       ctx.AnkhConfig.CurrentContextName,
+		"description":       fmt.Sprintf("ankh apply -f %v", ctx.AnkhFilePath),
+		"auto_merge":        false,
+		"required_contexts": []string{},
+		"payload": map[string]string{
+			"actor":    ctx.Actor,
+			"ankhFile": ctx.AnkhFilePath,
+			"release":  ctx.AnkhConfig.CurrentContext.Release,
+		},
+	}, deployment)
+	if err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+func setGitHubDeploymentStatus(ctx *ankh.ExecutionContext, deployment *gitHubDeployment, state string) {
+	description := fmt.Sprintf("Applying, by %v", ctx.Actor)
+	switch state {
+	case "success":
+		description = fmt.Sprintf("Applied by %v", ctx.Actor)
+	case "failure":
+		description = fmt.Sprintf("Apply by %v failed", ctx.Actor)
+	}
+	err := gitHubRequest(ctx, deployment.StatusesURL, map[string]interface{}{
+		"state":         state,
+		"environment":   deployment.Environment,
+		"description":   description,
+		"auto_inactive": state == "success",
+	}, nil)
+	if err != nil {
+		ctx.Logger.Warnf("Failed to set the status of GitHub Deployment %v to %v: %v", deployment.ID, state, err)
+	}
+}
+
+// withGitHubDeployment creates a GitHub Deployment for the current context
+// when `github.repo` is configured, then marks it in progress, then applies,
+// then marks it successful. If anything fails along the way, it's marked as
+// failed as ankh exits. Trouble with GitHub never stops the apply.
+func withGitHubDeployment(ctx *ankh.ExecutionContext, apply func()) {
+	if ctx.Mode != ankh.Apply || ctx.DryRun || ctx.AnkhConfig.GitHub.Repo == "" {
+		apply()
+		return
+	}
+	if token, tokenEnv := gitHubToken(ctx); token == "" {
+		ctx.Logger.Warnf("Not creating a GitHub Deployment in %v, since `%v` isn't set", ctx.AnkhConfig.GitHub.Repo, tokenEnv)
+		apply()
+		return
+	}
+
+	deployment, err := createGitHubDeployment(ctx)
+	if err != nil {
+		ctx.Logger.Warnf("Failed to create a GitHub Deployment in %v: %v", ctx.AnkhConfig.GitHub.Repo, err)
+		apply()
+		return
+	}
+	ctx.Logger.Infof("Created GitHub Deployment %v to environment \"%v\" in %v", deployment.ID, deployment.Environment, ctx.AnkhConfig.GitHub.Repo)
+	setGitHubDeploymentStatus(ctx, deployment, "in_progress")
+
+	activeGitHubDeploymentMtx.Lock()
+	activeGitHubDeployment = deployment
+	activeGitHubDeploymentMtx.Unlock()
+
+	apply()
+
+	activeGitHubDeploymentMtx.Lock()
+	activeGitHubDeployment = nil
+	activeGitHubDeploymentMtx.Unlock()
+	setGitHubDeploymentStatus(ctx, deployment, "success")
+}
+
+// failGitHubDeployment is registered as an exit handler, and marks the
+// Deployment of the context that was being applied as failed.
+func failGitHubDeployment(ctx *ankh.ExecutionContext) {
+	activeGitHubDeploymentMtx.Lock()
+	deployment := activeGitHubDeployment
+	activeGitHubDeployment = nil
+	activeGitHubDeploymentMtx.Unlock()
+
+	if deployment != nil {
+		setGitHubDeploymentStatus(ctx, deployment, "failure")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// gitOpsRender is the templated output of one chart, for one namespace of one context.
+type gitOpsRender struct {
+	Context   string
+	Namespace string
+	Chart     string
+	Version   string
+	Tag       string
+	Output    string
+}
+
+var gitOpsRenders = []gitOpsRender{}
+
+func recordGitOpsRender(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	docs := kubectl.ChartDocuments(helmOutput)
+	for _, chart := range charts {
+		output, ok := docs[chart.Name]
+		if !ok {
+			ctx.Logger.Warnf("Chart \"%v\" templated no objects for namespace \"%v\"", chart.Name, namespace)
+			continue
+		}
+		gitOpsRenders = append(gitOpsRenders, gitOpsRender{
+			Context:   ctx.AnkhConfig.CurrentContextName,
+			Namespace: namespace,
+			Chart:     chart.Name,
+			Version:   chart.Version,
+			Tag:       chart.Tag,
+			Output:    output,
+		})
+	}
+}
+
+// gitOpsFile is where render is written, relative to the root of the manifests repository.
+func gitOpsFile(path string, render gitOpsRender) string {
+	return filepath.Join(path, render.Context, render.Namespace, render.Chart+".yaml")
+}
+
+// gitOpsMessage builds a commit message that names each chart, version and tag,
+// one per line, so that history in the manifests repository can be searched.
+func gitOpsMessage(ctx *ankh.ExecutionContext, renders []gitOpsRender) string {
+	contexts := []string{}
+	seen := make(map[string]bool)
+	for _, render := range renders {
+		if !seen[render.Context] {
+			seen[render.Context] = true
+			contexts = append(contexts, render.Context)
+		}
+	}
+	sort.Strings(contexts)
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "ankh: render %v for [ %v ]\n\n", ctx.AnkhFilePath, strings.Join(contexts, ", "))
+	for _, render := range renders {
+		version := render.Version
+		if version == "" {
+			version = "local"
+		}
+		tag := render.Tag
+		if tag == "" {
+			tag = "none"
+		}
+		fmt.Fprintf(&message, "chart=%v version=%v tag=%v context=%v namespace=%v\n",
+			render.Chart, version, tag, render.Context, render.Namespace)
+	}
+	fmt.Fprintf(&message, "\nRendered-by: %v\n", ctx.Actor)
+	return message.String()
+}
+
+func runGit(ctx *ankh.ExecutionContext, dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	ctx.Logger.Debugf("Running git cmd %+v", cmd.Args)
+	record := ctx.StartCommand(cmd)
+	err := cmd.Run()
+	record.Finish(err)
+	if err != nil {
+		return "", fmt.Errorf("`git %v` failed: %v -- git had the following output:\n%s", strings.Join(args, " "), err, out.String())
+	}
+	return out.String(), nil
+}
+
+// pushGitOps writes what was rendered into a clone of repo under path, with a
+// directory per context and namespace, then commits and pushes it to branch,
+// or to the repository's default branch. A dry run commits in the clone, but
+// doesn't push.
+func pushGitOps(ctx *ankh.ExecutionContext, repo string, path string, branch string, dryRun bool) {
+	if len(gitOpsRenders) == 0 {
+		ctx.Logger.Warnf("Nothing was rendered, so there's nothing to push to %v", repo)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "ankh-gitops")
+	check(err)
+	defer ankh.RemoveOnExit(dir)()
+
+	args := []string{"clone", "--depth", "1"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	ctx.Logger.Infof("Cloning %v", repo)
+	_, err = runGit(ctx, "", append(args, repo, dir)...)
+	check(err)
+
+	files := []string{}
+	for _, render := range gitOpsRenders {
+		file := gitOpsFile(path, render)
+		files = append(files, file)
+		check(os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		check(ioutil.WriteFile(filepath.Join(dir, file), []byte(render.Output), 0644))
+	}
+
+	_, err = runGit(ctx, dir, append([]string{"add", "--"}, files...)...)
+	check(err)
+	status, err := runGit(ctx, dir, "status", "--porcelain")
+	check(err)
+	if strings.TrimSpace(status) == "" {
+		ctx.Logger.Infof("Nothing changed in %v, so there's nothing to push", repo)
+		return
+	}
+	fmt.Print(status)
+
+	_, err = runGit(ctx, dir, "commit", "-m", gitOpsMessage(ctx, gitOpsRenders))
+	check(err)
+	if dryRun {
+		ctx.Logger.Infof("Committed %v changed files, but not pushing to %v since this is a dry run", len(strings.Split(strings.TrimSpace(status), "\n")), repo)
+		return
+	}
+
+	ref := "HEAD"
+	if branch != "" {
+		ref = "HEAD:" + branch
+	}
+	ctx.Logger.Infof("Pushing to %v", repo)
+	_, err = runGit(ctx, dir, "push", "origin", ref)
+	check(err)
+
+	message := fmt.Sprintf("Pushed rendered charts from %v to %v under '%v'", ctx.AnkhFilePath, repo, path)
+	ctx.Logger.Infof("%v", message)
+	if err := ctx.Audit(ankh.AuditEntry{Message: message}); err != nil {
+		ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+	}
+}
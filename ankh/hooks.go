@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// failureHooks are the `on-failure` hooks of the Ankh files and charts being
+// applied, innermost last. They run from an exit handler when ankh exits on
+// a fatal error.
+var failureHooks = []hookRun{}
+var failureHooksMtx sync.Mutex
+
+type hookRun struct {
+	Commands []string
+	Env      []string
+}
+
+func hasChartHooks(charts []ankh.Chart) bool {
+	for _, chart := range charts {
+		if chart.Hooks != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// contextEnv describes the current context to hooks, smoke tests, and plugins.
+func contextEnv(ctx *ankh.ExecutionContext, namespace string) []string {
+	return append(os.Environ(),
+		"ANKH_CONTEXT="+ctx.AnkhConfig.CurrentContextName,
+		"ANKH_KUBE_CONTEXT="+ctx.AnkhConfig.CurrentContext.KubeContext,
+		"ANKH_KUBE_SERVER="+ctx.AnkhConfig.CurrentContext.KubeServer,
+		"ANKH_ENVIRONMENT_CLASS="+ctx.AnkhConfig.CurrentContext.EnvironmentClass,
+		"ANKH_RESOURCE_PROFILE="+ctx.AnkhConfig.CurrentContext.ResourceProfile,
+		"ANKH_NAMESPACE="+namespace,
+		"ANKH_RELEASE="+ctx.AnkhConfig.CurrentContext.Release,
+		"ANKH_ACTOR="+ctx.Actor,
+	)
+}
+
+// hookEnv describes what is being applied to hooks and smoke tests.
+func hookEnv(ctx *ankh.ExecutionContext, namespace string, charts []ankh.Chart) []string {
+	names, versions, tags := []string{}, []string{}, []string{}
+	for _, chart := range charts {
+		names = append(names, chart.Name)
+		versions = append(versions, chart.Version)
+		tags = append(tags, chart.Tag)
+	}
+	return append(contextEnv(ctx, namespace),
+		"ANKH_MODE="+string(ctx.Mode),
+		"ANKH_CHART="+strings.Join(names, ","),
+		"ANKH_CHART_VERSION="+strings.Join(versions, ","),
+		"ANKH_TAG="+strings.Join(tags, ","),
+	)
+}
+
+func runHookCommands(ctx *ankh.ExecutionContext, hook string, commands []string, env []string) error {
+	for _, command := range commands {
+		ctx.Logger.Infof("Running %v hook `%v`", hook, command)
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(env, "ANKH_HOOK="+hook)
+		record := ctx.StartCommand(cmd)
+		var err error
+		withProgressPaused(func() {
+			err = cmd.Run()
+		})
+		record.Finish(err)
+		if err != nil {
+			return fmt.Errorf("%v hook `%v` failed: %v", hook, command, err)
+		}
+	}
+	return nil
+}
+
+// withHooks runs the `pre-apply` hooks, then apply, then the `post-apply` hooks.
+// If anything fails along the way, the `on-failure` hooks run as ankh exits.
+func withHooks(ctx *ankh.ExecutionContext, hooks *ankh.Hooks, what string, env []string, apply func()) {
+	if hooks == nil || ctx.Mode != ankh.Apply {
+		apply()
+		return
+	}
+	if ctx.DryRun {
+		ctx.Logger.Infof("Skipping hooks for %v since this is a dry run", what)
+		apply()
+		return
+	}
+
+	failureHooksMtx.Lock()
+	failureHooks = append(failureHooks, hookRun{Commands: hooks.OnFailure, Env: env})
+	failureHooksMtx.Unlock()
+
+	if err := runHookCommands(ctx, "pre-apply", hooks.PreApply, env); err != nil {
+		fatalf(exitApplyFailed, "Aborting %v: %v", what, err)
+	}
+	apply()
+	if err := runHookCommands(ctx, "post-apply", hooks.PostApply, env); err != nil {
+		fatalf(exitApplyFailed, "Failed applying %v: %v", what, err)
+	}
+
+	failureHooksMtx.Lock()
+	failureHooks = failureHooks[:len(failureHooks)-1]
+	failureHooksMtx.Unlock()
+}
+
+// runFailureHooks is registered as an exit handler, and runs the `on-failure`
+// hooks of everything that was being applied, innermost first.
+func runFailureHooks(ctx *ankh.ExecutionContext) {
+	failureHooksMtx.Lock()
+	runs := failureHooks
+	failureHooks = []hookRun{}
+	failureHooksMtx.Unlock()
+
+	for i := len(runs) - 1; i >= 0; i-- {
+		if err := runHookCommands(ctx, "on-failure", runs[i].Commands, runs[i].Env); err != nil {
+			ctx.Logger.Errorf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+const (
+	// hpaReplicasLive sets `spec.replicas` of workloads managed by a HorizontalPodAutoscaler to their live replicas.
+	// It's the default.
+	hpaReplicasLive = "live"
+	// hpaReplicasDrop removes `spec.replicas` from workloads managed by a HorizontalPodAutoscaler.
+	hpaReplicasDrop = "drop"
+	// hpaReplicasChart applies the chart's replicas, as templated, resetting those the HorizontalPodAutoscaler set.
+	hpaReplicasChart = "chart"
+)
+
+// preserveHPAReplicas keeps apply from resetting the replicas of workloads
+// that a HorizontalPodAutoscaler scales, unless a chart sets `hpa-replicas`
+// to `chart`. The autoscalers are found in helmOutput and in the cluster,
+// since they may come from another chart, or not from Ankh at all.
+func preserveHPAReplicas(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) string {
+	modes := make(map[string]string)
+	for _, chart := range charts {
+		switch chart.HPAReplicas {
+		case "":
+			modes[chart.Name] = hpaReplicasLive
+		case hpaReplicasDrop, hpaReplicasLive:
+			modes[chart.Name] = chart.HPAReplicas
+		case hpaReplicasChart:
+			continue
+		default:
+			fatalf(exitConfigError, "Invalid `hpa-replicas` '%v' for chart \"%v\", must be `%v`, `%v` or `%v`",
+				chart.HPAReplicas, chart.Name, hpaReplicasLive, hpaReplicasDrop, hpaReplicasChart)
+		}
+	}
+	if len(modes) == 0 {
+		return helmOutput
+	}
+
+	targets := kubectl.HPATargets(helmOutput)
+	live, err := kubectl.LiveHPATargets(ctx, namespace)
+	if err != nil {
+		ctx.Logger.Warnf("Unable to get HorizontalPodAutoscalers in namespace \"%v\", so only those in the charts are used: %v", namespace, err)
+	}
+	targets = append(targets, live...)
+
+	objectCharts := kubectl.ChartsInNamespace(helmOutput, namespace)
+	replicas := make(map[string]*int)
+	liveTargets := []string{}
+	for _, target := range targets {
+		chart, ok := objectCharts[target]
+		if _, seen := replicas[target]; !ok || seen || modes[chart] == "" {
+			continue
+		}
+		replicas[target] = nil
+		if modes[chart] == hpaReplicasLive {
+			liveTargets = append(liveTargets, target)
+		}
+	}
+	sort.Strings(liveTargets)
+
+	if len(liveTargets) > 0 {
+		liveReplicas, err := kubectl.LiveReplicas(ctx, namespace, liveTargets)
+		if err != nil {
+			fatalf(exitFailure, "Unable to get the live replicas of [ %v ] in namespace \"%v\": %v", liveTargets, namespace, err)
+		}
+		for _, target := range liveTargets {
+			if n, ok := liveReplicas[target]; ok {
+				replicas[target] = &n
+			} else {
+				// It doesn't exist yet, so the chart's replicas are a starting point.
+				delete(replicas, target)
+			}
+		}
+	}
+	if len(replicas) == 0 {
+		return helmOutput
+	}
+
+	preserved := []string{}
+	for target := range replicas {
+		preserved = append(preserved, target)
+	}
+	sort.Strings(preserved)
+	for _, target := range preserved {
+		action := "dropping `spec.replicas`"
+		if n := replicas[target]; n != nil {
+			action = fmt.Sprintf("keeping its live replicas of %v", *n)
+		}
+		ctx.Logger.Infof("%v in namespace \"%v\" is scaled by a HorizontalPodAutoscaler, so %v", target, namespace, action)
+	}
+	output, err := kubectl.SetReplicas(helmOutput, replicas)
+	check(err)
+	return output
+}
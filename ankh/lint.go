@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+)
+
+// lintOutputFormats are the formats that `lint --output` writes findings in.
+var lintOutputFormats = []string{"json", "junit", "sarif"}
+
+var sourceRegexp = regexp.MustCompile(`(?m)^# Source: (.+)$`)
+
+// objectSources maps `kind/name` to the `# Source:` path of each object in
+// helmOutput, eg: `web/templates/deployment.yaml`, which starts with the
+// name of the chart that rendered it.
+func objectSources(helmOutput string) map[string]string {
+	sources := make(map[string]string)
+	for _, doc := range strings.Split(helmOutput, "\n---") {
+		match := sourceRegexp.FindStringSubmatch(doc)
+		if match == nil {
+			continue
+		}
+		obj := helm.KubeObject{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		sources[obj.Kind+"/"+obj.Metadata.Name] = strings.TrimSpace(match[1])
+	}
+	return sources
+}
+
+// sourceFile turns the `# Source:` path of an object into its chart, and the
+// file it came from: the manifest itself for plain manifests, the template
+// in a local chart's directory, or the template's path within a remote chart.
+func sourceFile(charts []ankh.Chart, source string) (string, string) {
+	tokens := strings.SplitN(source, "/", 2)
+	if len(tokens) != 2 {
+		return "", source
+	}
+	for _, chart := range charts {
+		if chart.Name != tokens[0] {
+			continue
+		}
+		if chart.IsManifests() {
+			return chart.Name, manifestSourceFile(chart, tokens[1])
+		}
+		if chart.Path != "" {
+			return chart.Name, filepath.ToSlash(filepath.Join(chart.Path, tokens[1]))
+		}
+	}
+	return tokens[0], source
+}
+
+// manifestSourceFile finds the file of chart's `manifests` whose path,
+// relative to the directory of the entry it was found from, is source.
+func manifestSourceFile(chart ankh.Chart, source string) string {
+	for _, entry := range chart.Manifests {
+		entry = filepath.Clean(entry)
+		file := filepath.Join(filepath.Dir(entry), source)
+		if file == entry || strings.HasPrefix(file, entry+string(filepath.Separator)) {
+			return filepath.ToSlash(file)
+		}
+	}
+	return source
+}
+
+// lintFindings attributes each error found linting helmOutput to the chart,
+// file and object that it's about, where it can.
+func lintFindings(charts []ankh.Chart, helmOutput string, errors []error) []ankh.LintFinding {
+	sources := objectSources(helmOutput)
+	findings := []ankh.LintFinding{}
+	for _, err := range errors {
+		finding := ankh.LintFinding{Rule: "lint", Message: err.Error()}
+		if objectErr, ok := err.(*ankh.ObjectError); ok {
+			finding.Rule = objectErr.Rule
+			finding.Kind = objectErr.Kind
+			finding.Name = objectErr.Name
+			if source, ok := sources[objectErr.Kind+"/"+objectErr.Name]; ok {
+				finding.Chart, finding.File = sourceFile(charts, source)
+			}
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+func recordLintResult(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, charts []ankh.Chart, namespace string,
+	helmOutput string, errors []error, scores map[string]int) {
+	result := ankh.LintResult{
+		Context:   ctx.AnkhConfig.CurrentContextName,
+		Namespace: namespace,
+		AnkhFile:  ankhFile.Path,
+		Charts:    []string{},
+		Findings:  lintFindings(charts, helmOutput, errors),
+		Scores:    scores,
+	}
+	for _, chart := range charts {
+		result.Charts = append(result.Charts, chart.Name)
+	}
+	for _, err := range errors {
+		ctx.Logger.Warningf("%v", err)
+	}
+	if len(errors) == 0 {
+		ctx.Logger.Infof("No issues.")
+	}
+	ctx.LintResults = append(ctx.LintResults, result)
+}
+
+// lintErrors counts the errors found by lint during this run.
+func lintErrors(ctx *ankh.ExecutionContext) int {
+	count := 0
+	for _, result := range ctx.LintResults {
+		count += len(result.Findings)
+	}
+	return count
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// lintJUnit formats lint results as a JUnit XML test suite, with a test case
+// for the charts linted on each namespace, which fails if lint found errors.
+func lintJUnit(results []ankh.LintResult) ([]byte, error) {
+	suite := junitTestSuite{Name: "ankh lint", TestCases: []junitTestCase{}}
+	for _, result := range results {
+		testCase := junitTestCase{
+			ClassName: fmt.Sprintf("%v.%v", result.Context, result.Namespace),
+			Name:      strings.Join(result.Charts, ","),
+		}
+		if len(result.Findings) > 0 {
+			lines := []string{}
+			for _, finding := range result.Findings {
+				if finding.File != "" {
+					lines = append(lines, fmt.Sprintf("%v: %v", finding.File, finding.Message))
+				} else {
+					lines = append(lines, finding.Message)
+				}
+			}
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("Lint found %d errors", len(result.Findings)),
+				Body:    strings.Join(lines, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Tests++
+	}
+	body, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+// sarifURI makes path relative to the working directory when it's inside it,
+// since code scanning UIs expect paths relative to the root of the repository.
+func sarifURI(path string) string {
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// lintSARIF formats lint results as a SARIF 2.1.0 log, for code scanning UIs.
+// Each finding is located in the file that rendered the object, when it's
+// known, and by the object's context, namespace, kind and name.
+func lintSARIF(results []ankh.LintResult) ([]byte, error) {
+	rules := []sarifRule{}
+	seenRules := make(map[string]bool)
+	sarifResults := []sarifResult{}
+	for _, result := range results {
+		for _, finding := range result.Findings {
+			if !seenRules[finding.Rule] {
+				seenRules[finding.Rule] = true
+				rules = append(rules, sarifRule{ID: finding.Rule})
+			}
+
+			location := sarifLocation{}
+			file := finding.File
+			if file == "" {
+				file = result.AnkhFile
+			}
+			if file != "" {
+				location.PhysicalLocation = &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: sarifURI(file)}}
+			}
+			if finding.Kind != "" {
+				object := fmt.Sprintf("%v/%v", finding.Kind, finding.Name)
+				location.LogicalLocations = []sarifLogicalLocation{{
+					Name:               object,
+					FullyQualifiedName: fmt.Sprintf("%v/%v/%v", result.Context, result.Namespace, object),
+					Kind:               "object",
+				}}
+			}
+			sarifResults = append(sarifResults, sarifResult{
+				RuleID:    finding.Rule,
+				Level:     "error",
+				Message:   sarifMessage{Text: finding.Message},
+				Locations: []sarifLocation{location},
+			})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	log := map[string]interface{}{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":           "ankh",
+						"version":        AnkhBuildVersion,
+						"informationUri": "https://github.com/appnexus/ankh",
+						"rules":          rules,
+					},
+				},
+				"results": sarifResults,
+			},
+		},
+	}
+	body, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
+
+// formatLintResults formats lint results for `lint --output`.
+func formatLintResults(results []ankh.LintResult, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		if results == nil {
+			results = []ankh.LintResult{}
+		}
+		body, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(body, '\n'), nil
+	case "junit":
+		return lintJUnit(results)
+	case "sarif":
+		return lintSARIF(results)
+	}
+	return nil, fmt.Errorf("Invalid output format '%v', must be one of [ %v ]", format, strings.Join(lintOutputFormats, ", "))
+}
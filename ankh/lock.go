@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+const defaultDeployLockTTL = "1h"
+
+// heldLocks tracks the deploy locks held by this run, by namespace, so that
+// they can be released if ankh exits early.
+var heldLocks = make(map[string]kubectl.DeployLock)
+var heldLocksMtx sync.Mutex
+
+func lockHolder(ctx *ankh.ExecutionContext) string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%v@%v", ctx.Actor, hostname)
+}
+
+func deployLockTTL(ctx *ankh.ExecutionContext) time.Duration {
+	ttl := ctx.AnkhConfig.DeployLock.TTL
+	if ttl == "" {
+		ttl = defaultDeployLockTTL
+	}
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		fatalf(exitConfigError, "Invalid `deploy-lock.ttl` '%v': %v", ttl, err)
+	}
+	return duration
+}
+
+func acquireDeployLock(ctx *ankh.ExecutionContext, namespace string) {
+	holder := lockHolder(ctx)
+	lock := kubectl.DeployLock{
+		Name:     kubectl.LockName(ctx.AnkhConfig.CurrentContext.Release),
+		Holder:   holder,
+		ID:       fmt.Sprintf("%v-%v-%v", holder, os.Getpid(), time.Now().UnixNano()),
+		Acquired: time.Now(),
+	}
+
+	ctx.Logger.Infof("Acquiring deploy lock '%v' in namespace \"%v\"", lock.Name, namespace)
+	if err := kubectl.AcquireLock(ctx, namespace, lock, deployLockTTL(ctx)); err != nil {
+		fatalf(exitFailure, "%v", err)
+	}
+
+	heldLocksMtx.Lock()
+	heldLocks[namespace] = lock
+	heldLocksMtx.Unlock()
+}
+
+func releaseDeployLock(ctx *ankh.ExecutionContext, namespace string) {
+	heldLocksMtx.Lock()
+	lock, ok := heldLocks[namespace]
+	delete(heldLocks, namespace)
+	heldLocksMtx.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx.Logger.Debugf("Releasing deploy lock '%v' in namespace \"%v\"", lock.Name, namespace)
+	if err := kubectl.ReleaseLock(ctx, namespace, lock.Name, lock.ID, false); err != nil {
+		ctx.Logger.Warnf("Failed to release deploy lock '%v' in namespace \"%v\": %v", lock.Name, namespace, err)
+	}
+}
+
+// releaseAllDeployLocks is registered as an exit handler, so that locks are
+// released when ankh exits on a fatal error.
+func releaseAllDeployLocks(ctx *ankh.ExecutionContext) {
+	heldLocksMtx.Lock()
+	namespaces := []string{}
+	for namespace, _ := range heldLocks {
+		namespaces = append(namespaces, namespace)
+	}
+	heldLocksMtx.Unlock()
+
+	for _, namespace := range namespaces {
+		releaseDeployLock(ctx, namespace)
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"text/tabwriter"
 	"time"
@@ -22,10 +27,13 @@ import (
 
 	"github.com/appnexus/ankh/config"
 	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/convert"
 	"github.com/appnexus/ankh/docker"
 	"github.com/appnexus/ankh/helm"
+	"github.com/appnexus/ankh/keyring"
 	"github.com/appnexus/ankh/kubectl"
 	"github.com/appnexus/ankh/util"
+	"github.com/appnexus/ankh/vcs"
 )
 
 var AnkhBuildVersion string = "DEVELOPMENT"
@@ -42,16 +50,73 @@ func setLogLevel(ctx *ankh.ExecutionContext, level logrus.Level) {
 	}
 }
 
+// logFields are the stable fields of structured logs: what ctx is operating on.
+func logFields(ctx *ankh.ExecutionContext) logrus.Fields {
+	context := ctx.AnkhConfig.CurrentContextName
+	if context == "" {
+		context = ctx.Context
+	}
+	chart := ctx.LogChart
+	if chart == "" {
+		chart = ctx.Chart
+	}
+	namespace := ctx.LogNamespace
+	if namespace == "" && ctx.Namespace != nil {
+		namespace = *ctx.Namespace
+	}
+	return logrus.Fields{
+		"mode":        string(ctx.Mode),
+		"context":     context,
+		"environment": ctx.Environment,
+		"chart":       chart,
+		"namespace":   namespace,
+	}
+}
+
+// logScope sets the charts and namespace that ctx is operating on, for
+// structured logs, and returns a func that restores the previous ones.
+func logScope(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string) func() {
+	chart, ns := ctx.LogChart, ctx.LogNamespace
+	names := []string{}
+	for _, c := range charts {
+		names = append(names, c.Name)
+	}
+	ctx.LogChart = strings.Join(names, ",")
+	ctx.LogNamespace = namespace
+	return func() {
+		ctx.LogChart, ctx.LogNamespace = chart, ns
+	}
+}
+
+// signalHandler interrupts the run on SIGINT or SIGTERM, which stops the
+// commands that are running, and exits once they have, through the exit
+// handlers, so that deploy locks are released and the run summary shows
+// what was applied. A second signal exits right away. While ankh.CatchingSignals,
+// SIGINT is left to the command the user is interacting with.
 func signalHandler(ctx *ankh.ExecutionContext, sigs chan os.Signal) {
-	process, _ := os.FindProcess(os.Getpid())
-	for {
-		sig := <-sigs
-		if !ctx.CatchSignals {
-			// This appears to work, but still doesn't seem totally right.
-			signal.Stop(sigs)
-			process.Signal(sig)
-			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range sigs {
+		if ankh.CatchingSignals() && sig == syscall.SIGINT {
+			continue
+		}
+		code := interruptedExitCode(sig)
+		if ankh.Interrupted() != nil {
+			log.Warnf("Received %v again, so exiting without cleaning up", ankh.SignalName(sig))
+			os.Exit(code)
 		}
+
+		log.Warnf("Received %v, so stopping the commands that are running (%v). Send it again to exit right away",
+			ankh.SignalName(sig), ankh.RunningCommands())
+		// Exit with code, even when ankh exits by failing on a stopped command.
+		exitCode = code
+		logrus.RegisterExitHandler(func() {
+			os.Exit(code)
+		})
+		ankh.Interrupt(sig)
+		go func() {
+			// Ankh usually exits by failing on a stopped command first.
+			time.Sleep(interruptGrace)
+			exit(code)
+		}()
 	}
 }
 
@@ -77,15 +142,58 @@ func printContexts(ankhConfig *ankh.AnkhConfig) {
 	}
 }
 
+// resolveChartNamespaces returns a copy of charts, where charts without a
+// namespace use the namespace of the current context's kube-context, when the
+// context sets `use-kube-context-namespace`. It runs for each context, since
+// each context's kube-context may have a different namespace.
+func resolveChartNamespaces(ctx *ankh.ExecutionContext, charts []ankh.Chart) ([]ankh.Chart, error) {
+	resolved := make([]ankh.Chart, len(charts))
+	copy(resolved, charts)
+	// A namespace set on the command line overrides every chart's namespace.
+	if ctx.Namespace != nil {
+		return resolved, nil
+	}
+
+	// The kube-context's namespace is looked up at most once, and only if some chart needs it.
+	var kubeContextNamespace *string
+	for i := 0; i < len(resolved); i++ {
+		chart := &resolved[i]
+		if chart.Namespace == nil && ctx.AnkhConfig.CurrentContext.UseKubeContextNamespace {
+			if kubeContextNamespace == nil {
+				namespace, err := kubectl.KubeContextNamespace(ctx)
+				if err != nil {
+					return nil, err
+				}
+				kubeContextNamespace = &namespace
+			}
+			if *kubeContextNamespace != "" {
+				ctx.Logger.Infof("Using namespace \"%v\" from kube-context \"%v\" "+
+					"for chart \"%v\" which has no explicit namespace set",
+					*kubeContextNamespace, ctx.AnkhConfig.CurrentContext.KubeContext, chart.Name)
+				chart.Namespace = kubeContextNamespace
+			}
+		}
+		if chart.Namespace == nil {
+			fatalf(exitConfigError, "Namespace is required for chart \"%v\" in context \"%v\". "+
+				"Provide a namespace either on the command line using `-n/--namespace`, "+
+				"using `namespace:` in an Ankh file where this chart is defined (eg: ankh.yaml), "+
+				"on the chart entry in the `charts` array in an Ankh file, "+
+				"or on the kube-context when the current context sets `use-kube-context-namespace: true`.",
+				chart.Name, ctx.AnkhConfig.CurrentContextName)
+		}
+	}
+	return resolved, nil
+}
+
 func promptForChartVersionsAndTagValues(ctx *ankh.ExecutionContext, ankhFile *ankh.AnkhFile) error {
 	// Prompt for chart versions if any are missing
 	for i := 0; i < len(ankhFile.Charts); i++ {
 		chart := &ankhFile.Charts[i]
 
-		// Ensure that we have a namespace before we prompt for versions.
-		// If namespace is set on the command line, we'll use that as an
-		// override later during executeChartsOnNamespace, so don't check
-		// for anything here.
+		// Charts without a namespace use the Ankh file's. If namespace is
+		// set on the command line, we'll use that as an override later
+		// during executeChartsOnNamespace, and charts that still have no
+		// namespace are resolved for each context by resolveChartNamespaces.
 		if ctx.Namespace == nil {
 			if ankhFile.Namespace != nil && chart.Namespace == nil {
 				ctx.Logger.Infof("Using namespace \"%v\" from Ankh file "+
@@ -93,16 +201,13 @@ func promptForChartVersionsAndTagValues(ctx *ankh.ExecutionContext, ankhFile *an
 					*ankhFile.Namespace, chart.Name)
 				chart.Namespace = ankhFile.Namespace
 			}
-			if chart.Namespace == nil {
-				ctx.Logger.Fatalf("Namespace is required for chart \"%v\". "+
-					"Provide a namespace either on the command line using `-n/--namespace`, "+
-					"using `namespace:` in an Ankh file where this chart is defined (eg: ankh.yaml), "+
-					"or on the chart entry in the `charts` array in an Ankh file.",
-				chart.Name)
-			}
 		}
 
-		if chart.Version == "" {
+		if chart.Version == "" && !chart.IsManifests() {
+			if ctx.NoPrompt {
+				return fmt.Errorf("Chart \"%v\" has no version, and prompts are disabled. "+
+					"Set `version` on the chart, or pass `--chart %v@VERSION`", chart.Name, chart.Name)
+			}
 			versions, err := helm.ListVersions(ctx, chart.Name, true)
 			if err != nil {
 				return err
@@ -145,6 +250,20 @@ func promptForChartVersionsAndTagValues(ctx *ankh.ExecutionContext, ankhFile *an
 		switch ctx.Mode {
 		case ankh.Rollback:
 			fallthrough
+		case ankh.Scale:
+			fallthrough
+		case ankh.Restart:
+			fallthrough
+		case ankh.Events:
+			fallthrough
+		case ankh.Top:
+			fallthrough
+		case ankh.Describe:
+			fallthrough
+		case ankh.Wait:
+			fallthrough
+		case ankh.Cp:
+			fallthrough
 		case ankh.Get:
 			fallthrough
 		case ankh.Pods:
@@ -155,15 +274,18 @@ func promptForChartVersionsAndTagValues(ctx *ankh.ExecutionContext, ankhFile *an
 			_, ok := ctx.HelmSetValues[tagValueName]
 			if !ok {
 				// It's unset, so set it for the purpose of this execution
-				tag := "__ankh_tag_value_unset___"
 				ctx.Logger.Debugf("Setting configured tagValueName %v=%v for a safe operation",
-					tagValueName, tag)
-				chart.Tag = tag
+					tagValueName, unsetTagValue)
+				chart.Tag = unsetTagValue
 			}
 		}
 
 		// If we stil don't have a chart.Tag value, prompt.
 		if chart.Tag == "" {
+			if ctx.NoPrompt {
+				return fmt.Errorf("No tag specified for chart \"%v\", and prompts are disabled. "+
+					"Pass `--set %v=TAG`", chart.Name, tagValueName)
+			}
 			// It's common for the primary image to be named after the chart, so that's our best guess
 			// as a default suggestion.
 			defaultValue := chart.Name
@@ -171,6 +293,7 @@ func promptForChartVersionsAndTagValues(ctx *ankh.ExecutionContext, ankhFile *an
 			image, err := util.PromptForInput(defaultValue,
 				fmt.Sprintf("No tag specified for chart '%v'. Provide the name of an image to select tags for => ", chart.Name))
 			check(err)
+			chart.TagImage = image
 
 			output, err := docker.ListTags(ctx, image, true)
 			check(err)
@@ -191,42 +314,167 @@ func promptForChartVersionsAndTagValues(ctx *ankh.ExecutionContext, ankhFile *an
 				if ctx.IgnoreConfigErrors {
 					ctx.Logger.Warnf("%v", complaint)
 				} else {
-					ctx.Logger.Fatalf("%v", complaint)
+					fatalf(exitConfigError, "%v", complaint)
+				}
+			}
+		}
+
+		// Convert the tag value to what the chart takes, eg: a full image ref from a bare tag.
+		if chart.Tag != "" && chart.Tag != unsetTagValue {
+			if ctx.PinDigests || chart.PinDigest {
+				if err := pinDigest(ctx, chart); err != nil {
+					return fmt.Errorf("Unable to pin the tag of chart \"%v\" to a digest: %v", chart.Name, err)
 				}
 			}
+			tag, err := formatTagValue(ctx, *chart)
+			if err != nil {
+				return fmt.Errorf("Invalid tag value for `%v` of chart \"%v\": %v", tagValueName, chart.Name, err)
+			}
+			if tag != chart.Tag {
+				ctx.Logger.Infof("Using tag value \"%v=%v\" for chart \"%v\"", tagValueName, tag, chart.Name)
+				chart.Tag = tag
+			}
 		}
 	}
 
 	return nil
 }
 
-func filterOutput(ctx *ankh.ExecutionContext, helmOutput string) string {
-	ctx.Logger.Debugf("Filtering with inclusive list `%v`", ctx.Filters)
+// unsetTagValue is the tag value used for operations that only need a chart templated, rather than applied.
+const unsetTagValue = "__ankh_tag_value_unset___"
+
+// formatTagValue converts chart.Tag, which may be a bare tag, a digest, or a
+// full image ref, into the format that the chart's tagvaluename takes.
+func formatTagValue(ctx *ankh.ExecutionContext, chart ankh.Chart) (string, error) {
+	format := ctx.AnkhConfig.Helm.TagFormat
+	if chart.TagFormat != "" {
+		format = chart.TagFormat
+	}
+	return util.FormatTagValue(chart.Tag, format, chartImage(ctx, chart.Image, chart.Name))
+}
+
+// chartImage is the repository of image, or else of name, in
+// `docker.registry`, which full image refs are made with.
+func chartImage(ctx *ankh.ExecutionContext, image string, name string) string {
+	if image != "" {
+		return image
+	}
+	if registry := ctx.AnkhConfig.Docker.Registry; registry != "" {
+		// Image refs don't have a scheme, though the registry's address may.
+		registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+		return strings.TrimSuffix(registry, "/") + "/" + name
+	}
+	return name
+}
+
+type objectRef struct {
+	Kind     string
+	Metadata struct {
+		Name string
+	}
+}
+
+// parseOnly validates `--only` arguments, which are of the form `kind/name`.
+func parseOnly(only []string) ([]string, error) {
+	objects := []string{}
+	for _, o := range only {
+		tokens := strings.SplitN(o, "/", 2)
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return objects, fmt.Errorf("Invalid `--only` argument '%v'. Must be of the form `kind/name`, eg: `deployment/web`", o)
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+// checkOutputFormat validates `get` and `pods` output formats, which replace
+// passing `-o` to kubectl after `--`, so both can't be used at once.
+func checkOutputFormat(mode ankh.Mode, format string, extra []string) error {
+	if err := kubectl.ValidateOutputFormat(mode, format); err != nil {
+		return err
+	}
+	if format == "" {
+		return nil
+	}
+	for _, e := range extra {
+		if e == "--output" || strings.HasPrefix(e, "--output=") || (strings.HasPrefix(e, "-o") && !strings.HasPrefix(e, "--")) {
+			return fmt.Errorf("Use either `-o %v` or pass `%v` to kubectl after `--`, not both", format, e)
+		}
+	}
+	return nil
+}
+
+// matchOnly returns the `--only` entry that an object matches, if any. Kinds are
+// case insensitive and may include an api group, eg: `deployment.apps/web`.
+func matchOnly(ctx *ankh.ExecutionContext, obj string) (string, bool) {
+	ref := objectRef{}
+	if err := yaml.Unmarshal([]byte(obj), &ref); err != nil || ref.Kind == "" {
+		return "", false
+	}
+	for _, o := range ctx.OnlyObjects {
+		tokens := strings.SplitN(o, "/", 2)
+		kind := strings.Split(tokens[0], ".")[0]
+		if strings.EqualFold(kind, ref.Kind) && tokens[1] == ref.Metadata.Name {
+			return o, true
+		}
+	}
+	return "", false
+}
+
+// objectFilter returns whether to keep an object, for `--filter` and `--only`,
+// and a func that warns about each `--only` that no object kept matched.
+func objectFilter(ctx *ankh.ExecutionContext) (func(obj string) bool, func()) {
+	ctx.Logger.Debugf("Filtering with inclusive list `%v` and objects `%v`", ctx.Filters, ctx.OnlyObjects)
 
 	// The golang yaml library doesn't actually support whitespace/comment
 	// preserving round-trip parsing. So, we're going to filter the "hard way".
-	filtered := []string{}
-	objs := strings.Split(helmOutput, "---")
-	for _, obj := range objs {
+	matchedOnly := make(map[string]bool)
+	keep := func(obj string) bool {
+		if len(ctx.OnlyObjects) > 0 {
+			o, ok := matchOnly(ctx, obj)
+			if !ok {
+				return false
+			}
+			matchedOnly[o] = true
+			if len(ctx.Filters) == 0 {
+				return true
+			}
+		}
+
 		lines := strings.Split(obj, "\n")
 		for _, line := range lines {
 			if !strings.HasPrefix(line, "kind:") {
 				continue
 			}
-			matched := false
 			for _, s := range ctx.Filters {
 				kind := strings.Trim(line[5:], " ")
 				if strings.EqualFold(kind, s) {
-					matched = true
-					break
+					return true
 				}
 			}
-			if matched {
-				filtered = append(filtered, obj)
-				break
+		}
+		return false
+	}
+	warn := func() {
+		for _, o := range ctx.OnlyObjects {
+			if !matchedOnly[o] {
+				ctx.Logger.Warnf("No templated object matched `--only %v`", o)
 			}
 		}
 	}
+	return keep, warn
+}
+
+func filterOutput(ctx *ankh.ExecutionContext, helmOutput string) string {
+	keep, warn := objectFilter(ctx)
+	filtered := []string{}
+	objs := strings.Split(helmOutput, "---")
+	for _, obj := range objs {
+		if keep(obj) {
+			filtered = append(filtered, obj)
+		}
+	}
+	warn()
 
 	return "---" + strings.Join(filtered, "---")
 }
@@ -238,18 +486,40 @@ func logExecuteAnkhFile(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile) {
 		action = "Applying chart"
 	case ankh.Rollback:
 		action = "Rolling back Deployment/StatefulSet from chart"
+	case ankh.Scale:
+		action = "Scaling Deployment/StatefulSet from chart"
+	case ankh.Restart:
+		action = "Restarting Deployment/StatefulSet/DaemonSet from chart"
+	case ankh.Events:
+		action = "Getting events for objects from chart"
+	case ankh.Top:
+		action = "Getting resource usage for pods from chart"
 	case ankh.Diff:
 		action = "Diffing objects from chart"
+	case ankh.Drift:
+		action = "Checking drift of objects from chart"
 	case ankh.Exec:
 		action = "Exec'ing on pods from chart"
+	case ankh.Cp:
+		action = "Copying files to or from pods from chart"
+	case ankh.RunJob:
+		action = "Running Jobs from chart"
+	case ankh.Wait:
+		action = "Waiting for objects from chart"
 	case ankh.Explain:
 		action = "Explaining"
 	case ankh.Get:
 		action = "Getting objects from chart"
+	case ankh.Describe:
+		action = "Describing objects from chart"
 	case ankh.Pods:
 		action = "Getting pods for Deployment/StatefulSet from chart"
 	case ankh.Template:
 		action = "Templating"
+	case ankh.GitOps:
+		action = "Rendering for GitOps"
+	case ankh.Export:
+		action = "Exporting"
 	case ankh.Lint:
 		action = "Linting"
 	case ankh.Logs:
@@ -277,9 +547,98 @@ func logExecuteAnkhFile(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile) {
 		ctx.AnkhConfig.CurrentContext.ResourceProfile)
 }
 
+func recordApplySummaries(ctx *ankh.ExecutionContext, summaries []ankh.ApplySummary, namespace string) {
+	for _, summary := range summaries {
+		chart := summary.Chart
+		if chart == "" {
+			chart = "(unknown)"
+		}
+		ctx.Logger.Infof("Applied chart \"%v\" to namespace \"%v\": %v", chart, namespace, summary)
+		if progress != nil && summary.Chart != "" {
+			progress.Note(progressTaskName(ctx, namespace, summary.Chart), summary.String())
+		}
+		recordChartOutcome(ctx, namespace, summary)
+	}
+	ctx.ApplySummaries = append(ctx.ApplySummaries, summaries...)
+
+	err := ctx.Audit(ankh.AuditEntry{
+		Namespace:      namespace,
+		ApplySummaries: summaries,
+	})
+	if err != nil {
+		ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+	}
+}
+
+func writeRunResult(ctx *ankh.ExecutionContext, contexts []string) {
+	for _, summary := range ankh.SummarizeCommands(ctx.Commands) {
+		ctx.Logger.Debugf("Spent %v running `%v` %v times, the slowest taking %v",
+			summary.Total.Round(time.Millisecond), summary.Command, summary.Count, summary.Slowest.Round(time.Millisecond))
+	}
+	resultPath, err := ctx.WriteRunResult(ankh.RunResult{
+		Mode:           ctx.Mode,
+		Actor:          ctx.Actor,
+		AnkhFilePath:   ctx.AnkhFilePath,
+		Environment:    ctx.Environment,
+		Contexts:       contexts,
+		ApplySummaries: ctx.ApplySummaries,
+		LintResults:    ctx.LintResults,
+		Commands:       ctx.Commands,
+	})
+	if err != nil {
+		ctx.Logger.Warnf("Failed to write run result: %v", err)
+		return
+	}
+	ctx.Logger.Debugf("Wrote run result to %v", resultPath)
+}
+
+// execute runs the current mode over the Ankh file given by `-f`, or when
+// `-f` isn't given, over each Ankh file in the workspace. The freeze windows
+// of the contexts operated on are checked once, up front, however many Ankh
+// files there are.
 func execute(ctx *ankh.ExecutionContext) {
-	rootAnkhFile, err := ankh.GetAnkhFile(ctx)
+	freezeContexts := []string{ctx.AnkhConfig.CurrentContextName}
+	if ctx.Environment != "" {
+		freezeContexts = ctx.AnkhConfig.Environments[ctx.Environment].Contexts
+	}
+	checkFreezeWindows(ctx, freezeContexts)
+
+	if ctx.Workspace == nil {
+		executeAnkhFilePath(ctx)
+		return
+	}
+
+	if len(ctx.Filters) == 0 && len(ctx.OnlyObjects) == 0 {
+		ctx.Filters = ctx.Workspace.Filters
+	}
+	if ctx.AnkhFilePath != defaultAnkhFilePath || len(ctx.Workspace.AnkhFiles) == 0 {
+		executeAnkhFilePath(ctx)
+		return
+	}
+	executeWorkspace(ctx, executeAnkhFilePath)
+}
+
+// executeWorkspace runs each Ankh file of ctx.Workspace with run.
+func executeWorkspace(ctx *ankh.ExecutionContext, run func(ctx *ankh.ExecutionContext)) {
+	cwd, err := os.Getwd()
 	check(err)
+	for _, ankhFilePath := range ctx.Workspace.AnkhFiles {
+		log.Infof("Executing Ankh file %v from workspace \"%v\"", ankhFilePath, ctx.Workspace.Name)
+		ctx.AnkhFilePath = ankhFilePath
+		// Local chart paths are relative to where Ankh runs, so run each
+		// Ankh file from its own directory, as if it were run from its repo.
+		if u, err := url.Parse(ankhFilePath); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			check(os.Chdir(filepath.Dir(ankhFilePath)))
+		}
+		run(ctx)
+		check(os.Chdir(cwd))
+	}
+}
+
+func executeAnkhFilePath(ctx *ankh.ExecutionContext) {
+	rootAnkhFile, err := ankh.GetAnkhFile(ctx)
+	checkWith(exitConfigError, err)
+	checkModeBinaries(ctx, rootAnkhFile)
 
 	err = promptForChartVersionsAndTagValues(ctx, &rootAnkhFile)
 	check(err)
@@ -291,28 +650,45 @@ func execute(ctx *ankh.ExecutionContext) {
 			log.Errorf("Environment '%v' not found in `environments`", ctx.Environment)
 			log.Info("The following environments are available:")
 			printEnvironments(&ctx.AnkhConfig)
-			os.Exit(1)
+			exit(exitConfigError)
 		}
 
 		contexts = environment.Contexts
 		log.Infof("Executing over environment \"%v\" with contexts [ %v ]", ctx.Environment, strings.Join(contexts, ", "))
+		authenticateContexts(ctx, contexts)
 
-		for _, context := range contexts {
+		for i, context := range contexts {
+			unstartedContexts = contexts[i+1:]
 			log.Infof("Beginning to operate on context \"%v\" in environment \"%v\"", context, ctx.Environment)
 			switchContext(ctx, &ctx.AnkhConfig, context)
-			executeContext(ctx, rootAnkhFile)
+			withGitHubDeployment(ctx, func() {
+				executeContext(ctx, rootAnkhFile)
+			})
+			if ctx.Mode == ankh.Apply && !ctx.DryRun {
+				appliedEnvironmentContexts++
+			}
 			log.Infof("Finished with context \"%v\" in environment \"%v\"", context, ctx.Environment)
 		}
 	} else {
 		if ctx.AnkhConfig.CurrentContextName == "" {
 			// Not sure if this is possible actually
-			log.Fatalf("No CurrentContextName found. Must provide an explicit `--context` or `--environment`")
+			fatalf(exitConfigError, "No CurrentContextName found. Must provide an explicit `--context` or `--environment`")
 		}
-		executeContext(ctx, rootAnkhFile)
+		contexts = []string{ctx.AnkhConfig.CurrentContextName}
+		authenticateContexts(ctx, contexts)
+		withGitHubDeployment(ctx, func() {
+			executeContext(ctx, rootAnkhFile)
+		})
 	}
+
+	writeRunResult(ctx, contexts)
 }
 
 func executeContext(ctx *ankh.ExecutionContext, rootAnkhFile ankh.AnkhFile) {
+	if ctx.Mode == ankh.Apply && ctx.Options.ApplyAtomic && !ctx.FeatureEnabled("atomic-apply") {
+		fatalf(exitConfigError, "`--atomic` needs the `atomic-apply` feature, which is not enabled for context \"%v\". "+
+			"Run `ankh features list` to see why", ctx.AnkhConfig.CurrentContextName)
+	}
 
 	dependencies := []string{}
 	if ctx.Chart == "" {
@@ -322,56 +698,225 @@ func executeContext(ctx *ankh.ExecutionContext, rootAnkhFile ankh.AnkhFile) {
 	}
 
 	executeAnkhFile := func(ankhFile ankh.AnkhFile) {
+		charts, err := resolveChartNamespaces(ctx, ankhFile.Charts)
+		check(err)
+		ankhFile.Charts = charts
 		logExecuteAnkhFile(ctx, ankhFile)
 
-		if ctx.HelmVersion == "" {
-			ver, err := helm.Version()
+		if ctx.Mode == ankh.Apply {
+			checkWith(exitConfigError, verifyImages(ctx, ankhFile.Charts))
+			waitForPreconditions(ctx, ankhFile)
+		}
+
+		if ctx.HelmVersion == "" && !binaryMissing("helm") {
+			ver, err := helm.Version(ctx)
 			if err != nil {
-				ctx.Logger.Fatalf("Failed to get helm version info: %v", err)
+				fatalf(exitFailure, "Failed to get helm version info: %v", err)
 			}
 			ctx.HelmVersion = ver
 			ctx.Logger.Debug("Using helm version: ", strings.TrimSpace(ver))
 		}
 
 		executeChartsOnNamespace := func(charts []ankh.Chart, namespace string) {
-			helmOutput, err := helm.Template(ctx, charts, namespace)
-			check(err)
+			defer logScope(ctx, charts, namespace)()
+
+			if ctx.Mode == ankh.Values {
+				printChartValues(ctx, charts, namespace)
+				return
+			}
+			if ctx.Mode == ankh.Export {
+				recordFluxReleases(ctx, charts, namespace)
+				return
+			}
+
+			if canStreamTemplate(ctx, ankhFile) {
+				checkWith(exitTemplateError, streamTemplate(ctx, ankhFile, charts, namespace, os.Stdout))
+				return
+			}
 
-			if len(ctx.Filters) > 0 {
-				helmOutput = filterOutput(ctx, helmOutput)
+			setProgress(ctx, charts, namespace, "templating")
+			startChartOutcomes(ctx, charts, namespace)
+			// Charts streamed to kubectl are templated as kubectl reads them.
+			streamKubectl := canStreamKubectl(ctx, ankhFile, charts)
+			helmOutput := ""
+			if !streamKubectl {
+				var err error
+				helmOutput, err = helm.Template(ctx, charts, namespace)
+				checkWith(exitTemplateError, err)
+
+				helmOutput, err = injectCommonMetadata(ctx, ankhFile, helmOutput)
+				check(err)
+				if ankhFile.ConfigChecksums || ctx.AnkhConfig.CurrentContext.ConfigChecksums {
+					helmOutput, err = kubectl.InjectConfigChecksums(helmOutput)
+					check(err)
+				}
+
+				if len(ctx.Filters) > 0 || len(ctx.OnlyObjects) > 0 {
+					helmOutput = filterOutput(ctx, helmOutput)
+				}
+				switch ctx.Mode {
+				case ankh.Apply, ankh.Diff, ankh.Drift:
+					helmOutput = preserveHPAReplicas(ctx, charts, namespace, helmOutput)
+				}
+				if ctx.Namespace != nil {
+					helmOutput = checkNamespaceOverride(ctx, namespace, helmOutput)
+				}
 			}
 
 			switch ctx.Mode {
+			case ankh.Drift:
+				checkChartDrift(ctx, charts, namespace, helmOutput)
 			case ankh.Diff:
 				fallthrough
 			case ankh.Rollback:
 				fallthrough
 			case ankh.Get:
 				fallthrough
+			case ankh.Describe:
+				fallthrough
 			case ankh.Pods:
 				fallthrough
 			case ankh.Exec:
 				fallthrough
+			case ankh.Cp:
+				fallthrough
 			case ankh.Explain:
 				fallthrough
 			case ankh.Logs:
 				fallthrough
 			case ankh.Apply:
-				if ctx.KubectlVersion == "" {
-					ver, err := kubectl.Version()
+				if ctx.KubectlVersion == "" && !binaryMissing("kubectl") {
+					ver, err := kubectl.Version(ctx)
 					if err != nil {
-						ctx.Logger.Fatalf("Failed to get kubectl version info: %v", err)
+						fatalf(exitFailure, "Failed to get kubectl version info: %v", err)
 					}
 					ctx.KubectlVersion = ver
 					ctx.Logger.Debug("Using kubectl version: ", strings.TrimSpace(ver))
 				}
 
-				kubectlOutput, err := kubectl.Execute(ctx, helmOutput, namespace, nil)
-				if err != nil && ctx.Mode == ankh.Diff {
-					ctx.Logger.Warnf("The `diff` feature entered alpha in kubectl v1.9.0, and seems to work best at version v1.12.1. "+
-						"Your results may vary. Current kubectl version string is `%s`", ctx.KubectlVersion)
+				// Cleanup needs every object, not just those that are applied, to
+				// tell which of the charts' Jobs and ReplicaSets are still in use.
+				templatedOutput := helmOutput
+				if ctx.Mode == ankh.Apply {
+					for _, err := range checkDeprecatedAPIs(ctx, helmOutput) {
+						ctx.Logger.Warnf("%v", err)
+					}
+					if violations := checkPolicies(ctx, helmOutput); len(violations) > 0 {
+						for _, err := range violations {
+							ctx.Logger.Errorf("%v", err)
+						}
+						ctx.Logger.Errorf("Refusing to apply to namespace \"%v\" because of the policy violations above, from '%v'",
+							namespace, ctx.AnkhConfig.Policy.Path)
+						exit(exitPolicyDenied)
+					}
+					if vulnerable := scanImages(ctx, namespace, helmOutput); len(vulnerable) > 0 {
+						for _, err := range vulnerable {
+							ctx.Logger.Errorf("%v", err)
+						}
+						ctx.Logger.Errorf("Refusing to apply to namespace \"%v\" because of the vulnerabilities above. "+
+							"Pass `--skip-scan REASON` to apply anyway", namespace)
+						exit(exitVulnerable)
+					}
+					if unverified := verifyImageSignatures(ctx, helmOutput); len(unverified) > 0 {
+						for _, err := range unverified {
+							ctx.Logger.Errorf("%v", err)
+						}
+						ctx.Logger.Errorf("Refusing to apply to namespace \"%v\" because the signatures of the images above can't be verified", namespace)
+						exit(exitUnverified)
+					}
+					if ctx.Options.ApplyOnlyChanged {
+						helmOutput = onlyChanged(ctx, namespace, helmOutput)
+						if len(kubectl.ObjectDocuments(helmOutput, namespace)) == 0 {
+							ctx.Logger.Infof("Nothing changed in namespace \"%v\"", namespace)
+							finishProgress(ctx, charts, namespace, "unchanged")
+							finishChartOutcomes(ctx, charts, namespace, "unchanged")
+							return
+						}
+					}
+					if ctx.Options.ApplyConfirm && !ctx.DryRun {
+						helmOutput = confirmApply(ctx, namespace, helmOutput)
+						if len(kubectl.ObjectDocuments(helmOutput, namespace)) == 0 {
+							ctx.Logger.Infof("Nothing left to apply in namespace \"%v\"", namespace)
+							finishChartOutcomes(ctx, charts, namespace, "skipped")
+							return
+						}
+					}
+					if hasMigrations(charts) {
+						setProgress(ctx, charts, namespace, "migrating")
+						withProgressPaused(func() {
+							helmOutput = runMigrations(ctx, charts, namespace, helmOutput)
+						})
+					}
+				}
+
+				var snapshot *kubectl.Snapshot
+				if ctx.Mode == ankh.Apply && ctx.Options.ApplyAtomic && !ctx.DryRun {
+					s := takeAtomicSnapshot(ctx, namespace, helmOutput)
+					snapshot = &s
+				}
+
+				setProgress(ctx, charts, namespace, "applying")
+				if ctx.Mode == ankh.Apply {
+					countChartObjects(ctx, namespace, helmOutput)
+				}
+				var differs bool
+				run := func(r io.Reader) (string, error) {
+					if ctx.Mode == ankh.Diff {
+						out, d, err := kubectl.DiffStream(ctx, r, namespace, nil)
+						differs = d
+						return out, err
+					}
+					return kubectl.Execute(ctx, r, namespace, nil)
+				}
+				var kubectlOutput string
+				var err error
+				if streamKubectl {
+					kubectlOutput, err = executeStreamed(ctx, ankhFile, charts, namespace, run)
+				} else {
+					kubectlOutput, err = run(strings.NewReader(helmOutput))
+				}
+				if err != nil && snapshot != nil {
+					revertAtomicApply(ctx, *snapshot, helmOutput, err, exitApplyFailed)
+				}
+				if ctx.Mode == ankh.Apply {
+					checkWith(exitApplyFailed, err)
 				}
 				check(err)
+				if ctx.Mode == ankh.Diff {
+					noteDiff(ctx, namespace, kubectlOutput, differs)
+				}
+
+				if ctx.Mode == ankh.Apply {
+					recordApplySummaries(ctx, kubectl.SummarizeApply(ctx, helmOutput, kubectlOutput, namespace), namespace)
+					if !ctx.DryRun {
+						if err := kubectl.AnnotateActor(ctx, namespace, helmOutput); err != nil {
+							ctx.Logger.Warnf("Failed to annotate objects in namespace \"%v\" with actor \"%v\": %v", namespace, ctx.Actor, err)
+						}
+						if ctx.Options.ApplyWait {
+							setProgress(ctx, charts, namespace, "waiting")
+							if err := waitForApply(ctx, namespace, helmOutput); err != nil {
+								if snapshot != nil {
+									revertAtomicApply(ctx, *snapshot, helmOutput, err, waitExitCode(ctx))
+								}
+								ctx.Logger.Errorf("%v", err)
+								exit(waitExitCode(ctx))
+							}
+						}
+					}
+					if hasSmokeTests(charts) {
+						setProgress(ctx, charts, namespace, "smoke testing")
+						withProgressPaused(func() {
+							runSmokeTests(ctx, charts, namespace, helmOutput)
+						})
+					}
+					cleanupNamespace(ctx, charts, namespace, templatedOutput)
+					action := "applied"
+					if ctx.DryRun {
+						action = "dry run"
+					}
+					finishProgress(ctx, charts, namespace, action)
+					finishChartOutcomes(ctx, charts, namespace, action)
+				}
 
 				if ctx.Mode == ankh.Explain {
 					// Sweet string badnesss.
@@ -379,21 +924,74 @@ func executeContext(ctx *ankh.ExecutionContext, rootAnkhFile ankh.AnkhFile) {
 					fmt.Println(fmt.Sprintf("(%s) | \\\n%s", helmOutput, kubectlOutput))
 				} else {
 					if kubectlOutput != "" {
-						fmt.Println(kubectlOutput)
+						printOutput(kubectlOutput)
 					}
 				}
 			case ankh.Template:
 				fmt.Println(helmOutput)
+			case ankh.GitOps:
+				recordGitOpsRender(ctx, charts, namespace, helmOutput)
+			case ankh.Resources:
+				printChartResources(ctx, charts, namespace, helmOutput)
+			case ankh.Status:
+				recordChartStatuses(ctx, charts, namespace, helmOutput)
+			case ankh.Scale:
+				scaleWorkloads(ctx, namespace, helmOutput)
+			case ankh.Restart:
+				restartWorkloads(ctx, charts, namespace, helmOutput)
+			case ankh.Events:
+				printEvents(ctx, namespace, helmOutput)
+			case ankh.Top:
+				printTop(ctx, charts, namespace, helmOutput)
+			case ankh.RunJob:
+				runJobs(ctx, namespace, helmOutput)
+			case ankh.Wait:
+				waitForObjects(ctx, namespace, helmOutput)
+			case ankh.PortForward:
+				portForwardTargets = append(portForwardTargets, kubectl.PortForwardTargets(helmOutput, namespace)...)
 			case ankh.Lint:
 				errors := helm.Lint(ctx, helmOutput, ankhFile)
-				if len(errors) > 0 {
-					for _, err := range errors {
-						ctx.Logger.Warningf("%v", err)
-					}
-					log.Fatalf("Lint found %d errors.", len(errors))
+				errors = append(errors, checkDeprecatedAPIs(ctx, helmOutput)...)
+				errors = append(errors, validateSchemas(ctx, helmOutput)...)
+				errors = append(errors, checkPolicies(ctx, helmOutput)...)
+				scores, scoreErrors := scoreCharts(ctx, charts, helmOutput)
+				errors = append(errors, scoreErrors...)
+				recordLintResult(ctx, ankhFile, charts, namespace, helmOutput, errors, scores)
+			}
+		}
+
+		executeChartSet := func(charts []ankh.Chart, namespace string) {
+			defer logScope(ctx, charts, namespace)()
+
+			if ctx.Mode == ankh.Apply && !ctx.DryRun && ctx.AnkhConfig.NamespaceLabels.Enabled && namespace != "" {
+				ctx.Logger.Infof("Ensuring namespace \"%v\" exists and is labeled", namespace)
+				if err := kubectl.EnsureNamespace(ctx, namespace, kubectl.NamespaceLabels(ctx, ankhFile.Team)); err != nil {
+					fatalf(exitApplyFailed, "%v", err)
+				}
+			} else if ctx.Mode == ankh.Apply && (ctx.Options.CreateNamespace || ctx.AnkhConfig.CurrentContext.CreateNamespace) && namespace != "" {
+				createNamespace(ctx, namespace, ankhFile.Team)
+			}
+
+			if ctx.Mode == ankh.Apply && !ctx.DryRun && ctx.AnkhConfig.DeployLock.Enabled {
+				acquireDeployLock(ctx, namespace)
+				defer releaseDeployLock(ctx, namespace)
+			}
+
+			if ctx.Mode != ankh.Apply || ctx.DryRun || (!hasSmokeTests(charts) && !hasMigrations(charts) && !hasChartHooks(charts)) {
+				if ctx.Mode == ankh.Apply && hasChartHooks(charts) {
+					ctx.Logger.Infof("Skipping chart hooks since this is a dry run")
 				}
+				executeChartsOnNamespace(charts, namespace)
+				return
+			}
 
-				ctx.Logger.Infof("No issues.")
+			// Apply charts one at a time, so that a failed smoke test,
+			// migration, or hook stops the charts after it from being applied.
+			for _, chart := range charts {
+				charts := []ankh.Chart{chart}
+				withHooks(ctx, chart.Hooks, fmt.Sprintf("chart \"%v\"", chart.Name), hookEnv(ctx, namespace, charts), func() {
+					executeChartsOnNamespace(charts, namespace)
+				})
 			}
 		}
 
@@ -414,8 +1012,10 @@ func executeContext(ctx *ankh.ExecutionContext, rootAnkhFile ankh.AnkhFile) {
 		if ctx.Namespace != nil {
 			// Namespace overridden on the command line, so use that one for everything.
 			namespace := *ctx.Namespace
-			logChartsExecute(ankhFile.Charts, namespace, "command-line override ")
-			executeChartsOnNamespace(ankhFile.Charts, namespace)
+			withHooks(ctx, ankhFile.Hooks, "Ankh file "+ankhFile.Path, hookEnv(ctx, namespace, ankhFile.Charts), func() {
+				logChartsExecute(ankhFile.Charts, namespace, "command-line override ")
+				executeChartSet(ankhFile.Charts, namespace)
+			})
 		} else {
 			// Gather charts by namespace, and execute them in sets.
 			chartSets := make(map[string][]ankh.Chart)
@@ -431,11 +1031,14 @@ func executeContext(ctx *ankh.ExecutionContext, rootAnkhFile ankh.AnkhFile) {
 				allNamespaces = append(allNamespaces, namespace)
 			}
 			sort.Strings(allNamespaces)
-			for _, namespace := range allNamespaces {
-				charts := chartSets[namespace]
-				logChartsExecute(charts, namespace, "")
-				executeChartsOnNamespace(charts, namespace)
-			}
+			env := hookEnv(ctx, strings.Join(allNamespaces, ","), ankhFile.Charts)
+			withHooks(ctx, ankhFile.Hooks, "Ankh file "+ankhFile.Path, env, func() {
+				for _, namespace := range allNamespaces {
+					charts := chartSets[namespace]
+					logChartsExecute(charts, namespace, "")
+					executeChartSet(charts, namespace)
+				}
+			})
 		}
 	}
 
@@ -447,7 +1050,7 @@ func executeContext(ctx *ankh.ExecutionContext, rootAnkhFile ankh.AnkhFile) {
 		if err == nil {
 			ctx.Logger.Debugf("- OK: %v", ankhFilePath)
 		}
-		check(err)
+		checkWith(exitConfigError, err)
 
 		executeAnkhFile(ankhFile)
 
@@ -475,7 +1078,7 @@ func checkContext(ankhConfig *ankh.AnkhConfig, context string) {
 			log.Info("The following contexts are available:")
 			printContexts(ankhConfig)
 		}
-		os.Exit(1)
+		exit(exitConfigError)
 	}
 }
 
@@ -485,13 +1088,13 @@ func switchContext(ctx *ankh.ExecutionContext, ankhConfig *ankh.AnkhConfig, cont
 	errs := ankhConfig.ValidateAndInit(ctx, context)
 	if len(errs) > 0 && !ctx.IgnoreContextAndEnv {
 		// The config validation errors are not recoverable.
-		log.Fatalf("%v", util.MultiErrorFormat(errs))
+		fatalf(exitConfigError, "%v", util.MultiErrorFormat(errs))
 	}
 }
 
 func main() {
 	app := cli.App("ankh", "Another Kubernetes Helper")
-	app.Spec = "[--verbose] [--quiet] [--ignore-config-errors] [--ankhconfig] [--kubeconfig] [--datadir] [--release] [--context] [--environment] [--namespace] [--set...]"
+	app.Spec = "[--verbose] [--quiet] [--ignore-config-errors] [--ankhconfig] [--kubeconfig] [--datadir] [--offline] [--config-cache-ttl] [--pin-digests] [--no-prompt | --interactive] [--actor] [--log-format] [--exit-zero-on-warn] [--timeout] [--max-concurrency] [--release] [--context] [--environment] [--namespace] [--workspace] [--set...]"
 
 	var (
 		verbose            = app.BoolOpt("v verbose", false, "Verbose debug mode")
@@ -540,6 +1143,67 @@ func main() {
 			Desc:   "The data directory for Ankh template history",
 			EnvVar: "ANKHDATADIR",
 		})
+		offline        = app.BoolOpt("offline", false, "Use cached copies of remote ankh configs when they can't be fetched")
+		configCacheTTL = app.String(cli.StringOpt{
+			Name:   "config-cache-ttl",
+			Value:  "5m",
+			Desc:   "How long to use a cached copy of a remote ankh config before fetching it again",
+			EnvVar: "ANKHCONFIG_CACHE_TTL",
+		})
+		pinDigests = app.Bool(cli.BoolOpt{
+			Name:   "pin-digests",
+			Value:  false,
+			Desc:   "Resolve the tag of each chart to the digest it points to in the docker registry, and pass the chart `tag@digest`, so that the applied image can't change",
+			EnvVar: "ANKH_PIN_DIGESTS",
+		})
+		noPrompt = app.Bool(cli.BoolOpt{
+			Name:   "no-prompt",
+			Value:  false,
+			Desc:   "Fail instead of prompting for anything, eg: a missing chart version or tag. Useful for unattended runs",
+			EnvVar: "ANKH_NO_PROMPT",
+		})
+		interactive = app.Bool(cli.BoolOpt{
+			Name:   "interactive",
+			Value:  false,
+			Desc:   "Prompt for missing information even when running in CI, where prompts are otherwise disabled",
+			EnvVar: "ANKH_INTERACTIVE",
+		})
+		workspaceName = app.String(cli.StringOpt{
+			Name:   "workspace",
+			Value:  "",
+			Desc:   "The workspace to use, by name from ~/.ankh/workspaces, or by path. A workspace supplies Ankh files, and defaults for other flags",
+			EnvVar: "ANKHWORKSPACE",
+		})
+		actor = app.String(cli.StringOpt{
+			Name:   "actor",
+			Value:  "",
+			Desc:   "The person or pipeline starting this run, recorded in audit logs, annotations, and notifications. Defaults to the OS user",
+			EnvVar: "ANKH_ACTOR",
+		})
+		logFormat = app.String(cli.StringOpt{
+			Name:   "log-format",
+			Value:  "",
+			Desc:   "How to format logs: `text`, or `json` for log aggregators, which also sends prompts to stderr. Defaults to `log-format` from the Ankh config, or `text`",
+			EnvVar: "ANKH_LOG_FORMAT",
+		})
+		zeroOnWarn = app.Bool(cli.BoolOpt{
+			Name:   "exit-zero-on-warn",
+			Value:  false,
+			Desc:   "Exit with 0 instead of the exit codes for drift, lint problems, and diff changes, for pipelines that treat them as soft failures",
+			EnvVar: "ANKH_EXIT_ZERO_ON_WARN",
+		})
+		runTimeout = app.String(cli.StringOpt{
+			Name:   "timeout",
+			Value:  "",
+			Desc:   "How long the whole run may take, eg: 30m, after which the helm and kubectl commands it runs are killed, and it fails",
+			EnvVar: "ANKH_TIMEOUT",
+		})
+		maxConcurrency = app.Int(cli.IntOpt{
+			Name:   "max-concurrency",
+			Value:  0,
+			Desc:   "The most operations to run at once on any one kind of resource, eg: kubectl commands or registry requests, capping the `concurrency` limits of the Ankh config",
+			EnvVar: "ANKH_MAX_CONCURRENCY",
+		})
 		helmSet = app.Strings(cli.StringsOpt{
 			Name:  "set",
 			Desc:  "Variables passed through to helm via --set",
@@ -554,11 +1218,42 @@ func main() {
 
 	ctx := &ankh.ExecutionContext{}
 
+	useLogFormat := func(format string) {
+		if err := util.ValidateLogFormat(format); err != nil {
+			fatalf(exitConfigError, "%v", err)
+		}
+		if format == util.JSONLogFormat {
+			log.Formatter = &util.JSONFormatter{Fields: func() logrus.Fields { return logFields(ctx) }}
+			util.PromptToStderr()
+		}
+	}
+
 	app.Before = func() {
 		setLogLevel(ctx, logrus.InfoLevel)
+		exitZeroOnWarn = *zeroOnWarn
+
+		var workspace *ankh.Workspace
+		helmSetPairs := *helmSet
+		if *workspaceName != "" {
+			w, err := ankh.ParseWorkspace(ankh.WorkspacePath(workspaceDir, *workspaceName))
+			checkWith(exitConfigError, err)
+			workspace = &w
+			log.Debugf("Using workspace %v from %v", w.Name, w.Path)
+
+			// Flags given explicitly take precedence over the workspace.
+			if *context == "" && *environment == "" {
+				*context = w.Context
+				*environment = w.Environment
+			}
+			if !namespaceSet && w.Namespace != "" {
+				*namespace = w.Namespace
+				namespaceSet = true
+			}
+			helmSetPairs = append(append([]string{}, w.Set...), helmSetPairs...)
+		}
 
 		helmVars := map[string]string{}
-		for _, helmkvPair := range *helmSet {
+		for _, helmkvPair := range helmSetPairs {
 			k := strings.Split(helmkvPair, "=")
 			if len(k) != 2 {
 				log.Debugf("Malformed helm set value '%v', skipping...", helmkvPair)
@@ -568,7 +1263,20 @@ func main() {
 		}
 
 		if *context != "" && *environment != "" {
-			log.Fatalf("Must not provide both `--context` and `--environment`, because an environment maps to one or more contexts.")
+			fatalf(exitConfigError, "Must not provide both `--context` and `--environment`, because an environment maps to one or more contexts.")
+		}
+
+		cacheTTL, err := time.ParseDuration(*configCacheTTL)
+		if err != nil {
+			fatalf(exitConfigError, "Invalid `--config-cache-ttl` '%v': %v", *configCacheTTL, err)
+		}
+
+		var timeout time.Duration
+		if *runTimeout != "" {
+			timeout, err = time.ParseDuration(*runTimeout)
+			if err != nil {
+				fatalf(exitConfigError, "Invalid `--timeout` '%v': %v", *runTimeout, err)
+			}
 		}
 
 		var namespaceOpt *string
@@ -576,6 +1284,22 @@ func main() {
 			namespaceOpt = namespace
 		}
 
+		// CI systems have nobody to answer prompts, and rarely a terminal to color logs for.
+		prompts := !*noPrompt
+		ci := util.DetectCI(os.Getenv)
+		if ci != "" && !*interactive {
+			prompts = false
+			log.Formatter = &util.CustomFormatter{IsTerminal: false}
+		}
+		if *logFormat != "" {
+			useLogFormat(*logFormat)
+		}
+
+		actorName := strings.TrimSpace(*actor)
+		if actorName == "" {
+			actorName = ankh.DefaultActor()
+		}
+
 		ctx = &ankh.ExecutionContext{
 			Verbose:             *verbose,
 			Quiet:               *quiet,
@@ -586,15 +1310,49 @@ func main() {
 			Environment:         *environment,
 			Namespace:           namespaceOpt,
 			DataDir:             path.Join(*datadir, fmt.Sprintf("%v", time.Now().Unix())),
+			AuditLogPath:        path.Join(*datadir, "audit.log"),
+			Actor:               actorName,
+			ConfigCacheDir:      path.Join(*datadir, "config-cache"),
+			SchemaCacheDir:      path.Join(*datadir, "schema-cache"),
+			ChartCacheDir:       path.Join(*datadir, "chart-cache"),
+			ConfigCacheTTL:      cacheTTL,
+			Offline:             *offline,
+			NoPrompt:            !prompts,
+			PinDigests:          *pinDigests,
 			Logger:              log,
 			HelmSetValues:       helmVars,
 			IgnoreContextAndEnv: ctx.IgnoreContextAndEnv,
 			IgnoreConfigErrors:  ctx.IgnoreConfigErrors || *ignoreConfigErrors,
+			Workspace:           workspace,
+			Timeout:             timeout,
+			MaxConcurrency:      *maxConcurrency,
+		}
+		if timeout > 0 {
+			ctx.Deadline = time.Now().Add(timeout)
 		}
 
 		sigs := make(chan os.Signal, 1)
 		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 		go signalHandler(ctx, sigs)
+		var exitOnce sync.Once
+		logrus.RegisterExitHandler(func() {
+			exited := false
+			exitOnce.Do(func() {
+				ankh.BeginExit()
+				stopProgress()
+				runFailureHooks(ctx)
+				failGitHubDeployment(ctx)
+				releaseAllDeployLocks(ctx)
+				reportInterrupt(ctx)
+				writeRunSummary(ctx, os.Stdout)
+				ctx.RemoveExitPaths()
+				exited = true
+			})
+			if !exited {
+				// Another goroutine is already exiting, eg: after an interrupt, so let it finish.
+				select {}
+			}
+		})
 
 		if ctx.Verbose && ctx.Quiet {
 			// Quiet overrides verbose, since it's more likely that the user
@@ -607,6 +1365,9 @@ func main() {
 		// Default to info level logging
 		setLogLevel(ctx, logrus.InfoLevel)
 
+		if ci != "" && !*interactive {
+			log.Debugf("Running in %v, so prompts are disabled. Pass `--interactive` to prompt anyway", ci)
+		}
 		log.Debugf("Using KubeConfigPath %v (KUBECONFIG = '%v')", ctx.KubeConfigPath, os.Getenv("KUBECONFIG"))
 		log.Debugf("Using AnkhConfigPath %v (ANKHCONFIG = '%v')", ctx.AnkhConfigPath, os.Getenv("ANKHCONFIG"))
 
@@ -629,7 +1390,7 @@ func main() {
 				// TODO: this is a mess
 				if !ctx.IgnoreContextAndEnv && !ctx.IgnoreConfigErrors {
 					// The config validation errors are not recoverable.
-					log.Fatalf("%s: Rerun with `ankh --ignore-config-errors ...` to ignore this error and use the merged configuration anyway.", err)
+					fatalf(exitConfigError, "%s: Rerun with `ankh --ignore-config-errors ...` to ignore this error and use the merged configuration anyway.", err)
 				} else {
 					log.Warnf("%v", err)
 				}
@@ -641,9 +1402,9 @@ func main() {
 					complaint := fmt.Sprintf("Context `%v` already defined from config source `%v`, would have been overriden by config source `%v`.",
 						name, context.Source, configPath)
 					if !ctx.IgnoreConfigErrors {
-						log.Fatalf(complaint + " Rerun with `ankh --ignore-config-errors ...` to ignore this error and use the merged configuration anyway.")
+						fatalf(exitConfigError, "%v Rerun with `ankh --ignore-config-errors ...` to ignore this error and use the merged configuration anyway.", complaint)
 					} else {
-						log.Warnf(complaint)
+						log.Warnf("%v", complaint)
 					}
 				}
 			}
@@ -652,9 +1413,9 @@ func main() {
 					complaint := fmt.Sprintf("Environment `%v` already defined from config source `%v`, would have been overriden by config source `%v`.",
 						name, environment.Source, configPath)
 					if !ctx.IgnoreConfigErrors {
-						log.Fatalf(complaint + " Rerun with `ankh --ignore-config-errors ...` to ignore this error and use the merged configuration anyway.")
+						fatalf(exitConfigError, "%v Rerun with `ankh --ignore-config-errors ...` to ignore this error and use the merged configuration anyway.", complaint)
 					} else {
-						log.Warnf(complaint)
+						log.Warnf("%v", complaint)
 					}
 				}
 			}
@@ -672,6 +1433,9 @@ func main() {
 
 		if ctx.Context != "" {
 			mergedAnkhConfig.CurrentContextName = ctx.Context
+		} else if ctx.Environment == "" && mergedAnkhConfig.PersistedContextName != "" {
+			log.Debugf("Using context %v from `current-context`", mergedAnkhConfig.PersistedContextName)
+			mergedAnkhConfig.CurrentContextName = mergedAnkhConfig.PersistedContextName
 		}
 		if ctx.Environment == "" && !ctx.IgnoreContextAndEnv {
 			log.Debugf("Switching to context %v", mergedAnkhConfig.CurrentContextName)
@@ -681,6 +1445,13 @@ func main() {
 		// Save the original config, and then assume the mergedAnkhConfig as the config going forward.
 		ctx.OriginalAnkhConfig = ctx.AnkhConfig
 		ctx.AnkhConfig = mergedAnkhConfig
+		if ctx.AnkhConfig.Helm.CacheDir != "" {
+			ctx.ChartCacheDir = ctx.AnkhConfig.Helm.CacheDir
+		}
+
+		if *logFormat == "" && ctx.AnkhConfig.LogFormat != "" {
+			useLogFormat(ctx.AnkhConfig.LogFormat)
+		}
 	}
 
 	app.Command("explain", "Explain how an Ankh file would be applied to a Kubernetes cluster", func(cmd *cli.Cmd) {
@@ -700,41 +1471,90 @@ func main() {
 	})
 
 	app.Command("apply", "Apply an Ankh file to a Kubernetes cluster", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-f] [--dry-run] [--chart] [--filter...]"
+		cmd.Spec = "[-f] [--dry-run | --confirm] [--chart] [--filter...] [--only...] [--override-freeze] [--only-changed] [--create-namespace] [--atomic] [--wait] [--timeout] [--no-progress] [--summary-output] [--skip-image-check] [--skip-scan]"
 
 		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
 		dryRun := cmd.BoolOpt("dry-run", false, "Perform a dry-run and don't actually apply anything to a cluster")
+		confirm := cmd.BoolOpt("confirm", false, "Show the diff of each object that would change, and choose whether to apply, skip or recreate it, or abort before anything is applied")
 		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
+		overrideFreeze := cmd.StringOpt("override-freeze", "", "Apply during a freeze window of the context. Requires a reason, which is recorded in the audit log")
 		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to include for the action, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+		wait := cmd.BoolOpt("wait", false, "After applying, wait for each Deployment, StatefulSet and DaemonSet to roll out, and each Job to complete, failing if any does not become healthy")
+		onlyChanged := cmd.BoolOpt("only-changed", false, "Diff first, and only apply the objects that differ from their live state")
+		createNamespace := cmd.BoolOpt("create-namespace", false, "Create the namespace being applied into if it doesn't exist")
+		atomic := cmd.BoolOpt("atomic", false, "Revert each namespace to its state before the apply if applying it, or waiting for it, fails. Implies `--wait`")
+		timeout := cmd.StringOpt("timeout", "", "How long `--wait` waits for workloads in each namespace to become healthy. Defaults to `timeouts.wait` from the Ankh config, or "+defaultApplyWaitTimeout)
+		noProgress := cmd.BoolOpt("no-progress", false, "Log each step instead of showing progress, even on a terminal")
+		summaryOutput := cmd.StringOpt("summary-output", "table", "How to print the summary of what was done to each chart at the end of the run, one of [ table, json, none ]")
+		skipImageCheck := cmd.BoolOpt("skip-image-check", false, "Apply without first checking that the chosen tag of each chart exists in the docker registry")
+		skipScan := cmd.StringOpt("skip-scan", "", "Apply without scanning images for vulnerabilities, when `scan.enabled` is set. Requires a reason, which is recorded in the audit log")
 
 		cmd.Action = func() {
 			ctx.AnkhFilePath = *ankhFilePath
 			ctx.DryRun = *dryRun
+			ctx.Options.SkipImageCheck = *skipImageCheck
+			ctx.Options.SkipScan = *skipScan
 			ctx.Chart = *chart
 			ctx.Mode = ankh.Apply
+			ctx.Options.ApplyAtomic = *atomic
+			ctx.Options.CreateNamespace = *createNamespace
+			ctx.Options.ApplyOnlyChanged = *onlyChanged
+			ctx.Options.ApplyWait = *wait || *atomic
+			if ctx.Options.ApplyWait {
+				// `--timeout` takes precedence over `timeouts.wait` from the Ankh config.
+				ctx.Options.WaitTimeout = ctx.PhaseTimeout(ankh.WaitPhase)
+				if *timeout == "" && ctx.Options.WaitTimeout == 0 {
+					*timeout = defaultApplyWaitTimeout
+				}
+				if *timeout != "" {
+					duration, err := time.ParseDuration(*timeout)
+					if err != nil {
+						fatalf(exitConfigError, "Invalid `--timeout` '%v': %v", *timeout, err)
+					}
+					ctx.Options.WaitTimeout = duration
+				}
+			}
 			filters := []string{}
 			for _, filter := range *filter {
 				filters = append(filters, string(filter))
 			}
 			ctx.Filters = filters
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+			ctx.Options.OverrideFreeze = *overrideFreeze
+			ctx.Options.ApplyConfirm = *confirm
+			validateConfigOutput(*summaryOutput, []string{"table", "json", "none"})
+			runSummaryFormat = *summaryOutput
+			if runSummaryFormat == "json" {
+				// Keep stdout for the summary, so that it can be parsed.
+				log.Out = os.Stderr
+				commandOutput = os.Stderr
+			}
 
+			startProgress(ctx, *noProgress || runSummaryFormat == "json")
 			execute(ctx)
+			stopProgress()
+			writeRunSummary(ctx, os.Stdout)
 			os.Exit(0)
 		}
 	})
 
 	app.Command("rollback", "Rollback deployments associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-f] [--dry-run] [--chart]"
+		cmd.Spec = "[-f] [--dry-run] [--chart] [--override-freeze]"
 
 		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
 		dryRun := cmd.BoolOpt("dry-run", false, "Perform a dry-run and don't actually rollback anything to a cluster")
 		chart := cmd.StringOpt("chart", "", "Limits the rollback command to only the specified chart")
+		overrideFreeze := cmd.StringOpt("override-freeze", "", "Rollback during a freeze window of the context. Requires a reason, which is recorded in the audit log")
 
 		cmd.Action = func() {
 			ctx.AnkhFilePath = *ankhFilePath
 			ctx.DryRun = *dryRun
 			ctx.Chart = *chart
 			ctx.Mode = ankh.Rollback
+			ctx.Options.OverrideFreeze = *overrideFreeze
 			ctx.Filters = []string{"deployment", "statfulset"}
 
 			ctx.Logger.Warnf("Rollback is not a transactional operation.\n" +
@@ -749,12 +1569,15 @@ func main() {
 				"do the right thing in this case. You MUST `ankh ... apply` using the co-dependent chart and tag value in order to converge back to a correct state.\n" +
 				"\n" +
 				"If you already know the chart version and associated tag values (eg: `--set ...`) that you want to converge to, use `ankh --set $... apply --chart $chartName@$prevVersion` instead.\n")
+			if ctx.NoPrompt {
+				fatalf(exitConfigError, "Rollback must be confirmed, but prompts are disabled")
+			}
 			selection, err := util.PromptForSelection([]string{"Abort", "OK"},
 				"Are you certain that you want to run `kubectl rollout undo` to rollback to a previous ReplicaSet spec? Select OK to proceed.")
 			check(err)
 
 			if selection != "OK" {
-				ctx.Logger.Fatalf("Aborting")
+				fatalf(exitFailure, "Aborting")
 			}
 
 			execute(ctx)
@@ -762,51 +1585,360 @@ func main() {
 		}
 	})
 
-	app.Command("diff", "Diff against live objects associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-f] [--chart] [--filter...]"
+	app.Command("scale", "Scale the Deployments and StatefulSets of a templated Ankh file", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--dry-run] [--chart] --replicas"
 
 		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
-		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
-		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		dryRun := cmd.BoolOpt("dry-run", false, "Perform a dry-run and don't actually scale anything")
+		chart := cmd.StringOpt("chart", "", "Limits the scale command to only the specified chart")
+		replicas := cmd.IntOpt("replicas", 0, "The number of replicas to scale to. Scaling to zero must be confirmed")
 
 		cmd.Action = func() {
-			setLogLevel(ctx, logrus.InfoLevel)
 			ctx.AnkhFilePath = *ankhFilePath
-			ctx.DryRun = false
+			ctx.DryRun = *dryRun
 			ctx.Chart = *chart
-			ctx.Mode = ankh.Diff
-			filters := []string{}
-			for _, filter := range *filter {
-				filters = append(filters, string(filter))
+			ctx.Mode = ankh.Scale
+			if *replicas < 0 {
+				fatalf(exitConfigError, "Invalid `--replicas` %v, must be zero or more", *replicas)
 			}
-			ctx.Filters = filters
+			ctx.Options.ScaleReplicas = *replicas
 
 			execute(ctx)
 			os.Exit(0)
 		}
 	})
 
-	app.Command("get", "Get objects associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-f] [--chart] [--filter...] [EXTRA...]"
+	app.Command("restart", "Restart the Deployments, StatefulSets and DaemonSets of a templated Ankh file", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--dry-run] [--chart] [--wait [--timeout]]"
 
 		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
-		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
-		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
-		extra := cmd.StringsArg("EXTRA", []string{}, "Extra arguments to pass to `kubectl`, which can be specified after `--` eg: `ankh ... get -- -o json`")
+		dryRun := cmd.BoolOpt("dry-run", false, "Perform a dry-run and don't actually restart anything")
+		chart := cmd.StringOpt("chart", "", "Limits the restart command to only the specified chart")
+		wait := cmd.BoolOpt("wait", false, "Wait for each restarted workload to finish rolling out")
+		timeout := cmd.StringOpt("timeout", "5m", "How long to wait for each workload to roll out, with `--wait`")
 
 		cmd.Action = func() {
-			setLogLevel(ctx, logrus.InfoLevel)
 			ctx.AnkhFilePath = *ankhFilePath
-			ctx.DryRun = false
+			ctx.DryRun = *dryRun
 			ctx.Chart = *chart
-			ctx.Mode = ankh.Get
-			filters := []string{}
-			for _, filter := range *filter {
-				filters = append(filters, string(filter))
-			}
-			ctx.Filters = filters
-			for _, e := range *extra {
-				ctx.Logger.Debugf("Appending extra arg: %+v", e)
+			ctx.Mode = ankh.Restart
+			ctx.Options.RestartWait = *wait
+			checkRestartTimeout(*timeout)
+			ctx.Options.RestartTimeout = *timeout
+
+			execute(ctx)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("diff", "Diff against live objects associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--filter...] [--only...] [--post-comment]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
+		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to include for the action, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+		postComment := cmd.BoolOpt("post-comment", false, "Also comment the diff on the pull request that GitHub Actions, or merge request that GitLab CI, is running for")
+
+		cmd.Action = func() {
+			setLogLevel(ctx, logrus.InfoLevel)
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Diff
+			filters := []string{}
+			for _, filter := range *filter {
+				filters = append(filters, string(filter))
+			}
+			ctx.Filters = filters
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+
+			var pr vcs.PullRequest
+			if *postComment {
+				pr, ctx.Options.DiffPostComment = detectPullRequest(ctx)
+			}
+
+			execute(ctx)
+			finishDiff(ctx, pr)
+		}
+	})
+
+	app.Command("drift", "Check whether live objects have drifted from a templated Ankh file, exiting with status 2 if they have", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--filter...] [--only...] [-o]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the drift command to only the specified chart")
+		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to include for the action, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+		output := cmd.StringOpt("o output", "", "A file to write the drift found to, as JSON")
+
+		cmd.Action = func() {
+			setLogLevel(ctx, logrus.InfoLevel)
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Drift
+			filters := []string{}
+			for _, filter := range *filter {
+				filters = append(filters, string(filter))
+			}
+			ctx.Filters = filters
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+
+			execute(ctx)
+			writeDriftReports(ctx, *output)
+			if len(driftReports) > 0 {
+				exit(exitDrift)
+			}
+			os.Exit(0)
+		}
+	})
+
+	app.Command("watch-drift", "Periodically check Ankh files for drift from their live objects, reporting it via webhook and metrics", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--interval] [--metrics-listen] [--once]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name, used when `drift.targets` isn't configured")
+		interval := cmd.StringOpt("interval", "1h", "How long to wait between checks")
+		metricsListen := cmd.StringOpt("metrics-listen", "", "An address to serve Prometheus metrics on, eg: `:9102`")
+		once := cmd.BoolOpt("once", false, "Check once and exit, with status 2 if there was any drift")
+
+		ctx.IgnoreContextAndEnv = true
+
+		cmd.Action = func() {
+			duration, err := time.ParseDuration(*interval)
+			if err != nil || duration <= 0 {
+				fatalf(exitConfigError, "Invalid `--interval` '%v', expected a duration like `30m` or `1h`", *interval)
+			}
+
+			targets := ctx.AnkhConfig.Drift.Targets
+			if len(targets) == 0 {
+				targets = []ankh.DriftTarget{{AnkhFile: *ankhFilePath, Context: ctx.Context, Environment: ctx.Environment}}
+			}
+			watchDrift(ctx, targets, duration, *metricsListen, *once)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("watch", "Re-render and diff an Ankh file on an interval, or when its files change, reporting or applying drift", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--interval] [--auto-apply]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		interval := cmd.StringOpt("interval", "5m", "How long to wait between checks, when no files change")
+		autoApply := cmd.BoolOpt("auto-apply", false, "Apply the Ankh file whenever drift is found, rather than just reporting it")
+
+		ctx.IgnoreContextAndEnv = true
+
+		cmd.Action = func() {
+			duration, err := time.ParseDuration(*interval)
+			if err != nil || duration <= 0 {
+				fatalf(exitConfigError, "Invalid `--interval` '%v', expected a duration like `30s` or `5m`", *interval)
+			}
+
+			path := *ankhFilePath
+			if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+				path, err = filepath.Abs(path)
+				check(err)
+			}
+			watchAnkhFile(ctx, ankh.DriftTarget{AnkhFile: path, Context: ctx.Context, Environment: ctx.Environment}, duration, *autoApply)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("status", "Show the health and deployed version of each chart in an Ankh file", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [-o]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the status command to only the specified chart")
+		output := cmd.StringOpt("o output", "table", "Output format, one of [ table, json ], `custom-columns=SPEC` or `jsonpath=TEMPLATE`")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Status
+			if ok, err := kubectl.ValidateTemplateFormat(*output); ok {
+				check(err)
+			} else {
+				validateConfigOutput(*output, []string{"table", "json"})
+			}
+			if *output != "table" {
+				log.Out = os.Stderr
+			}
+
+			execute(ctx)
+			switch *output {
+			case "table":
+				printChartStatuses(chartStatuses)
+			case "json":
+				out, err := formatStructured(chartStatuses, "json")
+				check(err)
+				fmt.Print(string(out))
+			default:
+				out, err := formatChartStatuses(chartStatuses, *output)
+				check(err)
+				fmt.Print(out)
+			}
+			os.Exit(0)
+		}
+	})
+
+	app.Command("top", "Show the CPU and memory that the pods of each chart in a templated Ankh file are using", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--containers]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the top command to only the specified chart")
+		containers := cmd.BoolOpt("containers", false, "Show the usage of each container, rather than each pod")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Top
+			ctx.Options.TopContainers = *containers
+
+			execute(ctx)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("events", "Show the recent events involving the objects of a templated Ankh file, and the pods they run", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [-w]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the events command to only the specified chart")
+		watch := cmd.BoolOpt("w watch", false, "After printing the recent events, watch for new ones")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Events
+			ctx.Options.EventsWatch = *watch
+			if ctx.Options.EventsWatch && ctx.Environment != "" {
+				fatalf(exitConfigError, "`ankh events --watch` works on a single context, so use `--context` rather than `--environment`")
+			}
+
+			execute(ctx)
+			if ctx.Options.EventsWatch {
+				log.Infof("Watching for new events...")
+				check(kubectl.WatchEvents(ctx, eventTargets, nil))
+			}
+			os.Exit(0)
+		}
+	})
+
+	app.Command("port-forward", "Forward local ports to the Services or Deployments of a templated Ankh file", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--service] [--port...]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the port-forward command to only the specified chart")
+		service := cmd.StringOpt("service", "", "The Service to forward to, by name, or `deployment/NAME` for a Deployment. Otherwise, you select one when there's more than one")
+		ports := cmd.StringsOpt("port", []string{}, "A port to forward, REMOTE or LOCAL:REMOTE. May be repeated. Defaults to every port of the Service or Deployment, each forwarded from the same local port when it's free, or else any free port")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.PortForward
+			if ctx.Environment != "" {
+				fatalf(exitConfigError, "`ankh port-forward` works on a single context, so use `--context` rather than `--environment`")
+			}
+			portSpecs := []string{}
+			for _, port := range *ports {
+				if _, _, err := kubectl.ParsePortSpec(port); err != nil {
+					fatalf(exitConfigError, "%v", err)
+				}
+				portSpecs = append(portSpecs, port)
+			}
+
+			execute(ctx)
+			target, err := selectPortForwardTarget(ctx, portForwardTargets, *service)
+			check(err)
+			forwards, err := portForwards(target, portSpecs)
+			check(err)
+			for _, forward := range forwards {
+				tokens := strings.Split(forward, ":")
+				log.Infof("Forwarding localhost:%v to %v port %v in namespace \"%v\"", tokens[0], target.Resource, tokens[1], target.Namespace)
+			}
+			check(kubectl.PortForward(ctx, target, forwards, nil))
+			os.Exit(0)
+		}
+	})
+
+	app.Command("fleet", "Report on an Ankh file across every context", func(cmd *cli.Cmd) {
+		ctx.IgnoreContextAndEnv = true
+
+		cmd.Command("status", "Show the health and deployed version of each chart in an Ankh file, in every context or those of `--environment`", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-f] [--chart] [-o] [--parallel]"
+
+			ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+			chart := cmd.StringOpt("chart", "", "Limits the status command to only the specified chart")
+			output := cmd.StringOpt("o output", "table", "Output format, one of [ table, json ]")
+			parallel := cmd.IntOpt("parallel", 0, "The number of contexts to check at once. Defaults to `concurrency.contexts` from the Ankh config, or 8")
+
+			cmd.Action = func() {
+				validateConfigOutput(*output, []string{"table", "json"})
+				if *output == "json" {
+					log.Out = os.Stderr
+				}
+				contexts, err := fleetContexts(ctx)
+				check(err)
+				self, err := os.Executable()
+				check(err)
+				absPath, err := filepath.Abs(*ankhFilePath)
+				check(err)
+
+				if *parallel < 1 {
+					*parallel = ctx.ConcurrencyLimit(ankh.ContextsConcurrency)
+				}
+				report := fleetStatus(ctx, self, contexts, absPath, *chart, *parallel)
+				if *output == "json" {
+					out, err := formatStructured(report, "json")
+					check(err)
+					fmt.Print(string(out))
+				} else {
+					printFleetReport(report)
+				}
+				if len(report.Errors) > 0 {
+					os.Exit(1)
+				}
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("get", "Get objects associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--filter...] [--only...] [-o] [EXTRA...]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
+		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to include for the action, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+		output := cmd.StringOpt("o output", "", fmt.Sprintf("Output format, one of [ %v ], `custom-columns=SPEC` or `jsonpath=TEMPLATE`", strings.Join(kubectl.OutputFormats, ", ")))
+		extra := cmd.StringsArg("EXTRA", []string{}, "Extra arguments to pass to `kubectl`, which can be specified after `--` eg: `ankh ... get -- --show-kind`")
+
+		cmd.Action = func() {
+			setLogLevel(ctx, logrus.InfoLevel)
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Get
+			check(checkOutputFormat(ctx.Mode, *output, *extra))
+			ctx.Options.OutputFormat = *output
+			filters := []string{}
+			for _, filter := range *filter {
+				filters = append(filters, string(filter))
+			}
+			ctx.Filters = filters
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+			for _, e := range *extra {
+				ctx.Logger.Debugf("Appending extra arg: %+v", e)
 				ctx.ExtraArgs = append(ctx.ExtraArgs, e)
 			}
 
@@ -815,14 +1947,83 @@ func main() {
 		}
 	})
 
+	app.Command("describe", "Describe objects associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--kind...] [--only...] [EXTRA...]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the describe command to only the specified chart")
+		kind := cmd.StringsOpt("kind", []string{}, "Kubernetes object kinds to describe, eg: `service`. May be repeated. The entries in this list are case insensitive. Defaults to every kind the chart templates.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to describe, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+		extra := cmd.StringsArg("EXTRA", []string{}, "Extra arguments to pass to `kubectl`, which can be specified after `--` eg: `ankh ... describe -- --show-events=false`")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Describe
+			ctx.Filters = *kind
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+			ctx.ExtraArgs = append(ctx.ExtraArgs, *extra...)
+
+			execute(ctx)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("wait", "Wait for objects associated with a templated Ankh file to meet conditions, eg: rollouts to finish", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--for...] [--kind...] [--only...] [--timeout]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the wait command to only the specified chart")
+		conditions := cmd.StringsOpt("for", []string{}, "What to wait for: `rollout` (Deployments, StatefulSets and DaemonSets), `complete` (Jobs), `established` (CustomResourceDefinitions), or `condition=NAME` for every object. May be repeated. Defaults to `established`, `rollout` and `complete`")
+		kind := cmd.StringsOpt("kind", []string{}, "Kubernetes object kinds to wait for, eg: `deployment`. May be repeated. The entries in this list are case insensitive. Defaults to every kind the chart templates.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to wait for, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+		timeout := cmd.StringOpt("timeout", defaultWaitTimeout, "How long to wait in total for every condition, after which ankh exits with status 5")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Wait
+			ctx.Filters = *kind
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+
+			ctx.Options.WaitConditions = kubectl.DefaultWaitConditions
+			if len(*conditions) > 0 {
+				ctx.Options.WaitConditions = []string{}
+				for _, c := range *conditions {
+					condition, err := kubectl.ParseWaitCondition(c)
+					check(err)
+					ctx.Options.WaitConditions = append(ctx.Options.WaitConditions, condition)
+				}
+			}
+			duration, err := time.ParseDuration(*timeout)
+			if err != nil {
+				fatalf(exitConfigError, "Invalid `--timeout` '%v': %v", *timeout, err)
+			}
+			ctx.Options.WaitTimeout = duration
+			ctx.Options.WaitDeadline = time.Now().Add(duration)
+
+			execute(ctx)
+			os.Exit(0)
+		}
+	})
+
 	app.Command("pods", "Get pods associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-f] [-w] [-d] [--chart] [EXTRA...]"
+		cmd.Spec = "[-f] [-w] [-d] [--chart] [--node] [--on-node...] [-o] [EXTRA...]"
 
 		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
 		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
 		watch := cmd.BoolOpt("w watch", false, "Watch for updates (ie: pass -w to kubectl)")
 		describe := cmd.BoolOpt("d describe", false, "Use `kubectl describe ...` instead of `kubectl get -o wide ...` for pods")
-		extra := cmd.StringsArg("EXTRA", []string{}, "Extra arguments to pass to `kubectl`, which can be specified after `--` eg: `ankh ... get -- -o json`")
+		node := cmd.BoolOpt("node", false, "Show the node each pod runs on, with the node's conditions and taints")
+		onNodes := cmd.StringsOpt("on-node", []string{}, "Only show pods on nodes with this name, or matching this glob pattern (eg: `pool-b-*`). May be repeated. Implies --node")
+		output := cmd.StringOpt("o output", "", fmt.Sprintf("Output format, one of [ %v ], `custom-columns=SPEC` or `jsonpath=TEMPLATE`. Defaults to `wide`", strings.Join(kubectl.OutputFormats, ", ")))
+		extra := cmd.StringsArg("EXTRA", []string{}, "Extra arguments to pass to `kubectl`, which can be specified after `--` eg: `ankh ... pods -- --show-labels`")
 
 		cmd.Action = func() {
 			setLogLevel(ctx, logrus.InfoLevel)
@@ -831,6 +2032,16 @@ func main() {
 			ctx.Describe = *describe
 			ctx.Chart = *chart
 			ctx.Mode = ankh.Pods
+			ctx.Options.PodNodes = *node
+			ctx.Options.OnNodes = *onNodes
+			if (ctx.Options.PodNodes || len(ctx.Options.OnNodes) > 0) && (*watch || *describe || *output != "" || len(*extra) > 0) {
+				fatalf(exitConfigError, "`--node` and `--on-node` can't be combined with `--watch`, `--describe`, `--output`, or extra kubectl arguments")
+			}
+			if *describe && *output != "" {
+				fatalf(exitConfigError, "`--describe` can't be combined with `--output`")
+			}
+			check(checkOutputFormat(ctx.Mode, *output, *extra))
+			ctx.Options.OutputFormat = *output
 			for _, e := range *extra {
 				ctx.Logger.Debugf("Appending extra arg: %+v", e)
 				ctx.ExtraArgs = append(ctx.ExtraArgs, e)
@@ -846,13 +2057,36 @@ func main() {
 	})
 
 	app.Command("logs", "Get logs for pods associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-c] [-f] [--filename] [--previous] [--tail] [--chart] [CONTAINER]"
+		cmd.Spec = "[-c] [-f] [--filename] [--previous] [--tail] [--since] [--timestamps] [--all-containers] [--grep] [--output] [--chart] [--all [--max-pods]] [CONTAINER]"
 
+		tailSet, followSet, timestampsSet := false, false, false
 		ankhFilePath := cmd.StringOpt("filename", "ankh.yaml", "Config file name")
-		numTailLines := cmd.IntOpt("t tail", 10, "The number of most recent log lines to see. Pass 0 to receive all log lines available from Kubernetes, which is subject to its own retential policy.")
-		follow := cmd.BoolOpt("f", false, "Follow logs")
+		numTailLines := cmd.Int(cli.IntOpt{
+			Name:      "t tail",
+			Value:     10,
+			Desc:      "The number of most recent log lines to see. Pass 0 to receive all log lines available from Kubernetes, which is subject to its own retential policy. Defaults to `logs.tail` in the ankh config, if set.",
+			SetByUser: &tailSet,
+		})
+		follow := cmd.Bool(cli.BoolOpt{
+			Name:      "f",
+			Value:     false,
+			Desc:      "Follow logs. Defaults to `logs.follow` in the ankh config.",
+			SetByUser: &followSet,
+		})
+		timestamps := cmd.Bool(cli.BoolOpt{
+			Name:      "timestamps",
+			Value:     false,
+			Desc:      "Include timestamps on each line. Defaults to `logs.timestamps` in the ankh config.",
+			SetByUser: &timestampsSet,
+		})
+		output := cmd.StringOpt("o output", "", "Also append the logs to this file, eg: to keep a record during an incident")
 		previous := cmd.BoolOpt("p previous", false, "Get logs for the previously terminated container, if any")
+		since := cmd.StringOpt("since", "", "Only get logs newer than a relative duration, eg: 10m or 2h")
+		allContainers := cmd.BoolOpt("all-containers", false, "Get logs for every container in the pod instead of selecting one")
+		grep := cmd.StringOpt("grep", "", "Only print log lines matching this regular expression")
 		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
+		all := cmd.BoolOpt("a all", false, "Stream logs from every pod at once, prefixing each line with its pod and container. Followed logs reconnect when a container restarts.")
+		maxPods := cmd.IntOpt("max-pods", 10, "The most pods to stream logs from with --all")
 		container := cmd.StringOpt("c container", "", "The container to exec on. Required when there is more than one container running in the pods associated with the templated Ankh file.")
 		containerArg := cmd.StringArg("CONTAINER", "", "The container to get logs for. Required when there is more than one container running in the pods associated with the templated Ankh file.")
 
@@ -862,14 +2096,46 @@ func main() {
 			ctx.DryRun = false
 			ctx.Chart = *chart
 			ctx.Mode = ankh.Logs
+			ctx.Options.LogsOutputPath = *output
+			ctx.Options.LogsAll = *all
+			ctx.Options.LogsMaxPods = *maxPods
+			if !tailSet && ctx.AnkhConfig.Logs.Tail != nil {
+				*numTailLines = *ctx.AnkhConfig.Logs.Tail
+			}
+			if !followSet {
+				*follow = ctx.AnkhConfig.Logs.Follow
+			}
+			if !timestampsSet {
+				*timestamps = ctx.AnkhConfig.Logs.Timestamps
+			}
 			if *follow {
 				ctx.ExtraArgs = append(ctx.ExtraArgs, "-f")
 			}
+			if *timestamps {
+				ctx.ExtraArgs = append(ctx.ExtraArgs, "--timestamps")
+			}
 			if *previous {
 				ctx.ExtraArgs = append(ctx.ExtraArgs, "--previous")
 			}
+			if *since != "" {
+				if _, err := time.ParseDuration(*since); err != nil {
+					fatalf(exitConfigError, "Invalid --since duration \"%v\": %v", *since, err)
+				}
+				ctx.ExtraArgs = append(ctx.ExtraArgs, "--since", *since)
+			}
+			if *grep != "" {
+				re, err := regexp.Compile(*grep)
+				if err != nil {
+					fatalf(exitConfigError, "Invalid --grep regular expression: %v", err)
+				}
+				ctx.Options.LogsGrep = re
+			}
+			if *allContainers && (*container != "" || *containerArg != "") {
+				fatalf(exitConfigError, "Cannot use --all-containers with a container")
+			}
+			ctx.Options.LogsAllContainers = *allContainers
 			if *container != "" && *containerArg != "" && *container != *containerArg {
-				ctx.Logger.Fatalf("Conflicting positional argument '%v' and container option (-c) '%v'. Please ensure that these are the same, or only use one one.",
+				fatalf(exitConfigError, "Conflicting positional argument '%v' and container option (-c) '%v'. Please ensure that these are the same, or only use one one.",
 					*containerArg, *container)
 			}
 			if *container != "" {
@@ -889,11 +2155,15 @@ func main() {
 	})
 
 	app.Command("exec", "Exec a command on pods associated with a templated Ankh file from Kubernetes", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-c] [--filename] [--chart] [PASSTHROUGH...]"
+		cmd.Spec = "[-c] [--filename] [--chart] [--pod | --all-pods [--parallel]] [--timeout] [PASSTHROUGH...]"
 
 		ankhFilePath := cmd.StringOpt("filename", "ankh.yaml", "Config file name")
 		chart := cmd.StringOpt("chart", "", "Limits the apply command to only the specified chart")
 		container := cmd.StringOpt("c container", "", "The container to exec on. Required when there is more than one container running in the pods associated with the templated Ankh file.")
+		pod := cmd.StringOpt("pod", "", "The pod to exec on, by name, or by its index (from 0) in the pods sorted by name. Otherwise, you select one when more than one pod matches")
+		all := cmd.BoolOpt("all-pods all", false, "Exec on every pod associated with the templated Ankh file, instead of selecting one. Output is prefixed with the pod name, and the command fails if exec fails on any pod.")
+		parallel := cmd.BoolOpt("parallel", false, "With --all-pods, exec on every pod in parallel instead of sequentially")
+		timeout := cmd.StringOpt("timeout", "", "Kill the command if it runs for longer than this, eg: 30s. With --all-pods, applies to each pod")
 		extra := cmd.StringsArg("PASSTHROUGH", []string{}, "Pass-through arguments to provide to `kubectl` after `exec`, which can be specified after `--` eg: `ankh ... get -- -o json`")
 
 		cmd.Action = func() {
@@ -902,9 +2172,22 @@ func main() {
 			ctx.DryRun = false
 			ctx.Chart = *chart
 			ctx.Mode = ankh.Exec
+			ctx.Options.ExecAll = *all
+			ctx.Options.ExecParallel = *parallel
+			ctx.Options.ExecPod = *pod
+			if *timeout != "" {
+				duration, err := time.ParseDuration(*timeout)
+				if err != nil {
+					fatalf(exitConfigError, "Invalid --timeout \"%v\": %v", *timeout, err)
+				}
+				ctx.Options.ExecTimeout = duration
+			}
 			if *container != "" {
 				ctx.ExtraArgs = append(ctx.ExtraArgs, []string{"-c", *container}...)
 			}
+			if *all && len(*extra) == 0 {
+				fatalf(exitConfigError, "A command is required when using --all-pods, eg: `ankh exec --all-pods -- /bin/date`")
+			}
 			if len(*extra) == 0 {
 				*extra = []string{"/bin/sh"}
 			}
@@ -918,44 +2201,311 @@ func main() {
 		}
 	})
 
-	app.Command("lint", "Lint an Ankh file, checking for possible errors or mistakes", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-f] [--chart] [--filter...]"
+	app.Command("run-job", "Run the Jobs in a chart once, streaming their logs, and exiting with their exit code", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--job...] [--timeout]"
 
 		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
-		chart := cmd.StringOpt("chart", "", "Limits the lint command to only the specified chart")
-		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		chart := cmd.StringOpt("chart", "", "Limits the run-job command to only the specified chart")
+		jobs := cmd.StringsOpt("job", []string{}, "The Job to run, by its name in the chart. May be repeated. Defaults to every Job in the chart")
+		timeout := cmd.StringOpt("timeout", defaultRunJobTimeout, "How long to wait for each Job to finish")
 
 		cmd.Action = func() {
 			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
 			ctx.Chart = *chart
-			ctx.Mode = ankh.Lint
-			filters := []string{}
-			for _, filter := range *filter {
-				filters = append(filters, string(filter))
+			ctx.Mode = ankh.RunJob
+			ctx.Filters = []string{"job"}
+			ctx.Options.RunJobNames = *jobs
+			duration, err := time.ParseDuration(*timeout)
+			if err != nil {
+				fatalf(exitConfigError, "Invalid `--timeout` '%v': %v", *timeout, err)
 			}
-			ctx.Filters = filters
+			ctx.Options.RunJobTimeout = duration
 
 			execute(ctx)
 			os.Exit(0)
 		}
 	})
 
-	app.Command("template", "Output the results of templating an Ankh file", func(cmd *cli.Cmd) {
-		cmd.Spec = "[-f] [--chart] [--filter...]"
+	app.Command("cp", "Copy files to or from a pod associated with a templated Ankh file", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [-c] [--pod] SRC DST"
 
 		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
-		chart := cmd.StringOpt("chart", "", "Limits the template command to only the specified chart")
-		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		chart := cmd.StringOpt("chart", "", "Limits the cp command to only the specified chart")
+		container := cmd.StringOpt("c container", "", "The container to copy to or from. Required when there is more than one container running in the pods associated with the templated Ankh file.")
+		pod := cmd.StringOpt("pod", "", "The pod to copy to or from, by name, or by its index (from 0) in the pods sorted by name. Otherwise, you select one when more than one pod matches")
+		src := cmd.StringArg("SRC", "", "The path to copy from. Paths in the pod are written as `:/path`")
+		dst := cmd.StringArg("DST", "", "The path to copy to. Paths in the pod are written as `:/path`")
 
 		cmd.Action = func() {
 			ctx.AnkhFilePath = *ankhFilePath
+			ctx.DryRun = false
 			ctx.Chart = *chart
-			ctx.Mode = ankh.Template
-			filters := []string{}
-			for _, filter := range *filter {
-				filters = append(filters, string(filter))
+			ctx.Mode = ankh.Cp
+			ctx.Options.ExecPod = *pod
+			check(kubectl.ValidateCpPaths(*src, *dst))
+			ctx.Options.CpSource = *src
+			ctx.Options.CpDestination = *dst
+			if *container != "" {
+				ctx.ExtraArgs = append(ctx.ExtraArgs, []string{"-c", *container}...)
+			}
+
+			execute(ctx)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("lint", "Lint an Ankh file, checking for possible errors or mistakes", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--filter...] [--only...] [--kubernetes-version] [--skip-schema-validation] [--score] [--min-score] [-o]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the lint command to only the specified chart")
+		kubernetesVersion := cmd.StringOpt("kubernetes-version", "", "The Kubernetes version to check objects against, eg: `1.21`. Defaults to `lint.kubernetesVersion` in the ankh config, and then the version of the context's cluster")
+		skipSchemaValidation := cmd.BoolOpt("skip-schema-validation", false, "Don't validate objects against the Kubernetes schemas")
+		score := cmd.BoolOpt("score", false, "Check workloads against best practices, like having probes and resource limits, and score each chart out of 100")
+		minScore := cmd.IntOpt("min-score", 0, "Fail charts that score lower than this on the best-practice checks. Implies `--score`. Defaults to `lint.score.minimum` in the ankh config")
+		output := cmd.StringOpt("o output", "", fmt.Sprintf("Print the lint findings in this format, one of [ %v ], and log to stderr instead", strings.Join(lintOutputFormats, ", ")))
+		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to include for the action, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Lint
+			ctx.Options.SchemaKubernetesVersion = *kubernetesVersion
+			ctx.Options.SkipSchemaValidation = *skipSchemaValidation
+			ctx.Options.Score = *score
+			ctx.Options.MinScore = *minScore
+			filters := []string{}
+			for _, filter := range *filter {
+				filters = append(filters, string(filter))
+			}
+			ctx.Filters = filters
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+			if *output != "" {
+				if !util.Contains(lintOutputFormats, *output) {
+					fatalf(exitConfigError, "Invalid output format '%v', must be one of [ %v ]", *output, strings.Join(lintOutputFormats, ", "))
+				}
+				log.Out = os.Stderr
+			}
+
+			execute(ctx)
+			if *output != "" {
+				body, err := formatLintResults(ctx.LintResults, *output)
+				check(err)
+				fmt.Print(string(body))
+			}
+			if count := lintErrors(ctx); count > 0 {
+				log.Errorf("Lint found %d errors.", count)
+				exit(exitLintFailed)
+			}
+			os.Exit(0)
+		}
+	})
+
+	app.Command("ci", "Lint and then apply an Ankh file without prompting, writing results for CI pipelines", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--tag] [--dry-run] [--skip-lint] [--results] [--junit]"
+
+		ankhFilePath := cmd.String(cli.StringOpt{
+			Name:   "f filename",
+			Value:  "ankh.yaml",
+			Desc:   "Config file name",
+			EnvVar: "ANKH_FILE",
+		})
+		chart := cmd.String(cli.StringOpt{
+			Name:   "chart",
+			Value:  "",
+			Desc:   "Limits the ci command to only the specified chart",
+			EnvVar: "ANKH_CHART",
+		})
+		tag := cmd.String(cli.StringOpt{
+			Name:   "tag",
+			Value:  "",
+			Desc:   "The tag to deploy, set as `helm.tagValueName` from the ankh config. Shorthand for `--set TAG_VALUE_NAME=TAG`",
+			EnvVar: "ANKH_TAG",
+		})
+		dryRun := cmd.Bool(cli.BoolOpt{
+			Name:   "dry-run",
+			Value:  false,
+			Desc:   "Lint, and then perform a dry-run apply",
+			EnvVar: "ANKH_DRY_RUN",
+		})
+		skipLint := cmd.Bool(cli.BoolOpt{
+			Name:   "skip-lint",
+			Value:  false,
+			Desc:   "Apply without linting first",
+			EnvVar: "ANKH_SKIP_LINT",
+		})
+		results := cmd.String(cli.StringOpt{
+			Name:   "results",
+			Value:  "",
+			Desc:   "Write the results of the run as JSON to this file, including when it fails",
+			EnvVar: "ANKH_RESULTS_OUTPUT",
+		})
+		junit := cmd.String(cli.StringOpt{
+			Name:   "junit",
+			Value:  "",
+			Desc:   "Write the lint results as JUnit XML to this file",
+			EnvVar: "ANKH_JUNIT_OUTPUT",
+		})
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.Chart = *chart
+			ctx.DryRun = *dryRun
+			ctx.NoPrompt = true
+			if *tag != "" {
+				tagValueName := ctx.AnkhConfig.Helm.TagValueName
+				if tagValueName == "" {
+					fatalf(exitConfigError, "`--tag` needs `helm.tagValueName` to be set in the ankh config. Pass `--set NAME=%v` instead", *tag)
+				}
+				ctx.HelmSetValues[tagValueName] = *tag
+			}
+			logrus.RegisterExitHandler(func() {
+				writeCIOutputs(ctx, exitCode, *results, *junit)
+			})
+
+			if !*skipLint {
+				ctx.Mode = ankh.Lint
+				execute(ctx)
+				if count := lintErrors(ctx); count > 0 {
+					log.Errorf("Lint found %d errors.", count)
+					exit(exitLintFailed)
+				}
+			}
+
+			ctx.Mode = ankh.Apply
+			execute(ctx)
+			writeCIOutputs(ctx, 0, *results, *junit)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("template", "Output the results of templating an Ankh file", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--filter...] [--only...]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the template command to only the specified chart")
+		filter := cmd.StringsOpt("filter", []string{}, "Kubernetes object kinds to include for the action. The entries in this list are case insensitive. Any object whose `kind:` does not match this filter will be excluded from the action.")
+		only := cmd.StringsOpt("only", []string{}, "Kubernetes objects to include for the action, of the form `kind/name` (eg: `deployment/web`). May be repeated. Any object that does not match one of these will be excluded from the action.")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Template
+			filters := []string{}
+			for _, filter := range *filter {
+				filters = append(filters, string(filter))
+			}
+			ctx.Filters = filters
+			onlyObjects, err := parseOnly(*only)
+			check(err)
+			ctx.OnlyObjects = onlyObjects
+
+			execute(ctx)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("export", "Export Ankh files for other deployment tools", func(cmd *cli.Cmd) {
+		cmd.Command("flux", "Write a Flux HelmRepository for each context, and a HelmRelease for each chart", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-f] [--chart] [--output-dir] [--interval] [--source-namespace]"
+
+			ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+			chart := cmd.StringOpt("chart", "", "Limits the export to only the specified chart")
+			outputDir := cmd.StringOpt("output-dir", "flux", "The directory to write a directory per context under")
+			interval := cmd.StringOpt("interval", "10m", "How often Flux reconciles the exported objects")
+			sourceNamespace := cmd.StringOpt("source-namespace", "flux-system", "The namespace of the exported HelmRepository")
+
+			cmd.Action = func() {
+				ctx.AnkhFilePath = *ankhFilePath
+				ctx.Chart = *chart
+				ctx.Mode = ankh.Export
+				if duration, err := time.ParseDuration(*interval); err != nil || duration <= 0 {
+					fatalf(exitConfigError, "Invalid `--interval` '%v', expected a duration like `10m` or `1h`", *interval)
+				}
+
+				execute(ctx)
+				writeFluxExport(ctx, *outputDir, *interval, *sourceNamespace)
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("gitops", "Render Ankh files into a manifests repository for GitOps tools like Argo CD and Flux", func(cmd *cli.Cmd) {
+		cmd.Command("push", "Render charts for each context, then commit and push them to a manifests repository", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-f] [--chart] --repo [--path] [--branch] [--dry-run]"
+
+			ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+			chart := cmd.StringOpt("chart", "", "Limits the push to only the specified chart")
+			repo := cmd.StringOpt("repo", "", "The git URL of the manifests repository")
+			path := cmd.StringOpt("path", ".", "The directory in the manifests repository to write a directory per context under, eg: `clusters/prod`")
+			branch := cmd.StringOpt("branch", "", "The branch to push to. Defaults to the repository's default branch")
+			dryRun := cmd.BoolOpt("dry-run", false, "Commit in a temporary clone and show what changed, without pushing")
+
+			cmd.Action = func() {
+				ctx.AnkhFilePath = *ankhFilePath
+				ctx.Chart = *chart
+				ctx.Mode = ankh.GitOps
+				if filepath.IsAbs(*path) || strings.HasPrefix(filepath.Clean(*path), "..") {
+					fatalf(exitConfigError, "Invalid `--path` '%v', expected a directory within the repository", *path)
+				}
+
+				execute(ctx)
+				pushGitOps(ctx, *repo, filepath.Clean(*path), *branch, *dryRun)
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("values", "Output the values that each chart in an Ankh file is templated with", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--explain-merge | --diff-defaults]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the values command to only the specified chart")
+		explainMerge := cmd.BoolOpt("explain-merge", false, "Show which source set each value, and how lists were merged, instead of the merged values")
+		diffDefaults := cmd.BoolOpt("diff-defaults", false, "Show only the values that differ from the default values.yaml of the chart's version, eg: to find overrides that are no longer needed")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Values
+			ctx.Options.ExplainMerge = *explainMerge
+			ctx.Options.DiffDefaults = *diffDefaults
+
+			execute(ctx)
+			os.Exit(0)
+		}
+	})
+
+	app.Command("resources", "Output the CPU and memory requested by each chart in an Ankh file, and what they'd cost", func(cmd *cli.Cmd) {
+		cmd.Spec = "[-f] [--chart] [--cpu-price] [--memory-price]"
+
+		ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name")
+		chart := cmd.StringOpt("chart", "", "Limits the resources command to only the specified chart")
+		cpuPrice := cmd.StringOpt("cpu-price", "", "The price of a core, to estimate costs with. Defaults to `resources.cpuPrice` in the ankh config")
+		memoryPrice := cmd.StringOpt("memory-price", "", "The price of a GiB of memory, to estimate costs with. Defaults to `resources.memoryPrice` in the ankh config")
+
+		cmd.Action = func() {
+			ctx.AnkhFilePath = *ankhFilePath
+			ctx.Chart = *chart
+			ctx.Mode = ankh.Resources
+			if *cpuPrice != "" {
+				price, err := strconv.ParseFloat(*cpuPrice, 64)
+				if err != nil {
+					fatalf(exitConfigError, "Invalid `--cpu-price` '%v': %v", *cpuPrice, err)
+				}
+				ctx.Options.CPUPrice = price
+			}
+			if *memoryPrice != "" {
+				price, err := strconv.ParseFloat(*memoryPrice, 64)
+				if err != nil {
+					fatalf(exitConfigError, "Invalid `--memory-price` '%v': %v", *memoryPrice, err)
+				}
+				ctx.Options.MemoryPrice = price
 			}
-			ctx.Filters = filters
 
 			execute(ctx)
 			os.Exit(0)
@@ -988,7 +2538,7 @@ func main() {
 				output, err := docker.ListImages(ctx, *numToShow)
 				check(err)
 				if output != "" {
-					fmt.Printf(output)
+					fmt.Print(output)
 				}
 				os.Exit(0)
 			}
@@ -1017,7 +2567,7 @@ func main() {
 				helmOutput, err := helm.ListCharts(ctx, *numToShow)
 				check(err)
 				if helmOutput != "" {
-					fmt.Printf(helmOutput)
+					fmt.Print(helmOutput)
 				}
 				os.Exit(0)
 			}
@@ -1083,12 +2633,35 @@ func main() {
 					}
 				}
 
+				requireBinaries(ctx, "chart publish", "helm")
 				err := helm.Publish(ctx)
 				check(err)
 				os.Exit(0)
 			}
 		})
 
+		cmd.Command("cache", "Manage the cache of chart archives fetched from helm registries", func(cmd *cli.Cmd) {
+			cmd.Command("clean", "Remove cached chart archives", func(cmd *cli.Cmd) {
+				cmd.Spec = "[--older-than]"
+				olderThan := cmd.StringOpt("older-than", "", "Only remove archives that haven't been used for this long, eg: 720h")
+
+				cmd.Action = func() {
+					var age time.Duration
+					if *olderThan != "" {
+						d, err := time.ParseDuration(*olderThan)
+						if err != nil {
+							fatalf(exitConfigError, "Invalid `--older-than` '%v': %v", *olderThan, err)
+						}
+						age = d
+					}
+					removed, size, err := helm.CleanChartCache(ctx, age)
+					check(err)
+					ctx.Logger.Infof("Removed %v cached chart archive(s), %v bytes, from %v", removed, size, ctx.ChartCacheDir)
+					os.Exit(0)
+				}
+			})
+		})
+
 		cmd.Command("bump", "Bump a Helm chart's semantic version using Chart.yaml from the current directory", func(cmd *cli.Cmd) {
 			cmd.Spec = "[SEMVERTYPE]"
 			semVerType := cmd.StringArg("SEMVERTYPE", "patch", "Which part of the semantic version (eg: x.y.z) to bump: \"major\", \"minor\", or \"patch\".")
@@ -1101,42 +2674,69 @@ func main() {
 		})
 	})
 
+	app.Command("workspace", "Manage Ankh workspaces", func(cmd *cli.Cmd) {
+		cmd.Command("ls", "List workspaces", func(cmd *cli.Cmd) {
+			cmd.Action = func() {
+				printWorkspaces()
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("view", "View a workspace, with its Ankh files resolved", func(cmd *cli.Cmd) {
+			cmd.Spec = "[NAME]"
+			name := cmd.StringArg("NAME", "", "The workspace to view. Defaults to the one selected with `--workspace`")
+
+			cmd.Action = func() {
+				viewWorkspace(ctx, *name)
+				os.Exit(0)
+			}
+		})
+	})
+
 	app.Command("config", "Manage Ankh configuration", func(cmd *cli.Cmd) {
 		ctx.IgnoreContextAndEnv = true
 		ctx.IgnoreConfigErrors = true
 
-		cmd.Command("init", "Initialize Ankh configuration", func(cmd *cli.Cmd) {
-			cmd.Action = func() {
-				// Use the original, unmerged config. We want to explicitly avoid
-				// serializing the contents of any remote configs.
-				newAnkhConfig := ctx.OriginalAnkhConfig
-
-				if len(newAnkhConfig.Contexts) == 0 {
-					newAnkhConfig.Contexts = map[string]ankh.Context{
-						"minikube": {
-							KubeContext:      "minikube",
-							EnvironmentClass: "dev",
-							ResourceProfile:  "constrained",
-							Release:          "minikube",
-							HelmRegistryURL:  "https://kubernetes-charts.storage.googleapis.com",
-						},
-					}
-					ctx.Logger.Infof("Initializing `contexts` to a single sample context for kube-context `minikube`")
-				}
+		cmd.Command("init", "Initialize Ankh configuration, merging a sample or starter config into an existing one", func(cmd *cli.Cmd) {
+			cmd.Spec = "[--force] [--from]"
+			force := cmd.BoolOpt("force", false, "Replace an existing config with the starter config, instead of merging. The existing config is backed up first")
+			from := cmd.StringOpt("from", "", "A URL or path of a starter config to use instead of the sample config, eg: one provided by your platform team")
 
-				out, err := yaml.Marshal(newAnkhConfig)
+			cmd.Action = func() {
+				// Only ever write to the local config, never a remote one.
+				configPath, err := config.LocalConfigPath(ctx)
 				check(err)
-
-				err = ioutil.WriteFile(ctx.AnkhConfigPath, out, 0644)
+				starter, err := config.StarterConfig(*from)
 				check(err)
 
+				result, err := config.InitConfig(configPath, starter, *force)
+				check(err)
+				if result.BackupPath != "" {
+					ctx.Logger.Infof("Backed up the existing ankh config to %v", result.BackupPath)
+				}
+				switch {
+				case result.Created:
+					ctx.Logger.Infof("Wrote a new ankh config to %v", configPath)
+				case result.Replaced:
+					ctx.Logger.Infof("Replaced the ankh config at %v", configPath)
+				case len(result.Added) == 0:
+					ctx.Logger.Infof("The ankh config at %v already has everything in the starter config, so it was left unchanged", configPath)
+				default:
+					ctx.Logger.Infof("Merged [ %v ] into the ankh config at %v", strings.Join(result.Added, ", "), configPath)
+				}
 				os.Exit(0)
 			}
 		})
 
 		cmd.Command("view", "View merged Ankh configuration", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-o]"
+			output := cmd.StringOpt("o output", "yaml", "Output format, one of [ json, yaml ]. Structured output includes the source of each context and environment")
+
 			cmd.Action = func() {
-				out, err := yaml.Marshal(ctx.AnkhConfig)
+				validateConfigOutput(*output, []string{"json", "yaml"})
+				view, err := configView(ctx)
+				check(err)
+				out, err := formatStructured(view, *output)
 				check(err)
 
 				fmt.Print(string(out))
@@ -1145,44 +2745,551 @@ func main() {
 		})
 
 		cmd.Command("get-contexts", "Get available contexts", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-o]"
+			output := cmd.StringOpt("o output", "table", fmt.Sprintf("Output format, one of [ %v ]. Structured output includes the resolved kube-context server", strings.Join(configOutputFormats, ", ")))
+
 			cmd.Action = func() {
-				w := tabwriter.NewWriter(os.Stdout, 0, 8, 8, ' ', 0)
-				fmt.Fprintf(w, "NAME\tRELEASE\tENVIRONMENT-CLASS\tRESOURCE-PROFILE\tKUBE-CONTEXT/SERVER\tSOURCE\n")
-				keys := []string{}
-				for k, _ := range ctx.AnkhConfig.Contexts {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
-				for _, name := range keys {
-					ctx, _ := ctx.AnkhConfig.Contexts[name]
-					target := ctx.KubeContext
-					if target == "" {
-						target = ctx.KubeServer
+				validateConfigOutput(*output, configOutputFormats)
+				views := contextViews(ctx)
+				if *output == "table" {
+					printContextViews(views)
+					os.Exit(0)
+				}
+				out, err := formatStructured(views, *output)
+				check(err)
+				fmt.Print(string(out))
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("use-context", "Set the current context in the Ankh config, used when no `--context` or `--environment` is provided", func(cmd *cli.Cmd) {
+			cmd.Spec = "CONTEXT"
+			context := cmd.StringArg("CONTEXT", "", "The context to use")
+
+			cmd.Action = func() {
+				if _, ok := ctx.AnkhConfig.Contexts[*context]; !ok {
+					log.Errorf("Context \"%v\" not found in `contexts`.", *context)
+					log.Info("The following contexts are available:")
+					printContexts(&ctx.AnkhConfig)
+					exit(exitConfigError)
+				}
+
+				configPath, err := config.LocalConfigPath(ctx)
+				check(err)
+
+				err = config.SetCurrentContext(configPath, *context)
+				check(err)
+
+				ctx.Logger.Infof("Switched to context \"%v\" in %v", *context, configPath)
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("set-context", "Create or modify a context in the Ankh config", func(cmd *cli.Cmd) {
+			cmd.Spec = "[--kube-context | --kube-server] [--environment-class] [--resource-profile] [--release] [--registry...] CONTEXT"
+
+			kubeContext := cmd.StringOpt("kube-context", "", "The kube-context to use with kubectl")
+			kubeServer := cmd.StringOpt("kube-server", "", "The kube-server to use with kubectl, instead of a kube-context")
+			environmentClass := cmd.StringOpt("environment-class", "", "The environment class, used to select `values` in Ankh files")
+			resourceProfile := cmd.StringOpt("resource-profile", "", "The resource profile, used to select `resource-profiles` in Ankh files")
+			release := cmd.StringOpt("release", "", "The release name, used to select `releases` in Ankh files")
+			registries := cmd.StringsOpt("registry", []string{}, "Helm registries to pin to this context, tried in order. May be repeated.")
+			context := cmd.StringArg("CONTEXT", "", "The context to create or modify")
+
+			cmd.Action = func() {
+				configPath, err := config.LocalConfigPath(ctx)
+				check(err)
+
+				newContext, exists, err := config.GetLocalContext(configPath, *context)
+				check(err)
+				if existing, ok := ctx.AnkhConfig.Contexts[*context]; ok && !exists {
+					fatalf(exitConfigError, "Context \"%v\" is defined in %v, not in %v, and can't be modified here", *context, existing.Source, configPath)
+				}
+
+				if *kubeContext != "" {
+					newContext.KubeContext = *kubeContext
+					newContext.KubeServer = ""
+				}
+				if *kubeServer != "" {
+					newContext.KubeServer = *kubeServer
+					newContext.KubeContext = ""
+				}
+				if *environmentClass != "" {
+					newContext.EnvironmentClass = *environmentClass
+				}
+				if *resourceProfile != "" {
+					newContext.ResourceProfile = *resourceProfile
+				}
+				if *release != "" {
+					newContext.Release = *release
+				}
+				if len(*registries) > 0 {
+					newContext.HelmRegistries = *registries
+				}
+
+				missing := []string{}
+				if newContext.KubeContext == "" && newContext.KubeServer == "" {
+					missing = append(missing, "--kube-context or --kube-server")
+				}
+				if newContext.EnvironmentClass == "" && newContext.Environment == "" {
+					missing = append(missing, "--environment-class")
+				}
+				if newContext.ResourceProfile == "" {
+					missing = append(missing, "--resource-profile")
+				}
+				if len(missing) > 0 {
+					fatalf(exitConfigError, "Context \"%v\" requires %v", *context, strings.Join(missing, ", "))
+				}
+
+				err = config.SetContext(configPath, *context, newContext)
+				check(err)
+
+				if exists {
+					ctx.Logger.Infof("Modified context \"%v\" in %v", *context, configPath)
+				} else {
+					ctx.Logger.Infof("Created context \"%v\" in %v", *context, configPath)
+				}
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("delete-context", "Delete a context from the Ankh config", func(cmd *cli.Cmd) {
+			cmd.Spec = "CONTEXT"
+			context := cmd.StringArg("CONTEXT", "", "The context to delete")
+
+			cmd.Action = func() {
+				configPath, err := config.LocalConfigPath(ctx)
+				check(err)
+
+				err = config.DeleteContext(configPath, *context)
+				check(err)
+
+				ctx.Logger.Infof("Deleted context \"%v\" from %v", *context, configPath)
+				if ctx.AnkhConfig.PersistedContextName == *context {
+					ctx.Logger.Warnf("Deleted context \"%v\" was the current context. Use `ankh config use-context CONTEXT` to select another.", *context)
+				}
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("rename-context", "Rename a context in the Ankh config", func(cmd *cli.Cmd) {
+			cmd.Spec = "OLD NEW"
+			oldName := cmd.StringArg("OLD", "", "The context to rename")
+			newName := cmd.StringArg("NEW", "", "The new name for the context")
+
+			cmd.Action = func() {
+				if existing, ok := ctx.AnkhConfig.Contexts[*newName]; ok {
+					fatalf(exitConfigError, "Context \"%v\" already exists in %v", *newName, existing.Source)
+				}
+				// Environments may come from included configs, which can't be edited here.
+				if using := config.EnvironmentsUsingContext(ctx.AnkhConfig.Environments, *oldName); len(using) > 0 {
+					fatalf(exitConfigError, "Context \"%v\" is in the `contexts` of environments [ %v ]. "+
+						"Remove it from them before renaming it, and add the new name after", *oldName, strings.Join(using, ", "))
+				}
+
+				configPath, err := config.LocalConfigPath(ctx)
+				check(err)
+
+				err = config.RenameContext(configPath, *oldName, *newName)
+				check(err)
+
+				if ctx.AnkhConfig.PersistedContextName == *oldName {
+					err = config.SetCurrentContext(configPath, *newName)
+					check(err)
+				}
+
+				ctx.Logger.Infof("Renamed context \"%v\" to \"%v\" in %v", *oldName, *newName, configPath)
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("import-kubeconfig", "Create a context in the Ankh config for each context in a kubeconfig", func(cmd *cli.Cmd) {
+			cmd.Spec = "[--kubeconfig] [--environment-class] [--resource-profile] [--release]"
+
+			kubeConfigPath := cmd.StringOpt("kubeconfig", "", "The kubeconfig to import contexts from. Defaults to the global kubeconfig.")
+			environmentClass := cmd.StringOpt("environment-class", "", "The environment class for every imported context. Prompted for each context when not provided.")
+			resourceProfile := cmd.StringOpt("resource-profile", "", "The resource profile for every imported context. Prompted for each context when not provided.")
+			release := cmd.StringOpt("release", "", "The release name for every imported context. Optional.")
+
+			cmd.Action = func() {
+				if *kubeConfigPath == "" {
+					*kubeConfigPath = ctx.KubeConfigPath
+				}
+				kubeContexts, err := config.KubeConfigContexts(*kubeConfigPath)
+				check(err)
+
+				configPath, err := config.LocalConfigPath(ctx)
+				check(err)
+				if _, err := os.Stat(configPath); os.IsNotExist(err) {
+					err = os.MkdirAll(path.Dir(configPath), 0755)
+					check(err)
+					err = ioutil.WriteFile(configPath, []byte{}, 0644)
+					check(err)
+				}
+
+				imported := 0
+				for _, name := range kubeContexts {
+					if existing, ok := ctx.AnkhConfig.Contexts[name]; ok {
+						ctx.Logger.Infof("Skipping kube-context \"%v\", since context \"%v\" already exists in %v", name, name, existing.Source)
+						continue
+					}
+
+					newContext := ankh.Context{
+						KubeContext:      name,
+						EnvironmentClass: *environmentClass,
+						ResourceProfile:  *resourceProfile,
+						Release:          *release,
 					}
-					fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", name, ctx.Release, ctx.EnvironmentClass, ctx.ResourceProfile, target, ctx.Source)
+					if newContext.EnvironmentClass == "" {
+						newContext.EnvironmentClass, err = util.PromptForInput("dev",
+							fmt.Sprintf("Environment class for kube-context '%v'", name))
+						check(err)
+					}
+					if newContext.ResourceProfile == "" {
+						newContext.ResourceProfile, err = util.PromptForInput("natural",
+							fmt.Sprintf("Resource profile for kube-context '%v'", name))
+						check(err)
+					}
+
+					err = config.SetContext(configPath, name, newContext)
+					check(err)
+					ctx.Logger.Infof("Created context \"%v\" in %v", name, configPath)
+					imported++
 				}
-				w.Flush()
+
+				ctx.Logger.Infof("Imported %v of %v kube-context(s) from %v", imported, len(kubeContexts), *kubeConfigPath)
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("migrate", "Upgrade the Ankh config and Ankh files to the current schema", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-f...] [--dry-run]"
+			ankhFilePaths := cmd.StringsOpt("f filename", []string{}, "Ankh files to migrate, in addition to the Ankh config. May be repeated")
+			dryRun := cmd.BoolOpt("dry-run", false, "Report the changes that would be made without writing them")
+
+			cmd.Action = func() {
+				configPath, err := config.LocalConfigPath(ctx)
+				check(err)
+
+				migrate := func(path string, migrateFunc func([]byte) ([]byte, []string, error)) {
+					body, err := ioutil.ReadFile(path)
+					check(err)
+
+					out, changes, err := migrateFunc(body)
+					if err != nil {
+						fatalf(exitConfigError, "Unable to migrate '%v': %v", path, err)
+					}
+					if len(changes) == 0 {
+						ctx.Logger.Infof("'%v' is already up to date", path)
+						return
+					}
+					for _, change := range changes {
+						ctx.Logger.Infof("%v: %v", path, change)
+					}
+					if *dryRun {
+						return
+					}
+
+					// Comments are lost when migrating, so keep the original around.
+					backupPath := path + ".bak"
+					check(ioutil.WriteFile(backupPath, body, 0644))
+					check(ioutil.WriteFile(path, out, 0644))
+					ctx.Logger.Infof("Migrated '%v' with %v change(s). The original was saved to '%v'", path, len(changes), backupPath)
+				}
+
+				migrate(configPath, config.MigrateAnkhConfig)
+				for _, ankhFilePath := range *ankhFilePaths {
+					migrate(ankhFilePath, config.MigrateAnkhFile)
+				}
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("doctor", "Check the Ankh config, clusters, binaries, and registries for problems", func(cmd *cli.Cmd) {
+			cmd.Action = func() {
+				failures := runDoctor(ctx, os.Stdout)
+				if failures > 0 {
+					fatalf(exitFailure, "%v check(s) failed", failures)
+				}
+				ctx.Logger.Infof("All checks passed")
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("current-context", "Print the current context", func(cmd *cli.Cmd) {
+			cmd.Action = func() {
+				if ctx.AnkhConfig.CurrentContextName == "" {
+					fatalf(exitConfigError, "No current context set. Use `ankh config use-context CONTEXT` to set one.")
+				}
+				fmt.Println(ctx.AnkhConfig.CurrentContextName)
 				os.Exit(0)
 			}
 		})
 
 		cmd.Command("get-environments", "Get available environments", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-o]"
+			output := cmd.StringOpt("o output", "table", fmt.Sprintf("Output format, one of [ %v ]", strings.Join(configOutputFormats, ", ")))
+
+			cmd.Action = func() {
+				validateConfigOutput(*output, configOutputFormats)
+				views := environmentViews(ctx)
+				if *output == "table" {
+					printEnvironmentViews(views)
+					os.Exit(0)
+				}
+				out, err := formatStructured(views, *output)
+				check(err)
+				fmt.Print(string(out))
+				os.Exit(0)
+			}
+		})	})
+
+	app.Command("features", "Manage features that are gated by the `features` config block", func(cmd *cli.Cmd) {
+		ctx.IgnoreContextAndEnv = true
+		ctx.IgnoreConfigErrors = true
+
+		cmd.Command("list", "List features, and whether they are enabled for the current user and context", func(cmd *cli.Cmd) {
 			cmd.Action = func() {
 				w := tabwriter.NewWriter(os.Stdout, 0, 8, 8, ' ', 0)
-				fmt.Fprintf(w, "NAME\tCONTEXTS\n")
-				keys := []string{}
-				for k, _ := range ctx.AnkhConfig.Environments {
-					keys = append(keys, k)
+				fmt.Fprintf(w, "NAME\tENABLED\tREASON\tDESCRIPTION\n")
+				for _, status := range ctx.FeatureStatuses() {
+					description := status.Description
+					if !status.Known {
+						description = "(unknown feature)"
+					}
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", status.Name, status.Enabled, status.Reason, description)
 				}
-				sort.Strings(keys)
-				for _, name := range keys {
-					env, _ := ctx.AnkhConfig.Environments[name]
-					fmt.Fprintf(w, "%v\t%v\t%v\n", name, strings.Join(env.Contexts, ","), env.Source)
+				w.Flush()
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("lock", "Manage deploy locks, which stop concurrent applies to the same namespace", func(cmd *cli.Cmd) {
+		cmd.Command("status", "Show the deploy locks held in the current context, optionally limited to --namespace", func(cmd *cli.Cmd) {
+			cmd.Action = func() {
+				namespace := ""
+				if ctx.Namespace != nil {
+					namespace = *ctx.Namespace
+				}
+				requireBinaries(ctx, "lock status", "kubectl")
+				locks, err := kubectl.ListLocks(ctx, namespace)
+				check(err)
+
+				if len(locks) == 0 {
+					ctx.Logger.Infof("No deploy locks are held")
+					os.Exit(0)
+				}
+
+				ttl := deployLockTTL(ctx)
+				w := tabwriter.NewWriter(os.Stdout, 0, 8, 8, ' ', 0)
+				fmt.Fprintf(w, "NAMESPACE\tNAME\tHOLDER\tACQUIRED\tSTALE\n")
+				for _, lock := range locks {
+					stale := time.Since(lock.Acquired) >= ttl
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", lock.Namespace, lock.Name, lock.Holder,
+						lock.Acquired.Format(time.RFC3339), stale)
 				}
 				w.Flush()
 				os.Exit(0)
 			}
 		})
+
+		cmd.Command("release", "Release the deploy lock for the current release in --namespace", func(cmd *cli.Cmd) {
+			cmd.Spec = "[--force]"
+			force := cmd.BoolOpt("force", false, "Release the lock even if it is held by somebody else")
+
+			cmd.Action = func() {
+				if ctx.Namespace == nil {
+					fatalf(exitConfigError, "Must provide the namespace of the lock to release using `--namespace`")
+				}
+				requireBinaries(ctx, "lock release", "kubectl")
+				namespace := *ctx.Namespace
+				name := kubectl.LockName(ctx.AnkhConfig.CurrentContext.Release)
+
+				lock, err := kubectl.GetLock(ctx, namespace, name)
+				check(err)
+				if lock == nil {
+					ctx.Logger.Infof("Deploy lock '%v' in namespace \"%v\" is not held", name, namespace)
+					os.Exit(0)
+				}
+				if lock.Holder != lockHolder(ctx) && !*force {
+					fatalf(exitFailure, "Deploy lock '%v' in namespace \"%v\" is held by %v since %v. Pass `--force` to release it anyway",
+						name, namespace, lock.Holder, lock.Acquired.Format(time.RFC3339))
+				}
+
+				check(kubectl.ReleaseLock(ctx, namespace, name, lock.ID, true))
+
+				message := fmt.Sprintf("Released deploy lock '%v' held by %v since %v", name, lock.Holder, lock.Acquired.Format(time.RFC3339))
+				ctx.Logger.Infof("%v", message)
+				if err := ctx.Audit(ankh.AuditEntry{Namespace: namespace, Message: message}); err != nil {
+					ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+				}
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("login", "Store registry credentials in the OS keyring", func(cmd *cli.Cmd) {
+		ctx.IgnoreContextAndEnv = true
+		ctx.IgnoreConfigErrors = true
+
+		login := func(kind string, registry string, key string) {
+			username, err := util.PromptForUsername()
+			check(err)
+			password, err := util.PromptForPassword()
+			check(err)
+
+			err = keyring.Set(key, keyring.Credentials{Username: username, Password: password})
+			check(err)
+			ctx.Logger.Infof("Stored credentials for user %v on %v registry '%v' in the OS keyring", username, kind, registry)
+			os.Exit(0)
+		}
+
+		cmd.Command("registry", "Store credentials for the helm registry", func(cmd *cli.Cmd) {
+			cmd.Spec = "[--registry]"
+			registry := cmd.StringOpt("registry", "", "The helm registry to log in to. Defaults to `helm.registry` from the ankh config")
+
+			cmd.Action = func() {
+				if *registry == "" {
+					*registry = ctx.AnkhConfig.Helm.Registry
+				}
+				if *registry == "" {
+					fatalf(exitConfigError, "No helm registry to log in to. Pass --registry or set `helm.registry` in the ankh config")
+				}
+				login("helm", *registry, keyring.HelmRegistryKey(*registry))
+			}
+		})
+
+		cmd.Command("docker", "Store credentials for the docker registry", func(cmd *cli.Cmd) {
+			cmd.Spec = "[--registry]"
+			registry := cmd.StringOpt("registry", "", "The docker registry to log in to. Defaults to `docker.registry` from the ankh config")
+
+			cmd.Action = func() {
+				if *registry == "" {
+					*registry = ctx.AnkhConfig.Docker.Registry
+				}
+				if *registry == "" {
+					fatalf(exitConfigError, "No docker registry to log in to. Pass --registry or set `docker.registry` in the ankh config")
+				}
+				login("docker", *registry, keyring.DockerRegistryKey(*registry))
+			}
+		})
+	})
+
+	app.Command("convert", "Convert configuration from other tools to Ankh", func(cmd *cli.Cmd) {
+		ctx.IgnoreContextAndEnv = true
+		ctx.IgnoreConfigErrors = true
+
+		cmd.Command("helmfile", "Convert a helmfile to an Ankh file and Ankh config contexts", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-f] [--ankh-file-output] [--config-output]"
+
+			helmfilePath := cmd.StringOpt("f filename", "helmfile.yaml", "The helmfile to convert")
+			ankhFileOutput := cmd.StringOpt("ankh-file-output", "ankh.yaml", "Where to write the converted Ankh file")
+			configOutput := cmd.StringOpt("config-output", "ankh-config.yaml", "Where to write Ankh config contexts for each helmfile environment")
+
+			cmd.Action = func() {
+				ankhFile, ankhConfig, err := convert.FromHelmfile(ctx, *helmfilePath)
+				check(err)
+
+				for _, output := range []string{*ankhFileOutput, *configOutput} {
+					if _, err := os.Stat(output); err == nil {
+						fatalf(exitFailure, "Refusing to overwrite existing file '%v'", output)
+					}
+				}
+
+				out, err := yaml.Marshal(ankhFile)
+				check(err)
+				err = ioutil.WriteFile(*ankhFileOutput, out, 0644)
+				check(err)
+				ctx.Logger.Infof("Wrote Ankh file with %v chart(s) to %v", len(ankhFile.Charts), *ankhFileOutput)
+
+				out, err = yaml.Marshal(ankhConfig)
+				check(err)
+				err = ioutil.WriteFile(*configOutput, out, 0644)
+				check(err)
+				ctx.Logger.Infof("Wrote Ankh config with %v context(s) to %v. Review it, and then add it to `include` in your Ankh config.",
+					len(ankhConfig.Contexts), *configOutput)
+
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("completion", "Output shell completion code for bash, zsh, or fish", func(cmd *cli.Cmd) {
+		ctx.IgnoreContextAndEnv = true
+		ctx.IgnoreConfigErrors = true
+
+		for _, shell := range []string{"bash", "zsh", "fish"} {
+			shell := shell
+			cmd.Command(shell, fmt.Sprintf("Output %v completion code", shell), func(cmd *cli.Cmd) {
+				cmd.Action = func() {
+					script, err := completionScript(shell)
+					check(err)
+					fmt.Print(script)
+					os.Exit(0)
+				}
+			})
+		}
+
+		cmd.Command("values", "Output dynamic values used by completion scripts", func(cmd *cli.Cmd) {
+			cmd.Spec = "[-f] KIND"
+
+			ankhFilePath := cmd.StringOpt("f filename", "ankh.yaml", "Config file name, used to complete chart names")
+			kind := cmd.StringArg("KIND", "", "The kind of values to output: \"contexts\", \"environments\", or \"charts\".")
+
+			cmd.Action = func() {
+				values, err := completionValues(ctx, *kind, *ankhFilePath)
+				check(err)
+				for _, value := range values {
+					fmt.Println(value)
+				}
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("plugin", "Run plugins, which are executables named `ankh-NAME` on your PATH. `ankh NAME` runs one too", func(cmd *cli.Cmd) {
+		cmd.Command("list", "List plugins on your PATH", func(cmd *cli.Cmd) {
+			ctx.IgnoreContextAndEnv = true
+			ctx.IgnoreConfigErrors = true
+
+			cmd.Action = func() {
+				printPlugins(ctx)
+				os.Exit(0)
+			}
+		})
+
+		cmd.Command("run", "Run a plugin with the merged ankh config and current context", func(cmd *cli.Cmd) {
+			cmd.Spec = "NAME [ARGS...]"
+
+			name := cmd.StringArg("NAME", "", "The plugin to run")
+			args := cmd.StringsArg("ARGS", []string{}, "Arguments for the plugin. Use `--` before them to pass options through")
+
+			cmd.Action = func() {
+				runPlugin(ctx, *name, *args)
+				os.Exit(0)
+			}
+		})
+	})
+
+	app.Command("serve", "Serve a local HTTP API for running ankh operations, for deploy UIs and bots", func(cmd *cli.Cmd) {
+		cmd.Spec = "[--listen] [--token]"
+
+		listen := cmd.StringOpt("listen", "127.0.0.1:8086", "The address to listen on")
+		token := cmd.String(cli.StringOpt{
+			Name:   "token",
+			Value:  "",
+			Desc:   "A bearer token that requests must present. Required when listening on anything but a loopback address, and generated when not given",
+			EnvVar: "ANKH_SERVE_TOKEN",
+		})
+
+		ctx.IgnoreContextAndEnv = true
+		ctx.IgnoreConfigErrors = true
+
+		cmd.Action = func() {
+			serve(ctx, *listen, *token)
+			os.Exit(0)
+		}
 	})
 
 	app.Command("version", "Show version info", func(cmd *cli.Cmd) {
@@ -1194,12 +3301,12 @@ func main() {
 			fmt.Println(AnkhBuildVersion)
 
 			ctx.Logger.Infof("`helm version --client` output:")
-			ver, err := helm.Version()
+			ver, err := helm.Version(ctx)
 			check(err)
 			fmt.Print(ver)
 
 			ctx.Logger.Infof("`kubectl version --client` output:")
-			ver, err = kubectl.Version()
+			ver, err = kubectl.Version(ctx)
 			check(err)
 			fmt.Print(ver)
 
@@ -1207,11 +3314,9 @@ func main() {
 		}
 	})
 
-	app.Run(os.Args)
+	app.Run(pluginArgs(os.Args))
 }
 
 func check(err error) {
-	if err != nil {
-		log.Fatalf("%v", err)
-	}
+	checkWith(exitFailure, err)
 }
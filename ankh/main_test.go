@@ -1,8 +1,1798 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/vcs"
 )
 
-// TODO: write tests
-func TestStub(t *testing.T) {}
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			script, err := completionScript(shell)
+			if err != nil {
+				t.Log(err)
+				t.FailNow()
+			}
+
+			for _, expected := range []string{"apply", "get-contexts", "-q completion values"} {
+				if !strings.Contains(script, expected) {
+					t.Logf("expected to find '%v' in %v completion script", expected, shell)
+					t.Fail()
+				}
+			}
+		})
+	}
+
+	t.Run("unsupported shell", func(t *testing.T) {
+		_, err := completionScript("tcsh")
+		if err == nil {
+			t.Log("expected to find an error but didnt get one")
+			t.Fail()
+		}
+	})
+}
+
+const filterTestOutput = `
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+# Source: worker/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+`
+
+func TestFilterOutput(t *testing.T) {
+	t.Run("only kind/name", func(t *testing.T) {
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), OnlyObjects: []string{"deployment.apps/web", "Service/web"}}
+		out := filterOutput(ctx, filterTestOutput)
+		if !strings.Contains(out, "web/templates/deployment.yaml") || !strings.Contains(out, "web/templates/service.yaml") ||
+			strings.Contains(out, "worker") {
+			t.Logf("unexpected filter output '%v'", out)
+			t.Fail()
+		}
+	})
+
+	t.Run("only combined with kind filters", func(t *testing.T) {
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), Filters: []string{"deployment"},
+			OnlyObjects: []string{"deployment/web", "service/web"}}
+		out := filterOutput(ctx, filterTestOutput)
+		if !strings.Contains(out, "web/templates/deployment.yaml") || strings.Contains(out, "kind: Service") {
+			t.Logf("unexpected filter output '%v'", out)
+			t.Fail()
+		}
+	})
+
+	t.Run("invalid only", func(t *testing.T) {
+		_, err := parseOnly([]string{"deployment"})
+		if err == nil {
+			t.Log("expected to find an error but didnt get one")
+			t.Fail()
+		}
+	})
+}
+
+func TestParseMajorMinor(t *testing.T) {
+	for version, expected := range map[string][2]int{
+		`Client: &version.Version{SemVer:"v2.11.0", GitCommit:"2e55dbe1"}`: {2, 11},
+		`version.BuildInfo{Version:"v3.2.4", GitCommit:"0ad800ef"}`:        {3, 2},
+		`Client Version: v1.28.2`:                                          {1, 28},
+	} {
+		major, minor, ok := parseMajorMinor(version)
+		if !ok || major != expected[0] || minor != expected[1] {
+			t.Logf("expected %v from '%v' but got %v.%v", expected, version, major, minor)
+			t.Fail()
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-hooks")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply}
+	ctx.AnkhConfig.CurrentContextName = "dev"
+	chart := ankh.Chart{Name: "web", Version: "1.0.0", Tag: "abc123"}
+	env := hookEnv(ctx, "team", []ankh.Chart{chart})
+	record := `echo "$ANKH_HOOK $ANKH_CONTEXT $ANKH_NAMESPACE $ANKH_CHART $ANKH_TAG" >> ` + out
+
+	t.Run("apply", func(t *testing.T) {
+		applied := false
+		hooks := &ankh.Hooks{PreApply: []string{record}, PostApply: []string{record}, OnFailure: []string{record}}
+		withHooks(ctx, hooks, "chart \"web\"", env, func() { applied = true })
+
+		body, _ := ioutil.ReadFile(out)
+		expected := "pre-apply dev team web abc123\npost-apply dev team web abc123\n"
+		if !applied || string(body) != expected {
+			t.Logf("expected to apply and find '%v' but got '%v'", expected, string(body))
+			t.Fail()
+		}
+		if len(failureHooks) != 0 {
+			t.Logf("expected no failure hooks after a successful apply but found %v", len(failureHooks))
+			t.Fail()
+		}
+	})
+
+	t.Run("on-failure", func(t *testing.T) {
+		os.Remove(out)
+		failureHooks = []hookRun{
+			{Commands: []string{"echo outer >> " + out}},
+			{Commands: []string{"echo inner >> " + out}},
+		}
+		runFailureHooks(ctx)
+
+		body, _ := ioutil.ReadFile(out)
+		if string(body) != "inner\nouter\n" {
+			t.Logf("expected innermost on-failure hooks to run first but got '%v'", string(body))
+			t.Fail()
+		}
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		hooks := ankh.Hooks{}
+		if err := yaml.UnmarshalStrict([]byte("pre-apply: [a]\npost-apply: [b]\non-failure: [c]\n"), &hooks); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		expected := ankh.Hooks{PreApply: []string{"a"}, PostApply: []string{"b"}, OnFailure: []string{"c"}}
+		if !reflect.DeepEqual(hooks, expected) {
+			t.Logf("expected hooks %+v but got %+v", expected, hooks)
+			t.Fail()
+		}
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		err := runHookCommands(ctx, "pre-apply", []string{"exit 3"}, env)
+		if err == nil {
+			t.Log("expected to find an error but didnt get one")
+			t.Fail()
+		}
+	})
+}
+
+func TestPluginArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-plugins")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "ankh-promote"), []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	for _, test := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"ankh", "promote", "-f", "x.yaml"}, []string{"ankh", "plugin", "run", "promote", "--", "-f", "x.yaml"}},
+		{[]string{"ankh", "-c", "promote", "--set=a=b", "promote", "up"}, []string{"ankh", "-c", "promote", "--set=a=b", "plugin", "run", "promote", "--", "up"}},
+		{[]string{"ankh", "-v", "apply", "promote"}, []string{"ankh", "-v", "apply", "promote"}},
+		{[]string{"ankh", "missing"}, []string{"ankh", "missing"}},
+	} {
+		args := pluginArgs(test.args)
+		if strings.Join(args, " ") != strings.Join(test.expected, " ") {
+			t.Logf("expected %v to be rewritten to %v but got %v", test.args, test.expected, args)
+			t.Fail()
+		}
+	}
+
+	plugins := listPlugins()
+	if plugins["promote"] != filepath.Join(dir, "ankh-promote") {
+		t.Logf("expected to find the promote plugin but got %v", plugins)
+		t.Fail()
+	}
+}
+
+func TestServeArgs(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), AnkhConfigPath: "/ankh/config", KubeConfigPath: "/kube/config",
+		AuditLogPath: "/ankh/data/audit.log"}
+
+	args, err := serveArgs(ctx, "apply", serveRequest{Context: "staging", Set: map[string]string{"tag": "v2", "a": "b"},
+		AnkhFile: "web.yaml", DryRun: true, Only: []string{"deployment/web"}})
+	expected := "--ankhconfig /ankh/config --kubeconfig /kube/config --datadir /ankh/data --no-prompt --context staging " +
+		"--set a=b --set tag=v2 apply -f web.yaml --dry-run --only deployment/web"
+	if err != nil || strings.Join(args, " ") != expected {
+		t.Logf("expected args '%v' but got '%v' (%v)", expected, strings.Join(args, " "), err)
+		t.Fail()
+	}
+
+	args, err = serveArgs(ctx, "plan", serveRequest{Environment: "production"})
+	if err != nil || args[len(args)-1] != "diff" {
+		t.Logf("expected plan to run diff but got %v (%v)", args, err)
+		t.Fail()
+	}
+
+	args, err = serveArgs(ctx, "status", serveRequest{Context: "staging", Chart: "web"})
+	if err != nil || strings.Join(args[len(args)-3:], " ") != "status --chart web" {
+		t.Logf("expected status to run status but got %v (%v)", args, err)
+		t.Fail()
+	}
+
+	for name, test := range map[string]struct {
+		operation string
+		req       serveRequest
+	}{
+		"unknown operation":       {"destroy", serveRequest{}},
+		"context and environment": {"template", serveRequest{Context: "a", Environment: "b"}},
+		"dry run template":        {"template", serveRequest{DryRun: true}},
+		"filter explain":          {"explain", serveRequest{Filter: []string{"deployment"}}},
+		"only status":             {"status", serveRequest{Only: []string{"deployment/web"}}},
+		"option as context":       {"apply", serveRequest{Context: "--kubeconfig=/tmp/evil"}},
+		"option as chart":         {"apply", serveRequest{Chart: "-f"}},
+		"option as set":           {"template", serveRequest{Set: map[string]string{"--ankhconfig": "x"}}},
+		"option as only":          {"apply", serveRequest{Only: []string{"-o"}}},
+	} {
+		if _, err := serveArgs(ctx, test.operation, test.req); err == nil {
+			t.Logf("%v: expected to find an error but didnt get one", name)
+			t.Fail()
+		}
+	}
+
+	for addr, expected := range map[string]bool{
+		"127.0.0.1:8086": true,
+		"localhost:80":   true,
+		"[::1]:8086":     true,
+		":8086":          false,
+		"0.0.0.0:8086":   false,
+		"10.1.2.3:8086":  false,
+	} {
+		if isLoopback(addr) != expected {
+			t.Logf("expected isLoopback(%v) to be %v", addr, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestServeRejectsRequests(t *testing.T) {
+	s := &server{ctx: &ankh.ExecutionContext{Logger: logrus.New()}, token: "secret", loopback: true}
+	for name, test := range map[string]struct {
+		host     string
+		headers  map[string]string
+		expected int
+	}{
+		"no token":          {"127.0.0.1:8086", map[string]string{"Content-Type": "application/json"}, http.StatusUnauthorized},
+		"wrong token":       {"127.0.0.1:8086", map[string]string{"Content-Type": "application/json", "Authorization": "Bearer nope"}, http.StatusUnauthorized},
+		"no content type":   {"127.0.0.1:8086", map[string]string{"Authorization": "Bearer secret"}, http.StatusUnsupportedMediaType},
+		"form content type": {"localhost", map[string]string{"Content-Type": "text/plain", "Authorization": "Bearer secret"}, http.StatusUnsupportedMediaType},
+		"origin":            {"127.0.0.1:8086", map[string]string{"Content-Type": "application/json", "Authorization": "Bearer secret", "Origin": "http://localhost"}, http.StatusForbidden},
+		"rebound host":      {"evil.example.com:8086", map[string]string{"Content-Type": "application/json", "Authorization": "Bearer secret"}, http.StatusForbidden},
+		// An unknown operation is only found after a request is admitted.
+		"admitted":      {"[::1]:8086", map[string]string{"Content-Type": "application/json; charset=utf-8", "Authorization": "Bearer secret"}, http.StatusNotFound},
+		"admitted host": {"localhost:8086", map[string]string{"Content-Type": "application/json", "Authorization": "Bearer secret"}, http.StatusNotFound},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/destroy", strings.NewReader("{}"))
+		r.Host = test.host
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.handleOperation(w, r)
+		if w.Code != test.expected {
+			t.Logf("%v: expected status %v but got %v: %v", name, test.expected, w.Code, w.Body.String())
+			t.Fail()
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/operations", nil)
+	r.Host = "127.0.0.1:8086"
+	w := httptest.NewRecorder()
+	s.handleOperations(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Logf("expected listing operations without a token to be unauthorized but got %v", w.Code)
+		t.Fail()
+	}
+}
+
+func TestDriftWatcher(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), AnkhConfigPath: "/ankh/config", KubeConfigPath: "/kube/config",
+		AuditLogPath: "/ankh/data/audit.log"}
+
+	target := ankh.DriftTarget{AnkhFile: "web.yaml", Environment: "production"}
+	args := strings.Join(driftArgs(ctx, target, "/tmp/out.json"), " ")
+	expected := "--ankhconfig /ankh/config --kubeconfig /kube/config --datadir /ankh/data --environment production " +
+		"drift -f web.yaml --output /tmp/out.json"
+	if args != expected {
+		t.Logf("expected args '%v' but got '%v'", expected, args)
+		t.Fail()
+	}
+
+	notifications := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Text string `json:"text"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		notifications = append(notifications, body.Text)
+	}))
+	defer server.Close()
+
+	w := &driftWatcher{ctx: ctx, webhookURL: server.URL, results: make(map[string]driftResult), notified: make(map[string][]string)}
+	drifted := driftResult{Target: target, Reports: []driftReport{{Context: "prod", Namespace: "team", Objects: []string{"Deployment/web"}}}}
+	for _, result := range []driftResult{{Target: target}, drifted, drifted, {Target: target}} {
+		w.notify(result)
+	}
+	expectedNotifications := []string{
+		"Found drift for web.yaml in environment production: prod/team/Deployment/web",
+		"Drift resolved for web.yaml in environment production",
+	}
+	if !reflect.DeepEqual(notifications, expectedNotifications) {
+		t.Logf("expected notifications %v but got %v", expectedNotifications, notifications)
+		t.Fail()
+	}
+
+	w.results["web"] = drifted
+	w.results["api"] = driftResult{Target: ankh.DriftTarget{AnkhFile: "api.yaml"}, Err: fmt.Errorf("boom")}
+	metrics := w.metrics()
+	for _, line := range []string{
+		`ankh_drift_objects{ankh_file="web.yaml",context="",environment="production"} 1`,
+		`ankh_drift_check_success{ankh_file="api.yaml",context="",environment=""} 0`,
+		`ankh_drift_check_success{ankh_file="web.yaml",context="",environment="production"} 1`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Logf("expected metrics to contain '%v' but got:\n%v", line, metrics)
+			t.Fail()
+		}
+	}
+	if strings.Contains(metrics, `ankh_drift_objects{ankh_file="api.yaml"`) {
+		t.Logf("expected no drift count for a failed check but got:\n%v", metrics)
+		t.Fail()
+	}
+}
+
+func TestCheckBinaries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-bin")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+	missingBinaries = make(map[string]bool)
+	defer func() { missingBinaries = make(map[string]bool) }()
+
+	if !binaryMissing("helm") || binaryMissing("kubectl") {
+		t.Logf("expected only helm to be missing but got %v", missingBinaries)
+		t.Fail()
+	}
+
+	manifests := ankh.AnkhFile{Charts: []ankh.Chart{{Name: "web", Manifests: []string{"web.yaml"}}}}
+	if !onlyManifests(manifests) {
+		t.Logf("expected %+v to be only manifests", manifests)
+		t.Fail()
+	}
+	for _, ankhFile := range []ankh.AnkhFile{
+		{Charts: []ankh.Chart{{Name: "web", Manifests: []string{"web.yaml"}}, {Name: "api"}}},
+		{Charts: manifests.Charts, Dependencies: []string{"other.yaml"}},
+	} {
+		if onlyManifests(ankhFile) {
+			t.Logf("expected %+v to need helm", ankhFile)
+			t.Fail()
+		}
+	}
+
+	// Neither of these need helm, so they shouldn't exit.
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply}
+	checkModeBinaries(ctx, manifests)
+	ctx.Mode = ankh.Explain
+	checkModeBinaries(ctx, ankh.AnkhFile{Charts: []ankh.Chart{{Name: "api"}}})
+}
+
+func TestCIOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-ci")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), AnkhFilePath: "ankh.yaml"}
+	ctx.AnkhConfig.CurrentContextName = "staging"
+	recordLintResult(ctx, ankh.AnkhFile{Path: "ankh.yaml"}, []ankh.Chart{{Name: "web"}}, "team", "", []error{
+		fmt.Errorf("Deployment 'web' is missing a release label"),
+		fmt.Errorf("Service 'web' is <wrong>"),
+	}, nil)
+	recordLintResult(ctx, ankh.AnkhFile{Path: "ankh.yaml"}, []ankh.Chart{{Name: "api"}, {Name: "worker"}}, "other", "", []error{}, nil)
+	if count := lintErrors(ctx); count != 2 {
+		t.Logf("expected 2 lint errors but got %v", count)
+		t.Fail()
+	}
+
+	resultsPath, junitPath := filepath.Join(dir, "results.json"), filepath.Join(dir, "lint.xml")
+	writeCIOutputs(ctx, exitLintFailed, resultsPath, junitPath)
+
+	junit, err := ioutil.ReadFile(junitPath)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	for _, expected := range []string{
+		`<testsuite name="ankh lint" tests="2" failures="1">`,
+		`<testcase classname="staging.team" name="web">`,
+		`<failure message="Lint found 2 errors">Deployment &#39;web&#39; is missing a release label&#xA;Service &#39;web&#39; is &lt;wrong&gt;</failure>`,
+		`<testcase classname="staging.other" name="api,worker"></testcase>`,
+	} {
+		if !strings.Contains(string(junit), expected) {
+			t.Logf("expected JUnit output to contain '%v' but got:\n%s", expected, junit)
+			t.Fail()
+		}
+	}
+
+	body, err := ioutil.ReadFile(resultsPath)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	result := ciResult{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if result.Status != "lint-failed" || result.ExitCode != exitLintFailed || result.Context != "staging" ||
+		len(result.LintResults) != 2 || result.ApplySummaries == nil {
+		t.Logf("unexpected results %+v", result)
+		t.Fail()
+	}
+}
+
+func TestLintOutput(t *testing.T) {
+	helmOutput := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+# Source: config/manifests/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+`
+	charts := []ankh.Chart{{Name: "web", Path: "charts/web"}, {Name: "config", Manifests: []string{"config/manifests"}}}
+	findings := lintFindings(charts, helmOutput, []error{
+		ankh.NewObjectError("release-label", "Deployment", "web", "Deployment 'web' is missing a release label"),
+		ankh.NewObjectError("schema", "ConfigMap", "web", "ConfigMap 'web' does not match the schema"),
+		fmt.Errorf("Failed to evaluate policies"),
+	})
+	expected := []ankh.LintFinding{
+		{Rule: "release-label", Chart: "web", File: "charts/web/templates/deployment.yaml", Kind: "Deployment", Name: "web",
+			Message: "Deployment 'web' is missing a release label"},
+		{Rule: "schema", Chart: "config", File: "config/manifests/configmap.yaml", Kind: "ConfigMap", Name: "web",
+			Message: "ConfigMap 'web' does not match the schema"},
+		{Rule: "lint", Message: "Failed to evaluate policies"},
+	}
+	if !reflect.DeepEqual(findings, expected) {
+		t.Logf("expected findings %+v but got %+v", expected, findings)
+		t.Fail()
+	}
+
+	results := []ankh.LintResult{{Context: "staging", Namespace: "team", AnkhFile: "ankh.yaml", Charts: []string{"web", "config"}, Findings: findings}}
+	body, err := formatLintResults(results, "sarif")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	sarif := struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+					LogicalLocations []struct {
+						FullyQualifiedName string `json:"fullyQualifiedName"`
+					} `json:"logicalLocations"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}{}
+	if err := json.Unmarshal(body, &sarif); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 3 || len(sarif.Runs[0].Tool.Driver.Rules) != 3 {
+		t.Logf("unexpected SARIF output:\n%s", body)
+		t.FailNow()
+	}
+	first, last := sarif.Runs[0].Results[0], sarif.Runs[0].Results[2]
+	if first.RuleID != "release-label" || first.Locations[0].PhysicalLocation.ArtifactLocation.URI != "charts/web/templates/deployment.yaml" ||
+		first.Locations[0].LogicalLocations[0].FullyQualifiedName != "staging/team/Deployment/web" {
+		t.Logf("unexpected SARIF result %+v", first)
+		t.Fail()
+	}
+	if last.Locations[0].PhysicalLocation.ArtifactLocation.URI != "ankh.yaml" || len(last.Locations[0].LogicalLocations) != 0 {
+		t.Logf("expected a finding about no object to be located in the Ankh file but got %+v", last)
+		t.Fail()
+	}
+
+	if _, err := formatLintResults(results, "xml"); err == nil {
+		t.Logf("expected an error for an invalid format")
+		t.Fail()
+	}
+}
+
+func TestResourcesFormatting(t *testing.T) {
+	if formatBytes(1.5*gibibyte) != "1.5Gi" || formatBytes(768*1<<20) != "768Mi" || formatCores(0.25) != "0.25" {
+		t.Logf("unexpected formatting %v, %v and %v", formatBytes(1.5*gibibyte), formatBytes(768*1<<20), formatCores(0.25))
+		t.Fail()
+	}
+
+	cost := resourcesCost(helm.Resources{CPURequests: 2, CPULimits: 4, MemoryRequests: 4 * gibibyte}, 20, 3)
+	if cost != 52 {
+		t.Logf("expected a cost of 52 but got %v", cost)
+		t.Fail()
+	}
+}
+
+func TestContextViews(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), KubeConfigPath: "../config/testdata/kubeconfig.yaml"}
+	ctx.AnkhConfig.Contexts = map[string]ankh.Context{
+		"prod": {KubeContext: "prod-east", Release: "canary", Source: "/etc/ankh/config"},
+		"dev":  {KubeServer: "https://dev.example.com", Source: "/home/me/.ankh/config"},
+	}
+
+	views := contextViews(ctx)
+	expected := []contextView{
+		{Name: "dev", KubeServer: "https://dev.example.com", Source: "/home/me/.ankh/config"},
+		{Name: "prod", Release: "canary", KubeContext: "prod-east", KubeServer: "https://prod-east.example.com", Source: "/etc/ankh/config"},
+	}
+	if !reflect.DeepEqual(views, expected) {
+		t.Logf("expected %+v but got %+v", expected, views)
+		t.Fail()
+	}
+
+	view, err := configView(ctx)
+	if err != nil {
+		t.Logf("got error %v", err)
+		t.FailNow()
+	}
+	prod := view["contexts"].(map[string]interface{})["prod"].(map[string]interface{})
+	if prod["source"] != "/etc/ankh/config" || prod["kube-server"] != "https://prod-east.example.com" {
+		t.Logf("unexpected context in config view %v", prod)
+		t.Fail()
+	}
+}
+
+func TestFleetStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-fleet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for ankh, answering `status -o json` for each context.
+	self := filepath.Join(dir, "ankh")
+	script := `#!/bin/sh
+case "$*" in
+  *"--context prod "*) echo '[{"context": "prod", "namespace": "web", "chart": "web", "deployedVersion": "1.2.3", "healthy": true, "workloads": [{"kind": "deployment", "name": "web", "found": true, "desired": 3, "ready": 3}]}]';;
+  *"--context staging "*) echo '[{"context": "staging", "namespace": "web", "chart": "web", "deployedVersion": "1.3.0", "healthy": false, "workloads": [{"kind": "deployment", "name": "web", "found": true, "desired": 2, "ready": 1}]}, {"context": "staging", "namespace": "db", "chart": "db", "healthy": true, "workloads": []}]';;
+  *) echo "unreachable" >&2; exit 1;;
+esac
+`
+	if err := ioutil.WriteFile(self, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	report := fleetStatus(ctx, self, []string{"dev", "prod", "staging"}, "/deploys/ankh.yaml", "", 2)
+	if !reflect.DeepEqual(report.Charts, []string{"db", "web"}) || len(report.Statuses) != 3 {
+		t.Logf("unexpected report %+v", report)
+		t.FailNow()
+	}
+	if _, ok := report.Errors["dev"]; !ok || len(report.Errors) != 1 {
+		t.Logf("expected an error for context dev but got %v", report.Errors)
+		t.Fail()
+	}
+
+	cells := map[string]string{}
+	for _, status := range report.Statuses {
+		cells[status.Context+"/"+status.Chart] = fleetCell([]chartStatus{status})
+	}
+	expected := map[string]string{"prod/web": "1.2.3 3/3", "staging/web": "1.3.0 1/2 !", "staging/db": "? 0/0"}
+	if !reflect.DeepEqual(cells, expected) {
+		t.Logf("expected cells %v but got %v", expected, cells)
+		t.Fail()
+	}
+	if fleetCell(nil) != "-" {
+		t.Logf("expected charts missing from a context to be shown as -")
+		t.Fail()
+	}
+}
+
+func TestWaitForPrecondition(t *testing.T) {
+	defer func(interval time.Duration) { preconditionInterval = interval }(preconditionInterval)
+	preconditionInterval = 10 * time.Millisecond
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	address := strings.TrimPrefix(server.URL, "http://")
+	for _, precondition := range []ankh.Precondition{{DNS: "localhost"}, {TCP: address}} {
+		if err := waitForPrecondition(ctx, precondition); err != nil {
+			t.Logf("expected %+v to be met but got %v", precondition, err)
+			t.Fail()
+		}
+	}
+
+	server.Close()
+	if err := waitForPrecondition(ctx, ankh.Precondition{TCP: address, Timeout: "50ms"}); err == nil {
+		t.Logf("expected tcp %v to time out once the server is closed", address)
+		t.Fail()
+	}
+
+	for _, precondition := range []ankh.Precondition{{}, {DNS: "a", TCP: "b:1"}, {TCP: "no-port"}, {Deployment: "web"}, {DNS: "a", Timeout: "soon"}} {
+		if err := waitForPrecondition(ctx, precondition); err == nil {
+			t.Logf("expected %+v to be invalid", precondition)
+			t.Fail()
+		}
+	}
+}
+
+func TestFormatChartStatuses(t *testing.T) {
+	statuses := []chartStatus{
+		{Context: "prod", Namespace: "web", Chart: "web", DeployedVersion: "1.2.3", Healthy: true,
+			Workloads: []kubectl.WorkloadStatus{{Kind: "deployment", Name: "web", Found: true, Desired: 3, Ready: 3}}},
+		{Context: "prod", Namespace: "db", Chart: "db", Workloads: []kubectl.WorkloadStatus{}},
+	}
+
+	out, err := formatChartStatuses(statuses, `jsonpath={range .items[*]}{.chart}={.deployedVersion}{"\n"}{end}`)
+	if err != nil || out != "web=1.2.3\ndb=\n" {
+		t.Logf("unexpected jsonpath output '%v' (%v)", out, err)
+		t.Fail()
+	}
+
+	out, err = formatChartStatuses(statuses, "custom-columns=CHART:.chart,READY:.workloads[*].ready")
+	expected := "CHART   READY\nweb     3\ndb      <none>\n"
+	if err != nil || out != expected {
+		t.Logf("expected\n%v\nbut got\n%v (%v)", expected, out, err)
+		t.Fail()
+	}
+}
+
+func TestAuthenticateContexts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-auth")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for kubectl, recording how it was run.
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$*\" >> " + calls + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer delete(missingBinaries, "kubectl")
+	missingBinaries["kubectl"] = false
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply, KubeConfigPath: "../config/testdata/kubeconfig.yaml"}
+	ctx.AnkhConfig.Contexts = map[string]ankh.Context{
+		"dev":  {KubeContext: "minikube", EnvironmentClass: "dev", ResourceProfile: "natural"},
+		"prod": {KubeContext: "prod-east", EnvironmentClass: "production", ResourceProfile: "natural"},
+	}
+	authenticateContexts(ctx, []string{"dev", "prod"})
+
+	body, _ := ioutil.ReadFile(calls)
+	expected := "get --raw /version --context prod-east --kubeconfig ../config/testdata/kubeconfig.yaml\n"
+	if string(body) != expected {
+		t.Logf("expected kubectl to authenticate only to prod-east, but it ran with '%v'", string(body))
+		t.Fail()
+	}
+}
+
+func TestOnlyChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-only-changed")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for `kubectl diff`, printing the diff file and exiting with the
+	// status in the status file: 1 when objects differ, and greater when it fails.
+	// It fails with `--dry-run`, which `kubectl diff` doesn't take.
+	diffPath, statusPath := filepath.Join(dir, "diff"), filepath.Join(dir, "status")
+	script := "#!/bin/sh\ncase \"$*\" in *--dry-run*) exit 2 ;; esac\ncat >/dev/null\ncat " + diffPath + "\nexit $(cat " + statusPath + ")\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	helmOutput := "kind: Deployment\nmetadata:\n  name: web\n" +
+		"---\nkind: ConfigMap\nmetadata:\n  name: web\n  namespace: shared\n" +
+		"---\nkind: ConfigMap\nmetadata:\n  name: web\n" +
+		"---\nkind: Service\nmetadata:\n  name: web\n"
+	everything := []string{"configmap/shared/web", "configmap/team/web", "deployment/team/web", "service/team/web"}
+	for _, test := range []struct {
+		name     string
+		diff     string
+		status   string
+		expected []string
+		warns    bool
+	}{
+		{"own namespace", "diff -u -N /tmp/LIVE-1/v1.ConfigMap.shared.web /tmp/MERGED-1/v1.ConfigMap.shared.web\n", "1",
+			[]string{"configmap/shared/web"}, false},
+		{"release namespace", "diff -u -N /tmp/LIVE-1/apps.v1.Deployment.team.web /tmp/MERGED-1/apps.v1.Deployment.team.web\n", "1",
+			[]string{"deployment/team/web"}, false},
+		{"same name in another namespace", "diff -u -N /tmp/LIVE-1/v1.ConfigMap.team.web /tmp/MERGED-1/v1.ConfigMap.team.web\n", "1",
+			[]string{"configmap/team/web"}, false},
+		{"unchanged", "", "0", []string{}, false},
+		{"external diff", "--- live\n+++ merged\n", "1", everything, true},
+		{"failed diff", "", "2", everything, true},
+	} {
+		if err := ioutil.WriteFile(diffPath, []byte(test.diff), 0644); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		if err := ioutil.WriteFile(statusPath, []byte(test.status), 0644); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		var logs bytes.Buffer
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply, DryRun: true}
+		ctx.Logger.Out = &logs
+		objects := []string{}
+		for object := range kubectl.ObjectDocuments(onlyChanged(ctx, "team", helmOutput), "team") {
+			objects = append(objects, object)
+		}
+		sort.Strings(objects)
+		if !reflect.DeepEqual(objects, test.expected) {
+			t.Logf("%v: expected to apply %v but got %v", test.name, test.expected, objects)
+			t.Fail()
+		}
+		if warned := strings.Contains(logs.String(), "level=warning"); warned != test.warns {
+			t.Logf("%v: expected a warning to be logged: %v, but got logs '%v'", test.name, test.warns, logs.String())
+			t.Fail()
+		}
+	}
+}
+
+func TestSelectPortForwardTarget(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), NoPrompt: true}
+	targets := []kubectl.PortForwardTarget{
+		{Resource: "service/web", Ports: []int{80}},
+		{Resource: "deployment/web", Ports: []int{8080}},
+	}
+	for service, expected := range map[string]string{"web": "service/web", "deployment/web": "deployment/web"} {
+		target, err := selectPortForwardTarget(ctx, targets, service)
+		if err != nil || target.Resource != expected {
+			t.Logf("expected --service %v to select %v but got %v (%v)", service, expected, target.Resource, err)
+			t.Fail()
+		}
+	}
+	if _, err := selectPortForwardTarget(ctx, targets, ""); err == nil {
+		t.Logf("expected an error when there's more than one target and no prompting")
+		t.Fail()
+	}
+	if _, err := selectPortForwardTarget(ctx, targets, "db"); err == nil {
+		t.Logf("expected an error for an unknown service")
+		t.Fail()
+	}
+
+	forwards, err := portForwards(targets[0], []string{"9000:80"})
+	if err != nil || !reflect.DeepEqual(forwards, []string{"9000:80"}) {
+		t.Logf("unexpected forwards %v (%v)", forwards, err)
+		t.Fail()
+	}
+	forwards, err = portForwards(targets[0], nil)
+	if err != nil || len(forwards) != 1 || strings.HasPrefix(forwards[0], "80:") || !strings.HasSuffix(forwards[0], ":80") {
+		t.Logf("expected port 80 to be forwarded from a free local port but got %v (%v)", forwards, err)
+		t.Fail()
+	}
+}
+
+func TestTagFormats(t *testing.T) {
+	namespace := "team"
+	ctx := &ankh.ExecutionContext{
+		Logger:        logrus.New(),
+		Mode:          ankh.Apply,
+		NoPrompt:      true,
+		Namespace:     &namespace,
+		HelmSetValues: map[string]string{"tag": "registry/web:1.2.3"},
+		AnkhConfig: ankh.AnkhConfig{
+			Helm:   ankh.HelmConfig{TagValueName: "tag"},
+			Docker: ankh.DockerConfig{Registry: "registry"},
+		},
+	}
+	ankhFile := ankh.AnkhFile{Charts: []ankh.Chart{
+		{Name: "web", Manifests: []string{"."}},
+		{Name: "worker", Manifests: []string{"."}, TagFormat: "ref"},
+		{Name: "api", Manifests: []string{"."}, TagFormat: "ref", Image: "other/api"},
+	}}
+	if err := promptForChartVersionsAndTagValues(ctx, &ankhFile); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	tags := []string{}
+	for _, chart := range ankhFile.Charts {
+		tags = append(tags, chart.Tag)
+	}
+	if expected := []string{"1.2.3", "registry/web:1.2.3", "registry/web:1.2.3"}; !reflect.DeepEqual(tags, expected) {
+		t.Logf("expected tags %v but got %v", expected, tags)
+		t.Fail()
+	}
+
+	ctx.HelmSetValues["tag"] = "1.2.3"
+	ankhFile.Charts[2].Tag = ""
+	if err := promptForChartVersionsAndTagValues(ctx, &ankhFile); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if ankhFile.Charts[2].Tag != "other/api:1.2.3" {
+		t.Logf("expected tag 'other/api:1.2.3' but got '%v'", ankhFile.Charts[2].Tag)
+		t.Fail()
+	}
+
+	ankhFile = ankh.AnkhFile{Charts: []ankh.Chart{{Name: "web", Manifests: []string{"."}, TagFormat: "digest"}}}
+	if err := promptForChartVersionsAndTagValues(ctx, &ankhFile); err == nil {
+		t.Log("expected an error for a bare tag where a digest is expected")
+		t.Fail()
+	}
+}
+
+func TestResolveChartNamespaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-namespace")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for `kubectl config view`, with a different namespace on each kube-context.
+	script := "#!/bin/sh\ncase \"$*\" in\n*\"--context east\"*) echo team-east ;;\n*) echo team-west ;;\nesac\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	explicit := "shared"
+	charts := []ankh.Chart{{Name: "web"}, {Name: "db", Namespace: &explicit}}
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply}
+	for _, test := range []struct {
+		kubeContext string
+		expected    []string
+	}{
+		{"east", []string{"team-east", "shared"}},
+		{"west", []string{"team-west", "shared"}},
+	} {
+		ctx.AnkhConfig.CurrentContextName = test.kubeContext
+		ctx.AnkhConfig.CurrentContext = ankh.Context{KubeContext: test.kubeContext, UseKubeContextNamespace: true}
+		resolved, err := resolveChartNamespaces(ctx, charts)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		namespaces := []string{}
+		for _, chart := range resolved {
+			namespaces = append(namespaces, *chart.Namespace)
+		}
+		if !reflect.DeepEqual(namespaces, test.expected) {
+			t.Logf("expected namespaces %v in context %v but got %v", test.expected, test.kubeContext, namespaces)
+			t.Fail()
+		}
+	}
+	if charts[0].Namespace != nil {
+		t.Logf("expected the charts to be left without a namespace for the next context but got %v", *charts[0].Namespace)
+		t.Fail()
+	}
+
+	override := "override"
+	ctx.Namespace = &override
+	if resolved, err := resolveChartNamespaces(ctx, charts); err != nil || resolved[0].Namespace != nil {
+		t.Logf("expected no kube-context namespace with `--namespace`, but got %+v (%v)", resolved, err)
+		t.Fail()
+	}
+}
+
+func TestPinDigests(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+		case "/v2/web/manifests/1.2.3":
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	namespace := "team"
+	ctx := &ankh.ExecutionContext{
+		Logger:        logrus.New(),
+		Mode:          ankh.Apply,
+		NoPrompt:      true,
+		PinDigests:    true,
+		Namespace:     &namespace,
+		HelmSetValues: map[string]string{"tag": "1.2.3"},
+		AnkhConfig: ankh.AnkhConfig{
+			Helm:   ankh.HelmConfig{TagValueName: "tag"},
+			Docker: ankh.DockerConfig{Registry: server.URL},
+		},
+	}
+	registry := strings.TrimPrefix(server.URL, "http://")
+	ankhFile := ankh.AnkhFile{Charts: []ankh.Chart{
+		{Name: "web", Manifests: []string{"."}},
+		{Name: "worker", Manifests: []string{"."}, TagFormat: "ref", Image: registry + "/web"},
+		{Name: "api", Manifests: []string{"."}, TagFormat: "digest", Image: registry + "/web"},
+	}}
+	if err := promptForChartVersionsAndTagValues(ctx, &ankhFile); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	tags := []string{}
+	for _, chart := range ankhFile.Charts {
+		tags = append(tags, chart.Tag)
+		if chart.Digest != digest {
+			t.Logf("expected chart %v to be pinned to %v but got '%v'", chart.Name, digest, chart.Digest)
+			t.Fail()
+		}
+	}
+	if expected := []string{"1.2.3@" + digest, registry + "/web:1.2.3@" + digest, digest}; !reflect.DeepEqual(tags, expected) {
+		t.Logf("expected tags %v but got %v", expected, tags)
+		t.Fail()
+	}
+
+	ctx.HelmSetValues["tag"] = "1.3.0"
+	ankhFile = ankh.AnkhFile{Charts: []ankh.Chart{{Name: "web", Manifests: []string{"."}}}}
+	if err := promptForChartVersionsAndTagValues(ctx, &ankhFile); err == nil || !strings.Contains(err.Error(), "No tag '1.3.0'") {
+		t.Logf("expected an error for a tag that isn't in the registry but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestLatestModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-watch")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, path := range []string{"ankh.yaml", "web/deployment.yaml", ".git/index"} {
+		path = filepath.Join(dir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte{}, 0644)
+		os.Chtimes(path, old, old)
+		os.Chtimes(filepath.Dir(path), old, old)
+	}
+	os.Chtimes(dir, old, old)
+	if latest := latestModTime(dir); !latest.Equal(old) {
+		t.Logf("expected latest modification time %v but got %v", old, latest)
+		t.Fail()
+	}
+
+	changed := time.Now().Add(-time.Minute).Truncate(time.Second)
+	os.Chtimes(filepath.Join(dir, ".git/index"), changed, changed)
+	if latest := latestModTime(dir); !latest.Equal(old) {
+		t.Logf("expected changes under .git to be ignored but got %v", latest)
+		t.Fail()
+	}
+	os.Chtimes(filepath.Join(dir, "web/deployment.yaml"), changed, changed)
+	if latest := latestModTime(dir); !latest.Equal(changed) {
+		t.Logf("expected latest modification time %v but got %v", changed, latest)
+		t.Fail()
+	}
+}
+
+func TestFluxHelmRelease(t *testing.T) {
+	release := fluxRelease{Context: "prod", Registry: "https://charts.example.com", Release: "web-prod", Namespace: "team",
+		Chart: "web", Version: "1.2.3", Values: map[string]interface{}{"tag": "1.2.3"}}
+	out, err := yaml.Marshal(fluxHelmRelease(release, "flux-system", "10m"))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: web
+  namespace: team
+spec:
+  interval: 10m
+  releaseName: web-prod
+  chart:
+    spec:
+      chart: web
+      version: 1.2.3
+      sourceRef:
+        kind: HelmRepository
+        name: ankh
+        namespace: flux-system
+  values:
+    tag: 1.2.3
+`
+	if string(out) != expected {
+		t.Logf("expected HelmRelease:\n%v\nbut got:\n%s", expected, out)
+		t.Fail()
+	}
+
+	release.Release = ""
+	release.Values = map[string]interface{}{}
+	out, _ = yaml.Marshal(fluxHelmRelease(release, "flux-system", "10m"))
+	if strings.Contains(string(out), "releaseName") || strings.Contains(string(out), "values") {
+		t.Logf("expected no releaseName or values but got:\n%s", out)
+		t.Fail()
+	}
+}
+
+func TestGitHubDeployment(t *testing.T) {
+	requests := []string{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, fmt.Sprintf("%v %v %v %v", r.URL.Path, r.Header.Get("Authorization"), body["environment"], body["state"]))
+		w.WriteHeader(http.StatusCreated)
+		if r.URL.Path == "/repos/appnexus/web/deployments" {
+			fmt.Fprintf(w, `{"id": 1, "environment": "prod", "statuses_url": "%v/repos/appnexus/web/deployments/1/statuses"}`, server.URL)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("ANKH_TEST_GITHUB_TOKEN", "secret")
+	defer os.Unsetenv("ANKH_TEST_GITHUB_TOKEN")
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply, Actor: "alice"}
+	ctx.AnkhConfig.CurrentContextName = "prod"
+	ctx.AnkhConfig.GitHub = ankh.GitHubConfig{Repo: "appnexus/web", TokenEnv: "ANKH_TEST_GITHUB_TOKEN", APIURL: server.URL, Ref: "master"}
+
+	applied := false
+	withGitHubDeployment(ctx, func() { applied = true })
+	expected := []string{
+		"/repos/appnexus/web/deployments token secret prod <nil>",
+		"/repos/appnexus/web/deployments/1/statuses token secret prod in_progress",
+		"/repos/appnexus/web/deployments/1/statuses token secret prod success",
+	}
+	if !applied || !reflect.DeepEqual(requests, expected) {
+		t.Logf("expected to apply with requests %v but got %v, %v", expected, applied, requests)
+		t.Fail()
+	}
+
+	requests = []string{}
+	ctx.DryRun = true
+	withGitHubDeployment(ctx, func() {})
+	if len(requests) != 0 {
+		t.Logf("expected no requests for a dry run but got %v", requests)
+		t.Fail()
+	}
+}
+
+func TestFormatDiffComment(t *testing.T) {
+	sections := []diffSection{
+		{Context: "prod", Namespace: "team", Diff: "-  replicas: 1\n+  replicas: 2\n"},
+		{Context: "prod", Namespace: "other", Diff: ""},
+		{Context: "staging", Namespace: "team", Diff: strings.Repeat("+  line\n", 1000)},
+	}
+	comment := formatDiffComment("ankh.yaml", sections, 2000)
+	if len(comment) > 2000 {
+		t.Logf("expected a comment of at most 2000 bytes but got %v", len(comment))
+		t.Fail()
+	}
+	for _, expected := range []string{
+		"<summary>Context <code>prod</code>, namespace <code>team</code>: 2 lines</summary>",
+		"+  replicas: 2\n```\n</details>",
+		"<summary>Context <code>staging</code>, namespace <code>team</code>: 1000 lines</summary>",
+		"more lines were cut",
+	} {
+		if !strings.Contains(comment, expected) {
+			t.Logf("expected comment to contain '%v' but got:\n%v", expected, comment)
+			t.Fail()
+		}
+	}
+	if strings.Contains(comment, "namespace <code>other</code>") {
+		t.Logf("expected no section for a namespace without differences but got:\n%v", comment)
+		t.Fail()
+	}
+
+	if comment := formatDiffComment("ankh.yaml", sections[1:2], 2000); !strings.Contains(comment, "No differences") {
+		t.Logf("expected a comment saying there are no differences but got:\n%v", comment)
+		t.Fail()
+	}
+}
+
+func TestNoteDiffPostComment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-diff-comment")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	// `kubectl diff` exits 1 when it finds a difference.
+	fakeKubectl(t, dir, "echo '+  replicas: 3'\nexit 1")
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer func() { diffSections, diffFoundChanges = []diffSection{}, false }()
+
+	ctx := &ankh.ExecutionContext{Logger: log, Mode: ankh.Diff, Options: ankh.CommandOptions{DiffPostComment: true}}
+	ctx.AnkhConfig.CurrentContextName = "prod"
+	out, differs, err := kubectl.DiffStream(ctx, strings.NewReader("kind: Deployment\nmetadata:\n  name: web\n"), "team", nil)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	noteDiff(ctx, "team", out, differs)
+
+	expected := []diffSection{{Context: "prod", Namespace: "team", Diff: "+  replicas: 3\n"}}
+	if !reflect.DeepEqual(diffSections, expected) || !diffFoundChanges {
+		t.Logf("expected the diff to be recorded as %v but got %v (changes found: %v)", expected, diffSections, diffFoundChanges)
+		t.Fail()
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Mode: ankh.Apply}
+	ctx.AnkhConfig.CurrentContextName = "prod"
+	charts := []ankh.Chart{{Name: "web", Version: "1.2.3", Tag: "abc"}, {Name: "api"}}
+	defer func() {
+		chartOutcomes = []chartOutcome{}
+		runSummaryFormat = ""
+	}()
+
+	startChartOutcomes(ctx, charts, "team")
+	countChartObjects(ctx, "team", "---\n# Source: web/templates/a.yaml\nkind: Service\nmetadata:\n  name: a\n"+
+		"---\n# Source: web/templates/b.yaml\nkind: Deployment\nmetadata:\n  name: b\n"+
+		"---\n# Source: api/templates/c.yaml\nkind: Deployment\nmetadata:\n  name: c\n")
+	recordChartOutcome(ctx, "team", ankh.ApplySummary{Chart: "web", Created: 1, Configured: 1})
+	finishChartOutcomes(ctx, charts[:1], "team", "applied")
+
+	runSummaryFormat = "json"
+	var out strings.Builder
+	writeRunSummary(ctx, &out)
+
+	outcomes := []chartOutcome{}
+	if err := json.Unmarshal([]byte(out.String()), &outcomes); err != nil {
+		t.Logf("expected a JSON summary but got '%v': %v", out.String(), err)
+		t.FailNow()
+	}
+	expected := []chartOutcome{
+		{Context: "prod", Namespace: "team", Chart: "web", Version: "1.2.3", Tag: "abc", Action: "applied", Created: 1, Configured: 1, Duration: "0s"},
+		{Context: "prod", Namespace: "team", Chart: "api", Action: "failed", Failed: 1, Duration: "0s"},
+	}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Logf("expected %+v but got %+v", expected, outcomes)
+		t.Fail()
+	}
+
+	out.Reset()
+	writeRunSummary(ctx, &out)
+	if out.Len() != 0 {
+		t.Logf("expected the summary to only be written once but got '%v'", out.String())
+		t.Fail()
+	}
+}
+
+func TestFinalExitCode(t *testing.T) {
+	defer func() {
+		exitZeroOnWarn = false
+		appliedEnvironmentContexts = 0
+	}()
+	cases := []struct {
+		zeroOnWarn bool
+		applied    int
+		code       int
+		expected   int
+	}{
+		{false, 0, exitDiffChanges, exitDiffChanges},
+		{true, 0, exitDiffChanges, 0},
+		{true, 0, exitDrift, 0},
+		{true, 0, exitApplyFailed, exitApplyFailed},
+		{false, 1, exitApplyFailed, exitPartialEnvironment},
+		{false, 1, exitDrift, exitDrift},
+		{false, 1, 0, 0},
+	}
+	for _, c := range cases {
+		exitZeroOnWarn = c.zeroOnWarn
+		appliedEnvironmentContexts = c.applied
+		if code := finalExitCode(c.code); code != c.expected {
+			t.Logf("expected %v for %+v but got %v", c.expected, c, code)
+			t.Fail()
+		}
+	}
+}
+
+func TestInterruptedExitCode(t *testing.T) {
+	if code := interruptedExitCode(syscall.SIGINT); code != 130 {
+		t.Logf("expected 130 for SIGINT but got %v", code)
+		t.Fail()
+	}
+	if code := interruptedExitCode(syscall.SIGTERM); code != 143 {
+		t.Logf("expected 143 for SIGTERM but got %v", code)
+		t.Fail()
+	}
+}
+
+func TestFrozenContextExitCode(t *testing.T) {
+	// exit ends the process, so the frozen context is checked in a copy of
+	// the test binary.
+	if os.Getenv("ANKH_TEST_FROZEN_CONTEXT") != "" {
+		ctx := &ankh.ExecutionContext{Logger: log, Mode: ankh.Apply}
+		ctx.AnkhConfig.Contexts = map[string]ankh.Context{
+			"production": {FreezeWindows: []ankh.FreezeWindow{{Name: "always", Start: "2000-01-01T00:00:00Z", End: "2100-01-01T00:00:00Z"}}},
+		}
+		checkFreezeWindows(ctx, []string{"production"})
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestFrozenContextExitCode$")
+	cmd.Env = append(os.Environ(), "ANKH_TEST_FROZEN_CONTEXT=true")
+	out, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != exitConfigError {
+		t.Logf("expected a frozen context to exit with %v but got %v: %s", exitConfigError, err, out)
+		t.Fail()
+	}
+	if !strings.Contains(string(out), "frozen by freeze window 'always'") {
+		t.Logf("expected the freeze window to be logged but got %s", out)
+		t.Fail()
+	}
+}
+
+func TestRestartTimeoutExitCode(t *testing.T) {
+	// exit ends the process, so the timeout is checked in a copy of the test
+	// binary.
+	if os.Getenv("ANKH_TEST_RESTART_TIMEOUT") != "" {
+		checkRestartTimeout("5 minutes")
+		return
+	}
+
+	checkRestartTimeout("90s")
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestRestartTimeoutExitCode$")
+	cmd.Env = append(os.Environ(), "ANKH_TEST_RESTART_TIMEOUT=true")
+	out, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != exitConfigError {
+		t.Logf("expected a bad `--timeout` to exit with %v but got %v: %s", exitConfigError, err, out)
+		t.Fail()
+	}
+	if !strings.Contains(string(out), "Invalid `--timeout` '5 minutes'") {
+		t.Logf("expected the bad timeout to be logged but got %s", out)
+		t.Fail()
+	}
+}
+
+func TestDiffChangesExitCode(t *testing.T) {
+	// exit ends the process, so the diff is run in a copy of the test binary,
+	// with a kubectl that finds a difference, which `kubectl diff` exits 1 for.
+	if dir := os.Getenv("ANKH_TEST_DIFF_CHANGES"); dir != "" {
+		fakeKubectl(t, dir, "echo '-  replicas: 2'\necho '+  replicas: 3'\nexit 1")
+		os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		ctx := &ankh.ExecutionContext{Logger: log, Mode: ankh.Diff}
+		out, differs, err := kubectl.DiffStream(ctx, strings.NewReader("kind: Deployment\nmetadata:\n  name: web\n"), "team", nil)
+		check(err)
+		noteDiff(ctx, "team", out, differs)
+		finishDiff(ctx, vcs.PullRequest{})
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "ankh-diff")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestDiffChangesExitCode$")
+	cmd.Env = append(os.Environ(), "ANKH_TEST_DIFF_CHANGES="+dir)
+	out, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != exitDiffChanges {
+		t.Logf("expected a diff with changes to exit with %v but got %v: %s", exitDiffChanges, err, out)
+		t.Fail()
+	}
+	calls := readCalls(filepath.Join(dir, "calls"))
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "diff -f - ") {
+		t.Logf("expected one `kubectl diff` but got %v", calls)
+		t.Fail()
+	}
+}
+
+func TestExecuteWorkspaceRelativePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-workspace")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	for path, body := range map[string]string{
+		"ws/team.yaml":  "ankhFiles:\n  - ../svc/ankh.yaml\n",
+		"svc/ankh.yaml": "charts:\n  - name: web\n    path: ./web\n",
+		"svc/web/.keep": "",
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	workspace, err := ankh.ParseWorkspace("./ws/team.yaml")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	ctx := &ankh.ExecutionContext{Logger: log, Workspace: &workspace}
+	charts := []string{}
+	executeWorkspace(ctx, func(ctx *ankh.ExecutionContext) {
+		// The Ankh file is read after changing to its directory.
+		ankhFile, err := ankh.GetAnkhFile(ctx)
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			return
+		}
+		for _, chart := range ankhFile.Charts {
+			if _, err := os.Stat(chart.Path); err != nil {
+				t.Logf("expected the chart path to be relative to the Ankh file: %v", err)
+				t.Fail()
+			}
+			charts = append(charts, chart.Name)
+		}
+	})
+	if !reflect.DeepEqual(charts, []string{"web"}) {
+		t.Logf("expected to run the workspace's Ankh file but got charts %v", charts)
+		t.Fail()
+	}
+}
+
+func TestFatalfHasExitCode(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		body, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		// Fatalf exits with 1, so failures go through fatalf with their exit code instead.
+		if regexp.MustCompile(`\.Fatalf?\(`).Match(body) {
+			t.Logf("expected %v to exit with fatalf or checkWith instead of Fatalf", name)
+			t.Fail()
+		}
+	}
+}
+
+func TestVerifyImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/", "/v2/web/manifests/1.2.3", "/v2/api/manifests/2.0.0":
+			w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("ab", 32))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	ctx := &ankh.ExecutionContext{
+		Logger: logrus.New(),
+		AnkhConfig: ankh.AnkhConfig{
+			Helm:           ankh.HelmConfig{TagValueName: "tag"},
+			Docker:         ankh.DockerConfig{Registry: "http://registry.invalid"},
+			CurrentContext: ankh.Context{DockerRegistry: server.URL},
+		},
+	}
+	charts := []ankh.Chart{
+		{Name: "web", Tag: "1.2.3"},
+		{Name: "worker", Tag: "2.0.0", TagImage: "api"},
+		{Name: "pinned", Tag: "1.0.0@sha256:" + strings.Repeat("cd", 32)},
+		{Name: "unset", Tag: unsetTagValue},
+	}
+	if err := verifyImages(ctx, charts); err != nil {
+		t.Logf("expected every tag to be found in the context's registry but got %v", err)
+		t.Fail()
+	}
+
+	charts = append(charts, ankh.Chart{Name: "web", Tag: "1.2.4"})
+	err := verifyImages(ctx, charts)
+	if err == nil || !strings.Contains(err.Error(), "No tag '1.2.4' of image 'web'") || !strings.Contains(err.Error(), "--skip-image-check") {
+		t.Logf("expected an error for a tag that isn't in the registry but got %v", err)
+		t.Fail()
+	}
+
+	ctx.Options.SkipImageCheck = true
+	if err := verifyImages(ctx, charts); err != nil {
+		t.Logf("expected no check with SkipImageCheck but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestSkipScanIsAudited(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	ctx := &ankh.ExecutionContext{
+		Logger:       logrus.New(),
+		Mode:         ankh.Apply,
+		Options:      ankh.CommandOptions{SkipScan: "hotfix for INC-42"},
+		AuditLogPath: filepath.Join(dir, "audit.log"),
+		AnkhConfig:   ankh.AnkhConfig{Scan: ankh.ScanConfig{Enabled: true}},
+	}
+	if vulnerable := scanImages(ctx, "team", ""); len(vulnerable) != 0 {
+		t.Logf("expected no scan with --skip-scan but got %v", vulnerable)
+		t.Fail()
+	}
+	audit, _ := ioutil.ReadFile(ctx.AuditLogPath)
+	if !strings.Contains(string(audit), `Skipped scanning images for vulnerabilities in namespace \"team\": hotfix for INC-42`) {
+		t.Logf("expected the skipped scan in the audit log but got %s", audit)
+		t.Fail()
+	}
+}
+
+// TestGlobalOptionsInSpec checks that every global option declared in main is
+// in the app's spec, without which mow.cli rejects it as incorrect usage.
+func TestGlobalOptionsInSpec(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	spec := ""
+	names := []string{}
+	optionName := func(call *ast.CallExpr) string {
+		if len(call.Args) == 0 {
+			return ""
+		}
+		switch arg := call.Args[0].(type) {
+		case *ast.BasicLit:
+			s, _ := strconv.Unquote(arg.Value)
+			return s
+		case *ast.CompositeLit:
+			for _, elt := range arg.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Name" {
+						if lit, ok := kv.Value.(*ast.BasicLit); ok {
+							s, _ := strconv.Unquote(lit.Value)
+							return s
+						}
+					}
+				}
+			}
+		}
+		return ""
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if sel, ok := n.Lhs[0].(*ast.SelectorExpr); ok && sel.Sel.Name == "Spec" {
+				if x, ok := sel.X.(*ast.Ident); ok && x.Name == "app" {
+					if lit, ok := n.Rhs[0].(*ast.BasicLit); ok {
+						spec, _ = strconv.Unquote(lit.Value)
+					}
+				}
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "app" {
+				return true
+			}
+			switch sel.Sel.Name {
+			case "BoolOpt", "StringOpt", "IntOpt", "StringsOpt", "Bool", "String", "Int", "Strings":
+				if name := optionName(n); name != "" {
+					fields := strings.Fields(name)
+					names = append(names, fields[len(fields)-1])
+				}
+			}
+		}
+		return true
+	})
+
+	if spec == "" || len(names) == 0 {
+		t.Logf("expected to find the app's spec and global options in main.go, but found spec '%v' and options %v", spec, names)
+		t.FailNow()
+	}
+	for _, name := range names {
+		if !regexp.MustCompile(`\[--`+regexp.QuoteMeta(name)+`[]. ]`).MatchString(spec) &&
+			!strings.Contains(spec, "--"+name+" |") && !strings.Contains(spec, "| --"+name+"]") {
+			t.Logf("expected global option --%v in the app's spec: %v", name, spec)
+			t.Fail()
+		}
+	}
+}
+
+func TestPreserveHPAReplicas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-hpa")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// Stands in for `kubectl get`, with no autoscalers in the cluster, and web's live replicas of 5.
+	fakeKubectl(t, dir, "case \"$2\" in horizontalpodautoscalers) echo '{\"items\": []}' ;; "+
+		"*) echo '{\"kind\": \"Deployment\", \"metadata\": {\"name\": \"web\"}, \"spec\": {\"replicas\": 5}}' ;; esac")
+
+	helmOutput := "---\n# Source: web/templates/deployment.yaml\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n" +
+		"---\n# Source: web/templates/hpa.yaml\nkind: HorizontalPodAutoscaler\nmetadata:\n  name: web\n" +
+		"spec:\n  scaleTargetRef:\n    kind: Deployment\n    name: web\n"
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply}
+	for _, test := range []struct {
+		mode     string
+		replicas string
+	}{
+		{"", "replicas: 5"},
+		{"live", "replicas: 5"},
+		{"chart", "replicas: 2"},
+	} {
+		charts := []ankh.Chart{{Name: "web", HPAReplicas: test.mode}}
+		output := preserveHPAReplicas(ctx, charts, "team", helmOutput)
+		if doc := kubectl.ObjectDocuments(output, "team")["deployment/team/web"]; !strings.Contains(doc, test.replicas) {
+			t.Logf("hpa-replicas '%v': expected %v but got:\n%v", test.mode, test.replicas, doc)
+			t.Fail()
+		}
+	}
+}
+
+func TestRestartWorkloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-restart")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for kubectl, recording the arguments of each call.
+	argsPath := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$*\" >>" + argsPath + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	helmOutput := "# Source: web/templates/deployment.yaml\nkind: Deployment\nmetadata:\n  name: web\n" +
+		"---\n# Source: web/templates/service.yaml\nkind: Service\nmetadata:\n  name: web\n"
+	charts := []ankh.Chart{{Name: "web"}}
+	for _, test := range []struct {
+		name     string
+		wait     bool
+		dryRun   bool
+		expected []string
+	}{
+		{"restart", false, false, []string{"rollout restart deployment/web "}},
+		{"wait", true, false, []string{"rollout restart deployment/web ", "rollout status deployment/web --timeout 90s "}},
+		{"dry run", true, true, []string{"rollout restart deployment/web "}},
+	} {
+		os.Remove(argsPath)
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Restart, DryRun: test.dryRun,
+			Options: ankh.CommandOptions{RestartWait: test.wait, RestartTimeout: "90s"}}
+		restartWorkloads(ctx, charts, "team", helmOutput)
+
+		body, _ := ioutil.ReadFile(argsPath)
+		calls := strings.Split(strings.TrimSpace(string(body)), "\n")
+		if len(calls) != len(test.expected) {
+			t.Logf("%v: expected %v kubectl commands but got %v", test.name, len(test.expected), calls)
+			t.Fail()
+			continue
+		}
+		for i, call := range calls {
+			if !strings.HasPrefix(call, test.expected[i]) || !strings.Contains(call, "--namespace team") {
+				t.Logf("%v: expected `kubectl %v... --namespace team` but got `kubectl %v`", test.name, test.expected[i], call)
+				t.Fail()
+			}
+			if strings.Contains(call, "--dry-run") != test.dryRun {
+				t.Logf("%v: expected --dry-run to be passed only on a dry run, but got `kubectl %v`", test.name, call)
+				t.Fail()
+			}
+		}
+	}
+}
+
+// fakeKubectl writes a kubectl to dir, which must be on PATH, that records
+// its arguments in the returned file, and then runs script.
+func fakeKubectl(t *testing.T, dir string, script string) string {
+	calls := filepath.Join(dir, "calls")
+	os.Remove(calls)
+	body := "#!/bin/sh\necho \"$*\" >> " + calls + "\n" + script + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(body), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	return calls
+}
+
+// readCalls returns the sorted commands that fakeKubectl recorded.
+func readCalls(calls string) []string {
+	body, _ := ioutil.ReadFile(calls)
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestWaitForApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-wait")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	workloads := "kind: Deployment\nmetadata:\n  name: web\n---\nkind: Job\nmetadata:\n  name: migrate\n---\n" +
+		"kind: Service\nmetadata:\n  name: web\n"
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply, Options: ankh.CommandOptions{WaitTimeout: time.Minute}}
+	ctx.AnkhConfig.CurrentContext.KubeContext = "dev"
+	for _, test := range []struct {
+		name       string
+		helmOutput string
+		script     string
+		calls      []string
+		err        string
+	}{
+		{"nothing to wait for", "kind: Service\nmetadata:\n  name: web\n", "exit 0", []string{}, ""},
+		{"healthy", workloads, "exit 0", []string{
+			"rollout status deployment/web --timeout 1m0s --context dev --namespace team",
+			"wait --for=condition=complete --timeout 1m0s job/migrate --context dev --namespace team",
+		}, ""},
+		{"unhealthy job", workloads, "case \"$1\" in wait) exit 1 ;; esac", []string{
+			"rollout status deployment/web --timeout 1m0s --context dev --namespace team",
+			"wait --for=condition=complete --timeout 1m0s job/migrate --context dev --namespace team",
+		}, "1 of 2 workload(s) in namespace \"team\" did not become healthy"},
+		{"all unhealthy", workloads, "exit 1", []string{
+			"rollout status deployment/web --timeout 1m0s --context dev --namespace team",
+			"wait --for=condition=complete --timeout 1m0s job/migrate --context dev --namespace team",
+		}, "2 of 2 workload(s) in namespace \"team\" did not become healthy"},
+	} {
+		calls := fakeKubectl(t, dir, test.script)
+		err := waitForApply(ctx, "team", test.helmOutput)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Logf("%v: expected error '%v' but got %v", test.name, test.err, err)
+			t.Fail()
+		}
+		if got := readCalls(calls); !reflect.DeepEqual(got, test.calls) {
+			t.Logf("%v: expected kubectl to be run with %q but got %q", test.name, test.calls, got)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-namespace")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	get := "get namespace team --ignore-not-found -o name --context dev"
+	for _, test := range []struct {
+		name    string
+		script  string
+		dryRun  bool
+		calls   []string
+		audited bool
+	}{
+		{"exists", "[ \"$1\" = get ] && echo namespace/team", false, []string{get}, false},
+		{"exists dry run", "[ \"$1\" = get ] && echo namespace/team", true, []string{get}, false},
+		{"missing dry run", "exit 0", true, []string{get}, false},
+		{"missing", "exit 0", false, []string{"apply -f - --context dev", get}, true},
+	} {
+		auditLogPath := filepath.Join(dir, "audit.log")
+		os.Remove(auditLogPath)
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply, DryRun: test.dryRun, AuditLogPath: auditLogPath}
+		ctx.AnkhConfig.CurrentContext.KubeContext = "dev"
+		calls := fakeKubectl(t, dir, test.script)
+		createNamespace(ctx, "team", "web-team")
+		if got := readCalls(calls); !reflect.DeepEqual(got, test.calls) {
+			t.Logf("%v: expected kubectl to be run with %q but got %q", test.name, test.calls, got)
+			t.Fail()
+		}
+		audit, _ := ioutil.ReadFile(auditLogPath)
+		if audited := strings.Contains(string(audit), "Created namespace"); audited != test.audited {
+			t.Logf("%v: expected audited %v but got audit log '%s'", test.name, test.audited, audit)
+			t.Fail()
+		}
+	}
+}
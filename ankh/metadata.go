@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// mergeStringMaps merges maps, with later maps overriding earlier ones.
+func mergeStringMaps(maps ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// injectCommonMetadata adds the common labels and annotations of the current
+// context and the Ankh file to every object in helmOutput. It's done
+// in every mode, not just apply, so that diff and drift see what apply applies.
+func injectCommonMetadata(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, helmOutput string) (string, error) {
+	labels := mergeStringMaps(ctx.AnkhConfig.CurrentContext.CommonLabels, ankhFile.CommonLabels)
+	annotations := mergeStringMaps(ctx.AnkhConfig.CurrentContext.CommonAnnotations, ankhFile.CommonAnnotations)
+	if len(labels) > 0 || len(annotations) > 0 {
+		ctx.Logger.Debugf("Adding common labels %v and annotations %v", labels, annotations)
+	}
+	return kubectl.InjectMetadata(helmOutput, labels, annotations)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+const defaultMigrationsTimeout = "10m"
+
+func hasMigrations(charts []ankh.Chart) bool {
+	for _, chart := range charts {
+		if chart.Migrations != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// chartMigrations gathers the migration Jobs for a chart, returning them and
+// the chart's templated output without them.
+func chartMigrations(chart ankh.Chart, helmOutput string) (string, string, error) {
+	manifests := []string{}
+	if chart.Migrations.Manifest != "" {
+		body, err := ioutil.ReadFile(chart.Migrations.Manifest)
+		if err != nil {
+			return "", helmOutput, fmt.Errorf("Unable to read migrations manifest '%v': %v", chart.Migrations.Manifest, err)
+		}
+		manifests = append(manifests, string(body))
+	}
+	if chart.Migrations.Hooks {
+		names, hooks, rest := kubectl.SplitMigrations(helmOutput)
+		if len(names) > 0 {
+			manifests = append(manifests, hooks)
+			helmOutput = rest
+		}
+	}
+
+	manifest := strings.Join(manifests, "\n---\n")
+	if len(kubectl.JobNames(manifest)) == 0 {
+		return "", helmOutput, fmt.Errorf("No migration Jobs found. Set `migrations.manifest` to a file of Job manifests, " +
+			"or set `migrations.hooks` and annotate Jobs in the chart with `helm.sh/hook: pre-install,pre-upgrade`")
+	}
+	return manifest, helmOutput, nil
+}
+
+// runMigrations applies each chart's migration Jobs and waits for them to
+// complete, aborting the run on the first failure. It returns the templated
+// output with any migration Jobs removed, since they have already been applied.
+func runMigrations(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) string {
+	if ctx.DryRun {
+		if hasMigrations(charts) {
+			ctx.Logger.Infof("Skipping migrations since this is a dry run")
+		}
+		return helmOutput
+	}
+
+	for _, chart := range charts {
+		if chart.Migrations == nil {
+			continue
+		}
+
+		timeout := chart.Migrations.Timeout
+		if timeout == "" {
+			timeout = defaultMigrationsTimeout
+		}
+
+		manifest, rest, err := chartMigrations(chart, helmOutput)
+		if err == nil {
+			var duration time.Duration
+			duration, err = time.ParseDuration(timeout)
+			if err == nil {
+				ctx.Logger.Infof("Running migrations for chart \"%v\" before applying it", chart.Name)
+				err = kubectl.RunMigrations(ctx, namespace, manifest, duration)
+			}
+		}
+		if err != nil {
+			message := fmt.Sprintf("Migrations failed for chart \"%v\" in namespace \"%v\": %v", chart.Name, namespace, err)
+			if err := ctx.Audit(ankh.AuditEntry{Namespace: namespace, Message: message}); err != nil {
+				ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+			}
+			fatalf(exitApplyFailed, "%v\nNot applying the chart, and aborting the remaining charts.", message)
+		}
+		helmOutput = rest
+	}
+	return helmOutput
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// checkNamespaceOverride finds objects in helmOutput that hard-code a
+// namespace other than the `--namespace` override, which would otherwise end
+// up somewhere other than where they were asked to go. It warns about them,
+// or with `kubectl.namespaceOverride: rewrite`, moves them into namespace.
+func checkNamespaceOverride(ctx *ankh.ExecutionContext, namespace string, helmOutput string) string {
+	foreign := kubectl.ForeignNamespaceObjects(helmOutput, namespace)
+	if len(foreign) == 0 {
+		return helmOutput
+	}
+
+	objects := []string{}
+	for object := range foreign {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+
+	rewrite := ctx.AnkhConfig.Kubectl.NamespaceOverride == ankh.NamespaceOverrideRewrite
+	for _, object := range objects {
+		if rewrite {
+			ctx.Logger.Infof("Rewriting the namespace of %v from \"%v\" to the command-line override namespace \"%v\"",
+				object, foreign[object], namespace)
+		} else {
+			ctx.Logger.Warnf("%v sets namespace \"%v\", which differs from the command-line override namespace \"%v\". "+
+				"Set `kubectl.namespaceOverride: rewrite` in your Ankh config to move it into \"%v\"",
+				object, foreign[object], namespace, namespace)
+		}
+	}
+	if rewrite {
+		return kubectl.RewriteNamespace(helmOutput, namespace)
+	}
+	return helmOutput
+}
+
+// createNamespace creates namespace, with the ownership labels of
+// NamespaceLabels, if it doesn't exist yet.
+func createNamespace(ctx *ankh.ExecutionContext, namespace string, team string) {
+	exists, err := kubectl.NamespaceExists(ctx, namespace)
+	if err != nil {
+		fatalf(exitApplyFailed, "%v", err)
+	}
+	if exists {
+		return
+	}
+	if ctx.DryRun {
+		ctx.Logger.Infof("Would create namespace \"%v\", which doesn't exist (dry run)", namespace)
+		return
+	}
+
+	ctx.Logger.Infof("Creating namespace \"%v\", which doesn't exist", namespace)
+	if err := kubectl.EnsureNamespace(ctx, namespace, kubectl.NamespaceLabels(ctx, team)); err != nil {
+		fatalf(exitApplyFailed, "%v", err)
+	}
+	if err := ctx.Audit(ankh.AuditEntry{Namespace: namespace, Message: "Created namespace"}); err != nil {
+		ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// onlyChanged removes the objects in helmOutput that don't differ from their
+// live state, per `kubectl diff`, so that `apply --only-changed` sends
+// kubectl only what it would change. If the diff fails, or something differs
+// but the diff doesn't say what, eg: because `KUBECTL_EXTERNAL_DIFF` is set,
+// every object is kept.
+func onlyChanged(ctx *ankh.ExecutionContext, namespace string, helmOutput string) string {
+	diff, differs, err := kubectl.Diff(ctx, helmOutput, namespace, nil)
+	if err != nil {
+		ctx.Logger.Warnf("Unable to diff namespace \"%v\", so applying every object: %v", namespace, err)
+		return helmOutput
+	}
+
+	changed := make(map[string]bool)
+	if differs {
+		for _, object := range kubectl.ChangedObjects(diff, helmOutput, namespace) {
+			changed[object] = true
+		}
+		if len(changed) == 0 {
+			ctx.Logger.Warnf("Unable to tell which objects differ in namespace \"%v\" from the output of `kubectl diff`, so applying every object", namespace)
+			return helmOutput
+		}
+	}
+	docs := kubectl.ObjectDocuments(helmOutput, namespace)
+	skipped := []string{}
+	for object := range docs {
+		if !changed[object] {
+			skipped = append(skipped, object)
+		}
+	}
+	sort.Strings(skipped)
+	if len(skipped) == 0 {
+		return helmOutput
+	}
+
+	ctx.Logger.Infof("Skipping %v of %v objects in namespace \"%v\", which are unchanged: [ %v ]",
+		len(skipped), len(docs), namespace, strings.Join(skipped, ", "))
+	return kubectl.WithoutObjects(helmOutput, namespace, skipped)
+}
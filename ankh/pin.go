@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/docker"
+	"github.com/appnexus/ankh/util"
+)
+
+// tagImageRef parses the tag of chart as an image ref, filling in the
+// repository that a bare tag is of: the image it was chosen from at a prompt,
+// if it was, or else the chart's image, or else its name. The repository is
+// relative to the docker registry unless it names another.
+func tagImageRef(chart ankh.Chart) (util.ImageRef, error) {
+	ref, err := util.ParseImageRef(chart.Tag)
+	if err != nil {
+		return ref, err
+	}
+	if ref.Repository == "" {
+		ref.Repository = chart.Name
+		if chart.TagImage != "" && chart.TagImage != chart.Name {
+			ref.Repository = strings.TrimSpace(chart.TagImage)
+		} else if chart.Image != "" {
+			ref.Repository = chart.Image
+		}
+	}
+	return ref, nil
+}
+
+// pinDigest resolves the tag of chart to the digest it points to now, and
+// makes chart.Tag a full image ref with both, so that the chart is passed the
+// digest along with the tag, and the applied image can't change even if the
+// tag is moved.
+func pinDigest(ctx *ankh.ExecutionContext, chart *ankh.Chart) error {
+	ref, err := tagImageRef(*chart)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		// Already pinned.
+		chart.Digest = ref.Digest
+		return nil
+	}
+
+	digest, err := docker.ImageDigest(ctx, ref.Repository, ref.Tag)
+	if err != nil {
+		return err
+	}
+	ref.Digest = digest
+	ctx.Logger.Infof("Pinned tag %v of chart \"%v\" to %v", ref.Tag, chart.Name, digest)
+	chart.Tag, chart.Digest = ref.String(), digest
+	return nil
+}
+
+// verifyImages checks that the chosen tag of each chart exists in the docker
+// registry that the current context's cluster pulls from, so that a mistyped
+// tag fails the apply now rather than as an ImagePullBackOff minutes later.
+func verifyImages(ctx *ankh.ExecutionContext, charts []ankh.Chart) error {
+	if ctx.Options.SkipImageCheck {
+		return nil
+	}
+	if ctx.AnkhConfig.CurrentContext.DockerRegistry == "" && ctx.AnkhConfig.Docker.Registry == "" {
+		ctx.Logger.Debugf("Not checking that image tags exist, since no docker registry is configured")
+		return nil
+	}
+
+	errs := []error{}
+	for _, chart := range charts {
+		// The tag is only passed to charts when there's a tagValueName to pass it as.
+		if chart.Tag == "" || chart.Tag == unsetTagValue || (chart.TagValueName == "" && ctx.AnkhConfig.Helm.TagValueName == "") {
+			continue
+		}
+		ref, err := tagImageRef(chart)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid tag value of chart \"%v\": %v", chart.Name, err))
+			continue
+		}
+		// Images are pulled by digest when there is one, which pinned tags were found by already.
+		if ref.Tag == "" || ref.Digest != "" {
+			continue
+		}
+		ctx.Logger.Debugf("Checking that tag %v of image %v exists for chart \"%v\"", ref.Tag, ref.Repository, chart.Name)
+		if err := docker.VerifyImage(ctx, ref.Repository, ref.Tag); err != nil {
+			errs = append(errs, fmt.Errorf("Unable to find the image of chart \"%v\": %v", chart.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v\nPass `--skip-image-check` to apply anyway", util.MultiErrorFormat(errs))
+	}
+	return nil
+}
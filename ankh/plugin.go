@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// Plugins are executables on PATH named `ankh-<name>`, which run as `ankh <name>`.
+const pluginPrefix = "ankh-"
+
+// listPlugins returns the plugins on PATH by name. Like PATH lookups, the first one found wins.
+func listPlugins() map[string]string {
+	plugins := make(map[string]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasPrefix(file.Name(), pluginPrefix) {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(file.Name(), pluginPrefix), filepath.Ext(file.Name()))
+			if _, ok := plugins[name]; ok || name == "" {
+				continue
+			}
+			if path, err := exec.LookPath(filepath.Join(dir, file.Name())); err == nil {
+				plugins[name] = path
+			}
+		}
+	}
+	return plugins
+}
+
+// pluginArgs rewrites `ankh [options] NAME ARGS...` to `ankh [options] plugin run NAME -- ARGS...`
+// when NAME isn't an ankh command but `ankh-NAME` is on PATH. Otherwise, args are returned as is.
+func pluginArgs(args []string) []string {
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			if !strings.Contains(arg, "=") && util.Contains(completionValueOpts, arg) {
+				i++
+			}
+			continue
+		}
+
+		if _, ok := completionCommands[arg]; ok {
+			return args
+		}
+		if _, err := exec.LookPath(pluginPrefix + arg); err != nil {
+			return args
+		}
+
+		rewritten := append([]string{}, args[:i]...)
+		rewritten = append(rewritten, "plugin", "run", arg, "--")
+		return append(rewritten, args[i+1:]...)
+	}
+	return args
+}
+
+// pluginAnkhFile finds the Ankh file a plugin is working with, from its `-f` argument or the current directory.
+func pluginAnkhFile(args []string) string {
+	ankhFilePath := "ankh.yaml"
+	for i, arg := range args {
+		if (arg == "-f" || arg == "--filename") && i+1 < len(args) {
+			ankhFilePath = args[i+1]
+		} else if strings.HasPrefix(arg, "--filename=") {
+			ankhFilePath = strings.TrimPrefix(arg, "--filename=")
+		}
+	}
+	if strings.HasPrefix(ankhFilePath, "http://") || strings.HasPrefix(ankhFilePath, "https://") {
+		return ankhFilePath
+	}
+	if _, err := os.Stat(ankhFilePath); err != nil {
+		return ""
+	}
+	if abs, err := filepath.Abs(ankhFilePath); err == nil {
+		return abs
+	}
+	return ankhFilePath
+}
+
+// runPlugin runs a plugin with the merged ankh config and the current context
+// in its environment, and exits with its exit status.
+func runPlugin(ctx *ankh.ExecutionContext, name string, args []string) {
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		fatalf(exitConfigError, "No plugin named '%v'. Plugins are executables named `%v%v` on your PATH", name, pluginPrefix, name)
+	}
+
+	body, err := yaml.Marshal(ctx.AnkhConfig)
+	check(err)
+	configFile, err := ioutil.TempFile("", "ankh-plugin-config")
+	check(err)
+	defer ankh.RemoveOnExit(configFile.Name())()
+	_, err = configFile.Write(body)
+	check(err)
+	check(configFile.Close())
+
+	namespace := ""
+	if ctx.Namespace != nil {
+		namespace = *ctx.Namespace
+	}
+	self, _ := os.Executable()
+
+	ctx.Logger.Debugf("Running plugin %v with args %v", path, args)
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(contextEnv(ctx, namespace),
+		"ANKH_BIN="+self,
+		"ANKH_MERGED_CONFIG="+configFile.Name(),
+		"ANKH_CONFIG_PATH="+ctx.AnkhConfigPath,
+		"ANKH_KUBECONFIG="+ctx.KubeConfigPath,
+		"ANKH_ENVIRONMENT="+ctx.Environment,
+		"ANKH_FILE="+pluginAnkhFile(args),
+		fmt.Sprintf("ANKH_VERBOSE=%v", ctx.Verbose),
+	)
+
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Remove(configFile.Name())
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			os.Exit(status.ExitStatus())
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fatalf(exitFailure, "Unable to run plugin '%v': %v", name, err)
+	}
+}
+
+func printPlugins(ctx *ankh.ExecutionContext) {
+	plugins := listPlugins()
+	if len(plugins) == 0 {
+		ctx.Logger.Infof("No plugins found. Plugins are executables named `%vNAME` on your PATH", pluginPrefix)
+		return
+	}
+
+	names := []string{}
+	for name, _ := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := completionCommands[name]; ok {
+			ctx.Logger.Warnf("Plugin %v is shadowed by the `ankh %v` command", plugins[name], name)
+			continue
+		}
+		fmt.Printf("%v\t%v\n", name, plugins[name])
+	}
+}
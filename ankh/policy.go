@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/policy"
+)
+
+func policiesApply(ctx *ankh.ExecutionContext) bool {
+	config := ctx.AnkhConfig.Policy
+	return config.Path != "" && (ctx.Mode == ankh.Lint || (ctx.Mode == ankh.Apply && config.EnforceOnApply))
+}
+
+// checkPolicies evaluates the rendered objects against the configured Rego
+// policies, warning about `warn` violations and returning `deny` violations.
+func checkPolicies(ctx *ankh.ExecutionContext, helmOutput string) []error {
+	if !policiesApply(ctx) {
+		return []error{}
+	}
+	deny, warn, err := policy.Evaluate(ctx, helmOutput)
+	if err != nil {
+		return []error{err}
+	}
+	for _, err := range warn {
+		ctx.Logger.Warnf("%v", err)
+	}
+	return deny
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	isatty "github.com/mattn/go-isatty"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/util"
+)
+
+var portForwardTargets = []kubectl.PortForwardTarget{}
+
+// selectPortForwardTarget chooses the Service or Deployment to forward to:
+// the one named by service, or else the only one, or the one the user selects.
+func selectPortForwardTarget(ctx *ankh.ExecutionContext, targets []kubectl.PortForwardTarget, service string) (kubectl.PortForwardTarget, error) {
+	if len(targets) == 0 {
+		return kubectl.PortForwardTarget{}, fmt.Errorf("No Services, nor Deployments with container ports, found to forward to")
+	}
+
+	choices := []string{}
+	for _, target := range targets {
+		choices = append(choices, target.Resource)
+	}
+	if service != "" {
+		for _, target := range targets {
+			if target.Resource == service || target.Resource == "service/"+service {
+				return target, nil
+			}
+		}
+		return kubectl.PortForwardTarget{}, fmt.Errorf("No Service or Deployment \"%v\" found, choose one of [ %v ]", service, strings.Join(choices, ", "))
+	}
+
+	if len(targets) == 1 {
+		return targets[0], nil
+	}
+	if ctx.NoPrompt || !isatty.IsTerminal(os.Stdin.Fd()) {
+		return kubectl.PortForwardTarget{}, fmt.Errorf("Found [ %v ] to forward to. Use --service to choose one", strings.Join(choices, ", "))
+	}
+	selection, err := util.PromptForSelection(choices, "Select a Service or Deployment to forward to")
+	if err != nil {
+		return kubectl.PortForwardTarget{}, err
+	}
+	for _, target := range targets {
+		if target.Resource == selection {
+			return target, nil
+		}
+	}
+	return kubectl.PortForwardTarget{}, fmt.Errorf("No Service or Deployment \"%v\" found", selection)
+}
+
+// portForwards are the `LOCAL:REMOTE` ports to forward to target: those in
+// portSpecs, or else every port of target, choosing free local ports where
+// they're not given.
+func portForwards(target kubectl.PortForwardTarget, portSpecs []string) ([]string, error) {
+	if len(portSpecs) == 0 {
+		if len(target.Ports) == 0 {
+			return nil, fmt.Errorf("%v has no ports, so use --port to choose one", target.Resource)
+		}
+		for _, port := range target.Ports {
+			portSpecs = append(portSpecs, fmt.Sprintf("%v", port))
+		}
+	}
+
+	forwards := []string{}
+	for _, spec := range portSpecs {
+		local, remote, err := kubectl.ParsePortSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if local == 0 {
+			local, err = kubectl.LocalPort(remote)
+			if err != nil {
+				return nil, err
+			}
+		}
+		forwards = append(forwards, fmt.Sprintf("%v:%v", local, remote))
+	}
+	return forwards, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+const defaultPreconditionTimeout = "2m"
+
+// preconditionInterval is how long to wait between checks of a precondition that isn't met yet.
+var preconditionInterval = 5 * time.Second
+
+func describePrecondition(precondition ankh.Precondition) string {
+	switch {
+	case precondition.DNS != "":
+		return fmt.Sprintf("dns %v", precondition.DNS)
+	case precondition.TCP != "":
+		return fmt.Sprintf("tcp %v", precondition.TCP)
+	default:
+		return fmt.Sprintf("deployment %v", precondition.Deployment)
+	}
+}
+
+func validatePrecondition(precondition ankh.Precondition) error {
+	set := 0
+	for _, check := range []string{precondition.DNS, precondition.TCP, precondition.Deployment} {
+		if check != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("Each precondition must have exactly one of `dns`, `tcp` or `deployment`, found %+v", precondition)
+	}
+	if precondition.TCP != "" {
+		if _, _, err := net.SplitHostPort(precondition.TCP); err != nil {
+			return fmt.Errorf("Precondition `tcp` must be host:port, found \"%v\"", precondition.TCP)
+		}
+	}
+	if precondition.Deployment != "" {
+		tokens := strings.Split(precondition.Deployment, "/")
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return fmt.Errorf("Precondition `deployment` must be namespace/name, found \"%v\"", precondition.Deployment)
+		}
+	}
+	if precondition.Timeout != "" {
+		if _, err := time.ParseDuration(precondition.Timeout); err != nil {
+			return fmt.Errorf("Invalid precondition timeout \"%v\": %v", precondition.Timeout, err)
+		}
+	}
+	return nil
+}
+
+// checkPrecondition checks whether precondition is met right now.
+func checkPrecondition(ctx *ankh.ExecutionContext, precondition ankh.Precondition) error {
+	switch {
+	case precondition.DNS != "":
+		_, err := net.LookupHost(precondition.DNS)
+		return err
+	case precondition.TCP != "":
+		conn, err := net.DialTimeout("tcp", precondition.TCP, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		tokens := strings.Split(precondition.Deployment, "/")
+		status, err := kubectl.DeploymentStatus(ctx, tokens[0], tokens[1])
+		if err != nil {
+			return err
+		}
+		if !status.Found {
+			return fmt.Errorf("not found")
+		}
+		if !status.Healthy() {
+			return fmt.Errorf("%v of %v pods ready", status.Ready, status.Desired)
+		}
+		return nil
+	}
+}
+
+// waitForPrecondition checks precondition until it's met or its timeout passes.
+func waitForPrecondition(ctx *ankh.ExecutionContext, precondition ankh.Precondition) error {
+	if err := validatePrecondition(precondition); err != nil {
+		return err
+	}
+	timeout := precondition.Timeout
+	if timeout == "" {
+		timeout = defaultPreconditionTimeout
+	}
+	duration, _ := time.ParseDuration(timeout)
+	deadline := time.Now().Add(duration)
+
+	description := describePrecondition(precondition)
+	ctx.Logger.Infof("Waiting up to %v for precondition %v", timeout, description)
+	for {
+		err := checkPrecondition(ctx, precondition)
+		if err == nil {
+			ctx.Logger.Infof("Precondition %v is met", description)
+			return nil
+		}
+		if time.Now().Add(preconditionInterval).After(deadline) {
+			return fmt.Errorf("Precondition %v was not met after %v: %v", description, timeout, err)
+		}
+		ctx.Logger.Debugf("Precondition %v is not met yet: %v", description, err)
+		time.Sleep(preconditionInterval)
+	}
+}
+
+// waitForPreconditions waits for all of an Ankh file's preconditions before
+// it's applied, aborting the run if any of them aren't met in time.
+func waitForPreconditions(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile) {
+	if len(ankhFile.Preconditions) == 0 {
+		return
+	}
+	if ctx.DryRun {
+		ctx.Logger.Infof("Skipping preconditions since this is a dry run")
+		return
+	}
+
+	for _, precondition := range ankhFile.Preconditions {
+		if err := waitForPrecondition(ctx, precondition); err != nil {
+			fatalf(exitPreconditionFailed, "%v. Not applying Ankh file %v", err, ankhFile.Path)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+const progressRedrawInterval = 100 * time.Millisecond
+
+// progress shows what `apply` is doing in each context, namespace and chart,
+// when it's run on a terminal. It's nil otherwise.
+var progress *util.Progress
+
+// progressFormatter hides info logs, which progress shows in their place,
+// and formats the rest with the formatter it replaced.
+type progressFormatter struct {
+	logrus.Formatter
+}
+
+func (f *progressFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level == logrus.InfoLevel {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// progressEnabled is true when progress can be shown: on a terminal, with
+// the default text logs, and nothing that interleaves with them.
+func progressEnabled(ctx *ankh.ExecutionContext, noProgress bool) bool {
+	formatter, ok := log.Formatter.(*util.CustomFormatter)
+	return !noProgress && ok && formatter.IsTerminal && isatty.IsTerminal(os.Stdout.Fd()) &&
+		!ctx.Verbose && !ctx.Quiet && !ctx.Options.ApplyConfirm
+}
+
+// startProgress shows progress instead of info logs, when enabled. Warnings
+// and errors are still logged, above it.
+func startProgress(ctx *ankh.ExecutionContext, noProgress bool) {
+	if !progressEnabled(ctx, noProgress) {
+		return
+	}
+	progress = util.NewProgress(os.Stdout)
+	log.Out = progress
+	log.Formatter = &progressFormatter{log.Formatter}
+	progress.Start(progressRedrawInterval)
+}
+
+// stopProgress leaves the last of the progress on the terminal, with
+// anything unfinished marked as failed, and goes back to logging everything.
+func stopProgress() {
+	if progress == nil {
+		return
+	}
+	progress.Stop()
+	progress = nil
+	log.Out = os.Stdout
+	if formatter, ok := log.Formatter.(*progressFormatter); ok {
+		log.Formatter = formatter.Formatter
+	}
+}
+
+func progressTaskName(ctx *ankh.ExecutionContext, namespace string, chart string) string {
+	return fmt.Sprintf("%v/%v %v", ctx.AnkhConfig.CurrentContextName, namespace, chart)
+}
+
+// setProgress sets the stage of each of charts in namespace, eg: `applying`.
+func setProgress(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, stage string) {
+	if progress == nil {
+		return
+	}
+	for _, chart := range charts {
+		progress.Set(progressTaskName(ctx, namespace, chart.Name), stage)
+	}
+}
+
+func finishProgress(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, stage string) {
+	if progress == nil {
+		return
+	}
+	for _, chart := range charts {
+		progress.Finish(progressTaskName(ctx, namespace, chart.Name), stage)
+	}
+}
+
+// withProgressPaused runs f without progress drawn, eg: for commands whose output goes to the terminal.
+func withProgressPaused(f func()) {
+	if progress == nil {
+		f()
+		return
+	}
+	progress.Pause()
+	defer progress.Resume()
+	f()
+}
+
+// commandOutput is where printOutput prints when progress isn't shown.
+var commandOutput io.Writer = os.Stdout
+
+// printOutput prints output above progress, if it's shown.
+func printOutput(output string) {
+	if progress != nil {
+		fmt.Fprintln(progress, output)
+		return
+	}
+	fmt.Fprintln(commandOutput, output)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+)
+
+const gibibyte = 1 << 30
+
+// resourcePrices are the prices per core and per GiB from `--cpu-price` and
+// `--memory-price`, and then the ankh config.
+func resourcePrices(ctx *ankh.ExecutionContext) (float64, float64) {
+	cpuPrice, memoryPrice := ctx.AnkhConfig.Resources.CPUPrice, ctx.AnkhConfig.Resources.MemoryPrice
+	if ctx.Options.CPUPrice > 0 {
+		cpuPrice = ctx.Options.CPUPrice
+	}
+	if ctx.Options.MemoryPrice > 0 {
+		memoryPrice = ctx.Options.MemoryPrice
+	}
+	return cpuPrice, memoryPrice
+}
+
+func formatCores(cores float64) string {
+	return strconv.FormatFloat(cores, 'f', -1, 64)
+}
+
+// formatBytes shows memory in GiB when there's at least 1, and MiB otherwise.
+func formatBytes(bytes float64) string {
+	if bytes >= gibibyte {
+		return strconv.FormatFloat(float64(int64(bytes*100/gibibyte))/100, 'f', -1, 64) + "Gi"
+	}
+	return strconv.FormatFloat(float64(int64(bytes*100/(1<<20)))/100, 'f', -1, 64) + "Mi"
+}
+
+// resourcesCost is a rough estimate of what resources cost, priced by what's
+// requested, since that's what the scheduler sets aside for them.
+func resourcesCost(resources helm.Resources, cpuPrice float64, memoryPrice float64) float64 {
+	return resources.CPURequests*cpuPrice + resources.MemoryRequests/gibibyte*memoryPrice
+}
+
+// printChartResources prints the CPU and memory requested by each chart in
+// helmOutput, and by all of them in namespace, with their estimated cost when
+// there are prices configured.
+func printChartResources(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	workloads, err := helm.WorkloadsResources(helmOutput)
+	check(err)
+
+	sources := objectSources(helmOutput)
+	chartResources := make(map[string]*helm.Resources)
+	total := helm.Resources{}
+	for _, workload := range workloads {
+		chart := ""
+		if source, ok := sources[workload.Kind+"/"+workload.Name]; ok {
+			chart, _ = sourceFile(charts, source)
+		} else if len(charts) == 1 {
+			chart = charts[0].Name
+		}
+		if workload.PerNode {
+			ctx.Logger.Warnf("%v '%v' in chart \"%v\" runs a pod on every node, so its resources are counted for one pod only",
+				workload.Kind, workload.Name, chart)
+		}
+		if chartResources[chart] == nil {
+			chartResources[chart] = &helm.Resources{}
+		}
+		chartResources[chart].Add(workload.Resources)
+		total.Add(workload.Resources)
+	}
+
+	names := []string{}
+	for name := range chartResources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cpuPrice, memoryPrice := resourcePrices(ctx)
+	priced := cpuPrice > 0 || memoryPrice > 0
+
+	fmt.Printf("# Resources in context \"%v\" and namespace \"%v\"\n", ctx.AnkhConfig.CurrentContextName, namespace)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	header := "CHART\tCPU REQUESTS\tCPU LIMITS\tMEMORY REQUESTS\tMEMORY LIMITS"
+	if priced {
+		header += "\tCOST"
+	}
+	fmt.Fprintln(w, header)
+	row := func(name string, resources helm.Resources) {
+		line := fmt.Sprintf("%v\t%v\t%v\t%v\t%v", name,
+			formatCores(resources.CPURequests), formatCores(resources.CPULimits),
+			formatBytes(resources.MemoryRequests), formatBytes(resources.MemoryLimits))
+		if priced {
+			line += fmt.Sprintf("\t%.2f", resourcesCost(resources, cpuPrice, memoryPrice))
+		}
+		fmt.Fprintln(w, line)
+	}
+	for _, name := range names {
+		chart := name
+		if chart == "" {
+			chart = "(unknown)"
+		}
+		row(chart, *chartResources[name])
+	}
+	row("TOTAL", total)
+	w.Flush()
+	fmt.Println()
+}
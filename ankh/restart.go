@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// checkRestartTimeout exits with exitConfigError unless timeout, the value of
+// `restart --timeout`, is a duration `kubectl rollout status` accepts.
+func checkRestartTimeout(timeout string) {
+	if _, err := time.ParseDuration(timeout); err != nil {
+		fatalf(exitConfigError, "Invalid `--timeout` '%v': %v", timeout, err)
+	}
+}
+
+// restartWorkloads restarts the Deployments, StatefulSets and DaemonSets of
+// charts with `kubectl rollout restart`, and with ctx.Options.RestartWait,
+// waits up to ctx.Options.RestartTimeout for each of them to roll out.
+func restartWorkloads(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	workloads := []string{}
+	for _, chart := range charts {
+		workloads = append(workloads, kubectl.WorkloadsForChart(helmOutput, chart.Name)...)
+	}
+	if len(workloads) == 0 {
+		ctx.Logger.Warnf("No Deployments, StatefulSets or DaemonSets to restart in namespace \"%v\"", namespace)
+		return
+	}
+
+	out, err := kubectl.RolloutRestart(ctx, namespace, workloads)
+	check(err)
+	fmt.Print(out)
+
+	if !ctx.Options.RestartWait || ctx.DryRun {
+		return
+	}
+	for _, workload := range workloads {
+		ctx.Logger.Infof("Waiting up to %v for %v to roll out", ctx.Options.RestartTimeout, workload)
+		check(kubectl.RolloutStatus(ctx, namespace, workload, ctx.Options.RestartTimeout))
+	}
+	ctx.Logger.Infof("Finished restarting [ %v ] in namespace \"%v\"", strings.Join(workloads, ", "), namespace)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/util"
+)
+
+const defaultRunJobTimeout = "30m"
+
+// runJobs runs the Jobs in helmOutput, or those named by
+// ctx.Options.RunJobNames, one at a time under names that are unique to this
+// run, streaming their logs. If a Job fails, ankh exits with the exit code of
+// its pod.
+func runJobs(ctx *ankh.ExecutionContext, namespace string, helmOutput string) {
+	available := kubectl.JobNames(helmOutput)
+	for _, name := range ctx.Options.RunJobNames {
+		if !util.Contains(available, name) {
+			fatalf(exitConfigError, "No Job named \"%v\" found, choose from [ %v ]", name, strings.Join(available, ", "))
+		}
+	}
+	suffix := strconv.FormatInt(time.Now().Unix(), 36)
+	manifests, names := kubectl.UniqueJobs(helmOutput, ctx.Options.RunJobNames, suffix)
+	if len(names) == 0 {
+		fatalf(exitConfigError, "No Jobs found to run in namespace \"%v\"", namespace)
+	}
+
+	for i, name := range names {
+		ctx.Logger.Infof("Running job \"%v\" in namespace \"%v\", waiting up to %v for it to finish", name, namespace, ctx.Options.RunJobTimeout)
+		code, err := kubectl.RunJob(ctx, namespace, manifests[i], name, ctx.Options.RunJobTimeout)
+
+		message := fmt.Sprintf("Job \"%v\" succeeded", name)
+		if err != nil {
+			message = err.Error()
+		}
+		if err := ctx.Audit(ankh.AuditEntry{Namespace: namespace, Message: message}); err != nil {
+			ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+		}
+		if err != nil {
+			ctx.Logger.Errorf("%v", message)
+			exit(code)
+		}
+		ctx.Logger.Infof("%v", message)
+	}
+}
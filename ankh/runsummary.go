@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// chartOutcome is what `apply` did to one chart, in one namespace of one
+// context, for the summary at the end of the run.
+type chartOutcome struct {
+	Context    string `json:"context"`
+	Namespace  string `json:"namespace"`
+	Chart      string `json:"chart"`
+	Version    string `json:"version,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Action     string `json:"action"`
+	Created    int    `json:"created"`
+	Configured int    `json:"configured"`
+	Unchanged  int    `json:"unchanged"`
+	Failed     int    `json:"failed"`
+	Duration   string `json:"duration"`
+
+	objects int
+	started time.Time
+}
+
+var chartOutcomes = []chartOutcome{}
+
+// runSummaryFormat is how writeRunSummary prints the summary: `table`, `json`,
+// or `none`. It's empty for commands that don't print one.
+var runSummaryFormat string
+
+// findChartOutcome returns the outcome of chart in namespace of the current context, or nil.
+func findChartOutcome(ctx *ankh.ExecutionContext, namespace string, chart string) *chartOutcome {
+	for i := len(chartOutcomes) - 1; i >= 0; i-- {
+		outcome := &chartOutcomes[i]
+		if outcome.Context == ctx.AnkhConfig.CurrentContextName && outcome.Namespace == namespace && outcome.Chart == chart {
+			return outcome
+		}
+	}
+	return nil
+}
+
+func startChartOutcomes(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string) {
+	if ctx.Mode != ankh.Apply {
+		return
+	}
+	for _, chart := range charts {
+		chartOutcomes = append(chartOutcomes, chartOutcome{
+			Context:   ctx.AnkhConfig.CurrentContextName,
+			Namespace: namespace,
+			Chart:     chart.Name,
+			Version:   chart.Version,
+			Tag:       strings.TrimSuffix(chart.Tag, "@"+chart.Digest),
+			Digest:    chart.Digest,
+			started:   time.Now(),
+		})
+	}
+}
+
+// countChartObjects counts the objects of each chart about to be applied, so
+// that the objects of a chart that fails to apply can be counted as failed.
+func countChartObjects(ctx *ankh.ExecutionContext, namespace string, helmOutput string) {
+	for chart, output := range kubectl.ChartDocuments(helmOutput) {
+		if outcome := findChartOutcome(ctx, namespace, chart); outcome != nil {
+			outcome.objects = len(kubectl.ObjectDocuments(output, namespace))
+		}
+	}
+}
+
+func recordChartOutcome(ctx *ankh.ExecutionContext, namespace string, summary ankh.ApplySummary) {
+	if outcome := findChartOutcome(ctx, namespace, summary.Chart); outcome != nil {
+		outcome.Created = summary.Created
+		outcome.Configured = summary.Configured
+		outcome.Unchanged = summary.Unchanged
+	}
+}
+
+func finishChartOutcome(outcome *chartOutcome, action string) {
+	outcome.Action = action
+	outcome.Duration = time.Since(outcome.started).Round(time.Second).String()
+	if action == "failed" {
+		outcome.Failed = outcome.objects - outcome.Created - outcome.Configured - outcome.Unchanged
+		if outcome.Failed < 0 {
+			outcome.Failed = 0
+		}
+	}
+}
+
+func finishChartOutcomes(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, action string) {
+	for _, chart := range charts {
+		if outcome := findChartOutcome(ctx, namespace, chart.Name); outcome != nil {
+			finishChartOutcome(outcome, action)
+		}
+	}
+}
+
+// failUnfinishedChartOutcomes marks the charts that were being applied when
+// ankh exited as failed, or as interrupted if that's why it exited.
+func failUnfinishedChartOutcomes() {
+	action := "failed"
+	if ankh.Interrupted() != nil {
+		action = "interrupted"
+	}
+	for i := range chartOutcomes {
+		if chartOutcomes[i].Action == "" {
+			finishChartOutcome(&chartOutcomes[i], action)
+		}
+	}
+}
+
+// unstartedContexts are the contexts of the environment being applied that
+// haven't been started yet, for reporting what an interrupted run didn't apply.
+var unstartedContexts []string
+
+// reportInterrupt logs what an interrupted run did and didn't apply, ahead of
+// the run summary.
+func reportInterrupt(ctx *ankh.ExecutionContext) {
+	sig := ankh.Interrupted()
+	if sig == nil || ctx.Mode != ankh.Apply {
+		return
+	}
+	applied, interrupted := []string{}, []string{}
+	for _, outcome := range chartOutcomes {
+		name := fmt.Sprintf("%v/%v/%v", outcome.Context, outcome.Namespace, outcome.Chart)
+		switch outcome.Action {
+		case "", "failed", "interrupted":
+			interrupted = append(interrupted, name)
+		case "skipped", "unchanged":
+		default:
+			applied = append(applied, name)
+		}
+	}
+	if len(applied) > 0 {
+		ctx.Logger.Warnf("Interrupted by %v after applying charts [ %v ]", ankh.SignalName(sig), strings.Join(applied, ", "))
+	} else {
+		ctx.Logger.Warnf("Interrupted by %v before any chart was applied", ankh.SignalName(sig))
+	}
+	if len(interrupted) > 0 {
+		ctx.Logger.Warnf("Charts that may be partly applied: [ %v ]", strings.Join(interrupted, ", "))
+	}
+	if len(unstartedContexts) > 0 {
+		ctx.Logger.Warnf("Contexts that weren't started: [ %v ]", strings.Join(unstartedContexts, ", "))
+	}
+	ctx.Logger.Warnf("Charts that aren't in the summary weren't applied")
+}
+
+func printRunSummary(w io.Writer, outcomes []chartOutcome) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "CONTEXT\tNAMESPACE\tCHART\tVERSION\tTAG\tACTION\tCREATED\tCONFIGURED\tUNCHANGED\tFAILED\tDURATION\n")
+	for _, o := range outcomes {
+		version := o.Version
+		if version == "" {
+			version = "-"
+		}
+		tag := o.Tag
+		if tag == "" {
+			tag = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", o.Context, o.Namespace, o.Chart, version, tag,
+			o.Action, o.Created, o.Configured, o.Unchanged, o.Failed, o.Duration)
+	}
+	tw.Flush()
+}
+
+// writeRunSummary prints what was done to each chart, in runSummaryFormat,
+// once, unless nothing was done.
+func writeRunSummary(ctx *ankh.ExecutionContext, w io.Writer) {
+	format := runSummaryFormat
+	runSummaryFormat = ""
+	if format == "" || format == "none" || len(chartOutcomes) == 0 {
+		return
+	}
+	failUnfinishedChartOutcomes()
+	if format == "json" {
+		out, err := formatStructured(chartOutcomes, "json")
+		if err != nil {
+			ctx.Logger.Warnf("Failed to format the run summary: %v", err)
+			return
+		}
+		w.Write(out)
+		return
+	}
+	fmt.Fprintln(w)
+	printRunSummary(w, chartOutcomes)
+}
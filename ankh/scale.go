@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/util"
+)
+
+// scaleWorkloads scales the Deployments and StatefulSets templated in
+// helmOutput to ctx.Options.ScaleReplicas. Scaling to zero stops every pod,
+// so unless it's a dry run, it must be confirmed first.
+func scaleWorkloads(ctx *ankh.ExecutionContext, namespace string, helmOutput string) {
+	workloads := kubectl.ScalableWorkloads(helmOutput)
+	if len(workloads) == 0 {
+		ctx.Logger.Warnf("No Deployments or StatefulSets to scale in namespace \"%v\"", namespace)
+		return
+	}
+
+	if ctx.Options.ScaleReplicas == 0 && !ctx.DryRun {
+		if ctx.NoPrompt {
+			fatalf(exitConfigError, "Scaling to zero must be confirmed, but prompts are disabled")
+		}
+		selection, err := util.PromptForSelection([]string{"Abort", "OK"},
+			fmt.Sprintf("Are you certain that you want to scale [ %v ] in namespace \"%v\" of context \"%v\" to zero replicas? Select OK to proceed.",
+				strings.Join(workloads, ", "), namespace, ctx.AnkhConfig.CurrentContextName))
+		check(err)
+		if selection != "OK" {
+			fatalf(exitFailure, "Aborting")
+		}
+	}
+
+	out, err := kubectl.Scale(ctx, namespace, workloads, ctx.Options.ScaleReplicas)
+	check(err)
+	fmt.Print(out)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/scan"
+)
+
+func scanApplies(ctx *ankh.ExecutionContext) bool {
+	return ctx.Mode == ankh.Apply && ctx.AnkhConfig.Scan.Enabled
+}
+
+// scanImages scans the images of the objects about to be applied to namespace
+// for vulnerabilities, returning an error for each image with vulnerabilities
+// of `scan.severity` or above. Skipping the scan with `--skip-scan` is recorded
+// in the audit log.
+func scanImages(ctx *ankh.ExecutionContext, namespace string, helmOutput string) []error {
+	if !scanApplies(ctx) {
+		return []error{}
+	}
+	if ctx.Options.SkipScan != "" {
+		message := fmt.Sprintf("Skipped scanning images for vulnerabilities in namespace \"%v\": %v", namespace, ctx.Options.SkipScan)
+		ctx.Logger.Warnf("%v", message)
+		if !ctx.DryRun {
+			if err := ctx.Audit(ankh.AuditEntry{Namespace: namespace, Message: message}); err != nil {
+				ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+			}
+		}
+		return []error{}
+	}
+
+	images, err := kubectl.Images(helmOutput)
+	if err != nil {
+		fatalf(exitTemplateError, "%v", err)
+	}
+	vulnerable, err := scan.Images(ctx, images)
+	if err != nil {
+		fatalf(exitFailure, "%v. Pass `--skip-scan REASON` to apply anyway", err)
+	}
+	return vulnerable
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+)
+
+// scoreSettings decides whether lint runs the best-practice checks, and the
+// minimum score charts need: `--min-score`, and then `lint.score.minimum`.
+func scoreSettings(ctx *ankh.ExecutionContext) (bool, int) {
+	config := ctx.AnkhConfig.Lint.Score
+	minimum := config.Minimum
+	if ctx.Options.MinScore > 0 {
+		minimum = ctx.Options.MinScore
+	}
+	return ctx.Options.Score || config.Enabled || minimum > 0, minimum
+}
+
+// scoreCharts runs the best-practice checks on helmOutput and scores each
+// chart out of 100 by the share of its checks that passed. Failed checks are
+// warnings, unless the chart scores lower than the minimum, when they're
+// returned as errors.
+func scoreCharts(ctx *ankh.ExecutionContext, charts []ankh.Chart, helmOutput string) (map[string]int, []error) {
+	enabled, minimum := scoreSettings(ctx)
+	if !enabled {
+		return nil, []error{}
+	}
+
+	checks, err := helm.Score(helmOutput)
+	if err != nil {
+		return nil, []error{err}
+	}
+	sources := objectSources(helmOutput)
+	chartChecks := make(map[string][]helm.ScoreCheck)
+	for _, check := range checks {
+		chart := ""
+		if source, ok := sources[check.Kind+"/"+check.Name]; ok {
+			chart, _ = sourceFile(charts, source)
+		} else if len(charts) == 1 {
+			chart = charts[0].Name
+		}
+		chartChecks[chart] = append(chartChecks[chart], check)
+	}
+
+	names := []string{}
+	for name := range chartChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scores := make(map[string]int)
+	errors := []error{}
+	for _, name := range names {
+		checks := chartChecks[name]
+		failed := []error{}
+		for _, check := range checks {
+			if check.Err != nil {
+				failed = append(failed, check.Err)
+			}
+		}
+		score := 100 * (len(checks) - len(failed)) / len(checks)
+		scores[name] = score
+
+		chart := name
+		if chart == "" {
+			chart = strings.Join(chartNames(charts), ", ")
+		}
+		if minimum > 0 && score < minimum {
+			ctx.Logger.Errorf("Chart \"%v\" scores %v, below the minimum of %v, passing %v of %v best-practice checks",
+				chart, score, minimum, len(checks)-len(failed), len(checks))
+			errors = append(errors, failed...)
+			continue
+		}
+		ctx.Logger.Infof("Chart \"%v\" scores %v, passing %v of %v best-practice checks", chart, score, len(checks)-len(failed), len(checks))
+		for _, err := range failed {
+			ctx.Logger.Warnf("%v", err)
+		}
+	}
+	return scores, errors
+}
+
+func chartNames(charts []ankh.Chart) []string {
+	names := []string{}
+	for _, chart := range charts {
+		names = append(names, chart.Name)
+	}
+	return names
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// serveOperations maps each operation exposed by `ankh serve` to the ankh command that runs it.
+var serveOperations = map[string]string{
+	"template": "template",
+	"explain":  "explain",
+	"lint":     "lint",
+	"plan":     "diff",
+	"apply":    "apply",
+	"status":   "status",
+	"pods":     "pods",
+}
+
+// serveRequest is the JSON body of an operation request. Each field corresponds to an ankh option.
+type serveRequest struct {
+	Context     string            `json:"context,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	AnkhFile    string            `json:"ankhFile,omitempty"`
+	Chart       string            `json:"chart,omitempty"`
+	Set         map[string]string `json:"set,omitempty"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	Filter      []string          `json:"filter,omitempty"`
+	Only        []string          `json:"only,omitempty"`
+}
+
+// serveEvent is one line of a streamed response: a line of output, or the final result.
+type serveEvent struct {
+	Stream   string `json:"stream,omitempty"`
+	Line     string `json:"line,omitempty"`
+	Done     bool   `json:"done,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// serveArgs builds the ankh command line for an operation request.
+func serveArgs(ctx *ankh.ExecutionContext, operation string, req serveRequest) ([]string, error) {
+	command, ok := serveOperations[operation]
+	if !ok {
+		return nil, fmt.Errorf("Unknown operation '%v'", operation)
+	}
+	if req.Context != "" && req.Environment != "" {
+		return nil, fmt.Errorf("Must not provide both `context` and `environment`")
+	}
+	if req.DryRun && command != "apply" {
+		return nil, fmt.Errorf("`dryRun` only applies to the apply operation")
+	}
+	if (len(req.Filter) > 0 || len(req.Only) > 0) && (command == "explain" || command == "pods" || command == "status") {
+		return nil, fmt.Errorf("`filter` and `only` are not supported by the %v operation", operation)
+	}
+	if err := checkServeValues(req); err != nil {
+		return nil, err
+	}
+
+	// Nobody can answer a prompt, since the command's stdin is /dev/null.
+	args := append(selfArgs(ctx), "--no-prompt")
+	if req.Context != "" {
+		args = append(args, "--context", req.Context)
+	}
+	if req.Environment != "" {
+		args = append(args, "--environment", req.Environment)
+	}
+	if req.Namespace != "" {
+		args = append(args, "--namespace", req.Namespace)
+	}
+	if req.Release != "" {
+		args = append(args, "--release", req.Release)
+	}
+	keys := []string{}
+	for k := range req.Set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--set", k+"="+req.Set[k])
+	}
+
+	args = append(args, command)
+	if req.AnkhFile != "" {
+		args = append(args, "-f", req.AnkhFile)
+	}
+	if req.Chart != "" {
+		args = append(args, "--chart", req.Chart)
+	}
+	if req.DryRun {
+		args = append(args, "--dry-run")
+	}
+	for _, filter := range req.Filter {
+		args = append(args, "--filter", filter)
+	}
+	for _, only := range req.Only {
+		args = append(args, "--only", only)
+	}
+	return args, nil
+}
+
+// checkServeValues rejects values in req that start with `-`, which the
+// command would take for options rather than their values.
+func checkServeValues(req serveRequest) error {
+	values := map[string][]string{
+		"context":     {req.Context},
+		"environment": {req.Environment},
+		"namespace":   {req.Namespace},
+		"release":     {req.Release},
+		"ankhFile":    {req.AnkhFile},
+		"chart":       {req.Chart},
+		"filter":      req.Filter,
+		"only":        req.Only,
+	}
+	for k := range req.Set {
+		values["set"] = append(values["set"], k)
+	}
+	for field, vs := range values {
+		for _, v := range vs {
+			if strings.HasPrefix(v, "-") {
+				return fmt.Errorf("Invalid `%v` '%v', which must not start with `-`", field, v)
+			}
+		}
+	}
+	return nil
+}
+
+type server struct {
+	ctx      *ankh.ExecutionContext
+	self     string
+	token    string
+	loopback bool
+}
+
+func writeServeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(serveEvent{Done: true, Error: err.Error()})
+}
+
+func (s *server) authorized(r *http.Request) bool {
+	expected := []byte("Bearer " + s.token)
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) == 1
+}
+
+// admit rejects requests that a browser could have been tricked into sending:
+// any cross-origin request, and, when listening on a loopback address, any
+// request for a Host other than a loopback one, which guards against DNS
+// rebinding. It writes the error and returns false if r is rejected.
+func (s *server) admit(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Origin") != "" {
+		writeServeError(w, http.StatusForbidden, fmt.Errorf("Cross-origin requests are not allowed"))
+		return false
+	}
+	if s.loopback && !isLoopbackHost(r.Host) {
+		writeServeError(w, http.StatusForbidden, fmt.Errorf("Host '%v' is not a loopback address", r.Host))
+		return false
+	}
+	if !s.authorized(r) {
+		writeServeError(w, http.StatusUnauthorized, fmt.Errorf("Missing or incorrect bearer token"))
+		return false
+	}
+	return true
+}
+
+// handleOperation runs an operation as an ankh subprocess, streaming its
+// output as newline delimited JSON events, followed by its exit code. The
+// subprocess runs to completion even if the client goes away, so that an
+// apply is never interrupted half way.
+func (s *server) handleOperation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeServeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Operations must be POSTed"))
+		return
+	}
+	if !s.admit(w, r) {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeServeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("Operations must have a `Content-Type` of application/json"))
+		return
+	}
+
+	req := serveRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeServeError(w, http.StatusBadRequest, fmt.Errorf("Unable to parse request: %v", err))
+			return
+		}
+	}
+	operation := strings.TrimPrefix(r.URL.Path, "/v1/")
+	args, err := serveArgs(s.ctx, operation, req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := serveOperations[operation]; !ok {
+			status = http.StatusNotFound
+		}
+		writeServeError(w, status, err)
+		return
+	}
+
+	s.ctx.Logger.Infof("%v %v from %v: ankh %v", r.Method, r.URL.Path, r.RemoteAddr, strings.Join(args, " "))
+	cmd := exec.Command(s.self, args...)
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+	if err := cmd.Start(); err != nil {
+		writeServeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	var mtx sync.Mutex
+	emit := func(event serveEvent) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		encoder.Encode(event)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var wg sync.WaitGroup
+	stream := func(name string, r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			emit(serveEvent{Stream: name, Line: scanner.Text()})
+		}
+	}
+	wg.Add(2)
+	go stream("stdout", stdout)
+	go stream("stderr", stderr)
+	wg.Wait()
+
+	exitCode := 0
+	result := serveEvent{Done: true, ExitCode: &exitCode}
+	if err := cmd.Wait(); err != nil {
+		exitCode = -1
+		result.Error = err.Error()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				exitCode = status.ExitStatus()
+			}
+		}
+	}
+	s.ctx.Logger.Infof("%v %v from %v finished with exit code %v", r.Method, r.URL.Path, r.RemoteAddr, exitCode)
+	emit(result)
+}
+
+func (s *server) handleOperations(w http.ResponseWriter, r *http.Request) {
+	if !s.admit(w, r) {
+		return
+	}
+	operations := []string{}
+	for operation, _ := range serveOperations {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"operations": operations})
+}
+
+// isLoopback is true if addr only listens on the local machine.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	return isLoopbackName(host)
+}
+
+// isLoopbackHost is true if the Host header of a request names the local
+// machine, with or without a port.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return isLoopbackName(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+}
+
+func isLoopbackName(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// generateToken returns a random bearer token, for when `--token` is not given.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func serve(ctx *ankh.ExecutionContext, addr string, token string) {
+	if !isLoopback(addr) && token == "" {
+		fatalf(exitConfigError, "Refusing to listen on '%v' without a `--token`, since anybody who can reach it could apply to your clusters", addr)
+	}
+	self, err := os.Executable()
+	check(err)
+
+	if token == "" {
+		token, err = generateToken()
+		check(err)
+		// Other local users and web pages can reach a loopback address too,
+		// so it's never served without a token.
+		ctx.Logger.Infof("No `--token` given, requests must present the header 'Authorization: Bearer %v'", token)
+	}
+
+	s := &server{ctx: ctx, self: self, token: token, loopback: isLoopback(addr)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/", s.handleOperation)
+	mux.HandleFunc("/v1/operations", s.handleOperations)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	ctx.Logger.Infof("Serving the ankh API on http://%v", addr)
+	check(http.ListenAndServe(addr, mux))
+}
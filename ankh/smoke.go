@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+const defaultSmokeTestTimeout = "5m"
+
+func hasSmokeTests(charts []ankh.Chart) bool {
+	for _, chart := range charts {
+		if chart.SmokeTest != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func runSmokeTestHTTP(ctx *ankh.ExecutionContext, smokeTest *ankh.SmokeTest) error {
+	expectStatus := smokeTest.ExpectStatus
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	attempts := smokeTest.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(5 * time.Second)
+		}
+
+		var resp *http.Response
+		resp, err = client.Get(smokeTest.HTTP)
+		if err != nil {
+			ctx.Logger.Warnf("Smoke test GET %v failed (attempt %v of %v): %v", smokeTest.HTTP, attempt, attempts, err)
+			continue
+		}
+		resp.Body.Close()
+
+		if (expectStatus == 0 && resp.StatusCode >= 200 && resp.StatusCode < 300) || resp.StatusCode == expectStatus {
+			return nil
+		}
+		err = fmt.Errorf("GET %v returned %v", smokeTest.HTTP, resp.Status)
+		ctx.Logger.Warnf("Smoke test %v (attempt %v of %v)", err, attempt, attempts)
+	}
+	return err
+}
+
+func runSmokeTestCommand(ctx *ankh.ExecutionContext, smokeTest *ankh.SmokeTest, chart ankh.Chart, namespace string) error {
+	attempts := smokeTest.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(5 * time.Second)
+		}
+
+		cmd := exec.Command("/bin/sh", "-c", smokeTest.Command)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = hookEnv(ctx, namespace, []ankh.Chart{chart})
+		ctx.Logger.Debugf("Running smoke test command %+v", cmd.Args)
+		record := ctx.StartCommand(cmd)
+		err = cmd.Run()
+		record.Finish(err)
+		if err == nil {
+			return nil
+		}
+		ctx.Logger.Warnf("Smoke test command `%v` failed (attempt %v of %v): %v", smokeTest.Command, attempt, attempts, err)
+	}
+	return err
+}
+
+// runSmokeTest waits for a chart's workloads to finish rolling out, and then runs its smoke test.
+func runSmokeTest(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace string, helmOutput string) error {
+	smokeTest := chart.SmokeTest
+	if smokeTest.Command == "" && smokeTest.HTTP == "" {
+		return fmt.Errorf("Chart \"%v\" has a `smoke-test` without a `command` or `http` check", chart.Name)
+	}
+
+	timeout := smokeTest.Timeout
+	if timeout == "" {
+		timeout = defaultSmokeTestTimeout
+	}
+	for _, workload := range kubectl.WorkloadsForChart(helmOutput, chart.Name) {
+		ctx.Logger.Infof("Waiting up to %v for %v to roll out before smoke testing chart \"%v\"", timeout, workload, chart.Name)
+		if err := kubectl.RolloutStatus(ctx, namespace, workload, timeout); err != nil {
+			return err
+		}
+	}
+
+	if smokeTest.HTTP != "" {
+		ctx.Logger.Infof("Running smoke test GET %v for chart \"%v\"", smokeTest.HTTP, chart.Name)
+		if err := runSmokeTestHTTP(ctx, smokeTest); err != nil {
+			return err
+		}
+	}
+	if smokeTest.Command != "" {
+		ctx.Logger.Infof("Running smoke test `%v` for chart \"%v\"", smokeTest.Command, chart.Name)
+		if err := runSmokeTestCommand(ctx, smokeTest, chart, namespace); err != nil {
+			return err
+		}
+	}
+
+	ctx.Logger.Infof("Smoke test passed for chart \"%v\"", chart.Name)
+	return nil
+}
+
+// runSmokeTests runs the smoke test for every chart that has one, aborting the run on the first failure.
+func runSmokeTests(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	if ctx.DryRun {
+		if hasSmokeTests(charts) {
+			ctx.Logger.Infof("Skipping smoke tests since this is a dry run")
+		}
+		return
+	}
+
+	for _, chart := range charts {
+		if chart.SmokeTest == nil {
+			continue
+		}
+		if err := runSmokeTest(ctx, chart, namespace, helmOutput); err != nil {
+			message := fmt.Sprintf("Smoke test failed for chart \"%v\" in namespace \"%v\": %v", chart.Name, namespace, err)
+			if err := ctx.Audit(ankh.AuditEntry{Namespace: namespace, Message: message}); err != nil {
+				ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+			}
+			fatalf(exitApplyFailed, "%v. Aborting the remaining charts.", message)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/util"
+)
+
+// chartStatus is the health of the workloads of a chart in one namespace of
+// one context, and the version of the chart that's deployed there.
+type chartStatus struct {
+	Context         string                   `json:"context"`
+	Namespace       string                   `json:"namespace"`
+	Chart           string                   `json:"chart"`
+	Version         string                   `json:"version,omitempty"`
+	DeployedVersion string                   `json:"deployedVersion,omitempty"`
+	Healthy         bool                     `json:"healthy"`
+	Workloads       []kubectl.WorkloadStatus `json:"workloads"`
+}
+
+var chartStatuses = []chartStatus{}
+
+// ready counts the ready and desired pods of the chart's workloads.
+func (s chartStatus) ready() (int, int) {
+	ready, desired := 0, 0
+	for _, workload := range s.Workloads {
+		ready += workload.Ready
+		desired += workload.Desired
+	}
+	return ready, desired
+}
+
+func recordChartStatuses(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	for _, chart := range charts {
+		workloads, err := kubectl.WorkloadStatuses(ctx, helmOutput, namespace, chart.Name)
+		check(err)
+
+		status := chartStatus{
+			Context:   ctx.AnkhConfig.CurrentContextName,
+			Namespace: namespace,
+			Chart:     chart.Name,
+			Version:   chart.Version,
+			Healthy:   true,
+			Workloads: workloads,
+		}
+		versions := []string{}
+		for _, workload := range workloads {
+			if !workload.Healthy() {
+				status.Healthy = false
+			}
+			if workload.ChartVersion != "" {
+				versions = append(versions, workload.ChartVersion)
+			}
+		}
+		// Workloads from different versions of the chart mean a deploy is in progress, or went wrong.
+		versions = util.ArrayDedup(versions)
+		sort.Strings(versions)
+		status.DeployedVersion = strings.Join(versions, ",")
+
+		ready, desired := status.ready()
+		if status.Healthy {
+			ctx.Logger.Infof("Chart \"%v\" in namespace \"%v\" is healthy, with %v/%v pods ready", chart.Name, namespace, ready, desired)
+		} else {
+			ctx.Logger.Warnf("Chart \"%v\" in namespace \"%v\" is unhealthy, with %v/%v pods ready", chart.Name, namespace, ready, desired)
+		}
+		chartStatuses = append(chartStatuses, status)
+	}
+}
+
+func printChartStatuses(statuses []chartStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "CONTEXT\tNAMESPACE\tCHART\tVERSION\tDEPLOYED\tREADY\tHEALTHY\n")
+	for _, status := range statuses {
+		ready, desired := status.ready()
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v/%v\t%v\n", status.Context, status.Namespace, status.Chart,
+			status.Version, status.DeployedVersion, ready, desired, status.Healthy)
+	}
+	w.Flush()
+}
+
+// formatChartStatuses prints statuses with `custom-columns=SPEC`, one row per
+// chart, or with `jsonpath=TEMPLATE` over `{"items": [...]}`, like the lists
+// kubectl prints.
+func formatChartStatuses(statuses []chartStatus, format string) (string, error) {
+	if strings.HasPrefix(format, kubectl.CustomColumnsPrefix) {
+		rows := []interface{}{}
+		for _, status := range statuses {
+			rows = append(rows, status)
+		}
+		return util.CustomColumns(strings.TrimPrefix(format, kubectl.CustomColumnsPrefix), rows)
+	}
+
+	jsonPath, err := util.ParseJSONPath(strings.TrimPrefix(format, kubectl.JSONPathPrefix))
+	if err != nil {
+		return "", err
+	}
+	return jsonPath.Execute(map[string]interface{}{"items": statuses})
+}
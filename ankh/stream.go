@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+	"github.com/appnexus/ankh/util"
+)
+
+// canStreamTemplate is true when `template` can print each object as it's
+// rendered, because nothing it does to the objects needs all of them at once,
+// the way config checksums do.
+func canStreamTemplate(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile) bool {
+	return ctx.Mode == ankh.Template && !ankhFile.ConfigChecksums && !ctx.AnkhConfig.CurrentContext.ConfigChecksums
+}
+
+// canStreamKubectl is true when `diff` or `rollback` can hand each object to
+// kubectl as it's rendered. `apply` can't, since it checks policies, scans
+// images, orders objects by kind, and waits on them, which all need every
+// object at once, and neither can a `diff` that keeps the live replicas of
+// autoscaled workloads, since the autoscaler may come after the workload.
+func canStreamKubectl(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, charts []ankh.Chart) bool {
+	if ctx.Mode != ankh.Diff && ctx.Mode != ankh.Rollback {
+		return false
+	}
+	if ankhFile.ConfigChecksums || ctx.AnkhConfig.CurrentContext.ConfigChecksums {
+		return false
+	}
+	if ctx.Mode == ankh.Diff {
+		for _, chart := range charts {
+			if chart.HPAReplicas != hpaReplicasChart {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// executeStreamed runs kubectl with run on the objects of charts, piping them
+// to it as helm renders them, and exits if templating fails.
+func executeStreamed(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, charts []ankh.Chart, namespace string,
+	run func(r io.Reader) (string, error)) (string, error) {
+	r, w := io.Pipe()
+	templated := make(chan error, 1)
+	go func() {
+		err := streamTemplate(ctx, ankhFile, charts, namespace, w)
+		w.CloseWithError(err)
+		templated <- err
+	}()
+	out, err := run(r)
+	// Stop templating if kubectl stopped reading before the end.
+	r.Close()
+	if templateErr := <-templated; templateErr != nil && templateErr != io.ErrClosedPipe {
+		// kubectl only saw some of the objects, so its output is moot.
+		checkWith(exitTemplateError, templateErr)
+	}
+	return out, err
+}
+
+// streamTemplate writes the objects of charts to w as helm renders them,
+// piping them through the same changes that are made to them otherwise, one
+// object at a time, instead of holding the output of every chart in memory.
+func streamTemplate(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, charts []ankh.Chart, namespace string, w io.Writer) error {
+	r, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(helm.TemplateTo(ctx, charts, namespace, pw))
+	}()
+	// Stop helm writing to the pipe if transforming fails.
+	defer r.Close()
+
+	filter := len(ctx.Filters) > 0 || len(ctx.OnlyObjects) > 0
+	keep, warn := objectFilter(ctx)
+	err := util.TransformDocuments(r, w, func(doc string) (string, bool, error) {
+		doc, err := injectCommonMetadata(ctx, ankhFile, doc)
+		if err != nil {
+			return "", false, err
+		}
+		if filter && !keep(doc) {
+			return "", false, nil
+		}
+		if ctx.Namespace != nil {
+			doc = checkNamespaceOverride(ctx, namespace, doc)
+		}
+		return doc, true, nil
+	})
+	if err == nil && filter {
+		warn()
+	}
+	return err
+}
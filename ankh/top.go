@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+)
+
+// formatMillicores shows CPU usage in millicores, like `kubectl top` does.
+func formatMillicores(cores float64) string {
+	return fmt.Sprintf("%vm", int64(cores*1000+0.5))
+}
+
+// printTop prints the CPU and memory that the pods of each chart in namespace
+// are using, or with ctx.Options.TopContainers, each of their containers,
+// followed by the total for the chart.
+func printTop(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, helmOutput string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if ctx.Options.TopContainers {
+		fmt.Fprintf(w, "CHART\tPOD\tCONTAINER\tCPU\tMEMORY\n")
+	} else {
+		fmt.Fprintf(w, "CHART\tPOD\tCPU\tMEMORY\n")
+	}
+
+	for _, chart := range charts {
+		usages, err := kubectl.TopPods(ctx, kubectl.ChartOutput(helmOutput, chart.Name), namespace, ctx.Options.TopContainers)
+		check(err)
+		if len(usages) == 0 {
+			ctx.Logger.Infof("No pods found for chart \"%v\" in namespace \"%v\"", chart.Name, namespace)
+			continue
+		}
+
+		cpu, memory := 0.0, 0.0
+		for _, usage := range usages {
+			cpu += usage.CPU
+			memory += usage.Memory
+			if ctx.Options.TopContainers {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", chart.Name, usage.Pod, usage.Container, formatMillicores(usage.CPU), formatBytes(usage.Memory))
+			} else {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", chart.Name, usage.Pod, formatMillicores(usage.CPU), formatBytes(usage.Memory))
+			}
+		}
+		if ctx.Options.TopContainers {
+			fmt.Fprintf(w, "%v\tTOTAL\t\t%v\t%v\n", chart.Name, formatMillicores(cpu), formatBytes(memory))
+		} else {
+			fmt.Fprintf(w, "%v\tTOTAL\t%v\t%v\n", chart.Name, formatMillicores(cpu), formatBytes(memory))
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+	"github.com/appnexus/ankh/util"
+)
+
+// printChartValues prints the values that each chart is templated with, or
+// with ctx.Options.ExplainMerge, which source set each value and how it was
+// merged. With ctx.Options.DiffDefaults, only the values that differ from the
+// chart's default values.yaml are printed.
+func printChartValues(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string) {
+	for _, chart := range charts {
+		values, steps, err := helm.ExplainValues(ctx, chart)
+		check(err)
+
+		if ctx.Options.DiffDefaults {
+			defaults, err := helm.ChartDefaultValues(ctx, chart)
+			if err != nil {
+				ctx.Logger.Warnf("Skipping chart \"%v\": %v", chart.Name, err)
+				continue
+			}
+			values = util.DiffValues(defaults, values)
+			fmt.Printf("# Values for chart \"%v\" in context \"%v\" and namespace \"%v\" that differ from the chart's defaults\n", chart.Name, ctx.AnkhConfig.CurrentContextName, namespace)
+		} else {
+			fmt.Printf("# Values for chart \"%v\" in context \"%v\" and namespace \"%v\"\n", chart.Name, ctx.AnkhConfig.CurrentContextName, namespace)
+		}
+		if !ctx.Options.ExplainMerge {
+			out, err := yaml.Marshal(values)
+			check(err)
+			fmt.Printf("%s---\n", out)
+			continue
+		}
+
+		// Group the steps by key, keeping them in order of precedence.
+		sort.SliceStable(steps, func(i, j int) bool { return steps[i].Path < steps[j].Path })
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "KEY\tSOURCE\tMERGE\n")
+		for _, step := range steps {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", step.Path, step.Source, step.How)
+		}
+		w.Flush()
+		fmt.Println()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/kubectl"
+	"github.com/appnexus/ankh/util"
+)
+
+const defaultWaitTimeout = "10m"
+const defaultApplyWaitTimeout = "5m"
+
+// waitForObjects waits for each of ctx.Options.WaitConditions to be met by
+// the objects in helmOutput that it applies to, in order. Every namespace
+// shares the deadline of ctx.Options.WaitDeadline, and ankh exits with
+// exitWaitTimeout if it passes.
+func waitForObjects(ctx *ankh.ExecutionContext, namespace string, helmOutput string) {
+	for _, condition := range ctx.Options.WaitConditions {
+		objects := kubectl.WaitObjects(helmOutput, condition)
+		if len(objects) == 0 {
+			ctx.Logger.Debugf("No objects to wait for `%v` in namespace \"%v\"", condition, namespace)
+			continue
+		}
+
+		remaining := time.Until(ctx.Options.WaitDeadline).Round(time.Second)
+		if remaining <= 0 {
+			ctx.Logger.Errorf("Timed out after %v waiting for `%v` in namespace \"%v\"", ctx.Options.WaitTimeout, condition, namespace)
+			exit(exitWaitTimeout)
+		}
+		ctx.Logger.Infof("Waiting up to %v for `%v` of %v object(s) in namespace \"%v\"", remaining, condition, len(objects), namespace)
+		if err := kubectl.Wait(ctx, namespace, condition, objects, remaining); err != nil {
+			if time.Now().After(ctx.Options.WaitDeadline) {
+				ctx.Logger.Errorf("Timed out after %v: %v", ctx.Options.WaitTimeout, err)
+				exit(exitWaitTimeout)
+			}
+			fatalf(exitFailure, "%v", err)
+		}
+	}
+	ctx.Logger.Infof("Finished waiting for objects in namespace \"%v\"", namespace)
+}
+
+// waitForApply tracks each Deployment, StatefulSet, DaemonSet and Job in
+// helmOutput after `apply --wait`, at the same time, until it's healthy or
+// ctx.Options.WaitTimeout passes. It reports on every workload, and then
+// returns an error if any of them didn't become healthy.
+func waitForApply(ctx *ankh.ExecutionContext, namespace string, helmOutput string) error {
+	type workload struct {
+		condition, object string
+	}
+	workloads := []workload{}
+	for _, condition := range []string{kubectl.WaitRollout, kubectl.WaitComplete} {
+		for _, object := range kubectl.WaitObjects(helmOutput, condition) {
+			workloads = append(workloads, workload{condition, object})
+		}
+	}
+	if len(workloads) == 0 {
+		return nil
+	}
+
+	ctx.Options.WaitDeadline = time.Now().Add(ctx.Options.WaitTimeout)
+	ctx.Logger.Infof("Waiting up to %v for %v workload(s) in namespace \"%v\" to become healthy", ctx.Options.WaitTimeout, len(workloads), namespace)
+	errs := make([]error, len(workloads))
+	pool := util.NewPool(ctx.ConcurrencyLimit(ankh.KubernetesConcurrency))
+	for i, w := range workloads {
+		i, w := i, w
+		pool.Go(func() {
+			errs[i] = kubectl.Wait(ctx, namespace, w.condition, []string{w.object}, ctx.Options.WaitTimeout)
+		})
+	}
+	pool.Wait()
+
+	failed := 0
+	for i, w := range workloads {
+		if errs[i] != nil {
+			ctx.Logger.Errorf("%v", errs[i])
+			failed++
+			continue
+		}
+		ctx.Logger.Infof("%v in namespace \"%v\" is healthy", w.object, namespace)
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v of %v workload(s) in namespace \"%v\" did not become healthy", failed, len(workloads), namespace)
+}
+
+// waitExitCode is the code to exit with when waiting fails: exitWaitTimeout
+// if the deadline passed, or else 1.
+func waitExitCode(ctx *ankh.ExecutionContext) int {
+	if time.Now().After(ctx.Options.WaitDeadline) {
+		return exitWaitTimeout
+	}
+	return 1
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// watchPollInterval is how often `ankh watch` looks for changes to local files between checks.
+const watchPollInterval = 5 * time.Second
+
+// latestModTime finds the most recent modification time of path, or of any
+// file beneath it when it's a directory, skipping hidden directories like `.git`.
+func latestModTime(path string) time.Time {
+	latest := time.Time{}
+	filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && p != path && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
+
+// waitForChange sleeps until interval has passed, or until a file under dir
+// changes after since, returning the latest modification time it saw.
+func waitForChange(dir string, since time.Time, interval time.Duration) (time.Time, bool) {
+	deadline := time.Now().Add(interval)
+	for time.Now().Before(deadline) {
+		sleep := watchPollInterval
+		if remaining := time.Until(deadline); remaining < sleep {
+			sleep = remaining
+		}
+		time.Sleep(sleep)
+		if dir == "" {
+			continue
+		}
+		if latest := latestModTime(dir); latest.After(since) {
+			return latest, true
+		}
+	}
+	return since, false
+}
+
+// applyTarget applies target in an ankh subprocess, streaming its output.
+func applyTarget(ctx *ankh.ExecutionContext, self string, target ankh.DriftTarget) error {
+	args := append(targetArgs(ctx, target), "--no-prompt", "apply", "-f", target.AnkhFile)
+	cmd := exec.Command(self, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	ctx.Logger.Debugf("Running %v", strings.Join(cmd.Args, " "))
+	record := ctx.StartCommand(cmd)
+	err := cmd.Run()
+	record.Finish(err)
+	return err
+}
+
+// watchAnkhFile re-renders target and checks it for drift every interval,
+// and whenever a file beside a local Ankh file changes. Drift is reported
+// like `ankh watch-drift` does, and applied when autoApply is set.
+func watchAnkhFile(ctx *ankh.ExecutionContext, target ankh.DriftTarget, interval time.Duration, autoApply bool) {
+	self, err := os.Executable()
+	check(err)
+
+	w := &driftWatcher{
+		ctx:        ctx,
+		self:       self,
+		targets:    []ankh.DriftTarget{target},
+		webhookURL: ctx.AnkhConfig.Drift.WebhookURL,
+		results:    make(map[string]driftResult),
+		notified:   make(map[string][]string),
+	}
+
+	dir := ""
+	if !strings.HasPrefix(target.AnkhFile, "http://") && !strings.HasPrefix(target.AnkhFile, "https://") {
+		dir = filepath.Dir(target.AnkhFile)
+	}
+	lastModified := latestModTime(dir)
+
+	name := driftTargetName(target)
+	for {
+		drifted, failed := w.run()
+		if drifted && !failed && autoApply {
+			ctx.Logger.Infof("Applying %v to resolve drift", name)
+			if err := applyTarget(ctx, self, target); err != nil {
+				ctx.Logger.Errorf("Failed to apply %v: %v", name, err)
+			} else {
+				message := fmt.Sprintf("Applied %v automatically to resolve drift", name)
+				if err := ctx.Audit(ankh.AuditEntry{Context: target.Context, Message: message}); err != nil {
+					ctx.Logger.Warnf("Failed to write to audit log: %v", err)
+				}
+				// Check again right away, so that the drift is reported as resolved.
+				w.run()
+			}
+		}
+
+		ctx.Logger.Infof("Checking %v again in %v, or when its files change", name, interval)
+		changed := false
+		lastModified, changed = waitForChange(dir, lastModified, interval)
+		if changed {
+			ctx.Logger.Infof("Files for %v changed", name)
+		}
+	}
+}
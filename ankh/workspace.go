@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// defaultAnkhFilePath is the `-f` that commands default to, which a workspace's Ankh files replace.
+const defaultAnkhFilePath = "ankh.yaml"
+
+// workspaceDir holds workspace files, which `--workspace` selects by name.
+var workspaceDir = path.Join(os.Getenv("HOME"), ".ankh", "workspaces")
+
+// printWorkspaces prints each workspace in workspaceDir, with where it runs
+// and how many Ankh files it has.
+func printWorkspaces() {
+	names, err := ankh.ListWorkspaces(workspaceDir)
+	check(err)
+	if len(names) == 0 {
+		log.Infof("No workspaces found in %v", workspaceDir)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tTARGET\tANKH FILES\n")
+	for _, name := range names {
+		workspace, err := ankh.ParseWorkspace(ankh.WorkspacePath(workspaceDir, name))
+		if err != nil {
+			log.Warnf("%v", err)
+			continue
+		}
+		target := "<current-context>"
+		if workspace.Environment != "" {
+			target = "environment " + workspace.Environment
+		} else if workspace.Context != "" {
+			target = "context " + workspace.Context
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", name, target, len(workspace.AnkhFiles))
+	}
+	w.Flush()
+}
+
+// viewWorkspace prints the workspace called name, or the selected one, with
+// its Ankh files resolved.
+func viewWorkspace(ctx *ankh.ExecutionContext, name string) {
+	workspace := ctx.Workspace
+	if name != "" {
+		w, err := ankh.ParseWorkspace(ankh.WorkspacePath(workspaceDir, name))
+		check(err)
+		workspace = &w
+	}
+	if workspace == nil {
+		fatalf(exitConfigError, "No workspace selected. Pass a workspace name, or use `ankh --workspace NAME workspace view`")
+	}
+
+	out, err := yaml.Marshal(workspace)
+	check(err)
+	fmt.Printf("# %v\n%v", workspace.Path, strings.TrimPrefix(string(out), "---\n"))
+}
@@ -0,0 +1,367 @@
+// Package aws finds AWS credentials the way the AWS CLI does, and signs
+// requests to AWS APIs with them, for S3 helm registries and ECR, without
+// the weight of the AWS SDK.
+package aws
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is when temporary credentials, eg: from an instance role, expire.
+	Expires time.Time
+}
+
+// parseINI parses the sections of an AWS CLI config or credentials file.
+func parseINI(body string) map[string]map[string]string {
+	sections := make(map[string]map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		tokens := strings.SplitN(line, "=", 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		if sections[section] == nil {
+			sections[section] = make(map[string]string)
+		}
+		sections[section][strings.TrimSpace(tokens[0])] = strings.TrimSpace(tokens[1])
+	}
+	return sections
+}
+
+func awsFile(env string, name string) map[string]map[string]string {
+	path := os.Getenv(env)
+	if path == "" {
+		path = filepath.Join(os.Getenv("HOME"), ".aws", name)
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return parseINI(string(body))
+}
+
+func profile() string {
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// Region is the region from the environment, or the AWS CLI config for
+// AWS_PROFILE, defaulting to us-east-1.
+func Region() string {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(env); region != "" {
+			return region
+		}
+	}
+	config := awsFile("AWS_CONFIG_FILE", "config")
+	name := profile()
+	if name != "default" {
+		name = "profile " + name
+	}
+	if region := config[name]["region"]; region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+// The credentials found by LoadCredentials from a role, which are reused
+// until they're about to expire. Not finding any is remembered too, so that
+// runs outside of AWS only wait on the instance metadata service once.
+var roleCredentials *Credentials
+var roleCredentialsLoaded bool
+var roleCredentialsMtx sync.Mutex
+
+// LoadCredentials finds credentials where the AWS CLI does: in the
+// environment, in the shared credentials file for AWS_PROFILE, from a web
+// identity token (eg: EKS's IAM roles for service accounts), from the
+// container credentials endpoint (eg: ECS task roles), and from the EC2
+// instance metadata service. It returns nil when there aren't any.
+func LoadCredentials() *Credentials {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return &Credentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if profile := awsFile("AWS_SHARED_CREDENTIALS_FILE", "credentials")[profile()]; profile["aws_access_key_id"] != "" {
+		return &Credentials{
+			AccessKeyID:     profile["aws_access_key_id"],
+			SecretAccessKey: profile["aws_secret_access_key"],
+			SessionToken:    profile["aws_session_token"],
+		}
+	}
+	if os.Getenv("AWS_PROFILE") != "" {
+		// A profile was asked for, so don't fall back to a role.
+		return nil
+	}
+
+	roleCredentialsMtx.Lock()
+	defer roleCredentialsMtx.Unlock()
+	if roleCredentialsLoaded && (roleCredentials == nil || time.Now().Add(5*time.Minute).Before(roleCredentials.Expires)) {
+		return roleCredentials
+	}
+	roleCredentials, roleCredentialsLoaded = nil, true
+	for _, load := range []func() (*Credentials, error){webIdentityCredentials, containerCredentials, instanceCredentials} {
+		if creds, err := load(); err == nil && creds != nil {
+			roleCredentials = creds
+			break
+		}
+	}
+	return roleCredentials
+}
+
+// metadataClient gives up quickly on the metadata endpoints, which are only
+// there when running in AWS.
+var metadataClient = &http.Client{Timeout: time.Second}
+
+type roleCredentialsResponse struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (r roleCredentialsResponse) credentials() *Credentials {
+	return &Credentials{AccessKeyID: r.AccessKeyId, SecretAccessKey: r.SecretAccessKey, SessionToken: r.Token, Expires: r.Expiration}
+}
+
+func getJSON(req *http.Request, v interface{}) error {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v returned %v", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// containerCredentials are the credentials of an ECS task role, or an EKS pod identity.
+func containerCredentials() (*Credentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = "http://169.254.170.2" + relative
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(body))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	response := roleCredentialsResponse{}
+	if err := getJSON(req, &response); err != nil {
+		return nil, err
+	}
+	return response.credentials(), nil
+}
+
+// instanceMetadataEndpoint is the EC2 instance metadata service.
+var instanceMetadataEndpoint = "http://169.254.169.254"
+
+// instanceCredentials are the credentials of the EC2 instance's role, from the
+// instance metadata service, using IMDSv2.
+func instanceCredentials() (*Credentials, error) {
+	if strings.ToLower(os.Getenv("AWS_EC2_METADATA_DISABLED")) == "true" {
+		return nil, nil
+	}
+	req, err := http.NewRequest("PUT", instanceMetadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	token, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the instance metadata service returned %v", resp.Status)
+	}
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequest("GET", instanceMetadataEndpoint+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err == nil {
+			req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		}
+		return req, err
+	}
+	req, err = get("")
+	if err != nil {
+		return nil, err
+	}
+	resp, err = metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	role, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(bytes.TrimSpace(role)) == 0 {
+		return nil, nil
+	}
+
+	req, err = get(strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0]))
+	if err != nil {
+		return nil, err
+	}
+	response := roleCredentialsResponse{}
+	if err := getJSON(req, &response); err != nil {
+		return nil, err
+	}
+	return response.credentials(), nil
+}
+
+// stsEndpoint is where webIdentityCredentials assumes roles, for region.
+var stsEndpoint = func(region string) string {
+	return fmt.Sprintf("https://sts.%v.amazonaws.com/", region)
+}
+
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      time.Time
+	} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+// webIdentityCredentials assume AWS_ROLE_ARN with the token in
+// AWS_WEB_IDENTITY_TOKEN_FILE, as EKS's IAM roles for service accounts set up.
+func webIdentityCredentials() (*Credentials, error) {
+	tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if tokenFile == "" || role == "" {
+		return nil, nil
+	}
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = fmt.Sprintf("ankh-%v", time.Now().Unix())
+	}
+	form := url.Values{}
+	form.Set("Action", "AssumeRoleWithWebIdentity")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", role)
+	form.Set("RoleSessionName", session)
+	form.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).PostForm(stsEndpoint(Region()), form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("assuming role %v returned %v", role, resp.Status)
+	}
+	response := assumeRoleWithWebIdentityResponse{}
+	if err := xml.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	c := response.Credentials
+	return &Credentials{AccessKeyID: c.AccessKeyId, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken, Expires: c.Expiration}, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// SignRequest signs req, whose payload is body, for service in region with
+// AWS Signature Version 4, over the host and every header already set on it.
+func SignRequest(req *http.Request, body []byte, creds Credentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := fmt.Sprintf("%v/%v/%v/aws4_request", amzDate[:8], region, service)
+	payloadHash := sha256.Sum256(body)
+	payloadSHA256 := hex.EncodeToString(payloadHash[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadSHA256)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadSHA256,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
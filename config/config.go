@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
 )
 
 type ConfigMap struct {
@@ -25,15 +28,7 @@ func GetAnkhConfig(ctx *ankh.ExecutionContext, configPath string) (ankh.AnkhConf
 
 	body := []byte{}
 	if u.Scheme == "http" || u.Scheme == "https" {
-		resp, err := http.Get(configPath)
-		if err != nil {
-			return ankhConfig, fmt.Errorf("Unable to fetch ankh config from URL '%s': %v", configPath, err)
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			return ankhConfig, fmt.Errorf("Non-200 status code when fetching ankh config from URL '%s': %v", configPath, resp.Status)
-		}
-		body, err = ioutil.ReadAll(resp.Body)
+		body, err = getRemoteConfig(ctx, configPath)
 	} else {
 		body, err = ioutil.ReadFile(configPath)
 	}
@@ -64,3 +59,142 @@ func GetAnkhConfig(ctx *ankh.ExecutionContext, configPath string) (ankh.AnkhConf
 
 	return ankhConfig, nil
 }
+
+// LocalConfigPath returns the ankh config that configuration changes are
+// written to, which is the first path in ctx.AnkhConfigPath. Remote configs
+// can't be written to.
+func LocalConfigPath(ctx *ankh.ExecutionContext) (string, error) {
+	configPath := strings.Split(ctx.AnkhConfigPath, ",")[0]
+	u, err := url.Parse(configPath)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse configPath '%v' as a URL: %v", configPath, err)
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return "", fmt.Errorf("Cannot write to remote ankh config '%v'. Put a local ankh config first in ANKHCONFIG", configPath)
+	}
+	return configPath, nil
+}
+
+var currentContextRegexp = regexp.MustCompile(`(?m)^current-context:.*$`)
+
+// SetCurrentContext persists `current-context` to the ankh config at configPath.
+// Only that line is rewritten, so the rest of the file (including comments) is left untouched.
+func SetCurrentContext(configPath string, name string) error {
+	body, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Unable to read ankh config '%s', consider using `ankh config init`: %v", configPath, err)
+	}
+
+	out, err := yaml.Marshal(map[string]string{"current-context": name})
+	if err != nil {
+		return err
+	}
+	line := strings.TrimSpace(string(out))
+
+	content := string(body)
+	if currentContextRegexp.MatchString(content) {
+		content = currentContextRegexp.ReplaceAllLiteralString(content, line)
+	} else {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += line + "\n"
+	}
+
+	return ioutil.WriteFile(configPath, []byte(content), 0644)
+}
+
+// readKubeConfigs reads each of the kubeconfigs in kubeConfigPath, which may
+// be a list of paths, like KUBECONFIG.
+func readKubeConfigs(kubeConfigPath string) ([]ankh.KubeConfig, error) {
+	kubeConfigs := []ankh.KubeConfig{}
+	for _, p := range filepath.SplitList(kubeConfigPath) {
+		if p == "" {
+			continue
+		}
+
+		body, err := ioutil.ReadFile(p)
+		if err != nil {
+			return kubeConfigs, fmt.Errorf("Unable to read kubeconfig '%s': %v", p, err)
+		}
+
+		kubeConfig := ankh.KubeConfig{}
+		if err := yaml.Unmarshal(body, &kubeConfig); err != nil {
+			return kubeConfigs, fmt.Errorf("Error loading kubeconfig '%s': %v", p, err)
+		}
+		kubeConfigs = append(kubeConfigs, kubeConfig)
+	}
+	return kubeConfigs, nil
+}
+
+// KubeConfigContexts returns the names of the contexts in a kubeconfig. Like
+// KUBECONFIG, kubeConfigPath may be a list of paths, whose contexts are merged.
+func KubeConfigContexts(kubeConfigPath string) ([]string, error) {
+	names := []string{}
+	kubeConfigs, err := readKubeConfigs(kubeConfigPath)
+	for _, kubeConfig := range kubeConfigs {
+		for _, context := range kubeConfig.Contexts {
+			if !util.Contains(names, context.Name) {
+				names = append(names, context.Name)
+			}
+		}
+	}
+	return names, err
+}
+
+// KubeConfigServers maps the names of the contexts in a kubeconfig to the
+// servers of their clusters. As with kubectl, the first kubeconfig in
+// kubeConfigPath to define a context or cluster wins.
+func KubeConfigServers(kubeConfigPath string) (map[string]string, error) {
+	kubeConfigs, err := readKubeConfigs(kubeConfigPath)
+	clusters := make(map[string]string)
+	contexts := make(map[string]string)
+	for _, kubeConfig := range kubeConfigs {
+		for _, cluster := range kubeConfig.Clusters {
+			if _, ok := clusters[cluster.Name]; !ok {
+				clusters[cluster.Name] = cluster.Cluster.Server
+			}
+		}
+		for _, context := range kubeConfig.Contexts {
+			if _, ok := contexts[context.Name]; !ok {
+				contexts[context.Name] = context.Context.Cluster
+			}
+		}
+	}
+
+	servers := make(map[string]string)
+	for name, cluster := range contexts {
+		servers[name] = clusters[cluster]
+	}
+	return servers, err
+}
+
+// KubeConfigExecPlugins maps the names of the contexts in a kubeconfig whose
+// users get credentials from an exec plugin that may prompt, eg: for a device
+// or browser login, to the plugin's command. Plugins with an `interactiveMode`
+// of `Never` are left out.
+func KubeConfigExecPlugins(kubeConfigPath string) (map[string]string, error) {
+	kubeConfigs, err := readKubeConfigs(kubeConfigPath)
+	users := make(map[string]*ankh.KubeExec)
+	contexts := make(map[string]string)
+	for _, kubeConfig := range kubeConfigs {
+		for _, user := range kubeConfig.Users {
+			if _, ok := users[user.Name]; !ok {
+				users[user.Name] = user.User.Exec
+			}
+		}
+		for _, context := range kubeConfig.Contexts {
+			if _, ok := contexts[context.Name]; !ok {
+				contexts[context.Name] = context.Context.User
+			}
+		}
+	}
+
+	plugins := make(map[string]string)
+	for name, user := range contexts {
+		if exec := users[user]; exec != nil && exec.InteractiveMode != "Never" {
+			plugins[name] = exec.Command
+		}
+	}
+	return plugins, err
+}
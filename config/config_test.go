@@ -56,3 +56,85 @@ func TestGetAnkhConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestSetCurrentContext(t *testing.T) {
+	t.Run("replaces existing current-context", func(t *testing.T) {
+		tmpFile, _ := ioutil.TempFile("", "")
+		tmpFile.WriteString("# my config\ncurrent-context: old\ncontexts: {}\n")
+		tmpFile.Close()
+
+		if err := SetCurrentContext(tmpFile.Name(), "new"); err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+
+		body, _ := ioutil.ReadFile(tmpFile.Name())
+		expected := "# my config\ncurrent-context: new\ncontexts: {}\n"
+		if string(body) != expected {
+			t.Logf("expected '%v' but got '%v'", expected, string(body))
+			t.Fail()
+		}
+	})
+
+	t.Run("appends missing current-context", func(t *testing.T) {
+		tmpFile, _ := ioutil.TempFile("", "")
+		tmpFile.WriteString("contexts: {}")
+		tmpFile.Close()
+
+		if err := SetCurrentContext(tmpFile.Name(), "new"); err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+
+		body, _ := ioutil.ReadFile(tmpFile.Name())
+		expected := "contexts: {}\ncurrent-context: new\n"
+		if string(body) != expected {
+			t.Logf("expected '%v' but got '%v'", expected, string(body))
+			t.Fail()
+		}
+	})
+
+	t.Run("remote configs are not writable", func(t *testing.T) {
+		ctx := &ankh.ExecutionContext{AnkhConfigPath: "https://example.com/ankh.yaml,/tmp/ankh.yaml"}
+		if _, err := LocalConfigPath(ctx); err == nil {
+			t.Log("expected to find an error but didnt get one")
+			t.Fail()
+		}
+	})
+}
+
+func TestKubeConfigContexts(t *testing.T) {
+	names, err := KubeConfigContexts("testdata/kubeconfig.yaml:testdata/kubeconfig.yaml")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(names) != 2 || names[0] != "minikube" || names[1] != "prod-east" {
+		t.Logf("expected contexts [minikube prod-east] but got %v", names)
+		t.Fail()
+	}
+}
+
+func TestKubeConfigServers(t *testing.T) {
+	servers, err := KubeConfigServers("testdata/kubeconfig.yaml")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(servers) != 2 || servers["minikube"] != "https://192.168.99.100:8443" || servers["prod-east"] != "https://prod-east.example.com" {
+		t.Logf("unexpected servers %v", servers)
+		t.Fail()
+	}
+}
+
+func TestKubeConfigExecPlugins(t *testing.T) {
+	plugins, err := KubeConfigExecPlugins("testdata/kubeconfig.yaml")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(plugins) != 1 || plugins["prod-east"] != "kubelogin" {
+		t.Logf("unexpected exec plugins %v", plugins)
+		t.Fail()
+	}
+}
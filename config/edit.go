@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// The functions in this file edit the `contexts` section of a local ankh config
+// line by line, rather than round-tripping the whole file through yaml, so that
+// comments and formatting outside of the edited context are preserved.
+
+var contextsKeyRegexp = regexp.MustCompile(`^contexts:\s*(\{\s*\})?\s*(#.*)?$`)
+var inlineContextsRegexp = regexp.MustCompile(`(?m)^contexts:`)
+
+type contextEntry struct {
+	Name         string
+	Start, End   int // lines [Start, End) hold this context
+	CommentStart int // comments directly above the context start here
+}
+
+type contextsBlock struct {
+	Lines       []string
+	Start, End  int // lines [Start, End) follow the `contexts:` key
+	Indent      string
+	Entries     []contextEntry
+	KeyLine     int // the `contexts:` key, or -1 if missing
+	InlineEmpty bool
+}
+
+func indentOf(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " "))]
+}
+
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+var contextKeyRegexp = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s"'#-][^:]*):(\s.*)?$`)
+
+// parseContextKey returns the context name, and anything following it, from a
+// line like `  name:` at the expected indent.
+func parseContextKey(line string, indent string) (string, string, bool) {
+	if indentOf(line) != indent {
+		return "", "", false
+	}
+	m := contextKeyRegexp.FindStringSubmatch(strings.TrimPrefix(line, indent))
+	if m == nil {
+		return "", "", false
+	}
+	name := ""
+	if err := yaml.Unmarshal([]byte(m[1]), &name); err != nil || name == "" {
+		return "", "", false
+	}
+	return name, m[2], true
+}
+
+func parseContextsBlock(body string) contextsBlock {
+	block := contextsBlock{
+		Lines:   strings.Split(strings.TrimSuffix(body, "\n"), "\n"),
+		KeyLine: -1,
+		Indent:  "  ",
+	}
+
+	for i, line := range block.Lines {
+		if m := contextsKeyRegexp.FindStringSubmatch(line); m != nil {
+			block.KeyLine = i
+			block.InlineEmpty = m[1] != ""
+			break
+		}
+	}
+	if block.KeyLine == -1 {
+		block.Start = len(block.Lines)
+		block.End = len(block.Lines)
+		return block
+	}
+
+	block.Start = block.KeyLine + 1
+	block.End = len(block.Lines)
+	for i := block.Start; i < len(block.Lines); i++ {
+		line := block.Lines[i]
+		if !isBlankOrComment(line) && indentOf(line) == "" {
+			block.End = i
+			break
+		}
+	}
+
+	// Trailing blank lines and comments belong to whatever follows the block.
+	for block.End > block.Start && isBlankOrComment(block.Lines[block.End-1]) {
+		block.End--
+	}
+
+	for i := block.Start; i < block.End; i++ {
+		if !isBlankOrComment(block.Lines[i]) {
+			block.Indent = indentOf(block.Lines[i])
+			break
+		}
+	}
+
+	for i := block.Start; i < block.End; i++ {
+		name, _, ok := parseContextKey(block.Lines[i], block.Indent)
+		if !ok {
+			continue
+		}
+		block.Entries = append(block.Entries, contextEntry{Name: name, Start: i})
+	}
+	for i := range block.Entries {
+		entry := &block.Entries[i]
+		entry.End = block.End
+		if i+1 < len(block.Entries) {
+			entry.End = block.Entries[i+1].Start
+		}
+		// Comments directly above the next context belong to it.
+		for entry.End > entry.Start+1 && isBlankOrComment(block.Lines[entry.End-1]) {
+			entry.End--
+		}
+		entry.CommentStart = entry.Start
+		for entry.CommentStart > block.Start && strings.HasPrefix(strings.TrimSpace(block.Lines[entry.CommentStart-1]), "#") {
+			entry.CommentStart--
+		}
+	}
+
+	return block
+}
+
+func (block contextsBlock) find(name string) (contextEntry, bool) {
+	for _, entry := range block.Entries {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return contextEntry{}, false
+}
+
+func (block contextsBlock) splice(start, end int, replacement []string) string {
+	lines := append([]string{}, block.Lines[:start]...)
+	lines = append(lines, replacement...)
+	lines = append(lines, block.Lines[end:]...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func marshalContext(name string, context ankh.Context, indent string) ([]string, error) {
+	out, err := yaml.Marshal(yaml.MapSlice{{Key: name, Value: context}})
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		lines = append(lines, indent+line)
+	}
+	return lines, nil
+}
+
+func readConfigFile(configPath string) (string, error) {
+	body, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read ankh config '%s', consider using `ankh config init`: %v", configPath, err)
+	}
+	return string(body), nil
+}
+
+// GetLocalContext returns the context with the given name defined directly in the ankh config at configPath.
+func GetLocalContext(configPath string, name string) (ankh.Context, bool, error) {
+	body, err := readConfigFile(configPath)
+	if err != nil {
+		return ankh.Context{}, false, err
+	}
+
+	ankhConfig := ankh.AnkhConfig{}
+	if err := yaml.Unmarshal([]byte(body), &ankhConfig); err != nil {
+		return ankh.Context{}, false, fmt.Errorf("Error loading ankh config '%s': %v", configPath, err)
+	}
+
+	context, ok := ankhConfig.Contexts[name]
+	return context, ok, nil
+}
+
+// SetContext creates or replaces a context in the ankh config at configPath.
+func SetContext(configPath string, name string, context ankh.Context) error {
+	body, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	block := parseContextsBlock(body)
+
+	lines, err := marshalContext(name, context, block.Indent)
+	if err != nil {
+		return err
+	}
+
+	if entry, ok := block.find(name); ok {
+		return ioutil.WriteFile(configPath, []byte(block.splice(entry.Start, entry.End, lines)), 0644)
+	}
+
+	if block.KeyLine == -1 {
+		if inlineContextsRegexp.MatchString(body) {
+			return fmt.Errorf("Unable to edit `contexts` in ankh config '%v', since it is written inline. Rewrite it as a block mapping first", configPath)
+		}
+		lines = append([]string{"contexts:"}, lines...)
+		if strings.TrimSpace(body) == "" {
+			block.Lines = []string{}
+			block.Start, block.End = 0, 0
+		}
+		return ioutil.WriteFile(configPath, []byte(block.splice(block.End, block.End, lines)), 0644)
+	}
+
+	if block.InlineEmpty {
+		block.Lines[block.KeyLine] = "contexts:"
+	}
+	return ioutil.WriteFile(configPath, []byte(block.splice(block.End, block.End, lines)), 0644)
+}
+
+// DeleteContext removes a context from the ankh config at configPath.
+func DeleteContext(configPath string, name string) error {
+	body, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	block := parseContextsBlock(body)
+
+	end := block.End
+	entry := contextEntry{}
+	found := false
+	for i, e := range block.Entries {
+		if e.Name == name {
+			entry = e
+			found = true
+			if i+1 < len(block.Entries) {
+				end = block.Entries[i+1].CommentStart
+			}
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("Context '%v' not found in `contexts` of ankh config '%v'", name, configPath)
+	}
+
+	if len(block.Entries) == 1 {
+		// Leave behind a valid, empty map rather than a null `contexts`.
+		block.Lines[block.KeyLine] = "contexts: {}"
+	}
+	return ioutil.WriteFile(configPath, []byte(block.splice(entry.CommentStart, end, nil)), 0644)
+}
+
+// EnvironmentsUsingContext lists the environments whose `contexts` include name.
+func EnvironmentsUsingContext(environments map[string]ankh.Environment, name string) []string {
+	using := []string{}
+	for environment, e := range environments {
+		for _, context := range e.Contexts {
+			if context == name {
+				using = append(using, environment)
+				break
+			}
+		}
+	}
+	sort.Strings(using)
+	return using
+}
+
+// RenameContext renames a context in the ankh config at configPath, leaving its contents untouched.
+// Contexts that environments in the config refer to are not renamed, since the environments would
+// be left referring to a context that no longer exists.
+func RenameContext(configPath string, oldName string, newName string) error {
+	body, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	config := struct {
+		Environments map[string]ankh.Environment `yaml:"environments"`
+	}{}
+	if err := yaml.Unmarshal([]byte(body), &config); err != nil {
+		return fmt.Errorf("Unable to parse ankh config '%v': %v", configPath, err)
+	}
+	if using := EnvironmentsUsingContext(config.Environments, oldName); len(using) > 0 {
+		return fmt.Errorf("Context '%v' is in the `contexts` of environments [ %v ] in ankh config '%v'. "+
+			"Remove it from them before renaming it, and add the new name after", oldName, strings.Join(using, ", "), configPath)
+	}
+	block := parseContextsBlock(body)
+
+	entry, ok := block.find(oldName)
+	if !ok {
+		return fmt.Errorf("Context '%v' not found in `contexts` of ankh config '%v'", oldName, configPath)
+	}
+	if _, ok := block.find(newName); ok {
+		return fmt.Errorf("Context '%v' already exists in `contexts` of ankh config '%v'", newName, configPath)
+	}
+
+	out, err := yaml.Marshal(newName)
+	if err != nil {
+		return err
+	}
+	_, rest, _ := parseContextKey(block.Lines[entry.Start], block.Indent)
+	header := block.Indent + strings.TrimSpace(string(out)) + ":" + rest
+	return ioutil.WriteFile(configPath, []byte(block.splice(entry.Start, entry.Start+1, []string{header})), 0644)
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const editTestConfig = `# Team ankh config
+include:
+- https://example.com/shared.yaml
+
+contexts:
+  # Local development
+  dev:
+    kube-context: minikube
+    environment-class: dev
+    resource-profile: constrained
+
+  # Shared staging cluster
+  staging: # do not use for load tests
+    kube-context: staging
+    environment-class: staging
+    resource-profile: natural
+
+# Trailing comment
+helm:
+  registry: https://charts.example.com
+`
+
+func writeEditTestConfig(t *testing.T, content string) string {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.WriteString(content)
+	tmpFile.Close()
+	return tmpFile.Name()
+}
+
+func checkEditTestConfig(t *testing.T, configPath string, expected string) {
+	body, _ := ioutil.ReadFile(configPath)
+	if string(body) != expected {
+		t.Logf("expected:\n%v\nbut got:\n%v", expected, string(body))
+		t.Fail()
+	}
+}
+
+func TestSetContext(t *testing.T) {
+	t.Run("replaces an existing context", func(t *testing.T) {
+		configPath := writeEditTestConfig(t, editTestConfig)
+		err := SetContext(configPath, "dev", ankh.Context{KubeContext: "kind", EnvironmentClass: "dev", ResourceProfile: "constrained"})
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+		checkEditTestConfig(t, configPath, `# Team ankh config
+include:
+- https://example.com/shared.yaml
+
+contexts:
+  # Local development
+  dev:
+    kube-context: kind
+    environment-class: dev
+    resource-profile: constrained
+
+  # Shared staging cluster
+  staging: # do not use for load tests
+    kube-context: staging
+    environment-class: staging
+    resource-profile: natural
+
+# Trailing comment
+helm:
+  registry: https://charts.example.com
+`)
+	})
+
+	t.Run("adds a new context", func(t *testing.T) {
+		configPath := writeEditTestConfig(t, editTestConfig)
+		err := SetContext(configPath, "prod", ankh.Context{KubeContext: "prod", EnvironmentClass: "production", ResourceProfile: "natural"})
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+
+		context, ok, err := GetLocalContext(configPath, "prod")
+		if err != nil || !ok || context.KubeContext != "prod" {
+			t.Logf("expected to find context prod but got %+v (%v)", context, err)
+			t.Fail()
+		}
+		if _, ok, _ := GetLocalContext(configPath, "staging"); !ok {
+			t.Log("expected to still find context staging")
+			t.Fail()
+		}
+	})
+
+	t.Run("adds contexts to a config without any", func(t *testing.T) {
+		configPath := writeEditTestConfig(t, "contexts: {}\n")
+		err := SetContext(configPath, "dev", ankh.Context{KubeContext: "minikube", EnvironmentClass: "dev", ResourceProfile: "constrained"})
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+		checkEditTestConfig(t, configPath, `contexts:
+  dev:
+    kube-context: minikube
+    environment-class: dev
+    resource-profile: constrained
+`)
+	})
+}
+
+func TestDeleteContext(t *testing.T) {
+	configPath := writeEditTestConfig(t, editTestConfig)
+	if err := DeleteContext(configPath, "dev"); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	checkEditTestConfig(t, configPath, `# Team ankh config
+include:
+- https://example.com/shared.yaml
+
+contexts:
+  # Shared staging cluster
+  staging: # do not use for load tests
+    kube-context: staging
+    environment-class: staging
+    resource-profile: natural
+
+# Trailing comment
+helm:
+  registry: https://charts.example.com
+`)
+
+	if err := DeleteContext(configPath, "dev"); err == nil {
+		t.Log("expected to find an error but didnt get one")
+		t.Fail()
+	}
+}
+
+func TestRenameContext(t *testing.T) {
+	configPath := writeEditTestConfig(t, editTestConfig)
+	if err := RenameContext(configPath, "staging", "stage"); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if _, ok, _ := GetLocalContext(configPath, "stage"); !ok {
+		t.Log("expected to find renamed context stage")
+		t.Fail()
+	}
+
+	if err := RenameContext(configPath, "dev", "stage"); err == nil {
+		t.Log("expected to find an error but didnt get one")
+		t.Fail()
+	}
+
+	configPath = writeEditTestConfig(t, editTestConfig+"environments:\n  pre-production:\n    contexts: [dev, staging]\n")
+	err := RenameContext(configPath, "staging", "stage")
+	if err == nil || !strings.Contains(err.Error(), "environments [ pre-production ]") {
+		t.Logf("expected an error for a context that an environment uses but got %v", err)
+		t.Fail()
+	}
+	if _, ok, _ := GetLocalContext(configPath, "staging"); !ok {
+		t.Log("expected context staging to be left alone")
+		t.Fail()
+	}
+}
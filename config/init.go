@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// sampleAnkhConfig is what `ankh config init` writes when there's no starter config.
+const sampleAnkhConfig = `current-context: minikube
+contexts:
+  minikube:
+    kube-context: minikube
+    environment-class: dev
+    resource-profile: constrained
+    release: minikube
+`
+
+// StarterConfig is the config that `ankh config init` writes, or merges into
+// an existing config: the body of from, a URL or a path, or else a sample
+// config with a single context for kube-context `minikube`.
+func StarterConfig(from string) ([]byte, error) {
+	if from == "" {
+		return []byte(sampleAnkhConfig), nil
+	}
+
+	u, err := url.Parse(from)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse '%v' as a URL: %v", from, err)
+	}
+	body := []byte{}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		body, err = fetchRemoteConfig(from)
+	} else {
+		body, err = ioutil.ReadFile(from)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(body, &ankh.AnkhConfig{}); err != nil {
+		return nil, fmt.Errorf("Starter config '%v' is not a valid ankh config: %v", from, err)
+	}
+	return body, nil
+}
+
+// mergeMapSlice adds the keys of from that are missing from into, recursing
+// into maps that are in both, and returns the dotted paths of what was added.
+func mergeMapSlice(into yaml.MapSlice, from yaml.MapSlice, prefix string) (yaml.MapSlice, []string) {
+	added := []string{}
+	for _, item := range from {
+		path := fmt.Sprintf("%v%v", prefix, item.Key)
+		found := false
+		for i := range into {
+			if into[i].Key != item.Key {
+				continue
+			}
+			found = true
+			intoMap, intoOk := into[i].Value.(yaml.MapSlice)
+			fromMap, fromOk := item.Value.(yaml.MapSlice)
+			if intoOk && fromOk {
+				merged, mergedAdded := mergeMapSlice(intoMap, fromMap, path+".")
+				into[i].Value = merged
+				added = append(added, mergedAdded...)
+			}
+			break
+		}
+		if !found {
+			into = append(into, item)
+			added = append(added, path)
+		}
+	}
+	return into, added
+}
+
+// MergeAnkhConfig merges starter into existing, adding the sections and map
+// entries, like contexts, that existing doesn't have. Anything already in
+// existing is kept as it is, and `current-context` is never added, since
+// that would change which context ankh uses. Returns the merged config and
+// the dotted paths of what was added, which are empty when there was nothing
+// to merge.
+func MergeAnkhConfig(existing []byte, starter []byte) ([]byte, []string, error) {
+	existingConfig := yaml.MapSlice{}
+	if err := yaml.Unmarshal(existing, &existingConfig); err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse existing ankh config: %v", err)
+	}
+	starterConfig := yaml.MapSlice{}
+	if err := yaml.Unmarshal(starter, &starterConfig); err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse starter ankh config: %v", err)
+	}
+
+	withoutCurrentContext := yaml.MapSlice{}
+	for _, item := range starterConfig {
+		if item.Key != "current-context" {
+			withoutCurrentContext = append(withoutCurrentContext, item)
+		}
+	}
+
+	merged, added := mergeMapSlice(existingConfig, withoutCurrentContext, "")
+	if len(added) == 0 {
+		return existing, added, nil
+	}
+
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := yaml.UnmarshalStrict(out, &ankh.AnkhConfig{}); err != nil {
+		return nil, nil, fmt.Errorf("Merged ankh config is not valid: %v", err)
+	}
+	return out, added, nil
+}
+
+// BackupConfig copies the ankh config at configPath next to it, with a
+// timestamp suffix, and returns the path of the copy.
+func BackupConfig(configPath string) (string, error) {
+	backupPath := fmt.Sprintf("%v.%v.bak", configPath, time.Now().Format("20060102150405"))
+	if err := util.CopyFile(configPath, backupPath); err != nil {
+		return "", fmt.Errorf("Unable to back up ankh config '%v': %v", configPath, err)
+	}
+	return backupPath, nil
+}
+
+// InitResult is what `ankh config init` did.
+type InitResult struct {
+	Created    bool     // there was no config, so starter was written
+	Replaced   bool     // the config was replaced by starter, with force
+	BackupPath string   // where the existing config was backed up to, if it was changed
+	Added      []string // the dotted paths of what was merged into the existing config
+}
+
+// InitConfig writes starter to the ankh config at configPath, or merges it
+// into the config that's there, after backing that up. With force, an
+// existing config is replaced by starter instead. An existing config that
+// already has everything in starter is left untouched.
+func InitConfig(configPath string, starter []byte, force bool) (InitResult, error) {
+	result := InitResult{}
+	existing, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) || (err == nil && len(existing) == 0) {
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			return result, err
+		}
+		result.Created = true
+		return result, ioutil.WriteFile(configPath, starter, 0644)
+	}
+	if err != nil {
+		return result, fmt.Errorf("Unable to read ankh config '%v': %v", configPath, err)
+	}
+
+	content := starter
+	if force {
+		result.Replaced = true
+	} else {
+		content, result.Added, err = MergeAnkhConfig(existing, starter)
+		if err != nil || len(result.Added) == 0 {
+			return result, err
+		}
+	}
+
+	result.BackupPath, err = BackupConfig(configPath)
+	if err != nil {
+		return result, err
+	}
+	return result, ioutil.WriteFile(configPath, content, 0644)
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const initTestConfig = `contexts:
+  prod:
+    kube-context: prod
+    environment-class: production
+    resource-profile: natural
+helm:
+  registry: https://charts.example.com
+`
+
+const initTestStarter = `current-context: dev
+contexts:
+  prod:
+    kube-context: other
+  dev:
+    kube-context: dev
+    environment-class: dev
+    resource-profile: constrained
+helm:
+  registry: https://starter.example.com
+  tagValueName: image.tag
+`
+
+func TestMergeAnkhConfig(t *testing.T) {
+	merged, added, err := MergeAnkhConfig([]byte(initTestConfig), []byte(initTestStarter))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(added, []string{"contexts.dev", "helm.tagValueName"}) {
+		t.Logf("unexpected additions %v", added)
+		t.Fail()
+	}
+	for _, expected := range []string{"kube-context: prod", "registry: https://charts.example.com", "tagValueName: image.tag", "  dev:"} {
+		if !strings.Contains(string(merged), expected) {
+			t.Logf("expected '%v' in merged config:\n%v", expected, string(merged))
+			t.Fail()
+		}
+	}
+	if strings.Contains(string(merged), "current-context") {
+		t.Logf("expected current-context not to be merged:\n%v", string(merged))
+		t.Fail()
+	}
+
+	_, added, err = MergeAnkhConfig(merged, []byte(initTestStarter))
+	if err != nil || len(added) != 0 {
+		t.Logf("expected merging twice to add nothing, but added %v (%v)", added, err)
+		t.Fail()
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-config-init")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "ankh", "config")
+
+	starter, _ := StarterConfig("")
+	result, err := InitConfig(configPath, starter, false)
+	if err != nil || !result.Created {
+		t.Logf("expected a new config to be created but got %+v (%v)", result, err)
+		t.FailNow()
+	}
+
+	result, err = InitConfig(configPath, starter, false)
+	if err != nil || result.BackupPath != "" || len(result.Added) != 0 {
+		t.Logf("expected initializing again to change nothing but got %+v (%v)", result, err)
+		t.Fail()
+	}
+
+	result, err = InitConfig(configPath, []byte(initTestStarter), true)
+	if err != nil || !result.Replaced || result.BackupPath == "" {
+		t.Logf("expected the config to be backed up and replaced but got %+v (%v)", result, err)
+		t.FailNow()
+	}
+	backup, _ := ioutil.ReadFile(result.BackupPath)
+	body, _ := ioutil.ReadFile(configPath)
+	if string(backup) != string(starter) || string(body) != initTestStarter {
+		t.Logf("unexpected backup '%v' or config '%v'", string(backup), string(body))
+		t.Fail()
+	}
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/util"
+)
+
+// The functions in this file upgrade ankh configs and Ankh files written
+// against older schemas to the current one. They work over yaml.MapSlice so
+// that key order is preserved, and return a description of each change made.
+
+func getKey(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func setKey(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == key {
+			m[i].Value = value
+			return m
+		}
+	}
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
+
+func deleteKey(m yaml.MapSlice, key string) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == key {
+			return append(m[:i:i], m[i+1:]...)
+		}
+	}
+	return m
+}
+
+func renameKey(m yaml.MapSlice, oldKey string, newKey string) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == oldKey {
+			m[i].Key = newKey
+		}
+	}
+	return m
+}
+
+func stringList(value interface{}) []string {
+	result := []string{}
+	if list, ok := value.([]interface{}); ok {
+		for _, v := range list {
+			result = append(result, fmt.Sprintf("%v", v))
+		}
+	}
+	return result
+}
+
+// migrateContext upgrades a single context. When pinRegistry is set, contexts
+// used their own `helm-registry-url` rather than a global `helm.registry`, so
+// one that differs from the new global registry is kept using `helm-registries`.
+func migrateContext(name string, context yaml.MapSlice, globalRegistry string, fallbackRegistries []string, pinRegistry bool) (yaml.MapSlice, []string) {
+	changes := []string{}
+
+	if environment, ok := getKey(context, "environment"); ok {
+		if environmentClass, ok := getKey(context, "environment-class"); !ok || environmentClass == nil || environmentClass == "" {
+			context = deleteKey(context, "environment-class")
+			context = renameKey(context, "environment", "environment-class")
+			changes = append(changes, fmt.Sprintf("Renamed `environment` to `environment-class` in context '%v'", name))
+		} else {
+			context = deleteKey(context, "environment")
+			if environment != environmentClass {
+				changes = append(changes, fmt.Sprintf("Removed `environment` '%v' from context '%v', which was overridden by `environment-class` '%v'",
+					environment, name, environmentClass))
+			} else {
+				changes = append(changes, fmt.Sprintf("Removed `environment` from context '%v', which duplicated `environment-class`", name))
+			}
+		}
+	}
+
+	if _, ok := getKey(context, "cluster-admin"); ok {
+		context = deleteKey(context, "cluster-admin")
+		changes = append(changes, fmt.Sprintf("Removed unused `cluster-admin` from context '%v'", name))
+	}
+
+	if value, ok := getKey(context, "helm-registry-url"); ok {
+		registry := fmt.Sprintf("%v", value)
+		context = deleteKey(context, "helm-registry-url")
+		if _, ok := getKey(context, "helm-registries"); ok || !pinRegistry || value == nil || registry == globalRegistry {
+			changes = append(changes, fmt.Sprintf("Removed `helm-registry-url` from context '%v', in favor of `helm.registry`", name))
+		} else {
+			// Pin the context's registry, so that it keeps using it instead of the global one.
+			registries := append([]interface{}{registry}, toInterfaces(fallbackRegistries)...)
+			context = setKey(context, "helm-registries", registries)
+			changes = append(changes, fmt.Sprintf("Replaced `helm-registry-url` with `helm-registries` in context '%v', since it differs from `helm.registry`", name))
+		}
+	}
+
+	return context, changes
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := []interface{}{}
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
+
+// MigrateAnkhConfig upgrades an ankh config to the current schema, returning
+// the upgraded config and a description of each change made.
+func MigrateAnkhConfig(body []byte) ([]byte, []string, error) {
+	config := yaml.MapSlice{}
+	if err := yaml.Unmarshal(body, &config); err != nil {
+		return nil, nil, fmt.Errorf("Error loading ankh config: %v", err)
+	}
+
+	changes := []string{}
+	for _, key := range []string{"supported-environments", "supported-environment-classes", "supported-resource-profiles"} {
+		if _, ok := getKey(config, key); ok {
+			config = deleteKey(config, key)
+			changes = append(changes, fmt.Sprintf("Removed unused `%v`", key))
+		}
+	}
+
+	value, _ := getKey(config, "contexts")
+	contexts, _ := value.(yaml.MapSlice)
+
+	helm := yaml.MapSlice{}
+	if value, ok := getKey(config, "helm"); ok && value != nil {
+		m, ok := value.(yaml.MapSlice)
+		if !ok {
+			return nil, nil, fmt.Errorf("Error loading ankh config: `helm` must be a map")
+		}
+		helm = m
+	}
+	globalRegistry := ""
+	if value, ok := getKey(helm, "registry"); ok && value != nil {
+		globalRegistry = fmt.Sprintf("%v", value)
+	}
+	fallbackRegistries, _ := getKey(helm, "fallbackRegistries")
+
+	// Registries moved from each context to the global `helm` config. Use the first context's registry.
+	pinRegistry := globalRegistry == ""
+	if pinRegistry {
+		for _, item := range contexts {
+			context, _ := item.Value.(yaml.MapSlice)
+			if value, ok := getKey(context, "helm-registry-url"); ok && value != nil && value != "" {
+				globalRegistry = fmt.Sprintf("%v", value)
+				helm = setKey(helm, "registry", globalRegistry)
+				config = setKey(config, "helm", helm)
+				changes = append(changes, fmt.Sprintf("Moved `helm-registry-url` '%v' from context '%v' to `helm.registry`", globalRegistry, item.Key))
+				break
+			}
+		}
+	}
+
+	for i, item := range contexts {
+		context, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		migrated, contextChanges := migrateContext(fmt.Sprintf("%v", item.Key), context, globalRegistry, stringList(fallbackRegistries), pinRegistry)
+		contexts[i].Value = migrated
+		changes = append(changes, contextChanges...)
+	}
+
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, changes, nil
+}
+
+// MigrateAnkhFile upgrades an Ankh file to the current schema, returning the
+// upgraded Ankh file and a description of each change made.
+func MigrateAnkhFile(body []byte) ([]byte, []string, error) {
+	ankhFile := yaml.MapSlice{}
+	if err := yaml.Unmarshal(body, &ankhFile); err != nil {
+		return nil, nil, fmt.Errorf("Error loading Ankh file: %v", err)
+	}
+
+	changes := []string{}
+	if value, ok := getKey(ankhFile, "admin-dependencies"); ok {
+		// Admin dependencies were only applied to `cluster-admin` contexts, which no longer exist.
+		existing, _ := getKey(ankhFile, "dependencies")
+		dependencies := stringList(existing)
+		for _, dependency := range stringList(value) {
+			if !util.Contains(dependencies, dependency) {
+				dependencies = append(dependencies, dependency)
+			}
+		}
+		ankhFile = deleteKey(ankhFile, "admin-dependencies")
+		if len(dependencies) > 0 {
+			ankhFile = setKey(ankhFile, "dependencies", toInterfaces(dependencies))
+		}
+		changes = append(changes, "Merged `admin-dependencies` into `dependencies`")
+	}
+
+	if _, ok := getKey(ankhFile, "bootstrap"); ok {
+		ankhFile = deleteKey(ankhFile, "bootstrap")
+		changes = append(changes, "Removed unused `bootstrap`. Run any bootstrap scripts by hand")
+	}
+
+	out, err := yaml.Marshal(ankhFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, changes, nil
+}
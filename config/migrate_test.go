@@ -0,0 +1,148 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestMigrateAnkhConfig(t *testing.T) {
+	t.Run("moves registries and renames keys", func(t *testing.T) {
+		body := `supported-environments: [dev, production]
+helm:
+  fallbackRegistries: [https://mirror.example.com]
+contexts:
+  dev:
+    kube-context: minikube
+    environment: dev
+    resource-profile: constrained
+    helm-registry-url: https://charts.example.com
+  production:
+    kube-context: prod
+    environment: production
+    environment-class: production
+    resource-profile: natural
+    cluster-admin: true
+    helm-registry-url: https://other-charts.example.com
+`
+		out, changes, err := MigrateAnkhConfig([]byte(body))
+		if err != nil {
+			t.Logf("got error %v", err)
+			t.Fail()
+			return
+		}
+		if len(changes) != 7 {
+			t.Logf("expected 7 changes but got %v: %+v", len(changes), changes)
+			t.Fail()
+		}
+
+		ankhConfig := ankh.AnkhConfig{}
+		if err := yaml.UnmarshalStrict(out, &ankhConfig); err != nil {
+			t.Logf("migrated config does not parse strictly: %v\n%s", err, out)
+			t.Fail()
+			return
+		}
+		if ankhConfig.Helm.Registry != "https://charts.example.com" {
+			t.Logf("expected `helm.registry` from the first context but got '%v'", ankhConfig.Helm.Registry)
+			t.Fail()
+		}
+		if len(ankhConfig.SupportedEnvironmentsUnused) != 0 {
+			t.Logf("expected `supported-environments` to be removed")
+			t.Fail()
+		}
+
+		dev := ankhConfig.Contexts["dev"]
+		if dev.EnvironmentClass != "dev" || dev.Environment != "" || dev.HelmRegistryURL != "" || len(dev.HelmRegistries) != 0 {
+			t.Logf("unexpected dev context %+v", dev)
+			t.Fail()
+		}
+
+		production := ankhConfig.Contexts["production"]
+		if production.Environment != "" || production.ClusterAdminUnused || production.HelmRegistryURL != "" {
+			t.Logf("unexpected production context %+v", production)
+			t.Fail()
+		}
+		if len(production.HelmRegistries) != 2 || production.HelmRegistries[0] != "https://other-charts.example.com" ||
+			production.HelmRegistries[1] != "https://mirror.example.com" {
+			t.Logf("expected production to keep its own registry but got %+v", production.HelmRegistries)
+			t.Fail()
+		}
+	})
+
+	t.Run("drops registries overridden by the global registry", func(t *testing.T) {
+		body := `helm:
+  registry: https://charts.example.com
+contexts:
+  dev:
+    kube-context: minikube
+    environment-class: dev
+    resource-profile: constrained
+    helm-registry-url: https://other-charts.example.com
+`
+		out, changes, err := MigrateAnkhConfig([]byte(body))
+		if err != nil || len(changes) != 1 {
+			t.Logf("expected 1 change but got %+v (err %v)", changes, err)
+			t.Fail()
+			return
+		}
+
+		ankhConfig := ankh.AnkhConfig{}
+		if err := yaml.UnmarshalStrict(out, &ankhConfig); err != nil {
+			t.Logf("migrated config does not parse strictly: %v", err)
+			t.Fail()
+			return
+		}
+		dev := ankhConfig.Contexts["dev"]
+		if dev.HelmRegistryURL != "" || len(dev.HelmRegistries) != 0 {
+			t.Logf("unexpected dev context %+v", dev)
+			t.Fail()
+		}
+	})
+
+	t.Run("leaves current configs alone", func(t *testing.T) {
+		_, changes, err := MigrateAnkhConfig([]byte("helm:\n  registry: https://charts.example.com\ncontexts: {}\n"))
+		if err != nil || len(changes) != 0 {
+			t.Logf("expected no changes but got %+v (err %v)", changes, err)
+			t.Fail()
+		}
+	})
+}
+
+func TestMigrateAnkhFile(t *testing.T) {
+	body := `namespace: web
+bootstrap:
+  scripts:
+  - path: setup.sh
+dependencies:
+- dns.yaml
+admin-dependencies:
+- dns.yaml
+- rbac.yaml
+charts:
+- name: web
+  version: 1.0.0
+`
+	out, changes, err := MigrateAnkhFile([]byte(body))
+	if err != nil || len(changes) != 2 {
+		t.Logf("expected 2 changes but got %+v (err %v)", changes, err)
+		t.Fail()
+		return
+	}
+
+	ankhFile := ankh.AnkhFile{}
+	if err := yaml.UnmarshalStrict(out, &ankhFile); err != nil {
+		t.Logf("migrated Ankh file does not parse strictly: %v", err)
+		t.Fail()
+		return
+	}
+	if len(ankhFile.Dependencies) != 2 || ankhFile.Dependencies[0] != "dns.yaml" || ankhFile.Dependencies[1] != "rbac.yaml" {
+		t.Logf("unexpected dependencies %+v", ankhFile.Dependencies)
+		t.Fail()
+	}
+	if len(ankhFile.Charts) != 1 || ankhFile.Charts[0].Name != "web" {
+		t.Logf("unexpected charts %+v", ankhFile.Charts)
+		t.Fail()
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// Remote ankh configs are fetched with optional auth from the environment, so
+// that credentials never have to be written into an ankh config. The
+// credentials are only sent to https URLs under ANKHCONFIG_AUTH_URL, and not to
+// every URL that's included or initialized from.
+const (
+	remoteConfigTokenEnv    = "ANKHCONFIG_TOKEN"
+	remoteConfigUsernameEnv = "ANKHCONFIG_USERNAME"
+	remoteConfigPasswordEnv = "ANKHCONFIG_PASSWORD"
+	remoteConfigAuthURLEnv  = "ANKHCONFIG_AUTH_URL"
+)
+
+var remoteConfigClient = &http.Client{Timeout: 30 * time.Second}
+
+func remoteConfigCachePath(ctx *ankh.ExecutionContext, configPath string) string {
+	return filepath.Join(ctx.ConfigCacheDir, fmt.Sprintf("%x.yaml", sha256.Sum256([]byte(configPath))))
+}
+
+// urlUnder is true if u is scope, or a URL beneath it.
+func urlUnder(u *url.URL, scope *url.URL) bool {
+	if u.Scheme != scope.Scheme || !strings.EqualFold(u.Host, scope.Host) {
+		return false
+	}
+	prefix := strings.TrimSuffix(scope.Path, "/")
+	return prefix == "" || u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/")
+}
+
+// authorizeRemoteConfig adds the credentials from the environment to req, if
+// its URL is under ANKHCONFIG_AUTH_URL.
+func authorizeRemoteConfig(req *http.Request) error {
+	token, username := os.Getenv(remoteConfigTokenEnv), os.Getenv(remoteConfigUsernameEnv)
+	if token == "" && username == "" {
+		return nil
+	}
+
+	authURL := os.Getenv(remoteConfigAuthURLEnv)
+	if authURL == "" {
+		return fmt.Errorf("Must set `%v` to the URL of the config server that `%v` or `%v` authenticate to",
+			remoteConfigAuthURLEnv, remoteConfigTokenEnv, remoteConfigUsernameEnv)
+	}
+	scope, err := url.Parse(authURL)
+	if err != nil {
+		return fmt.Errorf("Invalid `%v` '%v': %v", remoteConfigAuthURLEnv, authURL, err)
+	}
+	if scope.Scheme != "https" || scope.Host == "" {
+		return fmt.Errorf("`%v` must be an https URL, since credentials are never sent over plain http, found '%v'",
+			remoteConfigAuthURLEnv, authURL)
+	}
+	if !urlUnder(req.URL, scope) {
+		return nil
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.SetBasicAuth(username, os.Getenv(remoteConfigPasswordEnv))
+	}
+	return nil
+}
+
+func fetchRemoteConfig(configPath string) ([]byte, error) {
+	req, err := http.NewRequest("GET", configPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeRemoteConfig(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := remoteConfigClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch ankh config from URL '%s': %v", configPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Non-200 status code when fetching ankh config from URL '%s': %v", configPath, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// getRemoteConfig returns the body of a remote ankh config. Configs are cached
+// under ctx.ConfigCacheDir, and the cache is used instead of fetching while it
+// is younger than ctx.ConfigCacheTTL. When ctx.Offline is set, a stale cache is
+// used if the remote is unreachable.
+func getRemoteConfig(ctx *ankh.ExecutionContext, configPath string) ([]byte, error) {
+	if ctx.ConfigCacheDir == "" {
+		return fetchRemoteConfig(configPath)
+	}
+
+	cachePath := remoteConfigCachePath(ctx, configPath)
+	info, statErr := os.Stat(cachePath)
+	if statErr == nil && time.Since(info.ModTime()) < ctx.ConfigCacheTTL {
+		ctx.Logger.Debugf("Using cached ankh config %v for %v", cachePath, configPath)
+		return ioutil.ReadFile(cachePath)
+	}
+
+	body, err := fetchRemoteConfig(configPath)
+	if err != nil {
+		if ctx.Offline && statErr == nil {
+			ctx.Logger.Warnf("%v. Using cached copy from %v since `--offline` was provided.",
+				err, info.ModTime().Format(time.RFC3339))
+			return ioutil.ReadFile(cachePath)
+		}
+		if statErr == nil {
+			return nil, fmt.Errorf("%v. Rerun with `ankh --offline ...` to use the cached copy from %v", err, info.ModTime().Format(time.RFC3339))
+		}
+		return nil, err
+	}
+
+	if err := os.MkdirAll(ctx.ConfigCacheDir, 0700); err != nil {
+		ctx.Logger.Warnf("Unable to make config cache dir '%s': %v", ctx.ConfigCacheDir, err)
+	} else if err := ioutil.WriteFile(cachePath, body, 0600); err != nil {
+		ctx.Logger.Warnf("Unable to cache ankh config '%s': %v", configPath, err)
+	}
+	return body, nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestGetRemoteConfig(t *testing.T) {
+	hits := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("contexts: {}\n"))
+	}))
+
+	defer func(client *http.Client) { remoteConfigClient = client }(remoteConfigClient)
+	remoteConfigClient = server.Client()
+	os.Setenv(remoteConfigTokenEnv, "secret")
+	defer os.Unsetenv(remoteConfigTokenEnv)
+	os.Setenv(remoteConfigAuthURLEnv, server.URL)
+	defer os.Unsetenv(remoteConfigAuthURLEnv)
+
+	cacheDir, _ := ioutil.TempDir("", "")
+	ctx := &ankh.ExecutionContext{
+		Logger:         logrus.New(),
+		ConfigCacheDir: cacheDir,
+		ConfigCacheTTL: time.Hour,
+	}
+	configPath := server.URL + "/config.yaml"
+
+	t.Run("fetches with auth and caches", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			body, err := getRemoteConfig(ctx, configPath)
+			if err != nil || string(body) != "contexts: {}\n" {
+				t.Logf("unexpected body '%s' (%v)", body, err)
+				t.Fail()
+			}
+		}
+		if hits != 1 {
+			t.Logf("expected 1 request with a fresh cache, but got %v", hits)
+			t.Fail()
+		}
+	})
+
+	server.Close()
+	ctx.ConfigCacheTTL = 0
+
+	t.Run("unreachable without offline", func(t *testing.T) {
+		_, err := getRemoteConfig(ctx, configPath)
+		if err == nil {
+			t.Log("expected to find an error but didnt get one")
+			t.Fail()
+		}
+	})
+
+	t.Run("unreachable with offline uses cache", func(t *testing.T) {
+		ctx.Offline = true
+		body, err := getRemoteConfig(ctx, configPath)
+		if err != nil || string(body) != "contexts: {}\n" {
+			t.Logf("unexpected body '%s' (%v)", body, err)
+			t.Fail()
+		}
+	})
+}
+
+func TestAuthorizeRemoteConfig(t *testing.T) {
+	os.Setenv(remoteConfigTokenEnv, "secret")
+	defer os.Unsetenv(remoteConfigTokenEnv)
+	defer os.Unsetenv(remoteConfigAuthURLEnv)
+
+	for _, test := range []struct {
+		authURL   string
+		configURL string
+		sent      bool
+		err       bool
+	}{
+		{"https://config.example.com/ankh", "https://config.example.com/ankh/production.yaml", true, false},
+		{"https://config.example.com/ankh/", "https://CONFIG.example.com/ankh/production.yaml", true, false},
+		{"https://config.example.com", "https://config.example.com/production.yaml", true, false},
+		{"https://config.example.com/ankh", "https://config.example.com/ankh-other/production.yaml", false, false},
+		{"https://config.example.com", "https://config.example.com.evil.net/production.yaml", false, false},
+		{"https://config.example.com", "https://charts.example.com/production.yaml", false, false},
+		{"https://config.example.com", "http://config.example.com/production.yaml", false, false},
+		{"http://config.example.com", "http://config.example.com/production.yaml", false, true},
+		{"", "https://config.example.com/production.yaml", false, true},
+	} {
+		os.Setenv(remoteConfigAuthURLEnv, test.authURL)
+		req, _ := http.NewRequest("GET", test.configURL, nil)
+		err := authorizeRemoteConfig(req)
+		if (err != nil) != test.err {
+			t.Logf("%v with %v: expected error %v but got %v", test.configURL, test.authURL, test.err, err)
+			t.Fail()
+		}
+		if sent := req.Header.Get("Authorization") != ""; sent != test.sent {
+			t.Logf("%v with %v: expected credentials sent %v but got %v", test.configURL, test.authURL, test.sent, sent)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ankh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// ApplySummary counts the objects that kubectl reported on when applying a single chart to a namespace.
+type ApplySummary struct {
+	Context    string `json:"context"`
+	Namespace  string `json:"namespace"`
+	Chart      string `json:"chart"`
+	DryRun     bool   `json:"dryRun,omitempty"`
+	Created    int    `json:"created"`
+	Configured int    `json:"configured"`
+	Unchanged  int    `json:"unchanged"`
+	Other      int    `json:"other"`
+}
+
+func (s ApplySummary) String() string {
+	return fmt.Sprintf("%v created, %v configured, %v unchanged, %v other",
+		s.Created, s.Configured, s.Unchanged, s.Other)
+}
+
+// LintFinding is a single problem found by lint, attributed to the object,
+// chart and file it came from where they're known.
+type LintFinding struct {
+	Rule    string `json:"rule"`
+	Chart   string `json:"chart,omitempty"`
+	File    string `json:"file,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// LintResult is the outcome of linting the charts applied to a single namespace.
+type LintResult struct {
+	Context   string        `json:"context"`
+	Namespace string        `json:"namespace"`
+	AnkhFile  string        `json:"ankhFile,omitempty"`
+	Charts    []string      `json:"charts"`
+	Findings  []LintFinding `json:"findings"`
+	// Scores are out of 100 for each chart, when lint ran the best-practice checks.
+	Scores map[string]int `json:"scores,omitempty"`
+}
+
+// AuditEntry is a single line in the audit log, which records what Ankh did to which clusters.
+type AuditEntry struct {
+	Time           string         `json:"time"`
+	User           string         `json:"user"`
+	Actor          string         `json:"actor,omitempty"`
+	Mode           Mode           `json:"mode"`
+	Context        string         `json:"context,omitempty"`
+	Environment    string         `json:"environment,omitempty"`
+	Namespace      string         `json:"namespace,omitempty"`
+	Message        string         `json:"message,omitempty"`
+	ApplySummaries []ApplySummary `json:"applySummaries,omitempty"`
+}
+
+// RunResult is written as JSON to the data dir at the end of each run.
+type RunResult struct {
+	Mode           Mode            `json:"mode"`
+	Actor          string          `json:"actor,omitempty"`
+	AnkhFilePath   string          `json:"ankhFilePath,omitempty"`
+	Environment    string          `json:"environment,omitempty"`
+	Contexts       []string        `json:"contexts"`
+	ApplySummaries []ApplySummary  `json:"applySummaries"`
+	LintResults    []LintResult    `json:"lintResults,omitempty"`
+	Commands       []CommandRecord `json:"commands,omitempty"`
+}
+
+// DefaultActor is the OS user, or `unknown` when that can't be determined.
+func DefaultActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// Audit appends an entry to the audit log at AuditLogPath, if one is configured.
+func (ctx *ExecutionContext) Audit(entry AuditEntry) error {
+	if ctx.AuditLogPath == "" {
+		return nil
+	}
+
+	entry.Time = time.Now().Format(time.RFC3339)
+	if entry.User == "" {
+		if u, err := user.Current(); err == nil {
+			entry.User = u.Username
+		}
+	}
+	if entry.Actor == "" {
+		entry.Actor = ctx.Actor
+	}
+	if entry.Mode == "" {
+		entry.Mode = ctx.Mode
+	}
+	if entry.Context == "" {
+		entry.Context = ctx.AnkhConfig.CurrentContextName
+	}
+	if entry.Environment == "" {
+		entry.Environment = ctx.Environment
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ctx.AuditLogPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(ctx.AuditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to open audit log '%v': %v", ctx.AuditLogPath, err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// WriteRunResult writes the run result as result.json in the data dir.
+func (ctx *ExecutionContext) WriteRunResult(result RunResult) (string, error) {
+	if err := os.MkdirAll(ctx.DataDir, 0755); err != nil {
+		return "", err
+	}
+
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	resultPath := filepath.Join(ctx.DataDir, "result.json")
+	return resultPath, ioutil.WriteFile(resultPath, out, 0644)
+}
@@ -0,0 +1,51 @@
+package ankh
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditActor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-audit")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := &ExecutionContext{AuditLogPath: filepath.Join(dir, "audit.log"), Mode: Apply, Actor: "pipeline/deploy-web"}
+	if err := ctx.Audit(AuditEntry{Namespace: "team"}); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err := ctx.Audit(AuditEntry{Namespace: "team", Actor: "jane"}); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	out, err := ioutil.ReadFile(ctx.AuditLogPath)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		t.Logf("expected 2 audit entries but got %v", len(lines))
+		t.FailNow()
+	}
+	for i, expected := range []string{"pipeline/deploy-web", "jane"} {
+		entry := AuditEntry{}
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		if entry.Actor != expected || entry.User == "" {
+			t.Logf("expected actor '%v' and the OS user but got %+v", expected, entry)
+			t.Fail()
+		}
+	}
+}
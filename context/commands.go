@@ -0,0 +1,214 @@
+package ankh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// commandsMtx guards ExecutionContext.Commands, since commands run concurrently, eg: for `exec --parallel`.
+var commandsMtx sync.Mutex
+
+// CommandRecord is one run of an external command, like kubectl or helm,
+// for telling where the time in a run went.
+type CommandRecord struct {
+	// Command is the program and its subcommand, eg: `kubectl apply`,
+	// rather than every argument, which may hold values that shouldn't be
+	// written to disk.
+	Command  string    `json:"command"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"durationSeconds"`
+	ExitCode int       `json:"exitCode"`
+
+	// Byte counts are -1 when a stream wasn't captured, eg: when it's the terminal.
+	StdinBytes  int64 `json:"stdinBytes"`
+	StdoutBytes int64 `json:"stdoutBytes"`
+	StderrBytes int64 `json:"stderrBytes"`
+
+	ctx            *ExecutionContext
+	cmd            *exec.Cmd
+	stdin          *countingReader
+	stdout, stderr *countingWriter
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// commandName is the program in args, and the arguments that follow it up to
+// the first flag, eg: `kubectl rollout status` or `helm template`.
+func commandName(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	name := []string{filepath.Base(args[0])}
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "-") || len(name) == 3 {
+			break
+		}
+		name = append(name, arg)
+	}
+	return strings.Join(name, " ")
+}
+
+// StartCommand starts timing cmd, which must not have started yet, and counts
+// the bytes it reads and writes through any streams that aren't files, like
+// the terminal. Files are left alone, so that commands still see a terminal.
+// Unless CatchSignals was called for a command the user interacts with, cmd
+// gets a process group of its own, so that it can be stopped along with
+// anything it starts. Call Finish on the record once cmd is done.
+func (ctx *ExecutionContext) StartCommand(cmd *exec.Cmd) *CommandRecord {
+	if !CatchingSignals() {
+		setProcessGroup(cmd)
+	}
+	startedCommand(1)
+
+	record := &CommandRecord{
+		Command:     commandName(cmd.Args),
+		Start:       time.Now(),
+		StdinBytes:  -1,
+		StdoutBytes: -1,
+		StderrBytes: -1,
+		ctx:         ctx,
+		cmd:         cmd,
+	}
+	if _, ok := cmd.Stdin.(*os.File); cmd.Stdin != nil && !ok {
+		record.stdin = &countingReader{r: cmd.Stdin}
+		cmd.Stdin = record.stdin
+	}
+	combined := cmd.Stderr != nil && cmd.Stderr == cmd.Stdout
+	if _, ok := cmd.Stdout.(*os.File); cmd.Stdout != nil && !ok {
+		record.stdout = &countingWriter{w: cmd.Stdout}
+		cmd.Stdout = record.stdout
+	}
+	if _, ok := cmd.Stderr.(*os.File); cmd.Stderr != nil && !ok {
+		// Output that's combined is all counted as stdout.
+		if combined {
+			record.stderr = record.stdout
+		} else {
+			record.stderr = &countingWriter{w: cmd.Stderr}
+		}
+		cmd.Stderr = record.stderr
+	}
+	return record
+}
+
+// Finish records how the command ended, given the error from running it,
+// logging it at debug level and adding it to ctx.Commands. It returns err, or
+// a TimeoutError or InterruptedError if the command was stopped by Command.
+func (r *CommandRecord) Finish(err error) error {
+	startedCommand(-1)
+	err = finishDeadline(r.cmd, r.Command, err)
+	r.End = time.Now()
+	r.Duration = r.End.Sub(r.Start).Seconds()
+	if r.stdin != nil {
+		r.StdinBytes = r.stdin.n
+	}
+	if r.stdout != nil {
+		r.StdoutBytes = r.stdout.n
+	}
+	if r.stderr != nil && r.stderr != r.stdout {
+		r.StderrBytes = r.stderr.n
+	}
+
+	switch e := err.(type) {
+	case nil:
+		r.ExitCode = 0
+	case *exec.ExitError:
+		r.ExitCode = -1
+		if status, ok := e.Sys().(syscall.WaitStatus); ok {
+			r.ExitCode = status.ExitStatus()
+		}
+	default:
+		r.ExitCode = -1
+	}
+
+	if r.ctx.Logger != nil {
+		r.ctx.Logger.Debugf("`%v` exited with code %v after %.3fs, %v", r.Command, r.ExitCode, r.Duration, r.byteCounts())
+	}
+	commandsMtx.Lock()
+	r.ctx.Commands = append(r.ctx.Commands, *r)
+	commandsMtx.Unlock()
+	return err
+}
+
+func (r *CommandRecord) byteCounts() string {
+	counts := []string{}
+	for _, c := range []struct {
+		name string
+		n    int64
+	}{{"stdin", r.StdinBytes}, {"stdout", r.StdoutBytes}, {"stderr", r.StderrBytes}} {
+		if c.n >= 0 {
+			counts = append(counts, fmt.Sprintf("%v bytes of %v", c.n, c.name))
+		}
+	}
+	if len(counts) == 0 {
+		return "with no output captured"
+	}
+	return strings.Join(counts, ", ")
+}
+
+// CommandSummary is the time spent running one external command, over a run.
+type CommandSummary struct {
+	Command string
+	Count   int
+	Total   time.Duration
+	Slowest time.Duration
+}
+
+// SummarizeCommands adds up the time spent in each command in records, the
+// slowest first.
+func SummarizeCommands(records []CommandRecord) []CommandSummary {
+	byName := make(map[string]*CommandSummary)
+	for _, record := range records {
+		summary, ok := byName[record.Command]
+		if !ok {
+			summary = &CommandSummary{Command: record.Command}
+			byName[record.Command] = summary
+		}
+		d := record.End.Sub(record.Start)
+		summary.Count++
+		summary.Total += d
+		if d > summary.Slowest {
+			summary.Slowest = d
+		}
+	}
+
+	summaries := []CommandSummary{}
+	for _, summary := range byName {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Total != summaries[j].Total {
+			return summaries[i].Total > summaries[j].Total
+		}
+		return summaries[i].Command < summaries[j].Command
+	})
+	return summaries
+}
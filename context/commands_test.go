@@ -0,0 +1,64 @@
+package ankh
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandName(t *testing.T) {
+	cases := map[string]string{
+		"kubectl apply -f - --namespace team":   "kubectl apply",
+		"/usr/local/bin/helm template --name x": "helm template",
+		"kubectl rollout status deployment/web": "kubectl rollout status",
+		"/bin/sh -c echo secret":                "sh",
+	}
+	for args, expected := range cases {
+		if name := commandName(strings.Split(args, " ")); name != expected {
+			t.Logf("expected `%v` to be named `%v` but got `%v`", args, expected, name)
+			t.Fail()
+		}
+	}
+}
+
+func TestStartCommand(t *testing.T) {
+	ctx := &ExecutionContext{}
+	var stdout bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", "cat; exit 3")
+	cmd.Stdin = strings.NewReader("hello")
+	cmd.Stdout = &stdout
+
+	record := ctx.StartCommand(cmd)
+	record.Finish(cmd.Run())
+
+	if len(ctx.Commands) != 1 {
+		t.Logf("expected the command to be recorded, but got %+v", ctx.Commands)
+		t.FailNow()
+	}
+	r := ctx.Commands[0]
+	if r.Command != "sh" || r.ExitCode != 3 || r.StdinBytes != 5 || r.StdoutBytes != 5 || r.StderrBytes != -1 {
+		t.Logf("got unexpected record %+v", r)
+		t.Fail()
+	}
+	if stdout.String() != "hello" {
+		t.Logf("expected the command's output to still be written, but got '%v'", stdout.String())
+		t.Fail()
+	}
+}
+
+func TestSummarizeCommands(t *testing.T) {
+	start := time.Now()
+	records := []CommandRecord{
+		{Command: "helm template", Start: start, End: start.Add(time.Second)},
+		{Command: "kubectl apply", Start: start, End: start.Add(3 * time.Second)},
+		{Command: "helm template", Start: start, End: start.Add(2 * time.Second)},
+	}
+	summaries := SummarizeCommands(records)
+	if len(summaries) != 2 || summaries[0].Command != "helm template" || summaries[0].Count != 2 ||
+		summaries[0].Total != 3*time.Second || summaries[0].Slowest != 2*time.Second || summaries[1].Command != "kubectl apply" {
+		t.Logf("got unexpected summaries %+v", summaries)
+		t.Fail()
+	}
+}
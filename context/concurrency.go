@@ -0,0 +1,56 @@
+package ankh
+
+// ConcurrencyConfig limits how many operations on each kind of resource run
+// at once, so that large environments don't overwhelm the Kubernetes API or
+// the registries.
+type ConcurrencyConfig struct {
+	// Kubernetes limits concurrent kubectl commands, eg: waiting for workloads, or `exec --parallel`. Defaults to 10.
+	Kubernetes int `yaml:"kubernetes,omitempty"`
+	// Registry limits concurrent requests to the docker registry. Defaults to 10.
+	Registry int `yaml:"registry,omitempty"`
+	// Charts limits how many charts are templated at once. Defaults to 4.
+	Charts int `yaml:"charts,omitempty"`
+	// Contexts limits how many contexts are operated on at once, eg: by `fleet status`. Defaults to 8.
+	Contexts int `yaml:"contexts,omitempty"`
+}
+
+// ConcurrencyResource is a kind of resource that ConcurrencyConfig limits.
+type ConcurrencyResource string
+
+const (
+	KubernetesConcurrency ConcurrencyResource = "kubernetes"
+	RegistryConcurrency   ConcurrencyResource = "registry"
+	ChartsConcurrency     ConcurrencyResource = "charts"
+	ContextsConcurrency   ConcurrencyResource = "contexts"
+)
+
+var defaultConcurrency = map[ConcurrencyResource]int{
+	KubernetesConcurrency: 10,
+	RegistryConcurrency:   10,
+	ChartsConcurrency:     4,
+	ContextsConcurrency:   8,
+}
+
+// ConcurrencyLimit is how many operations on resource may run at once: its
+// limit from `concurrency` in the Ankh config, or its default, capped by
+// `--max-concurrency`.
+func (ctx *ExecutionContext) ConcurrencyLimit(resource ConcurrencyResource) int {
+	var limit int
+	switch resource {
+	case KubernetesConcurrency:
+		limit = ctx.AnkhConfig.Concurrency.Kubernetes
+	case RegistryConcurrency:
+		limit = ctx.AnkhConfig.Concurrency.Registry
+	case ChartsConcurrency:
+		limit = ctx.AnkhConfig.Concurrency.Charts
+	case ContextsConcurrency:
+		limit = ctx.AnkhConfig.Concurrency.Contexts
+	}
+	if limit <= 0 {
+		limit = defaultConcurrency[resource]
+	}
+	if ctx.MaxConcurrency > 0 && limit > ctx.MaxConcurrency {
+		limit = ctx.MaxConcurrency
+	}
+	return limit
+}
@@ -0,0 +1,26 @@
+package ankh
+
+import (
+	"testing"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	ctx := &ExecutionContext{}
+	ctx.AnkhConfig.Concurrency = ConcurrencyConfig{Registry: 4}
+	if limit := ctx.ConcurrencyLimit(KubernetesConcurrency); limit != 10 {
+		t.Logf("expected the default kubernetes limit of 10 but got %v", limit)
+		t.Fail()
+	}
+	if limit := ctx.ConcurrencyLimit(RegistryConcurrency); limit != 4 {
+		t.Logf("expected the configured registry limit of 4 but got %v", limit)
+		t.Fail()
+	}
+
+	ctx.MaxConcurrency = 3
+	for _, resource := range []ConcurrencyResource{KubernetesConcurrency, RegistryConcurrency, ContextsConcurrency} {
+		if limit := ctx.ConcurrencyLimit(resource); limit != 3 {
+			t.Logf("expected `--max-concurrency` to cap the %v limit at 3 but got %v", resource, limit)
+			t.Fail()
+		}
+	}
+}
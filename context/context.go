@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -16,16 +17,31 @@ import (
 type Mode string
 
 const (
-	Apply    Mode = "apply"
-	Rollback Mode = "rollback"
-	Diff     Mode = "diff"
-	Exec     Mode = "exec"
-	Explain  Mode = "explain"
-	Get      Mode = "get"
-	Pods     Mode = "pods"
-	Lint     Mode = "lint"
-	Logs     Mode = "logs"
-	Template Mode = "template"
+	Apply       Mode = "apply"
+	Rollback    Mode = "rollback"
+	Diff        Mode = "diff"
+	Drift       Mode = "drift"
+	Exec        Mode = "exec"
+	Explain     Mode = "explain"
+	Get         Mode = "get"
+	Describe    Mode = "describe"
+	Cp          Mode = "cp"
+	Wait        Mode = "wait"
+	RunJob      Mode = "run-job"
+	Pods        Mode = "pods"
+	Lint        Mode = "lint"
+	Logs        Mode = "logs"
+	Template    Mode = "template"
+	GitOps      Mode = "gitops"
+	Export      Mode = "export"
+	Values      Mode = "values"
+	Resources   Mode = "resources"
+	Status      Mode = "status"
+	PortForward Mode = "port-forward"
+	Scale       Mode = "scale"
+	Restart     Mode = "restart"
+	Events      Mode = "events"
+	Top         Mode = "top"
 )
 
 // Captures all of the context required to execute a single iteration of Ankh
@@ -41,10 +57,35 @@ type ExecutionContext struct {
 
 	Mode Mode
 
-	Verbose, Quiet, CatchSignals, DryRun, Describe, WarnOnConfigError, UseContext, IgnoreContextAndEnv, IgnoreConfigErrors bool
+	// Options are the flags of the command being run.
+	Options CommandOptions
+
+	// LogChart and LogNamespace are the charts and namespace being operated on, for structured logs.
+	LogChart, LogNamespace string
+
+	Verbose, Quiet, DryRun, Describe, WarnOnConfigError, UseContext, IgnoreContextAndEnv, IgnoreConfigErrors bool
+
+	// Offline falls back to cached remote ankh configs when they can't be fetched.
+	Offline        bool
+	ConfigCacheTTL time.Duration
+
+	// Timeout, if set by `--timeout`, is how long the whole run may take, until
+	// Deadline, after which the helm and kubectl commands it runs are killed.
+	Timeout  time.Duration
+	Deadline time.Time
+
+	// MaxConcurrency, if set by `--max-concurrency`, caps every limit of ConcurrencyLimit.
+	MaxConcurrency int
 
 	AnkhConfigPath string
 	KubeConfigPath string
+	AuditLogPath   string
+	// Actor is the person or pipeline that started the run, recorded in
+	// audit logs, annotations, and notifications. It defaults to the OS user.
+	Actor          string
+	ConfigCacheDir string
+	SchemaCacheDir string
+	ChartCacheDir  string
 	Context        string
 	Release        string
 	Environment    string
@@ -53,10 +94,31 @@ type ExecutionContext struct {
 
 	Filters []string
 
+	// OnlyObjects narrows the action to specific objects, of the form `kind/name`
+	OnlyObjects []string
+
+	// Workspace, if selected with `--workspace`, supplies Ankh files and default flags.
+	Workspace *Workspace
+
+	// Commands records each external command run, like kubectl or helm, and how long it took.
+	Commands []CommandRecord
+
 	ExtraArgs, PassThroughArgs []string
 
 	HelmVersion, KubectlVersion string
 
+	// ApplySummaries accumulates the outcome of each chart applied during this run.
+	ApplySummaries []ApplySummary
+
+	// LintResults accumulates the outcome of linting each set of charts during this run.
+	LintResults []LintResult
+
+	// NoPrompt makes anything that would prompt fail instead, for unattended runs like CI.
+	NoPrompt bool
+
+	// PinDigests resolves the tag of every chart to the digest it points to, so that the applied image can't change.
+	PinDigests bool
+
 	Logger *logrus.Logger
 }
 
@@ -71,8 +133,59 @@ type Context struct {
 	ResourceProfile    string                 `yaml:"resource-profile"`
 	Release            string                 `yaml:"release,omitempty"`
 	HelmRegistryURL    string                 `yaml:"helm-registry-url,omitempty"` // deprecated in favor of top-level config `helm.registry`
+	HelmRegistries     []string               `yaml:"helm-registries,omitempty"`   // ordered, the first registry serving a chart wins
+	DockerRegistry     string                 `yaml:"docker-registry,omitempty"`   // the registry this context's cluster pulls from, if not `docker.registry`
 	ClusterAdminUnused bool                   `yaml:"cluster-admin,omitempty"`     // deprecated
-	Global             map[string]interface{} `yaml:"global",omitempty"`
+	Global             map[string]interface{} `yaml:"global,omitempty"`
+
+	// Fall back to the kube-context's namespace for charts that have no namespace set anywhere else.
+	UseKubeContextNamespace bool `yaml:"use-kube-context-namespace,omitempty"`
+
+	// Apply and rollback are refused during these windows, unless overridden with a reason.
+	FreezeWindows []FreezeWindow `yaml:"freeze-windows,omitempty"`
+
+	// After apply, delete succeeded Jobs and old ReplicaSets of the charts that were applied.
+	Cleanup CleanupConfig `yaml:"cleanup,omitempty"`
+
+	// Before apply, create the namespace being applied into if it doesn't exist, like `--create-namespace`.
+	CreateNamespace bool `yaml:"create-namespace,omitempty"`
+
+	// Added to the metadata, and pod template metadata, of every object templated for this context.
+	CommonLabels      map[string]string `yaml:"common-labels,omitempty"`
+	CommonAnnotations map[string]string `yaml:"common-annotations,omitempty"`
+
+	// Annotate the pod templates of workloads with a checksum of the ConfigMaps and Secrets they use.
+	ConfigChecksums bool `yaml:"config-checksums,omitempty"`
+
+	// Before apply, verify the cosign signatures of fetched charts and of the images that objects run.
+	Cosign CosignConfig `yaml:"cosign,omitempty"`
+}
+
+// CosignConfig is how `apply` verifies the cosign signatures of the charts and
+// images it applies to a context: with a public key, or keyless, with the
+// identities that may sign them.
+type CosignConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Key is a public key file, or a KMS URI, eg: `awskms:///alias/signing`.
+	Key string `yaml:"key,omitempty"`
+	// Identities are who may sign keyless, any one of which is enough.
+	Identities []CosignIdentity `yaml:"identities,omitempty"`
+}
+
+// CosignIdentity is a keyless signer: the OIDC issuer that vouches for it,
+// and its subject, eg: an email address or a CI workflow's URL.
+type CosignIdentity struct {
+	Issuer        string `yaml:"issuer"`
+	Subject       string `yaml:"subject,omitempty"`
+	SubjectRegexp string `yaml:"subject-regexp,omitempty"`
+}
+
+// CleanupConfig configures deleting what's left behind by the charts that
+// `apply` applies to a context.
+type CleanupConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// JobTTL is how long after they complete that succeeded Jobs are deleted. Defaults to 24h.
+	JobTTL string `yaml:"job-ttl,omitempty"`
 }
 
 // An Environment is a collection of contexts over which operations should be applied
@@ -83,18 +196,134 @@ type Environment struct {
 
 type KubectlConfig struct {
 	WildCardLabels []string `yaml:"wildCardLabels,omitempty"`
+
+	// NamespaceOverride is what to do with objects that hard-code a namespace
+	// other than the one given by `--namespace`: NamespaceOverrideWarn or NamespaceOverrideRewrite.
+	NamespaceOverride string `yaml:"namespaceOverride,omitempty"`
+}
+
+const (
+	// NamespaceOverrideWarn warns about objects in other namespaces, and is the default.
+	NamespaceOverrideWarn = "warn"
+	// NamespaceOverrideRewrite moves objects in other namespaces into the override namespace.
+	NamespaceOverrideRewrite = "rewrite"
+)
+
+// LogsConfig sets defaults for `ankh logs`, which its options override.
+type LogsConfig struct {
+	Tail       *int `yaml:"tail,omitempty"`
+	Follow     bool `yaml:"follow,omitempty"`
+	Timestamps bool `yaml:"timestamps,omitempty"`
+}
+
+// DriftConfig configures `ankh watch-drift`.
+type DriftConfig struct {
+	// Targets are the Ankh files to check, and where to check them.
+	Targets []DriftTarget `yaml:"targets,omitempty"`
+	// WebhookURL receives a JSON POST whenever drift is found or resolved.
+	WebhookURL string `yaml:"webhookURL,omitempty"`
+}
+
+type DriftTarget struct {
+	AnkhFile    string `yaml:"ankhFile"`
+	Context     string `yaml:"context,omitempty"`
+	Environment string `yaml:"environment,omitempty"`
+}
+
+// GitHubConfig configures creating a GitHub Deployment for each context that
+// `apply` applies to, and updating its status as the apply goes.
+type GitHubConfig struct {
+	// Repo is the repository to create Deployments in, eg: `appnexus/web`. Deployments are only created when it's set.
+	Repo string `yaml:"repo,omitempty"`
+	// TokenEnv is the environment variable with a token that can create Deployments. Defaults to `GITHUB_TOKEN`.
+	TokenEnv string `yaml:"tokenEnv,omitempty"`
+	// APIURL is the GitHub API, for GitHub Enterprise. Defaults to `https://api.github.com`.
+	APIURL string `yaml:"apiURL,omitempty"`
+	// Ref is the git ref being deployed. Defaults to `$GITHUB_SHA`, or the commit checked out where ankh runs.
+	Ref string `yaml:"ref,omitempty"`
+}
+
+// PolicyConfig points at Rego policies that rendered objects are checked against.
+type PolicyConfig struct {
+	// Path is a directory of Rego policies, or a bundle ending in `.tar.gz`.
+	Path string `yaml:"path,omitempty"`
+	// Package is the Rego package with the `deny` and `warn` rules.
+	Package string `yaml:"package,omitempty"`
+	// EnforceOnApply makes `apply` fail on `deny` violations, as `lint` does.
+	EnforceOnApply bool `yaml:"enforceOnApply,omitempty"`
+}
+
+// ScanConfig has `ankh apply` scan the images of the objects it applies for
+// vulnerabilities with Trivy, refusing to apply any that have vulnerabilities
+// of Severity or above.
+type ScanConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Severity is the lowest of UNKNOWN, LOW, MEDIUM, HIGH and CRITICAL that fails the scan. Defaults to HIGH.
+	Severity string `yaml:"severity,omitempty"`
+	// Server is a Trivy server to scan with, eg: `http://trivy.example.com:4954`, instead of scanning locally.
+	Server string `yaml:"server,omitempty"`
+	// IgnoreUnfixed ignores vulnerabilities that have no fix yet.
+	IgnoreUnfixed bool `yaml:"ignoreUnfixed,omitempty"`
+}
+
+// LintConfig configures the schema validation done by `ankh lint`.
+type LintConfig struct {
+	KubernetesVersion string      `yaml:"kubernetesVersion,omitempty"`
+	SchemaLocation    string      `yaml:"schemaLocation,omitempty"`
+	Score             ScoreConfig `yaml:"score,omitempty"`
+}
+
+type ScoreConfig struct {
+	// Enabled runs the best-practice checks on every lint, as if `--score` was passed.
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Minimum fails lint for charts that score lower, out of 100.
+	Minimum int `yaml:"minimum,omitempty"`
 }
 
 type HelmConfig struct {
-	TagValueName string `yaml:"tagValueName"`
-	Registry     string `yaml:"registry"`
-	AuthType     string `yaml:"authType"`
+	TagValueName       string   `yaml:"tagValueName"`
+	TagFormat          string   `yaml:"tagFormat,omitempty"` // `tag`, `digest` or `ref`, unless a chart sets `tagformat`
+	Registry           string   `yaml:"registry"`
+	FallbackRegistries []string `yaml:"fallbackRegistries,omitempty"`
+	AuthType           string   `yaml:"authType"`
+	CacheDir           string   `yaml:"cacheDir,omitempty"` // where fetched chart archives are cached, instead of under the datadir
 }
 
 type DockerConfig struct {
 	Registry string `yaml:"registry"`
 }
 
+// RegistryConfig is how to connect to a docker or helm registry over TLS, eg:
+// one whose certificate is signed by a private CA.
+type RegistryConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`   // PEM bundle of CAs to trust, along with the system's
+	CertFile           string `yaml:"certFile,omitempty"` // PEM client certificate, with keyFile
+	KeyFile            string `yaml:"keyFile,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+}
+
+// DeployLockConfig enables locking namespaces for the duration of `ankh apply`, so that concurrent runs fail fast.
+type DeployLockConfig struct {
+	Enabled bool   `yaml:"enabled,omitempty"`
+	TTL     string `yaml:"ttl,omitempty"` // locks older than this are considered abandoned
+}
+
+// ResourcesConfig has prices for `ankh resources` to estimate what the
+// resources requested by charts cost.
+type ResourcesConfig struct {
+	CPUPrice    float64 `yaml:"cpuPrice,omitempty"`    // per core
+	MemoryPrice float64 `yaml:"memoryPrice,omitempty"` // per GiB
+}
+
+// NamespaceLabelsConfig has `ankh apply` create the namespaces it applies into
+// if they don't exist, and label them with the environment class, team,
+// release and `app.kubernetes.io/managed-by: ankh`.
+type NamespaceLabelsConfig struct {
+	Enabled bool              `yaml:"enabled,omitempty"`
+	Team    string            `yaml:"team,omitempty"`   // used when the Ankh file doesn't set a team
+	Labels  map[string]string `yaml:"labels,omitempty"` // added to the standard labels
+}
+
 // AnkhConfig defines the shape of the ~/.ankh/config file used for global
 // configuration options
 type AnkhConfig struct {
@@ -103,7 +332,7 @@ type AnkhConfig struct {
 	SupportedEnvironmentsUnused       []string               `yaml:"supported-environments,omitempty"`        // deprecated
 	SupportedEnvironmentClassesUnused []string               `yaml:"supported-environment-classes,omitempty"` // deprecated
 	SupportedResourceProfilesUnused   []string               `yaml:"supported-resource-profiles,omitempty"`   // deprecated
-	CurrentContextNameUnused          string                 `yaml:"current-context,omitempty"`               // deprecated
+	PersistedContextName              string                 `yaml:"current-context,omitempty"`               // set by `ankh config use-context`
 	CurrentContextName                string                 `yaml:"-"`                                       // deprecated
 	CurrentContext                    Context                `yaml:"-"`                                       // deprecated TODO: RENAME TO UNUSED
 	Contexts                          map[string]Context     `yaml:"contexts"`
@@ -111,6 +340,39 @@ type AnkhConfig struct {
 	Kubectl KubectlConfig `yaml:"kubectl,omitempty"`
 	Helm    HelmConfig    `yaml:"helm,omitempty"`
 	Docker  DockerConfig  `yaml:"docker,omitempty"`
+
+	// Registries configures TLS for docker and helm registries, by host, eg: `harbor.example.com:8443`.
+	Registries map[string]RegistryConfig `yaml:"registries,omitempty"`
+
+	DeployLock DeployLockConfig `yaml:"deploy-lock,omitempty"`
+
+	NamespaceLabels NamespaceLabelsConfig `yaml:"namespace-labels,omitempty"`
+
+	Logs LogsConfig `yaml:"logs,omitempty"`
+
+	Lint LintConfig `yaml:"lint,omitempty"`
+
+	Drift DriftConfig `yaml:"drift,omitempty"`
+
+	Policy PolicyConfig `yaml:"policy,omitempty"`
+
+	Scan ScanConfig `yaml:"scan,omitempty"`
+
+	Resources ResourcesConfig `yaml:"resources,omitempty"`
+
+	GitHub GitHubConfig `yaml:"github,omitempty"`
+
+	Retry RetryConfig `yaml:"retry,omitempty"`
+
+	Timeouts TimeoutsConfig `yaml:"timeouts,omitempty"`
+
+	Concurrency ConcurrencyConfig `yaml:"concurrency,omitempty"`
+
+	// LogFormat is the default for `--log-format`: `text` or `json`.
+	LogFormat string `yaml:"log-format,omitempty"`
+
+	// Features gates new behavior, by feature name. See KnownFeatures.
+	Features map[string]FeatureConfig `yaml:"features,omitempty"`
 }
 
 type KubeCluster struct {
@@ -123,15 +385,30 @@ type KubeCluster struct {
 type KubeContext struct {
 	Context struct {
 		Cluster string `yaml:"cluster"`
+		User    string `yaml:"user"`
+	}
+	Name string `yaml:"name"`
+}
+
+type KubeUser struct {
+	User struct {
+		Exec *KubeExec `yaml:"exec"`
 	}
 	Name string `yaml:"name"`
 }
 
+// KubeExec is an exec credential plugin, which kubectl runs to get credentials.
+type KubeExec struct {
+	Command         string `yaml:"command"`
+	InteractiveMode string `yaml:"interactiveMode"`
+}
+
 type KubeConfig struct {
 	ApiVersion           string        `yaml:"apiVersion"`
 	Kind                 string        `yaml:"kind"`
 	Clusters             []KubeCluster `yaml:"clusters"`
 	Contexts             []KubeContext `yaml:"contexts"`
+	Users                []KubeUser    `yaml:"users"`
 	CurrentContextUnused string        `yaml:"current-context"` // transitionary: this should never be user-supplied
 	CurrentContext       string        `yaml:"-"`               // transitionary: this should never be user-supplied
 }
@@ -172,6 +449,13 @@ func (ankhConfig *AnkhConfig) ValidateAndInit(ctx *ExecutionContext, context str
 		}
 	}
 
+	switch ankhConfig.Kubectl.NamespaceOverride {
+	case "", NamespaceOverrideWarn, NamespaceOverrideRewrite:
+	default:
+		errors = append(errors, fmt.Errorf("Invalid `kubectl.namespaceOverride` '%v', must be one of `%v` or `%v`",
+			ankhConfig.Kubectl.NamespaceOverride, NamespaceOverrideWarn, NamespaceOverrideRewrite))
+	}
+
 	ankhConfig.CurrentContext = selectedContext
 	if ctx.Release != "" {
 		if ankhConfig.CurrentContext.Release != "" {
@@ -186,18 +470,82 @@ func (ankhConfig *AnkhConfig) ValidateAndInit(ctx *ExecutionContext, context str
 
 // TODO: Rename me to target?
 type Chart struct {
-	Path         string
-	Name         string // TODO: Merge me and version into `Chart`?
-	Version      string // TODO: Merge me and Name into `Chart`?
-	Tag          string
-	TagValueName string
-	Namespace    *string
+	Path         string  `yaml:"path,omitempty"`
+	Name         string  `yaml:"name,omitempty"`    // TODO: Merge me and version into `Chart`?
+	Version      string  `yaml:"version,omitempty"` // TODO: Merge me and Name into `Chart`?
+	Tag          string  `yaml:"tag,omitempty"`
+	TagValueName string  `yaml:"tagvaluename,omitempty"`
+	Namespace    *string `yaml:"namespace,omitempty"`
+	// TagFormat is what the chart's tagvaluename takes: a bare `tag` (the default), a `digest`, or a full image `ref`.
+	TagFormat string `yaml:"tagformat,omitempty"`
+	// Image is the repository that full image refs are made with from bare tags and digests. Defaults to the chart's name, in `docker.registry`.
+	Image string `yaml:"image,omitempty"`
+	// PinDigest resolves the chart's tag to the digest it points to, like `--pin-digests` does for every chart.
+	PinDigest bool `yaml:"pin-digest,omitempty"`
+	// Digest is what the chart's tag was pinned to.
+	Digest string `yaml:"-"`
+	// TagImage is the image that the chart's tag was chosen from at a prompt, if it was.
+	TagImage string `yaml:"-"`
 	// DefaultValues are values that apply unconditionally, with lower precedence than values supplied in the fields below.
-	DefaultValues map[string]interface{} `yaml:"default-values"`
+	DefaultValues map[string]interface{} `yaml:"default-values,omitempty"`
 	// Values, by environment-class, resource-profile, or release. MapSlice preserves map ordering so we can regex search from top to bottom.
-	Values           yaml.MapSlice
-	ResourceProfiles yaml.MapSlice `yaml:"resource-profiles"`
-	Releases         yaml.MapSlice
+	Values           yaml.MapSlice `yaml:"values,omitempty"`
+	ResourceProfiles yaml.MapSlice `yaml:"resource-profiles,omitempty"`
+	Releases         yaml.MapSlice `yaml:"releases,omitempty"`
+	// Manifests are paths to plain Kubernetes YAML files, or directories of them, to use instead of a helm chart.
+	Manifests []string `yaml:"manifests,omitempty"`
+	// TemplateManifests processes Manifests as go templates over the chart's values, similar to `helm template`.
+	TemplateManifests bool `yaml:"template-manifests,omitempty"`
+	// MergeStrategies decide how lists at dotted key paths are merged across the chart's sources of values:
+	// `replace` like helm does, `append`, or `merge-by-key:FIELD`.
+	MergeStrategies map[string]string `yaml:"merge-strategies,omitempty"`
+	// SmokeTest runs after the chart is applied and its workloads have rolled out.
+	SmokeTest *SmokeTest `yaml:"smoke-test,omitempty"`
+	// Migrations are Jobs that must complete before the rest of the chart is applied.
+	Migrations *Migrations `yaml:"migrations,omitempty"`
+	// Hooks are commands run around applying the chart.
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+	// HPAReplicas is how apply treats the replicas of workloads scaled by a HorizontalPodAutoscaler:
+	// `live` sets `spec.replicas` to the live replicas, which is the default, `drop` removes it,
+	// and `chart` applies the chart's replicas.
+	HPAReplicas string `yaml:"hpa-replicas,omitempty"`
+}
+
+// Hooks are shell commands run around `ankh apply`, with the context, namespace, chart, and tag in their environment.
+type Hooks struct {
+	PreApply  []string `yaml:"pre-apply,omitempty"`
+	PostApply []string `yaml:"post-apply,omitempty"`
+	OnFailure []string `yaml:"on-failure,omitempty"`
+}
+
+// Migrations are Jobs, like database migrations, that are applied and must complete before a chart's workloads.
+type Migrations struct {
+	Manifest string `yaml:"manifest,omitempty"` // a file of Job manifests
+	Hooks    bool   `yaml:"hooks,omitempty"`    // use the chart's pre-install and pre-upgrade hook Jobs
+	Timeout  string `yaml:"timeout,omitempty"`
+}
+
+// SmokeTest is a command or HTTP check that must pass after a chart is applied for the run to continue.
+type SmokeTest struct {
+	Command      string `yaml:"command,omitempty"`
+	HTTP         string `yaml:"http,omitempty"`
+	ExpectStatus int    `yaml:"expect-status,omitempty"`
+	Attempts     int    `yaml:"attempts,omitempty"`
+	Timeout      string `yaml:"timeout,omitempty"`
+}
+
+// Precondition is an external dependency, like a DNS name, a TCP service, or a
+// Deployment in another namespace, that must be ready before an Ankh file is applied.
+type Precondition struct {
+	DNS        string `yaml:"dns,omitempty"`        // a host name that must resolve
+	TCP        string `yaml:"tcp,omitempty"`        // a host:port that must accept connections
+	Deployment string `yaml:"deployment,omitempty"` // a namespace/name Deployment whose pods must all be ready
+	Timeout    string `yaml:"timeout,omitempty"`
+}
+
+// IsManifests is true when the chart is a set of plain Kubernetes manifests rather than a helm chart.
+func (chart *Chart) IsManifests() bool {
+	return len(chart.Manifests) > 0
 }
 
 type ChartFiles struct {
@@ -218,10 +566,29 @@ type AnkhFile struct {
 
 	// The Kubernetes namespace to apply each chart to, if not overriden
 	// on the command line nor on the individual chart object.
-	Namespace *string
-	Charts    []Chart
+	Namespace *string `yaml:"namespace,omitempty"`
+	Charts    []Chart `yaml:"charts,omitempty"`
+
+	Dependencies []string `yaml:"dependencies,omitempty"`
+
+	// Hooks are commands run around applying all of the charts in this Ankh file.
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+
+	// Preconditions must all be met before any of the charts in this Ankh file are applied.
+	Preconditions []Precondition `yaml:"preconditions,omitempty"`
+
+	// The team that owns these charts, used to label namespaces when
+	// `namespace-labels` is enabled.
+	Team string `yaml:"team,omitempty"`
+
+	// Added to the metadata, and pod template metadata, of every object
+	// templated from this Ankh file, overriding the context's.
+	CommonLabels      map[string]string `yaml:"common-labels,omitempty"`
+	CommonAnnotations map[string]string `yaml:"common-annotations,omitempty"`
 
-	Dependencies []string `yaml:"dependencies"`
+	// Annotate the pod templates of workloads with a checksum of the
+	// ConfigMaps and Secrets they use, so that changing them rolls the pods.
+	ConfigChecksums bool `yaml:"config-checksums,omitempty"`
 }
 
 func ParseAnkhFile(ankhFilePath string) (AnkhFile, error) {
@@ -293,7 +660,7 @@ func getAnkhFileForChart(ctx *ExecutionContext, singleChart string) (AnkhFile, e
 	// Extract that now if possible.
 	tokens := strings.Split(singleChart, "@")
 	if len(tokens) > 2 {
-		ctx.Logger.Fatalf("Invalid chart '%v'. Too many `@` characters found. Chart must either be a name with no `@`, or in the combined `name@version` format.")
+		ctx.Logger.Fatalf("Invalid chart '%v'. Too many `@` characters found. Chart must either be a name with no `@`, or in the combined `name@version` format.", singleChart)
 	}
 	if len(tokens) == 2 {
 		singleChart = tokens[0]
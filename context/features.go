@@ -0,0 +1,92 @@
+package ankh
+
+import (
+	"os/user"
+	"sort"
+)
+
+// KnownFeatures describes each feature that can be gated using the `features` config block.
+var KnownFeatures = map[string]string{
+	"atomic-apply": "Roll back every chart applied during a run if any chart fails to apply",
+}
+
+// FeatureConfig enables a feature for everyone, or only for certain users or contexts.
+type FeatureConfig struct {
+	Enabled  bool     `yaml:"enabled,omitempty"`
+	Users    []string `yaml:"users,omitempty"`
+	Contexts []string `yaml:"contexts,omitempty"`
+}
+
+// FeatureStatus describes whether a feature is enabled for the current user and context, and why.
+type FeatureStatus struct {
+	Name        string
+	Description string
+	Enabled     bool
+	Reason      string
+	Known       bool
+}
+
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FeatureStatus reports whether a feature is enabled for the current user and context.
+func (ctx *ExecutionContext) FeatureStatus(name string) FeatureStatus {
+	description, known := KnownFeatures[name]
+	status := FeatureStatus{Name: name, Description: description, Known: known, Reason: "disabled"}
+
+	feature, ok := ctx.AnkhConfig.Features[name]
+	if !ok {
+		status.Reason = "not configured"
+		return status
+	}
+
+	if feature.Enabled {
+		status.Enabled = true
+		status.Reason = "enabled for everyone"
+	} else if username := currentUsername(); username != "" && containsString(feature.Users, username) {
+		status.Enabled = true
+		status.Reason = "enabled for user " + username
+	} else if ctx.AnkhConfig.CurrentContextName != "" && containsString(feature.Contexts, ctx.AnkhConfig.CurrentContextName) {
+		status.Enabled = true
+		status.Reason = "enabled for context " + ctx.AnkhConfig.CurrentContextName
+	}
+	return status
+}
+
+// FeatureEnabled is true if a feature is enabled for the current user and context.
+func (ctx *ExecutionContext) FeatureEnabled(name string) bool {
+	return ctx.FeatureStatus(name).Enabled
+}
+
+// FeatureStatuses reports on every known feature, and any configured features that are unknown.
+func (ctx *ExecutionContext) FeatureStatuses() []FeatureStatus {
+	names := []string{}
+	for name, _ := range KnownFeatures {
+		names = append(names, name)
+	}
+	for name, _ := range ctx.AnkhConfig.Features {
+		if _, ok := KnownFeatures[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	statuses := []FeatureStatus{}
+	for _, name := range names {
+		statuses = append(statuses, ctx.FeatureStatus(name))
+	}
+	return statuses
+}
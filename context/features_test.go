@@ -0,0 +1,36 @@
+package ankh
+
+import (
+	"testing"
+)
+
+func TestFeatureEnabled(t *testing.T) {
+	ctx := &ExecutionContext{
+		AnkhConfig: AnkhConfig{
+			CurrentContextName: "pilot",
+			Features: map[string]FeatureConfig{
+				"atomic-apply": {Contexts: []string{"pilot"}},
+				"retired":      {Enabled: true},
+				"pilot-only":   {Users: []string{"nobody-in-particular"}},
+			},
+		},
+	}
+
+	for name, expected := range map[string]bool{
+		"atomic-apply": true,
+		"retired":      true,
+		"pilot-only":   false,
+		"unconfigured": false,
+	} {
+		if ctx.FeatureEnabled(name) != expected {
+			t.Logf("expected feature %v enabled=%v", name, expected)
+			t.Fail()
+		}
+	}
+
+	statuses := ctx.FeatureStatuses()
+	if len(statuses) != len(KnownFeatures)+2 {
+		t.Logf("expected a status for each known and configured feature but got %+v", statuses)
+		t.Fail()
+	}
+}
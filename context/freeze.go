@@ -0,0 +1,198 @@
+package ankh
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FreezeWindow is a period during which apply and rollback are refused for a context.
+// It's either a fixed interval using `start` and `end`, or a recurring one using `schedule` and `duration`.
+type FreezeWindow struct {
+	Name     string `yaml:"name,omitempty"`
+	Start    string `yaml:"start,omitempty"`
+	End      string `yaml:"end,omitempty"`
+	Schedule string `yaml:"schedule,omitempty"`
+	Duration string `yaml:"duration,omitempty"`
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+func (w FreezeWindow) String() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	if w.Schedule != "" {
+		return fmt.Sprintf("%v for %v", w.Schedule, w.Duration)
+	}
+	return fmt.Sprintf("%v to %v", w.Start, w.End)
+}
+
+var cronDayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+type cronField struct {
+	values map[int]bool
+	any    bool
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow cronField
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// parseCronField parses one field of a cron expression, supporting `*`, lists,
+// ranges, steps, and (for months and days of the week) three letter names.
+func parseCronField(field string, min int, max int, names map[string]int) (cronField, error) {
+	result := cronField{values: make(map[int]bool), any: field == "*"}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		tokens := strings.SplitN(part, "/", 2)
+		if len(tokens) == 2 {
+			s, err := strconv.Atoi(tokens[1])
+			if err != nil || s <= 0 {
+				return result, fmt.Errorf("Invalid step in cron field '%v'", field)
+			}
+			step = s
+		}
+
+		lo, hi := min, max
+		if tokens[0] != "*" {
+			bounds := strings.SplitN(tokens[0], "-", 2)
+			var err error
+			lo, err = parseCronValue(bounds[0], names)
+			if err != nil {
+				return result, fmt.Errorf("Invalid value in cron field '%v'", field)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = parseCronValue(bounds[1], names)
+				if err != nil {
+					return result, fmt.Errorf("Invalid value in cron field '%v'", field)
+				}
+			} else if len(tokens) == 2 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return result, fmt.Errorf("Cron field '%v' is out of range %v-%v", field, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			result.values[v] = true
+		}
+	}
+	return result, nil
+}
+
+func parseCronSchedule(schedule string) (cronSchedule, error) {
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("Invalid schedule '%v'. Must have 5 fields: minute hour day-of-month month day-of-week", schedule)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return s, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return s, err
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return s, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return s, err
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return s, err
+	}
+	if s.dow.values[7] {
+		s.dow.values[0] = true
+	}
+	return s, nil
+}
+
+func (s cronSchedule) matches(t time.Time) bool {
+	if !s.minute.values[t.Minute()] || !s.hour.values[t.Hour()] || !s.month.values[int(t.Month())] {
+		return false
+	}
+	// Like cron, when both days are restricted, either one may match.
+	domMatch := s.dom.values[t.Day()]
+	dowMatch := s.dow.values[int(t.Weekday())]
+	if !s.dom.any && !s.dow.any {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// ActiveUntil reports whether the freeze window is active at the given time, and if so, when it ends.
+func (w FreezeWindow) ActiveUntil(now time.Time) (bool, time.Time, error) {
+	if w.Schedule == "" {
+		if w.Start == "" || w.End == "" {
+			return false, time.Time{}, fmt.Errorf("Freeze window '%v' must have either `schedule` and `duration`, or `start` and `end`", w)
+		}
+		start, err := time.Parse(time.RFC3339, w.Start)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("Invalid `start` for freeze window '%v': %v", w, err)
+		}
+		end, err := time.Parse(time.RFC3339, w.End)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("Invalid `end` for freeze window '%v': %v", w, err)
+		}
+		return !now.Before(start) && now.Before(end), end, nil
+	}
+
+	schedule, err := parseCronSchedule(w.Schedule)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil || duration <= 0 {
+		return false, time.Time{}, fmt.Errorf("Invalid `duration` '%v' for freeze window '%v'. Must be a positive duration like '48h'", w.Duration, w)
+	}
+	location := time.UTC
+	if w.Timezone != "" {
+		location, err = time.LoadLocation(w.Timezone)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("Invalid `timezone` for freeze window '%v': %v", w, err)
+		}
+	}
+
+	// Walk back minute by minute to find the most recent scheduled start that is still in effect.
+	now = now.In(location)
+	for t := now.Truncate(time.Minute); now.Sub(t) < duration; t = t.Add(-time.Minute) {
+		if schedule.matches(t) {
+			return true, t.Add(duration), nil
+		}
+	}
+	return false, time.Time{}, nil
+}
+
+// ActiveFreezeWindow returns the first of the context's freeze windows that is active at the given time, if any.
+func (context Context) ActiveFreezeWindow(now time.Time) (*FreezeWindow, time.Time, error) {
+	for _, w := range context.FreezeWindows {
+		active, until, err := w.ActiveUntil(now)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if active {
+			window := w
+			return &window, until, nil
+		}
+	}
+	return nil, time.Time{}, nil
+}
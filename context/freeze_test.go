@@ -0,0 +1,113 @@
+package ankh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	for _, schedule := range []string{"* * *", "60 * * * *", "* * * * 8", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := parseCronSchedule(schedule); err == nil {
+			t.Logf("expected an error parsing schedule '%v'", schedule)
+			t.Fail()
+		}
+	}
+
+	s, err := parseCronSchedule("*/15 9-17 * jan,dec mon-fri")
+	if err != nil {
+		t.Logf("got error %v", err)
+		t.Fail()
+		return
+	}
+	for _, minute := range []int{0, 15, 30, 45} {
+		if !s.minute.values[minute] {
+			t.Logf("expected minute %v to match", minute)
+			t.Fail()
+		}
+	}
+	if len(s.minute.values) != 4 || len(s.hour.values) != 9 || len(s.month.values) != 2 || len(s.dow.values) != 5 {
+		t.Logf("unexpected schedule %+v", s)
+		t.Fail()
+	}
+}
+
+func TestFreezeWindowActiveUntil(t *testing.T) {
+	t.Run("interval", func(t *testing.T) {
+		w := FreezeWindow{Start: "2018-12-21T17:00:00-05:00", End: "2019-01-02T09:00:00-05:00"}
+		for now, expected := range map[string]bool{
+			"2018-12-21T16:59:00-05:00": false,
+			"2018-12-21T22:00:00Z":      true,
+			"2018-12-25T12:00:00-05:00": true,
+			"2019-01-02T09:00:00-05:00": false,
+		} {
+			tm, _ := time.Parse(time.RFC3339, now)
+			active, _, err := w.ActiveUntil(tm)
+			if err != nil || active != expected {
+				t.Logf("expected active=%v at %v but got %v (err %v)", expected, now, active, err)
+				t.Fail()
+			}
+		}
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		// Weekends, from Friday at 4pm until Monday at 8am in New York.
+		w := FreezeWindow{Schedule: "0 16 * * fri", Duration: "64h", Timezone: "America/New_York"}
+		for now, expected := range map[string]bool{
+			"2018-11-16T15:59:00-05:00": false,
+			"2018-11-16T16:00:00-05:00": true,
+			"2018-11-17T21:00:00Z":      true,
+			"2018-11-19T07:59:00-05:00": true,
+			"2018-11-19T08:00:00-05:00": false,
+			"2018-11-21T12:00:00-05:00": false,
+		} {
+			tm, _ := time.Parse(time.RFC3339, now)
+			active, until, err := w.ActiveUntil(tm)
+			if err != nil || active != expected {
+				t.Logf("expected active=%v at %v but got %v (err %v)", expected, now, active, err)
+				t.Fail()
+			}
+			if active && until.Format(time.RFC3339) != "2018-11-19T08:00:00-05:00" {
+				t.Logf("expected freeze to end on monday morning but got %v", until)
+				t.Fail()
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, w := range []FreezeWindow{
+			{Start: "2018-12-21"},
+			{Start: "yesterday", End: "2018-12-21T17:00:00Z"},
+			{Schedule: "0 16 * * fri"},
+			{Schedule: "0 16 * * fri", Duration: "1d"},
+			{Schedule: "0 16 * * fri", Duration: "1h", Timezone: "Nowhere/Special"},
+		} {
+			if _, _, err := w.ActiveUntil(time.Now()); err == nil {
+				t.Logf("expected an error for freeze window %+v", w)
+				t.Fail()
+			}
+		}
+	})
+}
+
+func TestActiveFreezeWindow(t *testing.T) {
+	context := Context{
+		FreezeWindows: []FreezeWindow{
+			{Name: "past", Start: "2017-12-21T00:00:00Z", End: "2018-01-02T00:00:00Z"},
+			{Name: "holidays", Start: "2018-12-21T00:00:00Z", End: "2019-01-02T00:00:00Z"},
+		},
+	}
+
+	now, _ := time.Parse(time.RFC3339, "2018-12-25T00:00:00Z")
+	window, _, err := context.ActiveFreezeWindow(now)
+	if err != nil || window == nil || window.Name != "holidays" {
+		t.Logf("expected the holidays freeze window to be active but got %+v (err %v)", window, err)
+		t.Fail()
+	}
+
+	now, _ = time.Parse(time.RFC3339, "2018-06-01T00:00:00Z")
+	window, _, err = context.ActiveFreezeWindow(now)
+	if err != nil || window != nil {
+		t.Logf("expected no freeze window to be active but got %+v (err %v)", window, err)
+		t.Fail()
+	}
+}
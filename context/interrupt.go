@@ -0,0 +1,175 @@
+package ankh
+
+import (
+	gocontext "context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// commandStopGrace is how long a command has to exit after it's sent SIGTERM,
+// when the run is interrupted or its timeout passes, before it's killed.
+const commandStopGrace = 5 * time.Second
+
+// The run is interrupted by Interrupt, eg: when ankh receives SIGINT. That
+// cancels runContext, which every command made by Command runs under, so that
+// they're all stopped, and no more are started.
+var runContext, cancelRun = gocontext.WithCancel(gocontext.Background())
+var interruptSignal os.Signal
+var interruptMtx sync.Mutex
+
+// exiting is set by BeginExit.
+var exiting bool
+
+// runningCommands counts the commands that StartCommand was called for, and
+// Finish hasn't been yet.
+var runningCommands int
+
+// catchingSignals counts the callers of CatchSignals that haven't released it yet.
+var catchingSignals int32
+
+// CatchSignals leaves SIGINT to the commands that the user interacts with,
+// eg: `get --watch`, rather than interrupting the run, until the returned
+// func is called. Calls may overlap, eg: from `exec --parallel`, and SIGINT
+// is left to the commands until every one of them is released.
+func CatchSignals() func() {
+	atomic.AddInt32(&catchingSignals, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt32(&catchingSignals, -1)
+		})
+	}
+}
+
+// CatchingSignals is true while SIGINT is left to the commands that the user interacts with.
+func CatchingSignals() bool {
+	return atomic.LoadInt32(&catchingSignals) > 0
+}
+
+// InterruptedError is the error of a command that was stopped because the run was interrupted.
+type InterruptedError struct {
+	Command string
+	Signal  os.Signal
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("`%v` was stopped because ankh received %v", e.Command, SignalName(e.Signal))
+}
+
+// SignalName is the name of sig as shells write it, eg: SIGINT.
+func SignalName(sig os.Signal) string {
+	switch sig {
+	case syscall.SIGINT:
+		return "SIGINT"
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	}
+	return sig.String()
+}
+
+// Interrupt stops the run because ankh received sig: each running command made
+// by Command is sent SIGTERM, along with any processes it started, and is
+// killed if it hasn't exited after a few seconds. Commands made after this
+// fail to start.
+func Interrupt(sig os.Signal) {
+	interruptMtx.Lock()
+	if interruptSignal == nil {
+		interruptSignal = sig
+	}
+	interruptMtx.Unlock()
+	cancelRun()
+}
+
+// Interrupted is the signal that interrupted the run, or nil if it wasn't.
+func Interrupted() os.Signal {
+	interruptMtx.Lock()
+	defer interruptMtx.Unlock()
+	return interruptSignal
+}
+
+// BeginExit lets the commands made from now on run even though the run was
+// interrupted, so that exit handlers can still clean up, eg: release deploy
+// locks.
+func BeginExit() {
+	interruptMtx.Lock()
+	exiting = true
+	interruptMtx.Unlock()
+}
+
+// commandContext is the context that commands made by Command run under.
+func commandContext() gocontext.Context {
+	interruptMtx.Lock()
+	defer interruptMtx.Unlock()
+	if exiting {
+		return gocontext.Background()
+	}
+	return runContext
+}
+
+// RunningCommands is how many commands are running, for telling the user what
+// an interrupt is waiting for.
+func RunningCommands() int {
+	interruptMtx.Lock()
+	defer interruptMtx.Unlock()
+	return runningCommands
+}
+
+func startedCommand(delta int) {
+	interruptMtx.Lock()
+	runningCommands += delta
+	interruptMtx.Unlock()
+}
+
+// exitPaths are the temporary files and directories to remove when ankh exits
+// before it's done with them, since deferred removals don't run then. Those
+// mapped to true are only removed when the run was interrupted.
+var exitPaths = make(map[string]bool)
+var exitPathsMtx sync.Mutex
+
+// RemoveOnExit removes path if ankh exits before the returned func is called,
+// which removes it, eg: `defer ankh.RemoveOnExit(tmpDir)()`.
+func RemoveOnExit(path string) func() {
+	exitPathsMtx.Lock()
+	exitPaths[path] = false
+	exitPathsMtx.Unlock()
+	return func() {
+		exitPathsMtx.Lock()
+		delete(exitPaths, path)
+		exitPathsMtx.Unlock()
+		os.RemoveAll(path)
+	}
+}
+
+// RemoveOnInterrupt removes path if the run is interrupted, eg: the copies of
+// charts under DataDir, which are otherwise kept for troubleshooting, but
+// are likely to be incomplete when the run was interrupted.
+func RemoveOnInterrupt(path string) {
+	exitPathsMtx.Lock()
+	exitPaths[path] = true
+	exitPathsMtx.Unlock()
+}
+
+// RemoveExitPaths removes the paths given to RemoveOnExit, and to
+// RemoveOnInterrupt if the run was interrupted. Call it as ankh exits.
+func (ctx *ExecutionContext) RemoveExitPaths() {
+	interrupted := Interrupted() != nil
+	exitPathsMtx.Lock()
+	defer exitPathsMtx.Unlock()
+	for path, onlyOnInterrupt := range exitPaths {
+		if onlyOnInterrupt && !interrupted {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil && ctx.Logger != nil {
+			ctx.Logger.Warnf("Unable to remove %v: %v", path, err)
+		}
+		delete(exitPaths, path)
+	}
+	if interrupted && ctx.DataDir != "" {
+		// Remove the run's data dir too, if that left it empty.
+		os.Remove(ctx.DataDir)
+	}
+}
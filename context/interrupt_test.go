@@ -0,0 +1,90 @@
+package ankh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommandStopsProcessGroup(t *testing.T) {
+	ctx := &ExecutionContext{}
+	ctx.AnkhConfig.Timeouts = TimeoutsConfig{Apply: "100ms"}
+
+	// The shell waits on a child of its own, which has to be stopped too for the command to finish.
+	cmd := ctx.Command(ApplyPhase, "/bin/sh", "-c", "sleep 30 & wait")
+	record := ctx.StartCommand(cmd)
+	start := time.Now()
+	err := record.Finish(cmd.Run())
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Logf("expected the command to be stopped by `timeouts.apply` but got %v", err)
+		t.Fail()
+	}
+	if elapsed := time.Since(start); elapsed >= commandStopGrace {
+		t.Logf("expected the command's process group to stop right away but it took %v", elapsed)
+		t.Fail()
+	}
+	if running := RunningCommands(); running != 0 {
+		t.Logf("expected no running commands but got %v", running)
+		t.Fail()
+	}
+}
+
+func TestCatchSignals(t *testing.T) {
+	held := CatchSignals()
+
+	// Commands that catch signals and finish while another still runs, eg: with `exec --parallel`.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := CatchSignals()
+			release()
+			release()
+		}()
+	}
+	wg.Wait()
+	if !CatchingSignals() {
+		t.Log("expected signals to still be caught while a command that catches them runs")
+		t.Fail()
+	}
+
+	held()
+	if CatchingSignals() {
+		t.Log("expected signals not to be caught once every command released them")
+		t.Fail()
+	}
+}
+
+func TestRemoveExitPaths(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	ctx := &ExecutionContext{DataDir: dir}
+
+	onExit := filepath.Join(dir, "on-exit")
+	onInterrupt := filepath.Join(dir, "on-interrupt")
+	done := filepath.Join(dir, "done")
+	for _, path := range []string{onExit, onInterrupt, done} {
+		ioutil.WriteFile(path, []byte("x"), 0644)
+	}
+	RemoveOnExit(onExit)
+	RemoveOnInterrupt(onInterrupt)
+	RemoveOnExit(done)()
+	if _, err := os.Stat(done); !os.IsNotExist(err) {
+		t.Logf("expected %v to be removed once it was done with but got %v", done, err)
+		t.Fail()
+	}
+
+	ctx.RemoveExitPaths()
+	if _, err := os.Stat(onExit); !os.IsNotExist(err) {
+		t.Logf("expected %v to be removed on exit but got %v", onExit, err)
+		t.Fail()
+	}
+	if _, err := os.Stat(onInterrupt); err != nil {
+		t.Logf("expected %v to be kept, since the run wasn't interrupted, but got %v", onInterrupt, err)
+		t.Fail()
+	}
+}
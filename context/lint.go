@@ -0,0 +1,23 @@
+package ankh
+
+import (
+	"fmt"
+)
+
+// ObjectError is a problem that lint found with a single rendered object, so
+// that lint output can attribute it to the object, and to the check that found it.
+type ObjectError struct {
+	Rule string
+	Kind string
+	Name string
+	Err  error
+}
+
+func (e *ObjectError) Error() string {
+	return e.Err.Error()
+}
+
+// NewObjectError formats an ObjectError for the object with kind and name, like fmt.Errorf.
+func NewObjectError(rule string, kind string, name string, format string, args ...interface{}) error {
+	return &ObjectError{Rule: rule, Kind: kind, Name: name, Err: fmt.Errorf(format, args...)}
+}
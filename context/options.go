@@ -0,0 +1,114 @@
+package ankh
+
+import (
+	"regexp"
+	"time"
+)
+
+// CommandOptions are the flags of the command being run, which only that
+// command reads, as opposed to the global flags on ExecutionContext.
+type CommandOptions struct {
+	// ApplyWait tracks the rollouts of workloads after `apply`, up to WaitTimeout.
+	ApplyWait bool
+
+	// ApplyAtomic reverts each namespace to a snapshot taken before `apply` if it fails.
+	ApplyAtomic bool
+
+	// ApplyOnlyChanged makes `apply` diff first, and only apply the objects that differ from their live state.
+	ApplyOnlyChanged bool
+
+	// ApplyConfirm makes `apply` ask whether to apply, skip or recreate each object it would change.
+	ApplyConfirm bool
+
+	// CreateNamespace makes `apply` create the namespace it applies into if it doesn't exist.
+	CreateNamespace bool
+
+	// OverrideFreeze is the reason given for applying or rolling back during a freeze window.
+	OverrideFreeze string
+
+	// SkipScan is the reason given for applying without scanning images for vulnerabilities.
+	SkipScan string
+
+	// SkipImageCheck skips checking that the chosen tag of each chart exists in the docker registry before apply.
+	SkipImageCheck bool
+
+	// DiffPostComment makes `diff` collect its output to comment on the pull request that CI is running for.
+	DiffPostComment bool
+
+	// WaitConditions are what `wait` waits for, in order, eg: `rollout` or `condition=Available`.
+	WaitConditions []string
+
+	// WaitTimeout is how long `wait` waits in total, until WaitDeadline.
+	WaitTimeout  time.Duration
+	WaitDeadline time.Time
+
+	// OutputFormat is the format that `get` and `pods` print objects in, eg: `json`.
+	OutputFormat string
+
+	// PodNodes shows the node each pod runs on and the node's health. OnNodes limits pods to those on matching nodes.
+	PodNodes bool
+	OnNodes  []string
+
+	// ExecAll runs exec on every pod for the chart instead of a single one, optionally in parallel.
+	ExecAll, ExecParallel bool
+
+	// ExecPod is the pod to exec on, or for `cp` to copy to or from, by name or by its index in the pods sorted by name.
+	ExecPod string
+
+	// ExecTimeout, if set, is how long exec may run before it's killed.
+	ExecTimeout time.Duration
+
+	// CpSource and CpDestination are the paths to copy from and to, one of
+	// which is in the selected pod, written as `:/path`.
+	CpSource, CpDestination string
+
+	// LogsOutputPath is a file that `logs` appends to, in addition to printing.
+	LogsOutputPath string
+
+	// LogsAll streams logs from every pod for the chart at once, from at most LogsMaxPods pods.
+	LogsAll     bool
+	LogsMaxPods int
+
+	// LogsAllContainers gets logs from every container in the selected pod.
+	LogsAllContainers bool
+
+	// LogsGrep, if set, only prints log lines that match it.
+	LogsGrep *regexp.Regexp
+
+	// RunJobNames are the Jobs that `run-job` runs, or every Job in the chart when empty.
+	RunJobNames []string
+
+	// RunJobTimeout is how long `run-job` waits for each Job to finish.
+	RunJobTimeout time.Duration
+
+	// SchemaKubernetesVersion overrides the Kubernetes version that `lint` validates objects against.
+	SchemaKubernetesVersion string
+	SkipSchemaValidation    bool
+
+	// Score runs the best-practice checks in `lint`. MinScore fails charts that score lower, out of 100.
+	Score    bool
+	MinScore int
+
+	// ExplainMerge makes `values` show which source set each value, instead of the merged values.
+	ExplainMerge bool
+
+	// DiffDefaults makes `values` show only the values that differ from the chart's default values.yaml.
+	DiffDefaults bool
+
+	// ScaleReplicas is the number of replicas that `scale` sets.
+	ScaleReplicas int
+
+	// TopContainers makes `top` show the usage of each container, rather than each pod.
+	TopContainers bool
+
+	// EventsWatch makes `events` watch for new events after printing the recent ones.
+	EventsWatch bool
+
+	// RestartWait makes `restart` wait up to RestartTimeout for each workload to roll out.
+	RestartWait    bool
+	RestartTimeout string
+
+	// CPUPrice and MemoryPrice override `resources.cpuPrice` and `resources.memoryPrice` for `resources`.
+	CPUPrice    float64
+	MemoryPrice float64
+}
@@ -0,0 +1,27 @@
+// +build !windows
+
+package ankh
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup puts cmd in a process group of its own, so that stopping it
+// stops the processes it starts too, eg: helm plugins, or kubectl's
+// credential plugins. The terminal no longer sends it signals, so ankh
+// forwards them instead.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// stopProcess sends SIGTERM to cmd, and to its process group if it has one.
+func stopProcess(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	return cmd.Process.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,15 @@
+package ankh
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows, which has no process groups to
+// signal.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// stopProcess kills cmd, since Windows has no SIGTERM.
+func stopProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
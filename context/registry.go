@@ -0,0 +1,97 @@
+package ankh
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// registryHostPort is the host, and port if any, of a registry address, which
+// may be a URL, eg: `https://charts.example.com:8443/stable`.
+func registryHostPort(address string) string {
+	if i := strings.Index(address, "://"); i >= 0 {
+		address = address[i+len("://"):]
+	}
+	if i := strings.Index(address, "/"); i >= 0 {
+		address = address[:i]
+	}
+	return strings.ToLower(address)
+}
+
+// registryConfig is the config in `registries` for the registry at address,
+// by its host and port, or else by its host alone.
+func (ctx *ExecutionContext) registryConfig(address string) (RegistryConfig, bool) {
+	host := registryHostPort(address)
+	for name, config := range ctx.AnkhConfig.Registries {
+		if strings.ToLower(name) == host {
+			return config, true
+		}
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		for name, config := range ctx.AnkhConfig.Registries {
+			if strings.ToLower(name) == host[:i] {
+				return config, true
+			}
+		}
+	}
+	return RegistryConfig{}, false
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+	return path
+}
+
+// RegistryTLSConfig is the TLS config for the registry at address, per
+// `registries`. It's nil when there's nothing to configure.
+func (ctx *ExecutionContext) RegistryTLSConfig(address string) (*tls.Config, error) {
+	config, ok := ctx.registryConfig(address)
+	if !ok {
+		return nil, nil
+	}
+	host := registryHostPort(address)
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(expandHome(config.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read `caFile` of registry '%v': %v", host, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No PEM certificates in `caFile` %v of registry '%v'", config.CAFile, host)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(expandHome(config.CertFile), expandHome(config.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load the client certificate `certFile` and `keyFile` of registry '%v': %v", host, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// RegistryTransport is an HTTP transport for the registry at address, which
+// is configured with RegistryTLSConfig.
+func (ctx *ExecutionContext) RegistryTransport(address string) (*http.Transport, error) {
+	tlsConfig, err := ctx.RegistryTLSConfig(address)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
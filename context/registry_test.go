@@ -0,0 +1,63 @@
+package ankh
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "ankh-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+
+	get := func(ctx *ExecutionContext) error {
+		transport, err := ctx.RegistryTransport(server.URL + "/stable")
+		if err != nil {
+			return err
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	ctx := &ExecutionContext{}
+	if err := get(ctx); err == nil {
+		t.Logf("expected a registry with an unknown CA to fail")
+		t.Fail()
+	}
+
+	// By host and port.
+	host := strings.TrimPrefix(server.URL, "https://")
+	ctx.AnkhConfig.Registries = map[string]RegistryConfig{host: {CAFile: caFile}}
+	if err := get(ctx); err != nil {
+		t.Logf("expected the registry's CA to be trusted but got %v", err)
+		t.Fail()
+	}
+
+	// By host alone.
+	ctx.AnkhConfig.Registries = map[string]RegistryConfig{"127.0.0.1": {InsecureSkipVerify: true}}
+	if err := get(ctx); err != nil {
+		t.Logf("expected verification to be skipped but got %v", err)
+		t.Fail()
+	}
+
+	ctx.AnkhConfig.Registries = map[string]RegistryConfig{host: {CAFile: filepath.Join(dir, "missing.pem")}}
+	if _, err := ctx.RegistryTransport(server.URL); err == nil || !strings.Contains(err.Error(), "caFile") {
+		t.Logf("expected an error for a missing CA file but got %v", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,51 @@
+package ankh
+
+import (
+	"time"
+
+	"github.com/appnexus/ankh/util"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = time.Second
+)
+
+// RetryConfig configures retries of registry requests, chart fetches and kubectl
+// commands that fail with transient errors, like timeouts and refused connections.
+type RetryConfig struct {
+	// Attempts is how many times to try, in total. Defaults to 3, and 1 disables retries.
+	Attempts int `yaml:"attempts,omitempty"`
+	// Backoff is how long to wait before the first retry, which doubles for each one after. Defaults to 1s.
+	Backoff string `yaml:"backoff,omitempty"`
+}
+
+// RetryPolicy is the number of attempts and initial backoff from `retry` in the Ankh config, or their defaults.
+func (ctx *ExecutionContext) RetryPolicy() (int, time.Duration) {
+	attempts := ctx.AnkhConfig.Retry.Attempts
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	backoff := defaultRetryBackoff
+	if ctx.AnkhConfig.Retry.Backoff != "" {
+		d, err := time.ParseDuration(ctx.AnkhConfig.Retry.Backoff)
+		if err != nil {
+			ctx.Logger.Warnf("Invalid `retry.backoff` '%v', using %v instead: %v", ctx.AnkhConfig.Retry.Backoff, backoff, err)
+		} else {
+			backoff = d
+		}
+	}
+	return attempts, backoff
+}
+
+// Retry runs f, retrying it per RetryPolicy while it fails with transient
+// errors. It stops waiting to retry once the run is interrupted, or the
+// deadline set by `--timeout` passes.
+func (ctx *ExecutionContext) Retry(what string, f func() error) error {
+	attempts, backoff := ctx.RetryPolicy()
+	c, cancel := ctx.runContext()
+	defer cancel()
+	return util.Retry(attempts, backoff, c.Done(), f, func(attempt int, wait time.Duration, err error) {
+		ctx.Logger.Warnf("Retrying %v in %v, after attempt %v of %v failed: %v", what, wait, attempt, attempts, err)
+	})
+}
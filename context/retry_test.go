@@ -0,0 +1,20 @@
+package ankh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	ctx := &ExecutionContext{}
+	if attempts, backoff := ctx.RetryPolicy(); attempts != 3 || backoff != time.Second {
+		t.Logf("expected the default of 3 attempts after 1s but got %v after %v", attempts, backoff)
+		t.Fail()
+	}
+
+	ctx.AnkhConfig.Retry = RetryConfig{Attempts: 5, Backoff: "250ms"}
+	if attempts, backoff := ctx.RetryPolicy(); attempts != 5 || backoff != 250*time.Millisecond {
+		t.Logf("expected 5 attempts after 250ms but got %v after %v", attempts, backoff)
+		t.Fail()
+	}
+}
@@ -0,0 +1,140 @@
+package ankh
+
+import (
+	gocontext "context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// TimeoutsConfig bounds how long each phase of a run may take, so that a hung
+// helm or kubectl process fails the run instead of hanging it forever.
+type TimeoutsConfig struct {
+	// Template bounds each `helm template`.
+	Template string `yaml:"template,omitempty"`
+	// Apply bounds each kubectl command run by `apply`, other than waiting for rollouts.
+	Apply string `yaml:"apply,omitempty"`
+	// Wait is the default for `apply --timeout`, how long `--wait` waits for workloads to become healthy.
+	Wait string `yaml:"wait,omitempty"`
+}
+
+// Phase is the part of a run that a command belongs to, which decides its timeout.
+type Phase string
+
+const (
+	// RunPhase commands are only bounded by `--timeout`.
+	RunPhase      Phase = ""
+	TemplatePhase Phase = "template"
+	ApplyPhase    Phase = "apply"
+	WaitPhase     Phase = "wait"
+)
+
+// TimeoutError is the error of a command that was killed because it ran past its timeout.
+type TimeoutError struct {
+	Command string
+	Timeout time.Duration
+	// Setting is what set the timeout, eg: `--timeout`.
+	Setting string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("`%v` was killed after running past the %v of %v", e.Command, e.Setting, e.Timeout)
+}
+
+type commandDeadline struct {
+	ctx     gocontext.Context
+	cancel  gocontext.CancelFunc
+	timeout time.Duration
+	setting string
+}
+
+// commandDeadlines holds the context of each command made by Command, with its
+// deadline if it has one, until it's finished.
+var commandDeadlines = make(map[*exec.Cmd]commandDeadline)
+var commandDeadlinesMtx sync.Mutex
+
+// PhaseTimeout is the timeout of phase from `timeouts` in the Ankh config, or 0 for none.
+func (ctx *ExecutionContext) PhaseTimeout(phase Phase) time.Duration {
+	var value string
+	switch phase {
+	case TemplatePhase:
+		value = ctx.AnkhConfig.Timeouts.Template
+	case ApplyPhase:
+		value = ctx.AnkhConfig.Timeouts.Apply
+	case WaitPhase:
+		value = ctx.AnkhConfig.Timeouts.Wait
+	}
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		ctx.Logger.Warnf("Invalid `timeouts.%v` '%v', so it's ignored: %v", phase, value, err)
+		return 0
+	}
+	return d
+}
+
+// Command is like exec.Command, but the command is stopped once the timeout
+// of phase passes, or the deadline of the whole run set by `--timeout`,
+// whichever is first, or when the run is interrupted. Once that's happened,
+// commands fail to start at all.
+func (ctx *ExecutionContext) Command(phase Phase, name string, arg ...string) *exec.Cmd {
+	deadline := ctx.Deadline
+	timeout, setting := ctx.Timeout, "`--timeout`"
+	if d := ctx.PhaseTimeout(phase); d > 0 {
+		if phaseDeadline := time.Now().Add(d); deadline.IsZero() || phaseDeadline.Before(deadline) {
+			deadline = phaseDeadline
+			timeout, setting = d, fmt.Sprintf("`timeouts.%v`", phase)
+		}
+	}
+
+	var c gocontext.Context
+	var cancel gocontext.CancelFunc
+	if deadline.IsZero() {
+		c, cancel = gocontext.WithCancel(commandContext())
+	} else {
+		c, cancel = gocontext.WithDeadline(commandContext(), deadline)
+	}
+	cmd := exec.CommandContext(c, name, arg...)
+	// Cancel and WaitDelay need Go 1.20.
+	cmd.Cancel = func() error {
+		return stopProcess(cmd)
+	}
+	cmd.WaitDelay = commandStopGrace
+	commandDeadlinesMtx.Lock()
+	commandDeadlines[cmd] = commandDeadline{ctx: c, cancel: cancel, timeout: timeout, setting: setting}
+	commandDeadlinesMtx.Unlock()
+	return cmd
+}
+
+// runContext is done once the run is interrupted, or the deadline of the
+// whole run set by `--timeout` passes.
+func (ctx *ExecutionContext) runContext() (gocontext.Context, gocontext.CancelFunc) {
+	if ctx.Deadline.IsZero() {
+		return gocontext.WithCancel(commandContext())
+	}
+	return gocontext.WithDeadline(commandContext(), ctx.Deadline)
+}
+
+// finishDeadline releases the context of cmd, if it has one, returning a
+// TimeoutError in place of err if cmd failed because its deadline passed, or
+// an InterruptedError if it was stopped because the run was interrupted.
+func finishDeadline(cmd *exec.Cmd, command string, err error) error {
+	commandDeadlinesMtx.Lock()
+	d, ok := commandDeadlines[cmd]
+	delete(commandDeadlines, cmd)
+	commandDeadlinesMtx.Unlock()
+	if !ok {
+		return err
+	}
+	defer d.cancel()
+	if err != nil && d.ctx.Err() == gocontext.DeadlineExceeded {
+		return &TimeoutError{Command: command, Timeout: d.timeout, Setting: d.setting}
+	}
+	if sig := Interrupted(); err != nil && sig != nil && d.ctx.Err() == gocontext.Canceled {
+		return &InterruptedError{Command: command, Signal: sig}
+	}
+	return err
+}
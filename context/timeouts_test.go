@@ -0,0 +1,50 @@
+package ankh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommandTimeout(t *testing.T) {
+	ctx := &ExecutionContext{}
+	ctx.AnkhConfig.Timeouts = TimeoutsConfig{Apply: "100ms", Wait: "10m"}
+	if timeout := ctx.PhaseTimeout(WaitPhase); timeout != 10*time.Minute {
+		t.Logf("expected a wait timeout of 10m but got %v", timeout)
+		t.Fail()
+	}
+	if timeout := ctx.PhaseTimeout(TemplatePhase); timeout != 0 {
+		t.Logf("expected no template timeout but got %v", timeout)
+		t.Fail()
+	}
+
+	cmd := ctx.Command(ApplyPhase, "/bin/sh", "-c", "exec sleep 5")
+	record := ctx.StartCommand(cmd)
+	err := record.Finish(cmd.Run())
+	if e, ok := err.(*TimeoutError); !ok || e.Setting != "`timeouts.apply`" || e.Command != "sh" {
+		t.Logf("expected the command to be killed by `timeouts.apply` but got %v", err)
+		t.Fail()
+	}
+
+	// Once the run's deadline has passed, commands don't start at all.
+	ctx.Timeout = time.Minute
+	ctx.Deadline = time.Now().Add(-time.Second)
+	cmd = ctx.Command(TemplatePhase, "/bin/sh", "-c", "true")
+	record = ctx.StartCommand(cmd)
+	err = record.Finish(cmd.Run())
+	if e, ok := err.(*TimeoutError); !ok || e.Setting != "`--timeout`" || e.Timeout != time.Minute {
+		t.Logf("expected the command to fail because of `--timeout` but got %v", err)
+		t.Fail()
+	}
+
+	ctx.Deadline = time.Time{}
+	cmd = ctx.Command(TemplatePhase, "/bin/sh", "-c", "true")
+	record = ctx.StartCommand(cmd)
+	if err := record.Finish(cmd.Run()); err != nil {
+		t.Logf("expected the command to succeed but got %v", err)
+		t.Fail()
+	}
+	if len(commandDeadlines) != 0 {
+		t.Logf("expected every deadline to be released but got %v", len(commandDeadlines))
+		t.Fail()
+	}
+}
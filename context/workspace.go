@@ -0,0 +1,107 @@
+package ankh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Workspace is a named set of Ankh files, with the flags they're usually run
+// with, for operating several services without remembering how each is run.
+type Workspace struct {
+	Name string `yaml:"-"`
+	Path string `yaml:"-"`
+
+	// AnkhFiles are run in order, in place of `-f`. Relative paths are
+	// relative to the workspace file.
+	AnkhFiles []string `yaml:"ankhFiles,omitempty"`
+
+	// Environment or Context is used unless `--environment` or `--context` is given.
+	Environment string `yaml:"environment,omitempty"`
+	Context     string `yaml:"context,omitempty"`
+
+	// Namespace is used unless `--namespace` is given.
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Set are `key=value` pairs passed to helm before any `--set`.
+	Set []string `yaml:"set,omitempty"`
+
+	// Filters are the object kinds to include, unless `--filter` or `--only` is given.
+	Filters []string `yaml:"filters,omitempty"`
+}
+
+// WorkspacePath finds the workspace file for name, which is either a path to
+// a file, or the name of a file in dir, with or without `.yaml`.
+func WorkspacePath(dir string, name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) || strings.HasSuffix(name, ".yaml") {
+		return name
+	}
+	return filepath.Join(dir, name+".yaml")
+}
+
+// ParseWorkspace reads and validates the workspace file at workspacePath.
+// Its Path, and the paths of its Ankh files, are absolute, since each Ankh
+// file is run from its own directory.
+func ParseWorkspace(workspacePath string) (Workspace, error) {
+	workspace := Workspace{}
+	workspacePath, err := filepath.Abs(workspacePath)
+	if err != nil {
+		return workspace, fmt.Errorf("Unable to find workspace '%v': %v", workspacePath, err)
+	}
+	body, err := ioutil.ReadFile(workspacePath)
+	if err != nil {
+		return workspace, fmt.Errorf("Unable to read workspace '%v': %v", workspacePath, err)
+	}
+	if err := yaml.UnmarshalStrict(body, &workspace); err != nil {
+		return workspace, fmt.Errorf("Error loading workspace '%v': %v", workspacePath, err)
+	}
+	workspace.Name = strings.TrimSuffix(filepath.Base(workspacePath), ".yaml")
+	workspace.Path = workspacePath
+
+	if workspace.Context != "" && workspace.Environment != "" {
+		return workspace, fmt.Errorf("Workspace '%v' must not have both a `context` and an `environment`", workspacePath)
+	}
+	for _, set := range workspace.Set {
+		if len(strings.Split(set, "=")) != 2 {
+			return workspace, fmt.Errorf("Workspace '%v' has malformed `set` value '%v', which must be of the form `key=value`", workspacePath, set)
+		}
+	}
+
+	dir := filepath.Dir(workspacePath)
+	for i, ankhFilePath := range workspace.AnkhFiles {
+		if u, err := url.Parse(ankhFilePath); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			continue
+		}
+		if strings.HasPrefix(ankhFilePath, "~/") {
+			workspace.AnkhFiles[i] = filepath.Join(os.Getenv("HOME"), ankhFilePath[2:])
+		} else if !filepath.IsAbs(ankhFilePath) {
+			workspace.AnkhFiles[i] = filepath.Join(dir, ankhFilePath)
+		}
+	}
+	return workspace, nil
+}
+
+// ListWorkspaces returns the names of the workspaces in dir, sorted.
+func ListWorkspaces(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".yaml") {
+			names = append(names, strings.TrimSuffix(f.Name(), ".yaml"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
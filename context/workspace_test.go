@@ -0,0 +1,50 @@
+package ankh
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseWorkspace(t *testing.T) {
+	path := WorkspacePath(filepath.Join("testdata", "workspaces"), "payments")
+	workspace, err := ParseWorkspace(path)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	dir, err := filepath.Abs(filepath.Join("testdata", "workspaces"))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := []string{filepath.Join(dir, "payments", "ankh.yaml"), "/srv/ledger/ankh.yaml", "https://example.com/ankh.yaml"}
+	if !reflect.DeepEqual(workspace.AnkhFiles, expected) {
+		t.Logf("expected Ankh files %v but got %v", expected, workspace.AnkhFiles)
+		t.Fail()
+	}
+	if workspace.Name != "payments" || workspace.Environment != "production" || workspace.Namespace != "payments" {
+		t.Logf("got unexpected workspace %+v", workspace)
+		t.Fail()
+	}
+
+	if _, err := ParseWorkspace(WorkspacePath(filepath.Join("testdata", "workspaces"), "invalid")); err == nil {
+		t.Log("expected an error for a workspace with both a context and an environment")
+		t.Fail()
+	}
+}
+
+func TestListWorkspaces(t *testing.T) {
+	names, err := ListWorkspaces(filepath.Join("testdata", "workspaces"))
+	if err != nil || !reflect.DeepEqual(names, []string{"invalid", "payments"}) {
+		t.Logf("got unexpected workspaces %v, %v", names, err)
+		t.Fail()
+	}
+
+	names, err = ListWorkspaces(filepath.Join("testdata", "missing"))
+	if err != nil || len(names) != 0 {
+		t.Logf("expected no workspaces but got %v, %v", names, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,211 @@
+package convert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+type HelmfileRepository struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+type HelmfileSetValue struct {
+	Name  string      `yaml:"name"`
+	Value interface{} `yaml:"value"`
+}
+
+type HelmfileRelease struct {
+	Name        string             `yaml:"name"`
+	Namespace   string             `yaml:"namespace"`
+	Chart       string             `yaml:"chart"`
+	Version     string             `yaml:"version"`
+	KubeContext string             `yaml:"kubeContext"`
+	Installed   *bool              `yaml:"installed"`
+	Values      []interface{}      `yaml:"values"`
+	Set         []HelmfileSetValue `yaml:"set"`
+	Secrets     []interface{}      `yaml:"secrets"`
+}
+
+type HelmfileEnvironment struct {
+	KubeContext string        `yaml:"kubeContext"`
+	Values      []interface{} `yaml:"values"`
+}
+
+type HelmfileDefaults struct {
+	KubeContext string `yaml:"kubeContext"`
+}
+
+// Helmfile is the subset of the helmfile.yaml schema that can be represented by Ankh.
+type Helmfile struct {
+	Repositories []HelmfileRepository           `yaml:"repositories"`
+	Environments map[string]HelmfileEnvironment `yaml:"environments"`
+	HelmDefaults HelmfileDefaults               `yaml:"helmDefaults"`
+	Releases     []HelmfileRelease              `yaml:"releases"`
+	Helmfiles    []interface{}                  `yaml:"helmfiles"`
+	Bases        []string                       `yaml:"bases"`
+}
+
+// releaseValues merges a release's inline values, local values files, and `set` entries,
+// which become the chart's `default-values` in the Ankh file.
+func releaseValues(ctx *ankh.ExecutionContext, dir string, release HelmfileRelease) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for _, v := range release.Values {
+		switch entry := v.(type) {
+		case string:
+			if strings.HasSuffix(entry, ".gotmpl") {
+				ctx.Logger.Warnf("Skipping templated values file '%v' for release '%v'. Add these values to the Ankh file by hand.",
+					entry, release.Name)
+				continue
+			}
+			valuesPath := entry
+			if !filepath.IsAbs(valuesPath) {
+				valuesPath = filepath.Join(dir, valuesPath)
+			}
+			body, err := ioutil.ReadFile(valuesPath)
+			if err != nil {
+				return values, fmt.Errorf("Unable to read values file '%v' for release '%v': %v", valuesPath, release.Name, err)
+			}
+			fileValues := make(map[interface{}]interface{})
+			if err := yaml.Unmarshal(body, &fileValues); err != nil {
+				return values, fmt.Errorf("Unable to parse values file '%v' for release '%v': %v", valuesPath, release.Name, err)
+			}
+			values = util.MergeValues(values, util.NormalizeYAMLMap(fileValues).(map[string]interface{}))
+		default:
+			if m, ok := util.NormalizeYAMLMap(entry).(map[string]interface{}); ok {
+				values = util.MergeValues(values, m)
+			}
+		}
+	}
+
+	for _, set := range release.Set {
+		util.SetValue(values, set.Name, set.Value)
+	}
+
+	if len(release.Secrets) > 0 {
+		ctx.Logger.Warnf("Skipping %v secrets file(s) for release '%v'. Ankh does not decrypt helm-secrets files.",
+			len(release.Secrets), release.Name)
+	}
+
+	return values, nil
+}
+
+// FromHelmfile converts a helmfile into an equivalent Ankh file, and an Ankh
+// config with one context per helmfile environment.
+func FromHelmfile(ctx *ankh.ExecutionContext, helmfilePath string) (ankh.AnkhFile, ankh.AnkhConfig, error) {
+	ankhFile := ankh.AnkhFile{}
+	ankhConfig := ankh.AnkhConfig{}
+
+	body, err := ioutil.ReadFile(helmfilePath)
+	if err != nil {
+		return ankhFile, ankhConfig, err
+	}
+
+	helmfile := Helmfile{}
+	if err := yaml.Unmarshal(body, &helmfile); err != nil {
+		return ankhFile, ankhConfig, fmt.Errorf("Error loading helmfile '%v': %v", helmfilePath, err)
+	}
+
+	if len(helmfile.Helmfiles) > 0 || len(helmfile.Bases) > 0 {
+		ctx.Logger.Warnf("Helmfile '%v' uses `helmfiles` or `bases`, which are not converted. Convert each referenced helmfile separately.", helmfilePath)
+	}
+
+	repositories := make(map[string]string)
+	for _, repo := range helmfile.Repositories {
+		repositories[repo.Name] = repo.URL
+		if ankhConfig.Helm.Registry == "" {
+			ankhConfig.Helm.Registry = repo.URL
+		} else {
+			ankhConfig.Helm.FallbackRegistries = append(ankhConfig.Helm.FallbackRegistries, repo.URL)
+		}
+	}
+	if len(repositories) > 1 {
+		ctx.Logger.Warnf("Using repository '%v' as `helm.registry` and the rest as `helm.fallbackRegistries`. Ankh does not select registries per chart.",
+			ankhConfig.Helm.Registry)
+	}
+
+	dir := filepath.Dir(helmfilePath)
+	for _, release := range helmfile.Releases {
+		if release.Installed != nil && !*release.Installed {
+			ctx.Logger.Infof("Skipping release '%v' since it is not installed", release.Name)
+			continue
+		}
+
+		chart := ankh.Chart{Version: release.Version}
+		if strings.HasPrefix(release.Chart, ".") || strings.HasPrefix(release.Chart, "/") {
+			chart.Path = release.Chart
+			chart.Name = filepath.Base(release.Chart)
+		} else {
+			tokens := strings.SplitN(release.Chart, "/", 2)
+			chart.Name = tokens[len(tokens)-1]
+			if len(tokens) == 2 {
+				if _, ok := repositories[tokens[0]]; !ok {
+					ctx.Logger.Warnf("Release '%v' uses chart '%v' from unknown repository '%v'", release.Name, release.Chart, tokens[0])
+				}
+			}
+		}
+		if chart.Name != release.Name {
+			ctx.Logger.Warnf("Release '%v' is named differently than its chart '%v'. Ankh names releases using the context's `release`.",
+				release.Name, chart.Name)
+		}
+
+		if release.KubeContext != "" {
+			ctx.Logger.Warnf("Release '%v' sets `kubeContext` '%v', which is not converted. Ankh applies every chart to the context's `kube-context`, "+
+				"so move the release to its own Ankh file, applied with a context for that kube-context.", release.Name, release.KubeContext)
+		}
+
+		if release.Namespace != "" {
+			namespace := release.Namespace
+			chart.Namespace = &namespace
+		}
+
+		values, err := releaseValues(ctx, dir, release)
+		if err != nil {
+			return ankhFile, ankhConfig, err
+		}
+		if len(values) > 0 {
+			chart.DefaultValues = values
+		}
+
+		ankhFile.Charts = append(ankhFile.Charts, chart)
+	}
+
+	environments := []string{}
+	for name, _ := range helmfile.Environments {
+		environments = append(environments, name)
+	}
+	if len(environments) == 0 {
+		environments = []string{"default"}
+	}
+	sort.Strings(environments)
+
+	ankhConfig.Contexts = make(map[string]ankh.Context)
+	for _, name := range environments {
+		env := helmfile.Environments[name]
+		kubeContext := env.KubeContext
+		if kubeContext == "" {
+			kubeContext = helmfile.HelmDefaults.KubeContext
+		}
+		if kubeContext == "" {
+			ctx.Logger.Warnf("No kubeContext found for environment '%v'. Set `kube-context` on the generated context by hand.", name)
+		}
+		if len(env.Values) > 0 {
+			ctx.Logger.Warnf("Environment '%v' has values, which are not converted. Helmfile environment values only apply to helmfile templates.", name)
+		}
+		ankhConfig.Contexts[name] = ankh.Context{
+			KubeContext:      kubeContext,
+			EnvironmentClass: name,
+			ResourceProfile:  "natural",
+		}
+	}
+
+	return ankhFile, ankhConfig, nil
+}
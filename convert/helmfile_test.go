@@ -0,0 +1,61 @@
+package convert
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestFromHelmfile(t *testing.T) {
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &logs
+	ctx := &ankh.ExecutionContext{Logger: logger}
+
+	ankhFile, ankhConfig, err := FromHelmfile(ctx, "testdata/helmfile.yaml")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	if len(ankhFile.Charts) != 2 {
+		t.Logf("expected 2 charts but got %+v", ankhFile.Charts)
+		t.FailNow()
+	}
+
+	web := ankhFile.Charts[0]
+	if web.Name != "web" || web.Version != "1.2.3" || web.Namespace == nil || *web.Namespace != "frontend" {
+		t.Logf("got unexpected chart %+v", web)
+		t.Fail()
+	}
+	image := web.DefaultValues["image"].(map[string]interface{})
+	if web.DefaultValues["replicas"] != 3 || image["name"] != "web" || image["tag"] != "v1" {
+		t.Logf("got unexpected default-values %+v", web.DefaultValues)
+		t.Fail()
+	}
+
+	if local := ankhFile.Charts[1]; local.Path != "./charts/local" || local.Name != "local" {
+		t.Logf("got unexpected chart %+v", local)
+		t.Fail()
+	}
+	if !strings.Contains(logs.String(), "Release 'local' sets `kubeContext` 'other-cluster', which is not converted") {
+		t.Logf("expected a warning that the release's kubeContext is not converted but got:\n%v", logs.String())
+		t.Fail()
+	}
+
+	if ankhConfig.Helm.Registry != "https://kubernetes-charts.storage.googleapis.com" ||
+		len(ankhConfig.Helm.FallbackRegistries) != 1 {
+		t.Logf("got unexpected helm config %+v", ankhConfig.Helm)
+		t.Fail()
+	}
+
+	if ankhConfig.Contexts["production"].KubeContext != "prod-cluster" ||
+		ankhConfig.Contexts["staging"].KubeContext != "minikube" {
+		t.Logf("got unexpected contexts %+v", ankhConfig.Contexts)
+		t.Fail()
+	}
+}
@@ -0,0 +1,123 @@
+package cosign
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/appnexus/ankh/context"
+)
+
+var execCommand = exec.Command
+
+// Applies is true when the current context has `cosign.enabled` set and
+// charts and images are about to be applied to it.
+func Applies(ctx *ankh.ExecutionContext) bool {
+	return ctx.Mode == ankh.Apply && ctx.AnkhConfig.CurrentContext.Cosign.Enabled
+}
+
+// verifiers are the ways that the current context's `cosign` config verifies
+// signatures: its key, or else each of its keyless identities, any one of
+// which is enough. Each is the flags to pass to cosign.
+func verifiers(config ankh.CosignConfig) ([][]string, error) {
+	if config.Key != "" {
+		return [][]string{{"--key", config.Key}}, nil
+	}
+	if len(config.Identities) == 0 {
+		return nil, fmt.Errorf("`cosign` needs a `key` or at least one of `identities` to verify signatures with")
+	}
+	flags := [][]string{}
+	for _, identity := range config.Identities {
+		if identity.Issuer == "" || (identity.Subject == "") == (identity.SubjectRegexp == "") {
+			return nil, fmt.Errorf("Each of `cosign.identities` needs an `issuer`, and one of `subject` or `subject-regexp`, found %+v", identity)
+		}
+		f := []string{"--certificate-oidc-issuer", identity.Issuer}
+		if identity.Subject != "" {
+			f = append(f, "--certificate-identity", identity.Subject)
+		} else {
+			f = append(f, "--certificate-identity-regexp", identity.SubjectRegexp)
+		}
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+// verify runs `cosign <command>` with each of the verifiers' flags in turn,
+// until one of them verifies the signature.
+func verify(ctx *ankh.ExecutionContext, what string, command string, args []string, arg string) error {
+	flags, err := verifiers(ctx.AnkhConfig.CurrentContext.Cosign)
+	if err != nil {
+		return err
+	}
+	failures := []string{}
+	for _, f := range flags {
+		cosignCmd := execCommand("cosign", append(append(append([]string{command}, f...), args...), arg)...)
+		var output bytes.Buffer
+		cosignCmd.Stdout = &output
+		cosignCmd.Stderr = &output
+
+		ctx.Logger.Debugf("Running cosign cmd %+v", cosignCmd.Args)
+		err := cosignCmd.Run()
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%v: %v", err, strings.TrimSpace(output.String())))
+	}
+	return fmt.Errorf("Unable to verify the signature of %v -- cosign had the following output:\n%v", what, strings.Join(failures, "\n"))
+}
+
+// verified are the images whose signatures were verified already during this
+// run, by context, so that images shared by namespaces are verified once.
+var verified = make(map[string]bool)
+var verifiedMtx sync.Mutex
+
+// VerifyImage verifies the signature of image with `cosign verify`, per the
+// current context's `cosign` config.
+func VerifyImage(ctx *ankh.ExecutionContext, image string) error {
+	key := ctx.AnkhConfig.CurrentContextName + " " + image
+	verifiedMtx.Lock()
+	defer verifiedMtx.Unlock()
+	if verified[key] {
+		return nil
+	}
+
+	ctx.Logger.Infof("Verifying the signature of image %v", image)
+	if err := verify(ctx, fmt.Sprintf("image '%v'", image), "verify", []string{"--output", "json"}, image); err != nil {
+		return err
+	}
+	verified[key] = true
+	return nil
+}
+
+// VerifyBlob verifies signature, and certificate when it's signed keyless, of
+// blob with `cosign verify-blob`, per the current context's `cosign` config.
+// name is what blob is, eg: a chart's archive.
+func VerifyBlob(ctx *ankh.ExecutionContext, name string, blob []byte, signature []byte, certificate []byte) error {
+	dir, err := ioutil.TempDir(ctx.DataDir, "cosign-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	blobPath, signaturePath := filepath.Join(dir, "blob"), filepath.Join(dir, "blob.sig")
+	if err := ioutil.WriteFile(blobPath, blob, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(signaturePath, signature, 0644); err != nil {
+		return err
+	}
+	args := []string{"--signature", signaturePath}
+	if len(certificate) > 0 {
+		certificatePath := filepath.Join(dir, "blob.pem")
+		if err := ioutil.WriteFile(certificatePath, certificate, 0644); err != nil {
+			return err
+		}
+		args = append(args, "--certificate", certificatePath)
+	}
+	return verify(ctx, name, "verify-blob", args, blobPath)
+}
@@ -0,0 +1,97 @@
+package cosign
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestVerifyImage(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	calls := []string{}
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		calls = append(calls, strings.Join(arg, " "))
+		// Only the CI workflow signs images.
+		if strings.Contains(strings.Join(arg, " "), "--certificate-identity-regexp ^https://github.com/example/") {
+			return exec.Command("true")
+		}
+		return exec.Command("sh", "-c", "echo 'no matching signatures' >&2; exit 1")
+	}
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply}
+	ctx.AnkhConfig.CurrentContextName = "production"
+	ctx.AnkhConfig.CurrentContext.Cosign = ankh.CosignConfig{
+		Enabled: true,
+		Identities: []ankh.CosignIdentity{
+			{Issuer: "https://accounts.google.com", Subject: "release@example.com"},
+			{Issuer: "https://token.actions.githubusercontent.com", SubjectRegexp: "^https://github.com/example/"},
+		},
+	}
+	if !Applies(ctx) {
+		t.Log("expected cosign to apply")
+		t.Fail()
+	}
+	if err := VerifyImage(ctx, "registry.example.com/web:1.2.3"); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	expected := []string{
+		"verify --certificate-oidc-issuer https://accounts.google.com --certificate-identity release@example.com --output json registry.example.com/web:1.2.3",
+		"verify --certificate-oidc-issuer https://token.actions.githubusercontent.com --certificate-identity-regexp ^https://github.com/example/ --output json registry.example.com/web:1.2.3",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Logf("expected cosign to be run with\n%v\nbut got\n%v", strings.Join(expected, "\n"), strings.Join(calls, "\n"))
+		t.Fail()
+	}
+
+	// Verified images aren't verified again.
+	calls = []string{}
+	if err := VerifyImage(ctx, "registry.example.com/web:1.2.3"); err != nil || len(calls) != 0 {
+		t.Logf("expected no cosign calls for a verified image but got %v and error %v", calls, err)
+		t.Fail()
+	}
+
+	ctx.AnkhConfig.CurrentContext.Cosign.Identities = ctx.AnkhConfig.CurrentContext.Cosign.Identities[:1]
+	err := VerifyImage(ctx, "registry.example.com/api:1.0.0")
+	if err == nil || !strings.Contains(err.Error(), "no matching signatures") {
+		t.Logf("expected an error with cosign's output but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestVerifyBlob(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	var args []string
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		args = arg
+		return exec.Command("true")
+	}
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply}
+	ctx.AnkhConfig.CurrentContext.Cosign = ankh.CosignConfig{Enabled: true, Key: "cosign.pub"}
+	if err := VerifyBlob(ctx, "chart 'web-1.0.0.tgz'", []byte("chart"), []byte("signature"), nil); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(args) != 6 || args[0] != "verify-blob" || args[1] != "--key" || args[2] != "cosign.pub" || args[3] != "--signature" {
+		t.Logf("expected cosign verify-blob with the key and signature but got %v", args)
+		t.Fail()
+	}
+}
+
+func TestVerifiers(t *testing.T) {
+	for _, config := range []ankh.CosignConfig{
+		{Enabled: true},
+		{Enabled: true, Identities: []ankh.CosignIdentity{{Subject: "release@example.com"}}},
+		{Enabled: true, Identities: []ankh.CosignIdentity{{Issuer: "https://accounts.google.com"}}},
+	} {
+		if _, err := verifiers(config); err == nil {
+			t.Logf("expected an error for config %+v", config)
+			t.Fail()
+		}
+	}
+}
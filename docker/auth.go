@@ -0,0 +1,333 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/docker/docker/api/types"
+)
+
+// dockerConfigFile is the part of Docker's config.json that holds the
+// credentials stored by `docker login`.
+type dockerConfigFile struct {
+	Auths       map[string]dockerConfigAuth `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+type dockerConfigAuth struct {
+	// Auth is base64 of `username:password`.
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+	RegistryToken string `json:"registrytoken"`
+}
+
+// identityTokenUsername is the username that credential helpers return with
+// an identity token, rather than a password, as the secret.
+const identityTokenUsername = "<token>"
+
+// dockerConfigPath is config.json in $DOCKER_CONFIG, or in ~/.docker.
+func dockerConfigPath() string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+	return filepath.Join(dir, "config.json")
+}
+
+// registryHost is the host of a registry address, which may be a URL, eg:
+// `https://index.docker.io/v1/`. Docker Hub's addresses are all
+// `index.docker.io`, which is what `docker login` stores its credentials as.
+func registryHost(address string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://")
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return "index.docker.io"
+	}
+	return host
+}
+
+// dockerConfigCredentials returns the credentials for registry from Docker's
+// config, the way `docker login` stored them: with the registry's credential
+// helper in `credHelpers`, in `auths`, or with the `credsStore` helper.
+func dockerConfigCredentials(ctx *ankh.ExecutionContext, registry string) (types.AuthConfig, bool, error) {
+	path := dockerConfigPath()
+	body, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return types.AuthConfig{}, false, nil
+	} else if err != nil {
+		return types.AuthConfig{}, false, err
+	}
+	config := dockerConfigFile{}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return types.AuthConfig{}, false, fmt.Errorf("Unable to parse Docker config %v: %v", path, err)
+	}
+
+	host := registryHost(registry)
+	for address, helper := range config.CredHelpers {
+		if registryHost(address) == host {
+			return credentialHelperCredentials(ctx, helper, address)
+		}
+	}
+	for address, entry := range config.Auths {
+		if registryHost(address) != host {
+			continue
+		}
+		auth := types.AuthConfig{
+			ServerAddress: address,
+			Username:      entry.Username,
+			Password:      entry.Password,
+			IdentityToken: entry.IdentityToken,
+			RegistryToken: entry.RegistryToken,
+		}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if err != nil || len(parts) != 2 {
+				return types.AuthConfig{}, false, fmt.Errorf("Invalid `auth` for '%v' in Docker config %v", address, path)
+			}
+			auth.Username, auth.Password = parts[0], parts[1]
+		}
+		if auth.Username != "" || auth.IdentityToken != "" || auth.RegistryToken != "" {
+			return auth, true, nil
+		}
+		// With a credsStore, `auths` only lists the registries that it has credentials for.
+		if config.CredsStore != "" {
+			return credentialHelperCredentials(ctx, config.CredsStore, address)
+		}
+	}
+	return types.AuthConfig{}, false, nil
+}
+
+type credentialHelperOutput struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// credentialHelperCredentials gets the credentials for address from the
+// Docker credential helper `docker-credential-$helper`.
+func credentialHelperCredentials(ctx *ankh.ExecutionContext, helper string, address string) (types.AuthConfig, bool, error) {
+	name := "docker-credential-" + helper
+	cmd := ctx.Command(ankh.RunPhase, name, "get")
+	cmd.Stdin = strings.NewReader(address)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	record := ctx.StartCommand(cmd)
+	err := record.Finish(cmd.Run())
+	if err != nil {
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(output, "credentials not found") {
+			return types.AuthConfig{}, false, nil
+		}
+		return types.AuthConfig{}, false, fmt.Errorf("`%v get` failed for '%v': %v %v", name, address, err, output)
+	}
+
+	output := credentialHelperOutput{}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return types.AuthConfig{}, false, fmt.Errorf("Unable to parse the output of `%v get`: %v", name, err)
+	}
+	auth := types.AuthConfig{ServerAddress: address}
+	if output.Username == identityTokenUsername {
+		auth.IdentityToken = output.Secret
+	} else {
+		auth.Username, auth.Password = output.Username, output.Secret
+	}
+	return auth, true, nil
+}
+
+// authTransport authenticates requests to a registry per the registry v2 auth
+// spec: it answers a `Basic` challenge with the username and password, and a
+// `Bearer` challenge by exchanging the credentials at the challenge's realm
+// for a token, which is reused for later requests with the same scope.
+type authTransport struct {
+	transport http.RoundTripper
+	auth      types.AuthConfig
+
+	mtx    sync.Mutex
+	tokens map[string]string
+	basic  bool
+}
+
+func newAuthTransport(transport http.RoundTripper, auth types.AuthConfig) *authTransport {
+	return &authTransport{transport: transport, auth: auth, tokens: make(map[string]string)}
+}
+
+var repositoryPathRegexp = regexp.MustCompile(`^/v2/(.+)/(?:tags/list|manifests/[^/]+)$`)
+
+// requestScope is the scope that a request to the registry needs a token for.
+func requestScope(req *http.Request) string {
+	if m := repositoryPathRegexp.FindStringSubmatch(req.URL.Path); m != nil {
+		return fmt.Sprintf("repository:%v:pull", m[1])
+	}
+	if req.URL.Path == "/v2/_catalog" {
+		return "registry:catalog:*"
+	}
+	return ""
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	scope := requestScope(req)
+	t.mtx.Lock()
+	token, basic := t.tokens[scope], t.basic
+	t.mtx.Unlock()
+
+	resp, err := t.transport.RoundTrip(t.authorize(req, token, basic))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch {
+	case challenge.scheme == "basic" && !basic && t.auth.Username != "":
+		t.mtx.Lock()
+		t.basic = true
+		t.mtx.Unlock()
+		resp.Body.Close()
+		return t.transport.RoundTrip(t.authorize(req, "", true))
+	case challenge.scheme == "bearer" && challenge.params["realm"] != "":
+		token, err := t.fetchToken(challenge.params)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.mtx.Lock()
+		t.tokens[scope] = token
+		t.mtx.Unlock()
+		return t.transport.RoundTrip(t.authorize(req, token, false))
+	}
+	return resp, nil
+}
+
+// authorize is a copy of req with its Authorization header set.
+func (t *authTransport) authorize(req *http.Request, token string, basic bool) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	switch {
+	case token != "":
+		r.Header.Set("Authorization", "Bearer "+token)
+	case t.auth.RegistryToken != "":
+		r.Header.Set("Authorization", "Bearer "+t.auth.RegistryToken)
+	case basic:
+		r.SetBasicAuth(t.auth.Username, t.auth.Password)
+	}
+	return r
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// fetchToken exchanges the credentials for a token at the realm of a bearer
+// challenge: an identity token with an OAuth2 refresh token grant, and a
+// username and password with basic auth, or anonymously without either.
+func (t *authTransport) fetchToken(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("Invalid token realm '%v': %v", params["realm"], err)
+	}
+	scopes := strings.Fields(params["scope"])
+
+	var req *http.Request
+	if t.auth.IdentityToken != "" {
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", t.auth.IdentityToken)
+		form.Set("client_id", "ankh")
+		form.Set("service", params["service"])
+		form.Set("scope", strings.Join(scopes, " "))
+		req, err = http.NewRequest("POST", realm.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := realm.Query()
+		if params["service"] != "" {
+			query.Set("service", params["service"])
+		}
+		for _, scope := range scopes {
+			query.Add("scope", scope)
+		}
+		if t.auth.Username != "" {
+			query.Set("account", t.auth.Username)
+		}
+		realm.RawQuery = query.Encode()
+		req, err = http.NewRequest("GET", realm.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if t.auth.Username != "" {
+			req.SetBasicAuth(t.auth.Username, t.auth.Password)
+		}
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Getting a token from %v failed with status %v", realm.Host, resp.Status)
+	}
+	token := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("Unable to parse the token from %v: %v", realm.Host, err)
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return "", fmt.Errorf("%v returned an empty token", realm.Host)
+}
+
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+var challengeParamRegexp = regexp.MustCompile(`([a-zA-Z_]+)=(?:"([^"]*)"|([^,\s]*))`)
+
+// parseChallenge parses a WWW-Authenticate header, eg:
+// `Bearer realm="https://auth.example.com/token",service="registry",scope="repository:web:pull"`.
+func parseChallenge(header string) challenge {
+	header = strings.TrimSpace(header)
+	c := challenge{params: make(map[string]string)}
+	i := strings.IndexAny(header, " \t")
+	if i < 0 {
+		c.scheme = strings.ToLower(header)
+		return c
+	}
+	c.scheme = strings.ToLower(header[:i])
+	for _, m := range challengeParamRegexp.FindAllStringSubmatch(header[i:], -1) {
+		value := m[2]
+		if value == "" {
+			value = m[3]
+		}
+		c.params[strings.ToLower(m[1])] = value
+	}
+	return c
+}
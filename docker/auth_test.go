@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// newTokenRegistry is a registry that demands a bearer token, which its token
+// endpoint only hands out for the credentials user and secret.
+func newTokenRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			user, password, ok := r.BasicAuth()
+			if !ok || user != "user" || password != "secret" || r.URL.Query().Get("scope") != "repository:team/web:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"token": "t0ken"}`)
+		case r.Header.Get("Authorization") == "Bearer t0ken":
+			fmt.Fprintf(w, `{"name": "team/web", "tags": ["1.0.0", "1.1.0"]}`)
+		default:
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="registry",scope="repository:team/web:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	return server
+}
+
+func TestListTagsWithDockerConfig(t *testing.T) {
+	server := newTokenRegistry(t)
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.Docker.Registry = server.URL
+	auth := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	host := strings.TrimPrefix(server.URL, "http://")
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(fmt.Sprintf(`{"auths": {"%v": {"auth": "%v"}}}`, host, auth)), 0600)
+
+	tags, err := ListTags(ctx, "team/web", true)
+	if err != nil || tags != "1.1.0\n1.0.0" {
+		t.Logf("expected tags 1.1.0 and 1.0.0 but got %q and error %v", tags, err)
+		t.Fail()
+	}
+
+	// A credential helper's credentials are used instead.
+	helper := "#!/bin/sh\nread address\necho '{\"ServerURL\": \"'$address'\", \"Username\": \"user\", \"Secret\": \"secret\"}'\n"
+	ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(helper), 0755)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(fmt.Sprintf(`{"credHelpers": {"%v": "test"}}`, host)), 0600)
+	creds, ok, err := dockerConfigCredentials(ctx, server.URL)
+	if err != nil || !ok || creds.Username != "user" || creds.Password != "secret" {
+		t.Logf("expected the credential helper's credentials but got %+v, %v and error %v", creds, ok, err)
+		t.Fail()
+	}
+
+	// Without credentials, the token exchange fails.
+	os.Remove(filepath.Join(dir, "config.json"))
+	if _, err := ListTags(ctx, "team/web", true); err == nil {
+		t.Logf("expected listing tags without credentials to fail")
+		t.Fail()
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	c := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:web:pull,push"`)
+	if c.scheme != "bearer" || c.params["realm"] != "https://auth.example.com/token" ||
+		c.params["service"] != "registry.example.com" || c.params["scope"] != "repository:web:pull,push" {
+		t.Logf("unexpected challenge %+v", c)
+		t.Fail()
+	}
+	if c := parseChallenge(`Basic realm="Registry"`); c.scheme != "basic" {
+		t.Logf("expected a basic challenge but got %+v", c)
+		t.Fail()
+	}
+}
@@ -2,7 +2,12 @@ package docker
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"sort"
 	"strings"
 	"sync"
@@ -10,29 +15,357 @@ import (
 	"time"
 
 	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/keyring"
 	"github.com/appnexus/ankh/util"
 	"github.com/docker/docker/api/types"
 	"github.com/genuinetools/reg/registry"
+	"github.com/peterhellberg/link"
 )
 
-func newRegistry(ctx *ankh.ExecutionContext) (*registry.Registry, error) {
+// imageRegistry lists the images of a docker registry, and their tags.
+type imageRegistry interface {
+	Ping() error
+	Images() ([]string, error)
+	Tags(image string) ([]string, error)
+	// Digest is the digest that tag of image points to.
+	Digest(image string, tag string) (string, error)
+}
+
+func newRegistry(ctx *ankh.ExecutionContext) (imageRegistry, error) {
 	if ctx.AnkhConfig.Docker.Registry == "" {
 		return nil, fmt.Errorf("Missing DockerRegistryURL in AnkhConfig")
 	}
+	return newRegistryAt(ctx, ctx.AnkhConfig.Docker.Registry)
+}
+
+// newRegistryAt is a client for the docker registry at address, which it pings.
+func newRegistryAt(ctx *ankh.ExecutionContext, address string) (imageRegistry, error) {
+	var r imageRegistry
+	if ecr, ok := newECRRegistry(ctx, address); ok {
+		r = ecr
+	} else {
+		_, prefix := splitRegistryAddress(address)
+		client, err := newRegistryClient(ctx, registryCredentials(ctx, address))
+		if err != nil {
+			return nil, err
+		}
+		r = v2Registry{Registry: client, ctx: ctx, prefix: prefix}
+	}
+	err := ctx.Retry(fmt.Sprintf("connecting to docker registry '%v'", address), r.Ping)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// registryCredentials are the credentials for registry stored by `ankh login
+// docker`, or else by `docker login` in Docker's config, or else Google's for
+// GCR and Artifact Registry. Without any, requests are anonymous.
+func registryCredentials(ctx *ankh.ExecutionContext, registry string) types.AuthConfig {
+	auth := types.AuthConfig{ServerAddress: registry}
+	creds, err := keyring.Get(keyring.DockerRegistryKey(registry))
+	if err == nil {
+		auth.Username = creds.Username
+		auth.Password = creds.Password
+		return auth
+	} else if err != keyring.ErrNotFound {
+		ctx.Logger.Warnf("%v", err)
+	}
+
+	dockerAuth, ok, err := dockerConfigCredentials(ctx, registry)
+	if err != nil {
+		ctx.Logger.Warnf("Unable to read credentials for docker registry '%v' from Docker's config, so continuing without them: %v", registry, err)
+	} else if ok {
+		ctx.Logger.Debugf("Using credentials for docker registry '%v' from Docker's config", registry)
+		dockerAuth.ServerAddress = registry
+		return dockerAuth
+	}
+
+	googleAuth, ok, err := googleRegistryCredentials(ctx, registry)
+	if err != nil {
+		ctx.Logger.Warnf("Unable to get Google credentials for docker registry '%v', so continuing without them: %v", registry, err)
+	} else if ok {
+		return googleAuth
+	}
+	return auth
+}
+
+// dockerHubRegistry is where Docker Hub serves the registry API, whichever of
+// its addresses is used, eg: `docker.io`.
+const dockerHubRegistry = "registry-1.docker.io"
+
+// splitRegistryAddress splits a registry address into the URL of the registry
+// and the path that its images are under, eg: `us-docker.pkg.dev/team/images`
+// is the registry `https://us-docker.pkg.dev`, with images under `team/images`.
+func splitRegistryAddress(address string) (string, string) {
+	registryURL := strings.TrimSuffix(address, "/")
+	if !strings.HasPrefix(registryURL, "https://") && !strings.HasPrefix(registryURL, "http://") {
+		registryURL = "https://" + registryURL
+	}
+	host := strings.Index(registryURL, "://") + len("://")
+	prefix := ""
+	if i := strings.Index(registryURL[host:], "/"); i >= 0 {
+		registryURL, prefix = registryURL[:host+i], registryURL[host+i+1:]
+	}
+	if registryHost(registryURL) == "index.docker.io" {
+		registryURL = "https://" + dockerHubRegistry
+	}
+	// `https://index.docker.io/v1/` is Docker Hub's address in Docker's config, rather than a path.
+	if prefix == "v1" {
+		prefix = ""
+	}
+	return registryURL, prefix
+}
 
-	// TODO: This is an extermely not-generic assumption.
-	auth := types.AuthConfig{
-		ServerAddress: ctx.AnkhConfig.Docker.Registry,
+// newRegistryClient is a client for the registry of auth, which authenticates
+// with authTransport, and connects per the registry's TLS config.
+func newRegistryClient(ctx *ankh.ExecutionContext, auth types.AuthConfig) (*registry.Registry, error) {
+	url, _ := splitRegistryAddress(auth.ServerAddress)
+	transport, err := ctx.RegistryTransport(auth.ServerAddress)
+	if err != nil {
+		return nil, err
 	}
+	logf := registry.Quiet
+	if ctx.Verbose {
+		logf = registry.Log
+	}
+	return &registry.Registry{
+		URL:      url,
+		Domain:   strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://"),
+		Username: auth.Username,
+		Password: auth.Password,
+		Client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &registry.ErrorTransport{Transport: newAuthTransport(transport, auth)},
+		},
+		Logf: logf,
+	}, nil
+}
+
+// v2Registry lists images and tags with the docker registry v2 API.
+type v2Registry struct {
+	*registry.Registry
+	ctx *ankh.ExecutionContext
+	// prefix is the path in the registry that images are under, if any.
+	prefix string
+}
+
+// isDockerHub is true for Docker Hub, which doesn't list its repositories, and
+// has its official images under `library`.
+func (r v2Registry) isDockerHub() bool {
+	return r.Domain == dockerHubRegistry
+}
 
-	return registry.New(auth, registry.Opt{
-		Domain:   ctx.AnkhConfig.Docker.Registry,
-		Insecure: false,
-		Debug:    ctx.Verbose,
-		SkipPing: false,
-		NonSSL:   false,
-		Timeout:  time.Duration(10 * time.Second),
+// Images lists the images in the registry's catalog that are under prefix.
+func (r v2Registry) Images() ([]string, error) {
+	if r.isDockerHub() {
+		return nil, fmt.Errorf("Docker Hub doesn't list its images, so list the tags of one with `ankh image tags` instead")
+	}
+	images := []string{}
+	err := r.getPages("/v2/_catalog", "listing images", func(page []byte) error {
+		response := struct {
+			Repositories []string `json:"repositories"`
+		}{}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return fmt.Errorf("Unable to parse the catalog of registry '%v': %v", r.Domain, err)
+		}
+		for _, image := range response.Repositories {
+			if r.prefix == "" {
+				images = append(images, image)
+			} else if strings.HasPrefix(image, r.prefix+"/") {
+				images = append(images, strings.TrimPrefix(image, r.prefix+"/"))
+			}
+		}
+		return nil
 	})
+	return images, err
+}
+
+// repositoryName is the name of image in the registry, under prefix.
+func (r v2Registry) repositoryName(image string) string {
+	if r.prefix != "" {
+		return r.prefix + "/" + image
+	} else if r.isDockerHub() && !strings.Contains(image, "/") {
+		return "library/" + image
+	}
+	return image
+}
+
+// Tags lists the tags of image.
+func (r v2Registry) Tags(image string) ([]string, error) {
+	name := r.repositoryName(image)
+	tags := []string{}
+	err := r.getPages(fmt.Sprintf("/v2/%v/tags/list", name), fmt.Sprintf("listing tags of image '%v'", image), func(page []byte) error {
+		response := struct {
+			Tags []string `json:"tags"`
+		}{}
+		if err := json.Unmarshal(page, &response); err != nil {
+			return fmt.Errorf("Unable to parse the tags of image '%v': %v", image, err)
+		}
+		tags = append(tags, response.Tags...)
+		return nil
+	})
+	return tags, err
+}
+
+// manifestMediaTypes are the manifests that Digest accepts, most preferred
+// first, so that the digest of a multi-platform image is of its index, rather
+// than of one platform's manifest.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Digest asks for the manifest of tag with a HEAD request, which doesn't count
+// as a pull against Docker Hub's rate limit, and reads its digest from the
+// `Docker-Content-Digest` header. Registries that don't send that header have
+// the manifest fetched and hashed instead.
+func (r v2Registry) Digest(image string, tag string) (string, error) {
+	manifestURL := fmt.Sprintf("%v/v2/%v/manifests/%v", r.URL, r.repositoryName(image), tag)
+	var digest string
+	err := r.ctx.Retry(fmt.Sprintf("resolving the digest of image '%v:%v'", image, tag), func() error {
+		for _, method := range []string{"HEAD", "GET"} {
+			req, err := http.NewRequest(method, manifestURL, nil)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+			r.Logf("registry.manifest url=%s method=%s", manifestURL, method)
+			resp, err := r.Client.Do(req)
+			if err != nil {
+				return err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			switch {
+			case resp.StatusCode == http.StatusNotFound:
+				return fmt.Errorf("No tag '%v' of image '%v' in docker registry '%v'", tag, image, r.Domain)
+			case util.TransientHTTPStatus(resp.StatusCode):
+				return util.TransientAfter(fmt.Errorf("Getting the manifest of image '%v:%v' failed with status %v", image, tag, resp.Status),
+					util.RetryAfter(resp.Header, time.Now()))
+			case resp.StatusCode != http.StatusOK:
+				return fmt.Errorf("Getting the manifest of image '%v:%v' failed with status %v", image, tag, resp.Status)
+			}
+			if digest = resp.Header.Get("Docker-Content-Digest"); digest != "" {
+				return nil
+			}
+			if method == "GET" {
+				digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+			}
+		}
+		return nil
+	})
+	return digest, err
+}
+
+// getPages GETs path from the registry and passes it to f, then does the same
+// for each next page that a `Link` header points to, which is how registries
+// like Harbor, Quay, Docker Hub and ECR return long lists. Each page is retried
+// on its own per the retry policy, waiting as long as the registry asks to when
+// it limits the rate of requests.
+func (r v2Registry) getPages(path string, what string, f func(page []byte) error) error {
+	next, err := url.Parse(r.URL + path)
+	if err != nil {
+		return err
+	}
+	for page := 1; next != nil; page++ {
+		var body []byte
+		var header http.Header
+		err := r.ctx.Retry(fmt.Sprintf("%v (page %v)", what, page), func() error {
+			r.Logf("registry.get url=%s", next)
+			resp, err := r.Client.Get(next.String())
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			body, err = ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode != http.StatusOK {
+				err := fmt.Errorf("%v failed with status %v: %v", next.Path, resp.Status, strings.TrimSpace(string(body)))
+				if util.TransientHTTPStatus(resp.StatusCode) {
+					return util.TransientAfter(err, util.RetryAfter(resp.Header, time.Now()))
+				}
+				return err
+			}
+			header = resp.Header
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := f(body); err != nil {
+			return err
+		}
+
+		current := next
+		next = nil
+		if l, ok := link.ParseHeader(header)["next"]; ok {
+			if next, err = current.Parse(l.URI); err != nil {
+				return fmt.Errorf("Invalid link to the next page when %v: %v", what, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ImageDigest is the digest that tag of repository points to now, eg: to pin
+// it. repository is relative to `docker.registry`, unless it starts with the
+// host of another registry, eg: `quay.io/team/web`.
+func ImageDigest(ctx *ankh.ExecutionContext, repository string, tag string) (string, error) {
+	return imageDigestIn(ctx, ctx.AnkhConfig.Docker.Registry, repository, tag)
+}
+
+// VerifyImage checks that tag of repository exists in the docker registry
+// that the current context's cluster pulls from: the context's
+// `docker-registry`, or else `docker.registry`. Like ImageDigest, repository
+// may start with the host of another registry instead.
+func VerifyImage(ctx *ankh.ExecutionContext, repository string, tag string) error {
+	address := ctx.AnkhConfig.CurrentContext.DockerRegistry
+	if address == "" {
+		address = ctx.AnkhConfig.Docker.Registry
+	}
+	_, err := imageDigestIn(ctx, address, repository, tag)
+	return err
+}
+
+// imageDigestIn is the digest that tag of repository points to now, in the
+// registry at address unless repository starts with the host of another.
+func imageDigestIn(ctx *ankh.ExecutionContext, address string, repository string, tag string) (string, error) {
+	image := repository
+	configured := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://"), "/")
+	if configured != "" && strings.HasPrefix(repository, configured+"/") {
+		image = strings.TrimPrefix(repository, configured+"/")
+	} else if i := strings.Index(repository, "/"); i >= 0 && (strings.ContainsAny(repository[:i], ".:") || repository[:i] == "localhost") {
+		address, image = repository[:i], repository[i+1:]
+	} else if address == "" {
+		return "", fmt.Errorf("Missing DockerRegistryURL in AnkhConfig, to find image '%v' in", repository)
+	}
+
+	r, err := newRegistryAt(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	digest, err := r.Digest(image, tag)
+	if err != nil {
+		return "", err
+	}
+	if ref, err := util.ParseImageRef(digest); err != nil || ref.Digest != digest {
+		return "", fmt.Errorf("Docker registry '%v' returned an invalid digest '%v' for image '%v:%v'", address, digest, repository, tag)
+	}
+	return digest, nil
+}
+
+// Ping checks that the docker registry responds. Creating a registry client pings it.
+func Ping(ctx *ankh.ExecutionContext) error {
+	_, err := newRegistry(ctx)
+	return err
 }
 
 // TODO: Is descending actually descending here, or ascending?
@@ -50,7 +383,7 @@ func ListTags(ctx *ankh.ExecutionContext, image string, descending bool) (string
 	return strings.Join(tags, "\n"), nil
 }
 
-func listTags(ctx *ankh.ExecutionContext, r *registry.Registry,
+func listTags(ctx *ankh.ExecutionContext, r imageRegistry,
 	image string, limit int, descending bool) ([]string, error) {
 	tags, err := r.Tags(image)
 	if err != nil {
@@ -84,7 +417,7 @@ func ListImages(ctx *ankh.ExecutionContext, numToShow int) (string, error) {
 		return "", err
 	}
 
-	catalog, err := r.Catalog("")
+	catalog, err := r.Images()
 	if err != nil {
 		return "", err
 	}
@@ -104,11 +437,10 @@ func ListImages(ctx *ankh.ExecutionContext, numToShow int) (string, error) {
 
 	// Map image names to the list of tags that we fetch from the registry
 	var mtx sync.Mutex
-	var wg sync.WaitGroup
+	pool := util.NewPool(ctx.ConcurrencyLimit(ankh.RegistryConcurrency))
 	for i, image := range catalog {
-		wg.Add(1)
-		go func(image string, result *Result) {
-			defer wg.Done()
+		image, result := image, &results[i]
+		pool.Go(func() {
 			tags, err := listTags(ctx, r, image, numToShow, true)
 			if err != nil {
 				ctx.Logger.Warnf("Could not list tags for image %v: %v", image, err)
@@ -121,9 +453,9 @@ func ListImages(ctx *ankh.ExecutionContext, numToShow int) (string, error) {
 				Image: image,
 				Tags:  tags,
 			}
-		}(image, &results[i])
+		})
 	}
-	wg.Wait()
+	pool.Wait()
 
 	formatted := bytes.NewBufferString("")
 	w := tabwriter.NewWriter(formatted, 0, 8, 8, ' ', 0)
@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestListTagsFollowsLinks(t *testing.T) {
+	limited := false
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("last") {
+		case "":
+			// Relative, like Harbor and the reference registry.
+			w.Header().Set("Link", `</v2/web/tags/list?last=1.0.0&n=1>; rel="next"`)
+			fmt.Fprintf(w, `{"name": "web", "tags": ["1.0.0"]}`)
+		case "1.0.0":
+			// Rate limited once, like Docker Hub.
+			if !limited {
+				limited = true
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			// Absolute, like Quay.
+			w.Header().Set("Link", fmt.Sprintf(`<%v/v2/web/tags/list?last=1.1.0&n=1>; rel="next"`, server.URL))
+			fmt.Fprintf(w, `{"name": "web", "tags": ["1.1.0"]}`)
+		case "1.1.0":
+			fmt.Fprintf(w, `{"name": "web", "tags": ["1.2.0"]}`)
+		}
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.Retry.Backoff = "1ms"
+	ctx.AnkhConfig.Docker.Registry = server.URL
+	tags, err := ListTags(ctx, "web", false)
+	if err != nil || tags != "1.0.0\n1.1.0\n1.2.0" || !limited {
+		t.Logf("expected tags 1.0.0, 1.1.0 and 1.2.0 but got %q and error %v", tags, err)
+		t.Fail()
+	}
+}
+
+func TestSplitRegistryAddress(t *testing.T) {
+	cases := map[string][2]string{
+		"registry.example.com":           {"https://registry.example.com", ""},
+		"http://localhost:5000/":         {"http://localhost:5000", ""},
+		"us-docker.pkg.dev/team/images":  {"https://us-docker.pkg.dev", "team/images"},
+		"docker.io":                      {"https://registry-1.docker.io", ""},
+		"docker.io/team":                 {"https://registry-1.docker.io", "team"},
+		"https://index.docker.io/v1/":    {"https://registry-1.docker.io", ""},
+		"quay.io/team":                   {"https://quay.io", "team"},
+		"harbor.example.com:8443/team/a": {"https://harbor.example.com:8443", "team/a"},
+	}
+	for address, expected := range cases {
+		registryURL, prefix := splitRegistryAddress(address)
+		if registryURL != expected[0] || prefix != expected[1] {
+			t.Logf("expected %v to split into %v but got %v and %v", address, expected, registryURL, prefix)
+			t.Fail()
+		}
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	manifest := `{"schemaVersion": 2}`
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+		case "/v2/team/web/manifests/1.0.0":
+			// Without `Docker-Content-Digest`, so the manifest is hashed.
+			if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			fmt.Fprint(w, manifest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.Docker.Registry = server.URL + "/team"
+	expected := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+	for _, repository := range []string{"web", strings.TrimPrefix(server.URL, "http://") + "/team/web"} {
+		digest, err := ImageDigest(ctx, repository, "1.0.0")
+		if err != nil || digest != expected {
+			t.Logf("expected digest %v of %v but got %v and error %v", expected, repository, digest, err)
+			t.Fail()
+		}
+	}
+	if _, err := ImageDigest(ctx, "web", "2.0.0"); err == nil || !strings.Contains(err.Error(), "No tag '2.0.0'") {
+		t.Logf("expected an error for a missing tag but got %v", err)
+		t.Fail()
+	}
+}
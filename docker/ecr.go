@@ -0,0 +1,218 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/aws"
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// ecrRegistryRegexp matches the registries of ECR, eg:
+// `123456789012.dkr.ecr.us-west-2.amazonaws.com`, capturing the account that
+// owns it, its region, and its domain.
+var ecrRegistryRegexp = regexp.MustCompile(`^(?:https://)?([0-9]{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.(amazonaws\.com(?:\.cn)?)/?$`)
+
+// ecrEndpoint is the ECR API for region, in domain.
+var ecrEndpoint = func(region string, domain string) string {
+	return fmt.Sprintf("https://api.ecr.%v.%v/", region, domain)
+}
+
+// ecrPageSize is the most results that ECR returns per page.
+const ecrPageSize = 1000
+
+// ecrRegistry lists images and tags with the ECR API, which unlike the
+// registry API can list repositories, signed with AWS credentials.
+type ecrRegistry struct {
+	ctx        *ankh.ExecutionContext
+	registryID string
+	region     string
+	domain     string
+	creds      aws.Credentials
+	client     *http.Client
+}
+
+// newECRRegistry is an ecrRegistry for address, if it's an ECR registry and
+// there are AWS credentials to use with it.
+func newECRRegistry(ctx *ankh.ExecutionContext, address string) (*ecrRegistry, bool) {
+	m := ecrRegistryRegexp.FindStringSubmatch(address)
+	if m == nil {
+		return nil, false
+	}
+	creds := aws.LoadCredentials()
+	if creds == nil {
+		ctx.Logger.Debugf("No AWS credentials found for ECR registry '%v', so using it like any other docker registry", address)
+		return nil, false
+	}
+	return &ecrRegistry{
+		ctx:        ctx,
+		registryID: m[1],
+		region:     m[2],
+		domain:     m[3],
+		creds:      *creds,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, true
+}
+
+type ecrError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// call calls action on the ECR API with input, decoding its output.
+func (r *ecrRegistry) call(action string, input interface{}, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", ecrEndpoint(r.region, r.domain), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921."+action)
+	aws.SignRequest(req, body, r.creds, r.region, "ecr", time.Now())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := ecrError{}
+		json.Unmarshal(respBody, &e)
+		err := fmt.Errorf("ECR %v failed with status %v: %v %v", action, resp.Status, e.Type, e.Message)
+		if util.TransientHTTPStatus(resp.StatusCode) || strings.Contains(e.Type, "Throttling") {
+			return util.Transient(err)
+		}
+		return err
+	}
+	return json.Unmarshal(respBody, output)
+}
+
+type ecrAuthorizationData struct {
+	AuthorizationData []struct {
+		AuthorizationToken string `json:"authorizationToken"`
+	} `json:"authorizationData"`
+}
+
+// Ping checks the credentials by getting a token for the registry, like
+// `aws ecr get-login-password` does.
+func (r *ecrRegistry) Ping() error {
+	output := ecrAuthorizationData{}
+	if err := r.call("GetAuthorizationToken", map[string]interface{}{"registryIds": []string{r.registryID}}, &output); err != nil {
+		return err
+	}
+	if len(output.AuthorizationData) == 0 {
+		return fmt.Errorf("ECR returned no authorization token for registry %v", r.registryID)
+	}
+	if _, err := base64.StdEncoding.DecodeString(output.AuthorizationData[0].AuthorizationToken); err != nil {
+		return fmt.Errorf("ECR returned an invalid authorization token: %v", err)
+	}
+	return nil
+}
+
+type ecrRepositories struct {
+	Repositories []struct {
+		RepositoryName string `json:"repositoryName"`
+	} `json:"repositories"`
+	NextToken string `json:"nextToken"`
+}
+
+// Images lists every repository in the registry, a page at a time.
+func (r *ecrRegistry) Images() ([]string, error) {
+	images := []string{}
+	input := map[string]interface{}{"registryId": r.registryID, "maxResults": ecrPageSize}
+	for {
+		output := ecrRepositories{}
+		err := r.ctx.Retry("listing images", func() error {
+			return r.call("DescribeRepositories", input, &output)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, repository := range output.Repositories {
+			images = append(images, repository.RepositoryName)
+		}
+		if output.NextToken == "" {
+			return images, nil
+		}
+		input["nextToken"] = output.NextToken
+	}
+}
+
+type ecrImageIDs struct {
+	ImageIDs []struct {
+		ImageTag string `json:"imageTag"`
+	} `json:"imageIds"`
+	NextToken string `json:"nextToken"`
+}
+
+// Tags lists every tag of image, a page at a time.
+func (r *ecrRegistry) Tags(image string) ([]string, error) {
+	tags := []string{}
+	seen := make(map[string]bool)
+	input := map[string]interface{}{
+		"registryId":     r.registryID,
+		"repositoryName": image,
+		"filter":         map[string]string{"tagStatus": "TAGGED"},
+		"maxResults":     ecrPageSize,
+	}
+	for {
+		output := ecrImageIDs{}
+		err := r.ctx.Retry(fmt.Sprintf("listing tags of image '%v'", image), func() error {
+			return r.call("ListImages", input, &output)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range output.ImageIDs {
+			if id.ImageTag != "" && !seen[id.ImageTag] {
+				seen[id.ImageTag] = true
+				tags = append(tags, id.ImageTag)
+			}
+		}
+		if output.NextToken == "" {
+			return tags, nil
+		}
+		input["nextToken"] = output.NextToken
+	}
+}
+
+type ecrImageDetails struct {
+	ImageDetails []struct {
+		ImageDigest string `json:"imageDigest"`
+	} `json:"imageDetails"`
+}
+
+// Digest is the digest of the image that tag of image is.
+func (r *ecrRegistry) Digest(image string, tag string) (string, error) {
+	input := map[string]interface{}{
+		"registryId":     r.registryID,
+		"repositoryName": image,
+		"imageIds":       []map[string]string{{"imageTag": tag}},
+	}
+	output := ecrImageDetails{}
+	err := r.ctx.Retry(fmt.Sprintf("resolving the digest of image '%v:%v'", image, tag), func() error {
+		return r.call("DescribeImages", input, &output)
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(output.ImageDetails) == 0 {
+		return "", fmt.Errorf("No tag '%v' of image '%v' in ECR registry %v", tag, image, r.registryID)
+	}
+	return output.ImageDetails[0].ImageDigest, nil
+}
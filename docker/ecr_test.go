@@ -0,0 +1,81 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestListTagsInECR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-west-2/ecr/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `{"__type": "UnrecognizedClientException", "message": "The security token included in the request is invalid."}`)
+			return
+		}
+		input := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&input)
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken":
+			fmt.Fprintf(w, `{"authorizationData": [{"authorizationToken": "QVdTOnRva2Vu"}]}`)
+		case "AmazonEC2ContainerRegistry_V20150921.ListImages":
+			if input["registryId"] != "123456789012" || input["repositoryName"] != "team/web" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"__type": "RepositoryNotFoundException", "message": "no such repository"}`)
+			} else if input["nextToken"] == "page2" {
+				fmt.Fprintf(w, `{"imageIds": [{"imageTag": "1.10.0"}, {"imageTag": "1.2.0", "imageDigest": "sha256:b"}]}`)
+			} else {
+				fmt.Fprintf(w, `{"imageIds": [{"imageTag": "1.0.0"}, {"imageTag": "1.2.0", "imageDigest": "sha256:a"}], "nextToken": "page2"}`)
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	endpoint := ecrEndpoint
+	ecrEndpoint = func(region string, domain string) string { return server.URL }
+	defer func() { ecrEndpoint = endpoint }()
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.Docker.Registry = "123456789012.dkr.ecr.us-west-2.amazonaws.com"
+	tags, err := ListTags(ctx, "team/web", true)
+	if err != nil || tags != "1.10.0\n1.2.0\n1.0.0" {
+		t.Logf("expected the tags of both pages but got %q and error %v", tags, err)
+		t.Fail()
+	}
+
+	if _, err := ListTags(ctx, "team/api", true); err == nil || !strings.Contains(err.Error(), "RepositoryNotFoundException") {
+		t.Logf("expected ECR's error for a missing repository but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestECRRegistryRegexp(t *testing.T) {
+	for address, region := range map[string]string{
+		"123456789012.dkr.ecr.us-west-2.amazonaws.com":             "us-west-2",
+		"https://123456789012.dkr.ecr.eu-central-1.amazonaws.com/": "eu-central-1",
+		"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com":    "us-gov-west-1",
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn":         "cn-north-1",
+		"registry.example.com":                                     "",
+		"123456789012.dkr.ecr.us-west-2.amazonaws.com.example.com": "",
+	} {
+		m := ecrRegistryRegexp.FindStringSubmatch(address)
+		if (region == "" && m != nil) || (region != "" && (m == nil || m[2] != region)) {
+			t.Logf("expected %v to match region '%v' but got %v", address, region, m)
+			t.Fail()
+		}
+	}
+}
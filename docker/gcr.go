@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"regexp"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/google"
+	"github.com/docker/docker/api/types"
+)
+
+// googleRegistryRegexp matches the registries of Container Registry, eg:
+// `gcr.io` or `eu.gcr.io/project`, and of Artifact Registry, eg:
+// `us-docker.pkg.dev/project/images`.
+var googleRegistryRegexp = regexp.MustCompile(`^(?:https://)?(?:(?:[a-z]+\.)?gcr\.io|[a-z0-9-]+-docker\.pkg\.dev)(?:/.*)?$`)
+
+// googleTokenUsername is the username that Google's registries take an OAuth2
+// access token as the password of, like `docker-credential-gcloud` returns.
+const googleTokenUsername = "oauth2accesstoken"
+
+// googleRegistryCredentials are credentials for registry made with a Google
+// access token, found the way `gcloud` and Google's SDKs find them, if it's a
+// GCR or Artifact Registry registry.
+func googleRegistryCredentials(ctx *ankh.ExecutionContext, registry string) (types.AuthConfig, bool, error) {
+	if !googleRegistryRegexp.MatchString(registry) {
+		return types.AuthConfig{}, false, nil
+	}
+	token, err := google.AccessToken(ctx, google.CloudPlatformScope)
+	if err != nil || token == "" {
+		return types.AuthConfig{}, false, err
+	}
+	ctx.Logger.Debugf("Using Google credentials for docker registry '%v'", registry)
+	return types.AuthConfig{ServerAddress: registry, Username: googleTokenUsername, Password: token}, true, nil
+}
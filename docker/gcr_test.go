@@ -0,0 +1,64 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestGoogleRegistryCredentials(t *testing.T) {
+	os.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "ya29.token")
+	defer os.Unsetenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+
+	for _, registry := range []string{"gcr.io", "eu.gcr.io/team", "us-docker.pkg.dev/team/images", "https://europe-west1-docker.pkg.dev"} {
+		auth, ok, err := googleRegistryCredentials(ctx, registry)
+		if err != nil || !ok || auth.Username != googleTokenUsername || auth.Password != "ya29.token" {
+			t.Logf("expected Google credentials for %v but got %+v, %v and error %v", registry, auth, ok, err)
+			t.Fail()
+		}
+	}
+	for _, registry := range []string{"registry.example.com", "gcr.io.example.com", "docker.pkg.dev"} {
+		if _, ok, _ := googleRegistryCredentials(ctx, registry); ok {
+			t.Logf("expected no Google credentials for %v", registry)
+			t.Fail()
+		}
+	}
+}
+
+func TestListImagesUnderRegistryPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+		case "/v2/_catalog":
+			fmt.Fprintf(w, `{"repositories": ["team/images/web", "team/images/api", "other/images/web"]}`)
+		case "/v2/team/images/web/tags/list":
+			fmt.Fprintf(w, `{"name": "team/images/web", "tags": ["1.0.0"]}`)
+		case "/v2/team/images/api/tags/list":
+			fmt.Fprintf(w, `{"name": "team/images/api", "tags": ["2.0.0"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.Docker.Registry = server.URL + "/team/images"
+	output, err := ListImages(ctx, 1)
+	expected := "NAME        TAG(S)\napi         2.0.0\nweb         1.0.0\n"
+	if err != nil || output != expected {
+		t.Logf("expected %q but got %q and error %v", expected, output, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,247 @@
+// Package google finds Google access tokens the way Google's SDKs do, for GCS
+// helm registries and Google's docker registries, without the weight of the
+// Google Cloud SDK.
+package google
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// ReadOnlyStorageScope lets a token read from GCS buckets.
+const ReadOnlyStorageScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// CloudPlatformScope lets a token use any Google Cloud API the account may,
+// eg: GCR and Artifact Registry.
+const CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+var tokenURL = "https://oauth2.googleapis.com/token"
+
+// credentials is an application default credentials file, made by
+// `gcloud auth application-default login` or for a service account.
+type credentials struct {
+	Type         string `json:"type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type token struct {
+	value  string
+	expiry time.Time
+}
+
+// tokens are the access tokens found by AccessToken, by scope.
+var tokens = make(map[string]token)
+var tokensMtx sync.Mutex
+
+func credentialsPath() string {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return path
+	}
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		return filepath.Join(appData, "gcloud", "application_default_credentials.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "gcloud", "application_default_credentials.json")
+}
+
+// serviceAccountAssertion is a JWT signed by a service account's key, which
+// Google exchanges for an access token for scope.
+func serviceAccountAssertion(creds credentials, scope string, tokenURL string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("Unable to parse the private key of service account '%v'", creds.ClientEmail)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse the private key of service account '%v': %v", creds.ClientEmail, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("The private key of service account '%v' is not an RSA key", creds.ClientEmail)
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": scope,
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// exchangeCredentials trades application default credentials for an access
+// token for scope, and how long it's good for.
+func exchangeCredentials(creds credentials, scope string) (string, time.Duration, error) {
+	exchangeURL := creds.TokenURI
+	if exchangeURL == "" {
+		exchangeURL = tokenURL
+	}
+
+	form := url.Values{}
+	switch creds.Type {
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	case "service_account":
+		assertion, err := serviceAccountAssertion(creds, scope, exchangeURL, time.Now())
+		if err != nil {
+			return "", 0, err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	default:
+		return "", 0, fmt.Errorf("Unsupported Google credentials type '%v'", creds.Type)
+	}
+
+	client := &http.Client{Timeout: time.Duration(5 * time.Second)}
+	resp, err := client.PostForm(exchangeURL, form)
+	if err != nil {
+		return "", 0, fmt.Errorf("got an error %v when trying to call %v", err, exchangeURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", 0, fmt.Errorf("Received HTTP status '%v' (code %v) when trying to call %s", resp.Status, resp.StatusCode, exchangeURL)
+	}
+
+	token := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", 0, fmt.Errorf("Unable to parse the response from %v: %v", exchangeURL, err)
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// metadataHost is the GCE metadata server, which GKE's workload identity
+// serves too.
+func metadataHost() string {
+	if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+		return host
+	}
+	return "metadata.google.internal"
+}
+
+// metadataToken is an access token for scope, for the service account of the
+// GCE instance or GKE pod, and how long it's good for.
+func metadataToken(scope string) (string, time.Duration, error) {
+	query := url.Values{}
+	query.Set("scopes", scope)
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%v/computeMetadata/v1/instance/service-accounts/default/token?%v", metadataHost(), query.Encode()), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	// Give up quickly when not running in Google Cloud, where there's no metadata server.
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", 0, fmt.Errorf("the metadata server returned %v", resp.Status)
+	}
+	token := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", 0, fmt.Errorf("Unable to parse the token from the metadata server: %v", err)
+	}
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// AccessToken finds an access token for scope the way Google's SDKs do: from
+// GOOGLE_OAUTH_ACCESS_TOKEN, then application default credentials, then
+// `gcloud auth print-access-token`, and then the metadata server of the GCE
+// instance or GKE pod. It returns "" when there aren't any credentials.
+func AccessToken(ctx *ankh.ExecutionContext, scope string) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	tokensMtx.Lock()
+	defer tokensMtx.Unlock()
+	if t, ok := tokens[scope]; ok && time.Now().Before(t.expiry) {
+		return t.value, nil
+	}
+
+	path := credentialsPath()
+	if body, err := ioutil.ReadFile(path); err == nil {
+		creds := credentials{}
+		if err := json.Unmarshal(body, &creds); err != nil {
+			return "", fmt.Errorf("Unable to parse Google credentials '%v': %v", path, err)
+		}
+		value, expiresIn, err := exchangeCredentials(creds, scope)
+		if err != nil {
+			return "", fmt.Errorf("Unable to get an access token with Google credentials '%v': %v", path, err)
+		}
+		ctx.Logger.Debugf("Using Google credentials from %v", path)
+		// Refresh a minute early, so that tokens don't expire mid-request.
+		tokens[scope] = token{value: value, expiry: time.Now().Add(expiresIn - time.Minute)}
+		return value, nil
+	}
+
+	if _, err := exec.LookPath("gcloud"); err == nil {
+		var stdout bytes.Buffer
+		gcloudCmd := ctx.Command(ankh.RunPhase, "gcloud", "auth", "print-access-token")
+		gcloudCmd.Stdout = &stdout
+		record := ctx.StartCommand(gcloudCmd)
+		err := gcloudCmd.Run()
+		record.Finish(err)
+		if err == nil {
+			ctx.Logger.Debugf("Using Google credentials from `gcloud auth print-access-token`")
+			value := strings.TrimSpace(stdout.String())
+			tokens[scope] = token{value: value, expiry: time.Now().Add(30 * time.Minute)}
+			return value, nil
+		}
+		ctx.Logger.Debugf("`gcloud auth print-access-token` failed: %v", err)
+	}
+
+	value, expiresIn, err := metadataToken(scope)
+	if err != nil {
+		ctx.Logger.Debugf("No Google credentials from the metadata server: %v", err)
+		// Remember that there aren't any, so that runs outside of Google Cloud only wait on the metadata server once.
+		tokens[scope] = token{expiry: time.Now().Add(time.Hour)}
+		return "", nil
+	}
+	ctx.Logger.Debugf("Using Google credentials from the metadata server")
+	tokens[scope] = token{value: value, expiry: time.Now().Add(expiresIn - time.Minute)}
+	return value, nil
+}
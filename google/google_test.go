@@ -0,0 +1,58 @@
+package google
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestAccessTokenFromMetadataServer(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "ya29.%v", "expires_in": 3600}`, strings.TrimPrefix(r.URL.Query().Get("scopes"), "https://www.googleapis.com/auth/"))
+	}))
+	defer server.Close()
+
+	// Without application default credentials or gcloud.
+	dir, _ := ioutil.TempDir("", "ankh-google")
+	defer os.RemoveAll(dir)
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir)
+	os.Unsetenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(dir, "missing.json"))
+	defer os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+	os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	defer os.Unsetenv("GCE_METADATA_HOST")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	for _, expected := range []string{"ya29.cloud-platform", "ya29.devstorage.read_only", "ya29.cloud-platform"} {
+		scope := CloudPlatformScope
+		if strings.HasSuffix(expected, "read_only") {
+			scope = ReadOnlyStorageScope
+		}
+		token, err := AccessToken(ctx, scope)
+		if err != nil || token != expected {
+			t.Logf("expected token %v but got %v and error %v", expected, token, err)
+			t.Fail()
+		}
+	}
+	if requests != 2 {
+		t.Logf("expected a token per scope to be fetched once, but the metadata server got %v requests", requests)
+		t.Fail()
+	}
+}
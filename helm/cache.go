@@ -0,0 +1,149 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// The chart cache keeps each chart archive fetched from a registry under
+// ctx.ChartCacheDir, named for the sha256 of its content, with a ref named for
+// the sha256 of its URL pointing at it. Chart versions are immutable, so a
+// cached archive is used for as long as it's there.
+
+func chartCacheRefPath(ctx *ankh.ExecutionContext, tarballURL string) string {
+	return filepath.Join(ctx.ChartCacheDir, "refs", fmt.Sprintf("%x", sha256.Sum256([]byte(tarballURL))))
+}
+
+func chartCacheBlobPath(ctx *ankh.ExecutionContext, digest string) string {
+	return filepath.Join(ctx.ChartCacheDir, "sha256", digest+".tgz")
+}
+
+// cachedChart returns the archive cached for tarballURL, if there's one whose
+// content still matches its digest.
+func cachedChart(ctx *ankh.ExecutionContext, tarballURL string) ([]byte, bool) {
+	if ctx.ChartCacheDir == "" {
+		return nil, false
+	}
+	ref, err := ioutil.ReadFile(chartCacheRefPath(ctx, tarballURL))
+	if err != nil {
+		return nil, false
+	}
+	digest := strings.TrimSpace(string(ref))
+	blobPath := chartCacheBlobPath(ctx, digest)
+	body, err := ioutil.ReadFile(blobPath)
+	if err != nil {
+		return nil, false
+	}
+	if fmt.Sprintf("%x", sha256.Sum256(body)) != digest {
+		ctx.Logger.Warnf("Ignoring cached chart %v, whose content doesn't match its digest", blobPath)
+		return nil, false
+	}
+
+	// Mark it as used, for `chart cache clean --older-than`.
+	now := time.Now()
+	os.Chtimes(blobPath, now, now)
+	return body, true
+}
+
+// cacheChart caches body as the archive for tarballURL. Failing to cache is
+// only worth a warning, since the chart was fetched.
+func cacheChart(ctx *ankh.ExecutionContext, tarballURL string, body []byte) {
+	if ctx.ChartCacheDir == "" {
+		return
+	}
+	digest := fmt.Sprintf("%x", sha256.Sum256(body))
+	if err := writeFileAtomically(chartCacheBlobPath(ctx, digest), body); err != nil {
+		ctx.Logger.Warnf("Unable to cache chart %v: %v", tarballURL, err)
+		return
+	}
+	if err := writeFileAtomically(chartCacheRefPath(ctx, tarballURL), []byte(digest+"\n")); err != nil {
+		ctx.Logger.Warnf("Unable to cache chart %v: %v", tarballURL, err)
+	}
+}
+
+// removeCachedChart removes the archive cached for tarballURL from the chart cache.
+func removeCachedChart(ctx *ankh.ExecutionContext, tarballURL string) {
+	if ctx.ChartCacheDir == "" {
+		return
+	}
+	refPath := chartCacheRefPath(ctx, tarballURL)
+	if ref, err := ioutil.ReadFile(refPath); err == nil {
+		os.Remove(chartCacheBlobPath(ctx, strings.TrimSpace(string(ref))))
+	}
+	if err := os.Remove(refPath); err != nil && !os.IsNotExist(err) {
+		ctx.Logger.Warnf("Unable to remove cached chart %v: %v", tarballURL, err)
+	}
+}
+
+// writeFileAtomically writes data to a temporary file that's renamed to path,
+// so that concurrent runs never read a partly written file.
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// CleanChartCache removes the cached chart archives that haven't been used for
+// olderThan, or all of them if it's 0, along with the refs to them. It returns
+// how many archives were removed, and their size in bytes.
+func CleanChartCache(ctx *ankh.ExecutionContext, olderThan time.Duration) (int, int64, error) {
+	blobs, err := ioutil.ReadDir(filepath.Join(ctx.ChartCacheDir, "sha256"))
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	removed := 0
+	var size int64
+	for _, blob := range blobs {
+		if olderThan > 0 && time.Since(blob.ModTime()) < olderThan {
+			continue
+		}
+		if err := os.Remove(filepath.Join(ctx.ChartCacheDir, "sha256", blob.Name())); err != nil {
+			return removed, size, err
+		}
+		removed++
+		size += blob.Size()
+	}
+
+	// Remove the refs left pointing at nothing.
+	refsDir := filepath.Join(ctx.ChartCacheDir, "refs")
+	refs, err := ioutil.ReadDir(refsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return removed, size, err
+	}
+	for _, ref := range refs {
+		refPath := filepath.Join(refsDir, ref.Name())
+		digest, err := ioutil.ReadFile(refPath)
+		if err == nil {
+			if _, err = os.Stat(chartCacheBlobPath(ctx, strings.TrimSpace(string(digest)))); err == nil {
+				continue
+			}
+		}
+		if err := os.Remove(refPath); err != nil {
+			return removed, size, err
+		}
+	}
+	return removed, size, nil
+}
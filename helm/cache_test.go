@@ -0,0 +1,75 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func chartArchive() []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte("name: web\nversion: 1.0.0\n")
+	tw.WriteHeader(&tar.Header{Name: "web/Chart.yaml", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestChartCache(t *testing.T) {
+	archive := chartArchive()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), ChartCacheDir: filepath.Join(dir, "cache")}
+
+	for i, expectCached := range []bool{false, true} {
+		chartDir := filepath.Join(dir, fmt.Sprintf("chart-%v", i))
+		cached, err := fetchChart(ctx, server.URL, "web-1.0.0.tgz", chartDir)
+		if err != nil || cached != expectCached {
+			t.Logf("expected fetch %v to be cached=%v but got cached=%v and error %v", i+1, expectCached, cached, err)
+			t.Fail()
+		}
+		if _, err := os.Stat(filepath.Join(chartDir, "web", "Chart.yaml")); err != nil {
+			t.Logf("expected the chart to be extracted but got %v", err)
+			t.Fail()
+		}
+	}
+	if requests != 1 {
+		t.Logf("expected 1 request to the registry but got %v", requests)
+		t.Fail()
+	}
+
+	removed, size, err := CleanChartCache(ctx, 0)
+	if err != nil || removed != 1 || size != int64(len(archive)) {
+		t.Logf("expected to remove 1 archive of %v bytes but removed %v of %v bytes, with error %v", len(archive), removed, size, err)
+		t.Fail()
+	}
+	if _, ok := cachedChart(ctx, server.URL+"/web-1.0.0.tgz"); ok {
+		t.Logf("expected the cache to be empty after cleaning it")
+		t.Fail()
+	}
+	if refs, _ := ioutil.ReadDir(filepath.Join(ctx.ChartCacheDir, "refs")); len(refs) != 0 {
+		t.Logf("expected the refs to be removed too but got %v", len(refs))
+		t.Fail()
+	}
+}
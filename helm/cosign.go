@@ -0,0 +1,62 @@
+package helm
+
+import (
+	"fmt"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/cosign"
+)
+
+// VerificationError is the error of a chart whose signature can't be
+// verified. Unlike a registry that can't be reached, it's fatal, rather than
+// falling back to the next registry, so that a chart that isn't signed, or
+// was tampered with, can't be replaced by one from another registry.
+type VerificationError struct {
+	Chart    string
+	Registry string
+	Err      error
+}
+
+func (e *VerificationError) Error() string {
+	return e.Err.Error()
+}
+
+// verifyChart verifies the cosign signature of the chart archive
+// tarballFileName from registry, when the current context has `cosign`
+// enabled and it's about to be applied. The signature is read from
+// `<archive>.sig` next to the archive, and for keyless signatures, the
+// certificate from `<archive>.pem`, as `cosign sign-blob` writes them with
+// `--output-signature` and `--output-certificate`.
+func verifyChart(ctx *ankh.ExecutionContext, registry string, tarballFileName string, body []byte) error {
+	if !cosign.Applies(ctx) {
+		return nil
+	}
+
+	var signature, certificate []byte
+	err := ctx.Retry(fmt.Sprintf("fetching the signature of %v", tarballFileName), func() error {
+		var err error
+		signature, err = fetchRegistryFile(ctx, registry, tarballFileName+".sig")
+		return err
+	})
+	if err != nil {
+		return &VerificationError{tarballFileName, registry,
+			fmt.Errorf("Unable to verify chart '%v' of helm registry '%v', since its signature can't be fetched: %v", tarballFileName, registry, err)}
+	}
+	if ctx.AnkhConfig.CurrentContext.Cosign.Key == "" {
+		err := ctx.Retry(fmt.Sprintf("fetching the certificate of %v", tarballFileName), func() error {
+			var err error
+			certificate, err = fetchRegistryFile(ctx, registry, tarballFileName+".pem")
+			return err
+		})
+		if err != nil {
+			return &VerificationError{tarballFileName, registry,
+				fmt.Errorf("Unable to verify chart '%v' of helm registry '%v', since its certificate can't be fetched: %v", tarballFileName, registry, err)}
+		}
+	}
+
+	if err := cosign.VerifyBlob(ctx, fmt.Sprintf("chart '%v' of helm registry '%v'", tarballFileName, registry), body, signature, certificate); err != nil {
+		return &VerificationError{tarballFileName, registry, err}
+	}
+	ctx.Logger.Infof("Verified the signature of chart '%v'", tarballFileName)
+	return nil
+}
@@ -0,0 +1,112 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// apiDeprecation is a Kubernetes apiVersion and kind that was deprecated in
+// one minor version of Kubernetes 1.x, and removed in a later one.
+type apiDeprecation struct {
+	APIVersion   string
+	Kinds        []string
+	DeprecatedIn int
+	RemovedIn    int
+	Replacement  string
+}
+
+// See https://kubernetes.io/docs/reference/using-api/deprecation-guide/
+var apiDeprecations = []apiDeprecation{
+	{"extensions/v1beta1", []string{"Deployment", "DaemonSet", "ReplicaSet"}, 9, 16, "apps/v1"},
+	{"apps/v1beta1", []string{"Deployment", "StatefulSet", "ReplicaSet"}, 9, 16, "apps/v1"},
+	{"apps/v1beta2", []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"}, 9, 16, "apps/v1"},
+	{"extensions/v1beta1", []string{"NetworkPolicy"}, 9, 16, "networking.k8s.io/v1"},
+	{"extensions/v1beta1", []string{"PodSecurityPolicy"}, 10, 16, "policy/v1beta1"},
+	{"extensions/v1beta1", []string{"Ingress"}, 14, 22, "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", []string{"Ingress", "IngressClass"}, 19, 22, "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", []string{"Role", "RoleBinding", "ClusterRole", "ClusterRoleBinding"}, 17, 22, "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1alpha1", []string{"Role", "RoleBinding", "ClusterRole", "ClusterRoleBinding"}, 17, 22, "rbac.authorization.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", []string{"CustomResourceDefinition"}, 16, 22, "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", []string{"APIService"}, 19, 22, "apiregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", []string{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"}, 16, 22, "admissionregistration.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", []string{"PriorityClass"}, 14, 22, "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"}, 19, 22, "storage.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", []string{"Lease"}, 19, 22, "coordination.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", []string{"CertificateSigningRequest"}, 19, 22, "certificates.k8s.io/v1"},
+	{"batch/v1beta1", []string{"CronJob"}, 21, 25, "batch/v1"},
+	{"policy/v1beta1", []string{"PodDisruptionBudget"}, 21, 25, "policy/v1"},
+	{"policy/v1beta1", []string{"PodSecurityPolicy"}, 21, 25, ""},
+	{"discovery.k8s.io/v1beta1", []string{"EndpointSlice"}, 21, 25, "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", []string{"Event"}, 21, 25, "events.k8s.io/v1"},
+	{"node.k8s.io/v1beta1", []string{"RuntimeClass"}, 20, 25, "node.k8s.io/v1"},
+	{"autoscaling/v2beta1", []string{"HorizontalPodAutoscaler"}, 22, 25, "autoscaling/v2"},
+	{"autoscaling/v2beta2", []string{"HorizontalPodAutoscaler"}, 23, 26, "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", []string{"FlowSchema", "PriorityLevelConfiguration"}, 23, 26, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", []string{"FlowSchema", "PriorityLevelConfiguration"}, 26, 29, "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", []string{"FlowSchema", "PriorityLevelConfiguration"}, 29, 32, "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIStorageCapacity"}, 24, 27, "storage.k8s.io/v1"},
+}
+
+func findDeprecation(apiVersion string, kind string) *apiDeprecation {
+	for i, d := range apiDeprecations {
+		if d.APIVersion != apiVersion {
+			continue
+		}
+		for _, k := range d.Kinds {
+			if strings.EqualFold(k, kind) {
+				return &apiDeprecations[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (d *apiDeprecation) advice() string {
+	if d.Replacement == "" {
+		return "and has no replacement"
+	}
+	return fmt.Sprintf("use `apiVersion: %v` instead", d.Replacement)
+}
+
+// DeprecatedAPIs checks the apiVersion of each object in helmOutput against
+// Kubernetes 1.minor, returning errors for apiVersions that version no longer
+// serves, and warnings for those it has deprecated. When minor is negative
+// because the cluster's version is unknown, every known deprecation or
+// removal is a warning. Output that can't be parsed is an error too.
+func DeprecatedAPIs(helmOutput string, minor int) ([]error, []error) {
+	removed, deprecated := []error{}, []error{}
+	docs := util.NewYAMLDocuments(helmOutput)
+	for {
+		obj := KubeObject{}
+		if !docs.Next(&obj) {
+			break
+		}
+		if obj.Kind == "" {
+			continue
+		}
+
+		d := findDeprecation(obj.APIVersion, obj.Kind)
+		if d == nil {
+			continue
+		}
+		object := fmt.Sprintf("%v '%v' uses `apiVersion: %v`", obj.Kind, obj.Metadata.Name, obj.APIVersion)
+		switch {
+		case minor < 0:
+			deprecated = append(deprecated, fmt.Errorf("%v, which is deprecated since Kubernetes 1.%v and removed in 1.%v, %v",
+				object, d.DeprecatedIn, d.RemovedIn, d.advice()))
+		case minor >= d.RemovedIn:
+			removed = append(removed, ankh.NewObjectError("removed-api", obj.Kind, obj.Metadata.Name, "%v, which was removed in Kubernetes 1.%v and will fail to apply to this 1.%v cluster, %v",
+				object, d.RemovedIn, minor, d.advice()))
+		case minor >= d.DeprecatedIn:
+			deprecated = append(deprecated, fmt.Errorf("%v, which is deprecated since Kubernetes 1.%v and will be removed in 1.%v, %v",
+				object, d.DeprecatedIn, d.RemovedIn, d.advice()))
+		}
+	}
+	if err := docs.Err(); err != nil {
+		removed = append(removed, fmt.Errorf("Unable to parse templated output to check its apiVersions: %v", err))
+	}
+	return removed, deprecated
+}
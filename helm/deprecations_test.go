@@ -0,0 +1,65 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+)
+
+const deprecationsTestOutput = `
+# Source: web/templates/deployment.yaml
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+---
+# Source: web/templates/cronjob.yaml
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+func TestDeprecatedAPIs(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		minor      int
+		removed    []string
+		deprecated []string
+	}{
+		{"old cluster", 15, []string{}, []string{"Deployment 'web'"}},
+		{"removed deployment", 22, []string{"Deployment 'web'"}, []string{"CronJob 'cleanup'"}},
+		{"removed everything", 25, []string{"Deployment 'web'", "CronJob 'cleanup'"}, []string{}},
+		{"unknown cluster", -1, []string{}, []string{"Deployment 'web'", "CronJob 'cleanup'"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			removed, deprecated := DeprecatedAPIs(deprecationsTestOutput, test.minor)
+			check := func(what string, errs []error, expected []string) {
+				if len(errs) != len(expected) {
+					t.Logf("expected %v %v objects but found %v", len(expected), what, errs)
+					t.Fail()
+					return
+				}
+				for i, err := range errs {
+					if !strings.HasPrefix(err.Error(), expected[i]) {
+						t.Logf("expected %v object '%v' but found '%v'", what, expected[i], err)
+						t.Fail()
+					}
+				}
+			}
+			check("removed", removed, test.removed)
+			check("deprecated", deprecated, test.deprecated)
+		})
+	}
+
+	removed, _ := DeprecatedAPIs(deprecationsTestOutput+"---\nkind: [\n", 22)
+	if len(removed) != 2 || !strings.HasPrefix(removed[1].Error(), "Unable to parse templated output") {
+		t.Logf("expected the objects before unparseable output to be checked, and an error for it, but found %v", removed)
+		t.Fail()
+	}
+}
@@ -0,0 +1,189 @@
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/util"
+)
+
+// templateError is a helm template failure that we could trace back to a file and line.
+type templateError struct {
+	File       string // relative to the chart's parent dir for templates, or absolute for values files
+	Line       int
+	Column     int
+	ValuesPath string // eg: `image.tag`, when the failure was evaluating `.Values.image.tag`
+	Message    string
+	Rendered   bool // Line is in the rendered output of File, rather than File itself
+}
+
+var (
+	renderErrorRegexp     = regexp.MustCompile(`template: ([^:\s]+):(\d+):(\d+): executing "[^"]*" at <([^>]*)>: (.*)`)
+	parseErrorRegexp      = regexp.MustCompile(`template: ([^:\s]+):(\d+):(?:(\d+):)? (.*)`)
+	yamlErrorRegexp       = regexp.MustCompile(`YAML parse error on ([^:\s]+): error converting YAML to JSON: yaml: line (\d+): (.*)`)
+	valuesErrorRegexp     = regexp.MustCompile(`failed to parse ([^:\s]+): error converting YAML to JSON: yaml: line (\d+): (.*)`)
+	valuesReferenceRegexp = regexp.MustCompile(`\.Values((?:\.[\w-]+)+)`)
+)
+
+// parseTemplateError extracts the failing file, line, and values reference from `helm template` stderr.
+func parseTemplateError(stderr string) *templateError {
+	if m := renderErrorRegexp.FindStringSubmatch(stderr); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		te := &templateError{File: m[1], Line: line, Column: column, Message: m[5]}
+		if ref := valuesReferenceRegexp.FindStringSubmatch(m[4]); ref != nil {
+			te.ValuesPath = strings.TrimPrefix(ref[1], ".")
+		}
+		return te
+	}
+	if m := parseErrorRegexp.FindStringSubmatch(stderr); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		return &templateError{File: m[1], Line: line, Column: column, Message: m[4]}
+	}
+	if m := yamlErrorRegexp.FindStringSubmatch(stderr); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return &templateError{File: m[1], Line: line, Message: m[3], Rendered: true}
+	}
+	if m := valuesErrorRegexp.FindStringSubmatch(stderr); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return &templateError{File: m[1], Line: line, Message: m[3]}
+	}
+	return nil
+}
+
+// sourceExcerpt returns the lines around line in body, marking line itself.
+func sourceExcerpt(body string, line int, context int) string {
+	lines := strings.Split(body, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	start, end := line-context, line+context
+	if start < 1 {
+		start = 1
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	out := ""
+	for i := start; i <= end; i++ {
+		marker := "  "
+		if i == line {
+			marker = "> "
+		}
+		out += fmt.Sprintf("    %v%4d | %v\n", marker, i, lines[i-1])
+	}
+	return out
+}
+
+// mergedValues merges the chart's values.yaml with the values files and
+// `--set` values passed to helm, in the same order that helm does.
+func mergedValues(valuesPath string, helmArgs []string) map[string]interface{} {
+	values := make(map[string]interface{})
+	mergeFile := func(path string) {
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return
+		}
+		fileValues := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(body, &fileValues); err != nil {
+			return
+		}
+		if m, ok := util.NormalizeYAMLMap(fileValues).(map[string]interface{}); ok {
+			values = util.MergeValues(values, m)
+		}
+	}
+
+	mergeFile(valuesPath)
+	for i := 0; i+1 < len(helmArgs); i++ {
+		switch helmArgs[i] {
+		case "-f":
+			mergeFile(helmArgs[i+1])
+			i++
+		case "--set":
+			tokens := strings.SplitN(helmArgs[i+1], "=", 2)
+			if len(tokens) == 2 {
+				util.SetValue(values, tokens[0], tokens[1])
+			}
+			i++
+		}
+	}
+	return values
+}
+
+// valuesSubtree finds the deepest part of path that is set in values, returning it and the subtree there.
+func valuesSubtree(values map[string]interface{}, path string) (string, interface{}) {
+	found := ""
+	var current interface{} = values
+	for _, token := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			break
+		}
+		next, ok := m[token]
+		if !ok {
+			break
+		}
+		if found != "" {
+			found += "."
+		}
+		found += token
+		current = next
+	}
+	return found, current
+}
+
+// describe explains a template error using the chart sources in chartParentDir and the merged values.
+func (te *templateError) describe(chartParentDir string, values map[string]interface{}) string {
+	location := fmt.Sprintf("%v:%v", te.File, te.Line)
+	if te.Column > 0 {
+		location += fmt.Sprintf(":%v", te.Column)
+	}
+	out := fmt.Sprintf("  %v: %v\n", location, te.Message)
+
+	if te.Rendered {
+		out += fmt.Sprintf("  (line %v is in the output of the template, not the template itself. Use `ankh template` with `--set` to inspect it)\n", te.Line)
+	} else {
+		path := te.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(chartParentDir, path)
+		}
+		if body, err := ioutil.ReadFile(path); err == nil {
+			out += sourceExcerpt(string(body), te.Line, 2)
+		}
+	}
+
+	if te.ValuesPath != "" {
+		found, subtree := valuesSubtree(values, te.ValuesPath)
+		if found == te.ValuesPath {
+			out += fmt.Sprintf("  `.Values.%v` is set to:\n", found)
+		} else if found == "" {
+			out += fmt.Sprintf("  `.Values.%v` is not set, and neither is any part of it. Top level values are:\n", te.ValuesPath)
+			keys := []string{}
+			for key, _ := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			subtree = keys
+		} else {
+			out += fmt.Sprintf("  `.Values.%v` is not set. The merged values at `.Values.%v` are:\n", te.ValuesPath, found)
+		}
+		body, err := yaml.Marshal(subtree)
+		if err == nil {
+			for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+				out += "    " + line + "\n"
+			}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,73 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplateError(t *testing.T) {
+	for stderr, expected := range map[string]templateError{
+		`Error: render error in "web/templates/deployment.yaml": template: web/templates/deployment.yaml:5:22: executing "web/templates/deployment.yaml" at <.Values.image.repository>: nil pointer evaluating interface {}.repository`: {
+			File: "web/templates/deployment.yaml", Line: 5, Column: 22, ValuesPath: "image.repository",
+			Message: "nil pointer evaluating interface {}.repository",
+		},
+		`Error: parse error in "web/templates/service.yaml": template: web/templates/service.yaml:3: function "quoted" not defined`: {
+			File: "web/templates/service.yaml", Line: 3, Message: `function "quoted" not defined`,
+		},
+		`Error: YAML parse error on web/templates/configmap.yaml: error converting YAML to JSON: yaml: line 3: mapping values are not allowed in this context`: {
+			File: "web/templates/configmap.yaml", Line: 3, Message: "mapping values are not allowed in this context", Rendered: true,
+		},
+		`Error: failed to parse /tmp/ankh/values.yaml: error converting YAML to JSON: yaml: line 2: did not find expected key`: {
+			File: "/tmp/ankh/values.yaml", Line: 2, Message: "did not find expected key",
+		},
+	} {
+		te := parseTemplateError(stderr)
+		if te == nil || *te != expected {
+			t.Logf("expected %+v but got %+v", expected, te)
+			t.Fail()
+		}
+	}
+
+	if te := parseTemplateError("Error: could not find tiller"); te != nil {
+		t.Logf("expected no template error but got %+v", te)
+		t.Fail()
+	}
+}
+
+func TestDescribeTemplateError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Logf("got error %v", err)
+		t.Fail()
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	chartDir := filepath.Join(dir, "web")
+	os.MkdirAll(filepath.Join(chartDir, "templates"), 0755)
+	ioutil.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte("image:\n  tag: latest\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "values.yaml"), []byte("image:\n  pullPolicy: Always\n"), 0644)
+	ioutil.WriteFile(filepath.Join(chartDir, "templates", "deployment.yaml"),
+		[]byte("kind: Deployment\nspec:\n  containers:\n  - name: web\n    image: {{ .Values.image.repository.name }}:{{ .Values.image.tag }}\n"), 0644)
+
+	values := mergedValues(filepath.Join(chartDir, "values.yaml"),
+		[]string{"helm", "template", "-f", filepath.Join(dir, "values.yaml"), "--set", "image.tag=v1", chartDir})
+	te := templateError{File: "web/templates/deployment.yaml", Line: 5, Column: 22, ValuesPath: "image.repository.name", Message: "nil pointer"}
+	out := te.describe(dir, values)
+
+	for _, expected := range []string{
+		"web/templates/deployment.yaml:5:22: nil pointer",
+		">    5 |     image: {{ .Values.image.repository.name }}",
+		"`.Values.image.repository.name` is not set. The merged values at `.Values.image` are:",
+		"pullPolicy: Always",
+		"tag: v1",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Logf("expected '%v' in description:\n%v", expected, out)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package helm
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/google"
+)
+
+// gcsURL is where to GET key from bucket, using the emulator at
+// STORAGE_EMULATOR_HOST when it's set.
+func gcsURL(bucket string, key string) *url.URL {
+	u := &url.URL{Scheme: "https", Host: "storage.googleapis.com", Path: "/" + bucket + "/" + key}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if strings.Contains(host, "://") {
+			if e, err := url.Parse(host); err == nil {
+				u.Scheme, u.Host = e.Scheme, e.Host
+			}
+		} else {
+			u.Scheme, u.Host = "http", host
+		}
+	}
+	return u
+}
+
+// newGCSRequest makes a GET request for the file name in a `gs://bucket/path`
+// registry, with a Google access token, if there is one.
+func newGCSRequest(ctx *ankh.ExecutionContext, registry string, name string) (*http.Request, error) {
+	bucket, key, err := splitBucketURL(registry, name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", gcsURL(bucket, key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := google.AccessToken(ctx, google.ReadOnlyStorageScope)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		ctx.Logger.Debugf("No Google credentials found, so fetching from helm registry '%v' anonymously", registry)
+		return req, nil
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
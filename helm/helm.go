@@ -2,21 +2,22 @@ package helm
 
 import (
 	"bytes"
-	"crypto/tls"
 	"fmt"
 	"gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
 	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/keyring"
 	"github.com/appnexus/ankh/util"
 )
 
@@ -36,6 +37,122 @@ func explain(args []string) string {
 	return explain + " && \\\n"
 }
 
+// Registries returns the ordered list of helm registries to fetch charts from.
+// A context's `helm-registries` pins its own list, otherwise we use the global
+// `helm.registry` (or the context's deprecated `helm-registry-url`) followed by
+// any global `helm.fallbackRegistries`.
+func Registries(ctx *ankh.ExecutionContext) []string {
+	if len(ctx.AnkhConfig.CurrentContext.HelmRegistries) > 0 {
+		return ctx.AnkhConfig.CurrentContext.HelmRegistries
+	}
+
+	// TODO: Eventually, only support the global helm registry
+	registries := []string{}
+	registry := ctx.AnkhConfig.Helm.Registry
+	if registry == "" {
+		registry = ctx.AnkhConfig.CurrentContext.HelmRegistryURL
+	}
+	if registry != "" {
+		registries = append(registries, registry)
+	}
+	return append(registries, ctx.AnkhConfig.Helm.FallbackRegistries...)
+}
+
+var registryCredentials = make(map[string]*keyring.Credentials)
+var registryCredentialsMtx sync.Mutex
+
+// setRegistryAuth adds basic auth to a request for a helm registry, if
+// credentials for it were stored using `ankh login registry`.
+func setRegistryAuth(ctx *ankh.ExecutionContext, req *http.Request, registry string) {
+	registryCredentialsMtx.Lock()
+	defer registryCredentialsMtx.Unlock()
+
+	creds, ok := registryCredentials[registry]
+	if !ok {
+		c, err := keyring.Get(keyring.HelmRegistryKey(registry))
+		if err != nil {
+			if err != keyring.ErrNotFound {
+				ctx.Logger.Warnf("%v", err)
+			}
+		} else {
+			creds = &c
+		}
+		registryCredentials[registry] = creds
+	}
+	if creds != nil {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+}
+
+// fetchRegistryFile gets the file name from registry.
+func fetchRegistryFile(ctx *ankh.ExecutionContext, registry string, name string) ([]byte, error) {
+	fileURL := fmt.Sprintf("%s/%s", strings.TrimRight(registry, "/"), name)
+	tr, err := ctx.RegistryTransport(registry)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: tr,
+		Timeout:   time.Duration(5 * time.Second),
+	}
+	req, err := newRegistryRequest(ctx, registry, name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("got an error %v when trying to call %v", err, fileURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		err := fmt.Errorf("failed to fetch %v: received HTTP status '%v' (code %v) when trying to call %s", name, resp.Status, resp.StatusCode, fileURL)
+		if util.TransientHTTPStatus(resp.StatusCode) {
+			return nil, util.Transient(err)
+		}
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, util.Transient(fmt.Errorf("failed to read %v from %s: %v", name, fileURL, err))
+	}
+	return body, nil
+}
+
+// fetchChart extracts the chart archive tarballFileName from registry into dir,
+// from the chart cache when it's there, and caching it otherwise.
+func fetchChart(ctx *ankh.ExecutionContext, registry string, tarballFileName string, dir string) (bool, error) {
+	tarballURL := fmt.Sprintf("%s/%s", strings.TrimRight(registry, "/"), tarballFileName)
+	if body, ok := cachedChart(ctx, tarballURL); ok {
+		if err := verifyChart(ctx, registry, tarballFileName, body); err != nil {
+			// Fetch it again next time, in case it was since signed, or the cache was tampered with.
+			removeCachedChart(ctx, tarballURL)
+			return true, err
+		}
+		ctx.Logger.Debugf("untarring cached chart %s to %s", tarballURL, dir)
+		return true, util.Untar(dir, bytes.NewReader(body))
+	}
+	var body []byte
+	err := ctx.Retry(fmt.Sprintf("fetching %v", tarballURL), func() error {
+		ctx.Logger.Debugf("downloading chart from %s", tarballURL)
+		var err error
+		body, err = fetchRegistryFile(ctx, registry, tarballFileName)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := verifyChart(ctx, registry, tarballFileName, body); err != nil {
+		return false, err
+	}
+	ctx.Logger.Debugf("untarring chart to %s", dir)
+	if err := util.Untar(dir, bytes.NewReader(body)); err != nil {
+		return false, err
+	}
+	cacheChart(ctx, tarballURL, body)
+	return false, nil
+}
+
 func findChartFilesImpl(ctx *ankh.ExecutionContext, chart ankh.Chart) (ankh.ChartFiles, error) {
 	name := chart.Name
 	version := chart.Version
@@ -56,6 +173,7 @@ func findChartFilesImpl(ctx *ankh.ExecutionContext, chart ankh.Chart) (ankh.Char
 	if err != nil {
 		return files, err
 	}
+	ankh.RemoveOnInterrupt(tmpDir)
 
 	// If we already have a dir, let's just copy it to a temp directory so we can
 	// make changes to the ankh specific yaml files before passing them as `-f`
@@ -65,12 +183,8 @@ func findChartFilesImpl(ctx *ankh.ExecutionContext, chart ankh.Chart) (ankh.Char
 			return files, err
 		}
 	} else {
-		// TODO: Eventually, only support the global helm registry
-		registry := ctx.AnkhConfig.Helm.Registry
-		if registry == "" {
-			registry = ctx.AnkhConfig.CurrentContext.HelmRegistryURL
-		}
-		if registry == "" {
+		registries := Registries(ctx)
+		if len(registries) == 0 {
 			return files, fmt.Errorf("No helm registry configured. Set `helm.registry` globally, or `See README.md on where to specify a helm registry.")
 		}
 
@@ -80,40 +194,30 @@ func findChartFilesImpl(ctx *ankh.ExecutionContext, chart ankh.Chart) (ankh.Char
 		}
 
 		tarballFileName := fmt.Sprintf("%s-%s.tgz", name, version)
-		tarballURL := fmt.Sprintf("%s/%s", strings.TrimRight(registry, "/"), tarballFileName)
-
 		ok := false
-		for attempt := 1; attempt <= 5; attempt++ {
-			ctx.Logger.Debugf("downloading chart from %s (attempt %v)", tarballURL, attempt)
-			tr := &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		for i, registry := range registries {
+			if i > 0 {
+				ctx.Logger.Warnf("Falling back to helm registry '%v' for chart '%v'", registry, tarballFileName)
 			}
-			client := &http.Client{
-				Transport: tr,
-				Timeout:   time.Duration(5 * time.Second),
+			cached, err := fetchChart(ctx, registry, tarballFileName, tmpDir)
+			if _, ok := err.(*VerificationError); ok {
+				return files, err
 			}
-			resp, err := client.Get(tarballURL)
 			if err != nil {
-				ctx.Logger.Warningf("got an error %v when trying to call %v (attempt %v)",
-					err, tarballURL, attempt)
+				ctx.Logger.Warnf("%v", err)
 				continue
 			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode == 200 {
-				ctx.Logger.Debugf("untarring chart to %s", tmpDir)
-				if err = util.Untar(tmpDir, resp.Body); err != nil {
-					return files, err
-				}
-
-				ok = true
-				break
+			if cached {
+				ctx.Logger.Infof("Using chart '%v' of helm registry '%v' from the chart cache", tarballFileName, registry)
 			} else {
-				ctx.Logger.Warningf("Received HTTP status '%v' (code %v) when trying to call %s (attempt %v)", resp.Status, resp.StatusCode, tarballURL, attempt)
+				ctx.Logger.Infof("Fetched chart '%v' from helm registry '%v'", tarballFileName, registry)
 			}
+			ok = true
+			break
 		}
 		if !ok {
-			return files, fmt.Errorf("failed to fetch helm chart from URL: %v", tarballURL)
+			return files, fmt.Errorf("failed to fetch helm chart '%v' from any of the registries [ %v ]",
+				tarballFileName, strings.Join(registries, ", "))
 		}
 	}
 
@@ -132,61 +236,35 @@ func findChartFilesImpl(ctx *ankh.ExecutionContext, chart ankh.Chart) (ankh.Char
 }
 
 var findChartFiles = findChartFilesImpl
-var execContext = exec.Command
-
-func templateChart(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace string) (string, error) {
-	currentContext := ctx.AnkhConfig.CurrentContext
-	helmArgs := []string{"helm", "template"}
-
-	if namespace != "" {
-		helmArgs = append(helmArgs, []string{"--namespace", namespace}...)
-	}
-
-	if currentContext.Release != "" {
-		helmArgs = append(helmArgs, []string{"--name", currentContext.Release}...)
-	}
 
-	for key, val := range ctx.HelmSetValues {
-		helmArgs = append(helmArgs, "--set", key+"="+val)
-	}
-
-	// default to the global TagValueName, but allow per-chart overrides
-	tagValueName := ctx.AnkhConfig.Helm.TagValueName
-	if chart.TagValueName != "" {
-		ctx.Logger.Debugf("Overriding tagValueName to chart.TagValuename=%v (was configured globally as %v)",
-			chart.TagValueName, ctx.AnkhConfig.Helm.TagValueName, chart.Tag)
-		tagValueName = chart.TagValueName
-	}
-
-	// Set tagValueName=Chart.Tag, if configured and present
-	if tagValueName != "" && chart.Tag != "" {
-		ctx.Logger.Debugf("Setting helm value %v=%v since tagValueName and chart.Tag are set",
-			tagValueName, chart.Tag)
-		helmArgs = append(helmArgs, "--set", tagValueName+"="+chart.Tag)
-	}
-
-	files, err := findChartFiles(ctx, chart)
+// valuesFile is a file of values passed to helm, named for its source.
+type valuesFile struct {
+	Name string
+	Path string
+}
 
-	if err != nil {
-		return "", err
-	}
+// prepareValuesFiles writes each source of values for chart to a file in the
+// chart's directory, returning them in order of increasing precedence.
+func prepareValuesFiles(ctx *ankh.ExecutionContext, chart ankh.Chart, files ankh.ChartFiles) ([]valuesFile, error) {
+	currentContext := ctx.AnkhConfig.CurrentContext
+	valuesFiles := []valuesFile{}
 
 	// Load `values` from chart
 	_, valuesErr := os.Stat(files.AnkhValuesPath)
 	if valuesErr == nil {
 		if _, err := util.CreateReducedYAMLFile(files.AnkhValuesPath, currentContext.EnvironmentClass, true); err != nil {
-			return "", fmt.Errorf("unable to process ankh-values.yaml file for chart '%s': %v", chart.Name, err)
+			return nil, fmt.Errorf("unable to process ankh-values.yaml file for chart '%s': %v", chart.Name, err)
 		}
-		helmArgs = append(helmArgs, "-f", files.AnkhValuesPath)
+		valuesFiles = append(valuesFiles, valuesFile{"ankh-values.yaml", files.AnkhValuesPath})
 	}
 
 	// Load `resource-profiles` from chart
 	_, resourceProfilesError := os.Stat(files.AnkhResourceProfilesPath)
 	if resourceProfilesError == nil {
 		if _, err := util.CreateReducedYAMLFile(files.AnkhResourceProfilesPath, currentContext.ResourceProfile, true); err != nil {
-			return "", fmt.Errorf("unable to process ankh-resource-profiles.yaml file for chart '%s': %v", chart.Name, err)
+			return nil, fmt.Errorf("unable to process ankh-resource-profiles.yaml file for chart '%s': %v", chart.Name, err)
 		}
-		helmArgs = append(helmArgs, "-f", files.AnkhResourceProfilesPath)
+		valuesFiles = append(valuesFiles, valuesFile{"ankh-resource-profiles.yaml", files.AnkhResourceProfilesPath})
 	}
 
 	// Load `releases` from chart
@@ -195,10 +273,10 @@ func templateChart(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace strin
 		if releasesError == nil {
 			out, err := util.CreateReducedYAMLFile(files.AnkhReleasesPath, currentContext.Release, false)
 			if err != nil {
-				return "", fmt.Errorf("unable to process ankh-releases.yaml file for chart '%s': %v", chart.Name, err)
+				return nil, fmt.Errorf("unable to process ankh-releases.yaml file for chart '%s': %v", chart.Name, err)
 			}
 			if len(out) > 0 {
-				helmArgs = append(helmArgs, "-f", files.AnkhReleasesPath)
+				valuesFiles = append(valuesFiles, valuesFile{"ankh-releases.yaml", files.AnkhReleasesPath})
 			}
 		}
 	}
@@ -208,34 +286,34 @@ func templateChart(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace strin
 		defaultValuesPath := filepath.Join(files.Dir, "default-values.yaml")
 		defaultValuesBytes, err := yaml.Marshal(chart.DefaultValues)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		if err := ioutil.WriteFile(defaultValuesPath, defaultValuesBytes, 0644); err != nil {
-			return "", err
+			return nil, err
 		}
 
-		helmArgs = append(helmArgs, "-f", defaultValuesPath)
+		valuesFiles = append(valuesFiles, valuesFile{"default-values", defaultValuesPath})
 	}
 
 	// Load `values`
 	if chart.Values != nil {
 		values, err := util.MapSliceRegexMatch(chart.Values, currentContext.EnvironmentClass)
 		if err != nil {
-			return "", fmt.Errorf("Failed to load `values` for chart %v: %v", chart.Name, err)
+			return nil, fmt.Errorf("Failed to load `values` for chart %v: %v", chart.Name, err)
 		}
 		if values != nil {
 			valuesPath := filepath.Join(files.Dir, "values.yaml")
 			valuesBytes, err := yaml.Marshal(values)
 			if err != nil {
-				return "", err
+				return nil, err
 			}
 
 			if err := ioutil.WriteFile(valuesPath, valuesBytes, 0644); err != nil {
-				return "", err
+				return nil, err
 			}
 
-			helmArgs = append(helmArgs, "-f", valuesPath)
+			valuesFiles = append(valuesFiles, valuesFile{"values", valuesPath})
 		}
 	}
 
@@ -243,21 +321,21 @@ func templateChart(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace strin
 	if chart.ResourceProfiles != nil {
 		values, err := util.MapSliceRegexMatch(chart.ResourceProfiles, currentContext.ResourceProfile)
 		if err != nil {
-			return "", fmt.Errorf("Failed to load `resource-profiles` for chart %v: %v", chart.Name, err)
+			return nil, fmt.Errorf("Failed to load `resource-profiles` for chart %v: %v", chart.Name, err)
 		}
 		if values != nil {
 			resourceProfilesPath := filepath.Join(files.Dir, "resource-profiles.yaml")
 			resourceProfilesBytes, err := yaml.Marshal(values)
 
 			if err != nil {
-				return "", err
+				return nil, err
 			}
 
 			if err := ioutil.WriteFile(resourceProfilesPath, resourceProfilesBytes, 0644); err != nil {
-				return "", err
+				return nil, err
 			}
 
-			helmArgs = append(helmArgs, "-f", resourceProfilesPath)
+			valuesFiles = append(valuesFiles, valuesFile{"resource-profiles", resourceProfilesPath})
 		}
 	}
 
@@ -265,21 +343,21 @@ func templateChart(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace strin
 	if chart.Releases != nil {
 		values, err := util.MapSliceRegexMatch(chart.Releases, currentContext.Release)
 		if err != nil {
-			return "", fmt.Errorf("Failed to load `releases` for chart %v: %v", chart.Name, err)
+			return nil, fmt.Errorf("Failed to load `releases` for chart %v: %v", chart.Name, err)
 		}
 		if values != nil {
 			releasesPath := filepath.Join(files.Dir, "releases.yaml")
 			releasesBytes, err := yaml.Marshal(values)
 
 			if err != nil {
-				return "", err
+				return nil, err
 			}
 
 			if err := ioutil.WriteFile(releasesPath, releasesBytes, 0644); err != nil {
-				return "", err
+				return nil, err
 			}
 
-			helmArgs = append(helmArgs, "-f", releasesPath)
+			valuesFiles = append(valuesFiles, valuesFile{"releases", releasesPath})
 		}
 	}
 
@@ -291,48 +369,121 @@ func templateChart(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace strin
 			"global": currentContext.Global,
 		})
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		ctx.Logger.Debugf("writing global values to %s", files.GlobalPath)
 
 		if err := ioutil.WriteFile(files.GlobalPath, globalYamlBytes, 0644); err != nil {
-			return "", err
+			return nil, err
 		}
 
-		helmArgs = append(helmArgs, "-f", files.GlobalPath)
+		valuesFiles = append(valuesFiles, valuesFile{"global", files.GlobalPath})
+	}
+
+	return valuesFiles, nil
+}
+
+// templateChart writes the output of `helm template` for chart to w as helm renders it.
+func templateChart(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace string, w io.Writer) error {
+	currentContext := ctx.AnkhConfig.CurrentContext
+	helmArgs := []string{"helm", "template"}
+
+	if namespace != "" {
+		helmArgs = append(helmArgs, []string{"--namespace", namespace}...)
+	}
+
+	if currentContext.Release != "" {
+		helmArgs = append(helmArgs, []string{"--name", currentContext.Release}...)
+	}
+
+	for key, val := range ctx.HelmSetValues {
+		helmArgs = append(helmArgs, "--set", key+"="+val)
+	}
+
+	// default to the global TagValueName, but allow per-chart overrides
+	tagValueName := ctx.AnkhConfig.Helm.TagValueName
+	if chart.TagValueName != "" {
+		ctx.Logger.Debugf("Overriding tagValueName to chart.TagValuename=%v (was configured globally as %v)",
+			chart.TagValueName, ctx.AnkhConfig.Helm.TagValueName)
+		tagValueName = chart.TagValueName
+	}
+
+	// Set tagValueName=Chart.Tag, if configured and present
+	if tagValueName != "" && chart.Tag != "" {
+		ctx.Logger.Debugf("Setting helm value %v=%v since tagValueName and chart.Tag are set",
+			tagValueName, chart.Tag)
+		helmArgs = append(helmArgs, "--set", tagValueName+"="+chart.Tag)
+	}
+
+	files, err := findChartFiles(ctx, chart)
+
+	if err != nil {
+		return err
+	}
+
+	valuesFiles, err := prepareValuesFiles(ctx, chart, files)
+	if err != nil {
+		return err
+	}
+	if len(chart.MergeStrategies) > 0 {
+		// helm replaces lists, so merge the values here, using the chart's strategies.
+		mergedPath, err := mergeValuesFiles(chart, files, valuesFiles)
+		if err != nil {
+			return err
+		}
+		helmArgs = append(helmArgs, "-f", mergedPath)
+	} else {
+		for _, f := range valuesFiles {
+			helmArgs = append(helmArgs, "-f", f.Path)
+		}
 	}
 
 	helmArgs = append(helmArgs, files.ChartDir)
 
 	ctx.Logger.Debugf("running helm command %s", strings.Join(helmArgs, " "))
 
-	helmCmd := execContext(helmArgs[0], helmArgs[1:]...)
-
 	if ctx.Mode == ankh.Explain {
-		return explain(helmCmd.Args), nil
+		_, err := io.WriteString(w, explain(helmArgs))
+		return err
 	}
-	var stdout, stderr bytes.Buffer
-	helmCmd.Stdout = &stdout
+
+	helmCmd := ctx.Command(ankh.TemplatePhase, helmArgs[0], helmArgs[1:]...)
+	var stderr bytes.Buffer
+	helmCmd.Stdout = w
 	helmCmd.Stderr = &stderr
 
+	record := ctx.StartCommand(helmCmd)
 	err = helmCmd.Run()
-	var helmOutput, helmError = string(stdout.Bytes()), string(stderr.Bytes())
+	err = record.Finish(err)
+	var helmError = string(stderr.Bytes())
 	if err != nil {
+		if te := parseTemplateError(helmError); te != nil {
+			ctx.Logger.Debugf("helm template failed with the following output on stderr:\n%s", helmError)
+			return fmt.Errorf("error rendering chart '%v':\n%v", chart.Name,
+				strings.TrimRight(te.describe(filepath.Dir(files.ChartDir), mergedValues(files.ValuesPath, helmArgs)), "\n"))
+		}
+
 		outputMsg := ""
 		if len(helmError) > 0 {
 			outputMsg = fmt.Sprintf(" -- the helm process had the following output on stderr:\n%s", helmError)
 		}
-		return "", fmt.Errorf("error running the helm command: %v%v", err, outputMsg)
+		return fmt.Errorf("error running the helm command: %v%v", err, outputMsg)
 	}
 
-	return string(helmOutput), nil
+	return nil
 }
 
-func Version() (string, error) {
+func Version(ctx *ankh.ExecutionContext) (string, error) {
 	helmArgs := []string{"helm", "version", "--client"}
-	helmCmd := exec.Command(helmArgs[0], helmArgs[1:]...)
-	helmOutput, err := helmCmd.CombinedOutput()
+	helmCmd := ctx.Command(ankh.RunPhase, helmArgs[0], helmArgs[1:]...)
+	var output bytes.Buffer
+	helmCmd.Stdout = &output
+	helmCmd.Stderr = &output
+	record := ctx.StartCommand(helmCmd)
+	err := helmCmd.Run()
+	err = record.Finish(err)
+	helmOutput := output.Bytes()
 	if err != nil {
 		outputMsg := ""
 		if len(helmOutput) > 0 {
@@ -360,27 +511,88 @@ type HelmIndex struct {
 }
 
 func listCharts(ctx *ankh.ExecutionContext, numToShow int, descending bool) (map[string][]string, error) {
-	indexURL := fmt.Sprintf("%s/index.yaml", strings.TrimRight(
-		ctx.AnkhConfig.Helm.Registry, "/"))
-	ctx.Logger.Debugf("downloading index.yaml from %s", indexURL)
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	registries := Registries(ctx)
+	if len(registries) == 0 {
+		return nil, fmt.Errorf("No helm registry configured. Set `helm.registry` globally, or `See README.md on where to specify a helm registry.")
+	}
+
+	var err error
+	for i, registry := range registries {
+		if i > 0 {
+			ctx.Logger.Warnf("Falling back to helm registry '%v' to list charts", registry)
+		}
+		var reduced map[string][]string
+		reduced, err = listRegistryCharts(ctx, registry, numToShow, descending)
+		if err == nil {
+			ctx.Logger.Debugf("Listed charts from helm registry '%v'", registry)
+			return reduced, nil
+		}
+		ctx.Logger.Warnf("%v", err)
+	}
+	return nil, err
+}
+
+// PingRegistry checks that a helm registry serves an index.yaml.
+func PingRegistry(ctx *ankh.ExecutionContext, registry string) error {
+	indexURL := fmt.Sprintf("%s/index.yaml", strings.TrimRight(registry, "/"))
+	tr, err := ctx.RegistryTransport(registry)
+	if err != nil {
+		return err
 	}
 	client := &http.Client{
 		Transport: tr,
 		Timeout:   time.Duration(5 * time.Second),
 	}
-	resp, err := client.Get(indexURL)
+	req, err := newRegistryRequest(ctx, registry, "index.yaml")
 	if err != nil {
-		return nil, fmt.Errorf("got an error %v when trying to call %v", err, indexURL)
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("got an error %v when trying to call %v", err, indexURL)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Received HTTP status '%v' (code %v) when trying to call %s", resp.Status, resp.StatusCode, indexURL)
+		return fmt.Errorf("Received HTTP status '%v' (code %v) when trying to call %s", resp.Status, resp.StatusCode, indexURL)
 	}
+	return nil
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+func listRegistryCharts(ctx *ankh.ExecutionContext, registry string, numToShow int, descending bool) (map[string][]string, error) {
+	indexURL := fmt.Sprintf("%s/index.yaml", strings.TrimRight(registry, "/"))
+	ctx.Logger.Debugf("downloading index.yaml from %s", indexURL)
+	tr, err := ctx.RegistryTransport(registry)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: tr,
+		Timeout:   time.Duration(5 * time.Second),
+	}
+	var body []byte
+	err = ctx.Retry(fmt.Sprintf("fetching %v", indexURL), func() error {
+		req, err := newRegistryRequest(ctx, registry, "index.yaml")
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("got an error %v when trying to call %v", err, indexURL)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			err := fmt.Errorf("Received HTTP status '%v' (code %v) when trying to call %s", resp.Status, resp.StatusCode, indexURL)
+			if util.TransientHTTPStatus(resp.StatusCode) {
+				return util.Transient(err)
+			}
+			return err
+		}
+
+		body, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -530,6 +742,11 @@ func writeChartYaml(ctx *ankh.ExecutionContext, chartYaml map[string]interface{}
 }
 
 func Publish(ctx *ankh.ExecutionContext) error {
+	if isObjectStoreRegistry(ctx.AnkhConfig.Helm.Registry) {
+		return fmt.Errorf("Publishing to helm registry '%v' is not supported, since ankh only reads from registries in buckets. "+
+			"Upload the chart with your cloud's CLI and update the registry's index.yaml, eg: with `helm repo index`", ctx.AnkhConfig.Helm.Registry)
+	}
+
 	_, chartYaml, err := readChartYaml(ctx, "Chart.yaml")
 	if err != nil {
 		return err
@@ -550,14 +767,16 @@ func Publish(ctx *ankh.ExecutionContext) error {
 	defer removeTarball()
 
 	helmArgs := []string{"helm", "package", wd}
-	helmCmd := execContext(helmArgs[0], helmArgs[1:]...)
+	helmCmd := ctx.Command(ankh.RunPhase, helmArgs[0], helmArgs[1:]...)
 
 	var stderr bytes.Buffer
 	helmCmd.Stderr = &stderr
 
 	// Use helm to create a package tarball
 	ctx.Logger.Infof("Packaging '%v-%v'", chartYaml.Name, chartYaml.Version)
+	record := ctx.StartCommand(helmCmd)
 	err = helmCmd.Run()
+	err = record.Finish(err)
 	var helmError = string(stderr.Bytes())
 	if err != nil {
 		outputMsg := ""
@@ -593,9 +812,17 @@ func Publish(ctx *ankh.ExecutionContext) error {
 
 	switch strings.ToLower(ctx.AnkhConfig.Helm.AuthType) {
 	case "basic":
-		// Get basic auth credentials
+		// Get basic auth credentials, preferring the environment, then the keyring, then prompting.
+		creds, keyringErr := keyring.Get(keyring.HelmRegistryKey(ctx.AnkhConfig.Helm.Registry))
 		username := os.Getenv("ANKH_HELM_REGISTRY_USERNAME")
-		if username == "" {
+		if username == "" && keyringErr == nil {
+			username = creds.Username
+			ctx.Logger.Infof("Using username %v from keyring for 'basic' auth on helm registry '%v'",
+				username, ctx.AnkhConfig.Helm.Registry)
+		} else if username == "" && ctx.NoPrompt {
+			return fmt.Errorf("No credentials for helm registry '%v', and prompts are disabled. "+
+				"Set ANKH_HELM_REGISTRY_USERNAME and ANKH_HELM_REGISTRY_PASSWORD", ctx.AnkhConfig.Helm.Registry)
+		} else if username == "" {
 			username, err = util.PromptForUsername()
 			if err != nil {
 				return fmt.Errorf("Failed to read credentials from stdin: %v", err)
@@ -606,7 +833,12 @@ func Publish(ctx *ankh.ExecutionContext) error {
 		}
 
 		password := os.Getenv("ANKH_HELM_REGISTRY_PASSWORD")
-		if password == "" {
+		if password == "" && keyringErr == nil && creds.Username == username {
+			password = creds.Password
+		} else if password == "" && ctx.NoPrompt {
+			return fmt.Errorf("No password for helm registry '%v', and prompts are disabled. "+
+				"Set ANKH_HELM_REGISTRY_PASSWORD", ctx.AnkhConfig.Helm.Registry)
+		} else if password == "" {
 			password, err = util.PromptForPassword()
 			if err != nil {
 				return fmt.Errorf("Failed to read credentials from stdin: %v", err)
@@ -619,15 +851,17 @@ func Publish(ctx *ankh.ExecutionContext) error {
 		req.SetBasicAuth(username, password)
 	default:
 		if ctx.AnkhConfig.Helm.AuthType != "" {
-			ctx.Logger.Fatalf("Helm registry auth type '%v' is not supported - only 'basic' auth is supported.")
+			ctx.Logger.Fatalf("Helm registry auth type '%v' is not supported - only 'basic' auth is supported.", ctx.AnkhConfig.Helm.AuthType)
 		}
 	}
 
+	tr, err := ctx.RegistryTransport(ctx.AnkhConfig.Helm.Registry)
+	if err != nil {
+		return err
+	}
 	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-		Timeout: time.Duration(5 * time.Second),
+		Transport: tr,
+		Timeout:   time.Duration(5 * time.Second),
 	}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -645,32 +879,130 @@ func Publish(ctx *ankh.ExecutionContext) error {
 	return nil
 }
 
+// Template templates charts concurrently, up to the `concurrency.charts` limit
+// at once, and joins their output in the order of charts.
 func Template(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string) (string, error) {
-	finalOutput := ""
-	if len(charts) > 0 {
-		for _, chart := range charts {
-			extraString := ""
-			if chart.Version != "" {
-				extraString = fmt.Sprintf(" at version \"%v\"", chart.Version)
-			} else if chart.Path != "" {
-				extraString = fmt.Sprintf(" from path \"%v\"", chart.Path)
-			}
-			ctx.Logger.Infof("Templating chart \"%s\"%s", chart.Name, extraString)
-			chartOutput, err := templateChart(ctx, chart, namespace)
-			if err != nil {
-				return finalOutput, err
-			}
-			finalOutput += chartOutput
+	var output strings.Builder
+	err := TemplateTo(ctx, charts, namespace, &output)
+	return output.String(), err
+}
+
+// TemplateTo is Template, but writes the output of charts to w as it's
+// rendered, rather than once every chart has been.
+func TemplateTo(ctx *ankh.ExecutionContext, charts []ankh.Chart, namespace string, w io.Writer) error {
+	if len(charts) == 0 {
+		ctx.Logger.Infof("%s does not contain any charts. Nothing to do.", ctx.AnkhFilePath)
+		return nil
+	}
+
+	out := newOrderedOutput(w, len(charts))
+	pool := util.NewPool(ctx.ConcurrencyLimit(ankh.ChartsConcurrency))
+	for i, chart := range charts {
+		i, chart := i, chart
+		pool.Go(func() {
+			out.finish(i, templateOne(ctx, chart, namespace, out.writer(i)))
+		})
+	}
+	pool.Wait()
+	if err := out.err(); err != nil {
+		return err
+	}
+
+	if namespace != "" {
+		ctx.Logger.Infof("Finished templating charts for namespace %v", namespace)
+	} else {
+		ctx.Logger.Infof("Finished templating charts with an explicit empty namespace")
+	}
+	return nil
+}
+
+func templateOne(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace string, w io.Writer) error {
+	extraString := ""
+	if chart.IsManifests() {
+		extraString = fmt.Sprintf(" from manifests [ %v ]", strings.Join(chart.Manifests, ", "))
+	} else if chart.Version != "" {
+		extraString = fmt.Sprintf(" at version \"%v\"", chart.Version)
+	} else if chart.Path != "" {
+		extraString = fmt.Sprintf(" from path \"%v\"", chart.Path)
+	}
+	ctx.Logger.Infof("Templating chart \"%s\"%s", chart.Name, extraString)
+	if chart.IsManifests() {
+		output, err := templateManifests(ctx, chart, namespace)
+		if err != nil {
+			return err
 		}
-		if namespace != "" {
-			ctx.Logger.Infof("Finished templating charts for namespace %v", namespace)
-		} else {
-			ctx.Logger.Infof("Finished templating charts with an explicit empty namespace")
+		_, err = io.WriteString(w, output)
+		return err
+	}
+	return templateChart(ctx, chart, namespace, w)
+}
+
+// orderedOutput writes the output of charts templated concurrently to w in
+// their order. The output of the first chart that hasn't finished goes
+// straight through, and that of the charts after it is held until it has.
+// Nothing is written after the output of the first chart that failed.
+type orderedOutput struct {
+	w       io.Writer
+	mtx     sync.Mutex
+	head    int
+	held    []bytes.Buffer
+	done    []bool
+	errs    []error
+	failure error
+}
+
+func newOrderedOutput(w io.Writer, n int) *orderedOutput {
+	return &orderedOutput{w: w, held: make([]bytes.Buffer, n), done: make([]bool, n), errs: make([]error, n)}
+}
+
+type orderedWriter struct {
+	o *orderedOutput
+	i int
+}
+
+func (o *orderedOutput) writer(i int) io.Writer {
+	return &orderedWriter{o, i}
+}
+
+func (ow *orderedWriter) Write(p []byte) (int, error) {
+	o := ow.o
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if o.failure != nil {
+		return len(p), nil
+	}
+	if ow.i == o.head {
+		return o.w.Write(p)
+	}
+	return o.held[ow.i].Write(p)
+}
+
+// finish marks chart i as finished, with err if it failed, and writes the held
+// output of the charts after it that can now go.
+func (o *orderedOutput) finish(i int, err error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.done[i] = true
+	o.errs[i] = err
+	for o.failure == nil && o.head < len(o.done) && o.done[o.head] {
+		if o.errs[o.head] != nil {
+			o.failure = o.errs[o.head]
+			return
+		}
+		o.head++
+		if o.head < len(o.held) {
+			if _, err := o.held[o.head].WriteTo(o.w); err != nil {
+				o.failure = err
+			}
 		}
-	} else {
-		ctx.Logger.Infof("%s does not contain any charts. Nothing to do.", ctx.AnkhFilePath)
 	}
-	return finalOutput, nil
+}
+
+// err is the error of the first chart that failed, in their order.
+func (o *orderedOutput) err() error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.failure
 }
 
 func inspectFile(relativeDir string, file string) (string, error) {
@@ -719,6 +1051,8 @@ func Inspect(ctx *ankh.ExecutionContext, singleChart string) (string, error) {
 	chartVersion := ""
 	if len(tokens) == 2 {
 		chartVersion = tokens[1]
+	} else if ctx.NoPrompt {
+		return "", fmt.Errorf("Chart \"%v\" has no version, and prompts are disabled. Pass `%v@VERSION`", chartName, chartName)
 	} else {
 		versions, err := ListVersions(ctx, chartName, true)
 		if err != nil {
@@ -1,8 +1,222 @@
 package helm
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
 )
 
-// TODO: write tests
-func TestStub(t *testing.T) {}
+func newManifestsContext() *ankh.ExecutionContext {
+	dataDir, _ := ioutil.TempDir("", "")
+	return &ankh.ExecutionContext{
+		Logger:  logrus.New(),
+		DataDir: dataDir,
+		Mode:    ankh.Template,
+		AnkhConfig: ankh.AnkhConfig{
+			CurrentContext: ankh.Context{
+				EnvironmentClass: "dev",
+				ResourceProfile:  "constrained",
+				Release:          "minikube",
+			},
+		},
+		HelmSetValues: map[string]string{"port": "9090"},
+	}
+}
+
+func TestTemplateManifests(t *testing.T) {
+	t.Run("plain manifests", func(t *testing.T) {
+		ctx := newManifestsContext()
+		chart := ankh.Chart{Name: "test-app", Manifests: []string{"testdata/manifests"}}
+
+		output, err := templateManifests(ctx, chart, "test")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+
+		if !strings.Contains(output, "# Source: test-app/manifests/configmap.yaml") ||
+			!strings.Contains(output, "{{ .Values.host }}") {
+			t.Logf("expected untemplated manifest output but got '%s'", output)
+			t.Fail()
+		}
+	})
+
+	t.Run("templated manifests", func(t *testing.T) {
+		ctx := newManifestsContext()
+		chart := ankh.Chart{
+			Name:              "test-app",
+			Manifests:         []string{"testdata/manifests/configmap.yaml"},
+			TemplateManifests: true,
+			DefaultValues:     map[string]interface{}{"host": "localhost", "port": 8080},
+			Values: yaml.MapSlice{
+				yaml.MapItem{Key: "dev", Value: map[interface{}]interface{}{"host": "dev.internal.net"}},
+			},
+		}
+
+		output, err := templateManifests(ctx, chart, "test")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+
+		for _, expected := range []string{"name: test-app-minikube", "host: dev.internal.net", "port: \"9090\""} {
+			if !strings.Contains(output, expected) {
+				t.Logf("expected to find '%s' in output '%s'", expected, output)
+				t.Fail()
+			}
+		}
+	})
+
+	t.Run("multiple documents", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "ankh-manifests")
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer os.RemoveAll(dir)
+		manifest := "kind: Deployment\nmetadata:\n  name: web\n---\nkind: HorizontalPodAutoscaler\nmetadata:\n  name: web\n---\n---\nkind: Service\nmetadata:\n  name: web\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte(manifest), 0644); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		ctx := newManifestsContext()
+		chart := ankh.Chart{Name: "web", Manifests: []string{dir}}
+		output, err := templateManifests(ctx, chart, "test")
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		source := "# Source: web/" + filepath.Base(dir) + "/web.yaml\n"
+		expected := "---\n" + source + "kind: Deployment\nmetadata:\n  name: web\n" +
+			"---\n" + source + "kind: HorizontalPodAutoscaler\nmetadata:\n  name: web\n" +
+			"---\n" + source + "kind: Service\nmetadata:\n  name: web\n"
+		if output != expected {
+			t.Logf("expected each document to have a Source line but got '%s'", output)
+			t.Fail()
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		ctx := newManifestsContext()
+		chart := ankh.Chart{Name: "test-app", Manifests: []string{"/does/not/exist"}}
+
+		_, err := templateManifests(ctx, chart, "test")
+		if err == nil {
+			t.Log("expected to find an error but didnt get one")
+			t.Fail()
+		}
+	})
+}
+
+func TestTemplateOrder(t *testing.T) {
+	ctx := newManifestsContext()
+	charts := []ankh.Chart{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		charts = append(charts, ankh.Chart{Name: name, Manifests: []string{"testdata/manifests"}})
+	}
+
+	output, err := Template(ctx, charts, "test")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	last := -1
+	for _, chart := range charts {
+		i := strings.Index(output, "# Source: "+chart.Name+"/")
+		if i <= last {
+			t.Logf("expected the output of chart %v after that of the charts before it, but got '%s'", chart.Name, output)
+			t.Fail()
+		}
+		last = i
+	}
+}
+
+func TestRegistries(t *testing.T) {
+	t.Run("global registry with fallbacks", func(t *testing.T) {
+		ctx := newManifestsContext()
+		ctx.AnkhConfig.Helm.Registry = "https://primary"
+		ctx.AnkhConfig.Helm.FallbackRegistries = []string{"https://mirror"}
+
+		registries := Registries(ctx)
+		if strings.Join(registries, ",") != "https://primary,https://mirror" {
+			t.Logf("got unexpected registries %v", registries)
+			t.Fail()
+		}
+	})
+
+	t.Run("context-pinned registries", func(t *testing.T) {
+		ctx := newManifestsContext()
+		ctx.AnkhConfig.Helm.Registry = "https://primary"
+		ctx.AnkhConfig.CurrentContext.HelmRegistries = []string{"https://pinned", "https://pinned-mirror"}
+
+		registries := Registries(ctx)
+		if strings.Join(registries, ",") != "https://pinned,https://pinned-mirror" {
+			t.Logf("got unexpected registries %v", registries)
+			t.Fail()
+		}
+	})
+}
+
+func TestFetchChartVerifiesSignature(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/web-1.0.0.tgz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("chart"))
+	}))
+	defer server.Close()
+
+	ctx := newManifestsContext()
+	ctx.Mode = ankh.Apply
+	ctx.AnkhConfig.CurrentContext.Cosign = ankh.CosignConfig{Enabled: true, Key: "cosign.pub"}
+	dir, _ := ioutil.TempDir("", "")
+	_, err := fetchChart(ctx, server.URL, "web-1.0.0.tgz", dir)
+	if _, ok := err.(*VerificationError); !ok || !strings.Contains(err.Error(), "since its signature can't be fetched") {
+		t.Logf("expected a VerificationError for a chart without a signature but got %v", err)
+		t.Fail()
+	}
+	if _, ok := cachedChart(ctx, server.URL+"/web-1.0.0.tgz"); ok {
+		t.Log("expected an unverified chart not to be cached")
+		t.Fail()
+	}
+
+	// A cached chart that fails verification is removed from the cache.
+	ctx.ChartCacheDir, _ = ioutil.TempDir("", "")
+	cacheChart(ctx, server.URL+"/web-1.0.0.tgz", []byte("chart"))
+	cached, err := fetchChart(ctx, server.URL, "web-1.0.0.tgz", dir)
+	if _, ok := err.(*VerificationError); !ok || !cached {
+		t.Logf("expected a VerificationError for a cached chart without a signature but got %v", err)
+		t.Fail()
+	}
+	if _, ok := cachedChart(ctx, server.URL+"/web-1.0.0.tgz"); ok {
+		t.Log("expected the cached chart that failed verification to be removed")
+		t.Fail()
+	}
+
+	// It doesn't fall back to another registry.
+	fallbacks := 0
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbacks++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer fallback.Close()
+	ctx.AnkhConfig.Helm.Registry = server.URL
+	ctx.AnkhConfig.Helm.FallbackRegistries = []string{fallback.URL}
+	_, err = findChartFilesImpl(ctx, ankh.Chart{Name: "web", Version: "1.0.0"})
+	if _, ok := err.(*VerificationError); !ok || fallbacks != 0 {
+		t.Logf("expected a VerificationError without falling back but got %v after %v requests to the fallback", err, fallbacks)
+		t.Fail()
+	}
+}
@@ -10,8 +10,9 @@ import (
 )
 
 type KubeObject struct {
-	Kind     string
-	Metadata struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string
+	Metadata   struct {
 		Name   string
 		Labels map[string]string
 	}
@@ -37,7 +38,7 @@ func LintObject(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, obj KubeObje
 	// Verify that every object has a name with `-$release` as a suffix.
 	suffix := fmt.Sprintf("-%v", release)
 	if !strings.HasSuffix(obj.Metadata.Name, suffix) {
-		e := fmt.Errorf("Object with kind '%v' and name '%v': object name is missing a dashed release suffix (in this case, '%v'). Use .Release.Name in your template to ensure that all objects are named with the release as a suffix to aovid name collisions across releases.",
+		e := ankh.NewObjectError("release-suffix", obj.Kind, obj.Metadata.Name, "Object with kind '%v' and name '%v': object name is missing a dashed release suffix (in this case, '%v'). Use .Release.Name in your template to ensure that all objects are named with the release as a suffix to aovid name collisions across releases.",
 			obj.Kind, obj.Metadata.Name, suffix)
 		errors = append(errors, e)
 	}
@@ -45,7 +46,7 @@ func LintObject(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, obj KubeObje
 
 	// Verify that every object is labeled with a key `release` and value equal to the current context's release
 	if obj.Metadata.Labels["release"] != release {
-		e := fmt.Errorf("Object with kind '%v' and name '%v': object is missing a `release` label with the release name as a value (in this case, '%v'). Found these labels on the object: %+v", obj.Kind, obj.Metadata.Name, release, obj.Metadata.Labels)
+		e := ankh.NewObjectError("release-label", obj.Kind, obj.Metadata.Name, "Object with kind '%v' and name '%v': object is missing a `release` label with the release name as a value (in this case, '%v'). Found these labels on the object: %+v", obj.Kind, obj.Metadata.Name, release, obj.Metadata.Labels)
 		errors = append(errors, e)
 	}
 	ctx.Logger.Debugf("Object with kind '%v' and name '%v': object labels exist, and the release label is '%v'", obj.Kind, obj.Metadata.Name, obj.Metadata.Labels["release"])
@@ -54,15 +55,15 @@ func LintObject(ctx *ankh.ExecutionContext, ankhFile ankh.AnkhFile, obj KubeObje
 	case "deployment":
 		// The Deployment should create pods with the `release` label
 		if obj.Spec.Template.Metadata.Labels["release"] != release {
-			e := fmt.Errorf("Deployment with name '%v': object's spec.template.metadata.labels is missing a `release` label with the release name as a value (in this case, '%v'). Found these labels on spec.template.metadata: %+v", obj.Metadata.Name, release, obj.Spec.Template.Metadata.Labels)
+			e := ankh.NewObjectError("pod-release-label", obj.Kind, obj.Metadata.Name, "Deployment with name '%v': object's spec.template.metadata.labels is missing a `release` label with the release name as a value (in this case, '%v'). Found these labels on spec.template.metadata: %+v", obj.Metadata.Name, release, obj.Spec.Template.Metadata.Labels)
 			errors = append(errors, e)
 		}
-		ctx.Logger.Debugf("Deployment with name '%v': object spec.template.metadata.labels exists, and the release label is %v", obj.Kind, obj.Metadata.Name, obj.Spec.Template.Metadata.Labels["release"])
+		ctx.Logger.Debugf("Deployment with name '%v': object spec.template.metadata.labels exists, and the release label is %v", obj.Metadata.Name, obj.Spec.Template.Metadata.Labels["release"])
 	case "service":
 		// If the Service is not targeting an ExternalName, it should target pods with a `release` label
 		if obj.Spec.Type != "ExternalName" {
 			if obj.Spec.Selector["release"] != release {
-				e := fmt.Errorf("Service with type '%v' and name '%v': object's spec.selector is missing the `release` key with the release name as a value (in this case, '%v'). Found these keys on spec.selector: %+v", obj.Spec.Type, obj.Metadata.Name, release, obj.Spec.Selector)
+				e := ankh.NewObjectError("service-release-selector", obj.Kind, obj.Metadata.Name, "Service with type '%v' and name '%v': object's spec.selector is missing the `release` key with the release name as a value (in this case, '%v'). Found these keys on spec.selector: %+v", obj.Spec.Type, obj.Metadata.Name, release, obj.Spec.Selector)
 				errors = append(errors, e)
 			}
 			ctx.Logger.Debugf("Service with type '%v' and name '%v': object spec.selector exists, and the release key is %v", obj.Spec.Type, obj.Metadata.Name, obj.Spec.Selector["release"])
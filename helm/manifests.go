@@ -0,0 +1,169 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// manifestFile is a yaml file of a chart's `manifests`.
+type manifestFile struct {
+	path string
+	// source is the file's path relative to the directory of the `manifests`
+	// entry that it was found from, like a template's path in a helm chart,
+	// eg: `manifests/configmap.yaml`.
+	source string
+}
+
+// findManifestFiles expands a chart's `manifests` entries into a sorted list of yaml files.
+// Directories are walked recursively, and only files with a .yaml or .yml extension are used.
+func findManifestFiles(chart ankh.Chart) ([]manifestFile, error) {
+	files := []manifestFile{}
+	for _, p := range chart.Manifests {
+		info, err := os.Stat(p)
+		if err != nil {
+			return files, fmt.Errorf("Could not read manifests path '%v' for chart '%v': %v", p, chart.Name, err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, manifestFile{path: p, source: filepath.Base(p)})
+			continue
+		}
+
+		dirFiles := []string{}
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			if !info.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				dirFiles = append(dirFiles, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return files, fmt.Errorf("Could not read manifests directory '%v' for chart '%v': %v", p, chart.Name, err)
+		}
+		sort.Strings(dirFiles)
+		for _, path := range dirFiles {
+			source, err := filepath.Rel(filepath.Dir(filepath.Clean(p)), path)
+			if err != nil {
+				source = filepath.Base(path)
+			}
+			files = append(files, manifestFile{path: path, source: source})
+		}
+	}
+
+	if len(files) == 0 {
+		return files, fmt.Errorf("No yaml files found in `manifests` for chart '%v'", chart.Name)
+	}
+	return files, nil
+}
+
+var manifestFuncs = template.FuncMap{
+	"toYaml": func(v interface{}) string {
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSuffix(string(out), "\n")
+	},
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+	},
+	"quote": func(v interface{}) string {
+		return fmt.Sprintf("%q", fmt.Sprintf("%v", v))
+	},
+	"default": func(d interface{}, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return d
+		}
+		return v
+	},
+}
+
+// templateManifests produces output for a chart made of plain Kubernetes
+// manifests, without invoking helm. The manifests are optionally processed as
+// go templates with `.Values`, `.Release` and `.Chart` available, much like a
+// helm chart would have.
+func templateManifests(ctx *ankh.ExecutionContext, chart ankh.Chart, namespace string) (string, error) {
+	files, err := findManifestFiles(chart)
+	if err != nil {
+		return "", err
+	}
+
+	data := map[string]interface{}{
+		"Release": map[string]interface{}{
+			"Name":      ctx.AnkhConfig.CurrentContext.Release,
+			"Namespace": namespace,
+		},
+		"Chart": map[string]interface{}{
+			"Name":    chart.Name,
+			"Version": chart.Version,
+		},
+	}
+	if chart.TemplateManifests {
+		values, err := chartValues(ctx, chart)
+		if err != nil {
+			return "", err
+		}
+		data["Values"] = values
+	}
+
+	var output bytes.Buffer
+	for _, file := range files {
+		ctx.Logger.Debugf("Reading manifest file %v for chart %v", file.path, chart.Name)
+		content, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			return "", err
+		}
+
+		if chart.TemplateManifests {
+			tmpl, err := template.New(filepath.Base(file.path)).Funcs(manifestFuncs).Parse(string(content))
+			if err != nil {
+				return "", fmt.Errorf("Failed to parse manifest template '%v' for chart '%v': %v", file.path, chart.Name, err)
+			}
+			var rendered bytes.Buffer
+			if err := tmpl.Execute(&rendered, data); err != nil {
+				return "", fmt.Errorf("Failed to render manifest template '%v' for chart '%v': %v", file.path, chart.Name, err)
+			}
+			content = rendered.Bytes()
+		}
+
+		// Each document gets its own Source line, since objects are credited
+		// to the chart named in theirs.
+		source := fmt.Sprintf("# Source: %v/%v\n", chart.Name, filepath.ToSlash(file.source))
+		err = util.TransformDocuments(bytes.NewReader(content), &output, func(doc string) (string, bool, error) {
+			return source + strings.TrimLeft(doc, "\n"), true, nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("Failed to read manifest '%v' for chart '%v': %v", file.path, chart.Name, err)
+		}
+	}
+
+	if ctx.Mode == ankh.Explain {
+		// There's no helm invocation to explain, so write the rendered manifests
+		// to the data dir and explain them as a plain `cat`.
+		if err := os.MkdirAll(ctx.DataDir, 0755); err != nil {
+			return "", err
+		}
+		renderedPath := filepath.Join(ctx.DataDir, chart.Name+"-manifests.yaml")
+		if err := ioutil.WriteFile(renderedPath, output.Bytes(), 0644); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("cat %v && \\\n", renderedPath), nil
+	}
+
+	return output.String(), nil
+}
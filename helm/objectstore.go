@@ -0,0 +1,53 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// isObjectStoreRegistry is true for registries that are buckets, addressed
+// as `s3://bucket/path` or `gs://bucket/path`, rather than over HTTP.
+func isObjectStoreRegistry(registry string) bool {
+	return strings.HasPrefix(registry, "s3://") || strings.HasPrefix(registry, "gs://")
+}
+
+// splitBucketURL splits `s3://bucket/path` or `gs://bucket/path` into the
+// bucket and the key of name under path.
+func splitBucketURL(registry string, name string) (string, string, error) {
+	u, err := url.Parse(registry)
+	if err != nil {
+		return "", "", fmt.Errorf("Could not parse helm registry '%v' as a URL: %v", registry, err)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("Helm registry '%v' is missing a bucket name", registry)
+	}
+	key := strings.Trim(u.Path, "/")
+	if key != "" {
+		key += "/"
+	}
+	return u.Host, key + name, nil
+}
+
+// newRegistryRequest makes a GET request for the file name in a helm
+// registry. Registries in S3 and GCS buckets are fetched over their HTTPS APIs,
+// authenticated the way their CLIs are, and other registries get the
+// credentials stored by `ankh login registry`.
+func newRegistryRequest(ctx *ankh.ExecutionContext, registry string, name string) (*http.Request, error) {
+	switch {
+	case strings.HasPrefix(registry, "s3://"):
+		return newS3Request(ctx, registry, name)
+	case strings.HasPrefix(registry, "gs://"):
+		return newGCSRequest(ctx, registry, name)
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", strings.TrimRight(registry, "/"), name), nil)
+	if err != nil {
+		return nil, err
+	}
+	setRegistryAuth(ctx, req, registry)
+	return req, nil
+}
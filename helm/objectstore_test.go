@@ -0,0 +1,120 @@
+package helm
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestSplitBucketURL(t *testing.T) {
+	bucket, key, err := splitBucketURL("s3://charts/stable/", "index.yaml")
+	if err != nil || bucket != "charts" || key != "stable/index.yaml" {
+		t.Logf("got bucket '%v', key '%v' and error %v", bucket, key, err)
+		t.Fail()
+	}
+
+	bucket, key, err = splitBucketURL("gs://charts", "web-1.0.0.tgz")
+	if err != nil || bucket != "charts" || key != "web-1.0.0.tgz" {
+		t.Logf("got bucket '%v', key '%v' and error %v", bucket, key, err)
+		t.Fail()
+	}
+
+	if _, _, err := splitBucketURL("s3:///stable", "index.yaml"); err == nil {
+		t.Logf("expected an error for a registry without a bucket")
+		t.Fail()
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	os.Unsetenv("AWS_ENDPOINT_URL")
+	urls := map[string]string{
+		s3URL("charts", "stable/index.yaml", "us-west-2").String():     "https://charts.s3.us-west-2.amazonaws.com/stable/index.yaml",
+		s3URL("charts.example.com", "web 1.tgz", "us-east-1").String(): "https://s3.us-east-1.amazonaws.com/charts.example.com/web%201.tgz",
+	}
+	os.Setenv("AWS_ENDPOINT_URL", "http://localhost:9000")
+	defer os.Unsetenv("AWS_ENDPOINT_URL")
+	urls[s3URL("charts", "index.yaml", "us-east-1").String()] = "http://localhost:9000/charts/index.yaml"
+
+	for got, expected := range urls {
+		if got != expected {
+			t.Logf("expected %v but got %v", expected, got)
+			t.Fail()
+		}
+	}
+}
+
+func TestGCSServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			w.WriteHeader(400)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte(`{"access_token": "ya29.token", "expires_in": 3600}`))
+	}))
+	defer tokenServer.Close()
+
+	bucketServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.token" || r.URL.Path != "/charts/stable/index.yaml" {
+			w.WriteHeader(403)
+			return
+		}
+		w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+	}))
+	defer bucketServer.Close()
+
+	dir, err := ioutil.TempDir("", "ankh-gcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	creds, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "charts@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenServer.URL,
+	})
+	credsPath := filepath.Join(dir, "credentials.json")
+	ioutil.WriteFile(credsPath, creds, 0644)
+
+	os.Unsetenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsPath)
+	os.Setenv("STORAGE_EMULATOR_HOST", bucketServer.URL)
+	defer os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+	defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	if err := PingRegistry(ctx, "gs://charts/stable"); err != nil {
+		t.Logf("got error %v", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,173 @@
+package helm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/appnexus/ankh/util"
+)
+
+// Resources are CPU in cores, and memory in bytes.
+type Resources struct {
+	CPURequests    float64
+	CPULimits      float64
+	MemoryRequests float64
+	MemoryLimits   float64
+}
+
+// Add adds other to r.
+func (r *Resources) Add(other Resources) {
+	r.CPURequests += other.CPURequests
+	r.CPULimits += other.CPULimits
+	r.MemoryRequests += other.MemoryRequests
+	r.MemoryLimits += other.MemoryLimits
+}
+
+func (r Resources) times(n int) Resources {
+	return Resources{
+		CPURequests:    r.CPURequests * float64(n),
+		CPULimits:      r.CPULimits * float64(n),
+		MemoryRequests: r.MemoryRequests * float64(n),
+		MemoryLimits:   r.MemoryLimits * float64(n),
+	}
+}
+
+// WorkloadResources are the resources requested by all of the replicas of a
+// workload. DaemonSets run a pod per node, so theirs are PerNode, for one pod.
+type WorkloadResources struct {
+	Kind     string
+	Name     string
+	Replicas int
+	PerNode  bool
+	Resources
+}
+
+type resourcesContainer struct {
+	Resources struct {
+		Requests map[string]interface{}
+		Limits   map[string]interface{}
+	}
+}
+
+type resourcesPodSpec struct {
+	Containers []resourcesContainer
+}
+
+type resourcesObject struct {
+	Kind     string
+	Metadata struct {
+		Name string
+	}
+	Spec struct {
+		Replicas *int
+		Template struct {
+			Spec resourcesPodSpec
+		}
+		// Pods have their containers in their own spec.
+		Containers []resourcesContainer
+	}
+}
+
+var binarySuffixes = map[string]float64{
+	"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40, "Pi": 1 << 50, "Ei": 1 << 60,
+}
+
+var decimalSuffixes = map[string]float64{
+	"n": 1e-9, "u": 1e-6, "m": 1e-3, "k": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18,
+}
+
+// ParseQuantity parses a Kubernetes resource quantity, eg: `250m`, `1.5`,
+// `512Mi` or `1G`.
+func ParseQuantity(quantity string) (float64, error) {
+	quantity = strings.TrimSpace(quantity)
+	if len(quantity) > 2 {
+		if multiplier, ok := binarySuffixes[quantity[len(quantity)-2:]]; ok {
+			value, err := strconv.ParseFloat(quantity[:len(quantity)-2], 64)
+			if err == nil {
+				return value * multiplier, nil
+			}
+		}
+	}
+	if len(quantity) > 1 {
+		if multiplier, ok := decimalSuffixes[quantity[len(quantity)-1:]]; ok {
+			value, err := strconv.ParseFloat(quantity[:len(quantity)-1], 64)
+			if err == nil {
+				return value * multiplier, nil
+			}
+		}
+	}
+	value, err := strconv.ParseFloat(quantity, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid quantity '%v'", quantity)
+	}
+	return value, nil
+}
+
+func podResources(spec resourcesPodSpec) (Resources, error) {
+	total := Resources{}
+	for _, container := range spec.Containers {
+		quantities := []struct {
+			values   map[string]interface{}
+			resource string
+			total    *float64
+		}{
+			{container.Resources.Requests, "cpu", &total.CPURequests},
+			{container.Resources.Limits, "cpu", &total.CPULimits},
+			{container.Resources.Requests, "memory", &total.MemoryRequests},
+			{container.Resources.Limits, "memory", &total.MemoryLimits},
+		}
+		for _, q := range quantities {
+			if q.values[q.resource] == nil {
+				continue
+			}
+			value, err := ParseQuantity(fmt.Sprint(q.values[q.resource]))
+			if err != nil {
+				return total, err
+			}
+			*q.total += value
+		}
+	}
+	return total, nil
+}
+
+// WorkloadsResources adds up the CPU and memory requested by the containers
+// of the Deployments, StatefulSets, ReplicaSets, DaemonSets and Pods in
+// helmOutput, times their replicas. Jobs run to completion, so they're left
+// out, as are init containers.
+func WorkloadsResources(helmOutput string) ([]WorkloadResources, error) {
+	workloads := []WorkloadResources{}
+	docs := util.NewYAMLDocuments(helmOutput)
+	for {
+		obj := resourcesObject{}
+		if !docs.Next(&obj) {
+			break
+		}
+
+		workload := WorkloadResources{Kind: obj.Kind, Name: obj.Metadata.Name, Replicas: 1}
+		spec := obj.Spec.Template.Spec
+		switch obj.Kind {
+		case "Deployment", "StatefulSet", "ReplicaSet":
+			if obj.Spec.Replicas != nil {
+				workload.Replicas = *obj.Spec.Replicas
+			}
+		case "DaemonSet":
+			workload.PerNode = true
+		case "Pod":
+			spec = resourcesPodSpec{Containers: obj.Spec.Containers}
+		default:
+			continue
+		}
+
+		resources, err := podResources(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%v '%v': %v", obj.Kind, obj.Metadata.Name, err)
+		}
+		workload.Resources = resources.times(workload.Replicas)
+		workloads = append(workloads, workload)
+	}
+	if err := docs.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to parse templated output: %v", err)
+	}
+	return workloads, nil
+}
@@ -0,0 +1,110 @@
+package helm
+
+import (
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	quantities := map[string]float64{
+		"250m":  0.25,
+		"2":     2,
+		"1.5":   1.5,
+		"512Mi": 512 * 1024 * 1024,
+		"1Gi":   1024 * 1024 * 1024,
+		"1G":    1e9,
+		"128k":  128e3,
+		"1e3":   1000,
+	}
+	for quantity, expected := range quantities {
+		value, err := ParseQuantity(quantity)
+		if err != nil || value != expected {
+			t.Logf("expected %v for '%v' but got %v (error %v)", expected, quantity, value, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := ParseQuantity("lots"); err == nil {
+		t.Logf("expected an error for an invalid quantity")
+		t.Fail()
+	}
+}
+
+func TestWorkloadsResources(t *testing.T) {
+	helmOutput := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: web
+        resources:
+          requests:
+            cpu: 250m
+            memory: 256Mi
+          limits:
+            cpu: 1
+            memory: 512Mi
+      - name: sidecar
+        resources:
+          requests:
+            cpu: 50m
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    spec:
+      containers:
+      - name: agent
+        resources:
+          requests:
+            memory: 1Gi
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+spec:
+  containers:
+  - name: debug
+    resources:
+      limits:
+        cpu: "2"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+	workloads, err := WorkloadsResources(helmOutput)
+	if err != nil {
+		t.Logf("got error %v", err)
+		t.FailNow()
+	}
+	if len(workloads) != 3 {
+		t.Logf("expected 3 workloads but got %+v", workloads)
+		t.FailNow()
+	}
+
+	web := workloads[0]
+	expected := Resources{CPURequests: 0.9, CPULimits: 3, MemoryRequests: 3 * 256 * 1024 * 1024, MemoryLimits: 3 * 512 * 1024 * 1024}
+	if web.Name != "web" || web.Replicas != 3 || web.MemoryRequests != expected.MemoryRequests ||
+		web.CPULimits != expected.CPULimits || web.MemoryLimits != expected.MemoryLimits || web.CPURequests < 0.899 || web.CPURequests > 0.901 {
+		t.Logf("expected %+v but got %+v", expected, web)
+		t.Fail()
+	}
+	if !workloads[1].PerNode || workloads[1].MemoryRequests != 1024*1024*1024 {
+		t.Logf("unexpected DaemonSet resources %+v", workloads[1])
+		t.Fail()
+	}
+	if workloads[2].Kind != "Pod" || workloads[2].CPULimits != 2 {
+		t.Logf("unexpected Pod resources %+v", workloads[2])
+		t.Fail()
+	}
+}
@@ -0,0 +1,67 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/aws"
+	"github.com/appnexus/ankh/context"
+)
+
+// awsEscapePath URI encodes each segment of path the way SigV4 expects.
+func awsEscapePath(path string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(path) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '.' || b == '_' || b == '~' || b == '/' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// s3URL is where to GET key from bucket. Buckets are addressed by virtual
+// host, unless their name has dots, which don't match the S3 certificate, or
+// AWS_ENDPOINT_URL points elsewhere, eg: at MinIO.
+func s3URL(bucket string, key string, region string) *url.URL {
+	u := &url.URL{Scheme: "https", Host: fmt.Sprintf("%v.s3.%v.amazonaws.com", bucket, region), Path: "/" + key}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		if e, err := url.Parse(endpoint); err == nil && e.Host != "" {
+			u.Scheme, u.Host = e.Scheme, e.Host
+			u.Path = strings.TrimRight(e.Path, "/") + "/" + bucket + "/" + key
+		}
+	} else if strings.Contains(bucket, ".") {
+		u.Host = fmt.Sprintf("s3.%v.amazonaws.com", region)
+		u.Path = "/" + bucket + "/" + key
+	}
+	u.RawPath = awsEscapePath(u.Path)
+	return u
+}
+
+// newS3Request makes a GET request for the file name in an `s3://bucket/path`
+// registry, signed with the AWS CLI's credentials, if there are any.
+func newS3Request(ctx *ankh.ExecutionContext, registry string, name string) (*http.Request, error) {
+	bucket, key, err := splitBucketURL(registry, name)
+	if err != nil {
+		return nil, err
+	}
+	region := aws.Region()
+	req, err := http.NewRequest("GET", s3URL(bucket, key, region).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := aws.LoadCredentials()
+	if creds == nil {
+		ctx.Logger.Debugf("No AWS credentials found, so fetching from helm registry '%v' anonymously", registry)
+		return req, nil
+	}
+	aws.SignRequest(req, nil, *creds, region, "s3", time.Now())
+	return req, nil
+}
@@ -0,0 +1,170 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// ScoreCheck is the outcome of one best-practice check on one rendered object.
+// Checks that failed have an error saying why.
+type ScoreCheck struct {
+	Rule string
+	Kind string
+	Name string
+	Err  error
+}
+
+type scoreContainer struct {
+	Name           string
+	ReadinessProbe interface{} `yaml:"readinessProbe"`
+	LivenessProbe  interface{} `yaml:"livenessProbe"`
+	Resources      struct {
+		Requests map[string]interface{}
+		Limits   map[string]interface{}
+	}
+}
+
+type scoreObject struct {
+	Kind     string
+	Metadata struct {
+		Name string
+	}
+	Spec struct {
+		Replicas *int
+		Selector struct {
+			MatchLabels map[string]string `yaml:"matchLabels"`
+		}
+		Template struct {
+			Metadata struct {
+				Labels map[string]string
+			}
+			Spec struct {
+				Affinity struct {
+					PodAntiAffinity interface{} `yaml:"podAntiAffinity"`
+				}
+				TopologySpreadConstraints []interface{} `yaml:"topologySpreadConstraints"`
+				Containers                []scoreContainer
+				Volumes                   []struct {
+					Name     string
+					HostPath interface{} `yaml:"hostPath"`
+				}
+			}
+		}
+	}
+}
+
+// selects is true when every label in selector is on labels.
+func selects(selector map[string]string, labels map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func scoreWorkload(obj scoreObject, pdbSelectors []map[string]string) []ScoreCheck {
+	checks := []ScoreCheck{}
+	check := func(rule string, passed bool, format string, args ...interface{}) {
+		c := ScoreCheck{Rule: rule, Kind: obj.Kind, Name: obj.Metadata.Name}
+		if !passed {
+			c.Err = ankh.NewObjectError(rule, obj.Kind, obj.Metadata.Name, "%v '%v': %v", obj.Kind, obj.Metadata.Name, fmt.Sprintf(format, args...))
+		}
+		checks = append(checks, c)
+	}
+
+	spec := obj.Spec.Template.Spec
+	for _, container := range spec.Containers {
+		check("score-readiness-probe", container.ReadinessProbe != nil,
+			"container '%v' has no readinessProbe, so it gets traffic before it's ready", container.Name)
+		check("score-liveness-probe", container.LivenessProbe != nil,
+			"container '%v' has no livenessProbe, so it won't be restarted if it hangs", container.Name)
+
+		missing := []string{}
+		for _, resource := range []string{"cpu", "memory"} {
+			if container.Resources.Requests[resource] == nil {
+				missing = append(missing, "resources.requests."+resource)
+			}
+		}
+		check("score-resource-requests", len(missing) == 0,
+			"container '%v' is missing %v, so it may be scheduled onto a node without room for it", container.Name, strings.Join(missing, " and "))
+
+		missing = []string{}
+		for _, resource := range []string{"cpu", "memory"} {
+			if container.Resources.Limits[resource] == nil {
+				missing = append(missing, "resources.limits."+resource)
+			}
+		}
+		check("score-resource-limits", len(missing) == 0,
+			"container '%v' is missing %v, so it can starve its neighbors", container.Name, strings.Join(missing, " and "))
+	}
+
+	hostPaths := []string{}
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			hostPaths = append(hostPaths, volume.Name)
+		}
+	}
+	check("score-host-path", len(hostPaths) == 0,
+		"mounts hostPath volumes [ %v ], which tie pods to the state of their node", strings.Join(hostPaths, ", "))
+
+	if obj.Kind != "Deployment" {
+		return checks
+	}
+	replicas := 1
+	if obj.Spec.Replicas != nil {
+		replicas = *obj.Spec.Replicas
+	}
+	if replicas <= 1 {
+		hasPDB := false
+		for _, selector := range pdbSelectors {
+			if selects(selector, obj.Spec.Template.Metadata.Labels) {
+				hasPDB = true
+			}
+		}
+		check("score-pdb", hasPDB,
+			"has a single replica and no PodDisruptionBudget, so node drains take it down without warning")
+	} else {
+		check("score-anti-affinity", spec.Affinity.PodAntiAffinity != nil || len(spec.TopologySpreadConstraints) > 0,
+			"has %v replicas but no podAntiAffinity or topologySpreadConstraints, so they may all land on the same node", replicas)
+	}
+	return checks
+}
+
+// Score runs best-practice checks on the Deployments, StatefulSets and
+// DaemonSets in helmOutput: that containers have readiness and liveness
+// probes and resource requests and limits, that they don't mount hostPath
+// volumes, that single replica Deployments have a PodDisruptionBudget, and
+// that Deployments with more replicas spread them across nodes.
+func Score(helmOutput string) ([]ScoreCheck, error) {
+	objects := []scoreObject{}
+	pdbSelectors := []map[string]string{}
+	docs := util.NewYAMLDocuments(helmOutput)
+	for {
+		obj := scoreObject{}
+		if !docs.Next(&obj) {
+			break
+		}
+		switch obj.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet":
+			objects = append(objects, obj)
+		case "PodDisruptionBudget":
+			pdbSelectors = append(pdbSelectors, obj.Spec.Selector.MatchLabels)
+		}
+	}
+	if err := docs.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to parse templated output to score it: %v", err)
+	}
+
+	checks := []ScoreCheck{}
+	for _, obj := range objects {
+		checks = append(checks, scoreWorkload(obj, pdbSelectors)...)
+	}
+	return checks, nil
+}
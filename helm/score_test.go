@@ -0,0 +1,99 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+const scoreTestOutput = `
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        readinessProbe:
+          httpGet:
+            path: /health
+            port: 8080
+        livenessProbe:
+          httpGet:
+            path: /health
+            port: 8080
+        resources:
+          requests:
+            cpu: 100m
+            memory: 128Mi
+          limits:
+            memory: 128Mi
+---
+# Source: web/templates/pdb.yaml
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+---
+# Source: web/templates/worker.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: worker
+      volumes:
+      - name: docker
+        hostPath:
+          path: /var/run/docker.sock
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+func TestScore(t *testing.T) {
+	checks, err := Score(scoreTestOutput)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	failed := map[string][]string{}
+	passed := map[string]int{}
+	for _, check := range checks {
+		if check.Err != nil {
+			failed[check.Name] = append(failed[check.Name], check.Rule)
+		} else {
+			passed[check.Name]++
+		}
+	}
+
+	expected := map[string][]string{
+		"web": {"score-resource-limits"},
+		"worker": {"score-readiness-probe", "score-liveness-probe", "score-resource-requests", "score-resource-limits",
+			"score-host-path", "score-anti-affinity"},
+	}
+	if !reflect.DeepEqual(failed, expected) {
+		t.Logf("expected failed checks %v but got %v", expected, failed)
+		t.Fail()
+	}
+	if passed["web"] != 5 || passed["worker"] != 0 {
+		t.Logf("expected 5 checks to pass for web and none for worker but got %v", passed)
+		t.Fail()
+	}
+}
@@ -0,0 +1,233 @@
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// valuesLayer is one source of values for a chart, named for where it came from.
+type valuesLayer struct {
+	Name   string
+	Values map[string]interface{}
+}
+
+// ValuesMergeStep is a value set while merging a chart's values, and the source that set it.
+type ValuesMergeStep struct {
+	Path   string
+	Source string
+	How    string
+}
+
+func chartMerger(chart ankh.Chart) (util.ValuesMerger, error) {
+	for path, strategy := range chart.MergeStrategies {
+		if err := util.ValidateMergeStrategy(strategy); err != nil {
+			return util.ValuesMerger{}, fmt.Errorf("Invalid `merge-strategies` for key '%v' of chart %v: %v", path, chart.Name, err)
+		}
+	}
+	return util.ValuesMerger{Strategies: chart.MergeStrategies}, nil
+}
+
+func readValuesFile(path string) (map[string]interface{}, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fileValues := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(body, &fileValues); err != nil {
+		return nil, fmt.Errorf("Unable to parse values file '%v': %v", path, err)
+	}
+	values, _ := util.NormalizeYAMLMap(fileValues).(map[string]interface{})
+	return values, nil
+}
+
+// helmValuesLayers reads the chart's own values.yaml, and then valuesFiles.
+func helmValuesLayers(files ankh.ChartFiles, valuesFiles []valuesFile) ([]valuesLayer, error) {
+	layers := []valuesLayer{}
+	if values, err := readValuesFile(files.ValuesPath); err == nil {
+		layers = append(layers, valuesLayer{"values.yaml in the chart", values})
+	}
+	for _, f := range valuesFiles {
+		values, err := readValuesFile(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, valuesLayer{f.Name, values})
+	}
+	return layers, nil
+}
+
+// mergeValuesFiles merges the chart's values.yaml and valuesFiles using the
+// chart's merge strategies, writing the result to a single file for helm.
+func mergeValuesFiles(chart ankh.Chart, files ankh.ChartFiles, valuesFiles []valuesFile) (string, error) {
+	merger, err := chartMerger(chart)
+	if err != nil {
+		return "", err
+	}
+	layers, err := helmValuesLayers(files, valuesFiles)
+	if err != nil {
+		return "", err
+	}
+	values := make(map[string]interface{})
+	for _, layer := range layers {
+		values = merger.Merge(values, layer.Values)
+	}
+
+	mergedPath := filepath.Join(files.Dir, "merged-values.yaml")
+	body, err := yaml.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return mergedPath, ioutil.WriteFile(mergedPath, body, 0644)
+}
+
+// ankhValuesLayers are the values for chart from the Ankh file and the
+// current context, in the same order of precedence that `templateChart`
+// passes them to helm.
+func ankhValuesLayers(ctx *ankh.ExecutionContext, chart ankh.Chart) ([]valuesLayer, error) {
+	currentContext := ctx.AnkhConfig.CurrentContext
+	layers := []valuesLayer{}
+
+	add := func(name string, v interface{}) {
+		if normalized, ok := util.NormalizeYAMLMap(v).(map[string]interface{}); ok {
+			layers = append(layers, valuesLayer{name, normalized})
+		}
+	}
+
+	if chart.DefaultValues != nil {
+		add("default-values", chart.DefaultValues)
+	}
+
+	regexValues := []struct {
+		field string
+		slice yaml.MapSlice
+		key   string
+	}{
+		{"values", chart.Values, currentContext.EnvironmentClass},
+		{"resource-profiles", chart.ResourceProfiles, currentContext.ResourceProfile},
+		{"releases", chart.Releases, currentContext.Release},
+	}
+	for _, r := range regexValues {
+		if r.slice == nil {
+			continue
+		}
+		v, err := util.MapSliceRegexMatch(r.slice, r.key)
+		if err != nil {
+			return layers, fmt.Errorf("Failed to load `%v` for chart %v: %v", r.field, chart.Name, err)
+		}
+		if v != nil {
+			add(r.field, v)
+		}
+	}
+
+	if currentContext.Global != nil {
+		add("global", map[string]interface{}{"global": currentContext.Global})
+	}
+	return layers, nil
+}
+
+// setValuesLayer is the `--set` values and the chart's tag, which take precedence over every other source.
+func setValuesLayer(ctx *ankh.ExecutionContext, chart ankh.Chart) valuesLayer {
+	values := make(map[string]interface{})
+	keys := []string{}
+	for key := range ctx.HelmSetValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		util.SetValue(values, key, ctx.HelmSetValues[key])
+	}
+
+	// The chart's tag is set last, like `templateChart` does, since it may have been reformatted from a `--set` value.
+	tagValueName := ctx.AnkhConfig.Helm.TagValueName
+	if chart.TagValueName != "" {
+		tagValueName = chart.TagValueName
+	}
+	if tagValueName != "" && chart.Tag != "" {
+		util.SetValue(values, tagValueName, chart.Tag)
+	}
+	return valuesLayer{"--set", values}
+}
+
+// chartValues merges every source of values for a chart of plain manifests.
+func chartValues(ctx *ankh.ExecutionContext, chart ankh.Chart) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	merger, err := chartMerger(chart)
+	if err != nil {
+		return values, err
+	}
+	layers, err := ankhValuesLayers(ctx, chart)
+	if err != nil {
+		return values, err
+	}
+	for _, layer := range append(layers, setValuesLayer(ctx, chart)) {
+		values = merger.Merge(values, layer.Values)
+	}
+	return values, nil
+}
+
+// ExplainValues merges every source of values for chart the same way that
+// templating it does, returning the merged values, and each value that each
+// source set along the way.
+func ExplainValues(ctx *ankh.ExecutionContext, chart ankh.Chart) (map[string]interface{}, []ValuesMergeStep, error) {
+	var layers []valuesLayer
+	if chart.IsManifests() {
+		ankhLayers, err := ankhValuesLayers(ctx, chart)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = ankhLayers
+	} else {
+		files, err := findChartFiles(ctx, chart)
+		if err != nil {
+			return nil, nil, err
+		}
+		valuesFiles, err := prepareValuesFiles(ctx, chart, files)
+		if err != nil {
+			return nil, nil, err
+		}
+		if layers, err = helmValuesLayers(files, valuesFiles); err != nil {
+			return nil, nil, err
+		}
+	}
+	layers = append(layers, setValuesLayer(ctx, chart))
+
+	merger, err := chartMerger(chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	steps := []ValuesMergeStep{}
+	values := make(map[string]interface{})
+	for _, layer := range layers {
+		source := layer.Name
+		merger.Explain = func(path string, how string) {
+			steps = append(steps, ValuesMergeStep{Path: path, Source: source, How: how})
+		}
+		values = merger.Merge(values, layer.Values)
+	}
+	return values, steps, nil
+}
+
+// ChartDefaultValues reads the default values.yaml of the version of chart
+// that's templated. Charts of plain manifests don't have one.
+func ChartDefaultValues(ctx *ankh.ExecutionContext, chart ankh.Chart) (map[string]interface{}, error) {
+	if chart.IsManifests() {
+		return nil, fmt.Errorf("Chart %v is made of plain manifests, which have no default values.yaml", chart.Name)
+	}
+	files, err := findChartFiles(ctx, chart)
+	if err != nil {
+		return nil, err
+	}
+	values, err := readValuesFile(files.ValuesPath)
+	if os.IsNotExist(err) {
+		return make(map[string]interface{}), nil
+	}
+	return values, err
+}
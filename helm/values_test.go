@@ -0,0 +1,126 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestMergeValuesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-values")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, body string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		return path
+	}
+	files := ankh.ChartFiles{Dir: dir, ValuesPath: write("chart-values.yaml", "env:\n- name: CHART\ntolerations:\n- key: chart\n")}
+	valuesFiles := []valuesFile{
+		{"default-values", write("default-values.yaml", "env:\n- name: DEFAULT\ntolerations:\n- key: default\n")},
+		{"values", write("values.yaml", "env:\n- name: VALUES\n")},
+	}
+
+	chart := ankh.Chart{Name: "web", MergeStrategies: map[string]string{"env": "append"}}
+	mergedPath, err := mergeValuesFiles(chart, files, valuesFiles)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadFile(mergedPath)
+	merged := struct {
+		Env []struct {
+			Name string
+		}
+		Tolerations []struct {
+			Key string
+		}
+	}{}
+	if err := yaml.Unmarshal(body, &merged); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(merged.Env) != 3 || merged.Env[0].Name != "CHART" || merged.Env[2].Name != "VALUES" ||
+		len(merged.Tolerations) != 1 || merged.Tolerations[0].Key != "default" {
+		t.Logf("expected env to be appended and tolerations replaced but got:\n%s", body)
+		t.Fail()
+	}
+
+	chart.MergeStrategies = map[string]string{"env": "concatenate"}
+	if _, err := mergeValuesFiles(chart, files, valuesFiles); err == nil {
+		t.Log("expected an error for an invalid merge strategy")
+		t.Fail()
+	}
+}
+
+func TestExplainValues(t *testing.T) {
+	ctx := newManifestsContext()
+	chart := ankh.Chart{
+		Name:            "test-app",
+		Manifests:       []string{"testdata/manifests"},
+		MergeStrategies: map[string]string{"containers": "merge-by-key:name"},
+		DefaultValues: map[string]interface{}{
+			"containers": []interface{}{map[interface{}]interface{}{"name": "web", "image": "web:1"}},
+		},
+		Values: yaml.MapSlice{
+			yaml.MapItem{Key: "dev", Value: map[interface{}]interface{}{
+				"containers": []interface{}{map[interface{}]interface{}{"name": "web", "image": "web:2"}},
+			}},
+		},
+	}
+
+	values, steps, err := ExplainValues(ctx, chart)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	containers, _ := values["containers"].([]interface{})
+	if len(containers) != 1 || containers[0].(map[string]interface{})["image"] != "web:2" {
+		t.Logf("expected containers to be merged by name but got %+v", values)
+		t.Fail()
+	}
+
+	expected := []ValuesMergeStep{
+		{"containers", "default-values", "set"},
+		{"containers[name=web].image", "values", "replaced"},
+		{"containers", "values", "merged 1 items by name, and appended 0"},
+		{"port", "--set", "set"},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Logf("expected steps %+v but got %+v", expected, steps)
+		t.Fail()
+	}
+}
+
+func TestChartDefaultValues(t *testing.T) {
+	ctx := newManifestsContext()
+	defer os.RemoveAll(ctx.DataDir)
+
+	values, err := ChartDefaultValues(ctx, ankh.Chart{Name: "test-app", Path: "testdata"})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if values["host"] != "localhost" || values["port"] != 8080 {
+		t.Logf("expected the chart's values.yaml but got %+v", values)
+		t.Fail()
+	}
+
+	if _, err := ChartDefaultValues(ctx, ankh.Chart{Name: "test-app", Manifests: []string{"testdata/manifests"}}); err == nil {
+		t.Log("expected an error for a chart of plain manifests")
+		t.Fail()
+	}
+}
@@ -0,0 +1,64 @@
+// Package keyring stores registry credentials in the operating system's
+// keyring: the macOS Keychain, the Secret Service on Linux, or the Windows
+// Credential Manager.
+package keyring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const service = "ankh"
+
+// ErrNotFound is returned when no credentials are stored for a key.
+var ErrNotFound = errors.New("Credentials not found in keyring")
+
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// HelmRegistryKey is the keyring key for a helm registry's credentials.
+func HelmRegistryKey(registry string) string {
+	return "helm:" + registry
+}
+
+// DockerRegistryKey is the keyring key for a docker registry's credentials.
+func DockerRegistryKey(registry string) string {
+	return "docker:" + registry
+}
+
+func encode(creds Credentials) (string, error) {
+	out, err := json.Marshal(creds)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func decode(secret string) (Credentials, error) {
+	creds := Credentials{}
+	if err := json.Unmarshal([]byte(secret), &creds); err != nil {
+		return creds, fmt.Errorf("Unable to decode credentials from keyring: %v", err)
+	}
+	return creds, nil
+}
+
+// Set stores credentials for a key, replacing any that already exist.
+func Set(key string, creds Credentials) error {
+	secret, err := encode(creds)
+	if err != nil {
+		return err
+	}
+	return set(key, secret)
+}
+
+// Get returns the credentials stored for a key, or ErrNotFound.
+func Get(key string) (Credentials, error) {
+	secret, err := get(key)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return decode(secret)
+}
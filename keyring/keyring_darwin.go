@@ -0,0 +1,74 @@
+package keyring
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// The macOS Keychain is driven by the `security` tool that ships with the OS.
+// Secrets are passed to it on stdin, in its interactive mode, rather than as
+// arguments, which any user can see in the process list. They're base64
+// encoded, so that they need no quoting, and so that the Keychain doesn't hex
+// encode them.
+
+const base64Prefix = "go-base64:"
+
+// securityMaxLine is the longest command that `security -i` reads.
+const securityMaxLine = 4096
+
+// quote single quotes s for `security -i`, which splits commands like a shell.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// addCommand is the `security -i` command that stores secret for key.
+func addCommand(key string, secret string) (string, error) {
+	command := fmt.Sprintf("add-generic-password -U -s %v -a %v -l %v -w %v\n", quote(service), quote(key),
+		quote(fmt.Sprintf("%v (%v)", service, key)), quote(base64Prefix+base64.StdEncoding.EncodeToString([]byte(secret))))
+	if len(command) > securityMaxLine {
+		return "", fmt.Errorf("Unable to store credentials in the macOS Keychain: they're longer than `security` accepts")
+	}
+	return command, nil
+}
+
+func set(key string, secret string) error {
+	command, err := addCommand(key, secret)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(command)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Unable to store credentials in the macOS Keychain: %v: %s", err, out)
+	}
+	// `security -i` doesn't exit non-zero when one of its commands fails, so
+	// check that the secret was stored.
+	if stored, err := get(key); err != nil || stored != secret {
+		return fmt.Errorf("Unable to store credentials in the macOS Keychain: %s", out)
+	}
+	return nil
+}
+
+func get(key string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", key, "-w").Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok && exitError.Sys().(syscall.WaitStatus).ExitStatus() == 44 {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("Unable to read credentials from the macOS Keychain: %v", err)
+	}
+	secret := strings.TrimSuffix(string(out), "\n")
+	if !strings.HasPrefix(secret, base64Prefix) {
+		// Stored before secrets were encoded.
+		return secret, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, base64Prefix))
+	if err != nil {
+		return "", fmt.Errorf("Unable to decode credentials from the macOS Keychain: %v", err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,21 @@
+package keyring
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddCommand(t *testing.T) {
+	command, err := addCommand("helm:it's.example.com", `{"username":"deployer","password":"p@ss word"}`)
+	expected := `add-generic-password -U -s 'ankh' -a 'helm:it'"'"'s.example.com' -l 'ankh (helm:it'"'"'s.example.com)' ` +
+		`-w 'go-base64:eyJ1c2VybmFtZSI6ImRlcGxveWVyIiwicGFzc3dvcmQiOiJwQHNzIHdvcmQifQ=='` + "\n"
+	if err != nil || command != expected {
+		t.Logf("expected '%v' but got '%v' (%v)", expected, command, err)
+		t.Fail()
+	}
+
+	if _, err := addCommand("helm:example.com", strings.Repeat("x", securityMaxLine)); err == nil {
+		t.Log("expected to find an error but didnt get one")
+		t.Fail()
+	}
+}
@@ -0,0 +1,39 @@
+package keyring
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service (eg: GNOME Keyring, KWallet) is driven by `secret-tool`, from libsecret.
+
+func set(key string, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", fmt.Sprintf("%v (%v)", service, key),
+		"service", service, "account", key)
+	cmd.Stdin = strings.NewReader(secret)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Unable to store credentials using `secret-tool`, which requires libsecret and a running Secret Service: %v: %s", err, out)
+	}
+	return nil
+}
+
+func get(key string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", key).Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok && len(exitError.Stderr) == 0 {
+			// secret-tool exits non-zero, silently, when nothing matches.
+			return "", ErrNotFound
+		}
+		if execError, ok := err.(*exec.Error); ok && execError.Err == exec.ErrNotFound {
+			// Without libsecret there's no keyring, so there are no credentials in it.
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("Unable to read credentials using `secret-tool`: %v", err)
+	}
+	if len(out) == 0 {
+		return "", ErrNotFound
+	}
+	return string(out), nil
+}
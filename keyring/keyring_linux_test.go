@@ -0,0 +1,23 @@
+package keyring
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestGetWithoutSecretTool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-keyring")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	if _, err := get("helm:example.com"); err != ErrNotFound {
+		t.Logf("expected ErrNotFound without secret-tool but got %v", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,16 @@
+// +build !darwin,!linux,!windows
+
+package keyring
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func set(key string, secret string) error {
+	return fmt.Errorf("Storing credentials in a keyring is not supported on %v", runtime.GOOS)
+}
+
+func get(key string) (string, error) {
+	return "", ErrNotFound
+}
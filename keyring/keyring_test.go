@@ -0,0 +1,20 @@
+package keyring
+
+import (
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	creds := Credentials{Username: "deployer", Password: "p@ss:word\n"}
+	secret, err := encode(creds)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	decoded, err := decode(secret)
+	if err != nil || decoded != creds {
+		t.Logf("expected %+v but got %+v (%v)", creds, decoded, err)
+		t.Fail()
+	}
+}
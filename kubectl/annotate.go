@@ -0,0 +1,20 @@
+package kubectl
+
+import (
+	"github.com/appnexus/ankh/context"
+)
+
+// ActorAnnotation records who last applied an object with Ankh.
+const ActorAnnotation = "ankh.appnexus.com/actor"
+
+// AnnotateActor annotates the objects in input with ctx.Actor. It uses
+// `kubectl annotate` rather than changing what's applied, so that the
+// annotation isn't recorded as part of the last applied configuration,
+// and doesn't show up as drift.
+func AnnotateActor(ctx *ankh.ExecutionContext, namespace string, input string) error {
+	if len(ObjectDocuments(input, namespace)) == 0 {
+		return nil
+	}
+	_, err := runKubectl(ctx, namespace, []byte(input), "annotate", "--overwrite", "-f", "-", ActorAnnotation+"="+ctx.Actor)
+	return err
+}
@@ -0,0 +1,178 @@
+package kubectl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// Snapshot is what was last applied to the objects of an apply that already
+// existed, taken before the apply so that it can be reverted.
+type Snapshot struct {
+	Namespace string
+	// Manifest is a List of what was last applied to each existing object, as JSON.
+	Manifest []byte
+	// Existing is lowercase `kind/namespace/name`, like ObjectDocuments, for
+	// each object that already existed.
+	Existing []string
+	// Unrestorable is lowercase `kind/namespace/name` for each existing
+	// object that wasn't created by `kubectl apply`, so can't be restored.
+	Unrestorable []string
+	// Unknown is lowercase `kind/namespace/name` for each object whose kind
+	// the API server didn't know, eg: a custom resource whose CRD is created by the
+	// same apply, so it can't have existed.
+	Unknown []string
+}
+
+// unknownKindRegexp matches kubectl's error for an object whose kind the
+// API server doesn't know, capturing the kind and its apiVersion.
+var unknownKindRegexp = regexp.MustCompile(`no matches for kind "([^"]+)" in version "([^"]*)"`)
+
+// unknownResourceRegexp matches kubectl's error when deleting an object
+// whose kind the API server doesn't know.
+var unknownResourceRegexp = regexp.MustCompile(`the server doesn't have a resource type`)
+
+// unknownKinds returns `apiVersion/kind` for each kind that err says the API server doesn't know.
+func unknownKinds(err error) map[string]bool {
+	kinds := make(map[string]bool)
+	for _, match := range unknownKindRegexp.FindAllStringSubmatch(err.Error(), -1) {
+		kinds[match[2]+"/"+match[1]] = true
+	}
+	return kinds
+}
+
+// withoutKinds removes the objects whose `apiVersion/kind` is one of kinds
+// from input, returning what's left and lowercase `kind/namespace/name` for
+// each object removed, where objects that don't set a namespace are in
+// namespace.
+func withoutKinds(input string, namespace string, kinds map[string]bool) (string, []string) {
+	kept, removed := []string{}, []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := struct {
+			APIVersion string `yaml:"apiVersion"`
+			objectRef  `yaml:",inline"`
+		}{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err == nil && obj.Kind != "" && kinds[obj.APIVersion+"/"+obj.Kind] {
+			removed = append(removed, obj.key(namespace))
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	return strings.Join(kept, "\n---"), removed
+}
+
+// parseSnapshot builds a Snapshot from the output of `kubectl get -o json`.
+func parseSnapshot(output []byte, namespace string) (Snapshot, error) {
+	snapshot := Snapshot{Namespace: namespace, Existing: []string{}, Unrestorable: []string{}}
+	objects, err := parseLiveObjects(output)
+	if err != nil {
+		return snapshot, err
+	}
+	for _, obj := range objects {
+		ns := obj.Metadata.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		key := ObjectKey(strings.ToLower(obj.Kind+"/"+obj.Metadata.Name), ns)
+		snapshot.Existing = append(snapshot.Existing, key)
+		if _, ok := obj.Metadata.Annotations[lastAppliedAnnotation]; !ok {
+			snapshot.Unrestorable = append(snapshot.Unrestorable, key)
+		}
+	}
+	sort.Strings(snapshot.Existing)
+	sort.Strings(snapshot.Unrestorable)
+	snapshot.Manifest, _, err = lastAppliedList(objects)
+	return snapshot, err
+}
+
+// TakeSnapshot records the live state of the objects in input, before
+// they're applied. Objects whose kinds the API server doesn't know yet, since
+// their CRDs are in input too, are left out of the snapshot, and recorded as
+// Unknown, so that they're deleted if the apply is reverted.
+func TakeSnapshot(ctx *ankh.ExecutionContext, namespace string, input string) (Snapshot, error) {
+	unknown := []string{}
+	for len(EventObjects(input)) > 0 {
+		out, err := runKubectl(ctx, namespace, []byte(input), "get", "-f", "-", "-o", "json", "--ignore-not-found")
+		if err == nil {
+			snapshot, err := parseSnapshot(out, namespace)
+			snapshot.Unknown = unknown
+			return snapshot, err
+		}
+		var removed []string
+		input, removed = withoutKinds(input, namespace, unknownKinds(err))
+		if len(removed) == 0 {
+			return Snapshot{}, fmt.Errorf("Unable to snapshot objects in namespace \"%v\": %v", namespace, err)
+		}
+		ctx.Logger.Debugf("Objects [ %v ] in namespace \"%v\" are of kinds the API server doesn't know yet, so they're treated as new",
+			strings.Join(removed, ", "), namespace)
+		unknown = append(unknown, removed...)
+	}
+	snapshot, err := parseSnapshot(nil, namespace)
+	snapshot.Unknown = unknown
+	return snapshot, err
+}
+
+// CreatedObjects returns lowercase `kind/namespace/name` for each object in
+// input that didn't exist when snapshot was taken.
+func CreatedObjects(snapshot Snapshot, input string) []string {
+	existing := make(map[string]bool)
+	for _, object := range snapshot.Existing {
+		existing[object] = true
+	}
+	created := []string{}
+	for object := range ObjectDocuments(input, snapshot.Namespace) {
+		if !existing[object] {
+			created = append(created, object)
+		}
+	}
+	sort.Strings(created)
+	return created
+}
+
+// RestoreSnapshot reverts an apply of input: it applies what was last
+// applied to each object that existed before, and deletes those it created.
+func RestoreSnapshot(ctx *ankh.ExecutionContext, snapshot Snapshot, input string) error {
+	if len(snapshot.Existing) > len(snapshot.Unrestorable) {
+		if _, err := runKubectl(ctx, snapshot.Namespace, snapshot.Manifest, "apply", "-f", "-"); err != nil {
+			return fmt.Errorf("Unable to restore objects in namespace \"%v\": %v", snapshot.Namespace, err)
+		}
+	}
+	// Objects of unknown kinds are deleted one at a time, before their CRDs
+	// are, since their kinds are still unknown if the apply failed before
+	// creating the CRDs.
+	unknown := make(map[string]bool)
+	for _, key := range snapshot.Unknown {
+		unknown[key] = true
+		object, namespace := SplitObjectKey(key)
+		if _, err := runKubectl(ctx, namespace, nil, "delete", "--ignore-not-found", object); err != nil && !unknownResourceRegexp.MatchString(err.Error()) {
+			return fmt.Errorf("Unable to delete created object %v in namespace \"%v\": %v", object, namespace, err)
+		}
+	}
+	// The other created objects are deleted together, for each namespace
+	// they're in.
+	created := make(map[string][]string)
+	namespaces := []string{}
+	for _, key := range CreatedObjects(snapshot, input) {
+		if unknown[key] {
+			continue
+		}
+		object, namespace := SplitObjectKey(key)
+		if _, ok := created[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
+		}
+		created[namespace] = append(created[namespace], object)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		args := append([]string{"delete", "--ignore-not-found"}, created[namespace]...)
+		if _, err := runKubectl(ctx, namespace, nil, args...); err != nil {
+			return fmt.Errorf("Unable to delete created objects [ %v ] in namespace \"%v\": %v", strings.Join(created[namespace], ", "), namespace, err)
+		}
+	}
+	return nil
+}
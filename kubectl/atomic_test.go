@@ -0,0 +1,154 @@
+package kubectl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestParseSnapshot(t *testing.T) {
+	output := []byte(`{"kind": "List", "items": [
+  {"kind": "Deployment", "metadata": {"name": "web", "annotations": {"kubectl.kubernetes.io/last-applied-configuration": "{\"kind\":\"Deployment\",\"metadata\":{\"name\":\"web\"}}"}}},
+  {"kind": "ConfigMap", "metadata": {"name": "web-config"}}
+]}`)
+	snapshot, err := parseSnapshot(output, "team")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if expected := []string{"configmap/team/web-config", "deployment/team/web"}; !reflect.DeepEqual(snapshot.Existing, expected) {
+		t.Logf("expected existing objects %v but got %v", expected, snapshot.Existing)
+		t.Fail()
+	}
+	if expected := []string{"configmap/team/web-config"}; !reflect.DeepEqual(snapshot.Unrestorable, expected) {
+		t.Logf("expected unrestorable objects %v but got %v", expected, snapshot.Unrestorable)
+		t.Fail()
+	}
+	if !strings.Contains(string(snapshot.Manifest), `"items":[{"kind":"Deployment","metadata":{"name":"web"}}]`) {
+		t.Logf("expected a List of the last applied Deployment but got %s", snapshot.Manifest)
+		t.Fail()
+	}
+
+	if created := CreatedObjects(snapshot, getTestInput); !reflect.DeepEqual(created, []string{"service/team/web"}) {
+		t.Logf("expected the Service to have been created but got %v", created)
+		t.Fail()
+	}
+
+	snapshot, err = parseSnapshot([]byte(""), "team")
+	if err != nil || len(snapshot.Existing) != 0 {
+		t.Logf("expected an empty snapshot but got %+v, %v", snapshot, err)
+		t.Fail()
+	}
+}
+
+func TestWithoutUnknownKinds(t *testing.T) {
+	input := `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web`
+	err := errors.New(`exit status 1 -- the kubectl process had the following output on stderr:
+error: unable to recognize "STDIN": no matches for kind "Widget" in version "example.com/v1"`)
+	kinds := unknownKinds(err)
+	if !reflect.DeepEqual(kinds, map[string]bool{"example.com/v1/Widget": true}) {
+		t.Logf("expected the Widget kind to be unknown but got %v", kinds)
+		t.FailNow()
+	}
+
+	output, removed := withoutKinds(input, "team", kinds)
+	if !reflect.DeepEqual(removed, []string{"widget/team/web"}) {
+		t.Logf("expected the Widget to be removed but got %v", removed)
+		t.Fail()
+	}
+	if strings.Contains(output, "Widget") || !strings.Contains(output, "kind: Service") || !strings.Contains(output, "kind: CustomResourceDefinition") {
+		t.Logf("expected only the Widget to be removed but got %v", output)
+		t.Fail()
+	}
+
+	snapshot := Snapshot{Namespace: "team", Existing: []string{"service/team/web"}, Unknown: removed}
+	if created := CreatedObjects(snapshot, input); !reflect.DeepEqual(created, []string{"customresourcedefinition/team/widgets.example.com", "widget/team/web"}) {
+		t.Logf("expected the CRD and the Widget to have been created but got %v", created)
+		t.Fail()
+	}
+
+	if kinds := unknownKinds(errors.New("connection refused")); len(kinds) != 0 {
+		t.Logf("expected no unknown kinds but got %v", kinds)
+		t.Fail()
+	}
+}
+
+func TestRestoreSnapshotAcrossNamespaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-atomic")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for kubectl, recording the arguments of each call.
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$*\" >> " + calls + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// A Service named web exists in namespace team, but not in namespace
+	// other, so the one in other was created by the apply.
+	input := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: other
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: web
+  namespace: other`
+	snapshot := Snapshot{Namespace: "team", Existing: []string{"service/team/web"}, Unrestorable: []string{"service/team/web"}, Unknown: []string{"widget/other/web"}}
+	if created := CreatedObjects(snapshot, input); !reflect.DeepEqual(created, []string{"service/other/web", "widget/other/web"}) {
+		t.Logf("expected the Service and Widget in namespace other to have been created but got %v", created)
+		t.Fail()
+	}
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.CurrentContext = ankh.Context{KubeContext: "dev"}
+	if err := RestoreSnapshot(ctx, snapshot, input); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadFile(calls)
+	expected := "delete --ignore-not-found widget/web --context dev --namespace other\n" +
+		"delete --ignore-not-found service/web --context dev --namespace other\n"
+	if string(body) != expected {
+		t.Logf("expected the created objects to be deleted from namespace other but got:\n%v", string(body))
+		t.Fail()
+	}
+}
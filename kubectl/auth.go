@@ -0,0 +1,29 @@
+package kubectl
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// Authenticate makes a request to the current context's cluster with the
+// terminal attached, so that kubectl's exec credential plugin can show its
+// prompts, eg: a device code or browser login, and cache its credentials
+// for the kubectl commands that ankh runs after it.
+func Authenticate(ctx *ankh.ExecutionContext) error {
+	kubectlArgs := append([]string{"kubectl", "get", "--raw", "/version"}, kubectlConnectionArgs(ctx)...)
+	kubectlCmd := kubectlCommand(ctx, kubectlArgs[0], kubectlArgs[1:]...)
+	kubectlCmd.Stdin = os.Stdin
+	kubectlCmd.Stdout = ioutil.Discard
+	kubectlCmd.Stderr = os.Stderr
+
+	// Let the user interrupt a login they don't want to finish.
+	defer ankh.CatchSignals()()
+
+	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+	record := ctx.StartCommand(kubectlCmd)
+	err := kubectlCmd.Run()
+	err = record.Finish(err)
+	return err
+}
@@ -0,0 +1,138 @@
+package kubectl
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigChecksumAnnotation is put on the pod templates of workloads that use
+// templated ConfigMaps or Secrets, so that changing them rolls the pods.
+const ConfigChecksumAnnotation = "ankh.appnexus.com/config-checksum"
+
+func mapSlicePath(obj yaml.MapSlice, path ...string) interface{} {
+	var value interface{} = obj
+	for _, key := range path {
+		m, ok := value.(yaml.MapSlice)
+		if !ok {
+			return nil
+		}
+		value = mapSliceGet(m, key)
+	}
+	return value
+}
+
+func mapSliceString(obj interface{}, path ...string) string {
+	m, _ := obj.(yaml.MapSlice)
+	s, _ := mapSlicePath(m, path...).(string)
+	return s
+}
+
+// configRefs finds the lowercase `configmap/name` and `secret/name` of each
+// ConfigMap and Secret that a pod spec mounts, or reads environment from.
+func configRefs(podSpec yaml.MapSlice) []string {
+	refs := make(map[string]bool)
+	add := func(kind string, name string) {
+		if name != "" {
+			refs[kind+"/"+name] = true
+		}
+	}
+
+	volumes, _ := mapSliceGet(podSpec, "volumes").([]interface{})
+	for _, volume := range volumes {
+		add("configmap", mapSliceString(volume, "configMap", "name"))
+		add("secret", mapSliceString(volume, "secret", "secretName"))
+		v, _ := volume.(yaml.MapSlice)
+		sources, _ := mapSlicePath(v, "projected", "sources").([]interface{})
+		for _, source := range sources {
+			add("configmap", mapSliceString(source, "configMap", "name"))
+			add("secret", mapSliceString(source, "secret", "name"))
+		}
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := mapSliceGet(podSpec, field).([]interface{})
+		for _, container := range containers {
+			c, _ := container.(yaml.MapSlice)
+			envFrom, _ := mapSliceGet(c, "envFrom").([]interface{})
+			for _, e := range envFrom {
+				add("configmap", mapSliceString(e, "configMapRef", "name"))
+				add("secret", mapSliceString(e, "secretRef", "name"))
+			}
+			env, _ := mapSliceGet(c, "env").([]interface{})
+			for _, e := range env {
+				add("configmap", mapSliceString(e, "valueFrom", "configMapKeyRef", "name"))
+				add("secret", mapSliceString(e, "valueFrom", "secretKeyRef", "name"))
+			}
+		}
+	}
+
+	sorted := []string{}
+	for ref := range refs {
+		sorted = append(sorted, ref)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// configChecksums hashes the contents of each ConfigMap and Secret in
+// templated output, by lowercase `kind/name`.
+func configChecksums(input string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	_, err := transformObjects(input, func(kind string, obj yaml.MapSlice) (yaml.MapSlice, bool) {
+		if kind != "ConfigMap" && kind != "Secret" {
+			return obj, false
+		}
+		contents := yaml.MapSlice{}
+		for _, field := range []string{"data", "binaryData", "stringData"} {
+			contents = append(contents, yaml.MapItem{Key: field, Value: mapSliceGet(obj, field)})
+		}
+		body, _ := yaml.Marshal(contents)
+		name := mapSliceString(obj, "metadata", "name")
+		checksums[strings.ToLower(kind)+"/"+name] = fmt.Sprintf("%x", sha256.Sum256(body))
+		return obj, false
+	})
+	return checksums, err
+}
+
+// InjectConfigChecksums annotates the pod template of each workload in
+// templated output that uses ConfigMaps or Secrets that are also in it with
+// a checksum of their contents, like the `checksum/config` annotation that
+// Helm recommends. Changing only a ConfigMap or Secret then changes the pod
+// template too, which rolls the workload's pods when it's applied.
+func InjectConfigChecksums(input string) (string, error) {
+	checksums, err := configChecksums(input)
+	if err != nil || len(checksums) == 0 {
+		return input, err
+	}
+
+	output, err := transformObjects(input, func(kind string, obj yaml.MapSlice) (yaml.MapSlice, bool) {
+		paths := podTemplatePaths[kind]
+		if len(paths) == 0 {
+			return obj, false
+		}
+		path := paths[len(paths)-1]
+		podSpec, _ := mapSlicePath(obj, append(append([]string{}, path...), "spec")...).(yaml.MapSlice)
+
+		hash := sha256.New()
+		used := false
+		for _, ref := range configRefs(podSpec) {
+			if checksum, ok := checksums[ref]; ok {
+				fmt.Fprintf(hash, "%v=%v\n", ref, checksum)
+				used = true
+			}
+		}
+		if !used {
+			return obj, false
+		}
+		annotations := map[string]string{ConfigChecksumAnnotation: fmt.Sprintf("%x", hash.Sum(nil))}
+		return injectMetadataAt(obj, path, nil, annotations), true
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to add config checksums: %v", err)
+	}
+	return output, nil
+}
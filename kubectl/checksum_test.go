@@ -0,0 +1,95 @@
+package kubectl
+
+import (
+	"strings"
+	"testing"
+)
+
+const checksumTestInput = `---
+# Source: web/templates/config.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  LOG_LEVEL: info
+---
+# Source: web/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web
+stringData:
+  password: hunter2
+---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        envFrom:
+        - configMapRef:
+            name: web
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: web
+              key: password
+---
+# Source: web/templates/worker.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    spec:
+      containers:
+      - name: worker
+        envFrom:
+        - configMapRef:
+            name: external
+`
+
+func TestInjectConfigChecksums(t *testing.T) {
+	output, err := InjectConfigChecksums(checksumTestInput)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	docs := ObjectDocuments(output, "test")
+	checksum := func(doc string) string {
+		for _, line := range strings.Split(doc, "\n") {
+			if strings.Contains(line, ConfigChecksumAnnotation+":") {
+				return strings.TrimSpace(strings.SplitN(line, ": ", 2)[1])
+			}
+		}
+		return ""
+	}
+
+	webChecksum := checksum(docs["deployment/test/web"])
+	if webChecksum == "" {
+		t.Logf("expected a config checksum on the web Deployment but got:\n%v", docs["deployment/test/web"])
+		t.FailNow()
+	}
+	if checksum(docs["deployment/test/worker"]) != "" || docs["deployment/test/worker"] != ObjectDocuments(checksumTestInput, "test")["deployment/test/worker"] {
+		t.Logf("expected the worker Deployment, which only uses an untemplated ConfigMap, to be unchanged")
+		t.Fail()
+	}
+
+	changed, err := InjectConfigChecksums(strings.Replace(checksumTestInput, "LOG_LEVEL: info", "LOG_LEVEL: debug", 1))
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if c := checksum(ObjectDocuments(changed, "test")["deployment/test/web"]); c == "" || c == webChecksum {
+		t.Logf("expected the checksum to change with the ConfigMap, but got '%v' and '%v'", webChecksum, c)
+		t.Fail()
+	}
+}
@@ -0,0 +1,185 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// defaultRevisionHistoryLimit is the `revisionHistoryLimit` of Deployments that don't set one.
+const defaultRevisionHistoryLimit = 10
+
+type cleanupObject struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Labels          map[string]string `json:"labels"`
+		Annotations     map[string]string `json:"annotations"`
+		OwnerReferences []struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		Succeeded      int    `json:"succeeded"`
+		CompletionTime string `json:"completionTime"`
+	} `json:"status"`
+}
+
+// labeledWithChart is true when labels has a `helm.sh/chart` or `chart`
+// label of chart at some version, eg: `web-1.2.3` for chart `web`, but not
+// `web-api-1.2.3`.
+func labeledWithChart(labels map[string]string, chart string) bool {
+	version := strings.TrimPrefix(chartLabelVersion(labels, chart), "v")
+	return version != "" && version[0] >= '0' && version[0] <= '9'
+}
+
+func parseCleanupObjects(output []byte) ([]cleanupObject, error) {
+	list := struct {
+		Items []cleanupObject `json:"items"`
+	}{}
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return list.Items, nil
+	}
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, fmt.Errorf("Unable to parse objects to clean up: %v", err)
+	}
+	return list.Items, nil
+}
+
+// parseStaleJobs finds the Jobs in output, from `kubectl get jobs -o json`,
+// that are labeled with one of charts and succeeded before cutoff. Jobs that
+// are still templated in input are kept, since deleting them would make the
+// next apply run them again.
+func parseStaleJobs(output []byte, input string, charts []string, cutoff time.Time) ([]string, error) {
+	jobs, err := parseCleanupObjects(output)
+	if err != nil {
+		return nil, err
+	}
+	templated := objectNames(input)
+
+	stale := []string{}
+	for _, job := range jobs {
+		key := "job/" + job.Metadata.Name
+		if _, ok := templated[key]; ok || job.Status.Succeeded == 0 {
+			continue
+		}
+		completed, err := time.Parse(time.RFC3339, job.Status.CompletionTime)
+		if err != nil || !completed.Before(cutoff) {
+			continue
+		}
+		for _, chart := range charts {
+			if labeledWithChart(job.Metadata.Labels, chart) {
+				stale = append(stale, key)
+				break
+			}
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// StaleJobs finds the succeeded Jobs of charts in namespace that completed
+// longer than ttl ago.
+func StaleJobs(ctx *ankh.ExecutionContext, input string, namespace string, charts []string, ttl time.Duration) ([]string, error) {
+	out, err := runKubectl(ctx, namespace, nil, "get", "jobs", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parseStaleJobs(out, input, charts, time.Now().Add(-ttl))
+}
+
+// revisionHistoryLimits maps the name of each Deployment in input to its
+// `revisionHistoryLimit`.
+func revisionHistoryLimits(input string) map[string]int {
+	limits := make(map[string]int)
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+			Spec struct {
+				RevisionHistoryLimit *int `yaml:"revisionHistoryLimit"`
+			} `yaml:"spec"`
+		}{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind != "Deployment" {
+			continue
+		}
+		limits[obj.Metadata.Name] = defaultRevisionHistoryLimit
+		if obj.Spec.RevisionHistoryLimit != nil {
+			limits[obj.Metadata.Name] = *obj.Spec.RevisionHistoryLimit
+		}
+	}
+	return limits
+}
+
+// parseExcessReplicaSets finds the old ReplicaSets in output, from `kubectl
+// get replicasets -o json`, of the Deployments in limits beyond each one's
+// `revisionHistoryLimit`, oldest revisions first to go. Old ReplicaSets are
+// those scaled to zero.
+func parseExcessReplicaSets(output []byte, limits map[string]int) ([]string, error) {
+	replicaSets, err := parseCleanupObjects(output)
+	if err != nil {
+		return nil, err
+	}
+
+	type revision struct {
+		name     string
+		revision int
+	}
+	old := make(map[string][]revision)
+	for _, rs := range replicaSets {
+		if rs.Spec.Replicas == nil || *rs.Spec.Replicas != 0 {
+			continue
+		}
+		for _, owner := range rs.Metadata.OwnerReferences {
+			if _, ok := limits[owner.Name]; ok && owner.Kind == "Deployment" {
+				n, _ := strconv.Atoi(rs.Metadata.Annotations["deployment.kubernetes.io/revision"])
+				old[owner.Name] = append(old[owner.Name], revision{rs.Metadata.Name, n})
+			}
+		}
+	}
+
+	excess := []string{}
+	for deployment, revisions := range old {
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i].revision > revisions[j].revision })
+		for i := limits[deployment]; i < len(revisions); i++ {
+			excess = append(excess, "replicaset/"+revisions[i].name)
+		}
+	}
+	sort.Strings(excess)
+	return excess, nil
+}
+
+// ExcessReplicaSets finds the old ReplicaSets of the Deployments templated in
+// input beyond their `revisionHistoryLimit`, eg: after it was lowered.
+func ExcessReplicaSets(ctx *ankh.ExecutionContext, input string, namespace string) ([]string, error) {
+	limits := revisionHistoryLimits(input)
+	if len(limits) == 0 {
+		return []string{}, nil
+	}
+	out, err := runKubectl(ctx, namespace, nil, "get", "replicasets", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parseExcessReplicaSets(out, limits)
+}
+
+// DeleteObjects deletes objects, which are `kind/name`, from namespace.
+func DeleteObjects(ctx *ankh.ExecutionContext, namespace string, objects []string) error {
+	args := append([]string{"delete", "--ignore-not-found"}, objects...)
+	if _, err := runKubectl(ctx, namespace, nil, args...); err != nil {
+		return fmt.Errorf("Unable to delete [ %v ] from namespace \"%v\": %v", strings.Join(objects, ", "), namespace, err)
+	}
+	return nil
+}
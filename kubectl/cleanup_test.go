@@ -0,0 +1,77 @@
+package kubectl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseStaleJobs(t *testing.T) {
+	output := []byte(`{"items": [
+  {"metadata": {"name": "migrate-1", "labels": {"chart": "web-1.0.0"}}, "status": {"succeeded": 1, "completionTime": "2018-01-01T00:00:00Z"}},
+  {"metadata": {"name": "migrate-2", "labels": {"chart": "web-1.1.0"}}, "status": {"succeeded": 1, "completionTime": "2018-01-02T12:00:00Z"}},
+  {"metadata": {"name": "migrate-3", "labels": {"chart": "web-1.1.0"}}, "status": {"failed": 1}},
+  {"metadata": {"name": "web"}, "status": {"succeeded": 1, "completionTime": "2018-01-01T00:00:00Z"}},
+  {"metadata": {"name": "backfill", "labels": {"chart": "web-api-1.0.0"}}, "status": {"succeeded": 1, "completionTime": "2018-01-01T00:00:00Z"}},
+  {"metadata": {"name": "seed", "labels": {"helm.sh/chart": "web-1.0.0"}}, "status": {"succeeded": 1, "completionTime": "2018-01-01T00:00:00Z"}}
+]}`)
+	input := `---
+# Source: web/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: seed
+`
+
+	cutoff, _ := time.Parse(time.RFC3339, "2018-01-02T00:00:00Z")
+	jobs, err := parseStaleJobs(output, input, []string{"web"}, cutoff)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if expected := []string{"job/migrate-1"}; !reflect.DeepEqual(jobs, expected) {
+		t.Logf("expected %v but got %v", expected, jobs)
+		t.Fail()
+	}
+}
+
+func TestParseExcessReplicaSets(t *testing.T) {
+	input := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  revisionHistoryLimit: 1
+---
+# Source: web/templates/worker.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+`
+	limits := revisionHistoryLimits(input)
+	if !reflect.DeepEqual(limits, map[string]int{"web": 1, "worker": 10}) {
+		t.Logf("got unexpected limits %v", limits)
+		t.FailNow()
+	}
+
+	output := []byte(`{"items": [
+  {"metadata": {"name": "web-a", "annotations": {"deployment.kubernetes.io/revision": "1"}, "ownerReferences": [{"kind": "Deployment", "name": "web"}]}, "spec": {"replicas": 0}},
+  {"metadata": {"name": "web-b", "annotations": {"deployment.kubernetes.io/revision": "3"}, "ownerReferences": [{"kind": "Deployment", "name": "web"}]}, "spec": {"replicas": 0}},
+  {"metadata": {"name": "web-c", "annotations": {"deployment.kubernetes.io/revision": "2"}, "ownerReferences": [{"kind": "Deployment", "name": "web"}]}, "spec": {"replicas": 0}},
+  {"metadata": {"name": "web-d", "annotations": {"deployment.kubernetes.io/revision": "4"}, "ownerReferences": [{"kind": "Deployment", "name": "web"}]}, "spec": {"replicas": 3}},
+  {"metadata": {"name": "worker-a", "annotations": {"deployment.kubernetes.io/revision": "1"}, "ownerReferences": [{"kind": "Deployment", "name": "worker"}]}, "spec": {"replicas": 0}},
+  {"metadata": {"name": "other-a", "annotations": {"deployment.kubernetes.io/revision": "1"}, "ownerReferences": [{"kind": "Deployment", "name": "other"}]}, "spec": {"replicas": 0}}
+]}`)
+	excess, err := parseExcessReplicaSets(output, limits)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if expected := []string{"replicaset/web-a", "replicaset/web-c"}; !reflect.DeepEqual(excess, expected) {
+		t.Logf("expected %v but got %v", expected, excess)
+		t.Fail()
+	}
+}
@@ -0,0 +1,129 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// lastAppliedAnnotation is where `kubectl apply` records what it last applied to an object.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// ObjectDocuments maps each object in templated output, by lowercase
+// `kind/namespace/name`, to the YAML document that templated it. Objects
+// that don't set a namespace are in namespace.
+func ObjectDocuments(input string, namespace string) map[string]string {
+	docs := make(map[string]string)
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := objectRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		docs[obj.key(namespace)] = strings.TrimPrefix(doc, "\n")
+	}
+	return docs
+}
+
+// WithoutObjects removes objects, which are lowercase `kind/namespace/name`
+// like ObjectDocuments, from templated output.
+func WithoutObjects(input string, namespace string, objects []string) string {
+	remove := make(map[string]bool)
+	for _, object := range objects {
+		remove[object] = true
+	}
+	kept := []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := objectRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err == nil && remove[obj.key(namespace)] {
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	return strings.Join(kept, "\n---")
+}
+
+type lastAppliedObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// parseLiveObjects reads the objects in output, from `kubectl get -o json`,
+// which is a List, or a single object when getting just one.
+func parseLiveObjects(output []byte) ([]lastAppliedObject, error) {
+	list := struct {
+		Kind  string              `json:"kind"`
+		Items []lastAppliedObject `json:"items"`
+	}{}
+	if len(strings.TrimSpace(string(output))) > 0 {
+		if err := json.Unmarshal(output, &list); err != nil {
+			return nil, fmt.Errorf("Unable to parse live objects: %v", err)
+		}
+	}
+	if list.Kind != "" && list.Kind != "List" {
+		item := lastAppliedObject{}
+		if err := json.Unmarshal(output, &item); err != nil {
+			return nil, fmt.Errorf("Unable to parse live objects: %v", err)
+		}
+		list.Items = []lastAppliedObject{item}
+	}
+	return list.Items, nil
+}
+
+// lastAppliedList builds a List of what was last applied to each of objects that has it recorded.
+func lastAppliedList(objects []lastAppliedObject) ([]byte, int, error) {
+	items := []json.RawMessage{}
+	for _, item := range objects {
+		if lastApplied, ok := item.Metadata.Annotations[lastAppliedAnnotation]; ok {
+			items = append(items, json.RawMessage(lastApplied))
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items})
+	return body, len(items), err
+}
+
+// parseLastApplied builds a List of what was last applied to each of the
+// objects in output, from `kubectl get -o json`, that has it recorded.
+func parseLastApplied(output []byte) ([]byte, int, error) {
+	objects, err := parseLiveObjects(output)
+	if err != nil {
+		return nil, 0, err
+	}
+	return lastAppliedList(objects)
+}
+
+// HandEdits finds which of objects, which are lowercase `kind/name`, were
+// edited by hand since they were last applied, by diffing what was last
+// applied to them against their live state.
+func HandEdits(ctx *ankh.ExecutionContext, namespace string, objects []string) ([]string, error) {
+	if len(objects) == 0 {
+		return []string{}, nil
+	}
+	args := append([]string{"get", "-o", "json", "--ignore-not-found"}, objects...)
+	out, err := runKubectl(ctx, namespace, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	lastApplied, n, err := parseLastApplied(out)
+	if err != nil || n == 0 {
+		return []string{}, err
+	}
+
+	_, edited, err := Drift(ctx, string(lastApplied), namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range edited {
+		edited[i] = strings.ToLower(edited[i])
+	}
+	sort.Strings(edited)
+	return edited, nil
+}
@@ -0,0 +1,49 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWithoutObjects(t *testing.T) {
+	docs := ObjectDocuments(getTestInput, "test")
+	if _, ok := docs["deployment/test/web"]; !ok || len(docs) != 2 {
+		t.Logf("got unexpected documents %v", docs)
+		t.FailNow()
+	}
+
+	output := WithoutObjects(getTestInput, "test", []string{"deployment/test/web"})
+	if strings.Contains(output, "kind: Deployment") || !strings.Contains(output, "kind: Service") {
+		t.Logf("expected only the Deployment to be removed but got:\n%v", output)
+		t.Fail()
+	}
+}
+
+func TestParseLastApplied(t *testing.T) {
+	output := []byte(`{"kind": "List", "items": [
+  {"metadata": {"name": "web", "annotations": {"kubectl.kubernetes.io/last-applied-configuration": "{\"apiVersion\":\"apps/v1\",\"kind\":\"Deployment\",\"metadata\":{\"name\":\"web\"}}"}}},
+  {"metadata": {"name": "created-by-hand"}}
+]}`)
+	body, n, err := parseLastApplied(output)
+	if err != nil || n != 1 {
+		t.Logf("expected one last applied object but got %v, %v", n, err)
+		t.FailNow()
+	}
+	list := struct {
+		Kind  string
+		Items []struct {
+			Kind string
+		}
+	}{}
+	if err := json.Unmarshal(body, &list); err != nil || list.Kind != "List" || list.Items[0].Kind != "Deployment" {
+		t.Logf("got unexpected list %s, %v", body, err)
+		t.Fail()
+	}
+
+	_, n, err = parseLastApplied([]byte(`{"kind": "Deployment", "metadata": {"annotations": {"kubectl.kubernetes.io/last-applied-configuration": "{}"}}}`))
+	if err != nil || n != 1 {
+		t.Logf("expected a single object to be parsed but got %v, %v", n, err)
+		t.Fail()
+	}
+}
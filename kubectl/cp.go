@@ -0,0 +1,30 @@
+package kubectl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateCpPaths checks that exactly one of source and destination is in
+// the pod, written as `:/path`, the way `ankh cp` takes them.
+func ValidateCpPaths(source string, destination string) error {
+	inPod := func(p string) bool { return strings.HasPrefix(p, ":") }
+	if inPod(source) == inPod(destination) {
+		return fmt.Errorf("Exactly one of '%v' and '%v' must be a path in the pod, written as `:/path`, eg: `ankh cp ./local.txt :/tmp/local.txt`", source, destination)
+	}
+	for _, p := range []string{source, destination} {
+		if strings.TrimPrefix(p, ":") == "" {
+			return fmt.Errorf("Paths to copy must not be empty")
+		}
+	}
+	return nil
+}
+
+// cpPath turns a path in the pod, written as `:/path`, into the `pod:/path`
+// that `kubectl cp` takes, leaving local paths alone.
+func cpPath(p string, pod string) string {
+	if strings.HasPrefix(p, ":") {
+		return pod + p
+	}
+	return p
+}
@@ -0,0 +1,50 @@
+package kubectl
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestValidateCpPaths(t *testing.T) {
+	for _, paths := range [][]string{{"./local.txt", ":/tmp/local.txt"}, {":/tmp/heap.hprof", "."}} {
+		if err := ValidateCpPaths(paths[0], paths[1]); err != nil {
+			t.Logf("expected %v to be valid, but got %v", paths, err)
+			t.Fail()
+		}
+	}
+	for _, paths := range [][]string{{"./a", "./b"}, {":/a", ":/b"}, {":", "./b"}} {
+		if err := ValidateCpPaths(paths[0], paths[1]); err == nil {
+			t.Logf("expected an error for %v", paths)
+			t.Fail()
+		}
+	}
+}
+
+func TestExecuteCp(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Cp, NoPrompt: true,
+		Options: ankh.CommandOptions{CpSource: "./local.txt", CpDestination: ":/tmp/local.txt"}}
+	var args []string
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		if arg[0] == "get" {
+			return exec.Command("printf", "web-1|app,\n")
+		}
+		args = arg
+		return exec.Command("true")
+	}
+	if _, err := Execute(ctx, strings.NewReader(getTestInput), "team", cmd); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	expected := []string{"./local.txt", "web-1:/tmp/local.txt", "-c", "app"}
+	if len(args) < len(expected) || args[0] != "cp" || !reflect.DeepEqual(args[len(args)-len(expected):], expected) {
+		t.Logf("expected kubectl args %v but got %v", expected, args)
+		t.Fail()
+	}
+}
@@ -0,0 +1,181 @@
+package kubectl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// driftObject turns a file name from `kubectl diff` output, like
+// `apps.v1.Deployment.team.web`, into `Deployment/web`.
+func driftObject(file string, namespace string) string {
+	tokens := strings.Split(filepath.Base(file), ".")
+	for i, token := range tokens {
+		if token == "" || !unicode.IsUpper(rune(token[0])) {
+			continue
+		}
+		name := strings.Join(tokens[i+1:], ".")
+		if namespace != "" {
+			name = strings.TrimPrefix(name, namespace+".")
+		}
+		return token + "/" + name
+	}
+	return filepath.Base(file)
+}
+
+// driftObjects lists the objects that differ in `kubectl diff` output.
+func driftObjects(diff string, namespace string) []string {
+	objects := []string{}
+	for _, line := range strings.Split(diff, "\n") {
+		if !strings.HasPrefix(line, "diff ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		objects = append(objects, driftObject(fields[len(fields)-1], namespace))
+	}
+	return objects
+}
+
+// driftFiles maps the file names in `kubectl diff` output, like
+// `apps.v1.Deployment.team.web`, to lowercase `kind/namespace.name`, or
+// `kind/name` for cluster scoped objects, like `deployment/team.web`.
+func driftFiles(diff string) map[string]bool {
+	files := make(map[string]bool)
+	for _, line := range strings.Split(diff, "\n") {
+		if !strings.HasPrefix(line, "diff ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		tokens := strings.Split(filepath.Base(fields[len(fields)-1]), ".")
+		for i, token := range tokens {
+			if token != "" && unicode.IsUpper(rune(token[0])) {
+				files[strings.ToLower(token+"/"+strings.Join(tokens[i+1:], "."))] = true
+				break
+			}
+		}
+	}
+	return files
+}
+
+// ChangedObjects lists the objects in input, by lowercase
+// `kind/namespace/name` like ObjectDocuments, that differ in `kubectl diff`
+// output. Objects are matched by their kind, namespace and name, where an
+// object's namespace is its own, or else namespace, the one the diff ran in.
+func ChangedObjects(diff string, input string, namespace string) []string {
+	files := driftFiles(diff)
+	changed := []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := objectRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		kind, name := strings.ToLower(obj.Kind), strings.ToLower(obj.Metadata.Name)
+		ns := strings.ToLower(obj.Metadata.Namespace)
+		if ns == "" {
+			ns = strings.ToLower(namespace)
+		}
+		// Cluster scoped objects have no namespace in their file name.
+		found := files[kind+"/"+name] || (ns != "" && files[kind+"/"+ns+"."+name])
+		if !found && ns == "" {
+			// The object is in kubectl's default namespace, whatever that is.
+			for file := range files {
+				if strings.HasPrefix(file, kind+"/") && strings.HasSuffix(file, "."+name) {
+					found = true
+					break
+				}
+			}
+		}
+		if found {
+			changed = append(changed, obj.key(namespace))
+		}
+	}
+	return changed
+}
+
+// Diff runs `kubectl diff` on the objects in input, returning its output and
+// whether any of them differ from their live state. Objects that don't exist
+// in the cluster differ too. The output is whatever `KUBECTL_EXTERNAL_DIFF`
+// prints, when it's set.
+func Diff(ctx *ankh.ExecutionContext, input string, namespace string,
+	cmd func(name string, arg ...string) *exec.Cmd) (string, bool, error) {
+	return diff(ctx, strings.NewReader(input), namespace, nil, cmd)
+}
+
+// DiffStream is Diff for `ankh diff`, on the objects read from r as they're
+// templated, passing the extra args of ctx on to kubectl.
+func DiffStream(ctx *ankh.ExecutionContext, r io.Reader, namespace string,
+	cmd func(name string, arg ...string) *exec.Cmd) (string, bool, error) {
+	extraArgs := append([]string{}, ctx.ExtraArgs...)
+	if len(ctx.PassThroughArgs) > 0 {
+		extraArgs = append(append(extraArgs, "--"), ctx.PassThroughArgs...)
+	}
+	return diff(ctx, r, namespace, extraArgs, cmd)
+}
+
+// diff is Diff for the objects read from r, passing extraArgs on to kubectl.
+// It's retried when it fails with a transient error, reading what was read of
+// r again, so that r can be read as the objects are templated.
+func diff(ctx *ankh.ExecutionContext, r io.Reader, namespace string, extraArgs []string,
+	cmd func(name string, arg ...string) *exec.Cmd) (string, bool, error) {
+	if cmd == nil {
+		cmd = func(name string, arg ...string) *exec.Cmd { return kubectlCommand(ctx, name, arg...) }
+	}
+
+	kubectlArgs := append([]string{"diff", "-f", "-"}, kubectlReadArgs(ctx, namespace)...)
+	kubectlArgs = append(kubectlArgs, extraArgs...)
+	var out string
+	var differs bool
+	var read bytes.Buffer
+	err := ctx.Retry("`kubectl diff`", func() error {
+		kubectlCmd := cmd("kubectl", kubectlArgs...)
+		kubectlCmd.Stdin = io.MultiReader(bytes.NewReader(read.Bytes()), io.TeeReader(r, &read))
+		var stdout, stderr bytes.Buffer
+		kubectlCmd.Stdout = &stdout
+		kubectlCmd.Stderr = &stderr
+
+		ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+		record := ctx.StartCommand(kubectlCmd)
+		err := kubectlCmd.Run()
+		err = record.Finish(err)
+		if err == nil {
+			out, differs = "", false
+			return nil
+		}
+		// `kubectl diff` exits 1 when there are differences, and greater than 1 when it fails.
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+				out, differs = stdout.String(), true
+				return nil
+			}
+		}
+		return fmt.Errorf("%v -- the kubectl process had the following output on stderr:\n%s", err, stderr.String())
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return out, differs, nil
+}
+
+// Drift compares the objects in input with their live state using `kubectl
+// diff`, returning the diff and the objects that differ. Objects that don't
+// exist in the cluster count as drift too.
+func Drift(ctx *ankh.ExecutionContext, input string, namespace string,
+	cmd func(name string, arg ...string) *exec.Cmd) (string, []string, error) {
+	diff, differs, err := Diff(ctx, input, namespace, cmd)
+	if err != nil {
+		return "", nil, err
+	}
+	if !differs {
+		return "", []string{}, nil
+	}
+	return diff, driftObjects(diff, namespace), nil
+}
@@ -0,0 +1,106 @@
+package kubectl
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const driftTestDiff = `diff -u -N /tmp/LIVE-123/apps.v1.Deployment.team.web /tmp/MERGED-123/apps.v1.Deployment.team.web
+--- /tmp/LIVE-123/apps.v1.Deployment.team.web
++++ /tmp/MERGED-123/apps.v1.Deployment.team.web
+@@ -1 +1 @@
+-  replicas: 5
++  replicas: 3
+diff -u -N /tmp/LIVE-123/rbac.authorization.k8s.io.v1.ClusterRole.web.reader /tmp/MERGED-123/rbac.authorization.k8s.io.v1.ClusterRole.web.reader
+`
+
+func TestDriftObjects(t *testing.T) {
+	objects := driftObjects(driftTestDiff, "team")
+	expected := []string{"Deployment/web", "ClusterRole/web.reader"}
+	if !reflect.DeepEqual(objects, expected) {
+		t.Logf("expected %v but got %v", expected, objects)
+		t.Fail()
+	}
+}
+
+func TestChangedObjects(t *testing.T) {
+	input := `kind: Deployment
+metadata:
+  name: web
+---
+kind: Deployment
+metadata:
+  name: api
+---
+kind: ConfigMap
+metadata:
+  name: web
+  namespace: other
+---
+kind: ConfigMap
+metadata:
+  name: web
+  namespace: team
+---
+kind: ClusterRole
+metadata:
+  name: web.reader
+`
+	diff := driftTestDiff + "diff -u -N /tmp/LIVE-123/v1.ConfigMap.other.web /tmp/MERGED-123/v1.ConfigMap.other.web\n"
+	changed := ChangedObjects(diff, input, "team")
+	// The ConfigMap in other differs, not the one in team.
+	expected := []string{"deployment/team/web", "configmap/other/web", "clusterrole/team/web.reader"}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Logf("expected %v but got %v", expected, changed)
+		t.Fail()
+	}
+
+	changed = ChangedObjects("diff -u -N /tmp/LIVE-1/v1.ConfigMap.team.web /tmp/MERGED-1/v1.ConfigMap.team.web\n", input, "")
+	expected = []string{"configmap/team/web"}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Logf("expected only the ConfigMap in team but got %v", changed)
+		t.Fail()
+	}
+
+	if changed := ChangedObjects("external diff output\n", input, "team"); len(changed) != 0 {
+		t.Logf("expected no objects from unparseable output but got %v", changed)
+		t.Fail()
+	}
+}
+
+func TestDrift(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Drift}
+
+	for _, test := range []struct {
+		name    string
+		script  string
+		objects []string
+		err     bool
+	}{
+		{"no drift", "exit 0", []string{}, false},
+		{"drift", "printf '%s' \"$DIFF\"; exit 1", []string{"Deployment/web", "ClusterRole/web.reader"}, false},
+		{"failure", "echo forbidden >&2; exit 2", nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := func(name string, arg ...string) *exec.Cmd {
+				c := exec.Command("sh", "-c", test.script)
+				c.Env = []string{"DIFF=" + driftTestDiff}
+				return c
+			}
+			_, objects, err := Drift(ctx, getTestInput, "team", cmd)
+			if (err != nil) != test.err {
+				t.Logf("expected error %v but got %v", test.err, err)
+				t.FailNow()
+			}
+			if !reflect.DeepEqual(objects, test.objects) {
+				t.Logf("expected %v but got %v", test.objects, objects)
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// EventTarget is the objects templated into a namespace, whose Events are of interest.
+type EventTarget struct {
+	Namespace string
+	Objects   []string // lowercase `kind/name`
+}
+
+// Event is a Kubernetes Event involving one of the objects of an EventTarget.
+type Event struct {
+	Time      time.Time
+	Namespace string
+	Type      string
+	Reason    string
+	Object    string
+	Message   string
+	Count     int
+}
+
+type eventObject struct {
+	Metadata struct {
+		Namespace         string `json:"namespace"`
+		CreationTimestamp string `json:"creationTimestamp"`
+	} `json:"metadata"`
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+	Type           string `json:"type"`
+	Reason         string `json:"reason"`
+	Message        string `json:"message"`
+	Count          int    `json:"count"`
+	FirstTimestamp string `json:"firstTimestamp"`
+	LastTimestamp  string `json:"lastTimestamp"`
+	EventTime      string `json:"eventTime"`
+}
+
+func (e eventObject) toEvent() Event {
+	event := Event{
+		Namespace: e.Metadata.Namespace,
+		Type:      e.Type,
+		Reason:    e.Reason,
+		Object:    strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name,
+		Message:   strings.TrimSpace(e.Message),
+		Count:     e.Count,
+	}
+	// Newer Events only set eventTime, and older ones only the timestamps.
+	for _, timestamp := range []string{e.LastTimestamp, e.EventTime, e.FirstTimestamp, e.Metadata.CreationTimestamp} {
+		if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+			event.Time = t
+			break
+		}
+	}
+	return event
+}
+
+// EventObjects returns lowercase `kind/name` for each object in input.
+func EventObjects(input string) []string {
+	objects := []string{}
+	for key := range objectNames(input) {
+		objects = append(objects, key)
+	}
+	sort.Strings(objects)
+	return objects
+}
+
+// eventMatcher matches the objects of a target, and the objects that their
+// controllers make, eg: the ReplicaSets and Pods of a Deployment, by the
+// names the controllers give them.
+func eventMatcher(objects []string) func(object string) bool {
+	exact := make(map[string]bool)
+	owned := []*regexp.Regexp{}
+	for _, object := range objects {
+		exact[object] = true
+		tokens := strings.SplitN(object, "/", 2)
+		name := regexp.QuoteMeta(tokens[1])
+		switch tokens[0] {
+		case "deployment":
+			owned = append(owned, regexp.MustCompile(`^(replicaset/`+name+`-[a-z0-9]{6,}|pod/`+name+`-[a-z0-9]{6,}-[a-z0-9]{5})$`))
+		case "statefulset":
+			owned = append(owned, regexp.MustCompile(`^pod/`+name+`-[0-9]+$`))
+		case "daemonset", "job":
+			owned = append(owned, regexp.MustCompile(`^pod/`+name+`-[a-z0-9]{5}$`))
+		case "cronjob":
+			owned = append(owned, regexp.MustCompile(`^(job/`+name+`-[0-9]+|pod/`+name+`-[0-9]+-[a-z0-9]{5})$`))
+		}
+	}
+	return func(object string) bool {
+		if exact[object] {
+			return true
+		}
+		for _, r := range owned {
+			if r.MatchString(object) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// parseEvents reads the Events involving objects from the output of `kubectl get events -o json`.
+func parseEvents(output []byte, objects []string) ([]Event, error) {
+	list := struct {
+		Items []eventObject `json:"items"`
+	}{}
+	if len(strings.TrimSpace(string(output))) > 0 {
+		if err := json.Unmarshal(output, &list); err != nil {
+			return nil, fmt.Errorf("Unable to parse events: %v", err)
+		}
+	}
+
+	matches := eventMatcher(objects)
+	events := []Event{}
+	for _, item := range list.Items {
+		if event := item.toEvent(); matches(event.Object) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Events gets the Events involving the objects of each of targets, oldest first.
+func Events(ctx *ankh.ExecutionContext, targets []EventTarget) ([]Event, error) {
+	events := []Event{}
+	for _, target := range targets {
+		out, err := runKubectl(ctx, target.Namespace, nil, "get", "events", "-o", "json")
+		if err != nil {
+			return nil, err
+		}
+		namespaceEvents, err := parseEvents(out, target.Objects)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, namespaceEvents...)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+// eventAge formats how long ago an Event happened, like kubectl does, eg: `5m`.
+func eventAge(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%vs", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%vm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%vh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%vd", int(d.Hours()/24))
+	}
+}
+
+// FormatEvents prints a table of events.
+func FormatEvents(w io.Writer, events []Event, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "LAST SEEN\tNAMESPACE\tTYPE\tREASON\tOBJECT\tMESSAGE\n")
+	for _, event := range events {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", eventAge(event.Time, now), event.Namespace, event.Type, event.Reason, event.Object, event.Message)
+	}
+	tw.Flush()
+}
+
+// WatchEvents prints new Events involving the objects of each of targets as
+// they happen, until it's interrupted.
+func WatchEvents(ctx *ankh.ExecutionContext, targets []EventTarget, cmd func(name string, arg ...string) *exec.Cmd) error {
+	if cmd == nil {
+		cmd = func(name string, arg ...string) *exec.Cmd { return kubectlCommand(ctx, name, arg...) }
+	}
+
+	// We want to catch signals while running kubectl, which lets the user
+	// interrupt it gracefully.
+	defer ankh.CatchSignals()()
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(targets))
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target EventTarget) {
+			defer wg.Done()
+			kubectlArgs := []string{"kubectl", "get", "events", "--watch-only", "-o", "json"}
+			kubectlArgs = append(kubectlArgs, kubectlCommonArgs(ctx, target.Namespace)...)
+			kubectlCmd := cmd(kubectlArgs[0], kubectlArgs[1:]...)
+			kubectlCmd.Stderr = os.Stderr
+			stdout, err := kubectlCmd.StdoutPipe()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+			record := ctx.StartCommand(kubectlCmd)
+			if err := kubectlCmd.Start(); err != nil {
+				err = record.Finish(err)
+				errs[i] = err
+				return
+			}
+			matches := eventMatcher(target.Objects)
+			decoder := json.NewDecoder(stdout)
+			for {
+				item := eventObject{}
+				if err := decoder.Decode(&item); err != nil {
+					break
+				}
+				event := item.toEvent()
+				if !matches(event.Object) {
+					continue
+				}
+				mtx.Lock()
+				fmt.Printf("%v  %v  %v  %v  %v  %v\n", event.Time.Local().Format("15:04:05"), event.Namespace, event.Type, event.Reason, event.Object, event.Message)
+				mtx.Unlock()
+			}
+
+			err = kubectlCmd.Wait()
+			err = record.Finish(err)
+			if exitError, ok := err.(*exec.ExitError); ok {
+				if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+					return
+				}
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("Watching events in namespace \"%v\" failed: %v", target.Namespace, err)
+			}
+		}(i, target)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
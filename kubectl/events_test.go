@@ -0,0 +1,48 @@
+package kubectl
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEvents(t *testing.T) {
+	output := []byte(`{"items": [
+  {"metadata": {"namespace": "team"}, "involvedObject": {"kind": "Pod", "name": "web-5d8f7c9b6-x2x7q"}, "type": "Warning", "reason": "BackOff", "message": "Back-off restarting failed container", "lastTimestamp": "2018-01-01T00:02:00Z"},
+  {"metadata": {"namespace": "team"}, "involvedObject": {"kind": "ReplicaSet", "name": "web-5d8f7c9b6"}, "type": "Normal", "reason": "SuccessfulCreate", "message": "Created pod", "lastTimestamp": "2018-01-01T00:01:00Z"},
+  {"metadata": {"namespace": "team"}, "involvedObject": {"kind": "Deployment", "name": "web"}, "type": "Normal", "reason": "ScalingReplicaSet", "message": "Scaled up", "eventTime": "2018-01-01T00:00:00Z"},
+  {"metadata": {"namespace": "team"}, "involvedObject": {"kind": "Pod", "name": "web-api-5d8f7c9b6-x2x7q"}, "type": "Normal", "reason": "Pulled", "lastTimestamp": "2018-01-01T00:00:00Z"},
+  {"metadata": {"namespace": "team"}, "involvedObject": {"kind": "Pod", "name": "db-0"}, "type": "Normal", "reason": "Started", "lastTimestamp": "2018-01-01T00:00:00Z"},
+  {"metadata": {"namespace": "team"}, "involvedObject": {"kind": "Pod", "name": "other-0"}, "type": "Normal", "reason": "Started", "lastTimestamp": "2018-01-01T00:00:00Z"}
+]}`)
+
+	events, err := parseEvents(output, []string{"deployment/web", "statefulset/db"})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	objects := []string{}
+	for _, event := range events {
+		objects = append(objects, event.Object)
+	}
+	expected := []string{"pod/web-5d8f7c9b6-x2x7q", "replicaset/web-5d8f7c9b6", "deployment/web", "pod/db-0"}
+	if !reflect.DeepEqual(objects, expected) {
+		t.Logf("expected events for %v but got %v", expected, objects)
+		t.FailNow()
+	}
+
+	if events[2].Time.Format(time.RFC3339) != "2018-01-01T00:00:00Z" {
+		t.Logf("expected the event time to fall back to eventTime but got %v", events[2].Time)
+		t.Fail()
+	}
+
+	var out bytes.Buffer
+	now, _ := time.Parse(time.RFC3339, "2018-01-01T00:05:00Z")
+	FormatEvents(&out, events[:1], now)
+	if !strings.Contains(out.String(), "3m") || !strings.Contains(out.String(), "Back-off restarting failed container") {
+		t.Logf("got unexpected events table:\n%v", out.String())
+		t.Fail()
+	}
+}
@@ -0,0 +1,242 @@
+package kubectl
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	isatty "github.com/mattn/go-isatty"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+type podContainers struct {
+	Pod        string
+	Containers []string
+}
+
+// parsePodContainers parses the `pod|container1,container2,` lines produced by
+// the go-template output mode used when selecting pods for logs and exec.
+func parsePodContainers(kubectlOut string) []podContainers {
+	pods := []podContainers{}
+	for _, line := range strings.Split(strings.Trim(kubectlOut, "\n "), "\n") {
+		split := strings.Split(line, "|")
+		if len(split) != 2 {
+			continue
+		}
+		pods = append(pods, podContainers{
+			Pod:        split[0],
+			Containers: strings.Split(strings.Trim(split[1], ", "), ","),
+		})
+	}
+	return pods
+}
+
+// extractContainerArg removes `-c CONTAINER` from args, returning the container and remaining args.
+func extractContainerArg(args []string) (string, []string) {
+	container := ""
+	remaining := []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" && i+1 < len(args) {
+			container = args[i+1]
+			i++
+			continue
+		}
+		remaining = append(remaining, args[i])
+	}
+	return container, remaining
+}
+
+// execInteractive is true when the user can be prompted to select a pod or container.
+func execInteractive(ctx *ankh.ExecutionContext) bool {
+	return !ctx.NoPrompt && isatty.IsTerminal(os.Stdin.Fd())
+}
+
+// execTTY is true when exec should allocate a TTY for the command, which
+// only works when ankh itself is running in a terminal, eg: not in CI.
+func execTTY() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// selectExecPod chooses the pod to exec on, or copy to or from: the one
+// named by ctx.Options.ExecPod, by name or index into the pods sorted by
+// name, or else the only pod, or the one the user selects.
+func selectExecPod(ctx *ankh.ExecutionContext, pods []string) (string, error) {
+	sorted := append([]string{}, pods...)
+	sort.Strings(sorted)
+
+	if ctx.Options.ExecPod != "" {
+		if util.Contains(sorted, ctx.Options.ExecPod) {
+			return ctx.Options.ExecPod, nil
+		}
+		if index, err := strconv.Atoi(ctx.Options.ExecPod); err == nil {
+			if index < 0 || index >= len(sorted) {
+				return "", fmt.Errorf("Pod index %v is out of range, there are %v pods [ %v ]", index, len(sorted), strings.Join(sorted, ", "))
+			}
+			return sorted[index], nil
+		}
+		return "", fmt.Errorf("No pod named \"%v\" found, choose one of [ %v ]", ctx.Options.ExecPod, strings.Join(sorted, ", "))
+	}
+
+	if len(sorted) == 1 {
+		return sorted[0], nil
+	}
+	if !execInteractive(ctx) {
+		allPods := ""
+		if ctx.Mode == ankh.Exec {
+			allPods = ", or --all-pods to exec on all of them"
+		}
+		return "", fmt.Errorf("%v pods match [ %v ], and there's no terminal to select one on. Use --pod NAME|INDEX to choose one%v",
+			len(sorted), strings.Join(sorted, ", "), allPods)
+	}
+	return util.PromptForSelection(sorted, "Select a pod")
+}
+
+// killAfter kills cmd, which must have started, if it's still running after
+// timeout. The returned func stops the timer, and reports whether cmd was killed.
+func killAfter(cmd *exec.Cmd, timeout time.Duration) func() bool {
+	if timeout <= 0 {
+		return func() bool { return false }
+	}
+	var mtx sync.Mutex
+	killed := false
+	timer := time.AfterFunc(timeout, func() {
+		mtx.Lock()
+		defer mtx.Unlock()
+		killed = true
+		cmd.Process.Kill()
+	})
+	return func() bool {
+		timer.Stop()
+		mtx.Lock()
+		defer mtx.Unlock()
+		return killed
+	}
+}
+
+type execResult struct {
+	Pod      string
+	ExitCode int
+	Err      error
+}
+
+// execAll runs the pass-through command on every selected pod, either
+// sequentially or in parallel, prefixing output with the pod name and
+// aggregating exit codes.
+func execAll(ctx *ankh.ExecutionContext, cmd func(name string, arg ...string) *exec.Cmd,
+	commonArgs []string, kubectlOut string) (string, error) {
+	pods := parsePodContainers(kubectlOut)
+	container, extraArgs := extractContainerArg(ctx.ExtraArgs)
+
+	if container == "" {
+		allContainers := []string{}
+		for _, pod := range pods {
+			allContainers = append(allContainers, pod.Containers...)
+		}
+		allContainers = util.ArrayDedup(allContainers)
+		sort.Strings(allContainers)
+		if len(allContainers) > 1 {
+			if !execInteractive(ctx) {
+				return "", fmt.Errorf("The pods have %v containers [ %v ], and there's no terminal to select one on. Use -c to choose one",
+					len(allContainers), strings.Join(allContainers, ", "))
+			}
+			selection, err := util.PromptForSelection(allContainers, "Select a container to exec on in every pod")
+			if err != nil {
+				return "", err
+			}
+			container = selection
+		} else if len(allContainers) == 1 {
+			container = allContainers[0]
+		}
+	}
+
+	// We want to catch signals while running kubectl, which lets the user
+	// interrupt it gracefully.
+	defer ankh.CatchSignals()()
+
+	var mtx sync.Mutex
+	run := func(pod string) execResult {
+		kubectlArgs := []string{"kubectl", "exec"}
+		kubectlArgs = append(kubectlArgs, commonArgs...)
+		kubectlArgs = append(kubectlArgs, extraArgs...)
+		kubectlArgs = append(kubectlArgs, pod, "-c", container)
+		kubectlArgs = append(kubectlArgs, append([]string{"--"}, ctx.PassThroughArgs...)...)
+
+		stdout := util.NewPrefixWriter(os.Stdout, &mtx, fmt.Sprintf("[%v] ", pod))
+		stderr := util.NewPrefixWriter(os.Stderr, &mtx, fmt.Sprintf("[%v] ", pod))
+		kubectlCmd := cmd(kubectlArgs[0], kubectlArgs[1:]...)
+		kubectlCmd.Stdout = stdout
+		kubectlCmd.Stderr = stderr
+
+		ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+		record := ctx.StartCommand(kubectlCmd)
+		err := kubectlCmd.Start()
+		if err == nil {
+			timedOut := killAfter(kubectlCmd, ctx.Options.ExecTimeout)
+			err = kubectlCmd.Wait()
+			err = record.Finish(err)
+			if timedOut() {
+				err = fmt.Errorf("timed out after %v", ctx.Options.ExecTimeout)
+			}
+		} else {
+			err = record.Finish(err)
+		}
+		stdout.Flush()
+		stderr.Flush()
+
+		result := execResult{Pod: pod, Err: err}
+		if exitError, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitError.Sys().(syscall.WaitStatus).ExitStatus()
+		} else if err != nil {
+			result.ExitCode = -1
+		}
+		return result
+	}
+
+	targets := []string{}
+	for _, pod := range pods {
+		if container != "" && !util.Contains(pod.Containers, container) {
+			ctx.Logger.Warnf("Skipping pod %v, which has no container named '%v'", pod.Pod, container)
+			continue
+		}
+		targets = append(targets, pod.Pod)
+	}
+
+	results := make([]execResult, len(targets))
+	if ctx.Options.ExecParallel {
+		ctx.Logger.Infof("Running `%v` on %v pods in parallel", strings.Join(ctx.PassThroughArgs, " "), len(targets))
+		pool := util.NewPool(ctx.ConcurrencyLimit(ankh.KubernetesConcurrency))
+		for i, pod := range targets {
+			i, pod := i, pod
+			pool.Go(func() {
+				results[i] = run(pod)
+			})
+		}
+		pool.Wait()
+	} else {
+		for i, pod := range targets {
+			ctx.Logger.Infof("Running `%v` on pod %v (%v of %v)", strings.Join(ctx.PassThroughArgs, " "), pod, i+1, len(targets))
+			results[i] = run(pod)
+		}
+	}
+
+	failures := []string{}
+	for _, result := range results {
+		if result.Err != nil {
+			failures = append(failures, fmt.Sprintf("%v (exit code %v)", result.Pod, result.ExitCode))
+		}
+	}
+	if len(failures) > 0 {
+		return "", fmt.Errorf("Exec failed on %v of %v pods: %v", len(failures), len(results), strings.Join(failures, ", "))
+	}
+
+	ctx.Logger.Infof("Exec succeeded on all %v pods", len(results))
+	return "", nil
+}
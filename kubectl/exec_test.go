@@ -0,0 +1,70 @@
+package kubectl
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestSelectExecPod(t *testing.T) {
+	pods := []string{"web-b", "web-a", "web-c"}
+	for pod, expected := range map[string]string{"web-c": "web-c", "0": "web-a", "2": "web-c"} {
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), Options: ankh.CommandOptions{ExecPod: pod}}
+		selection, err := selectExecPod(ctx, pods)
+		if err != nil || selection != expected {
+			t.Logf("expected --pod %v to select %v but got %v (%v)", pod, expected, selection, err)
+			t.Fail()
+		}
+	}
+
+	for _, pod := range []string{"3", "-1", "web-d"} {
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), Options: ankh.CommandOptions{ExecPod: pod}}
+		if _, err := selectExecPod(ctx, pods); err == nil {
+			t.Logf("expected --pod %v to be an error", pod)
+			t.Fail()
+		}
+	}
+
+	// Tests don't run in a terminal, so a pod can't be selected interactively.
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	if _, err := selectExecPod(ctx, pods); err == nil || !strings.Contains(err.Error(), "--pod") {
+		t.Logf("expected an error suggesting --pod but got %v", err)
+		t.Fail()
+	}
+	if selection, err := selectExecPod(ctx, []string{"web-a"}); err != nil || selection != "web-a" {
+		t.Logf("expected the only pod to be selected but got %v (%v)", selection, err)
+		t.Fail()
+	}
+}
+
+func TestExecuteExecTimeout(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Exec, Options: ankh.CommandOptions{ExecPod: "1", ExecTimeout: 50 * time.Millisecond},
+		ExtraArgs: []string{"-c", "sidecar"}, PassThroughArgs: []string{"/bin/date"}}
+	var args []string
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		if arg[0] == "get" {
+			return exec.Command("printf", "web-1|app,sidecar,\nweb-2|app,sidecar,\n")
+		}
+		args = arg
+		return exec.Command("sleep", "5")
+	}
+
+	start := time.Now()
+	_, err := Execute(ctx, strings.NewReader(getTestInput), "team", cmd)
+	if err == nil || !strings.Contains(err.Error(), "timed out") || time.Since(start) > 4*time.Second {
+		t.Logf("expected exec to time out but got %v", err)
+		t.Fail()
+	}
+
+	joined := strings.Join(args, " ")
+	if !strings.HasPrefix(joined, "exec -i ") || strings.Contains(joined, " -t ") || strings.Count(joined, "-c ") != 1 ||
+		!strings.Contains(joined, "web-2 -c sidecar -- /bin/date") {
+		t.Logf("unexpected kubectl exec args %v", args)
+		t.Fail()
+	}
+}
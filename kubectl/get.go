@@ -0,0 +1,230 @@
+package kubectl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/util"
+)
+
+const (
+	getRed    = "\x1b[31m"
+	getGreen  = "\x1b[32m"
+	getYellow = "\x1b[33m"
+	getBold   = "\x1b[1m"
+	getReset  = "\x1b[0m"
+)
+
+var getColumnSeparator = regexp.MustCompile(`\s{2,}`)
+
+var statusColors = map[string]string{
+	"Running":           getGreen,
+	"Completed":         getGreen,
+	"Succeeded":         getGreen,
+	"Active":            getGreen,
+	"Bound":             getGreen,
+	"Ready":             getGreen,
+	"Pending":           getYellow,
+	"ContainerCreating": getYellow,
+	"PodInitializing":   getYellow,
+	"Terminating":       getYellow,
+	"Unknown":           getYellow,
+	"CrashLoopBackOff":  getRed,
+	"Error":             getRed,
+	"Failed":            getRed,
+	"ErrImagePull":      getRed,
+	"ImagePullBackOff":  getRed,
+	"OOMKilled":         getRed,
+	"Evicted":           getRed,
+	"NotReady":          getRed,
+}
+
+type getTable struct {
+	Kind   string
+	Header []string
+	Rows   [][]string
+}
+
+// parseGetOutput splits the output of `kubectl get kind1,kind2 -o wide` into
+// one table per kind. When more than one kind is requested, kubectl prints a
+// separate table for each, with names of the form `kind.group/name`.
+func parseGetOutput(output string) []getTable {
+	tables := make(map[string]*getTable)
+	kinds := []string{}
+
+	var header []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			header = nil
+			continue
+		}
+
+		cells := getColumnSeparator.Split(strings.TrimSpace(line), -1)
+		if header == nil {
+			header = cells
+			continue
+		}
+
+		kind := ""
+		tokens := strings.SplitN(cells[0], "/", 2)
+		if len(tokens) == 2 {
+			kind = strings.Split(tokens[0], ".")[0]
+			cells[0] = tokens[1]
+		}
+
+		table, ok := tables[kind]
+		if !ok {
+			table = &getTable{Kind: kind, Header: header}
+			tables[kind] = table
+			kinds = append(kinds, kind)
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+
+	sort.Strings(kinds)
+	result := []getTable{}
+	for _, kind := range kinds {
+		result = append(result, *tables[kind])
+	}
+	return result
+}
+
+// chartForObject finds the chart an object was templated from. Objects that
+// weren't templated directly, like pods and replicasets, are matched to the
+// templated object with the longest name that prefixes their own.
+func chartForObject(objectCharts map[string]string, kind string, name string) string {
+	if chart, ok := objectCharts[strings.ToLower(kind+"/"+name)]; ok {
+		return chart
+	}
+
+	best := ""
+	chart := ""
+	for key, c := range objectCharts {
+		tokens := strings.SplitN(key, "/", 2)
+		if len(tokens) != 2 || len(tokens[1]) <= len(best) {
+			continue
+		}
+		if strings.HasPrefix(name, tokens[1]+"-") {
+			best = tokens[1]
+			chart = c
+		}
+	}
+	return chart
+}
+
+func colorForCell(column string, value string) string {
+	switch column {
+	case "STATUS":
+		return statusColors[value]
+	case "READY":
+		tokens := strings.SplitN(value, "/", 2)
+		if len(tokens) != 2 {
+			return statusColors[value]
+		}
+		if tokens[0] == tokens[1] {
+			return getGreen
+		}
+		if tokens[0] == "0" {
+			return getRed
+		}
+		return getYellow
+	case "NODE-STATUS":
+		if !strings.HasPrefix(value, "Ready") {
+			return getRed
+		}
+		if value != "Ready" {
+			return getYellow
+		}
+		return getGreen
+	}
+	return ""
+}
+
+// formatTable aligns columns using the width of the uncolored text, since
+// tabwriter counts color escape sequences towards a cell's width.
+func formatTable(header []string, rows [][]string, color bool) string {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = len(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i < len(widths) && len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	formatRow := func(row []string, colors []string) string {
+		cells := []string{}
+		for i, cell := range row {
+			padding := ""
+			if i < len(row)-1 && i < len(widths) {
+				padding = strings.Repeat(" ", widths[i]-len(cell)+3)
+			}
+			if color && colors[i] != "" {
+				cell = colors[i] + cell + getReset
+			}
+			cells = append(cells, cell+padding)
+		}
+		return strings.Join(cells, "") + "\n"
+	}
+
+	out := formatRow(header, make([]string, len(header)))
+	for _, row := range rows {
+		colors := make([]string, len(row))
+		for i, cell := range row {
+			if i < len(header) {
+				colors[i] = colorForCell(header[i], cell)
+			}
+		}
+		out += formatRow(row, colors)
+	}
+	return out
+}
+
+// FormatGet groups the output of `kubectl get` by kind, adds the chart that
+// each object came from, aligns columns, and optionally colorizes statuses.
+func FormatGet(input string, output string, color bool) string {
+	objectCharts := objectNames(input)
+
+	// kubectl only prefixes names with their kind when more than one kind is requested.
+	inputKinds := []string{}
+	for key := range objectCharts {
+		inputKinds = append(inputKinds, strings.SplitN(key, "/", 2)[0])
+	}
+	inputKinds = util.ArrayDedup(inputKinds)
+
+	sections := []string{}
+	for _, table := range parseGetOutput(output) {
+		if table.Kind == "" && len(inputKinds) == 1 {
+			table.Kind = inputKinds[0]
+		}
+		header := append([]string{"CHART"}, table.Header...)
+		rows := [][]string{}
+		for _, row := range table.Rows {
+			chart := chartForObject(objectCharts, table.Kind, row[0])
+			if chart == "" {
+				chart = "-"
+			}
+			rows = append(rows, append([]string{chart}, row...))
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			return rows[i][0] < rows[j][0]
+		})
+
+		title := table.Kind
+		if title == "" {
+			title = "objects"
+		}
+		title = fmt.Sprintf("==> %v (%v)", title, len(rows))
+		if color {
+			title = getBold + title + getReset
+		}
+		sections = append(sections, title+"\n"+formatTable(header, rows, color))
+	}
+
+	return strings.TrimSuffix(strings.Join(sections, "\n"), "\n")
+}
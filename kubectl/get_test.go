@@ -0,0 +1,54 @@
+package kubectl
+
+import (
+	"strings"
+	"testing"
+)
+
+const getTestInput = `
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+const getTestOutput = `NAME                       READY   STATUS             RESTARTS   AGE
+pod/web-5d8f7c9b4-abcde    1/1     Running            0          1d
+pod/web-5d8f7c9b4-fghij    0/1     CrashLoopBackOff   12         1d
+
+NAME          TYPE        CLUSTER-IP    EXTERNAL-IP   PORT(S)   AGE
+service/web   ClusterIP   10.0.0.1      <none>        80/TCP    1d
+`
+
+func TestFormatGet(t *testing.T) {
+	t.Run("groups by kind with charts", func(t *testing.T) {
+		out := FormatGet(getTestInput, getTestOutput, false)
+		for _, expected := range []string{
+			"==> pod (2)",
+			"==> service (1)",
+			"CHART   NAME                  READY   STATUS",
+			"web     web-5d8f7c9b4-fghij   0/1     CrashLoopBackOff   12",
+			"web     web    ClusterIP",
+		} {
+			if !strings.Contains(out, expected) {
+				t.Logf("expected to find '%v' in output:\n%v", expected, out)
+				t.Fail()
+			}
+		}
+	})
+
+	t.Run("colorizes statuses", func(t *testing.T) {
+		out := FormatGet(getTestInput, getTestOutput, true)
+		if !strings.Contains(out, getRed+"CrashLoopBackOff"+getReset) || !strings.Contains(out, getGreen+"Running"+getReset) {
+			t.Logf("expected colorized statuses in output:\n%v", out)
+			t.Fail()
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+type hpaObject struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		ScaleTargetRef struct {
+			Kind string `json:"kind" yaml:"kind"`
+			Name string `json:"name" yaml:"name"`
+		} `json:"scaleTargetRef" yaml:"scaleTargetRef"`
+	} `json:"spec"`
+}
+
+func (h hpaObject) target() string {
+	if h.Spec.ScaleTargetRef.Kind == "" || h.Spec.ScaleTargetRef.Name == "" {
+		return ""
+	}
+	return strings.ToLower(h.Spec.ScaleTargetRef.Kind + "/" + h.Spec.ScaleTargetRef.Name)
+}
+
+// HPATargets returns lowercase `kind/name` for each object that a
+// HorizontalPodAutoscaler in templated output scales.
+func HPATargets(input string) []string {
+	targets := []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		hpa := hpaObject{}
+		if err := yaml.Unmarshal([]byte(doc), &hpa); err != nil || hpa.Kind != "HorizontalPodAutoscaler" {
+			continue
+		}
+		if target := hpa.target(); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// parseHPATargets reads the objects scaled by the HorizontalPodAutoscalers
+// in the output of `kubectl get hpa -o json`.
+func parseHPATargets(output []byte) ([]string, error) {
+	list := struct {
+		Items []hpaObject `json:"items"`
+	}{}
+	if len(strings.TrimSpace(string(output))) > 0 {
+		if err := json.Unmarshal(output, &list); err != nil {
+			return nil, fmt.Errorf("Unable to parse HorizontalPodAutoscalers: %v", err)
+		}
+	}
+	targets := []string{}
+	for _, hpa := range list.Items {
+		if target := hpa.target(); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// LiveHPATargets returns lowercase `kind/name` for each object that a live
+// HorizontalPodAutoscaler in namespace scales.
+func LiveHPATargets(ctx *ankh.ExecutionContext, namespace string) ([]string, error) {
+	out, err := runKubectl(ctx, namespace, nil, "get", "horizontalpodautoscalers", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parseHPATargets(out)
+}
+
+// parseReplicas reads the replicas of each object in the output of `kubectl get -o json`.
+func parseReplicas(output []byte) (map[string]int, error) {
+	list := struct {
+		Kind  string `json:"kind"`
+		Items []struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				Replicas *int `json:"replicas"`
+			} `json:"spec"`
+		} `json:"items"`
+	}{}
+	replicas := make(map[string]int)
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return replicas, nil
+	}
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, fmt.Errorf("Unable to parse live replicas: %v", err)
+	}
+	for _, item := range list.Items {
+		if item.Spec.Replicas != nil {
+			replicas[strings.ToLower(item.Kind+"/"+item.Metadata.Name)] = *item.Spec.Replicas
+		}
+	}
+	return replicas, nil
+}
+
+// LiveReplicas gets the live `spec.replicas` of objects, which are lowercase
+// `kind/name`, in namespace, keyed the same way. Objects that don't exist,
+// or don't set `spec.replicas`, are left out.
+func LiveReplicas(ctx *ankh.ExecutionContext, namespace string, objects []string) (map[string]int, error) {
+	if len(objects) == 0 {
+		return map[string]int{}, nil
+	}
+	// Getting one object prints it alone, so always ask for a List.
+	args := append([]string{"get", "-o", "json", "--ignore-not-found"}, objects...)
+	out, err := runKubectl(ctx, namespace, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 1 && len(strings.TrimSpace(string(out))) > 0 {
+		out = []byte(`{"kind": "List", "items": [` + string(out) + `]}`)
+	}
+	return parseReplicas(out)
+}
+
+// SetReplicas sets `spec.replicas` of each of the objects in templated
+// output that's in replicas, by lowercase `kind/name`, or removes it when
+// the replicas are nil.
+func SetReplicas(input string, replicas map[string]*int) (string, error) {
+	return transformObjects(input, func(kind string, obj yaml.MapSlice) (yaml.MapSlice, bool) {
+		n, ok := replicas[strings.ToLower(kind+"/"+mapSliceString(obj, "metadata", "name"))]
+		if !ok {
+			return obj, false
+		}
+		spec, _ := mapSliceGet(obj, "spec").(yaml.MapSlice)
+		if n != nil {
+			return mapSliceSet(obj, "spec", mapSliceSet(spec, "replicas", *n)), true
+		}
+		kept := yaml.MapSlice{}
+		for _, item := range spec {
+			if item.Key != "replicas" {
+				kept = append(kept, item)
+			}
+		}
+		return mapSliceSet(obj, "spec", kept), true
+	})
+}
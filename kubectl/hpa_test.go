@@ -0,0 +1,88 @@
+package kubectl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHPATargets(t *testing.T) {
+	input := getTestInput + `---
+# Source: web/templates/hpa.yaml
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: web
+`
+	if targets := HPATargets(input); !reflect.DeepEqual(targets, []string{"deployment/web"}) {
+		t.Logf("expected the HPA to target deployment/web but got %v", targets)
+		t.Fail()
+	}
+
+	targets, err := parseHPATargets([]byte(`{"items": [
+  {"kind": "HorizontalPodAutoscaler", "spec": {"scaleTargetRef": {"kind": "StatefulSet", "name": "db"}}},
+  {"kind": "HorizontalPodAutoscaler", "spec": {"scaleTargetRef": {"kind": "Deployment", "name": "web"}}}
+]}`))
+	if err != nil || !reflect.DeepEqual(targets, []string{"deployment/web", "statefulset/db"}) {
+		t.Logf("got unexpected live targets %v, %v", targets, err)
+		t.Fail()
+	}
+}
+
+func TestSetReplicas(t *testing.T) {
+	input := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+---
+# Source: web/templates/worker.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 2
+---
+# Source: web/templates/other.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other
+spec:
+  replicas: 2
+`
+	five := 5
+	output, err := SetReplicas(input, map[string]*int{"deployment/web": &five, "deployment/worker": nil})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	docs := ObjectDocuments(output, "test")
+	if !strings.Contains(docs["deployment/test/web"], "replicas: 5") {
+		t.Logf("expected web to keep its live replicas but got:\n%v", docs["deployment/test/web"])
+		t.Fail()
+	}
+	if strings.Contains(docs["deployment/test/worker"], "replicas") {
+		t.Logf("expected worker's replicas to be dropped but got:\n%v", docs["deployment/test/worker"])
+		t.Fail()
+	}
+	if docs["deployment/test/other"] != ObjectDocuments(input, "test")["deployment/test/other"] {
+		t.Logf("expected other to be unchanged but got:\n%v", docs["deployment/test/other"])
+		t.Fail()
+	}
+
+	replicas, err := parseReplicas([]byte(`{"kind": "List", "items": [{"kind": "Deployment", "metadata": {"name": "web"}, "spec": {"replicas": 7}}]}`))
+	if err != nil || !reflect.DeepEqual(replicas, map[string]int{"deployment/web": 7}) {
+		t.Logf("got unexpected live replicas %v, %v", replicas, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,43 @@
+package kubectl
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Images lists the images that the containers, init containers and ephemeral
+// containers of each Pod, and each workload's pod template, in templated
+// output run, sorted and without duplicates.
+func Images(input string) ([]string, error) {
+	images := make(map[string]bool)
+	_, err := transformObjects(input, func(kind string, obj yaml.MapSlice) (yaml.MapSlice, bool) {
+		path := []string{"spec"}
+		if paths := podTemplatePaths[kind]; len(paths) > 0 {
+			path = append(append([]string{}, paths[len(paths)-1]...), "spec")
+		} else if kind != "Pod" {
+			return obj, false
+		}
+		podSpec, _ := mapSlicePath(obj, path...).(yaml.MapSlice)
+		for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+			containers, _ := mapSliceGet(podSpec, field).([]interface{})
+			for _, container := range containers {
+				if image := mapSliceString(container, "image"); image != "" {
+					images[image] = true
+				}
+			}
+		}
+		return obj, false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find the images of templated objects: %v", err)
+	}
+
+	sorted := []string{}
+	for image := range images {
+		sorted = append(sorted, image)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
@@ -0,0 +1,67 @@
+package kubectl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImages(t *testing.T) {
+	input := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com/web:1.2.3
+      containers:
+      - name: web
+        image: registry.example.com/web:1.2.3
+      - name: proxy
+        image: envoyproxy/envoy:v1.27.0
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: report
+            image: registry.example.com/report@sha256:abc
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+spec:
+  containers:
+  - name: debug
+    image: busybox
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+  - port: 80
+`
+	images, err := Images(input)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := []string{"busybox", "envoyproxy/envoy:v1.27.0", "registry.example.com/report@sha256:abc", "registry.example.com/web:1.2.3"}
+	if !reflect.DeepEqual(images, expected) {
+		t.Logf("expected images %v but got %v", expected, images)
+		t.Fail()
+	}
+}
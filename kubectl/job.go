@@ -0,0 +1,115 @@
+package kubectl
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// maxNameLength is the longest a Job's name can be, so that the label its
+// pods get with it is still valid.
+const maxNameLength = 63
+
+// UniqueJobs renames each of the Jobs in input named in names, or every Job
+// when names is empty, by adding suffix, so that they can run again alongside
+// the Jobs from earlier runs. It returns the manifest of each of those Jobs,
+// and their new names.
+func UniqueJobs(input string, names []string, suffix string) ([]string, []string) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	jobs := []string{}
+	renamed := []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := migrationObject{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || !strings.EqualFold(obj.Kind, "job") {
+			continue
+		}
+		if len(names) > 0 && !wanted[obj.Metadata.Name] {
+			continue
+		}
+		lines := strings.Split(doc, "\n")
+		n, name := metadataField(lines, "name")
+		if n < 0 {
+			continue
+		}
+		if len(name)+len(suffix)+1 > maxNameLength {
+			name = strings.TrimRight(name[:maxNameLength-len(suffix)-1], "-.")
+		}
+		name = name + "-" + suffix
+		setMetadataField(lines, n, "name", name)
+		jobs = append(jobs, strings.Join(lines, "\n"))
+		renamed = append(renamed, name)
+	}
+	return jobs, renamed
+}
+
+// jobExitCode is the exit code of the last container of a Job's pods to
+// terminate, or 1 if there isn't one.
+func jobExitCode(ctx *ankh.ExecutionContext, namespace string, name string) int {
+	out, err := runKubectl(ctx, namespace, nil, "get", "pods", "-l", "job-name="+name,
+		"-o", `jsonpath={range .items[*]}{range .status.containerStatuses[*]}{.state.terminated.exitCode}{"\n"}{end}{end}`)
+	if err != nil {
+		return 1
+	}
+	code := 1
+	for _, line := range strings.Split(string(out), "\n") {
+		if c, err := strconv.Atoi(strings.TrimSpace(line)); err == nil && c != 0 {
+			code = c
+		}
+	}
+	return code
+}
+
+// RunJob creates the Job called name from manifest, streams the logs of its
+// pod, and waits up to timeout for it to finish, returning the exit code of
+// its pod when it fails.
+func RunJob(ctx *ankh.ExecutionContext, namespace string, manifest string, name string, timeout time.Duration) (int, error) {
+	if _, err := runKubectl(ctx, namespace, []byte(manifest), "create", "-f", "-"); err != nil {
+		return 1, fmt.Errorf("Unable to create job \"%v\": %v", name, err)
+	}
+
+	// We want to catch signals while streaming logs, which lets the user
+	// stop following them without leaving the Job behind unnoticed.
+	release := ankh.CatchSignals()
+	kubectlArgs := []string{"kubectl", "logs", "-f", "job/" + name, "--pod-running-timeout", timeout.String()}
+	kubectlArgs = append(kubectlArgs, kubectlCommonArgs(ctx, namespace)...)
+	kubectlCmd := ctx.Command(ankh.RunPhase, kubectlArgs[0], kubectlArgs[1:]...)
+	kubectlCmd.Stdout = os.Stdout
+	kubectlCmd.Stderr = os.Stderr
+	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+	record := ctx.StartCommand(kubectlCmd)
+	err := kubectlCmd.Run()
+	err = record.Finish(err)
+	release()
+	if err != nil {
+		ctx.Logger.Warnf("Stopped streaming the logs of job \"%v\": %v", name, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := jobState(ctx, namespace, name)
+		if err != nil {
+			return 1, err
+		}
+		if state == "Complete" {
+			return 0, nil
+		}
+		if state == "Failed" {
+			code := jobExitCode(ctx, namespace, name)
+			return code, fmt.Errorf("Job \"%v\" failed with exit code %v", name, code)
+		}
+		if time.Now().After(deadline) {
+			return 1, fmt.Errorf("Job \"%v\" did not complete within %v. It's still running, see `kubectl get job %v`", name, timeout, name)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
@@ -0,0 +1,50 @@
+package kubectl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUniqueJobs(t *testing.T) {
+	input := getTestInput + `---
+# Source: web/templates/migrate.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  labels:
+    name: migrate
+spec:
+  template:
+    metadata:
+      name: migrate
+---
+# Source: web/templates/backfill.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: backfill-the-very-long-named-table-of-everything-that-happened
+`
+	manifests, names := UniqueJobs(input, nil, "abc123")
+	manifest := strings.Join(manifests, "\n---")
+	expected := []string{"migrate-abc123", "backfill-the-very-long-named-table-of-everything-that-ha-abc123"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Logf("expected %v but got %v", expected, names)
+		t.Fail()
+	}
+	if !reflect.DeepEqual(JobNames(manifest), expected) || strings.Contains(manifest, "kind: Deployment") {
+		t.Logf("expected manifests of just the renamed Jobs, but got:\n%v", manifest)
+		t.Fail()
+	}
+	if !strings.Contains(manifest, "    name: migrate\n") || !strings.Contains(manifest, "      name: migrate\n") {
+		t.Logf("expected only the Jobs' names to change, but got:\n%v", manifest)
+		t.Fail()
+	}
+
+	_, names = UniqueJobs(input, []string{"migrate"}, "abc123")
+	if !reflect.DeepEqual(names, []string{"migrate-abc123"}) {
+		t.Logf("expected only the migrate Job but got %v", names)
+		t.Fail()
+	}
+}
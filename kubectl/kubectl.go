@@ -1,23 +1,50 @@
 package kubectl
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/mattn/go-isatty"
 
 	"github.com/appnexus/ankh/context"
 	"github.com/appnexus/ankh/util"
 )
 
-func Version() (string, error) {
+// kubectlCommand is exec.Command for kubectl, bounded by `timeouts.apply`
+// during `apply`, and by `--timeout` always. `kubectl wait` is bounded by its
+// own `--timeout` instead of `timeouts.apply`.
+func kubectlCommand(ctx *ankh.ExecutionContext, name string, arg ...string) *exec.Cmd {
+	phase := ankh.RunPhase
+	if ctx.Mode == ankh.Apply && (len(arg) == 0 || arg[0] != "wait") {
+		phase = ankh.ApplyPhase
+	}
+	return ctx.Command(phase, name, arg...)
+}
+
+// isStopped is true when ankh stopped the command that failed with err,
+// because it ran past its timeout, or because the run was interrupted.
+func isStopped(err error) bool {
+	switch err.(type) {
+	case *ankh.TimeoutError, *ankh.InterruptedError:
+		return true
+	}
+	return false
+}
+
+func Version(ctx *ankh.ExecutionContext) (string, error) {
 	kubectlArgs := []string{"kubectl", "version", "--client"}
-	kubectlCmd := exec.Command(kubectlArgs[0], kubectlArgs[1:]...)
-	kubectlOutput, err := kubectlCmd.CombinedOutput()
+	kubectlCmd := kubectlCommand(ctx, kubectlArgs[0], kubectlArgs[1:]...)
+	kubectlOutput, err := combinedOutput(ctx, kubectlCmd)
 	if err != nil {
 		outputMsg := ""
 		if len(kubectlOutput) > 0 {
@@ -28,6 +55,109 @@ func Version() (string, error) {
 	return string(kubectlOutput), nil
 }
 
+// KubeContextNamespace returns the namespace configured on the current context's
+// kube-context in the kubeconfig, or the empty string if there isn't one.
+func KubeContextNamespace(ctx *ankh.ExecutionContext) (string, error) {
+	kubeContext := ctx.AnkhConfig.CurrentContext.KubeContext
+	if kubeContext == "" {
+		return "", fmt.Errorf("Context '%v' has no `kube-context` to take a namespace from", ctx.AnkhConfig.CurrentContextName)
+	}
+
+	kubectlArgs := []string{"kubectl", "config", "view", "--minify", "--context", kubeContext,
+		"-o", "jsonpath={.contexts[0].context.namespace}"}
+	if ctx.KubeConfigPath != "" {
+		kubectlArgs = append(kubectlArgs, []string{"--kubeconfig", ctx.KubeConfigPath}...)
+	}
+	kubectlCmd := kubectlCommand(ctx, kubectlArgs[0], kubectlArgs[1:]...)
+	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+	kubectlOutput, err := combinedOutput(ctx, kubectlCmd)
+	if err != nil {
+		outputMsg := ""
+		if len(kubectlOutput) > 0 {
+			outputMsg = fmt.Sprintf(" -- the kubectl process had the following output on stdout/stderr:\n%s", kubectlOutput)
+		}
+		return "", fmt.Errorf("%v%v", err, outputMsg)
+	}
+	return strings.TrimSpace(string(kubectlOutput)), nil
+}
+
+// ClusterReachable checks that the cluster for a context responds to kubectl.
+func ClusterReachable(ctx *ankh.ExecutionContext, context ankh.Context) error {
+	kubectlArgs := []string{"kubectl", "version", "--request-timeout", "5s"}
+	if context.KubeServer != "" {
+		kubectlArgs = append(kubectlArgs, []string{"--server", context.KubeServer}...)
+	} else {
+		kubectlArgs = append(kubectlArgs, []string{"--context", context.KubeContext}...)
+		if ctx.KubeConfigPath != "" {
+			kubectlArgs = append(kubectlArgs, []string{"--kubeconfig", ctx.KubeConfigPath}...)
+		}
+	}
+	kubectlCmd := kubectlCommand(ctx, kubectlArgs[0], kubectlArgs[1:]...)
+	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+	kubectlOutput, err := combinedOutput(ctx, kubectlCmd)
+	if err != nil {
+		outputMsg := ""
+		if len(kubectlOutput) > 0 {
+			outputMsg = fmt.Sprintf(" -- the kubectl process had the following output on stdout/stderr:\n%s", kubectlOutput)
+		}
+		return fmt.Errorf("%v%v", err, outputMsg)
+	}
+	return nil
+}
+
+// ServerVersion returns the Kubernetes major and minor version of the current context's cluster.
+func ServerVersion(ctx *ankh.ExecutionContext) (int, int, error) {
+	context := ctx.AnkhConfig.CurrentContext
+	kubectlArgs := []string{"kubectl", "version", "-o", "json", "--request-timeout", "5s"}
+	if context.KubeServer != "" {
+		kubectlArgs = append(kubectlArgs, []string{"--server", context.KubeServer}...)
+	} else {
+		kubectlArgs = append(kubectlArgs, []string{"--context", context.KubeContext}...)
+		if ctx.KubeConfigPath != "" {
+			kubectlArgs = append(kubectlArgs, []string{"--kubeconfig", ctx.KubeConfigPath}...)
+		}
+	}
+	kubectlCmd := kubectlCommand(ctx, kubectlArgs[0], kubectlArgs[1:]...)
+	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+	var stdout, stderr bytes.Buffer
+	kubectlCmd.Stdout = &stdout
+	kubectlCmd.Stderr = &stderr
+	record := ctx.StartCommand(kubectlCmd)
+	err := kubectlCmd.Run()
+	err = record.Finish(err)
+	kubectlOutput := stdout.Bytes()
+	if err != nil {
+		return 0, 0, fmt.Errorf("%v -- the kubectl process had the following output on stderr:\n%s", err, stderr.String())
+	}
+	return parseServerVersion(kubectlOutput)
+}
+
+// parseServerVersion reads the server version from `kubectl version -o json`. Some
+// providers report minor versions like `21+`, so only the leading digits are used.
+func parseServerVersion(output []byte) (int, int, error) {
+	version := struct {
+		ServerVersion *struct {
+			Major string `json:"major"`
+			Minor string `json:"minor"`
+		} `json:"serverVersion"`
+	}{}
+	if err := json.Unmarshal(output, &version); err != nil {
+		return 0, 0, fmt.Errorf("Unable to parse `kubectl version` output: %v", err)
+	}
+	if version.ServerVersion == nil {
+		return 0, 0, fmt.Errorf("`kubectl version` did not report a server version")
+	}
+	major, err := strconv.Atoi(strings.TrimRight(version.ServerVersion.Major, "+"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Unable to parse server major version '%v'", version.ServerVersion.Major)
+	}
+	minor, err := strconv.Atoi(strings.TrimRight(version.ServerVersion.Minor, "+"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Unable to parse server minor version '%v'", version.ServerVersion.Minor)
+	}
+	return major, minor, nil
+}
+
 type KubeObject struct {
 	Kind     string
 	Metadata struct {
@@ -148,8 +278,48 @@ func getSelectorArgsForInput(ctx *ankh.ExecutionContext, input string, showWildC
 	return args, nil
 }
 
-func kubectlExec(ctx *ankh.ExecutionContext, kubectlCmd *exec.Cmd, input string,
-	skipStdin bool, skipStdoutAndStderr bool) (string, error) {
+// kubectlExec runs kubectlCmd, retrying it when it fails with a transient
+// error, eg: when the API server can't be reached. Commands whose output goes
+// straight to the terminal aren't retried, and neither is `rollback`, whose
+// `rollout undo` isn't safe to repeat.
+func kubectlExec(ctx *ankh.ExecutionContext, kubectlCmd *exec.Cmd, input io.Reader,
+	skipStdin bool, skipStdoutAndStderr bool, timeout time.Duration) (string, error) {
+	if skipStdoutAndStderr || ctx.Mode == ankh.Rollback {
+		return kubectlExecOnce(ctx, kubectlCmd, input, skipStdin, skipStdoutAndStderr, timeout)
+	}
+
+	what := "kubectl"
+	if len(kubectlCmd.Args) > 1 {
+		what = fmt.Sprintf("`kubectl %v`", kubectlCmd.Args[1])
+	}
+	var out string
+	cmd := kubectlCmd
+	// input can only be read once, so what's been read of it is kept, for
+	// retries to read again before the rest of it.
+	var read bytes.Buffer
+	err := ctx.Retry(what, func() error {
+		var err error
+		stdin := io.MultiReader(bytes.NewReader(read.Bytes()), io.TeeReader(input, &read))
+		out, err = kubectlExecOnce(ctx, cmd, stdin, skipStdin, skipStdoutAndStderr, timeout)
+		// A command can only be run once, so retries run a copy.
+		cmd = copyCommand(ctx, kubectlCmd)
+		return err
+	})
+	return out, err
+}
+
+func copyCommand(ctx *ankh.ExecutionContext, cmd *exec.Cmd) *exec.Cmd {
+	c := kubectlCommand(ctx, cmd.Path, cmd.Args[1:]...)
+	c.Args = cmd.Args
+	c.Env = cmd.Env
+	c.Dir = cmd.Dir
+	return c
+}
+
+// kubectlExecOnce runs kubectlCmd, streaming input to its stdin while reading
+// its stdout and stderr, so that large inputs and outputs never block it.
+func kubectlExecOnce(ctx *ankh.ExecutionContext, kubectlCmd *exec.Cmd, input io.Reader,
+	skipStdin bool, skipStdoutAndStderr bool, timeout time.Duration) (string, error) {
 	var kubectlStdoutPipe io.ReadCloser
 	var kubectlStderrPipe io.ReadCloser
 	var kubectlStdinPipe io.WriteCloser
@@ -157,7 +327,9 @@ func kubectlExec(ctx *ankh.ExecutionContext, kubectlCmd *exec.Cmd, input string,
 		kubectlStdoutPipe, _ = kubectlCmd.StdoutPipe()
 		kubectlStderrPipe, _ = kubectlCmd.StderrPipe()
 	} else {
-		kubectlCmd.Stdout = os.Stdout
+		if kubectlCmd.Stdout == nil {
+			kubectlCmd.Stdout = os.Stdout
+		}
 		kubectlCmd.Stderr = os.Stderr
 	}
 	if !skipStdin {
@@ -166,32 +338,64 @@ func kubectlExec(ctx *ankh.ExecutionContext, kubectlCmd *exec.Cmd, input string,
 		kubectlCmd.Stdin = os.Stdin
 	}
 
-	// We want to catch signals while running kubectl, which lets the user
-	// interrupt it gracefully.
-	ctx.CatchSignals = true
-	defer func() {
-		ctx.CatchSignals = false
-	}()
+	// We want to catch signals while kubectl writes to the terminal, which
+	// lets the user interrupt it gracefully, eg: `get --watch`. Otherwise an
+	// interrupt stops the run.
+	if skipStdoutAndStderr {
+		defer ankh.CatchSignals()()
+	}
 
+	record := ctx.StartCommand(kubectlCmd)
 	err := kubectlCmd.Start()
 	if err != nil {
+		if err = record.Finish(err); isStopped(err) {
+			return "", err
+		}
 		return "", fmt.Errorf("error starting the kubectl command: %v", err)
 	}
+	timedOut := killAfter(kubectlCmd, timeout)
 
+	var stdinBytes int64
+	stdinDone := make(chan struct{})
 	if !skipStdin {
-		kubectlStdinPipe.Write([]byte(input))
-		kubectlStdinPipe.Close()
+		go func() {
+			defer close(stdinDone)
+			stdinBytes, _ = io.Copy(kubectlStdinPipe, input)
+			kubectlStdinPipe.Close()
+		}()
+	} else {
+		close(stdinDone)
 	}
 
 	var kubectlOut, kubectlErr []byte
 	if !skipStdoutAndStderr {
+		stderrDone := make(chan struct{})
+		go func() {
+			defer close(stderrDone)
+			kubectlErr, _ = ioutil.ReadAll(kubectlStderrPipe)
+		}()
 		kubectlOut, _ = ioutil.ReadAll(kubectlStdoutPipe)
-		kubectlErr, _ = ioutil.ReadAll(kubectlStderrPipe)
+		<-stderrDone
 	}
+	<-stdinDone
 
 	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd)
 	err = kubectlCmd.Wait()
+	// The pipes are files, so count what went through them here.
+	if !skipStdin {
+		record.StdinBytes = stdinBytes
+	}
+	if !skipStdoutAndStderr {
+		record.StdoutBytes, record.StderrBytes = int64(len(kubectlOut)), int64(len(kubectlErr))
+	}
+	err = record.Finish(err)
 	ctx.Logger.Debugf("Kubectl command finished with err %+v", err)
+	if timedOut() {
+		return "", fmt.Errorf("the kubectl command timed out after %v", timeout)
+	}
+	if isStopped(err) {
+		return "", err
+	}
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			waitStatus := exitError.Sys().(syscall.WaitStatus)
@@ -215,24 +419,33 @@ func kubectlExec(ctx *ankh.ExecutionContext, kubectlCmd *exec.Cmd, input string,
 	return string(kubectlOut), nil
 }
 
-func kubectlCommonArgs(ctx *ankh.ExecutionContext, namespace string) []string {
-	kubectlArgs := []string{}
-
+// kubectlConnectionArgs select the cluster of the current context.
+func kubectlConnectionArgs(ctx *ankh.ExecutionContext) []string {
 	if ctx.AnkhConfig.CurrentContext.KubeServer != "" {
-		kubectlArgs = append(kubectlArgs, []string{"--server", ctx.AnkhConfig.CurrentContext.KubeServer}...)
-	} else {
-		kubectlArgs = append(kubectlArgs, []string{"--context", ctx.AnkhConfig.CurrentContext.KubeContext}...)
+		return []string{"--server", ctx.AnkhConfig.CurrentContext.KubeServer}
 	}
 
+	kubectlArgs := []string{"--context", ctx.AnkhConfig.CurrentContext.KubeContext}
+	if ctx.KubeConfigPath != "" {
+		kubectlArgs = append(kubectlArgs, []string{"--kubeconfig", ctx.KubeConfigPath}...)
+	}
+	return kubectlArgs
+}
+
+// kubectlReadArgs select the cluster and namespace, for commands that only
+// read from the cluster, which don't take `--dry-run`, eg: `get` and `diff`.
+func kubectlReadArgs(ctx *ankh.ExecutionContext, namespace string) []string {
+	kubectlArgs := kubectlConnectionArgs(ctx)
+
 	if namespace != "" {
 		kubectlArgs = append(kubectlArgs, []string{"--namespace", namespace}...)
 	}
 
-	if ctx.AnkhConfig.CurrentContext.KubeServer == "" {
-		if ctx.KubeConfigPath != "" {
-			kubectlArgs = append(kubectlArgs, []string{"--kubeconfig", ctx.KubeConfigPath}...)
-		}
-	}
+	return kubectlArgs
+}
+
+func kubectlCommonArgs(ctx *ankh.ExecutionContext, namespace string) []string {
+	kubectlArgs := kubectlReadArgs(ctx, namespace)
 
 	if ctx.DryRun {
 		kubectlArgs = append(kubectlArgs, "--dry-run")
@@ -241,22 +454,88 @@ func kubectlCommonArgs(ctx *ankh.ExecutionContext, namespace string) []string {
 	return kubectlArgs
 }
 
-func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
+// runKubectl runs a kubectl command against the current context, returning its stdout.
+func runKubectl(ctx *ankh.ExecutionContext, namespace string, stdin []byte, args ...string) ([]byte, error) {
+	kubectlArgs := append([]string{"kubectl"}, args...)
+	if len(args) > 0 && args[0] == "get" {
+		kubectlArgs = append(kubectlArgs, kubectlReadArgs(ctx, namespace)...)
+	} else {
+		kubectlArgs = append(kubectlArgs, kubectlCommonArgs(ctx, namespace)...)
+	}
+	kubectlCmd := kubectlCommand(ctx, kubectlArgs[0], kubectlArgs[1:]...)
+	if stdin != nil {
+		kubectlCmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	kubectlCmd.Stdout = &stdout
+	kubectlCmd.Stderr = &stderr
+
+	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+	record := ctx.StartCommand(kubectlCmd)
+	err := kubectlCmd.Run()
+	err = record.Finish(err)
+	if err != nil {
+		return stdout.Bytes(), fmt.Errorf("%v -- the kubectl process had the following output on stderr:\n%s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// combinedOutput runs kubectlCmd like CombinedOutput does, recording it on ctx.
+func combinedOutput(ctx *ankh.ExecutionContext, kubectlCmd *exec.Cmd) ([]byte, error) {
+	var output bytes.Buffer
+	kubectlCmd.Stdout = &output
+	kubectlCmd.Stderr = &output
+	record := ctx.StartCommand(kubectlCmd)
+	err := kubectlCmd.Run()
+	err = record.Finish(err)
+	return output.Bytes(), err
+}
+
+// Execute runs the kubectl command for ctx.Mode on the objects read from r.
+// `rollback` hands them to kubectl as they're read, so that kubectl can start
+// on them before they've all been templated. Every other command needs all of
+// them first, eg: to select objects by their labels, or to order them by kind.
+// `diff` is run by DiffStream instead, which also tells whether anything
+// differs.
+func Execute(ctx *ankh.ExecutionContext, r io.Reader, namespace string,
 	cmd func(name string, arg ...string) *exec.Cmd) (string, error) {
+	input := ""
+	stdin := r
+	if ctx.Mode != ankh.Rollback {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		input = string(b)
+		stdin = strings.NewReader(input)
+	}
+
 	skipStdin := false
 	skipStdoutAndStderr := false
 	if cmd == nil {
-		cmd = exec.Command
+		cmd = func(name string, arg ...string) *exec.Cmd { return kubectlCommand(ctx, name, arg...) }
+	}
+
+	if ctx.Mode == ankh.Pods && (ctx.Options.PodNodes || len(ctx.Options.OnNodes) > 0) {
+		return PodNodes(ctx, input, namespace, ctx.Options.OnNodes)
+	}
+
+	if ctx.Mode == ankh.Apply {
+		input = OrderByKind(input)
+		if out, split, err := applyCRDsFirst(ctx, input, namespace, cmd); split {
+			return out, err
+		}
 	}
 
 	kubectlArgs := []string{"kubectl"}
 	switch ctx.Mode {
-	case ankh.Diff:
-		kubectlArgs = append(kubectlArgs, []string{"alpha", "diff", "LAST", "LOCAL"}...)
 	case ankh.Logs:
 		fallthrough // We treat logs commands like a "get" until we choose a pod to get logs for
 	case ankh.Exec:
 		fallthrough // We treat exec commands like a "get" until we choose a pod to call exec on
+	case ankh.Cp:
+		fallthrough // We treat cp commands like a "get" until we choose a pod to copy to or from
 	case ankh.Pods:
 		fallthrough // Pods is just a `get`.
 	case ankh.Get:
@@ -265,6 +544,8 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 			verb = "describe"
 		}
 		kubectlArgs = append(kubectlArgs, verb)
+	case ankh.Describe:
+		kubectlArgs = append(kubectlArgs, "describe")
 	case ankh.Rollback:
 		kubectlArgs = append(kubectlArgs, []string{"rollout", "undo"}...)
 	case ankh.Explain:
@@ -277,13 +558,17 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 
 	// Decide if we should use selectors for input args instead of stdin
 	outputMode := []string{}
-	if !ctx.Describe {
+	if ctx.Options.OutputFormat != "" {
+		outputMode = []string{"-o", ctx.Options.OutputFormat}
+	} else if !ctx.Describe {
 		outputMode = []string{"-o", "wide"}
 	}
-	showWildcardLabels := !ctx.Describe
+	showWildcardLabels := !ctx.Describe && isTableFormat(ctx.Options.OutputFormat)
 	switch ctx.Mode {
 	case ankh.Exec:
 		fallthrough
+	case ankh.Cp:
+		fallthrough
 	case ankh.Logs:
 		outputMode = []string{"-o", "go-template", "--template={{ range .items }}{{ printf \"%s|\" .metadata.name }}{{ range .spec.containers }}{{ printf \"%s,\" .name }}{{ end }}{{ printf \"\\n\" }}{{ end }}"}
 		showWildcardLabels = false
@@ -301,13 +586,28 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 			skipStdoutAndStderr = true
 		}
 	case ankh.Get:
-		skipStdoutAndStderr = true
+		// Extra args may change the output format, so only format tables.
+		skipStdoutAndStderr = len(ctx.ExtraArgs) > 0 || ctx.Describe || !isTableFormat(ctx.Options.OutputFormat)
+		if ctx.Options.OutputFormat != "" {
+			kubectlArgs = append(kubectlArgs, outputMode...)
+		}
 		args, err := getSelectorArgsForInput(ctx, input, showWildcardLabels)
 		if err != nil {
 			return "", err
 		}
 		kubectlArgs = append(kubectlArgs, args...)
 		skipStdin = true
+	case ankh.Describe:
+		// Describe each object by name, rather than by selector, so that we
+		// don't also describe objects that only share labels with them.
+		objects := EventObjects(input)
+		if len(objects) == 0 {
+			ctx.Logger.Warnf("No objects to describe in namespace \"%v\"", namespace)
+			return "", nil
+		}
+		kubectlArgs = append(kubectlArgs, objects...)
+		skipStdin = true
+		skipStdoutAndStderr = true
 	default:
 		kubectlArgs = append(kubectlArgs, "-f", "-")
 	}
@@ -318,6 +618,8 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 	case ankh.Logs:
 		// Extra args for `logs` etc come later, after we do the initial `get`.
 		fallthrough
+	case ankh.Cp:
+		fallthrough
 	case ankh.Exec:
 		break
 	default:
@@ -332,14 +634,21 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 		return strings.Join(kubectlCmd.Args, " "), nil
 	}
 
-	kubectlOut, err := kubectlExec(ctx, kubectlCmd, input, skipStdin, skipStdoutAndStderr)
+	kubectlOut, err := kubectlExec(ctx, kubectlCmd, stdin, skipStdin, skipStdoutAndStderr, 0)
 	if err != nil {
 		return kubectlOut, err
 	}
 
 	switch ctx.Mode {
+	case ankh.Get:
+		if skipStdoutAndStderr {
+			return kubectlOut, nil
+		}
+		return FormatGet(input, kubectlOut, isatty.IsTerminal(os.Stdout.Fd())), nil
 	case ankh.Exec:
 		fallthrough
+	case ankh.Cp:
+		fallthrough
 	case ankh.Logs:
 		if len(kubectlOut) <= 1 {
 			suggestion := ""
@@ -350,6 +659,13 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 				namespace, suggestion)
 		}
 
+		if ctx.Mode == ankh.Exec && ctx.Options.ExecAll {
+			return execAll(ctx, cmd, commonArgs, kubectlOut)
+		}
+		if ctx.Mode == ankh.Logs && ctx.Options.LogsAll {
+			return logsAll(ctx, cmd, commonArgs, kubectlOut)
+		}
+
 		// Split the output line by line, and then again by `|` so the user can select a pod.
 		// This works in conjunction with the `go-template` `outputMode` used when selecting pods with kubectl.
 		pods := []string{}
@@ -358,7 +674,12 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 			split := strings.Split(line, "|")
 			pods = append(pods, split[0])
 		}
-		if len(pods) > 1 {
+		if ctx.Mode == ankh.Exec || ctx.Mode == ankh.Cp {
+			podSelection, err = selectExecPod(ctx, pods)
+			if err != nil {
+				return "", err
+			}
+		} else if len(pods) > 1 {
 			podSelection, err = util.PromptForSelection(pods, "Select a pod")
 			if err != nil {
 				return "", err
@@ -381,14 +702,16 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 		}
 
 		// It's possible that container was already specified via `-c` as extra args.
-		containerSelected := false
-		for _, extra := range ctx.ExtraArgs {
-			if extra == "-c" {
-				containerSelected = true
-				break
+		containerArg, extraArgs := extractContainerArg(ctx.ExtraArgs)
+		if ctx.Mode == ankh.Logs && ctx.Options.LogsAllContainers {
+			containerSelection = ""
+		} else if containerArg != "" {
+			containerSelection = containerArg
+		} else if len(containers) > 1 {
+			if ctx.Mode != ankh.Logs && !execInteractive(ctx) {
+				return "", fmt.Errorf("Pod %v has %v containers [ %v ], and there's no terminal to select one on. Use -c to choose one",
+					podSelection, len(containers), strings.Join(containers, ", "))
 			}
-		}
-		if !containerSelected && len(containers) > 1 {
 			containerSelection, err = util.PromptForSelection(containers, "Select a container")
 			if err != nil {
 				return "", err
@@ -397,23 +720,58 @@ func Execute(ctx *ankh.ExecutionContext, input string, namespace string,
 			containerSelection = containers[0]
 		}
 
+		if ctx.Mode == ankh.Cp {
+			kubectlArgs := append([]string{"kubectl", "cp"}, commonArgs...)
+			kubectlArgs = append(kubectlArgs, extraArgs...)
+			kubectlArgs = append(kubectlArgs, cpPath(ctx.Options.CpSource, podSelection), cpPath(ctx.Options.CpDestination, podSelection), "-c", containerSelection)
+			return kubectlExec(ctx, cmd(kubectlArgs[0], kubectlArgs[1:]...), nil, true, true, 0)
+		}
+
 		// We need to call kubectl again, given a pod argument chosen by the user.
 		kubectlArgs := []string{}
+		timeout := time.Duration(0)
 		switch ctx.Mode {
 		case ankh.Exec:
-			kubectlArgs = append(kubectlArgs, []string{"kubectl", "exec", "-it"}...)
+			kubectlArgs = append(kubectlArgs, []string{"kubectl", "exec", "-i"}...)
+			if execTTY() {
+				kubectlArgs = append(kubectlArgs, "-t")
+			}
+			timeout = ctx.Options.ExecTimeout
 		case ankh.Logs:
 			kubectlArgs = append(kubectlArgs, []string{"kubectl", "logs"}...)
 		}
 		kubectlArgs = append(kubectlArgs, commonArgs...)
-		kubectlArgs = append(kubectlArgs, ctx.ExtraArgs...)
+		kubectlArgs = append(kubectlArgs, extraArgs...)
 		kubectlArgs = append(kubectlArgs, podSelection)
-		kubectlArgs = append(kubectlArgs, []string{"-c", containerSelection}...)
+		if containerSelection != "" {
+			kubectlArgs = append(kubectlArgs, []string{"-c", containerSelection}...)
+		} else {
+			kubectlArgs = append(kubectlArgs, "--all-containers", "--prefix")
+		}
 		if len(ctx.PassThroughArgs) > 0 {
 			kubectlArgs = append(kubectlArgs, append([]string{"--"}, ctx.PassThroughArgs...)...)
 		}
 		kubectlCmd := cmd(kubectlArgs[0], kubectlArgs[1:]...)
-		return kubectlExec(ctx, kubectlCmd, "", true, true)
+		if ctx.Mode == ankh.Logs {
+			var stdout io.Writer = os.Stdout
+			if ctx.Options.LogsOutputPath != "" {
+				f, err := os.OpenFile(ctx.Options.LogsOutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+				if err != nil {
+					return "", fmt.Errorf("Unable to open logs output file: %v", err)
+				}
+				defer f.Close()
+				if containerSelection == "" {
+					ctx.Logger.Infof("Appending logs for all containers of pod \"%v\" to %v", podSelection, ctx.Options.LogsOutputPath)
+				} else {
+					ctx.Logger.Infof("Appending logs for pod \"%v\" container \"%v\" to %v", podSelection, containerSelection, ctx.Options.LogsOutputPath)
+				}
+				stdout = io.MultiWriter(os.Stdout, f)
+			}
+			stdout, flush := grepLogs(ctx, stdout)
+			defer flush()
+			kubectlCmd.Stdout = stdout
+		}
+		return kubectlExec(ctx, kubectlCmd, nil, true, true, timeout)
 	default:
 		return string(kubectlOut), nil
 	}
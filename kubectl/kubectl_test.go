@@ -0,0 +1,220 @@
+package kubectl
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestKubeContextNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-kube-context")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for `kubectl config view`, with a namespace on the `dev` kube-context only.
+	script := "#!/bin/sh\ncase \"$*\" in\n*\"--context dev \"*\"--kubeconfig /tmp/kubeconfig\"*) echo team-dev ;;\nesac\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), KubeConfigPath: "/tmp/kubeconfig"}
+	for _, test := range []struct {
+		kubeContext string
+		expected    string
+	}{
+		{"dev", "team-dev"},
+		{"prod", ""},
+	} {
+		ctx.AnkhConfig.CurrentContext = ankh.Context{KubeContext: test.kubeContext}
+		namespace, err := KubeContextNamespace(ctx)
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		if namespace != test.expected {
+			t.Logf("expected namespace '%v' for kube-context %v but got '%v'", test.expected, test.kubeContext, namespace)
+			t.Fail()
+		}
+	}
+
+	ctx.AnkhConfig.CurrentContextName = "minikube"
+	ctx.AnkhConfig.CurrentContext = ankh.Context{}
+	if _, err := KubeContextNamespace(ctx); err == nil {
+		t.Log("expected an error for a context without a kube-context")
+		t.Fail()
+	}
+}
+
+func TestExecuteLogsOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-logs")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "incident.log")
+	if err := ioutil.WriteFile(output, []byte("earlier\n"), 0644); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Logs, Options: ankh.CommandOptions{LogsOutputPath: output}}
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		if arg[0] == "get" {
+			return exec.Command("printf", "web-1|app,\n")
+		}
+		return exec.Command("echo", "a log line")
+	}
+	if _, err := Execute(ctx, strings.NewReader(getTestInput), "team", cmd); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	body, _ := ioutil.ReadFile(output)
+	if string(body) != "earlier\na log line\n" {
+		t.Logf("expected logs to be appended to the output file but found '%v'", string(body))
+		t.Fail()
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	for output, expected := range map[string][2]int{
+		`{"clientVersion": {"major": "1", "minor": "28"}, "serverVersion": {"major": "1", "minor": "21"}}`:  {1, 21},
+		`{"clientVersion": {"major": "1", "minor": "28"}, "serverVersion": {"major": "1", "minor": "23+"}}`: {1, 23},
+	} {
+		major, minor, err := parseServerVersion([]byte(output))
+		if err != nil || major != expected[0] || minor != expected[1] {
+			t.Logf("expected %v from '%v' but got %v.%v (%v)", expected, output, major, minor, err)
+			t.Fail()
+		}
+	}
+
+	_, _, err := parseServerVersion([]byte(`{"clientVersion": {"major": "1", "minor": "28"}}`))
+	if err == nil {
+		t.Log("expected to find an error but didnt get one")
+		t.Fail()
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	valid := []string{"", "wide", "json", "yaml", "name", "custom-columns=NAME:.metadata.name,NODE:.spec.nodeName", `jsonpath={range .items[*]}{.metadata.name}{"\n"}{end}`}
+	for _, format := range valid {
+		if err := ValidateOutputFormat(ankh.Get, format); err != nil {
+			t.Logf("expected '%v' to be valid, but got %v", format, err)
+			t.Fail()
+		}
+	}
+
+	invalid := []string{"xml", "custom-columns=", "custom-columns=NAME", "custom-columns=:.metadata.name", "jsonpath=", "jsonpath={.items"}
+	for _, format := range invalid {
+		if err := ValidateOutputFormat(ankh.Pods, format); err == nil {
+			t.Logf("expected '%v' to be invalid", format)
+			t.Fail()
+		}
+	}
+
+	if err := ValidateOutputFormat(ankh.Logs, "json"); err == nil {
+		t.Logf("expected output formats to be invalid for logs")
+		t.Fail()
+	}
+}
+
+func TestExecuteOutputFormat(t *testing.T) {
+	input := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    release: canary
+`
+	for _, mode := range []ankh.Mode{ankh.Get, ankh.Pods} {
+		ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: mode, Options: ankh.CommandOptions{OutputFormat: "json"}}
+		ctx.AnkhConfig.Kubectl.WildCardLabels = []string{"release"}
+		var args []string
+		cmd := func(name string, arg ...string) *exec.Cmd {
+			args = arg
+			return exec.Command("true")
+		}
+		if _, err := Execute(ctx, strings.NewReader(input), "team", cmd); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+
+		joined := " " + strings.Join(args, " ") + " "
+		if !strings.Contains(joined, " -o json ") || strings.Contains(joined, " wide ") || strings.Contains(joined, " -L ") {
+			t.Logf("unexpected kubectl args for %v: %v", mode, args)
+			t.Fail()
+		}
+	}
+}
+
+func TestExecuteDescribe(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Describe}
+	var args []string
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		args = arg
+		return exec.Command("true")
+	}
+	if _, err := Execute(ctx, strings.NewReader(getTestInput), "team", cmd); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	if len(args) < 3 || args[0] != "describe" || args[1] != "deployment/web" || args[2] != "service/web" {
+		t.Logf("expected to describe each object by name but got args %v", args)
+		t.Fail()
+	}
+}
+
+func TestDiffStreamRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-diff")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// The first attempt reads some of the input, then fails to connect, so
+	// the retry has to read what was read of the input again. `kubectl diff`
+	// exits 1 for differences, and greater than 1 for errors.
+	tried := filepath.Join(dir, "tried")
+	script := `if [ ! -f ` + tried + ` ]; then touch ` + tried + `; head -c 10 > /dev/null; echo "dial tcp: connection refused" >&2; exit 2; fi; cat; exit 1`
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Diff}
+	ctx.AnkhConfig.Retry.Backoff = "1ms"
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", script)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		for _, doc := range strings.Split(getTestInput, "\n---") {
+			io.WriteString(w, doc+"\n---")
+		}
+		w.Close()
+	}()
+	out, differs, err := DiffStream(ctx, r, "team", cmd)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if expected := getTestInput + "\n---"; out != expected || !differs {
+		t.Logf("expected kubectl to read all of the input and find differences but got '%v' (%v)", out, differs)
+		t.Fail()
+	}
+}
@@ -0,0 +1,193 @@
+package kubectl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// Deploy locks are ConfigMaps in the namespace being applied to. Creating a
+// ConfigMap is atomic, so only one ankh run can hold a lock at a time.
+const (
+	lockLabel              = "ankh.appnexus.com/deploy-lock"
+	lockHolderAnnotation   = "ankh.appnexus.com/lock-holder"
+	lockIDAnnotation       = "ankh.appnexus.com/lock-id"
+	lockAcquiredAnnotation = "ankh.appnexus.com/lock-acquired"
+)
+
+// DeployLock describes who holds the deploy lock for a release in a namespace.
+type DeployLock struct {
+	Name            string
+	Namespace       string
+	Holder          string
+	ID              string
+	Acquired        time.Time
+	resourceVersion string
+}
+
+type lockConfigMap struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+		Labels          map[string]string `json:"labels,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+}
+
+func (cm lockConfigMap) lock() DeployLock {
+	acquired, _ := time.Parse(time.RFC3339, cm.Metadata.Annotations[lockAcquiredAnnotation])
+	return DeployLock{
+		Name:            cm.Metadata.Name,
+		Namespace:       cm.Metadata.Namespace,
+		Holder:          cm.Metadata.Annotations[lockHolderAnnotation],
+		ID:              cm.Metadata.Annotations[lockIDAnnotation],
+		Acquired:        acquired,
+		resourceVersion: cm.Metadata.ResourceVersion,
+	}
+}
+
+func (lock DeployLock) configMap() lockConfigMap {
+	cm := lockConfigMap{APIVersion: "v1", Kind: "ConfigMap"}
+	cm.Metadata.Name = lock.Name
+	cm.Metadata.Namespace = lock.Namespace
+	cm.Metadata.ResourceVersion = lock.resourceVersion
+	cm.Metadata.Labels = map[string]string{lockLabel: "true"}
+	cm.Metadata.Annotations = map[string]string{
+		lockHolderAnnotation:   lock.Holder,
+		lockIDAnnotation:       lock.ID,
+		lockAcquiredAnnotation: lock.Acquired.Format(time.RFC3339),
+	}
+	return cm
+}
+
+// LockName is the name of the deploy lock for a release, or for releaseless charts.
+func LockName(release string) string {
+	if release == "" {
+		return "ankh-lock"
+	}
+	return "ankh-lock-" + release
+}
+
+// GetLock returns the deploy lock with the given name in a namespace, or nil if nobody holds it.
+func GetLock(ctx *ankh.ExecutionContext, namespace string, name string) (*DeployLock, error) {
+	out, err := runKubectl(ctx, namespace, nil, "get", "configmap", name, "--ignore-not-found", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+
+	cm := lockConfigMap{}
+	if err := json.Unmarshal(out, &cm); err != nil {
+		return nil, fmt.Errorf("Unable to parse deploy lock '%v' in namespace \"%v\": %v", name, namespace, err)
+	}
+	lock := cm.lock()
+	return &lock, nil
+}
+
+// ListLocks returns the deploy locks held in a namespace, or in every namespace if namespace is empty.
+func ListLocks(ctx *ankh.ExecutionContext, namespace string) ([]DeployLock, error) {
+	args := []string{"get", "configmaps", "-l", lockLabel + "=true", "-o", "json"}
+	if namespace == "" {
+		args = append(args, "--all-namespaces")
+	}
+	out, err := runKubectl(ctx, namespace, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	list := struct {
+		Items []lockConfigMap `json:"items"`
+	}{}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("Unable to parse deploy locks: %v", err)
+	}
+
+	locks := []DeployLock{}
+	for _, cm := range list.Items {
+		locks = append(locks, cm.lock())
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].Namespace != locks[j].Namespace {
+			return locks[i].Namespace < locks[j].Namespace
+		}
+		return locks[i].Name < locks[j].Name
+	})
+	return locks, nil
+}
+
+// AcquireLock takes the deploy lock for a namespace, failing fast with the
+// name of the holder if somebody else has it. Locks older than ttl are
+// considered abandoned and taken over.
+func AcquireLock(ctx *ankh.ExecutionContext, namespace string, lock DeployLock, ttl time.Duration) error {
+	lock.Namespace = namespace
+	body, err := json.Marshal(lock.configMap())
+	if err != nil {
+		return err
+	}
+
+	_, err = runKubectl(ctx, namespace, body, "create", "-f", "-")
+	if err == nil {
+		return nil
+	}
+	if !strings.Contains(err.Error(), "AlreadyExists") {
+		return fmt.Errorf("Unable to acquire deploy lock '%v' in namespace \"%v\": %v", lock.Name, namespace, err)
+	}
+
+	existing, err := GetLock(ctx, namespace, lock.Name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		// Released between our create and get, so try again.
+		return AcquireLock(ctx, namespace, lock, ttl)
+	}
+	if existing.ID == lock.ID {
+		return nil
+	}
+
+	if time.Since(existing.Acquired) < ttl {
+		return fmt.Errorf("Namespace \"%v\" is locked by %v since %v (deploy lock '%v'). "+
+			"Wait for their run to finish, or use `ankh lock release --force` if the lock is stale",
+			namespace, existing.Holder, existing.Acquired.Format(time.RFC3339), lock.Name)
+	}
+
+	// Replacing using the existing resource version fails if somebody else takes it over first.
+	ctx.Logger.Warnf("Taking over deploy lock '%v' in namespace \"%v\" held by %v since %v, which is older than %v",
+		lock.Name, namespace, existing.Holder, existing.Acquired.Format(time.RFC3339), ttl)
+	lock.resourceVersion = existing.resourceVersion
+	body, err = json.Marshal(lock.configMap())
+	if err != nil {
+		return err
+	}
+	if _, err := runKubectl(ctx, namespace, body, "replace", "-f", "-"); err != nil {
+		return fmt.Errorf("Unable to take over deploy lock '%v' in namespace \"%v\": %v", lock.Name, namespace, err)
+	}
+	return nil
+}
+
+// ReleaseLock releases a deploy lock. Unless force is set, it is only released if it is still held by id.
+func ReleaseLock(ctx *ankh.ExecutionContext, namespace string, name string, id string, force bool) error {
+	existing, err := GetLock(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil
+	}
+	if !force && existing.ID != id {
+		return fmt.Errorf("Deploy lock '%v' in namespace \"%v\" is held by %v, not us", name, namespace, existing.Holder)
+	}
+
+	_, err = runKubectl(ctx, namespace, nil, "delete", "configmap", name, "--ignore-not-found")
+	return err
+}
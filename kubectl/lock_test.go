@@ -0,0 +1,49 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLockName(t *testing.T) {
+	if LockName("") != "ankh-lock" || LockName("canary") != "ankh-lock-canary" {
+		t.Logf("unexpected lock names %v and %v", LockName(""), LockName("canary"))
+		t.Fail()
+	}
+}
+
+func TestLockConfigMap(t *testing.T) {
+	acquired, _ := time.Parse(time.RFC3339, "2018-11-16T16:00:00Z")
+	lock := DeployLock{
+		Name:      "ankh-lock-canary",
+		Namespace: "web",
+		Holder:    "alice@laptop",
+		ID:        "alice@laptop-123-456",
+		Acquired:  acquired,
+	}
+
+	body, err := json.Marshal(lock.configMap())
+	if err != nil {
+		t.Logf("got error %v", err)
+		t.Fail()
+		return
+	}
+
+	cm := lockConfigMap{}
+	if err := json.Unmarshal(body, &cm); err != nil {
+		t.Logf("got error %v", err)
+		t.Fail()
+		return
+	}
+	if cm.Kind != "ConfigMap" || cm.Metadata.Labels[lockLabel] != "true" {
+		t.Logf("unexpected config map %s", body)
+		t.Fail()
+	}
+
+	roundTripped := cm.lock()
+	if roundTripped != lock {
+		t.Logf("expected %+v but got %+v", lock, roundTripped)
+		t.Fail()
+	}
+}
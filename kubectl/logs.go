@@ -0,0 +1,241 @@
+package kubectl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	isatty "github.com/mattn/go-isatty"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// logsColors cycle through pods, so that their lines are easy to tell apart.
+var logsColors = []string{"\x1b[36m", "\x1b[32m", "\x1b[33m", "\x1b[35m", "\x1b[34m", "\x1b[31m"}
+
+// logsReconnectDelay is how long to wait before following a container's logs again.
+var logsReconnectDelay = 2 * time.Second
+
+// grepWriter only writes lines that match re.
+type grepWriter struct {
+	w   io.Writer
+	re  *regexp.Regexp
+	buf []byte
+}
+
+func (g *grepWriter) Write(b []byte) (int, error) {
+	g.buf = append(g.buf, b...)
+	for {
+		i := bytes.IndexByte(g.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := g.writeLine(g.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		g.buf = g.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes any remaining partial line, if it matches.
+func (g *grepWriter) Flush() error {
+	if len(g.buf) == 0 {
+		return nil
+	}
+	err := g.writeLine(append(g.buf, '\n'))
+	g.buf = nil
+	return err
+}
+
+func (g *grepWriter) writeLine(line []byte) error {
+	if !g.re.Match(line) {
+		return nil
+	}
+	_, err := g.w.Write(line)
+	return err
+}
+
+// grepLogs filters w with the `--grep` regex, if there is one.
+func grepLogs(ctx *ankh.ExecutionContext, w io.Writer) (io.Writer, func() error) {
+	if ctx.Options.LogsGrep == nil {
+		return w, func() error { return nil }
+	}
+	g := &grepWriter{w: w, re: ctx.Options.LogsGrep}
+	return g, g.Flush
+}
+
+type logsTarget struct {
+	Pod       string
+	Container string
+}
+
+// logsTargets are the containers to stream from: the container chosen with
+// `-c` in each pod that has it, or else every container, in at most maxPods pods.
+func logsTargets(ctx *ankh.ExecutionContext, pods []podContainers, container string, maxPods int) []logsTarget {
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Pod < pods[j].Pod })
+	if maxPods > 0 && len(pods) > maxPods {
+		ctx.Logger.Warnf("Streaming logs from %v of %v pods. Use `--max-pods` to stream from more", maxPods, len(pods))
+		pods = pods[:maxPods]
+	}
+
+	targets := []logsTarget{}
+	for _, pod := range pods {
+		if container != "" {
+			if !util.Contains(pod.Containers, container) {
+				ctx.Logger.Warnf("Skipping pod %v, which has no container named '%v'", pod.Pod, container)
+				continue
+			}
+			targets = append(targets, logsTarget{Pod: pod.Pod, Container: container})
+			continue
+		}
+		for _, c := range pod.Containers {
+			targets = append(targets, logsTarget{Pod: pod.Pod, Container: c})
+		}
+	}
+	return targets
+}
+
+// reconnectArgs replaces `--tail N` or `--since D` in args with a new
+// `--since`, so that following a container again picks up where the last
+// stream left off.
+func reconnectArgs(args []string, since time.Duration) []string {
+	reconnect := []string{}
+	for i := 0; i < len(args); i++ {
+		if (args[i] == "--tail" || args[i] == "--since") && i+1 < len(args) {
+			i++
+			continue
+		}
+		reconnect = append(reconnect, args[i])
+	}
+	seconds := int(since.Seconds()) + 1
+	return append(reconnect, "--since", fmt.Sprintf("%vs", seconds))
+}
+
+// logsAll streams the logs of many pods at once, prefixing each line with its
+// pod and container. When following, streams that end because a container
+// restarted are reconnected, until the pod is gone or ankh is interrupted.
+func logsAll(ctx *ankh.ExecutionContext, cmd func(name string, arg ...string) *exec.Cmd,
+	commonArgs []string, kubectlOut string) (string, error) {
+	container, extraArgs := extractContainerArg(ctx.ExtraArgs)
+	targets := logsTargets(ctx, parsePodContainers(kubectlOut), container, ctx.Options.LogsMaxPods)
+	if len(targets) == 0 {
+		return "", fmt.Errorf("No containers to get logs for")
+	}
+	follow := util.Contains(extraArgs, "-f")
+
+	var outputFile io.Writer
+	if ctx.Options.LogsOutputPath != "" {
+		f, err := os.OpenFile(ctx.Options.LogsOutputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return "", fmt.Errorf("Unable to open logs output file: %v", err)
+		}
+		defer f.Close()
+		ctx.Logger.Infof("Appending logs for %v containers to %v", len(targets), ctx.Options.LogsOutputPath)
+		outputFile = f
+	}
+	color := isatty.IsTerminal(os.Stdout.Fd())
+
+	// We want to catch signals while running kubectl, which lets the user
+	// interrupt it gracefully.
+	defer ankh.CatchSignals()()
+
+	podColors := make(map[string]string)
+	for _, target := range targets {
+		if _, ok := podColors[target.Pod]; !ok {
+			podColors[target.Pod] = logsColors[len(podColors)%len(logsColors)]
+		}
+	}
+
+	var mtx sync.Mutex
+	interrupted := false
+	stream := func(target logsTarget) {
+		prefix := fmt.Sprintf("[%v/%v] ", target.Pod, target.Container)
+		var stdout io.Writer
+		writers := []*util.PrefixWriter{}
+		if color {
+			writers = append(writers, util.NewPrefixWriter(os.Stdout, &mtx, podColors[target.Pod]+prefix+"\x1b[0m"))
+		} else {
+			writers = append(writers, util.NewPrefixWriter(os.Stdout, &mtx, prefix))
+		}
+		stdout = writers[0]
+		if outputFile != nil {
+			writers = append(writers, util.NewPrefixWriter(outputFile, &mtx, prefix))
+			stdout = io.MultiWriter(writers[0], writers[1])
+		}
+		stdout, flush := grepLogs(ctx, stdout)
+		defer func() {
+			flush()
+			for _, w := range writers {
+				w.Flush()
+			}
+		}()
+
+		args := extraArgs
+		for {
+			kubectlArgs := []string{"kubectl", "logs"}
+			kubectlArgs = append(kubectlArgs, commonArgs...)
+			kubectlArgs = append(kubectlArgs, args...)
+			kubectlArgs = append(kubectlArgs, target.Pod, "-c", target.Container)
+			kubectlCmd := cmd(kubectlArgs[0], kubectlArgs[1:]...)
+			var stderr bytes.Buffer
+			kubectlCmd.Stdout = stdout
+			kubectlCmd.Stderr = &stderr
+
+			ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+			record := ctx.StartCommand(kubectlCmd)
+			err := kubectlCmd.Run()
+			err = record.Finish(err)
+			disconnected := time.Now()
+			if exitError, ok := err.(*exec.ExitError); ok {
+				if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+					mtx.Lock()
+					interrupted = true
+					mtx.Unlock()
+					return
+				}
+			}
+			if err != nil && strings.Contains(stderr.String(), "NotFound") {
+				ctx.Logger.Infof("Pod %v is gone, so no longer streaming its logs", target.Pod)
+				return
+			}
+			if err != nil {
+				ctx.Logger.Warnf("Logs for %v ended: %v %v", strings.TrimSpace(prefix), err, strings.TrimSpace(stderr.String()))
+			}
+			if !follow {
+				return
+			}
+
+			time.Sleep(logsReconnectDelay)
+			mtx.Lock()
+			stop := interrupted
+			mtx.Unlock()
+			if stop {
+				return
+			}
+			ctx.Logger.Infof("Reconnecting to %v", strings.TrimSpace(prefix))
+			args = reconnectArgs(extraArgs, time.Since(disconnected))
+		}
+	}
+
+	ctx.Logger.Infof("Streaming logs from %v containers", len(targets))
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target logsTarget) {
+			defer wg.Done()
+			stream(target)
+		}(target)
+	}
+	wg.Wait()
+	return "", nil
+}
@@ -0,0 +1,134 @@
+package kubectl
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestLogsTargets(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	pods := parsePodContainers("web-2|app,sidecar,\nweb-1|app,\nweb-3|sidecar,\n")
+
+	targets := logsTargets(ctx, pods, "app", 2)
+	expected := []logsTarget{{"web-1", "app"}, {"web-2", "app"}}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Logf("expected %v but got %v", expected, targets)
+		t.Fail()
+	}
+
+	targets = logsTargets(ctx, pods, "", 0)
+	if len(targets) != 4 {
+		t.Logf("expected every container of every pod but got %v", targets)
+		t.Fail()
+	}
+}
+
+func TestReconnectArgs(t *testing.T) {
+	args := reconnectArgs([]string{"-f", "--tail", "10", "--since", "1h", "--timestamps"}, 3*time.Second)
+	expected := []string{"-f", "--timestamps", "--since", "4s"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Logf("expected %v but got %v", expected, args)
+		t.Fail()
+	}
+}
+
+func TestExecuteLogsAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-logs")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "all.log")
+
+	defer func(delay time.Duration) { logsReconnectDelay = delay }(logsReconnectDelay)
+	logsReconnectDelay = 0
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Logs, ExtraArgs: []string{"-f", "--tail", "5"},
+		Options: ankh.CommandOptions{LogsOutputPath: output, LogsAll: true, LogsMaxPods: 10}}
+	var mtx sync.Mutex
+	calls := map[string]int{}
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		if arg[0] == "get" {
+			return exec.Command("printf", "web-1|app,\nweb-2|app,\n")
+		}
+		pod := arg[len(arg)-3]
+		mtx.Lock()
+		defer mtx.Unlock()
+		calls[pod]++
+		if calls[pod] > 1 {
+			if !strings.Contains(strings.Join(arg, " "), "--since") {
+				return exec.Command("echo", "expected --since when reconnecting")
+			}
+			return exec.Command("sh", "-c", "echo 'pods \""+pod+"\" NotFound' >&2; exit 1")
+		}
+		return exec.Command("echo", "hello from "+pod)
+	}
+	if _, err := Execute(ctx, strings.NewReader(getTestInput), "team", cmd); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	body, _ := ioutil.ReadFile(output)
+	for _, line := range []string{"[web-1/app] hello from web-1\n", "[web-2/app] hello from web-2\n"} {
+		if !strings.Contains(string(body), line) {
+			t.Logf("expected '%v' in '%v'", line, string(body))
+			t.Fail()
+		}
+	}
+	if strings.Contains(string(body), "expected") {
+		t.Logf("unexpected reconnect args: %v", string(body))
+		t.Fail()
+	}
+	if calls["web-1"] != 2 || calls["web-2"] != 2 {
+		t.Logf("expected each pod to reconnect once but got %v", calls)
+		t.Fail()
+	}
+}
+
+func TestExecuteLogsGrepAllContainers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-logs")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "grep.log")
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Logs,
+		Options: ankh.CommandOptions{LogsOutputPath: output, LogsAllContainers: true, LogsGrep: regexp.MustCompile("ERROR")}}
+	var args []string
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		if arg[0] == "get" {
+			return exec.Command("printf", "web-1|app,sidecar,\n")
+		}
+		args = arg
+		return exec.Command("printf", "INFO starting\nERROR failed\nINFO done\nERROR partial")
+	}
+	if _, err := Execute(ctx, strings.NewReader(getTestInput), "team", cmd); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	if !strings.Contains(strings.Join(args, " "), "web-1 --all-containers") {
+		t.Logf("expected logs for all containers but got args %v", args)
+		t.Fail()
+	}
+	body, _ := ioutil.ReadFile(output)
+	if string(body) != "ERROR failed\nERROR partial\n" {
+		t.Logf("expected only matching lines but found '%v'", string(body))
+		t.Fail()
+	}
+}
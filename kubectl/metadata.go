@@ -0,0 +1,132 @@
+package kubectl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// podTemplatePaths are where the pod templates of each workload kind are,
+// whose metadata gets common labels and annotations too. The pod template is
+// the last of them.
+var podTemplatePaths = map[string][][]string{
+	"Deployment":            {{"spec", "template"}},
+	"StatefulSet":           {{"spec", "template"}},
+	"DaemonSet":             {{"spec", "template"}},
+	"ReplicaSet":            {{"spec", "template"}},
+	"ReplicationController": {{"spec", "template"}},
+	"Job":                   {{"spec", "template"}},
+	"CronJob":               {{"spec", "jobTemplate"}, {"spec", "jobTemplate", "spec", "template"}},
+}
+
+func mapSliceGet(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func mapSliceSet(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == key {
+			m[i].Value = value
+			return m
+		}
+	}
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
+
+// mergeMetadataField sets each of values in `metadata.<field>`, overriding
+// what's there.
+func mergeMetadataField(metadata yaml.MapSlice, field string, values map[string]string) yaml.MapSlice {
+	if len(values) == 0 {
+		return metadata
+	}
+	existing, _ := mapSliceGet(metadata, field).(yaml.MapSlice)
+	keys := []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		existing = mapSliceSet(existing, k, values[k])
+	}
+	return mapSliceSet(metadata, field, existing)
+}
+
+// injectMetadataAt merges labels and annotations into the metadata of the
+// object at path in obj, if there's one there.
+func injectMetadataAt(obj yaml.MapSlice, path []string, labels map[string]string, annotations map[string]string) yaml.MapSlice {
+	if len(path) == 0 {
+		metadata, _ := mapSliceGet(obj, "metadata").(yaml.MapSlice)
+		metadata = mergeMetadataField(metadata, "labels", labels)
+		metadata = mergeMetadataField(metadata, "annotations", annotations)
+		return mapSliceSet(obj, "metadata", metadata)
+	}
+	child, ok := mapSliceGet(obj, path[0]).(yaml.MapSlice)
+	if !ok {
+		return obj
+	}
+	return mapSliceSet(obj, path[0], injectMetadataAt(child, path[1:], labels, annotations))
+}
+
+// transformObjects calls transform with each object in templated output,
+// replacing the objects that it changes. The comments at the start of each
+// document, like `# Source:`, are kept.
+func transformObjects(input string, transform func(kind string, obj yaml.MapSlice) (yaml.MapSlice, bool)) (string, error) {
+	docs := strings.Split(input, "\n---")
+	for i, doc := range docs {
+		lines := strings.Split(doc, "\n")
+		n := 0
+		for n < len(lines) && (strings.TrimSpace(lines[n]) == "" || strings.HasPrefix(strings.TrimSpace(lines[n]), "#") ||
+			(i == 0 && n == 0 && strings.TrimSpace(lines[n]) == "---")) {
+			n++
+		}
+		body := strings.Join(lines[n:], "\n")
+
+		obj := yaml.MapSlice{}
+		if err := yaml.Unmarshal([]byte(body), &obj); err != nil {
+			return "", fmt.Errorf("Unable to parse templated object: %v", err)
+		}
+		kind, _ := mapSliceGet(obj, "kind").(string)
+		if kind == "" {
+			continue
+		}
+
+		obj, changed := transform(kind, obj)
+		if !changed {
+			continue
+		}
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		docs[i] = strings.Join(append(lines[:n], string(out)), "\n")
+	}
+	return strings.Join(docs, "\n---"), nil
+}
+
+// InjectMetadata merges labels and annotations into the metadata of every
+// object in templated output, and the metadata of the pod templates of
+// workloads, overriding what the charts set. Selectors are left alone, since
+// they can't be changed once they're applied.
+func InjectMetadata(input string, labels map[string]string, annotations map[string]string) (string, error) {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return input, nil
+	}
+	output, err := transformObjects(input, func(kind string, obj yaml.MapSlice) (yaml.MapSlice, bool) {
+		obj = injectMetadataAt(obj, nil, labels, annotations)
+		for _, path := range podTemplatePaths[kind] {
+			obj = injectMetadataAt(obj, path, labels, annotations)
+		}
+		return obj, true
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to add common labels and annotations: %v", err)
+	}
+	return output, nil
+}
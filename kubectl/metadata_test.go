@@ -0,0 +1,120 @@
+package kubectl
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestInjectMetadata(t *testing.T) {
+	input := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    team: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: web:1.2.3
+---
+# Source: web/templates/cronjob.yaml
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: report
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+	output, err := InjectMetadata(input, map[string]string{"team": "payments", "cost-center": "42"}, map[string]string{"owner": "payments@example.com"})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !strings.HasPrefix(output, "---\n# Source: web/templates/deployment.yaml\n") {
+		t.Logf("expected the Source comments to be kept but got:\n%v", output)
+		t.Fail()
+	}
+	if len(ObjectCharts(output, "test")) != 3 {
+		t.Logf("expected the objects to still be attributed to their chart but got %v", ObjectCharts(output, "test"))
+		t.Fail()
+	}
+
+	docs := ObjectDocuments(output, "test")
+	type metadata struct {
+		Labels      map[string]string
+		Annotations map[string]string
+	}
+	obj := struct {
+		Metadata metadata
+		Spec     struct {
+			Selector struct {
+				MatchLabels map[string]string `yaml:"matchLabels"`
+			}
+			Template struct {
+				Metadata metadata
+			}
+			JobTemplate struct {
+				Metadata metadata
+				Spec     struct {
+					Template struct {
+						Metadata metadata
+					}
+				}
+			} `yaml:"jobTemplate"`
+		}
+	}{}
+
+	if err := yaml.Unmarshal([]byte(docs["deployment/test/web"]), &obj); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if obj.Metadata.Labels["team"] != "payments" || obj.Metadata.Labels["cost-center"] != "42" || obj.Metadata.Annotations["owner"] != "payments@example.com" {
+		t.Logf("expected common metadata on the Deployment but got %+v", obj.Metadata)
+		t.Fail()
+	}
+	if obj.Spec.Template.Metadata.Labels["app"] != "web" || obj.Spec.Template.Metadata.Labels["team"] != "payments" {
+		t.Logf("expected common labels on the pod template but got %+v", obj.Spec.Template.Metadata)
+		t.Fail()
+	}
+	if len(obj.Spec.Selector.MatchLabels) != 1 {
+		t.Logf("expected the selector to be left alone but got %v", obj.Spec.Selector.MatchLabels)
+		t.Fail()
+	}
+
+	if err := yaml.Unmarshal([]byte(docs["cronjob/test/report"]), &obj); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if obj.Spec.JobTemplate.Metadata.Labels["team"] != "payments" || obj.Spec.JobTemplate.Spec.Template.Metadata.Labels["team"] != "payments" {
+		t.Logf("expected common labels on the CronJob's templates but got %+v", obj.Spec.JobTemplate)
+		t.Fail()
+	}
+
+	if unchanged, _ := InjectMetadata(input, nil, nil); unchanged != input {
+		t.Logf("expected no changes without common labels or annotations")
+		t.Fail()
+	}
+}
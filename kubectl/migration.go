@@ -0,0 +1,130 @@
+package kubectl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+type migrationObject struct {
+	Kind     string
+	Metadata struct {
+		Name        string
+		Annotations map[string]string
+	}
+}
+
+// isMigrationHook is true for Jobs that helm would run before installing or upgrading a release.
+func isMigrationHook(obj migrationObject) bool {
+	if !strings.EqualFold(obj.Kind, "job") {
+		return false
+	}
+	for _, hook := range strings.Split(obj.Metadata.Annotations["helm.sh/hook"], ",") {
+		hook = strings.TrimSpace(hook)
+		if hook == "pre-install" || hook == "pre-upgrade" {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitMigrations separates a chart's pre-install and pre-upgrade hook Jobs
+// from the rest of its templated output, returning the Jobs' names and
+// manifests, and the remaining output.
+func SplitMigrations(input string) ([]string, string, string) {
+	names := []string{}
+	migrations := []string{}
+	rest := []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := migrationObject{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err == nil && isMigrationHook(obj) {
+			names = append(names, obj.Metadata.Name)
+			migrations = append(migrations, doc)
+			continue
+		}
+		rest = append(rest, doc)
+	}
+	return names, strings.Join(migrations, "\n---"), strings.Join(rest, "\n---")
+}
+
+// JobNames returns the names of the Jobs in a manifest.
+func JobNames(input string) []string {
+	names := []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := migrationObject{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err == nil && strings.EqualFold(obj.Kind, "job") {
+			names = append(names, obj.Metadata.Name)
+		}
+	}
+	return names
+}
+
+// jobState reads a Job's `Complete` and `Failed` conditions.
+func jobState(ctx *ankh.ExecutionContext, namespace string, name string) (string, error) {
+	out, err := runKubectl(ctx, namespace, nil, "get", "job", name,
+		"-o", `jsonpath={range .status.conditions[*]}{.type}={.status}{"\n"}{end}`)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "Complete=True" {
+			return "Complete", nil
+		}
+		if line == "Failed=True" {
+			return "Failed", nil
+		}
+	}
+	return "", nil
+}
+
+// JobLogs returns the tail of the logs of a Job's pods.
+func JobLogs(ctx *ankh.ExecutionContext, namespace string, name string) string {
+	out, err := runKubectl(ctx, namespace, nil, "logs", "-l", "job-name="+name, "--tail", "100")
+	if err != nil {
+		return fmt.Sprintf("(unable to get logs: %v)", err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// RunMigrations replaces the Jobs in manifest, since Jobs can't be updated in
+// place, and waits for each of them to complete. If any of them fails or
+// times out, the error includes its logs.
+func RunMigrations(ctx *ankh.ExecutionContext, namespace string, manifest string, timeout time.Duration) error {
+	names := JobNames(manifest)
+	for _, name := range names {
+		if _, err := runKubectl(ctx, namespace, nil, "delete", "job", name, "--ignore-not-found"); err != nil {
+			return fmt.Errorf("Unable to delete previous migration job \"%v\": %v", name, err)
+		}
+	}
+
+	if _, err := runKubectl(ctx, namespace, []byte(manifest), "apply", "-f", "-"); err != nil {
+		return fmt.Errorf("Unable to apply migration jobs: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, name := range names {
+		ctx.Logger.Infof("Waiting up to %v for migration job \"%v\" to complete", timeout, name)
+		for {
+			state, err := jobState(ctx, namespace, name)
+			if err != nil {
+				return err
+			}
+			if state == "Complete" {
+				ctx.Logger.Infof("Migration job \"%v\" completed", name)
+				break
+			}
+			if state == "Failed" {
+				return fmt.Errorf("Migration job \"%v\" failed. Its logs were:\n%v", name, JobLogs(ctx, namespace, name))
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("Migration job \"%v\" did not complete within %v. Its logs were:\n%v", name, timeout, JobLogs(ctx, namespace, name))
+			}
+			time.Sleep(5 * time.Second)
+		}
+	}
+	return nil
+}
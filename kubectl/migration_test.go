@@ -0,0 +1,54 @@
+package kubectl
+
+import (
+	"strings"
+	"testing"
+)
+
+const migrationInput = `---
+# Source: web/templates/migrate.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: web-migrate
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+---
+# Source: web/templates/cleanup.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: web-cleanup
+  annotations:
+    helm.sh/hook: post-upgrade
+---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`
+
+func TestSplitMigrations(t *testing.T) {
+	names, migrations, rest := SplitMigrations(migrationInput)
+	if len(names) != 1 || names[0] != "web-migrate" {
+		t.Logf("expected only web-migrate but got %+v", names)
+		t.Fail()
+	}
+	if !strings.Contains(migrations, "name: web-migrate") || strings.Contains(migrations, "name: web-cleanup") {
+		t.Logf("unexpected migrations:\n%v", migrations)
+		t.Fail()
+	}
+	if strings.Contains(rest, "name: web-migrate") || !strings.Contains(rest, "name: web-cleanup") || !strings.Contains(rest, "kind: Deployment") {
+		t.Logf("unexpected remaining output:\n%v", rest)
+		t.Fail()
+	}
+}
+
+func TestJobNames(t *testing.T) {
+	names := JobNames(migrationInput)
+	if len(names) != 2 || names[0] != "web-migrate" || names[1] != "web-cleanup" {
+		t.Logf("expected both jobs but got %+v", names)
+		t.Fail()
+	}
+}
@@ -0,0 +1,155 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// Labels put on namespaces when `namespace-labels` is enabled.
+const (
+	NamespaceManagedByLabel        = "app.kubernetes.io/managed-by"
+	NamespaceEnvironmentClassLabel = "ankh.appnexus.com/environment-class"
+	NamespaceTeamLabel             = "ankh.appnexus.com/team"
+	NamespaceReleaseLabel          = "ankh.appnexus.com/release"
+)
+
+type namespaceObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels,omitempty"`
+	} `json:"metadata"`
+}
+
+// NamespaceLabels is the label set for namespaces applied into from the current
+// context: the configured extra labels, then the environment class, team and
+// release, where they're set, and managed-by ankh. team overrides
+// `namespace-labels.team`.
+func NamespaceLabels(ctx *ankh.ExecutionContext, team string) map[string]string {
+	config := ctx.AnkhConfig.NamespaceLabels
+	labels := make(map[string]string)
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+
+	if team == "" {
+		team = config.Team
+	}
+	standard := map[string]string{
+		NamespaceEnvironmentClassLabel: ctx.AnkhConfig.CurrentContext.EnvironmentClass,
+		NamespaceTeamLabel:             team,
+		NamespaceReleaseLabel:          ctx.AnkhConfig.CurrentContext.Release,
+	}
+	for k, v := range standard {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	labels[NamespaceManagedByLabel] = "ankh"
+	return labels
+}
+
+func namespaceManifest(namespace string, labels map[string]string) namespaceObject {
+	obj := namespaceObject{APIVersion: "v1", Kind: "Namespace"}
+	obj.Metadata.Name = namespace
+	obj.Metadata.Labels = labels
+	return obj
+}
+
+// EnsureNamespace creates namespace with labels if it doesn't exist, and
+// otherwise adds labels to it, leaving any other labels it has alone.
+func EnsureNamespace(ctx *ankh.ExecutionContext, namespace string, labels map[string]string) error {
+	body, err := json.Marshal(namespaceManifest(namespace, labels))
+	if err != nil {
+		return err
+	}
+	if _, err := runKubectl(ctx, "", body, "apply", "-f", "-"); err != nil {
+		return fmt.Errorf("Unable to create or label namespace \"%v\": %v", namespace, err)
+	}
+	return nil
+}
+
+// NamespaceExists checks whether namespace exists.
+func NamespaceExists(ctx *ankh.ExecutionContext, namespace string) (bool, error) {
+	out, err := runKubectl(ctx, "", nil, "get", "namespace", namespace, "--ignore-not-found", "-o", "name")
+	if err != nil {
+		return false, fmt.Errorf("Unable to check whether namespace \"%v\" exists: %v", namespace, err)
+	}
+	return strings.TrimSpace(string(out)) != "", nil
+}
+
+// metadataField finds the line of a YAML document that sets `metadata.<field>`,
+// and the value it sets, or -1 if there isn't one.
+func metadataField(lines []string, field string) (int, string) {
+	inMetadata := false
+	indent := ""
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inMetadata = strings.TrimSpace(line) == "metadata:"
+			indent = ""
+			continue
+		}
+		if !inMetadata {
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		if indent == "" {
+			indent = line[:len(line)-len(trimmed)]
+		}
+		if line[:len(line)-len(trimmed)] != indent || !strings.HasPrefix(trimmed, field+":") {
+			continue
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(trimmed, field+":"))
+		return i, strings.Trim(value, `"'`)
+	}
+	return -1, ""
+}
+
+// setMetadataField sets `metadata.<field>` on line n of a YAML document, which
+// metadataField found.
+func setMetadataField(lines []string, n int, field string, value string) {
+	prefix := lines[n][:strings.Index(lines[n], field+":")]
+	lines[n] = prefix + field + ": " + value
+}
+
+// ForeignNamespaceObjects finds the objects in input, by lowercase
+// `kind/name`, whose `metadata.namespace` is set to something other than
+// namespace, mapped to the namespace they set.
+func ForeignNamespaceObjects(input string, namespace string) map[string]string {
+	foreign := make(map[string]string)
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := objectRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		if _, objNamespace := metadataField(strings.Split(doc, "\n"), "namespace"); objNamespace != "" && objNamespace != namespace {
+			foreign[strings.ToLower(obj.Kind+"/"+obj.Metadata.Name)] = objNamespace
+		}
+	}
+	return foreign
+}
+
+// RewriteNamespace sets the `metadata.namespace` of each object in input that
+// sets one to namespace, leaving the rest of each document as it is.
+func RewriteNamespace(input string, namespace string) string {
+	docs := strings.Split(input, "\n---")
+	for i, doc := range docs {
+		lines := strings.Split(doc, "\n")
+		n, objNamespace := metadataField(lines, "namespace")
+		if n < 0 || objNamespace == namespace {
+			continue
+		}
+		setMetadataField(lines, n, "namespace", namespace)
+		docs[i] = strings.Join(lines, "\n")
+	}
+	return strings.Join(docs, "\n---")
+}
@@ -0,0 +1,98 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestNamespaceLabels(t *testing.T) {
+	ctx := &ankh.ExecutionContext{}
+	ctx.AnkhConfig.CurrentContext.EnvironmentClass = "production"
+	ctx.AnkhConfig.NamespaceLabels = ankh.NamespaceLabelsConfig{
+		Enabled: true,
+		Team:    "platform",
+		Labels:  map[string]string{"cost-center": "1234", NamespaceManagedByLabel: "someone-else"},
+	}
+
+	labels := NamespaceLabels(ctx, "")
+	expected := map[string]string{
+		"cost-center":                  "1234",
+		NamespaceEnvironmentClassLabel: "production",
+		NamespaceTeamLabel:             "platform",
+		NamespaceManagedByLabel:        "ankh",
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Logf("expected %v but got %v", expected, labels)
+		t.Fail()
+	}
+
+	ctx.AnkhConfig.CurrentContext.Release = "canary"
+	labels = NamespaceLabels(ctx, "web")
+	if labels[NamespaceTeamLabel] != "web" || labels[NamespaceReleaseLabel] != "canary" {
+		t.Logf("expected the Ankh file's team and the release, but got %v", labels)
+		t.Fail()
+	}
+}
+
+func TestNamespaceManifest(t *testing.T) {
+	body, err := json.Marshal(namespaceManifest("web", map[string]string{NamespaceManagedByLabel: "ankh"}))
+	if err != nil {
+		t.Logf("got error %v", err)
+		t.FailNow()
+	}
+	expected := `{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"web","labels":{"app.kubernetes.io/managed-by":"ankh"}}}`
+	if string(body) != expected {
+		t.Logf("expected %v but got %s", expected, body)
+		t.Fail()
+	}
+}
+
+func TestForeignNamespaceObjects(t *testing.T) {
+	input := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: "team"
+  labels:
+    namespace: other
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  labels:
+    app: web
+  name: web
+  namespace: ops
+spec:
+  selector:
+    app: web
+---
+# Source: web/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+`
+	foreign := ForeignNamespaceObjects(input, "team")
+	if !reflect.DeepEqual(foreign, map[string]string{"service/web": "ops"}) {
+		t.Logf("got unexpected objects %v", foreign)
+		t.Fail()
+	}
+
+	rewritten := RewriteNamespace(input, "team")
+	if len(ForeignNamespaceObjects(rewritten, "team")) != 0 {
+		t.Logf("expected no objects in other namespaces after rewriting, but got:\n%v", rewritten)
+		t.Fail()
+	}
+	if strings.Replace(rewritten, "  namespace: team\nspec:", "  namespace: ops\nspec:", 1) != input {
+		t.Logf("expected only the Service's namespace to be rewritten, but got:\n%v", rewritten)
+		t.Fail()
+	}
+}
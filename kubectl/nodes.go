@@ -0,0 +1,211 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+
+	"github.com/appnexus/ankh/context"
+)
+
+type podItem struct {
+	Metadata struct {
+		Name              string  `json:"name"`
+		DeletionTimestamp *string `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase             string `json:"phase"`
+		ContainerStatuses []struct {
+			Ready        bool `json:"ready"`
+			RestartCount int  `json:"restartCount"`
+			State        struct {
+				Waiting *struct {
+					Reason string `json:"reason"`
+				} `json:"waiting"`
+				Terminated *struct {
+					Reason string `json:"reason"`
+				} `json:"terminated"`
+			} `json:"state"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type nodeItem struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Unschedulable bool `json:"unschedulable"`
+		Taints        []struct {
+			Key    string `json:"key"`
+			Value  string `json:"value"`
+			Effect string `json:"effect"`
+		} `json:"taints"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// podStatus summarizes a pod the way `kubectl get pods` does in its STATUS column.
+func podStatus(pod podItem) string {
+	if pod.Metadata.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return cs.State.Waiting.Reason
+		}
+		if cs.State.Terminated != nil && cs.State.Terminated.Reason != "" && pod.Status.Phase != "Succeeded" {
+			return cs.State.Terminated.Reason
+		}
+	}
+	return pod.Status.Phase
+}
+
+// nodeStatus summarizes a node's readiness, whether it is cordoned, and any
+// pressure conditions, eg: `Ready,SchedulingDisabled,DiskPressure`.
+func nodeStatus(node nodeItem) string {
+	statuses := []string{"Unknown"}
+	problems := []string{}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == "Ready" {
+			if condition.Status == "True" {
+				statuses[0] = "Ready"
+			} else if condition.Status == "False" {
+				statuses[0] = "NotReady"
+			}
+		} else if condition.Status == "True" {
+			problems = append(problems, condition.Type)
+		}
+	}
+	if node.Spec.Unschedulable {
+		statuses = append(statuses, "SchedulingDisabled")
+	}
+	sort.Strings(problems)
+	return strings.Join(append(statuses, problems...), ",")
+}
+
+func nodeTaints(node nodeItem) string {
+	taints := []string{}
+	for _, taint := range node.Spec.Taints {
+		t := taint.Key
+		if taint.Value != "" {
+			t += "=" + taint.Value
+		}
+		taints = append(taints, t+":"+taint.Effect)
+	}
+	if len(taints) == 0 {
+		return "<none>"
+	}
+	return strings.Join(taints, ",")
+}
+
+// matchesNode is true if node matches one of the names or glob patterns in onNodes, or if there are none.
+func matchesNode(node string, onNodes []string) bool {
+	if len(onNodes) == 0 {
+		return true
+	}
+	for _, pattern := range onNodes {
+		if matched, _ := path.Match(pattern, node); matched || pattern == node {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPodNodes lays out pods alongside the node each one runs on and the node's health.
+func formatPodNodes(pods []podItem, nodes map[string]nodeItem, onNodes []string, color bool) string {
+	header := []string{"NAME", "READY", "STATUS", "RESTARTS", "NODE", "NODE-STATUS", "TAINTS"}
+	rows := [][]string{}
+	for _, pod := range pods {
+		if !matchesNode(pod.Spec.NodeName, onNodes) {
+			continue
+		}
+
+		ready, restarts := 0, 0
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Ready {
+				ready++
+			}
+			restarts += cs.RestartCount
+		}
+
+		nodeName, health, taints := pod.Spec.NodeName, "<unknown>", "<unknown>"
+		if nodeName == "" {
+			nodeName, health, taints = "<none>", "<none>", "<none>"
+		} else if node, ok := nodes[nodeName]; ok {
+			health, taints = nodeStatus(node), nodeTaints(node)
+		}
+
+		rows = append(rows, []string{
+			pod.Metadata.Name,
+			fmt.Sprintf("%v/%v", ready, len(pod.Status.ContainerStatuses)),
+			podStatus(pod),
+			fmt.Sprintf("%v", restarts),
+			nodeName,
+			health,
+			taints,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][4] != rows[j][4] {
+			return rows[i][4] < rows[j][4]
+		}
+		return rows[i][0] < rows[j][0]
+	})
+	return formatTable(header, rows, color)
+}
+
+// PodNodes gets the pods for the Deployments and StatefulSets in input, and
+// shows the node each one runs on with the node's conditions and taints.
+// Pods are limited to those on nodes matching onNodes, if there are any.
+func PodNodes(ctx *ankh.ExecutionContext, input string, namespace string, onNodes []string) (string, error) {
+	selectorArgs, err := getSelectorArgsForPods(ctx, input, false)
+	if err != nil {
+		return "", err
+	}
+	out, err := runKubectl(ctx, namespace, nil, append([]string{"get", "pods", "-o", "json"}, selectorArgs...)...)
+	if err != nil {
+		return "", err
+	}
+	pods := struct {
+		Items []podItem `json:"items"`
+	}{}
+	if err := json.Unmarshal(out, &pods); err != nil {
+		return "", fmt.Errorf("Unable to parse pods: %v", err)
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("No pods found for input chart in namespace \"%v\"", namespace)
+	}
+
+	// Reading nodes needs cluster-wide permissions that not everybody has, so carry on without them.
+	nodes := make(map[string]nodeItem)
+	out, err = runKubectl(ctx, "", nil, "get", "nodes", "-o", "json")
+	if err != nil {
+		ctx.Logger.Warnf("Unable to get nodes, so node status and taints are unknown: %v", err)
+	} else {
+		nodeList := struct {
+			Items []nodeItem `json:"items"`
+		}{}
+		if err := json.Unmarshal(out, &nodeList); err != nil {
+			return "", fmt.Errorf("Unable to parse nodes: %v", err)
+		}
+		for _, node := range nodeList.Items {
+			nodes[node.Metadata.Name] = node
+		}
+	}
+
+	return formatPodNodes(pods.Items, nodes, onNodes, isatty.IsTerminal(os.Stdout.Fd())), nil
+}
@@ -0,0 +1,76 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const podNodesTestPods = `{"items": [
+  {"metadata": {"name": "web-1"}, "spec": {"nodeName": "pool-a-1"},
+   "status": {"phase": "Running", "containerStatuses": [{"ready": true, "restartCount": 0, "state": {"running": {}}}]}},
+  {"metadata": {"name": "web-2"}, "spec": {"nodeName": "pool-b-1"},
+   "status": {"phase": "Pending", "containerStatuses": [{"ready": false, "restartCount": 3, "state": {"waiting": {"reason": "CrashLoopBackOff"}}}]}},
+  {"metadata": {"name": "web-3"}, "spec": {},
+   "status": {"phase": "Pending"}}
+]}`
+
+const podNodesTestNodes = `{"items": [
+  {"metadata": {"name": "pool-a-1"},
+   "status": {"conditions": [{"type": "DiskPressure", "status": "False"}, {"type": "Ready", "status": "True"}]}},
+  {"metadata": {"name": "pool-b-1"},
+   "spec": {"unschedulable": true, "taints": [{"key": "node.kubernetes.io/unschedulable", "effect": "NoSchedule"}, {"key": "dedicated", "value": "batch", "effect": "NoExecute"}]},
+   "status": {"conditions": [{"type": "MemoryPressure", "status": "True"}, {"type": "Ready", "status": "False"}]}}
+]}`
+
+func TestFormatPodNodes(t *testing.T) {
+	pods := struct{ Items []podItem }{}
+	nodes := struct{ Items []nodeItem }{}
+	if err := json.Unmarshal([]byte(podNodesTestPods), &pods); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err := json.Unmarshal([]byte(podNodesTestNodes), &nodes); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	nodeMap := make(map[string]nodeItem)
+	for _, node := range nodes.Items {
+		nodeMap[node.Metadata.Name] = node
+	}
+
+	t.Run("all nodes", func(t *testing.T) {
+		out := formatPodNodes(pods.Items, nodeMap, nil, false)
+		for _, expected := range []string{
+			"web-1   1/1     Running            0          pool-a-1   Ready",
+			"NotReady,SchedulingDisabled,MemoryPressure",
+			"node.kubernetes.io/unschedulable:NoSchedule,dedicated=batch:NoExecute",
+			"web-3   0/0     Pending            0          <none>",
+		} {
+			if !strings.Contains(out, expected) {
+				t.Logf("expected to find '%v' in output '%v'", expected, out)
+				t.Fail()
+			}
+		}
+		if strings.Index(out, "web-3") > strings.Index(out, "web-1") {
+			t.Logf("expected unscheduled pods to sort first in output '%v'", out)
+			t.Fail()
+		}
+	})
+
+	t.Run("on node", func(t *testing.T) {
+		out := formatPodNodes(pods.Items, nodeMap, []string{"pool-b-*"}, false)
+		if !strings.Contains(out, "web-2") || strings.Contains(out, "web-1") || strings.Contains(out, "web-3") {
+			t.Logf("expected only pods on pool-b in output '%v'", out)
+			t.Fail()
+		}
+	})
+
+	t.Run("unknown nodes", func(t *testing.T) {
+		out := formatPodNodes(pods.Items, map[string]nodeItem{}, []string{"pool-a-1"}, false)
+		if !strings.Contains(out, "pool-a-1   <unknown>") {
+			t.Logf("expected unknown node status in output '%v'", out)
+			t.Fail()
+		}
+	})
+}
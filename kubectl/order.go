@@ -0,0 +1,182 @@
+package kubectl
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// crdEstablishedTimeout is how long apply waits for CustomResourceDefinitions
+// to be established before applying the rest of its input.
+const crdEstablishedTimeout = "60s"
+
+// applyOrder is the order that apply applies kinds in: objects that others
+// depend on, like Namespaces, CustomResourceDefinitions and RBAC, first, then
+// configuration, then workloads. Kinds that aren't listed, eg: custom
+// resources, come after these, and webhooks come last, so that they can't
+// reject the objects they serve.
+var applyOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"PriorityClass",
+	"StorageClass",
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Secret",
+	"ConfigMap",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+	"PodDisruptionBudget",
+	"DaemonSet",
+	"Pod",
+	"ReplicaSet",
+	"Deployment",
+	"StatefulSet",
+	"HorizontalPodAutoscaler",
+	"Job",
+	"CronJob",
+	"Ingress",
+	"APIService",
+}
+
+var applyLast = []string{
+	"MutatingWebhookConfiguration",
+	"ValidatingWebhookConfiguration",
+}
+
+type crdRef struct {
+	Kind string
+	Spec struct {
+		Names struct {
+			Kind string
+		}
+	}
+}
+
+func applyPriority(doc string) int {
+	obj := objectRef{}
+	if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+		return len(applyOrder)
+	}
+	for i, kind := range applyOrder {
+		if obj.Kind == kind {
+			return i
+		}
+	}
+	for i, kind := range applyLast {
+		if obj.Kind == kind {
+			return len(applyOrder) + 1 + i
+		}
+	}
+	return len(applyOrder)
+}
+
+// OrderByKind sorts the documents of templated output into applyOrder,
+// keeping documents of the same kind in their original order. Input that's
+// already in order is returned as is.
+func OrderByKind(input string) string {
+	docs := strings.Split(input, "\n---")
+	priorities := make([]int, len(docs))
+	sorted := true
+	for i, doc := range docs {
+		priorities[i] = applyPriority(doc)
+		if i > 0 && priorities[i] < priorities[i-1] {
+			sorted = false
+		}
+	}
+	if sorted {
+		return input
+	}
+
+	docs[0] = strings.TrimPrefix(docs[0], "---")
+	indexes := make([]int, len(docs))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool { return priorities[indexes[i]] < priorities[indexes[j]] })
+
+	ordered := []string{}
+	for _, i := range indexes {
+		doc := docs[i]
+		if !strings.HasPrefix(doc, "\n") {
+			doc = "\n" + doc
+		}
+		ordered = append(ordered, doc)
+	}
+	return "---" + strings.Join(ordered, "\n---")
+}
+
+// splitCRDs splits templated output into its CustomResourceDefinitions, and
+// the rest, when the rest has custom resources of the kinds they define,
+// which are definedKinds. Otherwise, crds is empty.
+func splitCRDs(input string) (crds []string, definedKinds []string, rest string) {
+	docs := strings.Split(input, "\n---")
+	crdDocs, others := []string{}, []string{}
+	kinds := make(map[string]bool)
+	for _, doc := range docs {
+		obj := crdRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err == nil && obj.Kind == "CustomResourceDefinition" {
+			crdDocs = append(crdDocs, doc)
+			kinds[obj.Spec.Names.Kind] = true
+			continue
+		}
+		others = append(others, doc)
+	}
+
+	for _, doc := range others {
+		obj := objectRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err == nil && kinds[obj.Kind] {
+			definedKinds = append(definedKinds, obj.Kind)
+			kinds[obj.Kind] = false
+		}
+	}
+	if len(definedKinds) == 0 {
+		return nil, nil, input
+	}
+	return crdDocs, definedKinds, strings.Join(others, "\n---")
+}
+
+// applyCRDsFirst applies the CustomResourceDefinitions in input, and waits
+// for them to be established, before applying custom resources of the kinds
+// they define, which kubectl would otherwise fail to find.
+func applyCRDsFirst(ctx *ankh.ExecutionContext, input string, namespace string,
+	cmd func(name string, arg ...string) *exec.Cmd) (string, bool, error) {
+	crdDocs, definedKinds, rest := splitCRDs(input)
+	if len(crdDocs) == 0 {
+		return "", false, nil
+	}
+	crdInput := strings.Join(crdDocs, "\n---")
+
+	ctx.Logger.Infof("Applying %v CustomResourceDefinition(s) before the custom resources [ %v ] that need them", len(crdDocs), strings.Join(definedKinds, ", "))
+	crdOut, err := Execute(ctx, strings.NewReader(crdInput), namespace, cmd)
+	if err != nil {
+		return crdOut, true, err
+	}
+
+	if !ctx.DryRun {
+		crds := EventObjects(crdInput)
+		kubectlArgs := []string{"kubectl", "wait", "--for=condition=established", "--timeout", crdEstablishedTimeout}
+		kubectlArgs = append(kubectlArgs, crds...)
+		kubectlArgs = append(kubectlArgs, kubectlConnectionArgs(ctx)...)
+		ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlArgs)
+		if _, err := kubectlExec(ctx, cmd(kubectlArgs[0], kubectlArgs[1:]...), nil, true, false, 0); err != nil {
+			return crdOut, true, fmt.Errorf("CustomResourceDefinitions [ %v ] were not established: %v", strings.Join(crds, ", "), err)
+		}
+	}
+
+	out, err := Execute(ctx, strings.NewReader(rest), namespace, cmd)
+	return crdOut + out, true, err
+}
@@ -0,0 +1,99 @@
+package kubectl
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const orderTestInput = `---
+# Source: web/templates/webhook.yaml
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: web
+---
+# Source: web/templates/widget.yaml
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: web
+---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+# Source: web/templates/crd.yaml
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  names:
+    kind: Widget
+---
+# Source: web/templates/config.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+---
+# Source: web/templates/namespace.yaml
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team
+`
+
+func TestOrderByKind(t *testing.T) {
+	output := OrderByKind(orderTestInput)
+	kinds := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "kind: ") {
+			kinds = append(kinds, strings.TrimPrefix(line, "kind: "))
+		}
+	}
+	expected := []string{"Namespace", "CustomResourceDefinition", "ConfigMap", "Deployment", "Widget", "ValidatingWebhookConfiguration"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Logf("expected kinds in order %v but got %v", expected, kinds)
+		t.Fail()
+	}
+	if len(ObjectDocuments(output, "test")) != 6 || !strings.HasPrefix(output, "---\n# Source: web/templates/namespace.yaml") {
+		t.Logf("expected every document to be kept intact but got:\n%v", output)
+		t.Fail()
+	}
+
+	if OrderByKind(output) != output {
+		t.Logf("expected input that's already in order to be unchanged")
+		t.Fail()
+	}
+}
+
+func TestExecuteAppliesCRDsFirst(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Apply}
+	calls := [][]string{}
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		calls = append(calls, arg)
+		return exec.Command("true")
+	}
+	if _, err := Execute(ctx, strings.NewReader(orderTestInput), "team", cmd); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	if len(calls) != 3 || calls[0][0] != "apply" || calls[1][0] != "wait" || calls[2][0] != "apply" {
+		t.Logf("expected to apply, wait, and apply again, but got %v", calls)
+		t.FailNow()
+	}
+	if calls[1][len(calls[1])-3] != "customresourcedefinition/widgets.example.com" {
+		t.Logf("expected to wait for the CustomResourceDefinition but got %v", calls[1])
+		t.Fail()
+	}
+}
@@ -0,0 +1,68 @@
+package kubectl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// OutputFormats are the formats that `get` and `pods` can print objects in,
+// besides `custom-columns=SPEC` and `jsonpath=TEMPLATE`.
+var OutputFormats = []string{"wide", "json", "yaml", "name"}
+
+// The prefixes of output formats that take a spec or template.
+const (
+	CustomColumnsPrefix = "custom-columns="
+	JSONPathPrefix      = "jsonpath="
+)
+
+// ValidateOutputFormat checks that format is one that mode can print, and
+// that custom columns and JSONPath templates parse.
+func ValidateOutputFormat(mode ankh.Mode, format string) error {
+	if format == "" {
+		return nil
+	}
+	if mode != ankh.Get && mode != ankh.Pods {
+		return fmt.Errorf("Output formats are only supported by `get` and `pods`, not `%v`", mode)
+	}
+
+	for _, f := range OutputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	if ok, err := ValidateTemplateFormat(format); ok {
+		return err
+	}
+	return fmt.Errorf("Invalid output format '%v', must be one of [ %v ], `custom-columns=SPEC` or `jsonpath=TEMPLATE`", format, strings.Join(OutputFormats, ", "))
+}
+
+// ValidateTemplateFormat checks a `custom-columns=SPEC` or `jsonpath=TEMPLATE`
+// output format, returning false if format is neither.
+func ValidateTemplateFormat(format string) (bool, error) {
+	switch {
+	case strings.HasPrefix(format, CustomColumnsPrefix):
+		if err := util.ValidateCustomColumns(strings.TrimPrefix(format, CustomColumnsPrefix)); err != nil {
+			return true, fmt.Errorf("Invalid output format '%v': %v", format, err)
+		}
+		return true, nil
+	case strings.HasPrefix(format, JSONPathPrefix):
+		template := strings.TrimPrefix(format, JSONPathPrefix)
+		if template == "" {
+			return true, fmt.Errorf("Invalid output format '%v': JSONPath needs a template, eg: `jsonpath={.items[*].metadata.name}`", format)
+		}
+		if _, err := util.ParseJSONPath(template); err != nil {
+			return true, fmt.Errorf("Invalid output format '%v': %v", format, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// isTableFormat is true for the formats that print tables, which ankh
+// formats and adds wildcard label columns to.
+func isTableFormat(format string) bool {
+	return format == "" || format == "wide"
+}
@@ -0,0 +1,173 @@
+package kubectl
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// portForwardReconnectDelay is how long to wait before forwarding again when a forward ends.
+var portForwardReconnectDelay = 2 * time.Second
+
+// portForwardMaxFailures is how many forwards in a row may fail quickly before giving up.
+const portForwardMaxFailures = 3
+
+// PortForwardTarget is a Service or Deployment that ports can be forwarded to.
+type PortForwardTarget struct {
+	Namespace string
+	Chart     string
+	Resource  string // eg: service/web
+	Ports     []int
+}
+
+type portForwardObject struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Ports []struct {
+			Port int `yaml:"port"`
+		} `yaml:"ports"`
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Ports []struct {
+						ContainerPort int `yaml:"containerPort"`
+					} `yaml:"ports"`
+				} `yaml:"containers"`
+			} `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+// PortForwardTargets finds the Services in input, and the Deployments with
+// container ports, that ports can be forwarded to. Services come first.
+func PortForwardTargets(input string, namespace string) []PortForwardTarget {
+	services := []PortForwardTarget{}
+	deployments := []PortForwardTarget{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := portForwardObject{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+
+		target := PortForwardTarget{Namespace: namespace, Chart: chartForSource(doc)}
+		switch obj.Kind {
+		case "Service":
+			target.Resource = "service/" + obj.Metadata.Name
+			for _, port := range obj.Spec.Ports {
+				target.Ports = append(target.Ports, port.Port)
+			}
+			services = append(services, target)
+		case "Deployment":
+			target.Resource = "deployment/" + obj.Metadata.Name
+			for _, container := range obj.Spec.Template.Spec.Containers {
+				for _, port := range container.Ports {
+					target.Ports = append(target.Ports, port.ContainerPort)
+				}
+			}
+			if len(target.Ports) > 0 {
+				deployments = append(deployments, target)
+			}
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Resource < services[j].Resource })
+	sort.Slice(deployments, func(i, j int) bool { return deployments[i].Resource < deployments[j].Resource })
+	return append(services, deployments...)
+}
+
+// ParsePortSpec parses a port to forward, `REMOTE` or `LOCAL:REMOTE`. The
+// local port is 0 when it isn't given.
+func ParsePortSpec(spec string) (int, int, error) {
+	tokens := strings.Split(spec, ":")
+	if len(tokens) > 2 {
+		return 0, 0, fmt.Errorf("Invalid port '%v', must be REMOTE or LOCAL:REMOTE", spec)
+	}
+	ports := []int{}
+	for _, token := range tokens {
+		port, err := strconv.Atoi(token)
+		if err != nil || port < 1 || port > 65535 {
+			return 0, 0, fmt.Errorf("Invalid port '%v', must be REMOTE or LOCAL:REMOTE", spec)
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) == 1 {
+		return 0, ports[0], nil
+	}
+	return ports[0], ports[1], nil
+}
+
+// LocalPort chooses a free local port to forward remote to: remote itself,
+// when it's free and doesn't need privileges, or else any free port.
+func LocalPort(remote int) (int, error) {
+	if remote >= 1024 {
+		if listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", remote)); err == nil {
+			listener.Close()
+			return remote, nil
+		}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("Unable to find a free local port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// PortForward runs `kubectl port-forward` to target with ports, which are
+// `LOCAL:REMOTE`, until it's interrupted. When a forward ends, eg: because
+// the pod it was forwarding to restarted, it's started again, using the
+// same local ports. It gives up when forwards keep failing straight away.
+func PortForward(ctx *ankh.ExecutionContext, target PortForwardTarget, ports []string,
+	cmd func(name string, arg ...string) *exec.Cmd) error {
+	if cmd == nil {
+		cmd = func(name string, arg ...string) *exec.Cmd { return kubectlCommand(ctx, name, arg...) }
+	}
+
+	// We want to catch signals while running kubectl, which lets the user
+	// interrupt it gracefully.
+	defer ankh.CatchSignals()()
+
+	failures := 0
+	for {
+		kubectlArgs := []string{"kubectl", "port-forward", target.Resource}
+		kubectlArgs = append(kubectlArgs, ports...)
+		kubectlArgs = append(kubectlArgs, kubectlCommonArgs(ctx, target.Namespace)...)
+		kubectlCmd := cmd(kubectlArgs[0], kubectlArgs[1:]...)
+		kubectlCmd.Stdout = os.Stdout
+		kubectlCmd.Stderr = os.Stderr
+
+		ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+		start := time.Now()
+		record := ctx.StartCommand(kubectlCmd)
+		err := kubectlCmd.Run()
+		err = record.Finish(err)
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				return nil
+			}
+		}
+
+		if time.Since(start) < 10*time.Second {
+			failures++
+		} else {
+			failures = 0
+		}
+		if failures >= portForwardMaxFailures {
+			return fmt.Errorf("Port forward to %v failed %v times in a row: %v", target.Resource, failures, err)
+		}
+		ctx.Logger.Warnf("Port forward to %v ended (%v), forwarding again", target.Resource, err)
+		time.Sleep(portForwardReconnectDelay)
+	}
+}
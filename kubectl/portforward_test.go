@@ -0,0 +1,122 @@
+package kubectl
+
+import (
+	"net"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const portForwardTestInput = `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        ports:
+        - containerPort: 8080
+      - name: metrics
+        ports:
+        - containerPort: 9090
+---
+# Source: web/templates/worker.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    spec:
+      containers:
+      - name: worker
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+  - port: 80
+`
+
+func TestPortForwardTargets(t *testing.T) {
+	targets := PortForwardTargets(portForwardTestInput, "team")
+	expected := []PortForwardTarget{
+		{Namespace: "team", Chart: "web", Resource: "service/web", Ports: []int{80}},
+		{Namespace: "team", Chart: "web", Resource: "deployment/web", Ports: []int{8080, 9090}},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Logf("expected %+v but got %+v", expected, targets)
+		t.Fail()
+	}
+}
+
+func TestParsePortSpec(t *testing.T) {
+	for spec, expected := range map[string][2]int{"8080": {0, 8080}, "9000:80": {9000, 80}} {
+		local, remote, err := ParsePortSpec(spec)
+		if err != nil || local != expected[0] || remote != expected[1] {
+			t.Logf("expected %v from '%v' but got %v:%v (%v)", expected, spec, local, remote, err)
+			t.Fail()
+		}
+	}
+	for _, spec := range []string{"", "http", "1:2:3", "0", "70000"} {
+		if _, _, err := ParsePortSpec(spec); err == nil {
+			t.Logf("expected '%v' to be invalid", spec)
+			t.Fail()
+		}
+	}
+}
+
+func TestLocalPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer listener.Close()
+	busy := listener.Addr().(*net.TCPAddr).Port
+
+	port, err := LocalPort(busy)
+	if err != nil || port == busy || port == 0 {
+		t.Logf("expected a free port other than %v but got %v (%v)", busy, port, err)
+		t.Fail()
+	}
+	if port, err := LocalPort(80); err != nil || port == 80 {
+		t.Logf("expected a privileged port to be forwarded from another port but got %v (%v)", port, err)
+		t.Fail()
+	}
+}
+
+func TestPortForwardGivesUp(t *testing.T) {
+	defer func(delay time.Duration) { portForwardReconnectDelay = delay }(portForwardReconnectDelay)
+	portForwardReconnectDelay = 0
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	runs := [][]string{}
+	cmd := func(name string, arg ...string) *exec.Cmd {
+		runs = append(runs, arg)
+		return exec.Command("false")
+	}
+	target := PortForwardTarget{Namespace: "team", Resource: "service/web", Ports: []int{80}}
+	err := PortForward(ctx, target, []string{"8080:80"}, cmd)
+	if err == nil || len(runs) != portForwardMaxFailures {
+		t.Logf("expected to give up after %v failures but ran %v times (%v)", portForwardMaxFailures, len(runs), err)
+		t.Fail()
+	}
+	if len(runs) > 0 && !strings.HasPrefix(strings.Join(runs[0], " "), "port-forward service/web 8080:80 ") {
+		t.Logf("unexpected kubectl args %v", runs[0])
+		t.Fail()
+	}
+}
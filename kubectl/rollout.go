@@ -0,0 +1,55 @@
+package kubectl
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// WorkloadsForChart returns `kind/name` for each workload templated from a chart
+// that `kubectl rollout status` can wait on.
+func WorkloadsForChart(input string, chart string) []string {
+	workloads := []string{}
+	for key, c := range objectNames(input) {
+		if c != chart {
+			continue
+		}
+		kind := strings.SplitN(key, "/", 2)[0]
+		if kind == "deployment" || kind == "statefulset" || kind == "daemonset" {
+			workloads = append(workloads, key)
+		}
+	}
+	sort.Strings(workloads)
+	return workloads
+}
+
+// RolloutStatus waits for a workload's rollout to finish, failing if it takes longer than timeout.
+func RolloutStatus(ctx *ankh.ExecutionContext, namespace string, workload string, timeout string) error {
+	kubectlArgs := []string{"kubectl", "rollout", "status", workload, "--timeout", timeout}
+	kubectlArgs = append(kubectlArgs, kubectlCommonArgs(ctx, namespace)...)
+	kubectlCmd := ctx.Command(ankh.RunPhase, kubectlArgs[0], kubectlArgs[1:]...)
+	kubectlCmd.Stdout = os.Stderr
+	kubectlCmd.Stderr = os.Stderr
+
+	ctx.Logger.Debugf("Running kubectl cmd %+v", kubectlCmd.Args)
+	record := ctx.StartCommand(kubectlCmd)
+	err := kubectlCmd.Run()
+	err = record.Finish(err)
+	if err != nil {
+		return fmt.Errorf("Rollout of %v in namespace \"%v\" did not become healthy: %v", workload, namespace, err)
+	}
+	return nil
+}
+
+// RolloutRestart restarts the pods of workloads in namespace, returning the output of `kubectl rollout restart`.
+func RolloutRestart(ctx *ankh.ExecutionContext, namespace string, workloads []string) (string, error) {
+	args := append([]string{"rollout", "restart"}, workloads...)
+	out, err := runKubectl(ctx, namespace, nil, args...)
+	if err != nil {
+		return string(out), fmt.Errorf("Unable to restart [ %v ] in namespace \"%v\": %v", strings.Join(workloads, ", "), namespace, err)
+	}
+	return string(out), nil
+}
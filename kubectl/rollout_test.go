@@ -0,0 +1,77 @@
+package kubectl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestWorkloadsForChart(t *testing.T) {
+	input := getTestInput + `---
+# Source: worker/templates/statefulset.yaml
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: worker
+`
+	workloads := WorkloadsForChart(input, "web")
+	if len(workloads) != 1 || workloads[0] != "deployment/web" {
+		t.Logf("expected [deployment/web] but got %v", workloads)
+		t.Fail()
+	}
+
+	workloads = WorkloadsForChart(input, "worker")
+	if len(workloads) != 1 || workloads[0] != "statefulset/worker" {
+		t.Logf("expected [statefulset/worker] but got %v", workloads)
+		t.Fail()
+	}
+}
+
+func TestRolloutRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ankh-restart")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	// Stands in for kubectl, recording the arguments of each call.
+	argsPath := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$*\" >>" + argsPath + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), Mode: ankh.Restart}
+	if _, err := RolloutRestart(ctx, "team", []string{"deployment/web", "statefulset/worker"}); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err := RolloutStatus(ctx, "team", "deployment/web", "2m"); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	body, _ := ioutil.ReadFile(argsPath)
+	calls := strings.Split(strings.TrimSpace(string(body)), "\n")
+	expected := []string{"rollout restart deployment/web statefulset/worker ", "rollout status deployment/web --timeout 2m "}
+	if len(calls) != len(expected) {
+		t.Logf("expected %v kubectl commands but got %v", len(expected), calls)
+		t.FailNow()
+	}
+	for i, call := range calls {
+		if !strings.HasPrefix(call, expected[i]) || !strings.Contains(call, "--namespace team") {
+			t.Logf("expected `kubectl %v... --namespace team` but got `kubectl %v`", expected[i], call)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package kubectl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// ScalableWorkloads returns `kind/name` for each Deployment and StatefulSet
+// in input, which `kubectl scale` can scale.
+func ScalableWorkloads(input string) []string {
+	workloads := []string{}
+	for key := range objectNames(input) {
+		kind := strings.SplitN(key, "/", 2)[0]
+		if kind == "deployment" || kind == "statefulset" {
+			workloads = append(workloads, key)
+		}
+	}
+	sort.Strings(workloads)
+	return workloads
+}
+
+// Scale sets the replicas of workloads in namespace, returning the output of `kubectl scale`.
+func Scale(ctx *ankh.ExecutionContext, namespace string, workloads []string, replicas int) (string, error) {
+	args := append([]string{"scale", fmt.Sprintf("--replicas=%v", replicas)}, workloads...)
+	out, err := runKubectl(ctx, namespace, nil, args...)
+	if err != nil {
+		return string(out), fmt.Errorf("Unable to scale [ %v ] in namespace \"%v\": %v", strings.Join(workloads, ", "), namespace, err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,27 @@
+package kubectl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScalableWorkloads(t *testing.T) {
+	input := getTestInput + `---
+# Source: worker/templates/statefulset.yaml
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: worker
+---
+# Source: agent/templates/daemonset.yaml
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+`
+	expected := []string{"deployment/web", "statefulset/worker"}
+	if workloads := ScalableWorkloads(input); !reflect.DeepEqual(workloads, expected) {
+		t.Logf("expected %v but got %v", expected, workloads)
+		t.Fail()
+	}
+}
@@ -0,0 +1,137 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// WorkloadStatus is how many of a workload's pods are ready, and the version
+// of the chart it was deployed from, according to its `helm.sh/chart` or
+// `chart` label.
+type WorkloadStatus struct {
+	Kind         string `json:"kind"`
+	Name         string `json:"name"`
+	Found        bool   `json:"found"`
+	Desired      int    `json:"desired"`
+	Ready        int    `json:"ready"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+}
+
+// Healthy is true when the workload exists and all of its pods are ready.
+func (s WorkloadStatus) Healthy() bool {
+	return s.Found && s.Ready >= s.Desired
+}
+
+type statusObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		ReadyReplicas          int `json:"readyReplicas"`
+		DesiredNumberScheduled int `json:"desiredNumberScheduled"`
+		NumberReady            int `json:"numberReady"`
+	} `json:"status"`
+}
+
+// chartLabelVersion is the version in a `chart` label, which helm charts set
+// to `$name-$version`, eg: `web-1.2.3` for chart `web`.
+func chartLabelVersion(labels map[string]string, chart string) string {
+	for _, label := range []string{"helm.sh/chart", "chart"} {
+		if value, ok := labels[label]; ok && strings.HasPrefix(value, chart+"-") {
+			return strings.TrimPrefix(value, chart+"-")
+		}
+	}
+	return ""
+}
+
+// parseWorkloadStatuses reads the status of each of workloads, which are
+// `kind/name`, from the output of `kubectl get -o json`.
+func parseWorkloadStatuses(output []byte, workloads []string, chart string) ([]WorkloadStatus, error) {
+	list := struct {
+		Kind  string         `json:"kind"`
+		Items []statusObject `json:"items"`
+	}{}
+	if len(strings.TrimSpace(string(output))) > 0 {
+		if err := json.Unmarshal(output, &list); err != nil {
+			return nil, fmt.Errorf("Unable to parse workload statuses: %v", err)
+		}
+	}
+	// kubectl prints a single object, rather than a List, when getting just one.
+	if list.Kind != "" && list.Kind != "List" {
+		item := statusObject{}
+		if err := json.Unmarshal(output, &item); err != nil {
+			return nil, fmt.Errorf("Unable to parse workload statuses: %v", err)
+		}
+		list.Items = []statusObject{item}
+	}
+
+	found := make(map[string]statusObject)
+	for _, item := range list.Items {
+		found[strings.ToLower(item.Kind)+"/"+item.Metadata.Name] = item
+	}
+
+	statuses := []WorkloadStatus{}
+	for _, workload := range workloads {
+		tokens := strings.SplitN(workload, "/", 2)
+		status := WorkloadStatus{Kind: tokens[0], Name: tokens[1]}
+		if item, ok := found[workload]; ok {
+			status.Found = true
+			status.ChartVersion = chartLabelVersion(item.Metadata.Labels, chart)
+			if tokens[0] == "daemonset" {
+				status.Desired = item.Status.DesiredNumberScheduled
+				status.Ready = item.Status.NumberReady
+			} else {
+				status.Desired = 1
+				if item.Spec.Replicas != nil {
+					status.Desired = *item.Spec.Replicas
+				}
+				status.Ready = item.Status.ReadyReplicas
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Kind+"/"+statuses[i].Name < statuses[j].Kind+"/"+statuses[j].Name
+	})
+	return statuses, nil
+}
+
+// WorkloadStatuses gets the status of the workloads that chart templated in
+// input from namespace. Workloads that don't exist are not Found.
+func WorkloadStatuses(ctx *ankh.ExecutionContext, input string, namespace string, chart string) ([]WorkloadStatus, error) {
+	workloads := WorkloadsForChart(input, chart)
+	if len(workloads) == 0 {
+		return []WorkloadStatus{}, nil
+	}
+
+	args := append([]string{"get", "-o", "json", "--ignore-not-found"}, workloads...)
+	out, err := runKubectl(ctx, namespace, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseWorkloadStatuses(out, workloads, chart)
+}
+
+// DeploymentStatus gets the status of Deployment name in namespace. A
+// Deployment that doesn't exist is not Found.
+func DeploymentStatus(ctx *ankh.ExecutionContext, namespace string, name string) (WorkloadStatus, error) {
+	workload := "deployment/" + name
+	out, err := runKubectl(ctx, namespace, nil, "get", "-o", "json", "--ignore-not-found", workload)
+	if err != nil {
+		return WorkloadStatus{}, err
+	}
+	statuses, err := parseWorkloadStatuses(out, []string{workload}, "")
+	if err != nil {
+		return WorkloadStatus{}, err
+	}
+	return statuses[0], nil
+}
@@ -0,0 +1,65 @@
+package kubectl
+
+import (
+	"testing"
+)
+
+const statusTestOutput = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {
+      "kind": "Deployment",
+      "metadata": {"name": "web", "labels": {"chart": "web-1.2.3"}},
+      "spec": {"replicas": 3},
+      "status": {"readyReplicas": 2}
+    },
+    {
+      "kind": "DaemonSet",
+      "metadata": {"name": "agent", "labels": {"helm.sh/chart": "web-1.2.3"}},
+      "spec": {},
+      "status": {"desiredNumberScheduled": 5, "numberReady": 5}
+    }
+  ]
+}`
+
+func TestParseWorkloadStatuses(t *testing.T) {
+	statuses, err := parseWorkloadStatuses([]byte(statusTestOutput), []string{"deployment/web", "daemonset/agent", "statefulset/db"}, "web")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	expected := []WorkloadStatus{
+		{Kind: "daemonset", Name: "agent", Found: true, Desired: 5, Ready: 5, ChartVersion: "1.2.3"},
+		{Kind: "deployment", Name: "web", Found: true, Desired: 3, Ready: 2, ChartVersion: "1.2.3"},
+		{Kind: "statefulset", Name: "db"},
+	}
+	if len(statuses) != len(expected) {
+		t.Logf("expected %+v but got %+v", expected, statuses)
+		t.FailNow()
+	}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Logf("expected %+v but got %+v", expected[i], statuses[i])
+			t.Fail()
+		}
+	}
+	if !statuses[0].Healthy() || statuses[1].Healthy() || statuses[2].Healthy() {
+		t.Logf("unexpected health for %+v", statuses)
+		t.Fail()
+	}
+}
+
+func TestParseWorkloadStatusesSingleObject(t *testing.T) {
+	output := `{"kind": "Deployment", "metadata": {"name": "auth"}, "spec": {"replicas": 2}, "status": {"readyReplicas": 2}}`
+	statuses, err := parseWorkloadStatuses([]byte(output), []string{"deployment/auth"}, "")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(statuses) != 1 || !statuses[0].Healthy() || statuses[0].Desired != 2 {
+		t.Logf("expected a healthy deployment but got %+v", statuses)
+		t.Fail()
+	}
+}
@@ -0,0 +1,240 @@
+package kubectl
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/appnexus/ankh/context"
+)
+
+type objectRef struct {
+	Kind     string
+	Metadata struct {
+		Name      string
+		Namespace string
+	}
+}
+
+// key is the object's lowercase `kind/namespace/name`, where its namespace
+// is its own, or else namespace.
+func (o objectRef) key(namespace string) string {
+	if o.Metadata.Namespace != "" {
+		namespace = o.Metadata.Namespace
+	}
+	return ObjectKey(strings.ToLower(o.Kind+"/"+o.Metadata.Name), namespace)
+}
+
+// ObjectKey turns object, which is lowercase `kind/name`, into the
+// `kind/namespace/name` that objects in templated output are keyed by.
+func ObjectKey(object string, namespace string) string {
+	tokens := strings.SplitN(object, "/", 2)
+	if len(tokens) != 2 {
+		return object
+	}
+	return tokens[0] + "/" + strings.ToLower(namespace) + "/" + tokens[1]
+}
+
+// SplitObjectKey splits a `kind/namespace/name` key into the object's
+// `kind/name`, which is how kubectl refers to it, and its namespace.
+func SplitObjectKey(key string) (string, string) {
+	tokens := strings.SplitN(key, "/", 3)
+	if len(tokens) != 3 {
+		return key, ""
+	}
+	return tokens[0] + "/" + tokens[2], tokens[1]
+}
+
+// chartForSource extracts the chart name from a `# Source: chart/templates/...` comment
+func chartForSource(doc string) string {
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.HasPrefix(line, "# Source: ") {
+			source := strings.TrimSpace(strings.TrimPrefix(line, "# Source: "))
+			return strings.Split(source, "/")[0]
+		}
+	}
+	return ""
+}
+
+// chartObject is an object in templated output, and the chart it was templated from.
+type chartObject struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Chart     string
+}
+
+// key is the object's lowercase `kind/namespace/name`.
+func (o chartObject) key() string {
+	return ObjectKey(o.ref(), o.Namespace)
+}
+
+// ref is the object's lowercase `kind/name`, which is how kubectl refers to it.
+func (o chartObject) ref() string {
+	return strings.ToLower(o.Kind + "/" + o.Name)
+}
+
+// chartObjects lists the objects in templated output, in order. Objects that
+// don't set a namespace are in namespace.
+func chartObjects(input string, namespace string) []chartObject {
+	objects := []chartObject{}
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := objectRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		ns := obj.Metadata.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		objects = append(objects, chartObject{
+			Kind:      obj.Kind,
+			Namespace: ns,
+			Name:      obj.Metadata.Name,
+			Chart:     chartForSource(doc),
+		})
+	}
+	return objects
+}
+
+// ObjectCharts maps each object in templated output, by lowercase
+// `kind/namespace/name`, to the name of the chart that it was templated from.
+// Objects that don't set a namespace are in namespace.
+func ObjectCharts(input string, namespace string) map[string]string {
+	charts := make(map[string]string)
+	for _, obj := range chartObjects(input, namespace) {
+		charts[obj.key()] = obj.Chart
+	}
+	return charts
+}
+
+// ChartsInNamespace maps each object in templated output that's in
+// namespace, by lowercase `kind/name`, to the name of the chart that it was
+// templated from.
+func ChartsInNamespace(input string, namespace string) map[string]string {
+	charts := make(map[string]string)
+	for _, obj := range chartObjects(input, namespace) {
+		if obj.Namespace == namespace {
+			charts[obj.ref()] = obj.Chart
+		}
+	}
+	return charts
+}
+
+// objectNames maps each object in templated output, by lowercase
+// `kind/name`, to the name of the chart that it was templated from, for
+// commands that refer to objects by name in a single namespace.
+func objectNames(input string) map[string]string {
+	charts := make(map[string]string)
+	for _, obj := range chartObjects(input, "") {
+		charts[obj.ref()] = obj.Chart
+	}
+	return charts
+}
+
+// ChartDocuments splits templated output by the chart that each object was
+// templated from, keeping each object's YAML document as is.
+func ChartDocuments(input string) map[string]string {
+	docs := make(map[string]string)
+	for _, doc := range strings.Split(input, "\n---") {
+		obj := objectRef{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj.Kind == "" {
+			continue
+		}
+		doc = strings.TrimPrefix(strings.TrimPrefix(doc, "\n"), "---\n")
+		docs[chartForSource(doc)] += "---\n" + strings.TrimRight(doc, "\n") + "\n"
+	}
+	return docs
+}
+
+// dryRunSuffixes are what `kubectl apply` appends to each line of its output on a dry run.
+var dryRunSuffixes = []string{"(server dry run)", "(dry run)"}
+
+// parseApplyLine parses a line of `kubectl apply` output, like `deployment.apps/web configured`,
+// or the older `deployment.apps "web" configured`, into an object key and action.
+func parseApplyLine(line string) (string, string, bool) {
+	for _, suffix := range dryRunSuffixes {
+		line = strings.Replace(line, suffix, "", -1)
+	}
+	line = strings.TrimSpace(line)
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", "", false
+	}
+
+	action := fields[len(fields)-1]
+	ref := fields[0]
+	if len(fields) == 3 {
+		ref = ref + "/" + strings.Trim(fields[1], "\"")
+	}
+
+	tokens := strings.SplitN(ref, "/", 2)
+	if len(tokens) != 2 {
+		return "", "", false
+	}
+
+	// Strip the api group from the kind, eg: `deployment.apps` -> `deployment`
+	kind := strings.Split(tokens[0], ".")[0]
+	return strings.ToLower(kind + "/" + tokens[1]), action, true
+}
+
+// SummarizeApply counts the created, configured, and unchanged objects reported
+// by `kubectl apply`, grouped by the chart that each object was templated from.
+func SummarizeApply(ctx *ankh.ExecutionContext, input string, output string, namespace string) []ankh.ApplySummary {
+	// kubectl doesn't say which namespace each object is in, but reports them
+	// in the order they were applied, so same named objects in different
+	// namespaces are matched up in order.
+	objects := chartObjects(input, namespace)
+	reported := make([]bool, len(objects))
+	summaries := make(map[string]*ankh.ApplySummary)
+
+	for _, line := range strings.Split(output, "\n") {
+		key, action, ok := parseApplyLine(line)
+		if !ok {
+			continue
+		}
+
+		chart := ""
+		for i, obj := range objects {
+			if !reported[i] && obj.ref() == key {
+				reported[i] = true
+				chart = obj.Chart
+				break
+			}
+		}
+		summary, ok := summaries[chart]
+		if !ok {
+			summary = &ankh.ApplySummary{
+				Context:   ctx.AnkhConfig.CurrentContextName,
+				Namespace: namespace,
+				Chart:     chart,
+				DryRun:    ctx.DryRun,
+			}
+			summaries[chart] = summary
+		}
+
+		switch action {
+		case "created":
+			summary.Created++
+		case "configured":
+			summary.Configured++
+		case "unchanged":
+			summary.Unchanged++
+		default:
+			summary.Other++
+		}
+	}
+
+	charts := []string{}
+	for chart := range summaries {
+		charts = append(charts, chart)
+	}
+	sort.Strings(charts)
+
+	result := []ankh.ApplySummary{}
+	for _, chart := range charts {
+		result = append(result, *summaries[chart])
+	}
+	return result
+}
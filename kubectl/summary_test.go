@@ -0,0 +1,138 @@
+package kubectl
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const summaryInput = `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+# Source: cache/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cache
+`
+
+func TestSummarizeApply(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	output := "deployment.apps/web configured\nservice \"web\" unchanged\nconfigmap/cache created (dry run)\n"
+
+	summaries := SummarizeApply(ctx, summaryInput, output, "test")
+	if len(summaries) != 2 {
+		t.Logf("expected 2 summaries but got %+v", summaries)
+		t.FailNow()
+	}
+
+	cache, web := summaries[0], summaries[1]
+	if cache.Chart != "cache" || cache.Created != 1 {
+		t.Logf("got unexpected summary for chart cache: %+v", cache)
+		t.Fail()
+	}
+	if web.Chart != "web" || web.Configured != 1 || web.Unchanged != 1 || web.Namespace != "test" {
+		t.Logf("got unexpected summary for chart web: %+v", web)
+		t.Fail()
+	}
+}
+
+func TestSummarizeApplyNamespaces(t *testing.T) {
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	input := `---
+# Source: web/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+# Source: worker/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: jobs
+`
+	output := "configmap/settings unchanged\nconfigmap/settings created\n"
+
+	summaries := SummarizeApply(ctx, input, output, "test")
+	if len(summaries) != 2 {
+		t.Logf("expected 2 summaries but got %+v", summaries)
+		t.FailNow()
+	}
+	web, worker := summaries[0], summaries[1]
+	if web.Chart != "web" || web.Unchanged != 1 || web.Created != 0 {
+		t.Logf("got unexpected summary for chart web: %+v", web)
+		t.Fail()
+	}
+	if worker.Chart != "worker" || worker.Created != 1 || worker.Unchanged != 0 {
+		t.Logf("got unexpected summary for chart worker: %+v", worker)
+		t.Fail()
+	}
+
+	charts := ObjectCharts(input, "test")
+	if charts["configmap/test/settings"] != "web" || charts["configmap/jobs/settings"] != "worker" {
+		t.Logf("expected each object to be keyed by its namespace but got %v", charts)
+		t.Fail()
+	}
+	if charts := ChartsInNamespace(input, "jobs"); len(charts) != 1 || charts["configmap/settings"] != "worker" {
+		t.Logf("expected only the object in namespace jobs but got %v", charts)
+		t.Fail()
+	}
+}
+
+func TestParseApplyLine(t *testing.T) {
+	for line, expected := range map[string][2]string{
+		"deployment.apps/web configured":                 {"deployment/web", "configured"},
+		`service "web" unchanged`:                        {"service/web", "unchanged"},
+		"configmap/cache created (dry run)":              {"configmap/cache", "created"},
+		"configmap/cache configured (server dry run)":    {"configmap/cache", "configured"},
+		`deployment.apps "web" configured (dry run)`:     {"deployment/web", "configured"},
+		`deployment.apps "web" created (server dry run)`: {"deployment/web", "created"},
+	} {
+		key, action, ok := parseApplyLine(line)
+		if !ok || key != expected[0] || action != expected[1] {
+			t.Logf("expected '%v' to parse as %v but got %v %v (%v)", line, expected, key, action, ok)
+			t.Fail()
+		}
+	}
+	if _, _, ok := parseApplyLine("warning: something"); ok {
+		t.Log("expected a line that isn't an object to be skipped")
+		t.Fail()
+	}
+}
+
+func TestChartDocuments(t *testing.T) {
+	docs := ChartDocuments(summaryInput)
+	if len(docs) != 2 {
+		t.Logf("expected documents for 2 charts but got %v", docs)
+		t.FailNow()
+	}
+	expected := `---
+# Source: cache/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cache
+`
+	if docs["cache"] != expected {
+		t.Logf("expected cache documents '%v' but got '%v'", expected, docs["cache"])
+		t.Fail()
+	}
+	if n := len(ObjectDocuments(docs["web"], "test")); n != 2 {
+		t.Logf("expected 2 web objects but got %v in '%v'", n, docs["web"])
+		t.Fail()
+	}
+}
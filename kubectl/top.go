@@ -0,0 +1,86 @@
+package kubectl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/helm"
+)
+
+// PodUsage is the CPU, in cores, and memory, in bytes, that a pod, or one of
+// its containers, is using, according to `kubectl top pods`.
+type PodUsage struct {
+	Pod       string
+	Container string
+	CPU       float64
+	Memory    float64
+}
+
+// ChartOutput is the part of templated output that came from chart.
+func ChartOutput(input string, chart string) string {
+	docs := []string{}
+	for _, doc := range strings.Split(input, "\n---") {
+		if chartForSource(doc) == chart {
+			docs = append(docs, doc)
+		}
+	}
+	return strings.Join(docs, "\n---")
+}
+
+// parseTop reads the output of `kubectl top pods --no-headers`, which has
+// a container column too with `--containers`.
+func parseTop(output string, containers bool) ([]PodUsage, error) {
+	columns := 3
+	if containers {
+		columns = 4
+	}
+	usages := []PodUsage{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != columns {
+			return nil, fmt.Errorf("Unable to parse `kubectl top` output '%v'", line)
+		}
+		usage := PodUsage{Pod: fields[0]}
+		if containers {
+			usage.Container = fields[1]
+		}
+		cpu, err := helm.ParseQuantity(fields[columns-2])
+		if err != nil {
+			return nil, err
+		}
+		memory, err := helm.ParseQuantity(fields[columns-1])
+		if err != nil {
+			return nil, err
+		}
+		usage.CPU, usage.Memory = cpu, memory
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// TopPods gets the CPU and memory that the pods of the Deployments and
+// StatefulSets in input are using, found with the same label selector as
+// `ankh pods`, and with containers, that each of their containers is using.
+func TopPods(ctx *ankh.ExecutionContext, input string, namespace string, containers bool) ([]PodUsage, error) {
+	if len(ScalableWorkloads(input)) == 0 {
+		return []PodUsage{}, nil
+	}
+	selectorArgs, err := getSelectorArgsForPods(ctx, input, false)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"top", "pods", "--no-headers"}
+	if containers {
+		args = append(args, "--containers")
+	}
+	out, err := runKubectl(ctx, namespace, nil, append(args, selectorArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseTop(string(out), containers)
+}
@@ -0,0 +1,47 @@
+package kubectl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTop(t *testing.T) {
+	usages, err := parseTop("web-5d8f7c9b6-x2x7q   250m   64Mi\nweb-5d8f7c9b6-9kq2z   1   1Gi\n", false)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := []PodUsage{
+		{Pod: "web-5d8f7c9b6-x2x7q", CPU: 0.25, Memory: 64 << 20},
+		{Pod: "web-5d8f7c9b6-9kq2z", CPU: 1, Memory: 1 << 30},
+	}
+	if !reflect.DeepEqual(usages, expected) {
+		t.Logf("expected %+v but got %+v", expected, usages)
+		t.Fail()
+	}
+
+	usages, err = parseTop("web-5d8f7c9b6-x2x7q   app   5m   10Mi\n", true)
+	if err != nil || len(usages) != 1 || usages[0].Container != "app" {
+		t.Logf("expected a container's usage but got %+v, %v", usages, err)
+		t.Fail()
+	}
+
+	if _, err := parseTop("web-5d8f7c9b6-x2x7q   5m   10Mi\n", true); err == nil {
+		t.Log("expected an error parsing output without containers")
+		t.Fail()
+	}
+}
+
+func TestChartOutput(t *testing.T) {
+	input := getTestInput + `---
+# Source: worker/templates/statefulset.yaml
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: worker
+`
+	if workloads := ScalableWorkloads(ChartOutput(input, "worker")); !reflect.DeepEqual(workloads, []string{"statefulset/worker"}) {
+		t.Logf("expected only the worker chart's objects but got %v", workloads)
+		t.Fail()
+	}
+}
@@ -0,0 +1,82 @@
+package kubectl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const (
+	// WaitRollout waits for the rollouts of Deployments, StatefulSets and DaemonSets to finish.
+	WaitRollout = "rollout"
+	// WaitComplete waits for Jobs to complete.
+	WaitComplete = "complete"
+	// WaitEstablished waits for CustomResourceDefinitions to be established.
+	WaitEstablished = "established"
+)
+
+// DefaultWaitConditions are what `ankh wait` waits for without `--for`.
+var DefaultWaitConditions = []string{WaitEstablished, WaitRollout, WaitComplete}
+
+// ParseWaitCondition checks that s is `rollout`, `complete`, `established`,
+// or `condition=NAME` for any condition, like `kubectl wait --for`.
+func ParseWaitCondition(s string) (string, error) {
+	switch s {
+	case WaitRollout, WaitComplete, WaitEstablished:
+		return s, nil
+	}
+	if name := strings.TrimPrefix(s, "condition="); name != s && name != "" {
+		return s, nil
+	}
+	return "", fmt.Errorf("Invalid condition '%v', must be one of `%v`, `%v`, `%v`, or `condition=NAME`",
+		s, WaitRollout, WaitComplete, WaitEstablished)
+}
+
+// WaitObjects returns lowercase `kind/name` for each object in input that
+// condition applies to. Named conditions apply to every object.
+func WaitObjects(input string, condition string) []string {
+	kinds := map[string][]string{
+		WaitRollout:     {"deployment", "statefulset", "daemonset"},
+		WaitComplete:    {"job"},
+		WaitEstablished: {"customresourcedefinition"},
+	}[condition]
+
+	objects := []string{}
+	for _, object := range EventObjects(input) {
+		kind := strings.SplitN(object, "/", 2)[0]
+		if kinds == nil {
+			objects = append(objects, object)
+			continue
+		}
+		for _, k := range kinds {
+			if kind == k {
+				objects = append(objects, object)
+			}
+		}
+	}
+	return objects
+}
+
+// Wait waits up to timeout for condition to be met by each of objects in namespace.
+func Wait(ctx *ankh.ExecutionContext, namespace string, condition string, objects []string, timeout time.Duration) error {
+	if condition == WaitRollout {
+		for _, object := range objects {
+			if err := RolloutStatus(ctx, namespace, object, timeout.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	forCondition := condition
+	if condition == WaitComplete || condition == WaitEstablished {
+		forCondition = "condition=" + condition
+	}
+	args := append([]string{"wait", "--for=" + forCondition, "--timeout", timeout.String()}, objects...)
+	if _, err := runKubectl(ctx, namespace, nil, args...); err != nil {
+		return fmt.Errorf("[ %v ] in namespace \"%v\" did not meet `%v`: %v", strings.Join(objects, ", "), namespace, forCondition, err)
+	}
+	return nil
+}
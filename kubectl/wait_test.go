@@ -0,0 +1,49 @@
+package kubectl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWaitCondition(t *testing.T) {
+	for _, s := range []string{"rollout", "complete", "established", "condition=Available"} {
+		if _, err := ParseWaitCondition(s); err != nil {
+			t.Logf("expected '%v' to parse but got %v", s, err)
+			t.Fail()
+		}
+	}
+	for _, s := range []string{"", "ready", "condition=", "delete"} {
+		if _, err := ParseWaitCondition(s); err == nil {
+			t.Logf("expected an error parsing '%v'", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestWaitObjects(t *testing.T) {
+	input := getTestInput + `---
+# Source: web/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+---
+# Source: web/templates/crd.yaml
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`
+	cases := map[string][]string{
+		WaitRollout:           {"deployment/web"},
+		WaitComplete:          {"job/migrate"},
+		WaitEstablished:       {"customresourcedefinition/widgets.example.com"},
+		"condition=Available": {"customresourcedefinition/widgets.example.com", "deployment/web", "job/migrate", "service/web"},
+	}
+	for condition, expected := range cases {
+		if objects := WaitObjects(input, condition); !reflect.DeepEqual(objects, expected) {
+			t.Logf("expected %v for '%v' but got %v", expected, condition, objects)
+			t.Fail()
+		}
+	}
+}
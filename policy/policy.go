@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// DefaultPackage is the Rego package that policies are read from, unless `policy.package` is set.
+const DefaultPackage = "ankh"
+
+var execCommand = exec.Command
+
+type object struct {
+	Kind string
+	Name string
+	Body map[string]interface{}
+}
+
+func parseObjects(helmOutput string) ([]object, error) {
+	objects := []object{}
+	docs := util.NewYAMLDocuments(helmOutput)
+	for {
+		var doc interface{}
+		if !docs.Next(&doc) {
+			break
+		}
+		body, ok := util.NormalizeYAMLMap(doc).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := body["kind"].(string)
+		if kind == "" {
+			continue
+		}
+		name := ""
+		if metadata, ok := body["metadata"].(map[string]interface{}); ok {
+			name, _ = metadata["name"].(string)
+		}
+		objects = append(objects, object{Kind: kind, Name: name, Body: body})
+	}
+	if err := docs.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to parse templated output to evaluate policies: %v", err)
+	}
+	return objects, nil
+}
+
+// query evaluates the deny and warn rules of pkg against each of input.objects
+// in turn, so that policies see one object as `input`, like they do in conftest.
+func query(pkg string) string {
+	rule := func(name string) string {
+		return fmt.Sprintf("%q: [msg | data.%v.%v[msg] with input as obj]", name, pkg, name)
+	}
+	return fmt.Sprintf("[{%v, %v} | obj := input.objects[_]]", rule("deny"), rule("warn"))
+}
+
+type result struct {
+	Deny []interface{} `json:"deny"`
+	Warn []interface{} `json:"warn"`
+}
+
+// parseResults reads the output of `opa eval --format json`.
+func parseResults(output []byte, pkg string) ([]result, error) {
+	parsed := struct {
+		Result []struct {
+			Expressions []struct {
+				Value []result `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}{}
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("Unable to parse opa output: %v", err)
+	}
+	if len(parsed.Result) == 0 || len(parsed.Result[0].Expressions) == 0 {
+		return nil, fmt.Errorf("opa returned no result, check that the policies in package `%v` compile", pkg)
+	}
+	return parsed.Result[0].Expressions[0].Value, nil
+}
+
+func message(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	// Policies sometimes return objects like `{"msg": "..."}`.
+	if m, ok := v.(map[string]interface{}); ok {
+		if msg, ok := m["msg"].(string); ok {
+			return msg
+		}
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// Evaluate checks every object in helmOutput against the Rego policies
+// configured in `policy`, using `opa eval`. It returns the violations of
+// `deny` rules, which should fail, and of `warn` rules, which shouldn't.
+func Evaluate(ctx *ankh.ExecutionContext, helmOutput string) ([]error, []error, error) {
+	config := ctx.AnkhConfig.Policy
+	pkg := config.Package
+	if pkg == "" {
+		pkg = DefaultPackage
+	}
+
+	objects, err := parseObjects(helmOutput)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(objects) == 0 {
+		return []error{}, []error{}, nil
+	}
+	bodies := []map[string]interface{}{}
+	for _, obj := range objects {
+		bodies = append(bodies, obj.Body)
+	}
+	input, err := json.Marshal(map[string]interface{}{"objects": bodies})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataFlag := "--data"
+	if strings.HasSuffix(config.Path, ".tar.gz") {
+		dataFlag = "--bundle"
+	}
+	opaCmd := execCommand("opa", "eval", "--format", "json", "--stdin-input", dataFlag, config.Path, query(pkg))
+	opaCmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	opaCmd.Stdout = &stdout
+	opaCmd.Stderr = &stderr
+
+	ctx.Logger.Debugf("Running opa cmd %+v", opaCmd.Args)
+	if err := opaCmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("Failed to evaluate policies in '%v': %v -- the opa process had the following output:\n%s%s",
+			config.Path, err, stdout.String(), stderr.String())
+	}
+
+	results, err := parseResults(stdout.Bytes(), pkg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(results) != len(objects) {
+		return nil, nil, fmt.Errorf("opa returned results for %v objects, but there are %v", len(results), len(objects))
+	}
+
+	deny, warn := []error{}, []error{}
+	for i, r := range results {
+		for _, v := range r.Deny {
+			deny = append(deny, ankh.NewObjectError("policy", objects[i].Kind, objects[i].Name,
+				"%v '%v' violates policy: %v", objects[i].Kind, objects[i].Name, message(v)))
+		}
+		for _, v := range r.Warn {
+			warn = append(warn, fmt.Errorf("%v '%v' violates policy: %v", objects[i].Kind, objects[i].Name, message(v)))
+		}
+	}
+	return deny, warn, nil
+}
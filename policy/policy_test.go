@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const policyTestOutput = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+const policyTestResult = `{
+  "result": [{
+    "expressions": [{
+      "value": [
+        {"deny": ["containers must not run as root"], "warn": [{"msg": "missing team label"}]},
+        {"deny": [], "warn": []}
+      ]
+    }]
+  }]
+}`
+
+func TestQuery(t *testing.T) {
+	expected := `[{"deny": [msg | data.security.deny[msg] with input as obj], ` +
+		`"warn": [msg | data.security.warn[msg] with input as obj]} | obj := input.objects[_]]`
+	if actual := query("security"); actual != expected {
+		t.Logf("expected query '%v' but got '%v'", expected, actual)
+		t.Fail()
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	var args []string
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		args = arg
+		cmd := exec.Command("sh", "-c", `cat >/dev/null; printf '%s' "$RESULT"`)
+		cmd.Env = []string{"RESULT=" + policyTestResult}
+		return cmd
+	}
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.Policy.Path = "policies.tar.gz"
+	deny, warn, err := Evaluate(ctx, policyTestOutput)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(deny) != 1 || deny[0].Error() != "Deployment 'web' violates policy: containers must not run as root" {
+		t.Logf("unexpected deny violations %v", deny)
+		t.Fail()
+	}
+	if len(warn) != 1 || warn[0].Error() != "Deployment 'web' violates policy: missing team label" {
+		t.Logf("unexpected warn violations %v", warn)
+		t.Fail()
+	}
+	if !strings.Contains(strings.Join(args, " "), "--bundle policies.tar.gz") {
+		t.Logf("expected a bundle to be passed with --bundle, got %v", args)
+		t.Fail()
+	}
+
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", `cat >/dev/null; echo "rego_parse_error" >&2; exit 1`)
+	}
+	if _, _, err := Evaluate(ctx, policyTestOutput); err == nil || !strings.Contains(err.Error(), "rego_parse_error") {
+		t.Logf("expected the opa error to be returned, got %v", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,182 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/appnexus/ankh/context"
+)
+
+// DefaultSeverity is the lowest severity that fails a scan, unless `scan.severity` is set.
+const DefaultSeverity = "HIGH"
+
+// Severities are Trivy's severities, from lowest to highest.
+var Severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+var execCommand = exec.Command
+
+// Vulnerability is a vulnerability that Trivy found in a package of an image.
+type Vulnerability struct {
+	VulnerabilityID  string
+	PkgName          string
+	InstalledVersion string
+	FixedVersion     string
+	Severity         string
+	Title            string
+}
+
+func (v Vulnerability) String() string {
+	s := fmt.Sprintf("%v (%v) in %v %v", v.VulnerabilityID, v.Severity, v.PkgName, v.InstalledVersion)
+	if v.FixedVersion != "" {
+		s += ", fixed in " + v.FixedVersion
+	}
+	return s
+}
+
+type result struct {
+	Target          string
+	Vulnerabilities []Vulnerability
+}
+
+// parseResults reads the output of `trivy image --format json`, which is an
+// object with `Results` since Trivy 0.20, and a list of results before that.
+func parseResults(output []byte) ([]result, error) {
+	results := []result{}
+	if trimmed := bytes.TrimSpace(output); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, fmt.Errorf("Unable to parse trivy output: %v", err)
+		}
+		return results, nil
+	}
+	report := struct {
+		Results []result
+	}{}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, fmt.Errorf("Unable to parse trivy output: %v", err)
+	}
+	return report.Results, nil
+}
+
+// severitiesFrom is severity and every severity above it.
+func severitiesFrom(severity string) ([]string, error) {
+	if severity == "" {
+		severity = DefaultSeverity
+	}
+	for i, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return Severities[i:], nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid `scan.severity` '%v', must be one of [ %v ]", severity, strings.Join(Severities, ", "))
+}
+
+// scanned are the vulnerabilities found in each image already scanned during
+// this run, so that images shared by namespaces and contexts are scanned once.
+var scanned = make(map[string][]Vulnerability)
+var scannedMtx sync.Mutex
+
+// Image scans image with `trivy image`, returning its vulnerabilities of
+// `scan.severity` or above.
+func Image(ctx *ankh.ExecutionContext, image string) ([]Vulnerability, error) {
+	scannedMtx.Lock()
+	defer scannedMtx.Unlock()
+	if vulnerabilities, ok := scanned[image]; ok {
+		return vulnerabilities, nil
+	}
+
+	config := ctx.AnkhConfig.Scan
+	severities, err := severitiesFrom(config.Severity)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"image", "--quiet", "--format", "json", "--severity", strings.Join(severities, ",")}
+	if config.IgnoreUnfixed {
+		args = append(args, "--ignore-unfixed")
+	}
+	if config.Server != "" {
+		args = append(args, "--server", config.Server)
+	}
+	trivyCmd := execCommand("trivy", append(args, image)...)
+	var stdout, stderr bytes.Buffer
+	trivyCmd.Stdout = &stdout
+	trivyCmd.Stderr = &stderr
+
+	ctx.Logger.Infof("Scanning image %v for vulnerabilities", image)
+	ctx.Logger.Debugf("Running trivy cmd %+v", trivyCmd.Args)
+	if err := trivyCmd.Run(); err != nil {
+		return nil, fmt.Errorf("Failed to scan image '%v': %v -- the trivy process had the following output:\n%s%s",
+			image, err, stdout.String(), stderr.String())
+	}
+
+	results, err := parseResults(stdout.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	vulnerabilities := []Vulnerability{}
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, v := range r.Vulnerabilities {
+			// Trivy filters by severity too, but not every version of it.
+			key := v.VulnerabilityID + " " + v.PkgName
+			if seen[key] || !containsFold(severities, v.Severity) {
+				continue
+			}
+			seen[key] = true
+			vulnerabilities = append(vulnerabilities, v)
+		}
+	}
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		return severityRank(vulnerabilities[i].Severity) > severityRank(vulnerabilities[j].Severity)
+	})
+	scanned[image] = vulnerabilities
+	return vulnerabilities, nil
+}
+
+func containsFold(slice []string, s string) bool {
+	for _, v := range slice {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Images scans each of images, returning an error for each image that has
+// vulnerabilities of `scan.severity` or above.
+func Images(ctx *ankh.ExecutionContext, images []string) ([]error, error) {
+	severities, err := severitiesFrom(ctx.AnkhConfig.Scan.Severity)
+	if err != nil {
+		return nil, err
+	}
+	errs := []error{}
+	for _, image := range images {
+		vulnerabilities, err := Image(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		if len(vulnerabilities) == 0 {
+			continue
+		}
+		lines := []string{}
+		for _, v := range vulnerabilities {
+			lines = append(lines, "  "+v.String())
+		}
+		errs = append(errs, fmt.Errorf("Image '%v' has %v vulnerabilities of severity %v or above:\n%v",
+			image, len(vulnerabilities), severities[0], strings.Join(lines, "\n")))
+	}
+	return errs, nil
+}
@@ -0,0 +1,79 @@
+package scan
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+const scanTestResult = `{
+  "SchemaVersion": 2,
+  "ArtifactName": "registry.example.com/web:1.2.3",
+  "Results": [
+    {
+      "Target": "registry.example.com/web:1.2.3 (debian 12.1)",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2023-0001", "PkgName": "libssl3", "InstalledVersion": "3.0.9", "FixedVersion": "3.0.11", "Severity": "HIGH"},
+        {"VulnerabilityID": "CVE-2023-0002", "PkgName": "zlib1g", "InstalledVersion": "1.2.13", "Severity": "MEDIUM"},
+        {"VulnerabilityID": "CVE-2023-0003", "PkgName": "libc6", "InstalledVersion": "2.36", "FixedVersion": "2.36-9", "Severity": "CRITICAL"}
+      ]
+    },
+    {"Target": "app/go.sum"}
+  ]
+}`
+
+func TestImages(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	var args []string
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		args = arg
+		result := "[]"
+		if arg[len(arg)-1] == "registry.example.com/web:1.2.3" {
+			result = scanTestResult
+		}
+		cmd := exec.Command("sh", "-c", `printf '%s' "$RESULT"`)
+		cmd.Env = []string{"RESULT=" + result}
+		return cmd
+	}
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New()}
+	ctx.AnkhConfig.Scan = ankh.ScanConfig{Enabled: true, Server: "http://trivy:4954", IgnoreUnfixed: true}
+	errs, err := Images(ctx, []string{"registry.example.com/web:1.2.3", "busybox"})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if expected := "image --quiet --format json --severity HIGH,CRITICAL --ignore-unfixed --server http://trivy:4954 busybox"; strings.Join(args, " ") != expected {
+		t.Logf("expected trivy args '%v' but got %v", expected, args)
+		t.Fail()
+	}
+	if len(errs) != 1 {
+		t.Logf("expected an error for one image but got %v", errs)
+		t.FailNow()
+	}
+	expected := "Image 'registry.example.com/web:1.2.3' has 2 vulnerabilities of severity HIGH or above:\n" +
+		"  CVE-2023-0003 (CRITICAL) in libc6 2.36, fixed in 2.36-9\n" +
+		"  CVE-2023-0001 (HIGH) in libssl3 3.0.9, fixed in 3.0.11"
+	if errs[0].Error() != expected {
+		t.Logf("expected error '%v' but got '%v'", expected, errs[0])
+		t.Fail()
+	}
+
+	ctx.AnkhConfig.Scan.Severity = "severe"
+	if _, err := Images(ctx, []string{"busybox"}); err == nil {
+		t.Log("expected an error for an invalid severity")
+		t.Fail()
+	}
+}
+
+func TestParseResults(t *testing.T) {
+	results, err := parseResults([]byte(`[{"Target": "web", "Vulnerabilities": [{"VulnerabilityID": "CVE-2020-0001", "Severity": "LOW"}]}]`))
+	if err != nil || len(results) != 1 || len(results[0].Vulnerabilities) != 1 {
+		t.Logf("expected the results of older versions of trivy to parse but got %+v and error %v", results, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,218 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/appnexus/ankh/context"
+	"github.com/appnexus/ankh/util"
+)
+
+// DefaultLocation is where schemas are fetched from, unless `lint.schemaLocation`
+// is set. Locations are templates with the same fields as kubeconform's
+// `-schema-location`, so mirrors made for kubeconform work here too.
+const DefaultLocation = "https://raw.githubusercontent.com/yannh/kubernetes-json-schema/master/" +
+	"{{ .NormalizedKubernetesVersion }}-standalone{{ .StrictSuffix }}/{{ .ResourceKind }}{{ .KindSuffix }}.json"
+
+type locationParams struct {
+	NormalizedKubernetesVersion string
+	StrictSuffix                string
+	ResourceKind                string
+	ResourceAPIVersion          string
+	Group                       string
+	KindSuffix                  string
+}
+
+// NormalizeVersion turns versions like `1.21` or `v1.21.3` into the form used
+// by schema locations, eg: `v1.21.0`. The empty string becomes `master`.
+func NormalizeVersion(version string) string {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if version == "" || version == "master" {
+		return "master"
+	}
+	tokens := strings.Split(version, ".")
+	for len(tokens) < 3 {
+		tokens = append(tokens, "0")
+	}
+	return "v" + strings.Join(tokens[:3], ".")
+}
+
+// schemaURL renders location for an object's apiVersion and kind.
+func schemaURL(location string, kubernetesVersion string, apiVersion string, kind string) (string, error) {
+	group, version := "", apiVersion
+	if tokens := strings.SplitN(apiVersion, "/", 2); len(tokens) == 2 {
+		group, version = tokens[0], tokens[1]
+	}
+	params := locationParams{
+		NormalizedKubernetesVersion: NormalizeVersion(kubernetesVersion),
+		StrictSuffix:                "-strict",
+		ResourceKind:                strings.ToLower(kind),
+		ResourceAPIVersion:          version,
+		Group:                       group,
+		KindSuffix:                  "-" + version,
+	}
+	if group != "" {
+		params.KindSuffix = "-" + strings.Split(group, ".")[0] + "-" + version
+	}
+
+	t, err := template.New("location").Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("Invalid schema location '%v': %v", location, err)
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, params); err != nil {
+		return "", fmt.Errorf("Invalid schema location '%v': %v", location, err)
+	}
+	return out.String(), nil
+}
+
+// errNoSchema means there is no schema for a kind, eg: for custom resources.
+var errNoSchema = fmt.Errorf("no schema")
+
+func fetchSchema(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		body, err := ioutil.ReadFile(url)
+		if os.IsNotExist(err) {
+			return nil, errNoSchema
+		}
+		return body, err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch schema from URL '%s': %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return nil, errNoSchema
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Non-200 status code when fetching schema from URL '%s': %v", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Validator validates objects against schemas for one Kubernetes version.
+// Schemas for a version never change, so they are cached under cacheDir
+// indefinitely, and only fetched the first time they are needed.
+type Validator struct {
+	ctx               *ankh.ExecutionContext
+	location          string
+	kubernetesVersion string
+	cacheDir          string
+	schemas           map[string]map[string]interface{}
+}
+
+func NewValidator(ctx *ankh.ExecutionContext, location string, kubernetesVersion string) *Validator {
+	if location == "" {
+		location = DefaultLocation
+	}
+	return &Validator{
+		ctx:               ctx,
+		location:          location,
+		kubernetesVersion: kubernetesVersion,
+		cacheDir:          ctx.SchemaCacheDir,
+		schemas:           make(map[string]map[string]interface{}),
+	}
+}
+
+func (v *Validator) cachePath(url string) string {
+	return filepath.Join(v.cacheDir, NormalizeVersion(v.kubernetesVersion), filepath.Base(url))
+}
+
+// schema returns the schema for an apiVersion and kind, or nil if there isn't one.
+func (v *Validator) schema(apiVersion string, kind string) (map[string]interface{}, error) {
+	url, err := schemaURL(v.location, v.kubernetesVersion, apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+	if schema, ok := v.schemas[url]; ok {
+		return schema, nil
+	}
+
+	cachePath := v.cachePath(url)
+	body, err := ioutil.ReadFile(cachePath)
+	if err == nil {
+		v.ctx.Logger.Debugf("Using cached schema %v for %v", cachePath, url)
+	} else {
+		body, err = fetchSchema(url)
+		if err == errNoSchema {
+			v.ctx.Logger.Debugf("No schema for %v %v at %v", apiVersion, kind, url)
+			v.schemas[url] = nil
+			return nil, nil
+		}
+		if err != nil {
+			// Don't try again for every object of this kind.
+			v.schemas[url] = nil
+			return nil, err
+		}
+		if v.cacheDir != "" {
+			if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+				v.ctx.Logger.Warnf("Unable to make schema cache dir '%s': %v", filepath.Dir(cachePath), err)
+			} else if err := ioutil.WriteFile(cachePath, body, 0600); err != nil {
+				v.ctx.Logger.Warnf("Unable to cache schema '%s': %v", url, err)
+			}
+		}
+	}
+
+	schema := make(map[string]interface{})
+	if err := json.Unmarshal(body, &schema); err != nil {
+		return nil, fmt.Errorf("Unable to parse schema '%v': %v", url, err)
+	}
+	v.schemas[url] = schema
+	return schema, nil
+}
+
+// Validate checks every object in helmOutput against its schema, returning
+// an error for each problem found. Objects without a schema, like custom
+// resources, are skipped. Output that can't be parsed is an error too.
+func (v *Validator) Validate(helmOutput string) []error {
+	errors := []error{}
+	docs := util.NewYAMLDocuments(helmOutput)
+	for {
+		var doc interface{}
+		if !docs.Next(&doc) {
+			break
+		}
+		obj, ok := util.NormalizeYAMLMap(doc).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		if kind == "" {
+			continue
+		}
+		name := ""
+		if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+			name, _ = metadata["name"].(string)
+		}
+
+		schema, err := v.schema(apiVersion, kind)
+		if err != nil {
+			v.ctx.Logger.Warnf("Skipping schema validation of %v '%v': %v", kind, name, err)
+			continue
+		}
+		if schema == nil {
+			v.ctx.Logger.Debugf("Skipping schema validation of %v '%v', which has no schema", kind, name)
+			continue
+		}
+		for _, problem := range validate(schema, obj, "") {
+			errors = append(errors, ankh.NewObjectError("schema", kind, name, "%v '%v' does not match the Kubernetes %v schema: %v",
+				kind, name, NormalizeVersion(v.kubernetesVersion), problem))
+		}
+	}
+	if err := docs.Err(); err != nil {
+		errors = append(errors, fmt.Errorf("Unable to parse templated output to validate it: %v", err))
+	}
+	return errors
+}
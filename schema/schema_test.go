@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/appnexus/ankh/context"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	for version, expected := range map[string]string{
+		"":        "master",
+		"master":  "master",
+		"1.21":    "v1.21.0",
+		"v1.21.3": "v1.21.3",
+		"1":       "v1.0.0",
+	} {
+		if actual := NormalizeVersion(version); actual != expected {
+			t.Errorf("NormalizeVersion(%q) = %q, expected %q", version, actual, expected)
+		}
+	}
+}
+
+func TestSchemaURL(t *testing.T) {
+	for _, test := range []struct {
+		apiVersion string
+		kind       string
+		expected   string
+	}{
+		{"apps/v1", "Deployment", "v1.21.0-standalone-strict/deployment-apps-v1.json"},
+		{"v1", "Service", "v1.21.0-standalone-strict/service-v1.json"},
+		{"networking.k8s.io/v1", "Ingress", "v1.21.0-standalone-strict/ingress-networking-v1.json"},
+	} {
+		url, err := schemaURL(DefaultLocation, "1.21", test.apiVersion, test.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(url, "/"+test.expected) {
+			t.Errorf("Expected URL for %v %v to end with %v, got %v", test.apiVersion, test.kind, test.expected, url)
+		}
+	}
+
+	if _, err := schemaURL("{{ .Nope", "1.21", "v1", "Service"); err == nil {
+		t.Errorf("Expected an error for an invalid location")
+	}
+}
+
+const schemaTestOutput = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: "3"
+  selector: {}
+  template:
+    spec:
+      containers:
+      - name: web
+        imagePullPolicy: Always
+        imagePullPolcy: Always
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: custom
+`
+
+func TestValidator(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "ankh-schema-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	location, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	location += "/{{ .NormalizedKubernetesVersion }}-standalone{{ .StrictSuffix }}/{{ .ResourceKind }}{{ .KindSuffix }}.json"
+
+	ctx := &ankh.ExecutionContext{Logger: logrus.New(), SchemaCacheDir: cacheDir}
+	errs := NewValidator(ctx, location, "1.21").Validate(schemaTestOutput)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", errs)
+	}
+	for i, expected := range []string{
+		"spec.replicas: expected integer or null, but found string",
+		"spec.template.spec.containers[0]: unknown field 'imagePullPolcy'",
+	} {
+		if !strings.HasPrefix(errs[i].Error(), "Deployment 'web' does not match the Kubernetes v1.21.0 schema") ||
+			!strings.HasSuffix(errs[i].Error(), expected) {
+			t.Errorf("Expected error %v to be about %v", errs[i], expected)
+		}
+	}
+
+	cached := filepath.Join(cacheDir, "v1.21.0", "deployment-apps-v1.json")
+	if _, err := os.Stat(cached); err != nil {
+		t.Fatalf("Expected schema to be cached at %v: %v", cached, err)
+	}
+
+	// Later runs use the cache, even when the location is gone.
+	errs = NewValidator(ctx, "/nonexistent/{{ .ResourceKind }}{{ .KindSuffix }}.json", "1.21").Validate(schemaTestOutput)
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 errors using the cached schema, got %v", errs)
+	}
+}
@@ -0,0 +1,221 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// validate checks value against the subset of JSON schema used by the
+// standalone Kubernetes schemas: types, enums, properties, required fields,
+// additional properties, items, and the oneOf/anyOf/allOf combinators. Each
+// problem is reported with the path to the offending field.
+func validate(schema map[string]interface{}, value interface{}, path string) []string {
+	problems := []string{}
+	if schema == nil {
+		return problems
+	}
+
+	if intOrString, _ := schema["x-kubernetes-int-or-string"].(bool); intOrString || schema["format"] == "int-or-string" {
+		if _, ok := value.(string); ok || isInteger(value) {
+			return problems
+		}
+		return append(problems, fmt.Sprintf("%v: expected an integer or string, but found %v", displayPath(path), typeName(value)))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !matchesType(types, value) {
+		return append(problems, fmt.Sprintf("%v: expected %v, but found %v", displayPath(path), strings.Join(types, " or "), typeName(value)))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && value != nil {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(normalizeNumber(e), normalizeNumber(value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allowed := []string{}
+			for _, e := range enum {
+				allowed = append(allowed, fmt.Sprintf("%v", e))
+			}
+			problems = append(problems, fmt.Sprintf("%v: '%v' is not one of [%v]", displayPath(path), value, strings.Join(allowed, ", ")))
+		}
+	}
+
+	for _, sub := range schemaList(schema["allOf"]) {
+		problems = append(problems, validate(sub, value, path)...)
+	}
+	if anyOf := schemaList(schema["anyOf"]); len(anyOf) > 0 && countMatches(anyOf, value, path) == 0 {
+		problems = append(problems, fmt.Sprintf("%v: does not match any of the allowed schemas", displayPath(path)))
+	}
+	if oneOf := schemaList(schema["oneOf"]); len(oneOf) > 0 && countMatches(oneOf, value, path) != 1 {
+		problems = append(problems, fmt.Sprintf("%v: does not match exactly one of the allowed schemas", displayPath(path)))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		problems = append(problems, validateObject(schema, v, path)...)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validate(items, item, fmt.Sprintf("%v[%v]", path, i))...)
+			}
+		}
+	}
+	return problems
+}
+
+func validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) []string {
+	problems := []string{}
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	required := []string{}
+	for _, r := range toList(schema["required"]) {
+		if name, ok := r.(string); ok {
+			required = append(required, name)
+		}
+	}
+	for _, name := range required {
+		if _, ok := obj[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%v: missing required field '%v'", displayPath(path), name))
+		}
+	}
+
+	keys := []string{}
+	for key, _ := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	preserveUnknown, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool)
+	for _, key := range keys {
+		fieldPath := joinPath(path, key)
+		if sub, ok := properties[key].(map[string]interface{}); ok {
+			problems = append(problems, validate(sub, obj[key], fieldPath)...)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional && !preserveUnknown {
+				problems = append(problems, fmt.Sprintf("%v: unknown field '%v'", displayPath(path), key))
+			}
+		case map[string]interface{}:
+			problems = append(problems, validate(additional, obj[key], fieldPath)...)
+		}
+	}
+	return problems
+}
+
+func countMatches(schemas []map[string]interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		if len(validate(sub, value, path)) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func toList(v interface{}) []interface{} {
+	list, _ := v.([]interface{})
+	return list
+}
+
+func schemaList(v interface{}) []map[string]interface{} {
+	schemas := []map[string]interface{}{}
+	for _, item := range toList(v) {
+		if m, ok := item.(map[string]interface{}); ok {
+			schemas = append(schemas, m)
+		}
+	}
+	return schemas
+}
+
+func schemaTypes(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := []string{}
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func isInteger(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int64, uint64:
+		return true
+	case float64:
+		return v == math.Trunc(v)
+	}
+	return false
+}
+
+// normalizeNumber makes numbers from YAML and JSON comparable.
+func normalizeNumber(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return value
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if isInteger(value) {
+		return "integer"
+	}
+	if _, ok := normalizeNumber(value).(float64); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func matchesType(types []string, value interface{}) bool {
+	actual := typeName(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const validateTestSchema = `{
+  "type": "object",
+  "required": ["name"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string"},
+    "policy": {"type": "string", "enum": ["Always", "Never"]},
+    "port": {"x-kubernetes-int-or-string": true},
+    "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+    "extra": {"type": "object", "x-kubernetes-preserve-unknown-fields": true},
+    "args": {"type": "array", "items": {"type": "string"}}
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	schema := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(validateTestSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		value    map[string]interface{}
+		problems []string
+	}{
+		{"valid", map[string]interface{}{
+			"name":   "web",
+			"policy": "Always",
+			"port":   8080,
+			"labels": map[string]interface{}{"app": "web"},
+			"extra":  map[string]interface{}{"anything": true},
+			"args":   []interface{}{"--verbose"},
+		}, []string{}},
+		{"string port", map[string]interface{}{"name": "web", "port": "http"}, []string{}},
+		{"missing required", map[string]interface{}{}, []string{"(root): missing required field 'name'"}},
+		{"unknown field", map[string]interface{}{"name": "web", "nmae": "web"}, []string{"(root): unknown field 'nmae'"}},
+		{"wrong type", map[string]interface{}{"name": 1}, []string{"name: expected string, but found integer"}},
+		{"bad enum", map[string]interface{}{"name": "web", "policy": "Sometimes"},
+			[]string{"policy: 'Sometimes' is not one of [Always, Never]"}},
+		{"bad int or string", map[string]interface{}{"name": "web", "port": true},
+			[]string{"port: expected an integer or string, but found boolean"}},
+		{"bad label", map[string]interface{}{"name": "web", "labels": map[string]interface{}{"app": 1}},
+			[]string{"labels.app: expected string, but found integer"}},
+		{"bad item", map[string]interface{}{"name": "web", "args": []interface{}{"ok", 2}},
+			[]string{"args[1]: expected string, but found integer"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			problems := validate(schema, test.value, "")
+			if !reflect.DeepEqual(problems, test.problems) {
+				t.Errorf("Expected %v, got %v", test.problems, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"strings"
+)
+
+// ciSystems are the environment variables that CI systems set, and the
+// systems that set them, checked in order.
+var ciSystems = []struct {
+	env  string
+	name string
+}{
+	{"GITHUB_ACTIONS", "GitHub Actions"},
+	{"GITLAB_CI", "GitLab CI"},
+	{"JENKINS_URL", "Jenkins"},
+	{"CIRCLECI", "CircleCI"},
+	{"TRAVIS", "Travis CI"},
+	{"BUILDKITE", "Buildkite"},
+	{"TEAMCITY_VERSION", "TeamCity"},
+	{"TF_BUILD", "Azure Pipelines"},
+	{"BITBUCKET_BUILD_NUMBER", "Bitbucket Pipelines"},
+	{"CODEBUILD_BUILD_ID", "AWS CodeBuild"},
+	{"DRONE", "Drone"},
+}
+
+func envSet(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false", "no":
+		return false
+	}
+	return true
+}
+
+// DetectCI returns the name of the CI system that the environment read by
+// getenv belongs to, or "CI" for others that set `CI`, or "" outside of CI.
+func DetectCI(getenv func(string) string) string {
+	for _, system := range ciSystems {
+		if envSet(getenv(system.env)) {
+			return system.name
+		}
+	}
+	if envSet(getenv("CI")) {
+		return "CI"
+	}
+	return ""
+}
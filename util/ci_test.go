@@ -0,0 +1,25 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestDetectCI(t *testing.T) {
+	cases := []struct {
+		env      map[string]string
+		expected string
+	}{
+		{map[string]string{}, ""},
+		{map[string]string{"CI": "false"}, ""},
+		{map[string]string{"CI": "true"}, "CI"},
+		{map[string]string{"CI": "true", "GITHUB_ACTIONS": "true"}, "GitHub Actions"},
+		{map[string]string{"JENKINS_URL": "https://jenkins.example.com/"}, "Jenkins"},
+		{map[string]string{"TF_BUILD": "True"}, "Azure Pipelines"},
+	}
+	for _, c := range cases {
+		if ci := DetectCI(func(key string) string { return c.env[key] }); ci != c.expected {
+			t.Logf("expected '%v' for %v but got '%v'", c.expected, c.env, ci)
+			t.Fail()
+		}
+	}
+}
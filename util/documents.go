@@ -0,0 +1,130 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// maxDocumentSize is the largest YAML document that TransformDocuments reads.
+const maxDocumentSize = 16 * 1024 * 1024
+
+func isDocumentSeparator(line []byte) bool {
+	return string(bytes.TrimRight(line, " \t\r")) == "---"
+}
+
+// ScanDocuments is a bufio.SplitFunc that splits a stream of YAML into its
+// documents, on the `---` lines between them, which are left out.
+func ScanDocuments(data []byte, atEOF bool) (int, []byte, error) {
+	// Separators start a line, so look at the start, and after each newline followed by `---`.
+	line := 0
+	if !bytes.HasPrefix(data, []byte("---")) {
+		line = nextDocumentSeparator(data, 0)
+	}
+	for line >= 0 {
+		end := bytes.IndexByte(data[line:], '\n')
+		if end < 0 {
+			if !atEOF {
+				// Wait for the rest of the line, which may be a separator.
+				return 0, nil, nil
+			}
+			if isDocumentSeparator(data[line:]) {
+				return len(data), data[:line], nil
+			}
+			break
+		}
+		if isDocumentSeparator(data[line : line+end]) {
+			return line + end + 1, data[:line], nil
+		}
+		line = nextDocumentSeparator(data, line+end)
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// nextDocumentSeparator is the start of the next line from i that starts with `---`, or -1.
+func nextDocumentSeparator(data []byte, i int) int {
+	j := bytes.Index(data[i:], []byte("\n---"))
+	if j < 0 {
+		return -1
+	}
+	return i + j + 1
+}
+
+// TransformDocuments reads the YAML documents of r as they arrive, and writes
+// each to w after a `---` line, as transform returns it, unless transform
+// drops it. Documents that are only whitespace are dropped.
+func TransformDocuments(r io.Reader, w io.Writer, transform func(doc string) (string, bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxDocumentSize)
+	scanner.Split(ScanDocuments)
+	for scanner.Scan() {
+		doc := scanner.Text()
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		doc, keep, err := transform(doc)
+		if err != nil {
+			return err
+		}
+		if !keep {
+			continue
+		}
+		doc = strings.TrimPrefix(strings.TrimLeft(doc, "\n"), "---\n")
+		if !strings.HasSuffix(doc, "\n") {
+			doc += "\n"
+		}
+		if _, err := io.WriteString(w, "---\n"+doc); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// YAMLDocuments decodes the documents of a stream of YAML one at a time, like
+// a bufio.Scanner, eg:
+//
+//	docs := util.NewYAMLDocuments(helmOutput)
+//	for {
+//		obj := object{}
+//		if !docs.Next(&obj) {
+//			break
+//		}
+//		...
+//	}
+//	if err := docs.Err(); err != nil {
+//		...
+//	}
+type YAMLDocuments struct {
+	decoder *yaml.Decoder
+	err     error
+}
+
+// NewYAMLDocuments decodes the documents of input.
+func NewYAMLDocuments(input string) *YAMLDocuments {
+	return &YAMLDocuments{decoder: yaml.NewDecoder(strings.NewReader(input))}
+}
+
+// Next decodes the next document into v. It returns false at the end of the
+// input, or at the first document that can't be decoded, after which Err
+// returns why.
+func (d *YAMLDocuments) Next(v interface{}) bool {
+	if d.err != nil {
+		return false
+	}
+	d.err = d.decoder.Decode(v)
+	return d.err == nil
+}
+
+// Err is the error that stopped Next, or nil if it reached the end of the input.
+func (d *YAMLDocuments) Err() error {
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// slowReader returns a byte at a time, like a slow pipe.
+type slowReader struct {
+	r io.Reader
+}
+
+func (s slowReader) Read(p []byte) (int, error) {
+	return s.r.Read(p[:1])
+}
+
+func TestTransformDocuments(t *testing.T) {
+	input := "---\n# Source: a\nkind: ConfigMap\ndata:\n  x: \"---\"\n---\n\n---\n# Source: b\nkind: Secret\n---   \nkind: Service\n---"
+	var out bytes.Buffer
+	docs := []string{}
+	err := TransformDocuments(slowReader{strings.NewReader(input)}, &out, func(doc string) (string, bool, error) {
+		docs = append(docs, doc)
+		return strings.Replace(doc, "kind:", "Kind:", 1), !strings.Contains(doc, "Secret"), nil
+	})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	if len(docs) != 3 {
+		t.Logf("expected 3 documents but got %q", docs)
+		t.Fail()
+	}
+	expected := "---\n# Source: a\nKind: ConfigMap\ndata:\n  x: \"---\"\n---\nKind: Service\n"
+	if out.String() != expected {
+		t.Logf("expected %q but got %q", expected, out.String())
+		t.Fail()
+	}
+}
+
+func TestYAMLDocuments(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		kinds []string
+		err   bool
+	}{
+		{"---\n# Source: a\n---\nkind: ConfigMap\n---\nkind: Secret\n", []string{"", "ConfigMap", "Secret"}, false},
+		{"", []string{}, false},
+		{"kind: ConfigMap\n---\n- not an object\n---\nkind: Secret\n", []string{"ConfigMap"}, true},
+		{"kind: ConfigMap\n---\nkind: [\n", []string{"ConfigMap"}, true},
+	} {
+		docs := NewYAMLDocuments(test.input)
+		kinds := []string{}
+		for {
+			obj := struct{ Kind string }{}
+			if !docs.Next(&obj) {
+				break
+			}
+			kinds = append(kinds, obj.Kind)
+		}
+		if strings.Join(kinds, ",") != strings.Join(test.kinds, ",") || (docs.Err() != nil) != test.err {
+			t.Logf("expected kinds %q and error %v from %q, but got %q (%v)", test.kinds, test.err, test.input, kinds, docs.Err())
+			t.Fail()
+		}
+	}
+}
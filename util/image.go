@@ -0,0 +1,128 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// TagFormatTag is a bare image tag, eg: `1.2.3`, for charts that take `image.tag`.
+	TagFormatTag = "tag"
+	// TagFormatDigest is an image digest, eg: `sha256:...`, for charts that take `image.digest`.
+	TagFormatDigest = "digest"
+	// TagFormatRef is a full image reference, eg: `registry/web:1.2.3`, for charts that take `image`.
+	TagFormatRef = "ref"
+)
+
+var (
+	imageTagRegexp        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageDigestRegexp     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+	imageRepositoryRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9.-]+(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+)
+
+// ImageRef is a Docker image reference, or the parts of one that were given.
+type ImageRef struct {
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+func (r ImageRef) String() string {
+	s := r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// ParseImageRef parses a bare tag (eg: `1.2.3`), a bare digest (eg:
+// `sha256:...`), or a full image reference (eg: `registry:5000/web:1.2.3` or
+// `web@sha256:...`), validating each part.
+func ParseImageRef(s string) (ImageRef, error) {
+	ref := ImageRef{}
+	if imageDigestRegexp.MatchString(s) {
+		ref.Digest = s
+		return ref, nil
+	}
+	if !strings.ContainsAny(s, "/:@") {
+		if !imageTagRegexp.MatchString(s) {
+			return ref, fmt.Errorf("Invalid image tag '%v'", s)
+		}
+		ref.Tag = s
+		return ref, nil
+	}
+
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !imageDigestRegexp.MatchString(ref.Digest) {
+			return ref, fmt.Errorf("Invalid digest '%v' in image reference '%v'", ref.Digest, s)
+		}
+	}
+	// A `:` after the last `/` separates the tag, rather than a registry's port.
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+		if !imageTagRegexp.MatchString(ref.Tag) {
+			return ref, fmt.Errorf("Invalid tag '%v' in image reference '%v'", ref.Tag, s)
+		}
+	}
+	if !imageRepositoryRegexp.MatchString(name) {
+		return ref, fmt.Errorf("Invalid repository '%v' in image reference '%v'", name, s)
+	}
+	ref.Repository = name
+	return ref, nil
+}
+
+// ValidateTagFormat checks that format is one of `tag`, `digest` or `ref`, or empty for `tag`.
+func ValidateTagFormat(format string) error {
+	switch format {
+	case "", TagFormatTag, TagFormatDigest, TagFormatRef:
+		return nil
+	}
+	return fmt.Errorf("Invalid tag format '%v', must be one of `%v`, `%v`, or `%v`", format, TagFormatTag, TagFormatDigest, TagFormatRef)
+}
+
+// FormatTagValue converts value, a bare tag, a bare digest, or a full image
+// reference, into the format a chart takes for its tag value: the tag, with
+// its digest if it has one, the digest, or a full reference. Full references
+// to bare tags and digests use repository.
+func FormatTagValue(value string, format string, repository string) (string, error) {
+	if err := ValidateTagFormat(format); err != nil {
+		return "", err
+	}
+	ref, err := ParseImageRef(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case TagFormatDigest:
+		if ref.Digest == "" {
+			return "", fmt.Errorf("Expected an image digest, eg: `sha256:...`, but got '%v'", value)
+		}
+		return ref.Digest, nil
+	case TagFormatRef:
+		if ref.Repository == "" {
+			if repository == "" {
+				return "", fmt.Errorf("Expected a full image reference, but got '%v', and there's no image to use it with", value)
+			}
+			ref.Repository = repository
+		}
+		return ref.String(), nil
+	default:
+		if ref.Tag == "" {
+			return "", fmt.Errorf("Expected an image tag, but got '%v', which has no tag. Use a tag format of `%v` or `%v` for digests", value, TagFormatDigest, TagFormatRef)
+		}
+		if ref.Digest != "" {
+			// Keep the tag pinned, for charts that make `image:tag` refs.
+			return ref.Tag + "@" + ref.Digest, nil
+		}
+		return ref.Tag, nil
+	}
+}
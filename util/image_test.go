@@ -0,0 +1,69 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestParseImageRef(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	valid := map[string]ImageRef{
+		"1.2.3":                           {Tag: "1.2.3"},
+		digest:                            {Digest: digest},
+		"web:1.2.3":                       {Repository: "web", Tag: "1.2.3"},
+		"registry:5000/team/web":          {Repository: "registry:5000/team/web"},
+		"registry:5000/team/web:1.2.3":    {Repository: "registry:5000/team/web", Tag: "1.2.3"},
+		"web@" + digest:                   {Repository: "web", Digest: digest},
+		"registry.io/web:1.2.3@" + digest: {Repository: "registry.io/web", Tag: "1.2.3", Digest: digest},
+	}
+	for s, expected := range valid {
+		ref, err := ParseImageRef(s)
+		if err != nil || ref != expected {
+			t.Logf("expected '%v' to parse as %+v but got %+v, %v", s, expected, ref, err)
+			t.Fail()
+		}
+	}
+
+	for _, s := range []string{"", "-1.2.3", "Web:1.2.3", "web@sha256:short", "web:1.2.3:4"} {
+		if _, err := ParseImageRef(s); err == nil {
+			t.Logf("expected an error parsing '%v'", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestFormatTagValue(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	cases := []struct {
+		value, format, repository, expected string
+	}{
+		{"1.2.3", "", "", "1.2.3"},
+		{"registry/web:1.2.3", TagFormatTag, "", "1.2.3"},
+		{"registry/web:1.2.3@" + digest, TagFormatTag, "", "1.2.3@" + digest},
+		{"web@" + digest, TagFormatDigest, "", digest},
+		{"1.2.3", TagFormatRef, "registry/web", "registry/web:1.2.3"},
+		{digest, TagFormatRef, "registry/web", "registry/web@" + digest},
+		{"other/web:1.2.3", TagFormatRef, "registry/web", "other/web:1.2.3"},
+	}
+	for _, c := range cases {
+		value, err := FormatTagValue(c.value, c.format, c.repository)
+		if err != nil || value != c.expected {
+			t.Logf("expected '%v' with format '%v' to be '%v' but got '%v', %v", c.value, c.format, c.expected, value, err)
+			t.Fail()
+		}
+	}
+
+	errors := []struct {
+		value, format string
+	}{
+		{digest, TagFormatTag},
+		{"1.2.3", TagFormatDigest},
+		{"1.2.3", TagFormatRef},
+		{"1.2.3", "sha"},
+	}
+	for _, c := range errors {
+		if _, err := FormatTagValue(c.value, c.format, ""); err == nil {
+			t.Logf("expected an error for '%v' with format '%v'", c.value, c.format)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// JSONPath is a parsed kubectl-style JSONPath template, eg:
+// `{range .items[*]}{.metadata.name}{"\n"}{end}`. It supports the subset of
+// kubectl's syntax that scripts commonly use: text, quoted literals, field
+// paths with `[N]`, `[*]` and `.*`, and `range`/`end`. Missing fields print
+// nothing, like `kubectl get -o jsonpath`.
+type JSONPath struct {
+	nodes []jsonPathNode
+}
+
+type jsonPathNode struct {
+	text     string
+	path     []jsonPathSegment
+	isPath   bool
+	isRange  bool
+	children []jsonPathNode
+}
+
+type jsonPathSegment struct {
+	key   string
+	index int
+	all   bool
+}
+
+// ParseJSONPath parses a JSONPath template.
+func ParseJSONPath(template string) (*JSONPath, error) {
+	stack := [][]jsonPathNode{{}}
+	ranges := []jsonPathNode{}
+	for len(template) > 0 {
+		start := strings.Index(template, "{")
+		if start < 0 {
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: template})
+			break
+		}
+		if start > 0 {
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: template[:start]})
+		}
+		end := jsonPathExpressionEnd(template, start)
+		if end < 0 {
+			return nil, fmt.Errorf("Unclosed `{` in JSONPath template '%v'", template)
+		}
+		expression := strings.TrimSpace(template[start+1 : end])
+		template = template[end+1:]
+
+		switch {
+		case expression == "end":
+			if len(ranges) == 0 {
+				return nil, fmt.Errorf("JSONPath `{end}` without a `{range}`")
+			}
+			node := ranges[len(ranges)-1]
+			ranges = ranges[:len(ranges)-1]
+			node.children = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = append(stack[len(stack)-1], node)
+		case strings.HasPrefix(expression, "range "):
+			path, err := parseJSONPathSegments(strings.TrimSpace(strings.TrimPrefix(expression, "range ")))
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, jsonPathNode{path: path, isRange: true})
+			stack = append(stack, []jsonPathNode{})
+		case strings.HasPrefix(expression, "\""):
+			text, err := strconv.Unquote(expression)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JSONPath literal %v: %v", expression, err)
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: text})
+		default:
+			path, err := parseJSONPathSegments(expression)
+			if err != nil {
+				return nil, err
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{path: path, isPath: true})
+		}
+	}
+	if len(ranges) > 0 {
+		return nil, fmt.Errorf("JSONPath `{range}` without an `{end}`")
+	}
+	return &JSONPath{nodes: stack[0]}, nil
+}
+
+// jsonPathExpressionEnd finds the `}` closing the expression that starts at
+// start, skipping over quoted literals.
+func jsonPathExpressionEnd(template string, start int) int {
+	quoted := false
+	for i := start + 1; i < len(template); i++ {
+		switch {
+		case quoted && template[i] == '\\':
+			i++
+		case template[i] == '"':
+			quoted = !quoted
+		case !quoted && template[i] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseJSONPathSegments(path string) ([]jsonPathSegment, error) {
+	original := path
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), "@")
+	if path == "" || (path[0] != '.' && path[0] != '[') {
+		return nil, fmt.Errorf("Invalid JSONPath '%v', must start with `.`", original)
+	}
+
+	segments := []jsonPathSegment{}
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key := path[:end]
+			path = path[end:]
+			if key == "*" {
+				segments = append(segments, jsonPathSegment{all: true})
+			} else if key != "" {
+				segments = append(segments, jsonPathSegment{key: key, index: -1})
+			}
+		case '[':
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Unclosed `[` in JSONPath '%v'", original)
+			}
+			subscript := path[1:end]
+			path = path[end+1:]
+			if subscript == "*" {
+				segments = append(segments, jsonPathSegment{all: true})
+				continue
+			}
+			if quoted, err := strconv.Unquote(strings.Replace(subscript, "'", "\"", -1)); err == nil {
+				segments = append(segments, jsonPathSegment{key: quoted, index: -1})
+				continue
+			}
+			index, err := strconv.Atoi(subscript)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("Invalid subscript `[%v]` in JSONPath '%v'", subscript, original)
+			}
+			segments = append(segments, jsonPathSegment{index: index})
+		default:
+			return nil, fmt.Errorf("Invalid JSONPath '%v'", original)
+		}
+	}
+	return segments, nil
+}
+
+// jsonValue converts v to the generic form that encoding/json decodes into.
+func jsonValue(v interface{}) (interface{}, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	err = decoder.Decode(&value)
+	return value, err
+}
+
+func evalJSONPath(segments []jsonPathSegment, value interface{}) []interface{} {
+	results := []interface{}{value}
+	for _, segment := range segments {
+		next := []interface{}{}
+		for _, result := range results {
+			switch typed := result.(type) {
+			case map[string]interface{}:
+				if segment.all {
+					keys := []string{}
+					for key := range typed {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, typed[key])
+					}
+				} else if v, ok := typed[segment.key]; ok && segment.index < 0 {
+					next = append(next, v)
+				}
+			case []interface{}:
+				if segment.all {
+					next = append(next, typed...)
+				} else if segment.key == "" && segment.index < len(typed) {
+					next = append(next, typed[segment.index])
+				}
+			}
+		}
+		results = next
+	}
+	return results
+}
+
+func formatJSONPathValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case json.Number:
+		return typed.String()
+	case bool:
+		return strconv.FormatBool(typed)
+	default:
+		body, _ := json.Marshal(typed)
+		return string(body)
+	}
+}
+
+func executeJSONPath(nodes []jsonPathNode, value interface{}, out *bytes.Buffer) {
+	for _, node := range nodes {
+		switch {
+		case node.isRange:
+			items := evalJSONPath(node.path, value)
+			if len(items) == 1 {
+				if list, ok := items[0].([]interface{}); ok {
+					items = list
+				}
+			}
+			for _, item := range items {
+				executeJSONPath(node.children, item, out)
+			}
+		case node.isPath:
+			values := []string{}
+			for _, result := range evalJSONPath(node.path, value) {
+				values = append(values, formatJSONPathValue(result))
+			}
+			out.WriteString(strings.Join(values, " "))
+		default:
+			out.WriteString(node.text)
+		}
+	}
+}
+
+// Execute applies the template to v, after converting it to JSON.
+func (j *JSONPath) Execute(v interface{}) (string, error) {
+	value, err := jsonValue(v)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	executeJSONPath(j.nodes, value, &out)
+	return out.String(), nil
+}
+
+// parseCustomColumns parses a kubectl-style custom columns spec, eg:
+// `NAME:.metadata.name,NODE:.spec.nodeName`, into column names and paths.
+func parseCustomColumns(spec string) ([]string, [][]jsonPathSegment, error) {
+	if spec == "" {
+		return nil, nil, fmt.Errorf("Custom columns need a spec, eg: `NAME:.metadata.name,NODE:.spec.nodeName`")
+	}
+	names := []string{}
+	paths := [][]jsonPathSegment{}
+	for _, column := range strings.Split(spec, ",") {
+		tokens := strings.SplitN(column, ":", 2)
+		if len(tokens) != 2 || tokens[0] == "" {
+			return nil, nil, fmt.Errorf("Invalid custom column '%v', must be of the form `NAME:.json.path`", column)
+		}
+		path := strings.TrimSuffix(strings.TrimPrefix(tokens[1], "{"), "}")
+		segments, err := parseJSONPathSegments(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid custom column '%v': %v", column, err)
+		}
+		names = append(names, tokens[0])
+		paths = append(paths, segments)
+	}
+	return names, paths, nil
+}
+
+// ValidateCustomColumns checks a custom columns spec, eg: `NAME:.metadata.name,NODE:.spec.nodeName`.
+func ValidateCustomColumns(spec string) error {
+	_, _, err := parseCustomColumns(spec)
+	return err
+}
+
+// CustomColumns prints a table with a row for each of rows, like
+// `kubectl get -o custom-columns=SPEC`. Missing fields print as `<none>`.
+func CustomColumns(spec string, rows []interface{}) (string, error) {
+	names, paths, err := parseCustomColumns(spec)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	w := tabwriter.NewWriter(&out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, strings.Join(names, "\t"))
+	for _, row := range rows {
+		value, err := jsonValue(row)
+		if err != nil {
+			return "", err
+		}
+		cells := []string{}
+		for _, path := range paths {
+			values := []string{}
+			for _, result := range evalJSONPath(path, value) {
+				values = append(values, formatJSONPathValue(result))
+			}
+			if len(values) == 0 {
+				values = []string{"<none>"}
+			}
+			cells = append(cells, strings.Join(values, ","))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	return out.String(), nil
+}
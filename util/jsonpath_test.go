@@ -0,0 +1,66 @@
+package util
+
+import (
+	"testing"
+)
+
+var jsonPathTestObject = map[string]interface{}{
+	"items": []interface{}{
+		map[string]interface{}{"metadata": map[string]interface{}{"name": "web-1"}, "spec": map[string]interface{}{"nodeName": "node-a"},
+			"status": map[string]interface{}{"ready": true, "restarts": 2}},
+		map[string]interface{}{"metadata": map[string]interface{}{"name": "web-2"}},
+	},
+}
+
+func TestJSONPath(t *testing.T) {
+	for template, expected := range map[string]string{
+		`{.items[*].metadata.name}`:                                            "web-1 web-2",
+		`{.items[0].spec.nodeName}`:                                            "node-a",
+		`first: {.items[0].metadata.name}`:                                     "first: web-1",
+		`{.items[1].spec.nodeName}`:                                            "",
+		`{range .items[*]}{.metadata.name}{"\t"}{.status.restarts}{"\n"}{end}`: "web-1\t2\nweb-2\t\n",
+		`{range .items}{.metadata.name}{","}{end}`:                             "web-1,web-2,",
+		`{.items[0].status}`:                                                   `{"ready":true,"restarts":2}`,
+		`{.items[0].metadata['name']}`:                                         "web-1",
+	} {
+		jsonPath, err := ParseJSONPath(template)
+		if err != nil {
+			t.Logf("failed to parse '%v': %v", template, err)
+			t.Fail()
+			continue
+		}
+		out, err := jsonPath.Execute(jsonPathTestObject)
+		if err != nil || out != expected {
+			t.Logf("expected '%v' to produce '%v' but got '%v' (%v)", template, expected, out, err)
+			t.Fail()
+		}
+	}
+
+	for _, template := range []string{`{.items`, `{metadata.name}`, `{range .items[*]}{.name}`, `{end}`, `{.items[x]}`} {
+		if _, err := ParseJSONPath(template); err == nil {
+			t.Logf("expected '%v' to be invalid", template)
+			t.Fail()
+		}
+	}
+}
+
+func TestCustomColumns(t *testing.T) {
+	rows := jsonPathTestObject["items"].([]interface{})
+	out, err := CustomColumns("NAME:.metadata.name,NODE:{.spec.nodeName},READY:.status.ready", rows)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	expected := "NAME    NODE     READY\nweb-1   node-a   true\nweb-2   <none>   <none>\n"
+	if out != expected {
+		t.Logf("expected\n%v\nbut got\n%v", expected, out)
+		t.Fail()
+	}
+
+	for _, spec := range []string{"", "NAME", ":.metadata.name", "NAME:metadata.name"} {
+		if err := ValidateCustomColumns(spec); err == nil {
+			t.Logf("expected '%v' to be invalid", spec)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TextLogFormat = "text"
+	JSONLogFormat = "json"
+)
+
+// StableLogFields are in every line logged by JSONFormatter, empty when
+// they're unknown, so that log aggregators can always index them.
+var StableLogFields = []string{"mode", "context", "environment", "chart", "namespace"}
+
+// JSONFormatter logs each entry as a line of JSON, with `time`, `level` and
+// `msg`, the StableLogFields, and any fields of the entry.
+type JSONFormatter struct {
+	// Fields returns the current values of the StableLogFields, or others.
+	Fields func() logrus.Fields
+}
+
+func (f *JSONFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields)
+	for _, field := range StableLogFields {
+		data[field] = ""
+	}
+	if f.Fields != nil {
+		for k, v := range f.Fields() {
+			data[k] = v
+		}
+	}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data[k] = v
+	}
+	data["time"] = entry.Time.Format(time.RFC3339)
+	data["level"] = entry.Level.String()
+	data["msg"] = entry.Message
+
+	line, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal log entry to JSON: %v", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// ValidateLogFormat returns an error unless format is "text" or "json".
+func ValidateLogFormat(format string) error {
+	switch format {
+	case TextLogFormat, JSONLogFormat:
+		return nil
+	}
+	return fmt.Errorf("Invalid log format '%v'. Must be one of `%v` or `%v`", format, TextLogFormat, JSONLogFormat)
+}
+
+// PromptToStderr sends prompts to stderr, so that they don't end up amongst
+// logs or output that's being collected from stdout.
+func PromptToStderr() {
+	readline.Stdout = os.Stderr
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"sync"
+)
+
+// Pool runs funcs concurrently, with at most a limit of them running at once,
+// so that many operations don't all hit a server at the same time.
+type Pool struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+// NewPool returns a Pool that runs up to limit funcs at once. A limit below 1
+// is unlimited.
+func NewPool(limit int) *Pool {
+	p := &Pool{}
+	if limit > 0 {
+		p.sem = make(chan struct{}, limit)
+	}
+	return p
+}
+
+// Go runs f once there's room in the pool, waiting until there is, so that
+// funcs start in the order they're given.
+func (p *Pool) Go(f func()) {
+	if p.sem != nil {
+		p.sem <- struct{}{}
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if p.sem != nil {
+			defer func() { <-p.sem }()
+		}
+		f()
+	}()
+}
+
+// Wait waits for every func given to Go to return.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
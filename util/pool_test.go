@@ -0,0 +1,40 @@
+package util
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	var mtx sync.Mutex
+	running, most, done := 0, 0, 0
+	pool := NewPool(2)
+	for i := 0; i < 6; i++ {
+		pool.Go(func() {
+			mtx.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mtx.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mtx.Lock()
+			running--
+			done++
+			mtx.Unlock()
+		})
+	}
+	pool.Wait()
+
+	if done != 6 {
+		t.Logf("expected every func to run but %v did", done)
+		t.Fail()
+	}
+	if most != 2 {
+		t.Logf("expected at most 2 funcs to run at once but %v did", most)
+		t.Fail()
+	}
+}
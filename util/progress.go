@@ -0,0 +1,248 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const (
+	clearLineSequence = "\x1b[2K\r"
+	cursorUpSequence  = "\x1b[1A"
+)
+
+type progressTask struct {
+	name       string
+	stage      string
+	note       string
+	started    time.Time
+	stageStart time.Time
+	finished   time.Time
+	failed     bool
+}
+
+// Progress draws a line per task at the bottom of a terminal, with a spinner,
+// what the task is doing, and how long it's been at it. Anything written to
+// it is printed above those lines.
+type Progress struct {
+	out     io.Writer
+	mtx     sync.Mutex
+	tasks   []*progressTask
+	index   map[string]*progressTask
+	drawn   int
+	frame   int
+	paused  int
+	stopped bool
+	done    chan struct{}
+	now     func() time.Time
+}
+
+var activeProgress *Progress
+var activeProgressMtx sync.Mutex
+
+// NewProgress returns a Progress that draws to out, which must be a terminal.
+func NewProgress(out io.Writer) *Progress {
+	return &Progress{
+		out:   out,
+		index: make(map[string]*progressTask),
+		done:  make(chan struct{}),
+		now:   time.Now,
+	}
+}
+
+// Start redraws p every interval, until it's stopped.
+func (p *Progress) Start(interval time.Duration) {
+	activeProgressMtx.Lock()
+	activeProgress = p
+	activeProgressMtx.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.mtx.Lock()
+				p.frame++
+				p.redraw()
+				p.mtx.Unlock()
+			}
+		}
+	}()
+}
+
+// Stop draws p one last time, and leaves it on the terminal. Tasks that
+// haven't finished are marked as failed.
+func (p *Progress) Stop() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+	close(p.done)
+
+	activeProgressMtx.Lock()
+	if activeProgress == p {
+		activeProgress = nil
+	}
+	activeProgressMtx.Unlock()
+
+	for _, task := range p.tasks {
+		if task.finished.IsZero() {
+			task.finished = p.now()
+			task.failed = true
+		}
+	}
+	p.paused = 0
+	p.redraw()
+}
+
+// Set sets the stage of the task named name, adding it if it's new.
+func (p *Progress) Set(name string, stage string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := p.now()
+	task, ok := p.index[name]
+	if !ok {
+		task = &progressTask{name: name, started: now}
+		p.index[name] = task
+		p.tasks = append(p.tasks, task)
+	}
+	if task.stage != stage {
+		task.stage = stage
+		task.stageStart = now
+	}
+	task.finished = time.Time{}
+	p.redraw()
+}
+
+// Note sets a note shown after the task named name, eg: a summary of what it did.
+func (p *Progress) Note(name string, note string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if task, ok := p.index[name]; ok {
+		task.note = note
+		p.redraw()
+	}
+}
+
+// Finish marks the task named name as finished, with stage describing how.
+func (p *Progress) Finish(name string, stage string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if task, ok := p.index[name]; ok {
+		task.stage = stage
+		task.finished = p.now()
+		p.redraw()
+	}
+}
+
+// Write prints b above the tasks.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.erase()
+	n, err := p.out.Write(b)
+	p.redraw()
+	return n, err
+}
+
+// Pause erases the tasks, and stops drawing them until Resume is called, so
+// that something else can use the terminal, eg: to prompt.
+func (p *Progress) Pause() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.erase()
+	p.paused++
+}
+
+func (p *Progress) Resume() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.paused > 0 {
+		p.paused--
+	}
+	p.redraw()
+}
+
+// PauseProgress pauses the Progress that's running, if any, and returns a
+// func that resumes it.
+func PauseProgress() func() {
+	activeProgressMtx.Lock()
+	p := activeProgress
+	activeProgressMtx.Unlock()
+	if p == nil {
+		return func() {}
+	}
+	p.Pause()
+	return p.Resume
+}
+
+func (p *Progress) erase() {
+	if p.drawn > 0 {
+		p.out.Write([]byte(strings.Repeat(clearLineSequence+cursorUpSequence, p.drawn) + clearLineSequence))
+		p.drawn = 0
+	}
+}
+
+func (p *Progress) redraw() {
+	p.erase()
+	if p.paused > 0 || len(p.tasks) == 0 {
+		return
+	}
+	lines := p.render()
+	p.out.Write([]byte(lines))
+	if p.stopped {
+		// Leave the last drawing where it is, rather than erasing it with the next write.
+		p.drawn = 0
+		return
+	}
+	p.drawn = strings.Count(lines, "\n")
+}
+
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// render formats a line per task.
+func (p *Progress) render() string {
+	width := 0
+	for _, task := range p.tasks {
+		if len(task.name) > width {
+			width = len(task.name)
+		}
+	}
+
+	var out bytes.Buffer
+	now := p.now()
+	for _, task := range p.tasks {
+		switch {
+		case task.finished.IsZero():
+			fmt.Fprintf(&out, "%v %-*v  %v %v", spinnerFrames[p.frame%len(spinnerFrames)], width, task.name,
+				task.stage, formatElapsed(now.Sub(task.stageStart)))
+			if task.stageStart != task.started {
+				fmt.Fprintf(&out, " (%v total)", formatElapsed(now.Sub(task.started)))
+			}
+		case task.failed:
+			fmt.Fprintf(&out, "✗ %-*v  failed %v after %v", width, task.name, task.stage, formatElapsed(task.finished.Sub(task.started)))
+		default:
+			fmt.Fprintf(&out, "✓ %-*v  %v in %v", width, task.name, task.stage, formatElapsed(task.finished.Sub(task.started)))
+		}
+		if task.note != "" {
+			fmt.Fprintf(&out, ": %v", task.note)
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
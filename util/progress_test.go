@@ -0,0 +1,40 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestProgressRender(t *testing.T) {
+	var out bytes.Buffer
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	p := NewProgress(&out)
+	p.now = func() time.Time { return now }
+
+	p.Set("dev/web api", "templating")
+	p.Set("dev/web frontend", "templating")
+	now = now.Add(3 * time.Second)
+	p.Set("dev/web api", "applying")
+	now = now.Add(2 * time.Second)
+	p.Finish("dev/web frontend", "applied")
+	p.Note("dev/web frontend", "1 created")
+	now = now.Add(70 * time.Second)
+
+	expected := "⠋ dev/web api       applying 1m12s (1m15s total)\n" +
+		"✓ dev/web frontend  applied in 5s: 1 created\n"
+	if rendered := p.render(); rendered != expected {
+		t.Logf("expected '%v' but got '%v'", expected, rendered)
+		t.Fail()
+	}
+
+	out.Reset()
+	p.Stop()
+	expected = "✗ dev/web api       failed applying after 1m15s\n" +
+		"✓ dev/web frontend  applied in 5s: 1 created\n"
+	if !bytes.HasSuffix(out.Bytes(), []byte(expected)) {
+		t.Logf("expected output ending with '%v' but got '%v'", expected, out.String())
+		t.Fail()
+	}
+}
@@ -0,0 +1,118 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type transientError struct {
+	error
+	// after is how long to wait before retrying, at least, eg: per a Retry-After header.
+	after time.Duration
+}
+
+// Transient marks err as transient, so that Retry retries it, eg: for an
+// HTTP status that's worth retrying. It returns nil for a nil err.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{error: err}
+}
+
+// TransientAfter marks err as transient, like Transient, and as not worth
+// retrying until after has passed.
+func TransientAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{error: err, after: after}
+}
+
+// maxRetryAfter is the longest that Retry waits for a Retry-After header.
+const maxRetryAfter = time.Minute
+
+// RetryAfter is how long a Retry-After header, in seconds or as a date, asks
+// to wait, up to a minute. It's 0 when there isn't one.
+func RetryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	var after time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		after = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		after = date.Sub(now)
+	}
+	if after < 0 {
+		return 0
+	}
+	if after > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return after
+}
+
+// TransientHTTPStatus is true for the HTTP statuses worth retrying: server errors, and too many requests.
+func TransientHTTPStatus(code int) bool {
+	return code >= 500 || code == 429
+}
+
+// transientErrorRegexp matches the messages of errors that are clearly transient,
+// from Go's networking, from registries, and from kubectl and the API server.
+// It's limited to failures to reach a server, or a server saying it's
+// overloaded, since errors like `Internal error occurred`, which is also
+// how admission webhooks reject objects, or `unexpected EOF`, which is also
+// how malformed YAML fails, would fail the same way again.
+var transientErrorRegexp = regexp.MustCompile(`connection refused|connection reset by peer|broken pipe|i/o timeout|` +
+	`TLS handshake timeout|Client\.Timeout exceeded|server sent GOAWAY|status=5[0-9][0-9]|` +
+	`Unable to connect to the server|the server is currently unable to handle the request|` +
+	`etcdserver: request timed out|Too Many Requests`)
+
+// IsTransient is true for errors that are likely to go away if retried, like timeouts and refused connections.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(transientError); ok {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return transientErrorRegexp.MatchString(err.Error())
+}
+
+// Retry calls f up to attempts times while it fails with transient errors,
+// waiting backoff before the second attempt, and twice as long before each
+// one after that, or longer when the error says to wait longer. onRetry is
+// called before each wait. Once cancel is closed, it stops waiting, and
+// returns the last error.
+func Retry(attempts int, backoff time.Duration, cancel <-chan struct{}, f func() error, onRetry func(attempt int, wait time.Duration, err error)) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || attempt >= attempts || !IsTransient(err) {
+			return err
+		}
+		wait := backoff
+		if t, ok := err.(transientError); ok && t.after > wait {
+			wait = t.after
+		}
+		if onRetry != nil {
+			onRetry(attempt, wait, err)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-cancel:
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
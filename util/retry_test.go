@@ -0,0 +1,102 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{fmt.Errorf("dial tcp 10.0.0.1:443: connect: connection refused"), true},
+		{fmt.Errorf("Get https://registry/v2/: http: non-successful response (status=503 body=\"\")"), true},
+		{fmt.Errorf("Unable to connect to the server: net/http: TLS handshake timeout"), true},
+		{fmt.Errorf("error validating data: unknown field \"replica\""), false},
+		{fmt.Errorf("Received HTTP status '404 Not Found'"), false},
+		{fmt.Errorf("Internal error occurred: admission webhook \"policy.example.com\" denied the request"), false},
+		{fmt.Errorf("error converting YAML to JSON: yaml: line 3: unexpected EOF"), false},
+		{Transient(fmt.Errorf("Received HTTP status '502 Bad Gateway'")), true},
+	}
+	for _, c := range cases {
+		if transient := IsTransient(c.err); transient != c.expected {
+			t.Logf("expected IsTransient(%v) to be %v", c.err, c.expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	waits := []time.Duration{}
+	err := Retry(3, time.Millisecond, nil, func() error {
+		calls++
+		return fmt.Errorf("connection refused")
+	}, func(attempt int, wait time.Duration, err error) {
+		waits = append(waits, wait)
+	})
+	if err == nil || calls != 3 || len(waits) != 2 || waits[1] != 2*time.Millisecond {
+		t.Logf("expected 3 calls with a doubling backoff but got %v calls, waits %v, err %v", calls, waits, err)
+		t.Fail()
+	}
+
+	calls = 0
+	err = Retry(3, time.Millisecond, nil, func() error {
+		calls++
+		return fmt.Errorf("not found")
+	}, nil)
+	if err == nil || calls != 1 {
+		t.Logf("expected a single call for an error that isn't transient but got %v", calls)
+		t.Fail()
+	}
+
+	calls = 0
+	cancel := make(chan struct{})
+	close(cancel)
+	start := time.Now()
+	err = Retry(3, time.Hour, cancel, func() error {
+		calls++
+		return fmt.Errorf("connection refused")
+	}, nil)
+	if err == nil || calls != 1 || time.Since(start) > time.Minute {
+		t.Logf("expected canceling to stop the wait for a retry but got %v calls, err %v", calls, err)
+		t.Fail()
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"3600":                          time.Minute,
+		"Fri, 02 Jan 2026 03:04:35 GMT": 30 * time.Second,
+		"Fri, 02 Jan 2026 03:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for value, expected := range cases {
+		header := http.Header{}
+		if value != "" {
+			header.Set("Retry-After", value)
+		}
+		if after := RetryAfter(header, now); after != expected {
+			t.Logf("expected Retry-After '%v' to be %v but got %v", value, expected, after)
+			t.Fail()
+		}
+	}
+
+	waits := []time.Duration{}
+	Retry(2, time.Millisecond, nil, func() error {
+		return TransientAfter(fmt.Errorf("Too Many Requests"), 5*time.Millisecond)
+	}, func(attempt int, wait time.Duration, err error) {
+		waits = append(waits, wait)
+	})
+	if len(waits) != 1 || waits[0] != 5*time.Millisecond {
+		t.Logf("expected to wait as long as the error asked but got %v", waits)
+		t.Fail()
+	}
+}
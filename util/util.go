@@ -2,6 +2,7 @@ package util
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"gopkg.in/yaml.v2"
@@ -10,9 +11,12 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/manifoldco/promptui"
 	"github.com/sirupsen/logrus"
@@ -462,6 +466,8 @@ func FuzzySemVerCompare(s1, s2 string) bool {
 }
 
 func PromptForUsername() (string, error) {
+	defer PauseProgress()()
+
 	current_user, err := user.Current()
 	if err != nil {
 		return "", err
@@ -479,6 +485,8 @@ func PromptForUsername() (string, error) {
 }
 
 func PromptForPassword() (string, error) {
+	defer PauseProgress()()
+
 	passwordPrompt := promptui.Prompt{
 		Label: "Password:",
 		Mask:  '*',
@@ -492,6 +500,8 @@ func PromptForPassword() (string, error) {
 }
 
 func PromptForInput(defaultValue string, label string) (string, error) {
+	defer PauseProgress()()
+
 	prompt := promptui.Prompt{
 		Label:   label,
 		Default: defaultValue,
@@ -505,6 +515,8 @@ func PromptForInput(defaultValue string, label string) (string, error) {
 }
 
 func PromptForSelection(choices []string, label string) (string, error) {
+	defer PauseProgress()()
+
 	prompt := promptui.Select{
 		Label: label,
 		Items: choices,
@@ -537,3 +549,252 @@ func SemverBump(version string, semVerType string) (string, error) {
 
 	return v.String(), nil
 }
+
+// NormalizeYAMLMap recursively converts the map[interface{}]interface{} values
+// produced by the yaml library into map[string]interface{}, so that values
+// from different sources can be merged and used from go templates.
+func NormalizeYAMLMap(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{})
+		for k, val := range v {
+			out[fmt.Sprintf("%v", k)] = NormalizeYAMLMap(val)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for k, val := range v {
+			out[k] = NormalizeYAMLMap(val)
+		}
+		return out
+	case yaml.MapSlice:
+		out := make(map[string]interface{})
+		for _, item := range v {
+			out[fmt.Sprintf("%v", item.Key)] = NormalizeYAMLMap(item.Value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = NormalizeYAMLMap(val)
+		}
+		return out
+	default:
+		return in
+	}
+}
+
+// MergeValues deep merges src into dst, with values in src taking precedence.
+// Nested maps are merged recursively, and everything else is replaced.
+func MergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	return ValuesMerger{}.Merge(dst, src)
+}
+
+const (
+	// MergeReplace replaces lists, like helm does.
+	MergeReplace = "replace"
+	// MergeAppend appends lists to the lists they're merged into.
+	MergeAppend = "append"
+	// MergeByKey merges lists of maps by the value of a field, eg: `merge-by-key:name`,
+	// deep merging maps with the same value and appending the rest.
+	MergeByKey = "merge-by-key"
+)
+
+// ValidateMergeStrategy checks that strategy is one of `replace`, `append`, or `merge-by-key:FIELD`.
+func ValidateMergeStrategy(strategy string) error {
+	switch {
+	case strategy == MergeReplace, strategy == MergeAppend:
+		return nil
+	case strings.HasPrefix(strategy, MergeByKey+":") && len(strategy) > len(MergeByKey)+1:
+		return nil
+	}
+	return fmt.Errorf("Invalid merge strategy '%v', must be one of `%v`, `%v`, or `%v:FIELD`", strategy, MergeReplace, MergeAppend, MergeByKey)
+}
+
+// ValuesMerger deep merges values, using Strategies to decide how lists at
+// dotted key paths (eg: `env` or `web.tolerations`) are merged. Lists of maps
+// don't add to the path, so `containers.env` is the `env` of each container.
+type ValuesMerger struct {
+	Strategies map[string]string
+	// Explain, when set, is called with the path of each value that a merge sets, and how it set it.
+	Explain func(path string, how string)
+}
+
+func (m ValuesMerger) explain(path string, how string) {
+	if m.Explain != nil {
+		m.Explain(path, how)
+	}
+}
+
+// Merge deep merges src into dst, with values in src taking precedence.
+func (m ValuesMerger) Merge(dst, src map[string]interface{}) map[string]interface{} {
+	return m.merge(dst, src, "", "")
+}
+
+// merge merges src into dst at prefix. Explanations use displayPrefix, which
+// also says which item of a list merged by key is being merged.
+func (m ValuesMerger) merge(dst, src map[string]interface{}, prefix string, displayPrefix string) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{})
+	}
+	keys := []string{}
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := src[k]
+		path, displayPath := k, k
+		if prefix != "" {
+			path = prefix + "." + k
+			displayPath = displayPrefix + "." + k
+		}
+
+		existing, exists := dst[k]
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := existing.(map[string]interface{})
+		srcList, srcIsList := v.([]interface{})
+		dstList, dstIsList := existing.([]interface{})
+		strategy := m.Strategies[path]
+		switch {
+		case srcIsMap && dstIsMap:
+			dst[k] = m.merge(dstMap, srcMap, path, displayPath)
+		case srcIsMap && !exists:
+			// Explain each value in the new map.
+			dst[k] = m.merge(nil, srcMap, path, displayPath)
+		case srcIsList && dstIsList && strategy == MergeAppend:
+			dst[k] = append(append([]interface{}{}, dstList...), srcList...)
+			m.explain(displayPath, fmt.Sprintf("appended %v items to %v", len(srcList), len(dstList)))
+		case srcIsList && dstIsList && strings.HasPrefix(strategy, MergeByKey+":"):
+			dst[k] = m.mergeByKey(dstList, srcList, strings.TrimPrefix(strategy, MergeByKey+":"), path, displayPath)
+		case exists && reflect.DeepEqual(existing, v):
+			// Nothing to explain.
+		default:
+			dst[k] = v
+			if exists {
+				m.explain(displayPath, "replaced")
+			} else {
+				m.explain(displayPath, "set")
+			}
+		}
+	}
+	return dst
+}
+
+// mergeByKey merges the maps in src into the maps in dst with the same value of field.
+func (m ValuesMerger) mergeByKey(dst, src []interface{}, field string, path string, displayPath string) []interface{} {
+	out := append([]interface{}{}, dst...)
+	merged, appended := 0, 0
+	for _, item := range src {
+		srcItem, ok := item.(map[string]interface{})
+		found := false
+		if ok && srcItem[field] != nil {
+			for i, existing := range out {
+				dstItem, ok := existing.(map[string]interface{})
+				if ok && fmt.Sprintf("%v", dstItem[field]) == fmt.Sprintf("%v", srcItem[field]) {
+					out[i] = m.merge(copyValues(dstItem), srcItem, path, fmt.Sprintf("%v[%v=%v]", displayPath, field, srcItem[field]))
+					found = true
+					merged++
+					break
+				}
+			}
+		}
+		if !found {
+			out = append(out, item)
+			appended++
+		}
+	}
+	m.explain(displayPath, fmt.Sprintf("merged %v items by %v, and appended %v", merged, field, appended))
+	return out
+}
+
+// copyValues makes a shallow copy of values, so that merging into it leaves the original alone.
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range values {
+		out[k] = v
+	}
+	return out
+}
+
+// DiffValues returns the parts of values that differ from defaults: keys
+// that defaults doesn't have, or has with a different value. Maps in both are
+// compared key by key, and everything else, including lists, as a whole.
+func DiffValues(defaults, values map[string]interface{}) map[string]interface{} {
+	diff := make(map[string]interface{})
+	for k, v := range values {
+		existing, exists := defaults[k]
+		valuesMap, valuesIsMap := v.(map[string]interface{})
+		defaultsMap, defaultsIsMap := existing.(map[string]interface{})
+		switch {
+		case valuesIsMap && defaultsIsMap:
+			if nested := DiffValues(defaultsMap, valuesMap); len(nested) > 0 {
+				diff[k] = nested
+			}
+		case !exists || !reflect.DeepEqual(existing, v):
+			diff[k] = v
+		}
+	}
+	return diff
+}
+
+// SetValue sets a dotted key path (eg: `image.tag`) in values to value,
+// creating intermediate maps as necessary, similar to `helm --set`.
+func SetValue(values map[string]interface{}, key string, value interface{}) {
+	tokens := strings.Split(key, ".")
+	current := values
+	for _, token := range tokens[:len(tokens)-1] {
+		next, ok := current[token].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[token] = next
+		}
+		current = next
+	}
+	current[tokens[len(tokens)-1]] = value
+}
+
+// PrefixWriter writes each line with a prefix, serializing lines from multiple
+// PrefixWriters that share the same underlying writer and mutex.
+type PrefixWriter struct {
+	w      io.Writer
+	mtx    *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func NewPrefixWriter(w io.Writer, mtx *sync.Mutex, prefix string) *PrefixWriter {
+	return &PrefixWriter{w: w, mtx: mtx, prefix: prefix}
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes any remaining partial line.
+func (p *PrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+	return err
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+	return err
+}
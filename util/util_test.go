@@ -1,8 +1,12 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -50,6 +54,29 @@ func TestCustomFormatterFormat(t *testing.T) {
 	}
 }
 
+func TestJSONFormatterFormat(t *testing.T) {
+	formatter := JSONFormatter{Fields: func() logrus.Fields {
+		return logrus.Fields{"mode": "apply", "context": "staging", "namespace": "web"}
+	}}
+	entry := &logrus.Entry{
+		Message: "applied",
+		Level:   logrus.InfoLevel,
+		Time:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Data:    logrus.Fields{"namespace": "api", "error": fmt.Errorf("oops")},
+	}
+
+	result, err := formatter.Format(entry)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	expected := `{"chart":"","context":"staging","environment":"","error":"oops","level":"info","mode":"apply","msg":"applied","namespace":"api","time":"2020-01-02T03:04:05Z"}` + "\n"
+	if string(result) != expected {
+		t.Logf("expected '%s' but got '%s'", expected, result)
+		t.Fail()
+	}
+}
+
 // TODO
 func TestUntar(t *testing.T) {}
 
@@ -88,3 +115,125 @@ func TestMultiErrorFormat(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestMergeValues(t *testing.T) {
+	dst := map[string]interface{}{
+		"image": map[string]interface{}{"name": "app", "tag": "1.0"},
+		"port":  80,
+	}
+	src := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "2.0"},
+	}
+
+	result := MergeValues(dst, src)
+	image := result["image"].(map[string]interface{})
+	if image["name"] != "app" || image["tag"] != "2.0" || result["port"] != 80 {
+		t.Logf("got unexpected merge result %+v", result)
+		t.Fail()
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	values := map[string]interface{}{}
+	SetValue(values, "image.tag", "1.0")
+
+	image, ok := values["image"].(map[string]interface{})
+	if !ok || image["tag"] != "1.0" {
+		t.Logf("got unexpected values %+v", values)
+		t.Fail()
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	defaults := map[string]interface{}{
+		"image":    map[string]interface{}{"name": "app", "tag": "1.0"},
+		"replicas": 1,
+		"env":      []interface{}{"A"},
+	}
+	values := map[string]interface{}{
+		"image":    map[string]interface{}{"name": "app", "tag": "2.0"},
+		"replicas": 1,
+		"env":      []interface{}{"A", "B"},
+		"debug":    true,
+	}
+
+	expected := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "2.0"},
+		"env":   []interface{}{"A", "B"},
+		"debug": true,
+	}
+	if diff := DiffValues(defaults, values); !reflect.DeepEqual(diff, expected) {
+		t.Logf("expected diff %+v but got %+v", expected, diff)
+		t.Fail()
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var mtx sync.Mutex
+	w := NewPrefixWriter(&out, &mtx, "[pod] ")
+
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	w.Flush()
+
+	expected := "[pod] one\n[pod] two\n[pod] three\n"
+	if out.String() != expected {
+		t.Logf("expected '%s' but got '%s'", expected, out.String())
+		t.Fail()
+	}
+}
+
+func TestValuesMerger(t *testing.T) {
+	dst := map[string]interface{}{
+		"env":         []interface{}{"A"},
+		"tolerations": []interface{}{"a"},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "web", "image": "web:1"},
+		},
+	}
+	src := map[string]interface{}{
+		"env":         []interface{}{"B"},
+		"tolerations": []interface{}{"b"},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "web", "image": "web:2"},
+			map[string]interface{}{"name": "sidecar", "image": "sidecar:1"},
+		},
+	}
+	explained := []string{}
+	merger := ValuesMerger{
+		Strategies: map[string]string{"env": MergeAppend, "containers": "merge-by-key:name"},
+		Explain:    func(path string, how string) { explained = append(explained, path+": "+how) },
+	}
+	result := merger.Merge(dst, src)
+
+	expected := map[string]interface{}{
+		"env":         []interface{}{"A", "B"},
+		"tolerations": []interface{}{"b"},
+		"containers": []interface{}{
+			map[string]interface{}{"name": "web", "image": "web:2"},
+			map[string]interface{}{"name": "sidecar", "image": "sidecar:1"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Logf("expected %+v but got %+v", expected, result)
+		t.Fail()
+	}
+	expectedExplained := []string{
+		"containers[name=web].image: replaced",
+		"containers: merged 1 items by name, and appended 1",
+		"env: appended 1 items to 1",
+		"tolerations: replaced",
+	}
+	if !reflect.DeepEqual(explained, expectedExplained) {
+		t.Logf("expected explanations %v but got %v", expectedExplained, explained)
+		t.Fail()
+	}
+
+	for strategy, valid := range map[string]bool{"replace": true, "append": true, "merge-by-key:name": true, "merge-by-key:": false, "prepend": false} {
+		if err := ValidateMergeStrategy(strategy); (err == nil) != valid {
+			t.Logf("expected strategy '%v' to be valid: %v, but got %v", strategy, valid, err)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package vcs talks to the code hosts that CI runs for, to comment on the
+// pull request, or merge request, being built.
+package vcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// MaxCommentLength is a little under the smallest limit on comment length, which is GitHub's.
+const MaxCommentLength = 60000
+
+// PullRequest is the pull request, or merge request, that CI is running for.
+type PullRequest struct {
+	Provider string
+	APIURL   string
+	// Repo is `owner/name` on GitHub, or the project ID on GitLab.
+	Repo   string
+	Number int
+	Token  string
+}
+
+func (pr PullRequest) String() string {
+	if pr.Provider == GitLab {
+		return fmt.Sprintf("merge request !%v of project %v", pr.Number, pr.Repo)
+	}
+	return fmt.Sprintf("pull request #%v of %v", pr.Number, pr.Repo)
+}
+
+var gitHubRefRegexp = regexp.MustCompile(`^refs/pull/([0-9]+)/`)
+
+// gitHubPullRequestNumber reads the pull request number from the event that
+// triggered a GitHub Actions workflow, or from the ref it checked out.
+func gitHubPullRequestNumber(getenv func(string) string) int {
+	if path := getenv("GITHUB_EVENT_PATH"); path != "" {
+		event := struct {
+			Number      int `json:"number"`
+			PullRequest struct {
+				Number int `json:"number"`
+			} `json:"pull_request"`
+		}{}
+		if body, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(body, &event) == nil {
+			if event.PullRequest.Number > 0 {
+				return event.PullRequest.Number
+			}
+			if event.Number > 0 {
+				return event.Number
+			}
+		}
+	}
+	if match := gitHubRefRegexp.FindStringSubmatch(getenv("GITHUB_REF")); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		return n
+	}
+	return 0
+}
+
+// DetectPullRequest finds the pull request that GitHub Actions, or the merge
+// request that GitLab CI, is running for, from the environment that they set.
+// GitHub takes a token from `GITHUB_TOKEN`, and GitLab from `GITLAB_TOKEN`,
+// since its job tokens can't comment.
+func DetectPullRequest(getenv func(string) string) (PullRequest, error) {
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		pr := PullRequest{Provider: GitHub, APIURL: getenv("GITHUB_API_URL"), Repo: getenv("GITHUB_REPOSITORY"),
+			Number: gitHubPullRequestNumber(getenv), Token: getenv("GITHUB_TOKEN")}
+		if pr.APIURL == "" {
+			pr.APIURL = "https://api.github.com"
+		}
+		if pr.Number == 0 {
+			return pr, fmt.Errorf("This GitHub Actions workflow isn't running for a pull request")
+		}
+		if pr.Token == "" {
+			return pr, fmt.Errorf("Set `GITHUB_TOKEN` to comment on pull requests, eg: to `${{ secrets.GITHUB_TOKEN }}`")
+		}
+		return pr, nil
+	case getenv("GITLAB_CI") == "true":
+		pr := PullRequest{Provider: GitLab, APIURL: getenv("CI_API_V4_URL"), Repo: getenv("CI_PROJECT_ID"), Token: getenv("GITLAB_TOKEN")}
+		pr.Number, _ = strconv.Atoi(getenv("CI_MERGE_REQUEST_IID"))
+		if pr.Number == 0 {
+			return pr, fmt.Errorf("This GitLab CI pipeline isn't running for a merge request")
+		}
+		if pr.Token == "" {
+			return pr, fmt.Errorf("Set `GITLAB_TOKEN` to a token with the `api` scope to comment on merge requests")
+		}
+		return pr, nil
+	}
+	return PullRequest{}, fmt.Errorf("Unable to find a pull request to comment on. Only GitHub Actions and GitLab CI are supported")
+}
+
+// PostComment comments body on the pull request.
+func (pr PullRequest) PostComment(body string) error {
+	endpoint := ""
+	headers := map[string]string{"Content-Type": "application/json"}
+	switch pr.Provider {
+	case GitHub:
+		endpoint = fmt.Sprintf("%v/repos/%v/issues/%v/comments", strings.TrimSuffix(pr.APIURL, "/"), pr.Repo, pr.Number)
+		headers["Authorization"] = "token " + pr.Token
+		headers["Accept"] = "application/vnd.github+json"
+	case GitLab:
+		endpoint = fmt.Sprintf("%v/projects/%v/merge_requests/%v/notes", strings.TrimSuffix(pr.APIURL, "/"), url.PathEscape(pr.Repo), pr.Number)
+		headers["PRIVATE-TOKEN"] = pr.Token
+	default:
+		return fmt.Errorf("Unknown code host '%v'", pr.Provider)
+	}
+
+	payload, _ := json.Marshal(map[string]string{"body": body})
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Unable to comment on %v: %v: %v", pr, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+func lineCount(s string) int {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return 0
+	}
+	return strings.Count(s, "\n") + 1
+}
+
+// Truncate cuts s down to at most max bytes, at the end of a line, and
+// returns how many lines were cut.
+func Truncate(s string, max int) (string, int) {
+	if len(s) <= max {
+		return s, 0
+	}
+	kept := ""
+	if cut := strings.LastIndex(s[:max], "\n"); cut >= 0 {
+		kept = s[:cut+1]
+	}
+	return kept, lineCount(s) - lineCount(kept)
+}
@@ -0,0 +1,110 @@
+package vcs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDetectPullRequest(t *testing.T) {
+	event, err := ioutil.TempFile("", "ankh-event")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.Remove(event.Name())
+	event.WriteString(`{"action": "opened", "pull_request": {"number": 42}}`)
+	event.Close()
+
+	env := map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REPOSITORY": "appnexus/web",
+		"GITHUB_EVENT_PATH": event.Name(),
+		"GITHUB_TOKEN":      "secret",
+	}
+	pr, err := DetectPullRequest(func(key string) string { return env[key] })
+	expected := PullRequest{Provider: GitHub, APIURL: "https://api.github.com", Repo: "appnexus/web", Number: 42, Token: "secret"}
+	if err != nil || pr != expected {
+		t.Logf("expected %+v but got %+v, %v", expected, pr, err)
+		t.Fail()
+	}
+
+	env["GITHUB_EVENT_PATH"] = ""
+	env["GITHUB_REF"] = "refs/pull/7/merge"
+	if pr, err := DetectPullRequest(func(key string) string { return env[key] }); err != nil || pr.Number != 7 {
+		t.Logf("expected pull request 7 from GITHUB_REF but got %+v, %v", pr, err)
+		t.Fail()
+	}
+
+	env["GITHUB_REF"] = "refs/heads/master"
+	if _, err := DetectPullRequest(func(key string) string { return env[key] }); err == nil {
+		t.Logf("expected an error for a push to a branch")
+		t.Fail()
+	}
+
+	env = map[string]string{
+		"GITLAB_CI":            "true",
+		"CI_API_V4_URL":        "https://gitlab.example.com/api/v4",
+		"CI_PROJECT_ID":        "12",
+		"CI_MERGE_REQUEST_IID": "3",
+	}
+	if _, err := DetectPullRequest(func(key string) string { return env[key] }); err == nil {
+		t.Logf("expected an error without GITLAB_TOKEN")
+		t.Fail()
+	}
+	env["GITLAB_TOKEN"] = "secret"
+	pr, err = DetectPullRequest(func(key string) string { return env[key] })
+	expected = PullRequest{Provider: GitLab, APIURL: "https://gitlab.example.com/api/v4", Repo: "12", Number: 3, Token: "secret"}
+	if err != nil || pr != expected {
+		t.Logf("expected %+v but got %+v, %v", expected, pr, err)
+		t.Fail()
+	}
+}
+
+func TestPostComment(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("Authorization")+r.Header.Get("PRIVATE-TOKEN")+" "+body["body"])
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	for _, pr := range []PullRequest{
+		{Provider: GitHub, APIURL: server.URL, Repo: "appnexus/web", Number: 42, Token: "secret"},
+		{Provider: GitLab, APIURL: server.URL + "/api/v4", Repo: "12", Number: 3, Token: "secret"},
+	} {
+		if err := pr.PostComment("diff"); err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+	}
+	expected := []string{
+		"/repos/appnexus/web/issues/42/comments token secret diff",
+		"/api/v4/projects/12/merge_requests/3/notes secret diff",
+	}
+	if len(requests) != 2 || requests[0] != expected[0] || requests[1] != expected[1] {
+		t.Logf("expected requests %v but got %v", expected, requests)
+		t.Fail()
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	s := "one\ntwo\nthree\n"
+	if out, cut := Truncate(s, 100); out != s || cut != 0 {
+		t.Logf("expected '%v' to be left alone but got '%v', %v", s, out, cut)
+		t.Fail()
+	}
+	if out, cut := Truncate(s, 9); out != "one\ntwo\n" || cut != 1 {
+		t.Logf("expected 'one\\ntwo\\n' and 1 line cut but got '%v', %v", out, cut)
+		t.Fail()
+	}
+	if out, cut := Truncate(s, 2); out != "" || cut != 3 {
+		t.Logf("expected everything cut but got '%v', %v", out, cut)
+		t.Fail()
+	}
+}